@@ -233,7 +233,7 @@ func TestNewLoopAgent(t *testing.T) {
 			}
 
 			ignoreFields := []cmp.Option{
-				cmpopts.IgnoreFields(session.Event{}, "ID", "InvocationID", "Timestamp"),
+				cmpopts.IgnoreFields(session.Event{}, "ID", "InvocationID", "Timestamp", "Sequence"),
 				cmpopts.IgnoreFields(session.EventActions{}, "StateDelta"),
 				cmpopts.IgnoreFields(genai.FunctionCall{}, "ID"),
 				cmpopts.IgnoreFields(genai.FunctionResponse{}, "ID"),
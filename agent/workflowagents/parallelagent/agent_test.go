@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/genai"
 
 	"google.golang.org/adk/agent"
@@ -153,7 +154,9 @@ func TestNewParallelAgent(t *testing.T) {
 				slices.SortFunc(tt.wantEvents, eventCompareFunc)
 				slices.SortFunc(gotEvents, eventCompareFunc)
 
-				if diff := cmp.Diff(tt.wantEvents, gotEvents); diff != "" {
+				// The sub-agents append concurrently, the sequences of their
+				// events depend on the scheduling.
+				if diff := cmp.Diff(tt.wantEvents, gotEvents, cmpopts.IgnoreFields(session.Event{}, "Sequence")); diff != "" {
 					t.Errorf("events mismatch (-want +got):\n%s", diff)
 				}
 			}
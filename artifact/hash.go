@@ -0,0 +1,39 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"google.golang.org/genai"
+)
+
+// ContentHash returns the hash identifying the content of an artifact: the
+// hex encoded SHA-256 of its inline data and MIME type, or of its text.
+// Parts with the same content have the same hash.
+func ContentHash(part *genai.Part) string {
+	h := sha256.New()
+	if part.InlineData != nil {
+		h.Write([]byte("blob\x00"))
+		h.Write([]byte(part.InlineData.MIMEType))
+		h.Write([]byte{0})
+		h.Write(part.InlineData.Data)
+	} else {
+		h.Write([]byte("text\x00"))
+		h.Write([]byte(part.Text))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -34,14 +34,43 @@ import (
 // inMemoryService is an in-memory implementation of the Service.
 // It is primarily for testing and demonstration purposes.
 type inMemoryService struct {
+	cfg InMemoryServiceConfig
+
 	mu sync.RWMutex
 	// ordered(appName, userID, sessionID) -> session
 	artifacts omap.Map[string, *genai.Part]
+	// blobs holds the stored contents by hash when they are deduplicated.
+	blobs map[string]*blob
+}
+
+// blob is a stored content shared by the artifact versions having it.
+type blob struct {
+	part *genai.Part
+	// refs is the number of artifact versions referencing the blob.
+	refs int
 }
 
 // InMemoryService returns a new in-memory artifact service.
 func InMemoryService() Service {
-	return &inMemoryService{}
+	return InMemoryServiceWithConfig(InMemoryServiceConfig{})
+}
+
+// InMemoryServiceWithConfig returns a new in-memory artifact service using
+// the given config.
+func InMemoryServiceWithConfig(cfg InMemoryServiceConfig) Service {
+	return &inMemoryService{cfg: cfg, blobs: make(map[string]*blob)}
+}
+
+// InMemoryServiceConfig contains optional settings of the in-memory artifact
+// service. The zero value is a valid config.
+type InMemoryServiceConfig struct {
+	// Deduplicate stores identical contents once, however many artifact
+	// versions have them: versions with the same [ContentHash] share the
+	// stored part, which is released when the last of them is deleted. The
+	// hash is returned in [SaveResponse.Hash]. Loaded parts may be shared,
+	// callers must not modify them.
+	// Optional: by default every version stores its own part.
+	Deduplicate bool
 }
 
 // fileHasUserNamespace checks if a filename indicates a user scoped artifact.
@@ -124,9 +153,38 @@ func (s *inMemoryService) set(appName, userID, sessionID, fileName string, versi
 		FileName:  fileName,
 		Version:   version,
 	}.Encode()
+	if s.cfg.Deduplicate {
+		artifact = s.retain(artifact)
+	}
 	s.artifacts.Set(key, artifact)
 }
 
+// retain returns the stored blob with the content of the part, storing the
+// part as a new blob if there is none, and adds a reference to it.
+func (s *inMemoryService) retain(part *genai.Part) *genai.Part {
+	hash := ContentHash(part)
+	b, ok := s.blobs[hash]
+	if !ok {
+		b = &blob{part: part}
+		s.blobs[hash] = b
+	}
+	b.refs++
+	return b.part
+}
+
+// release removes a reference to the blob of the part, deleting the blob
+// with its last reference.
+func (s *inMemoryService) release(part *genai.Part) {
+	hash := ContentHash(part)
+	b, ok := s.blobs[hash]
+	if !ok {
+		return
+	}
+	if b.refs--; b.refs <= 0 {
+		delete(s.blobs, hash)
+	}
+}
+
 func (s *inMemoryService) delete(appName, userID, sessionID, fileName string, version int64) {
 	key := artifactKey{
 		AppName:   appName,
@@ -135,6 +193,11 @@ func (s *inMemoryService) delete(appName, userID, sessionID, fileName string, ve
 		FileName:  fileName,
 		Version:   version,
 	}.Encode()
+	if s.cfg.Deduplicate {
+		if artifact, ok := s.artifacts.Get(key); ok {
+			s.release(artifact)
+		}
+	}
 	s.artifacts.Delete(key)
 }
 
@@ -159,7 +222,11 @@ func (s *inMemoryService) Save(ctx context.Context, req *SaveRequest) (*SaveResp
 		nextVersion = internalVer + 1
 	}
 	s.set(appName, userID, sessionID, fileName, nextVersion, artifact)
-	return &SaveResponse{Version: nextVersion}, nil
+	resp := &SaveResponse{Version: nextVersion}
+	if s.cfg.Deduplicate {
+		resp.Hash = ContentHash(artifact)
+	}
+	return resp, nil
 }
 
 // Delete implements [artifact.Service]
@@ -186,6 +253,11 @@ func (s *inMemoryService) Delete(ctx context.Context, req *DeleteRequest) error
 	// pick the latest version
 	lo := artifactKey{AppName: appName, UserID: userID, SessionID: sessionID, FileName: fileName, Version: math.MaxInt64}.Encode()
 	hi := artifactKey{AppName: appName, UserID: userID, SessionID: sessionID, FileName: fileName}.Encode()
+	if s.cfg.Deduplicate {
+		for _, artifact := range s.scan(lo, hi) {
+			s.release(artifact)
+		}
+	}
 	s.artifacts.DeleteRange(lo, hi)
 	return nil
 }
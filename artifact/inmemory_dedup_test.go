@@ -0,0 +1,127 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestInMemoryService_Deduplicate(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{Deduplicate: true}).(*inMemoryService)
+	image := func() *genai.Part {
+		return genai.NewPartFromBytes([]byte("generated image"), "image/png")
+	}
+	save := func(sessionID, fileName string, part *genai.Part) *SaveResponse {
+		t.Helper()
+		resp, err := s.Save(ctx, &SaveRequest{AppName: "app", UserID: "user", SessionID: sessionID, FileName: fileName, Part: part})
+		if err != nil {
+			t.Fatalf("Save(%q, %q) failed: %v", sessionID, fileName, err)
+		}
+		return resp
+	}
+	refs := func(hash string) int {
+		t.Helper()
+		b, ok := s.blobs[hash]
+		if !ok {
+			return 0
+		}
+		return b.refs
+	}
+
+	first := save("s1", "a.png", image())
+	second := save("s1", "a.png", image())
+	third := save("s2", "b.png", image())
+	other := save("s1", "c.txt", genai.NewPartFromText("generated image"))
+
+	if first.Hash != ContentHash(image()) || second.Hash != first.Hash || third.Hash != first.Hash {
+		t.Errorf("Save hashes = %q, %q, %q, want %q", first.Hash, second.Hash, third.Hash, ContentHash(image()))
+	}
+	if other.Hash == first.Hash {
+		t.Errorf("text and image with the same bytes have the same hash %q", other.Hash)
+	}
+	if len(s.blobs) != 2 {
+		t.Errorf("got %d blobs stored, want 2", len(s.blobs))
+	}
+	if got := refs(first.Hash); got != 3 {
+		t.Errorf("image blob has %d references, want 3", got)
+	}
+	loaded, err := s.Load(ctx, &LoadRequest{AppName: "app", UserID: "user", SessionID: "s2", FileName: "b.png"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !bytes.Equal(loaded.Part.InlineData.Data, []byte("generated image")) {
+		t.Errorf("Load data = %q, want %q", loaded.Part.InlineData.Data, "generated image")
+	}
+
+	// Deleting a single version releases its reference only.
+	if err := s.Delete(ctx, &DeleteRequest{AppName: "app", UserID: "user", SessionID: "s1", FileName: "a.png", Version: first.Version}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := refs(first.Hash); got != 2 {
+		t.Errorf("after deleting a version, image blob has %d references, want 2", got)
+	}
+	// Deleting every version of a file releases all of theirs.
+	if err := s.Delete(ctx, &DeleteRequest{AppName: "app", UserID: "user", SessionID: "s1", FileName: "a.png"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := refs(first.Hash); got != 1 {
+		t.Errorf("after deleting the file, image blob has %d references, want 1", got)
+	}
+	if _, err := s.Load(ctx, &LoadRequest{AppName: "app", UserID: "user", SessionID: "s2", FileName: "b.png"}); err != nil {
+		t.Errorf("Load of the artifact still referencing the blob failed: %v", err)
+	}
+	// Deleting a missing version doesn't release anything.
+	if err := s.Delete(ctx, &DeleteRequest{AppName: "app", UserID: "user", SessionID: "s1", FileName: "a.png", Version: 7}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := refs(first.Hash); got != 1 {
+		t.Errorf("after deleting a missing version, image blob has %d references, want 1", got)
+	}
+
+	if err := s.Delete(ctx, &DeleteRequest{AppName: "app", UserID: "user", SessionID: "s2", FileName: "b.png"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := s.blobs[first.Hash]; ok {
+		t.Errorf("image blob is still stored after its last reference was deleted")
+	}
+	if len(s.blobs) != 1 {
+		t.Errorf("got %d blobs stored, want 1", len(s.blobs))
+	}
+	if _, err := s.Load(ctx, &LoadRequest{AppName: "app", UserID: "user", SessionID: "s2", FileName: "b.png"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load of the deleted artifact = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestInMemoryService_NoDeduplicate(t *testing.T) {
+	s := InMemoryService().(*inMemoryService)
+	for range 2 {
+		resp, err := s.Save(t.Context(), &SaveRequest{AppName: "app", UserID: "user", SessionID: "s", FileName: "f", Part: genai.NewPartFromText("same")})
+		if err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if resp.Hash != "" {
+			t.Errorf("Save hash = %q, want none without deduplication", resp.Hash)
+		}
+	}
+	if len(s.blobs) != 0 {
+		t.Errorf("got %d blobs stored without deduplication, want 0", len(s.blobs))
+	}
+}
@@ -27,3 +27,10 @@ func TestInMemoryArtifactService(t *testing.T) {
 	}
 	tests.TestArtifactService(t, "InMemory", factory)
 }
+
+func TestInMemoryArtifactService_Deduplicate(t *testing.T) {
+	factory := func(t *testing.T) (artifact.Service, error) {
+		return artifact.InMemoryServiceWithConfig(artifact.InMemoryServiceConfig{Deduplicate: true}), nil
+	}
+	tests.TestArtifactService(t, "InMemoryDeduplicate", factory)
+}
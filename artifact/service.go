@@ -107,6 +107,10 @@ func (req *SaveRequest) Validate() error {
 // SaveResponse is the return type of [ArtifactService.Save].
 type SaveResponse struct {
 	Version int64
+	// Hash is the [ContentHash] of the artifact, set by services
+	// deduplicating artifacts by content. Versions with the same hash share
+	// their stored content.
+	Hash string
 }
 
 // LoadRequest is the parameter for [ArtifactService.Load].
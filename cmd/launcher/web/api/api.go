@@ -33,6 +33,9 @@ import (
 type apiConfig struct {
 	frontendAddress string
 	sseWriteTimeout time.Duration
+	readOnly        bool
+	enableAdminAPI  bool
+	strictDecoding  bool
 }
 
 // apiLauncher can launch ADK REST API
@@ -71,13 +74,21 @@ func (a *apiLauncher) UserMessage(webURL string, printer func(v ...any)) {
 // SetupSubrouters adds the API router to the parent router.
 func (a *apiLauncher) SetupSubrouters(router *mux.Router, config *launcher.Config) error {
 	// Create the ADK REST API handler
-	apiHandler := adkrest.NewHandler(config, a.config.sseWriteTimeout)
+	apiHandler := adkrest.NewHandlerWithConfig(config, adkrest.ServerConfig{
+		SSEWriteTimeout: a.config.sseWriteTimeout,
+		ReadOnly:        a.config.readOnly,
+		EnableAdminAPI:  a.config.enableAdminAPI,
+		// The launcher has no authenticator, the flag opts into the
+		// unauthenticated admin routes.
+		InsecureAdminAPI: a.config.enableAdminAPI,
+		StrictDecoding:   a.config.strictDecoding,
+	})
 
 	// Wrap it with CORS middleware
 	corsHandler := corsWithArgs(a.config.frontendAddress)(apiHandler)
 
 	// Register it at the /api/ path
-	router.Methods("GET", "POST", "DELETE", "PATCH", "OPTIONS").PathPrefix("/api/").Handler(
+	router.Methods("GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS").PathPrefix("/api/").Handler(
 		http.StripPrefix("/api", corsHandler),
 	)
 
@@ -111,6 +122,9 @@ func NewLauncher() weblauncher.Sublauncher {
 	fs := flag.NewFlagSet("web", flag.ContinueOnError)
 	fs.StringVar(&config.frontendAddress, "webui_address", "localhost:8080", "ADK WebUI address as seen from the user browser. It's used to allow CORS requests. Please specify only hostname and (optionally) port.")
 	fs.DurationVar(&config.sseWriteTimeout, "sse-write-timeout", 120*time.Second, "SSE server write timeout (i.e. '10s', '2m' - see time.ParseDuration for details) - for writing the SSE response after reading the headers & body")
+	fs.BoolVar(&config.readOnly, "read-only", false, "Start the API in read-only mode: session writes fail with 503 while reads keep working")
+	fs.BoolVar(&config.strictDecoding, "strict-decoding", false, "Reject session request bodies with unknown JSON fields with 400 instead of ignoring the fields")
+	fs.BoolVar(&config.enableAdminAPI, "enable-admin-api", false, "Serve the unauthenticated /admin routes, e.g. for toggling the read-only mode at runtime")
 
 	return &apiLauncher{
 		config: config,
@@ -48,6 +48,9 @@ type Config struct {
 	ArtifactService artifact.Service
 	// optional
 	MemoryService memory.Service
+	// ProtectSystemState fails the runs whose agents write system state
+	// keys, see [session.KeyPrefixSystem], before their event is appended.
+	ProtectSystemState bool
 }
 
 // New creates a new [Runner].
@@ -71,6 +74,7 @@ func New(cfg Config) (*Runner, error) {
 		sessionService:  cfg.SessionService,
 		artifactService: cfg.ArtifactService,
 		memoryService:   cfg.MemoryService,
+		protectSystem:   cfg.ProtectSystemState,
 		parents:         parents,
 	}, nil
 }
@@ -84,6 +88,7 @@ type Runner struct {
 	sessionService  session.Service
 	artifactService artifact.Service
 	memoryService   memory.Service
+	protectSystem   bool
 
 	parents parentmap.Map
 }
@@ -161,6 +166,11 @@ func (r *Runner) Run(ctx context.Context, userID, sessionID string, msg *genai.C
 				continue
 			}
 
+			if err := r.checkAgentEvent(event); err != nil {
+				yield(nil, err)
+				return
+			}
+
 			// only commit non-partial event to a session service
 			if !event.LLMResponse.Partial {
 				if err := r.sessionService.AppendEvent(ctx, session, event); err != nil {
@@ -176,6 +186,18 @@ func (r *Runner) Run(ctx context.Context, userID, sessionID string, msg *genai.C
 	}
 }
 
+// checkAgentEvent returns an error if the event of an agent writes system
+// state keys while they are protected.
+func (r *Runner) checkAgentEvent(event *session.Event) error {
+	if !r.protectSystem {
+		return nil
+	}
+	if err := session.CheckSystemStateDelta(event.Actions.StateDelta); err != nil {
+		return fmt.Errorf("event of agent %q rejected: %w", event.Author, err)
+	}
+	return nil
+}
+
 func (r *Runner) appendMessageToSession(ctx agent.InvocationContext, storedSession session.Session, msg *genai.Content, saveInputBlobsAsArtifacts bool) error {
 	if msg == nil {
 		return nil
@@ -17,6 +17,7 @@ package runner
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"iter"
 	"strings"
@@ -370,3 +371,56 @@ func createSession(t *testing.T, ctx context.Context, sessionID, appName, userID
 
 	return resp.Session
 }
+
+func TestRunner_ProtectSystemState(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		protect bool
+		wantErr bool
+	}{
+		{name: "agent writes system state", protect: false},
+		{name: "agent write is rejected", protect: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := t.Context()
+			sessionService := session.InMemoryService()
+			if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+				t.Fatalf("sessionService.Create() error = %v", err)
+			}
+			testAgent := must(agent.New(agent.Config{
+				Name: "test_agent",
+				Run: func(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
+					return func(yield func(*session.Event, error) bool) {
+						event := session.NewEvent(ctx.InvocationID())
+						event.Author = "test_agent"
+						event.Actions.StateDelta["sys:tier"] = "gold"
+						yield(event, nil)
+					}
+				},
+			}))
+			r, err := New(Config{AppName: "testApp", Agent: testAgent, SessionService: sessionService, ProtectSystemState: tc.protect})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			var runErr error
+			for _, err := range r.Run(ctx, "testUser", "testSession", genai.NewContentFromText("hi", genai.RoleUser), agent.RunConfig{}) {
+				if err != nil {
+					runErr = err
+				}
+			}
+			if tc.wantErr != errors.Is(runErr, session.ErrSystemStateWrite) {
+				t.Fatalf("r.Run() error = %v, want ErrSystemStateWrite: %v", runErr, tc.wantErr)
+			}
+
+			resp, err := sessionService.Get(ctx, &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+			if err != nil {
+				t.Fatalf("sessionService.Get() error = %v", err)
+			}
+			_, err = resp.Session.State().Get("sys:tier")
+			if written := err == nil; written == tc.wantErr {
+				t.Errorf("system state written = %v, want %v", written, !tc.wantErr)
+			}
+		})
+	}
+}
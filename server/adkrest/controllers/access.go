@@ -0,0 +1,60 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"errors"
+	"net/http"
+)
+
+// AccessDenial is how the requests for resources the authenticated
+// principal may not access are answered.
+type AccessDenial int
+
+const (
+	// DenyAsNotFound answers 404 Not Found, with the same body as for a
+	// missing session, so that clients can't learn which resources of other
+	// users exist.
+	DenyAsNotFound AccessDenial = iota
+	// DenyAsForbidden answers 403 Forbidden with the reason of the denial,
+	// for deployments which prefer telling clients why they are turned
+	// away.
+	DenyAsForbidden
+)
+
+// deny answers a request denied for the reason.
+func (d AccessDenial) deny(rw http.ResponseWriter, reason string) {
+	if d == DenyAsForbidden {
+		http.Error(rw, reason, http.StatusForbidden)
+		return
+	}
+	writeNotFound(rw)
+}
+
+// error returns the error answering a request denied for the reason, for
+// the handlers returning their errors, see [NewErrorHandler].
+func (d AccessDenial) error(reason string) error {
+	if d == DenyAsForbidden {
+		return newStatusError(errors.New(reason), http.StatusForbidden)
+	}
+	return newStatusError(errors.New(http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+}
+
+// writeNotFound answers 404 Not Found for a missing session. The body
+// doesn't depend on the session, so that denials with [DenyAsNotFound]
+// can't be told apart from it.
+func writeNotFound(rw http.ResponseWriter) {
+	http.Error(rw, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+}
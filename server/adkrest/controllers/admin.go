@@ -0,0 +1,331 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// AdminAPIController is the controller for the Admin API.
+type AdminAPIController struct {
+	readOnly       *ReadOnlyMode
+	sessionService session.Service
+	streams        *StreamCounter
+	agentLoader    agent.Loader
+	settings       models.ServerSettings
+	audit          *AuditLog
+}
+
+// AdminAPIConfig contains the settings of the Admin API controller.
+type AdminAPIConfig struct {
+	// ReadOnly is the read-only switch toggled by the admin API.
+	ReadOnly *ReadOnlyMode
+	// SessionService provides the session statistics, when it implements
+	// [session.StatsService]. Optional.
+	SessionService session.Service
+	// Streams counts the SSE responses being served. Optional.
+	Streams *StreamCounter
+	// AgentLoader lists the apps searched by DeleteSessionsHandler when no
+	// app is given, in addition to the apps the session statistics know.
+	// Optional.
+	AgentLoader agent.Loader
+	// Settings is the effective server configuration reported by the
+	// ServerInfoHandler. Its read-only field is replaced by the current
+	// state of ReadOnly.
+	Settings models.ServerSettings
+	// Audit writes an audit record of every session deleted or whose
+	// system state is set, see [AuditLog]. Optional.
+	Audit *AuditLog
+}
+
+// NewAdminAPIController creates the controller for the Admin API.
+func NewAdminAPIController(readOnly *ReadOnlyMode) *AdminAPIController {
+	return NewAdminAPIControllerWithConfig(AdminAPIConfig{ReadOnly: readOnly})
+}
+
+// NewAdminAPIControllerWithConfig creates the controller for the Admin API
+// using the given config.
+func NewAdminAPIControllerWithConfig(config AdminAPIConfig) *AdminAPIController {
+	return &AdminAPIController{
+		readOnly:       config.ReadOnly,
+		sessionService: config.SessionService,
+		streams:        config.Streams,
+		agentLoader:    config.AgentLoader,
+		settings:       config.Settings,
+		audit:          config.Audit,
+	}
+}
+
+// ServerInfoHandler returns the effective configuration of the server and
+// its runtime statistics.
+func (c *AdminAPIController) ServerInfoHandler(rw http.ResponseWriter, req *http.Request) {
+	info := models.ServerInfo{Config: c.settings}
+	info.Config.ReadOnly = c.readOnly.Enabled()
+	if c.streams != nil {
+		info.Stats.ActiveStreams = c.streams.Active()
+	}
+	if statsService, ok := c.sessionService.(session.StatsService); ok {
+		stats, err := statsService.AppStats(req.Context())
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			writeError(rw, err)
+			return
+		}
+		if err == nil {
+			var sessions, events int64
+			for _, appStats := range stats {
+				sessions += int64(appStats.Sessions)
+				events += int64(appStats.Events)
+			}
+			info.Stats.Sessions, info.Stats.Events = &sessions, &events
+		}
+	}
+	EncodeJSONResponse(info, http.StatusOK, rw)
+}
+
+// GetReadOnlyHandler returns whether the server is in read-only mode.
+func (c *AdminAPIController) GetReadOnlyHandler(rw http.ResponseWriter, req *http.Request) {
+	EncodeJSONResponse(models.ReadOnlyStatus{ReadOnly: c.readOnly.Enabled()}, http.StatusOK, rw)
+}
+
+// SetReadOnlyHandler enables or disables the read-only mode of the server.
+func (c *AdminAPIController) SetReadOnlyHandler(rw http.ResponseWriter, req *http.Request) {
+	status := models.ReadOnlyStatus{}
+	if err := json.NewDecoder(req.Body).Decode(&status); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.readOnly.SetEnabled(status.ReadOnly)
+	EncodeJSONResponse(models.ReadOnlyStatus{ReadOnly: c.readOnly.Enabled()}, http.StatusOK, rw)
+}
+
+// DeleteSessionsHandler deletes the sessions matching the filter of the
+// request, for instance all the sessions of a user across apps. A dry run
+// only reports the matching sessions. Otherwise the request must carry the
+// number of sessions it expects to delete, and nothing is deleted with 409
+// Conflict if a different number matches, so that a mistyped filter can't
+// delete more than the dry run showed.
+func (c *AdminAPIController) DeleteSessionsHandler(rw http.ResponseWriter, req *http.Request) {
+	var deleteReq models.DeleteSessionsRequest
+	if err := json.NewDecoder(req.Body).Decode(&deleteReq); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if deleteReq.AppName == "" && deleteReq.UserID == "" && deleteReq.OlderThan == nil {
+		http.Error(rw, "at least one of appName, userId and olderThan is required", http.StatusBadRequest)
+		return
+	}
+	if !deleteReq.DryRun {
+		if deleteReq.ExpectedCount == nil {
+			http.Error(rw, "expectedCount is required to delete sessions, run with dryRun to get it", http.StatusBadRequest)
+			return
+		}
+		if c.readOnly.rejectWrite(rw) {
+			return
+		}
+	}
+	ctx := req.Context()
+	matching, err := c.matchingSessions(ctx, deleteReq)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	resp := models.DeleteSessionsResponse{DryRun: deleteReq.DryRun, Count: len(matching), Sessions: matching}
+	if deleteReq.DryRun {
+		EncodeJSONResponse(resp, http.StatusOK, rw)
+		return
+	}
+	if *deleteReq.ExpectedCount != len(matching) {
+		http.Error(rw, fmt.Sprintf("%d sessions match, expected %d: nothing was deleted", len(matching), *deleteReq.ExpectedCount), http.StatusConflict)
+		return
+	}
+	for i, s := range matching {
+		audited, err := c.audit.begin(req, AuditRecord{Operation: AuditDelete, AppName: s.AppName, UserID: s.UserID, SessionID: s.ID})
+		if err == nil {
+			err = c.sessionService.Delete(ctx, &session.DeleteRequest{AppName: s.AppName, UserID: s.UserID, SessionID: s.ID})
+			audited(err)
+		}
+		if err != nil {
+			// Deleting is idempotent: the request can be retried with the
+			// count of the remaining sessions.
+			writeError(rw, fmt.Errorf("deleted %d of %d sessions, failed to delete session %q of app %q: %w", i, len(matching), s.ID, s.AppName, err))
+			return
+		}
+	}
+	EncodeJSONResponse(resp, http.StatusOK, rw)
+}
+
+// SetSystemStateHandler applies a state delta to the system state keys of a
+// session, see [session.KeyPrefixSystem], which agents and clients can't
+// write when they are protected. Every key of the delta must be a system
+// key; a null value deletes the key. The delta is recorded by an event
+// authored by "system". It returns the updated session.
+//
+// The user of the session is the target_user_id route variable, user_id is
+// the admin's when the requests are authenticated.
+func (c *AdminAPIController) SetSystemStateHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.readOnly.rejectWrite(rw) {
+		return
+	}
+	vars := maps.Clone(mux.Vars(req))
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	vars["user_id"] = vars["target_user_id"]
+	sessionID, err := models.SessionIDFromHTTPParameters(vars)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	var patchReq models.PatchSessionStateDeltaRequest
+	if err := json.NewDecoder(req.Body).Decode(&patchReq); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(patchReq.StateDelta) == 0 {
+		http.Error(rw, "stateDelta is required", http.StatusBadRequest)
+		return
+	}
+	for _, key := range slices.Sorted(maps.Keys(patchReq.StateDelta)) {
+		if !strings.HasPrefix(key, session.KeyPrefixSystem) {
+			http.Error(rw, fmt.Sprintf("state key %q is not a system key, it must start with %s", key, session.KeyPrefixSystem), http.StatusBadRequest)
+			return
+		}
+		if directive, ok := patchReq.StateDelta[key].(map[string]any); ok && models.IsStateDirective(directive) {
+			http.Error(rw, fmt.Sprintf("state key %q: directives are not supported in system state", key), http.StatusBadRequest)
+			return
+		}
+	}
+	if c.sessionService == nil {
+		http.Error(rw, "no session service is configured", http.StatusNotImplemented)
+		return
+	}
+	ctx := req.Context()
+	resp, err := c.sessionService.Get(ctx, &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	event := newStateUpdateEvent("s-"+uuid.NewString(), patchReq.StateDelta)
+	event.Author = "system"
+	audited, err := c.audit.begin(req, AuditRecord{
+		Operation:   AuditPatch,
+		AppName:     sessionID.AppName,
+		UserID:      sessionID.UserID,
+		SessionID:   sessionID.ID,
+		ChangedKeys: auditKeys(patchReq.StateDelta),
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	err = c.sessionService.AppendEvent(ctx, resp.Session, event)
+	audited(err)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	respSession, err := models.FromSession(resp.Session)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(respSession, http.StatusOK, rw)
+}
+
+// matchingSessions lists the sessions matching the filter of the request,
+// by app, user and ID.
+func (c *AdminAPIController) matchingSessions(ctx context.Context, deleteReq models.DeleteSessionsRequest) ([]models.DeletedSession, error) {
+	if c.sessionService == nil {
+		return nil, newStatusError(errors.New("no session service is configured"), http.StatusNotImplemented)
+	}
+	apps := []string{deleteReq.AppName}
+	if deleteReq.AppName == "" {
+		var err error
+		if apps, err = c.appNames(ctx); err != nil {
+			return nil, err
+		}
+	}
+	matching := []models.DeletedSession{}
+	for _, appName := range apps {
+		listResp, err := c.sessionService.List(ctx, &session.ListRequest{AppName: appName, UserID: deleteReq.UserID})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range listResp.Sessions {
+			// The user filter is checked again, services may list the
+			// sessions of other users.
+			if deleteReq.UserID != "" && s.UserID() != deleteReq.UserID {
+				continue
+			}
+			if deleteReq.OlderThan != nil && !s.LastUpdateTime().Before(*deleteReq.OlderThan) {
+				continue
+			}
+			matching = append(matching, models.DeletedSession{AppName: s.AppName(), UserID: s.UserID(), ID: s.ID()})
+		}
+	}
+	slices.SortFunc(matching, func(a, b models.DeletedSession) int {
+		return cmp.Or(cmp.Compare(a.AppName, b.AppName), cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.ID, b.ID))
+	})
+	return matching, nil
+}
+
+// appNames returns the apps known to the session statistics and the agent
+// loader, sorted.
+func (c *AdminAPIController) appNames(ctx context.Context) ([]string, error) {
+	apps := map[string]bool{}
+	statsService, hasStats := c.sessionService.(session.StatsService)
+	if hasStats {
+		stats, err := statsService.AppStats(ctx)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return nil, err
+		}
+		hasStats = err == nil
+		for appName := range stats {
+			apps[appName] = true
+		}
+	}
+	if c.agentLoader != nil {
+		for _, appName := range c.agentLoader.ListAgents() {
+			apps[appName] = true
+		}
+	}
+	if !hasStats && c.agentLoader == nil {
+		return nil, newStatusError(errors.New("appName is required: the apps of the session service can't be listed"), http.StatusBadRequest)
+	}
+	return slices.Sorted(maps.Keys(apps)), nil
+}
@@ -0,0 +1,307 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func deletedSession(appName, userID, sessionID string) models.DeletedSession {
+	return models.DeletedSession{AppName: appName, UserID: userID, ID: sessionID}
+}
+
+func TestDeleteSessions(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	create := func(appName, userID, sessionID string) {
+		t.Helper()
+		if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: appName, UserID: userID, SessionID: sessionID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create("app1", "alice", "old")
+	create("app2", "alice", "old")
+	create("app1", "bob", "old")
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	create("app1", "alice", "new")
+	create("app2", "bob", "new")
+
+	apiController := controllers.NewAdminAPIControllerWithConfig(controllers.AdminAPIConfig{SessionService: sessionService})
+	deleteSessions := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, "/admin/sessions:delete", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		apiController.DeleteSessionsHandler(rr, req)
+		return rr
+	}
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) models.DeleteSessionsResponse {
+		t.Helper()
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var resp models.DeleteSessionsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+	remaining := func(t *testing.T) []models.DeletedSession {
+		t.Helper()
+		var sessions []models.DeletedSession
+		for _, appName := range []string{"app1", "app2"} {
+			resp, err := sessionService.List(ctx, &session.ListRequest{AppName: appName})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range resp.Sessions {
+				sessions = append(sessions, deletedSession(s.AppName(), s.UserID(), s.ID()))
+			}
+		}
+		return sessions
+	}
+	all := remaining(t)
+
+	cutoffJSON, err := json.Marshal(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dryRuns := []struct {
+		name string
+		body string
+		want []models.DeletedSession
+	}{
+		{
+			name: "user across apps",
+			body: `{"userId": "alice", "dryRun": true}`,
+			want: []models.DeletedSession{deletedSession("app1", "alice", "new"), deletedSession("app1", "alice", "old"), deletedSession("app2", "alice", "old")},
+		},
+		{
+			name: "app",
+			body: `{"appName": "app2", "dryRun": true}`,
+			want: []models.DeletedSession{deletedSession("app2", "alice", "old"), deletedSession("app2", "bob", "new")},
+		},
+		{
+			name: "older than",
+			body: `{"olderThan": ` + string(cutoffJSON) + `, "dryRun": true}`,
+			want: []models.DeletedSession{deletedSession("app1", "alice", "old"), deletedSession("app1", "bob", "old"), deletedSession("app2", "alice", "old")},
+		},
+		{
+			name: "user and app older than",
+			body: `{"appName": "app1", "userId": "alice", "olderThan": ` + string(cutoffJSON) + `, "dryRun": true}`,
+			want: []models.DeletedSession{deletedSession("app1", "alice", "old")},
+		},
+		{
+			name: "no match",
+			body: `{"userId": "carol", "dryRun": true}`,
+			want: []models.DeletedSession{},
+		},
+	}
+	for _, tt := range dryRuns {
+		t.Run("dry run "+tt.name, func(t *testing.T) {
+			resp := decode(t, deleteSessions(t, tt.body))
+			want := models.DeleteSessionsResponse{DryRun: true, Count: len(tt.want), Sessions: tt.want}
+			if diff := cmp.Diff(want, resp); diff != "" {
+				t.Errorf("DeleteSessions() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(all, remaining(t)); diff != "" {
+				t.Errorf("dry run deleted sessions (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	rejected := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "no filter", body: `{"dryRun": true}`, wantStatus: http.StatusBadRequest},
+		{name: "no expected count", body: `{"userId": "alice"}`, wantStatus: http.StatusBadRequest},
+		{name: "expected count mismatch", body: `{"userId": "alice", "expectedCount": 2}`, wantStatus: http.StatusConflict},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := deleteSessions(t, tt.body); rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if diff := cmp.Diff(all, remaining(t)); diff != "" {
+				t.Errorf("rejected request deleted sessions (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// The sessions of the user are deleted in every app, the others are
+	// kept.
+	resp := decode(t, deleteSessions(t, `{"userId": "alice", "expectedCount": 3}`))
+	if resp.DryRun || resp.Count != 3 {
+		t.Errorf("DeleteSessions() = %+v, want 3 sessions deleted", resp)
+	}
+	want := []models.DeletedSession{deletedSession("app1", "bob", "old"), deletedSession("app2", "bob", "new")}
+	if diff := cmp.Diff(want, remaining(t)); diff != "" {
+		t.Errorf("remaining sessions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeleteSessions_ReadOnly(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := &controllers.ReadOnlyMode{}
+	readOnly.SetEnabled(true)
+	apiController := controllers.NewAdminAPIControllerWithConfig(controllers.AdminAPIConfig{ReadOnly: readOnly, SessionService: sessionService})
+	for body, wantStatus := range map[string]int{
+		`{"userId": "user", "dryRun": true}`:     http.StatusOK,
+		`{"userId": "user", "expectedCount": 1}`: http.StatusServiceUnavailable,
+	} {
+		req, err := http.NewRequest(http.MethodPost, "/admin/sessions:delete", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		apiController.DeleteSessionsHandler(rr, req)
+		if rr.Code != wantStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", body, rr.Code, wantStatus)
+		}
+	}
+}
+
+func TestSetSystemState(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"old": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	sessionsController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{ProtectSystemState: true})
+	adminController := controllers.NewAdminAPIControllerWithConfig(controllers.AdminAPIConfig{SessionService: sessionService})
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "target_user_id": "testUser", "session_id": "testSession"}
+	call := func(handler http.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, "/", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{name: "patch", handler: sessionsController.UpdateSessionHandler, body: `{"stateDelta": {"sys:tier": "free"}}`},
+		{name: "patch deleting", handler: sessionsController.UpdateSessionHandler, body: `{"stateDelta": {"sys:tier": null}}`},
+		{name: "rename into system state", handler: sessionsController.UpdateSessionHandler, body: `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "sys:tier"}}}`},
+		{name: "event", handler: sessionsController.AppendEventHandler, body: `{"author": "user", "actions": {"stateDelta": {"sys:tier": "free"}}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := call(tc.handler, http.MethodPost, tc.body)
+			if rr.Code != http.StatusForbidden {
+				t.Fatalf("client write returned status %d, want %d, body: %s", rr.Code, http.StatusForbidden, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), `"sys:tier"`) {
+				t.Errorf("error %q doesn't name the system key", rr.Body.String())
+			}
+		})
+	}
+
+	if rr := call(adminController.SetSystemStateHandler, http.MethodPatch, `{"stateDelta": {"tier": "gold"}}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("admin write of a non-system key returned status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	rr := call(adminController.SetSystemStateHandler, http.MethodPatch, `{"stateDelta": {"sys:tier": "gold"}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("admin write returned status %d, want %d, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	// The system state is read like any other.
+	rr = call(sessionsController.GetSessionHandler, http.MethodGet, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get returned status %d, want %d, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var got models.Session
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if diff := cmp.Diff(map[string]any{"old": "v", "sys:tier": "gold"}, got.State); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetSystemState_NormalizedKeys(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"old": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	sessionsController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		ProtectSystemState: true,
+		StateKeys:          &controllers.StateKeyPolicy{Normalize: strings.ToLower},
+	})
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}
+
+	// The protection applies to the keys once normalized, whatever their
+	// spelling.
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{name: "patch", handler: sessionsController.UpdateSessionHandler, body: `{"stateDelta": {"SYS:tier": "gold"}}`},
+		{name: "rename into system state", handler: sessionsController.UpdateSessionHandler, body: `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "Sys:tier"}}}`},
+		{name: "event", handler: sessionsController.AppendEventHandler, body: `{"author": "user", "actions": {"stateDelta": {"SYS:tier": "gold"}}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, vars)
+			rr := httptest.NewRecorder()
+			tc.handler(rr, req)
+			if rr.Code != http.StatusForbidden {
+				t.Fatalf("client write returned status %d, want %d, body: %s", rr.Code, http.StatusForbidden, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), `"sys:tier"`) {
+				t.Errorf("error %q doesn't name the normalized system key", rr.Body.String())
+			}
+		})
+	}
+
+	resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resp.Session.State().Get("sys:tier"); !errors.Is(err, session.ErrStateKeyNotExist) {
+		t.Errorf("system key written by a client, get error = %v", err)
+	}
+}
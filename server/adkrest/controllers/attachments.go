@@ -0,0 +1,273 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+const (
+	// defaultMaxAttachmentSize is the size limit of an uploaded attachment
+	// when SessionsAPIConfig.MaxAttachmentSize is unset.
+	defaultMaxAttachmentSize = 32 << 20
+	// maxAttachmentEventSize is the size limit of the event part of an
+	// attachment upload.
+	maxAttachmentEventSize = 1 << 20
+	// AttachmentSizeTag is the event tag holding the size in bytes of the
+	// attachment uploaded with the event.
+	AttachmentSizeTag = "attachmentSize"
+	// AttachmentHashTag is the event tag holding the content hash of the
+	// attachment uploaded with the event, when the artifact service
+	// deduplicates artifacts by content.
+	AttachmentHashTag = "attachmentHash"
+)
+
+// UploadEventAttachmentHandler stores a file uploaded as multipart/form-data
+// in the artifact service and appends an event referencing it to the
+// session. The form has an optional "event" field, the JSON event to append,
+// followed by a "file" field, the attachment. The event is validated before
+// the file is read, so that invalid events are rejected without receiving
+// the upload.
+//
+// The body is read part by part rather than parsed as a form, and the file is
+// read up to the configured MaxAttachmentSize: larger files are rejected with
+// 413. The artifact service stores whole parts, so the file is held in memory
+// once while it is saved.
+//
+// The event references the artifact in its artifact delta, with the version
+// saved, and in a file data part with its URI in the artifacts API, MIME type
+// and file name. Its [AttachmentSizeTag] tag holds the size of the file, and
+// its [AttachmentHashTag] tag the content hash identifying the stored content
+// when the artifact service returns one: events attaching identical files
+// reference the same content.
+func (c *SessionsAPIController) UploadEventAttachmentHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	params := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	if c.config.Artifacts == nil {
+		http.Error(rw, "attachments require an artifact service", http.StatusNotImplemented)
+		return
+	}
+	reader, err := req.MultipartReader()
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("attachments must be uploaded as multipart/form-data: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	getResp, err := c.service.Get(req.Context(), &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	event := models.Event{Author: "user"}
+	var fileName, mimeType string
+	var data []byte
+	for data == nil {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(rw, "the file field is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read multipart body: %v", err), http.StatusBadRequest)
+			return
+		}
+		switch part.FormName() {
+		case "event":
+			if err := c.decodeAttachmentEvent(part, sessionID.AppName, &event); err != nil {
+				writeError(rw, err)
+				return
+			}
+		case "file":
+			fileName = part.FileName()
+			if fileName == "" {
+				http.Error(rw, "the file field must have a file name", http.StatusBadRequest)
+				return
+			}
+			if err := c.config.AllowedAuthors.check(sessionID.AppName, event); err != nil {
+				writeError(rw, err)
+				return
+			}
+			if err := c.checkEventsStateDepth(event); err != nil {
+				writeError(rw, err)
+				return
+			}
+			if err := c.prepareEventDelta(sessionID.AppName, &event); err != nil {
+				writeError(rw, err)
+				return
+			}
+			if data, err = c.readAttachment(part); err != nil {
+				writeError(rw, err)
+				return
+			}
+			mimeType = part.Header.Get("Content-Type")
+			if mimeType == "" {
+				mimeType = http.DetectContentType(data)
+			}
+		default:
+			http.Error(rw, fmt.Sprintf("unexpected form field %q", part.FormName()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	audited, err := c.config.Audit.begin(req, AuditRecord{
+		Operation:   AuditAppend,
+		AppName:     sessionID.AppName,
+		UserID:      sessionID.UserID,
+		SessionID:   sessionID.ID,
+		ChangedKeys: auditKeys(event.Actions.StateDelta),
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	saveResp, err := c.config.Artifacts.Save(req.Context(), &artifact.SaveRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+		FileName:  fileName,
+		Part:      &genai.Part{InlineData: &genai.Blob{MIMEType: mimeType, Data: data}},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to save attachment: %w", err)
+		audited(err)
+		writeError(rw, err)
+		return
+	}
+
+	sessionEvent := models.ToSessionEvent(event)
+	if sessionEvent.ID == "" {
+		sessionEvent.ID = uuid.NewString()
+	}
+	if event.Time == 0 {
+		sessionEvent.Timestamp = time.Now()
+	}
+	if sessionEvent.Actions.ArtifactDelta == nil {
+		sessionEvent.Actions.ArtifactDelta = map[string]int64{}
+	}
+	sessionEvent.Actions.ArtifactDelta[fileName] = saveResp.Version
+	if sessionEvent.Content == nil {
+		sessionEvent.Content = &genai.Content{Role: genai.RoleUser}
+	}
+	sessionEvent.Content.Parts = append(sessionEvent.Content.Parts, &genai.Part{FileData: &genai.FileData{
+		FileURI:     attachmentURI(sessionID, fileName, saveResp.Version),
+		MIMEType:    mimeType,
+		DisplayName: fileName,
+	}})
+	if sessionEvent.Tags == nil {
+		sessionEvent.Tags = map[string]string{}
+	}
+	sessionEvent.Tags[AttachmentSizeTag] = strconv.Itoa(len(data))
+	if saveResp.Hash != "" {
+		sessionEvent.Tags[AttachmentHashTag] = saveResp.Hash
+	}
+	sessionEvent.Tags = c.config.EventEnrichment.enrich(req, sessionEvent.Tags)
+
+	err = c.service.AppendEvent(leaseContext(req), getResp.Session, sessionEvent)
+	audited(err)
+	if err != nil {
+		// Don't leave behind an artifact no event references.
+		if deleteErr := c.config.Artifacts.Delete(req.Context(), &artifact.DeleteRequest{
+			AppName:   sessionID.AppName,
+			UserID:    sessionID.UserID,
+			SessionID: sessionID.ID,
+			FileName:  fileName,
+			Version:   saveResp.Version,
+		}); deleteErr != nil {
+			log.Printf("failed to delete attachment %q of session %q after a failed append: %v", fileName, sessionID.ID, deleteErr)
+		}
+		writeError(rw, err)
+		return
+	}
+	c.config.ReadYourWrites.setVersion(rw, sessionEvent.Sequence)
+	EncodeJSONResponse(models.FromSessionEvent(*sessionEvent), http.StatusOK, rw)
+}
+
+// decodeAttachmentEvent validates and decodes the event part of an
+// attachment upload into event.
+func (c *SessionsAPIController) decodeAttachmentEvent(part io.Reader, appName string, event *models.Event) error {
+	body, err := io.ReadAll(io.LimitReader(part, maxAttachmentEventSize+1))
+	if err != nil {
+		return newStatusError(fmt.Errorf("failed to read the event field: %w", err), http.StatusBadRequest)
+	}
+	if len(body) > maxAttachmentEventSize {
+		return newStatusError(fmt.Errorf("the event field exceeds %d bytes", maxAttachmentEventSize), http.StatusRequestEntityTooLarge)
+	}
+	eventReq := &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+	if err := c.events.checkBody(eventReq, appName, singleEvent); err != nil {
+		return err
+	}
+	if err := c.decodeRequest(eventReq, event); err != nil {
+		return newStatusError(fmt.Errorf("invalid event field: %w", err), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// readAttachment reads the file part of an attachment upload, failing with
+// 413 as soon as it exceeds the configured size limit.
+func (c *SessionsAPIController) readAttachment(part io.Reader) ([]byte, error) {
+	limit := c.config.MaxAttachmentSize
+	if limit <= 0 {
+		limit = defaultMaxAttachmentSize
+	}
+	data, err := io.ReadAll(io.LimitReader(part, limit+1))
+	if err != nil {
+		return nil, newStatusError(fmt.Errorf("failed to read the file field: %w", err), http.StatusBadRequest)
+	}
+	if int64(len(data)) > limit {
+		return nil, newStatusError(fmt.Errorf("the attachment exceeds %d bytes", limit), http.StatusRequestEntityTooLarge)
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+// attachmentURI returns the URI of a version of an attachment, relative to
+// the root of the REST API.
+func attachmentURI(id models.SessionID, fileName string, version int64) string {
+	return fmt.Sprintf("/apps/%s/users/%s/sessions/%s/artifacts/%s/versions/%d",
+		url.PathEscape(id.AppName), url.PathEscape(id.UserID), url.PathEscape(id.ID), url.PathEscape(fileName), version)
+}
@@ -0,0 +1,273 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// attachmentField is a field of an attachment upload form.
+type attachmentField struct {
+	name, fileName, contentType string
+	content                     []byte
+}
+
+func TestUploadEventAttachment(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatal(err)
+	}
+	artifacts := artifact.InMemoryService()
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		Artifacts:         artifacts,
+		MaxAttachmentSize: 64,
+	})
+	report := bytes.Repeat([]byte("%PDF"), 10)
+
+	rr := uploadAttachment(t, apiController,
+		attachmentField{name: "event", content: []byte(`{"author": "writer", "content": {"role": "model", "parts": [{"text": "here is the report"}]}}`)},
+		attachmentField{name: "file", fileName: "report.pdf", contentType: "application/pdf", content: report},
+	)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var got models.Event
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Author != "writer" {
+		t.Errorf("event author = %q, want %q", got.Author, "writer")
+	}
+	if diff := cmp.Diff(map[string]int64{"report.pdf": 1}, got.Actions.ArtifactDelta); diff != "" {
+		t.Errorf("artifact delta mismatch (-want +got):\n%s", diff)
+	}
+	wantParts := []*genai.Part{
+		{Text: "here is the report"},
+		{FileData: &genai.FileData{
+			FileURI:     "/apps/testApp/users/testUser/sessions/testSession/artifacts/report.pdf/versions/1",
+			MIMEType:    "application/pdf",
+			DisplayName: "report.pdf",
+		}},
+	}
+	if diff := cmp.Diff(wantParts, got.Content.Parts); diff != "" {
+		t.Errorf("event parts mismatch (-want +got):\n%s", diff)
+	}
+	if size := got.Tags[controllers.AttachmentSizeTag]; size != "40" {
+		t.Errorf("attachment size tag = %q, want %q", size, "40")
+	}
+
+	// The event is stored and references the stored artifact.
+	getResp, err := sessionService.Get(ctx, &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := getResp.Session.Events().Len(); n != 1 {
+		t.Fatalf("session has %d events, want 1", n)
+	}
+	if stored := getResp.Session.Events().At(0); stored.ID != got.ID {
+		t.Errorf("stored event ID = %q, want %q", stored.ID, got.ID)
+	}
+	loadResp, err := artifacts.Load(ctx, &artifact.LoadRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", FileName: "report.pdf", Version: got.Actions.ArtifactDelta["report.pdf"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&genai.Blob{MIMEType: "application/pdf", Data: report}, loadResp.Part.InlineData); diff != "" {
+		t.Errorf("stored artifact mismatch (-want +got):\n%s", diff)
+	}
+
+	// Uploading the file again saves a new version, and the event defaults
+	// to a user event.
+	rr = uploadAttachment(t, apiController, attachmentField{name: "file", fileName: "report.pdf", contentType: "application/pdf", content: report})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("second upload returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	got = models.Event{}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Author != "user" {
+		t.Errorf("event author = %q, want %q", got.Author, "user")
+	}
+	if v := got.Actions.ArtifactDelta["report.pdf"]; v != 2 {
+		t.Errorf("second upload saved version %d, want 2", v)
+	}
+}
+
+func TestUploadEventAttachment_Deduplicate(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		Artifacts: artifact.InMemoryServiceWithConfig(artifact.InMemoryServiceConfig{Deduplicate: true}),
+	})
+	image := []byte("generated image")
+
+	var hashes []string
+	for _, fileName := range []string{"first.png", "second.png"} {
+		rr := uploadAttachment(t, apiController, attachmentField{name: "file", fileName: fileName, contentType: "image/png", content: image})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("upload of %s returned wrong status code: got %v want %v, body: %s", fileName, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.Event
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		hashes = append(hashes, got.Tags[controllers.AttachmentHashTag])
+	}
+	want := artifact.ContentHash(genai.NewPartFromBytes(image, "image/png"))
+	if diff := cmp.Diff([]string{want, want}, hashes); diff != "" {
+		t.Errorf("attachment hash tags mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploadEventAttachment_Errors(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatal(err)
+	}
+	artifacts := artifact.InMemoryService()
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		Artifacts:         artifacts,
+		MaxAttachmentSize: 8,
+		AllowedAuthors:    controllers.AuthorAllowlist{"testApp": {"user"}},
+	})
+	file := attachmentField{name: "file", fileName: "notes.txt", contentType: "text/plain", content: []byte("notes")}
+
+	tests := []struct {
+		name       string
+		fields     []attachmentField
+		wantStatus int
+	}{
+		{
+			name:       "file too large",
+			fields:     []attachmentField{{name: "file", fileName: "big.bin", content: bytes.Repeat([]byte{0}, 9)}},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "missing file",
+			fields:     []attachmentField{{name: "event", content: []byte(`{}`)}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "file without name",
+			fields:     []attachmentField{{name: "file", content: []byte("notes")}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid event",
+			fields:     []attachmentField{{name: "event", content: []byte(`{`)}, file},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unexpected field",
+			fields:     []attachmentField{{name: "other", content: []byte("x")}, file},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "author not allowed",
+			fields:     []attachmentField{{name: "event", content: []byte(`{"author": "intruder"}`)}, file},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := uploadAttachment(t, apiController, tt.fields...)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+
+	// No rejected upload leaves an event or an artifact behind.
+	getResp, err := sessionService.Get(ctx, &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := getResp.Session.Events().Len(); n != 0 {
+		t.Errorf("session has %d events, want none", n)
+	}
+	listResp, err := artifacts.List(ctx, &artifact.ListRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listResp.FileNames) != 0 {
+		t.Errorf("artifacts %v were stored, want none", listResp.FileNames)
+	}
+}
+
+func TestUploadEventAttachment_NoArtifactService(t *testing.T) {
+	apiController := controllers.NewSessionsAPIController(session.InMemoryService())
+	rr := uploadAttachment(t, apiController, attachmentField{name: "file", fileName: "notes.txt", content: []byte("notes")})
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
+
+// uploadAttachment posts the fields as a multipart form to the attachment
+// upload handler, for the session testApp/testUser/testSession.
+func uploadAttachment(t *testing.T, apiController *controllers.SessionsAPIController, fields ...attachmentField) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, field := range fields {
+		header := textproto.MIMEHeader{}
+		disposition := `form-data; name="` + field.name + `"`
+		if field.fileName != "" {
+			disposition += `; filename="` + field.fileName + `"`
+		}
+		header.Set("Content-Disposition", disposition)
+		if field.contentType != "" {
+			header.Set("Content-Type", field.contentType)
+		}
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write(field.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events:upload", &body)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+	rr := httptest.NewRecorder()
+	apiController.UploadEventAttachmentHandler(rr, req)
+	return rr
+}
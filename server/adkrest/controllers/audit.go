@@ -0,0 +1,177 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Operations of the audit records.
+const (
+	AuditCreate = "create"
+	AuditPatch  = "patch"
+	AuditAppend = "append"
+	AuditDelete = "delete"
+	AuditUndo   = "undo"
+	AuditRedo   = "redo"
+)
+
+// AuditRecord describes a mutation of a session through the API.
+type AuditRecord struct {
+	// Time is when the mutation was about to be applied, or when it failed
+	// for the records with an error.
+	Time time.Time `json:"time"`
+	// RequestID is the ID of the request, see [RequestIDHeader].
+	RequestID string `json:"requestId,omitempty"`
+	// Principal is the authenticated user of the request. It is empty when
+	// the server doesn't authenticate requests.
+	Principal string `json:"principal,omitempty"`
+	Operation string `json:"operation"`
+	AppName   string `json:"appName"`
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId"`
+	// ChangedKeys are the state keys the mutation sets or deletes, sorted.
+	ChangedKeys []string `json:"changedKeys,omitempty"`
+	// Error is the error of a mutation which failed after its record was
+	// written, set on the second record of the mutation.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink stores audit records. WriteAuditRecord returns once the record
+// is stored, or fails.
+type AuditSink interface {
+	WriteAuditRecord(ctx context.Context, record AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to [AuditSink].
+type AuditSinkFunc func(ctx context.Context, record AuditRecord) error
+
+// WriteAuditRecord calls f.
+func (f AuditSinkFunc) WriteAuditRecord(ctx context.Context, record AuditRecord) error {
+	return f(ctx, record)
+}
+
+// NewWriterAuditSink returns a sink writing every record as a line of JSON
+// to w, for instance a file opened for appending or a [log/syslog.Writer],
+// which sends every write as a message. The writes are serialized. When w
+// has a Sync method, like [os.File], it is called after every record, so
+// that records are on disk once written.
+func NewWriterAuditSink(w io.Writer) AuditSink {
+	return &writerAuditSink{w: w}
+}
+
+type writerAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerAuditSink) WriteAuditRecord(ctx context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if syncer, ok := s.w.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// AuditLog writes an audit record for every mutation of a session through
+// the API: creations, including imports, state patches, event appends,
+// including attachments and transactions, deletions, undos and redos.
+// Labels, pins, touches and leases are operational metadata rather than
+// changes of the session, they aren't audited; neither are the events
+// appended by agent runs.
+//
+// A record is written before its mutation is applied, and the mutation is
+// refused with 503 if the record can't be written, so that every applied
+// mutation has a record. A mutation failing after its record is written
+// gets a second record with the error. Sessions created without an ID get
+// one from the server, so that their record names them. A creation with a
+// dedup key returning the session created earlier isn't audited.
+type AuditLog struct {
+	// Sink stores the records, see [NewWriterAuditSink].
+	Sink AuditSink
+	// Now returns the time of the records. Optional: defaults to time.Now.
+	Now func() time.Time
+}
+
+// begin writes the records of the mutations the request is about to
+// apply, and returns the function to call with the error of the
+// mutations. It writes nothing when a is nil.
+func (a *AuditLog) begin(req *http.Request, records ...AuditRecord) (func(error), error) {
+	if a == nil || a.Sink == nil {
+		return func(error) {}, nil
+	}
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	principal, _ := authenticatedUser(req.Context())
+	for i := range records {
+		records[i].Time = now()
+		records[i].RequestID = requestID(req)
+		records[i].Principal = principal
+	}
+	// failed writes the second records of mutations which failed. The
+	// mutations are done, the records are written even if the client is
+	// gone.
+	failed := func(written []AuditRecord, err error) {
+		for _, record := range written {
+			record.Time = now()
+			record.Error = err.Error()
+			if err := a.Sink.WriteAuditRecord(context.WithoutCancel(req.Context()), record); err != nil {
+				log.Printf("audit record of failed %s of session %q lost: %v", record.Operation, record.SessionID, err)
+			}
+		}
+	}
+	for i, record := range records {
+		if err := a.Sink.WriteAuditRecord(req.Context(), record); err != nil {
+			err = fmt.Errorf("failed to write audit record: %w", err)
+			failed(records[:i], err)
+			return nil, newStatusError(err, http.StatusServiceUnavailable)
+		}
+	}
+	return func(err error) {
+		if err != nil {
+			failed(records, err)
+		}
+	}, nil
+}
+
+// auditKeys returns the sorted keys of the deltas.
+func auditKeys(deltas ...map[string]any) []string {
+	var keys []string
+	for _, delta := range deltas {
+		for key := range delta {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
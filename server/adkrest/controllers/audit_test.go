@@ -0,0 +1,226 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// auditRecorder is an audit sink keeping the records in memory, failing
+// with err when it is set.
+type auditRecorder struct {
+	records []controllers.AuditRecord
+	err     error
+}
+
+func (r *auditRecorder) WriteAuditRecord(ctx context.Context, record controllers.AuditRecord) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.records = append(r.records, record)
+	return nil
+}
+
+// serveAudited serves the request with the handler behind the auth
+// middleware, authenticating every token as testUser.
+func serveAudited(handler http.HandlerFunc, method, target, body string, vars map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set(controllers.RequestIDHeader, "request-1")
+	req = mux.SetURLVars(req, vars)
+	authenticate := func(ctx context.Context, token string) (string, error) { return "testUser", nil }
+	rr := httptest.NewRecorder()
+	controllers.NewAuthMiddleware(authenticate)(handler).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAudit_Mutations(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	sink := &auditRecorder{}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(session.InMemoryService(), controllers.SessionsAPIConfig{
+		Audit: &controllers.AuditLog{Sink: sink, Now: func() time.Time { return now }},
+	})
+	vars := map[string]string{"app_name": "testApp", "session_id": "testSession"}
+	path := "/apps/testApp/users/testUser/sessions/testSession"
+
+	requests := []struct {
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+	}{
+		{apiController.CreateSessionHandler, http.MethodPost, path, `{"state": {"b": 1, "app:a": 2}}`},
+		{apiController.UpdateSessionHandler, http.MethodPatch, path, `{"stateDelta": {"c": 3}}`},
+		{apiController.AppendEventHandler, http.MethodPost, path + "/events", `{"author": "user", "actions": {"stateDelta": {"d": 4, "b": null}}}`},
+		{apiController.DeleteSessionHandler, http.MethodDelete, path, ""},
+	}
+	for _, r := range requests {
+		if rr := serveAudited(r.handler, r.method, r.target, r.body, vars); rr.Code != http.StatusOK {
+			t.Fatalf("%s %s returned wrong status code: got %v want %v, body: %s", r.method, r.target, rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+
+	record := func(operation string, keys ...string) controllers.AuditRecord {
+		return controllers.AuditRecord{
+			Time:        now,
+			RequestID:   "request-1",
+			Principal:   "testUser",
+			Operation:   operation,
+			AppName:     "testApp",
+			UserID:      "testUser",
+			SessionID:   "testSession",
+			ChangedKeys: keys,
+		}
+	}
+	want := []controllers.AuditRecord{
+		record(controllers.AuditCreate, "app:a", "b"),
+		record(controllers.AuditPatch, "c"),
+		record(controllers.AuditAppend, "b", "d"),
+		record(controllers.AuditDelete),
+	}
+	if diff := cmp.Diff(want, sink.records); diff != "" {
+		t.Errorf("audit records mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAudit_Failures(t *testing.T) {
+	sessionService := session.InMemoryService()
+	sink := &auditRecorder{}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		Audit: &controllers.AuditLog{Sink: sink},
+	})
+	vars := map[string]string{"app_name": "testApp", "session_id": "testSession"}
+	path := "/apps/testApp/users/testUser/sessions/testSession"
+
+	// A mutation whose record can't be written is refused.
+	sink.err = errors.New("disk full")
+	rr := serveAudited(apiController.CreateSessionHandler, http.MethodPost, path, "", vars)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("create with a failing audit sink returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	if _, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("session created without an audit record, get error = %v", err)
+	}
+
+	// A mutation failing after its record is written gets a second record
+	// with the error.
+	sink.err = nil
+	rr = serveAudited(apiController.AppendEventHandler, http.MethodPost, path+"/events", `{"author": "user"}`, vars)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("append to a missing session returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if len(sink.records) != 0 {
+		t.Errorf("append to a missing session failing before the mutation wrote %d records", len(sink.records))
+	}
+
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatal(err)
+	}
+	rr = serveAudited(apiController.UndoSessionHandler, http.MethodPost, path+"/undo", "", vars)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("undo without undo history returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusNotImplemented, rr.Body.String())
+	}
+	if len(sink.records) != 2 {
+		t.Fatalf("got %d audit records of a failed undo, want 2: %+v", len(sink.records), sink.records)
+	}
+	if got := sink.records[0]; got.Operation != controllers.AuditUndo || got.Error != "" {
+		t.Errorf("first record = %+v, want an undo without error", got)
+	}
+	if got := sink.records[1]; got.Operation != controllers.AuditUndo || got.Error == "" {
+		t.Errorf("second record = %+v, want an undo with the error", got)
+	}
+}
+
+func TestAudit_Create(t *testing.T) {
+	sessionService := session.InMemoryService()
+	sink := &auditRecorder{}
+	audited := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		Audit: &controllers.AuditLog{Sink: sink},
+	})
+	unaudited := controllers.NewSessionsAPIController(sessionService)
+	vars := map[string]string{"app_name": "testApp"}
+	path := "/apps/testApp/users/testUser/sessions"
+
+	// The ID generated for the record doesn't turn an import without an ID
+	// into the import of a given session: both events are created as
+	// without auditing.
+	importBody := `{"import": true, "events": [{"author": "user"}, {"author": "user"}]}`
+	for name, apiController := range map[string]*controllers.SessionsAPIController{"audited": audited, "unaudited": unaudited} {
+		rr := serveAudited(apiController.CreateSessionHandler, http.MethodPost, path, importBody, vars)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s import without an ID returned wrong status code: got %v want %v, body: %s", name, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.Session
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Events) != 2 {
+			t.Errorf("%s import without an ID created %d events, want 2", name, len(got.Events))
+		}
+	}
+	if len(sink.records) != 1 || sink.records[0].SessionID == "" {
+		t.Fatalf("got audit records %+v of the import, want one naming the session", sink.records)
+	}
+
+	// Returning the session created earlier for a dedup key creates
+	// nothing and isn't audited.
+	sink.records = nil
+	for i := range 2 {
+		rr := serveAudited(audited.CreateSessionHandler, http.MethodPost, path, `{"dedupKey": "key"}`, vars)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("create %d with a dedup key returned wrong status code: got %v want %v, body: %s", i, rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d audit records of two creations with the same dedup key, want one of the first: %+v", len(sink.records), sink.records)
+	}
+	if got := sink.records[0]; got.Operation != controllers.AuditCreate || got.Error != "" {
+		t.Errorf("record = %+v, want a creation without error", got)
+	}
+}
+
+func TestNewWriterAuditSink(t *testing.T) {
+	var out strings.Builder
+	sink := controllers.NewWriterAuditSink(&out)
+	records := []controllers.AuditRecord{
+		{Time: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), Operation: controllers.AuditDelete, AppName: "a", UserID: "u", SessionID: "s"},
+		{Time: time.Date(2025, 6, 1, 12, 0, 1, 0, time.UTC), Operation: controllers.AuditPatch, AppName: "a", UserID: "u", SessionID: "s", ChangedKeys: []string{"k"}},
+	}
+	for _, record := range records {
+		if err := sink.WriteAuditRecord(t.Context(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `{"time":"2025-06-01T12:00:00Z","operation":"delete","appName":"a","userId":"u","sessionId":"s"}
+{"time":"2025-06-01T12:00:01Z","operation":"patch","appName":"a","userId":"u","sessionId":"s","changedKeys":["k"]}
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("written records mismatch (-want +got):\n%s", diff)
+	}
+}
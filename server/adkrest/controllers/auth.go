@@ -0,0 +1,101 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AuthenticateFunc returns the user ID of the principal a bearer token
+// belongs to, or an error if the token is not valid.
+type AuthenticateFunc func(ctx context.Context, token string) (string, error)
+
+// NewAuthMiddleware returns a middleware which authenticates the bearer token
+// of every request and scopes the request to the authenticated user.
+//
+// The user_id route variable is set to the authenticated user, so handlers
+// resolving it with models.SessionIDFromHTTPParameters don't need the client
+// to pass it. A user_id in the path that disagrees with the token is denied
+// with [DenyAsNotFound], as if the resources of the other user didn't exist.
+func NewAuthMiddleware(authenticate AuthenticateFunc) mux.MiddlewareFunc {
+	return NewAuthMiddlewareWithDenial(authenticate, DenyAsNotFound)
+}
+
+// NewAuthMiddlewareWithDenial is like [NewAuthMiddleware], denying the
+// requests for the resources of other users as configured.
+func NewAuthMiddlewareWithDenial(authenticate AuthenticateFunc, denial AccessDenial) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			token, ok := bearerToken(req)
+			if !ok {
+				http.Error(rw, "missing bearer token", http.StatusUnauthorized)
+				return
+			}
+			userID, err := authenticate(req.Context(), token)
+			if err != nil || userID == "" {
+				http.Error(rw, "invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+			vars := maps.Clone(mux.Vars(req))
+			if vars == nil {
+				vars = map[string]string{}
+			}
+			if pathUserID, ok := vars["user_id"]; ok && pathUserID != userID {
+				denial.deny(rw, fmt.Sprintf("user_id %q does not match the authenticated user", pathUserID))
+				return
+			}
+			vars["user_id"] = userID
+			req = req.WithContext(context.WithValue(req.Context(), authenticatedUserKey{}, userID))
+			next.ServeHTTP(rw, mux.SetURLVars(req, vars))
+		})
+	}
+}
+
+// NewAdminMiddleware returns a middleware which only lets the given admin
+// users through, and rejects other requests with 403 Forbidden. It must run
+// after the middleware returned by [NewAuthMiddleware], which authenticates
+// the user of the request. The user_id route variable isn't trusted, admin
+// routes name the user they act on with target_user_id.
+func NewAdminMiddleware(admins []string) mux.MiddlewareFunc {
+	allowed := make(map[string]bool, len(admins))
+	for _, admin := range admins {
+		allowed[admin] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			userID, ok := authenticatedUser(req.Context())
+			if !ok || !allowed[userID] {
+				http.Error(rw, "admin access required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// bearerToken returns the token of the request's Authorization header.
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+)
+
+// AuthorAllowlist maps an app name to the authors allowed on the events
+// clients submit for the app's sessions, e.g. the names of its agents and
+// "user". Apps without an entry accept any author.
+type AuthorAllowlist map[string][]string
+
+// check returns an error reported with 422 Unprocessable Entity if one of
+// the events has an author that is not allowed for the app.
+func (a AuthorAllowlist) check(appName string, events ...models.Event) error {
+	allowed, ok := a[appName]
+	if !ok {
+		return nil
+	}
+	for _, event := range events {
+		if !slices.Contains(allowed, event.Author) {
+			return newStatusError(fmt.Errorf("author %q is not allowed for app %q", event.Author, appName), http.StatusUnprocessableEntity)
+		}
+	}
+	return nil
+}
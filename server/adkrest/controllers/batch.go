@@ -0,0 +1,126 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// AppendEventsHandler appends a batch of events to a session, in order.
+// Unlike the import of a session, the batch is not atomic: every event is
+// validated and appended on its own, as by AppendEventHandler, and the
+// response reports which events were appended and why the others were
+// rejected. Only a missing session or a malformed batch fail the request.
+func (c *SessionsAPIController) AppendEventsHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	sessionID, err := models.SessionIDFromHTTPParameters(mux.Vars(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	appendRequest := models.AppendEventsRequest{}
+	if err := c.decodeRequest(req, &appendRequest); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(appendRequest.Events) == 0 {
+		http.Error(rw, "events must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	getResp, err := c.service.Get(req.Context(), &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	resp := models.AppendEventsResponse{Results: make([]models.AppendEventResult, len(appendRequest.Events))}
+	for i, raw := range appendRequest.Events {
+		event, err := c.batchEvent(sessionID.AppName, raw)
+		if err == nil {
+			event.Tags = c.config.EventEnrichment.enrich(req, event.Tags)
+			err = c.appendAudited(req, getResp.Session, event)
+		}
+		if err != nil {
+			resp.Results[i] = models.AppendEventResult{Status: statusFromError(err), Error: err.Error()}
+			continue
+		}
+		resp.Results[i] = models.AppendEventResult{ID: event.ID, Status: http.StatusOK}
+		resp.Accepted++
+	}
+	EncodeJSONResponse(resp, http.StatusOK, rw)
+}
+
+// appendAudited appends the event of a batch once its audit record is
+// written.
+func (c *SessionsAPIController) appendAudited(req *http.Request, storedSession session.Session, event *session.Event) error {
+	audited, err := c.config.Audit.begin(req, AuditRecord{
+		Operation:   AuditAppend,
+		AppName:     storedSession.AppName(),
+		UserID:      storedSession.UserID(),
+		SessionID:   storedSession.ID(),
+		ChangedKeys: auditKeys(event.Actions.StateDelta),
+	})
+	if err != nil {
+		return err
+	}
+	err = c.service.AppendEvent(leaseContext(req), storedSession, event)
+	audited(err)
+	return err
+}
+
+// batchEvent decodes and validates an event of a batch, with the checks of
+// AppendEventHandler.
+func (c *SessionsAPIController) batchEvent(appName string, raw json.RawMessage) (*session.Event, error) {
+	var schemaEvent any
+	if err := json.Unmarshal(raw, &schemaEvent); err != nil {
+		return nil, newStatusError(fmt.Errorf("invalid event: %w", err), http.StatusBadRequest)
+	}
+	if err := c.events.checkEvent(appName, schemaEvent); err != nil {
+		return nil, err
+	}
+	event := models.Event{}
+	if err := c.decodeJSON(bytes.NewReader(raw), &event); err != nil {
+		return nil, newStatusError(fmt.Errorf("invalid event: %w", err), http.StatusBadRequest)
+	}
+	if err := c.config.AllowedAuthors.check(appName, event); err != nil {
+		return nil, err
+	}
+	if err := c.checkEventsStateDepth(event); err != nil {
+		return nil, err
+	}
+	if err := c.prepareEventDelta(appName, &event); err != nil {
+		return nil, err
+	}
+	return newClientEvent(event), nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestAppendEvents(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		ContentLimits: session.ContentLimits{
+			Apps: map[string]session.ContentLimit{"testApp": {MaxBytes: 5}},
+		},
+	})
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		AllowedAuthors: controllers.AuthorAllowlist{"testApp": {"user", "agent"}},
+	})
+	body := `{"events": [
+		{"id": "e1", "author": "user", "content": {"role": "user", "parts": [{"text": "hi"}]}},
+		{"id": "e2", "author": "intruder"},
+		{"id": "e3", "author": "agent", "content": {"role": "model", "parts": [{"text": "too long"}]}},
+		{"id": "e4", "author": 42},
+		{"author": "agent", "content": {"role": "model", "parts": [{"text": "hello"}]}},
+		{"id": "e6", "author": "user"}
+	]}`
+	req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events:batch", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{
+		"app_name":   "testApp",
+		"user_id":    "testUser",
+		"session_id": "testSession",
+	})
+	rr := httptest.NewRecorder()
+
+	apiController.AppendEventsHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+	}
+	var got models.AppendEventsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got.Results) != 6 {
+		t.Fatalf("got %d results, want one per event: %+v", len(got.Results), got.Results)
+	}
+	assignedID := got.Results[4].ID
+	if assignedID == "" {
+		t.Errorf("event without ID was not assigned one: %+v", got.Results[4])
+	}
+	want := models.AppendEventsResponse{
+		Results: []models.AppendEventResult{
+			{ID: "e1", Status: http.StatusOK},
+			{Status: http.StatusUnprocessableEntity, Error: `author "intruder" is not allowed for app "testApp"`},
+			{Status: http.StatusRequestEntityTooLarge},
+			{Status: http.StatusBadRequest},
+			{ID: assignedID, Status: http.StatusOK},
+			{ID: "e6", Status: http.StatusOK},
+		},
+		Accepted: 3,
+	}
+	// The errors of the service and of the decoding are only checked to be
+	// reported.
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(models.AppendEventResult{}, "Error")); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+	for i, result := range got.Results {
+		if (result.Status == http.StatusOK) != (result.Error == "") {
+			t.Errorf("result %d = %+v, want an error exactly when rejected", i, result)
+		}
+	}
+	if got.Results[1].Error != want.Results[1].Error {
+		t.Errorf("result 1 error = %q, want %q", got.Results[1].Error, want.Results[1].Error)
+	}
+
+	// The accepted events are stored in request order.
+	resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	var gotIDs []string
+	for event := range resp.Session.Events().All() {
+		gotIDs = append(gotIDs, event.ID)
+	}
+	if diff := cmp.Diff([]string{"e1", assignedID, "e6"}, gotIDs); diff != "" {
+		t.Errorf("stored events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAppendEvents_RequestErrors(t *testing.T) {
+	tc := []struct {
+		name       string
+		sessionID  string
+		body       string
+		wantStatus int
+	}{
+		{name: "missing session", sessionID: "missing", body: `{"events": [{"author": "user"}]}`, wantStatus: http.StatusNotFound},
+		{name: "no events", sessionID: "testSession", body: `{"events": []}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed batch", sessionID: "testSession", body: `{"events": {}}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			apiController := controllers.NewSessionsAPIController(sessionService)
+			req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/"+tt.sessionID+"/events:batch", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name":   "testApp",
+				"user_id":    "testUser",
+				"session_id": tt.sessionID,
+			})
+			rr := httptest.NewRecorder()
+
+			apiController.AppendEventsHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+const (
+	// SessionVersionHeader is the response header carrying the version of
+	// the session a write left, when read-your-writes is enabled. Clients
+	// send it back in [MinSessionVersionHeader] to read their writes.
+	SessionVersionHeader = "X-Session-Version"
+	// MinSessionVersionHeader is the request header with the version a
+	// read of a session must observe, see [ReadYourWrites].
+	MinSessionVersionHeader = "X-Min-Session-Version"
+)
+
+// defaultReadYourWritesInterval is the interval between two reads of a
+// session which isn't at the required version yet, when
+// ReadYourWrites.PollInterval is unset.
+const defaultReadYourWritesInterval = 20 * time.Millisecond
+
+// ReadYourWrites lets clients read their writes through a session service
+// whose reads may lag its writes, like one serving the reads from replicas
+// or caches. The writes of a session return its version in the
+// [SessionVersionHeader] header; reads sending it in the
+// [MinSessionVersionHeader] header are served once the session read is at
+// least at that version, reading it again until it is, or fail with 503
+// after the Timeout.
+//
+// The version of a session is the [session.Event.Sequence] of its last
+// event, so sessions of services which don't assign sequences are always
+// fresh enough.
+type ReadYourWrites struct {
+	// Timeout is how long a read waits for the session to reach the
+	// required version. Optional: if zero, read-your-writes is disabled,
+	// writes return no version and reads don't wait.
+	Timeout time.Duration
+	// PollInterval is the interval between two reads of a session which
+	// isn't at the required version yet. Optional: defaults to 20ms.
+	PollInterval time.Duration
+}
+
+// sessionVersion returns the version of the session, the sequence of its
+// last event.
+func sessionVersion(s session.Session) int64 {
+	if n := s.Events().Len(); n > 0 {
+		return s.Events().At(n - 1).Sequence
+	}
+	return 0
+}
+
+// setVersion sets the SessionVersionHeader of a write which left the
+// session at the version, if read-your-writes is enabled.
+func (r ReadYourWrites) setVersion(rw http.ResponseWriter, version int64) {
+	if r.Timeout > 0 && version > 0 {
+		rw.Header().Set(SessionVersionHeader, strconv.FormatInt(version, 10))
+	}
+}
+
+// minVersion returns the version of the MinSessionVersionHeader of the
+// request, or zero if it has none or read-your-writes is disabled.
+func (r ReadYourWrites) minVersion(req *http.Request) (int64, error) {
+	header := req.Header.Get(MinSessionVersionHeader)
+	if r.Timeout <= 0 || header == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || version < 0 {
+		return 0, newStatusError(fmt.Errorf("invalid %s header %q", MinSessionVersionHeader, header), http.StatusBadRequest)
+	}
+	return version, nil
+}
+
+// getSession gets the session of a read, reading it again until it is at
+// the version the request requires. Sessions which don't reach it within
+// the timeout fail with an error wrapping [session.ErrServiceUnavailable].
+func (c *SessionsAPIController) getSession(req *http.Request, getReq *session.GetRequest) (*session.GetResponse, error) {
+	r := c.config.ReadYourWrites
+	minVersion, err := r.minVersion(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.service.Get(req.Context(), getReq)
+	if err != nil || minVersion == 0 || sessionVersion(resp.Session) >= minVersion {
+		return resp, err
+	}
+
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = defaultReadYourWritesInterval
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), r.Timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := req.Context().Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("session %q did not reach version %d within %v: %w", getReq.SessionID, minVersion, r.Timeout, session.ErrServiceUnavailable)
+		case <-ticker.C:
+		}
+		resp, err = c.service.Get(req.Context(), getReq)
+		if err != nil || sessionVersion(resp.Session) >= minVersion {
+			return resp, err
+		}
+	}
+}
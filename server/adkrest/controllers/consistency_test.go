@@ -0,0 +1,187 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/session"
+)
+
+// laggingService simulates a replica lagging behind the writes: its next
+// lag reads return a stale session instead of the stored one.
+type laggingService struct {
+	session.Service
+
+	mu    sync.Mutex
+	stale session.Session
+	lag   int
+	reads int
+}
+
+func (s *laggingService) Get(ctx context.Context, req *session.GetRequest) (*session.GetResponse, error) {
+	s.mu.Lock()
+	s.reads++
+	if s.lag > 0 {
+		s.lag--
+		s.mu.Unlock()
+		return &session.GetResponse{Session: s.stale}, nil
+	}
+	s.mu.Unlock()
+	return s.Service.Get(ctx, req)
+}
+
+// snapshot returns the stored session as it is now.
+func (s *laggingService) snapshot(t *testing.T) session.Session {
+	t.Helper()
+	resp, err := s.Service.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Session
+}
+
+// serveStale makes the next lag reads return the stale session, and resets
+// the count of reads.
+func (s *laggingService) serveStale(stale session.Session, lag int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stale, s.lag, s.reads = stale, lag, 0
+}
+
+func (s *laggingService) readCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+func TestReadYourWrites(t *testing.T) {
+	ctx := t.Context()
+	service := &laggingService{Service: session.InMemoryService()}
+	if _, err := service.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}
+	newController := func(timeout time.Duration) *controllers.SessionsAPIController {
+		return controllers.NewSessionsAPIControllerWithConfig(service, controllers.SessionsAPIConfig{
+			ReadYourWrites: controllers.ReadYourWrites{Timeout: timeout, PollInterval: time.Millisecond},
+		})
+	}
+	apiController := newController(time.Second)
+	patch := func(t *testing.T, apiController *controllers.SessionsAPIController, color string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(`{"stateDelta": {"color": "`+color+`"}}`))
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.UpdateSessionHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("patch returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		return rr.Header().Get(controllers.SessionVersionHeader)
+	}
+	getState := func(apiController *controllers.SessionsAPIController, version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/state", nil)
+		if version != "" {
+			req.Header.Set(controllers.MinSessionVersionHeader, version)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.GetSessionStateHandler(rr, req)
+		return rr
+	}
+	colorOf := func(t *testing.T, rr *httptest.ResponseRecorder) any {
+		t.Helper()
+		if rr.Code != http.StatusOK {
+			t.Fatalf("read returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var state map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&state); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return state["color"]
+	}
+
+	if version := patch(t, apiController, "red"); version != "1" {
+		t.Errorf("first patch returned version %q, want %q", version, "1")
+	}
+	stale := service.snapshot(t)
+	version := patch(t, apiController, "blue")
+	if version != "2" {
+		t.Fatalf("second patch returned version %q, want %q", version, "2")
+	}
+
+	t.Run("read without version may be stale", func(t *testing.T) {
+		service.serveStale(stale, 1)
+		if got := colorOf(t, getState(apiController, "")); got != "red" {
+			t.Errorf("read color = %v, want %q", got, "red")
+		}
+	})
+
+	t.Run("read waits for the version", func(t *testing.T) {
+		service.serveStale(stale, 3)
+		if got := colorOf(t, getState(apiController, version)); got != "blue" {
+			t.Errorf("read color = %v, want %q", got, "blue")
+		}
+		if got := service.readCount(); got != 4 {
+			t.Errorf("session read %d times, want 4", got)
+		}
+	})
+
+	t.Run("read of an older version is served at once", func(t *testing.T) {
+		service.serveStale(stale, 3)
+		if got := colorOf(t, getState(apiController, "1")); got != "red" {
+			t.Errorf("read color = %v, want %q", got, "red")
+		}
+		if got := service.readCount(); got != 1 {
+			t.Errorf("session read %d times, want 1", got)
+		}
+	})
+
+	t.Run("unattainable version", func(t *testing.T) {
+		service.serveStale(stale, 1<<20)
+		defer service.serveStale(nil, 0)
+		if rr := getState(newController(20*time.Millisecond), version); rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("read returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusServiceUnavailable, rr.Body.String())
+		}
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		if rr := getState(apiController, "latest"); rr.Code != http.StatusBadRequest {
+			t.Errorf("read returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusBadRequest, rr.Body.String())
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := controllers.NewSessionsAPIController(service)
+		if version := patch(t, disabled, "green"); version != "" {
+			t.Errorf("patch returned version %q with read-your-writes disabled", version)
+		}
+		// The required version is ignored.
+		service.serveStale(stale, 1)
+		if got := colorOf(t, getState(disabled, "3")); got != "red" {
+			t.Errorf("read color = %v, want %q", got, "red")
+		}
+	})
+}
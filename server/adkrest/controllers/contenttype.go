@@ -0,0 +1,130 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ContentTypePolicy is the media types the middleware of
+// [NewContentTypeMiddleware] accepts on request bodies.
+type ContentTypePolicy struct {
+	// Lenient lets the bodies with a missing or unsupported Content-Type
+	// through, logging them, so that clients can be migrated before the
+	// policy is enforced.
+	Lenient bool
+	// MediaTypes are accepted on the bodies of every route, for instance
+	// application/msgpack next to application/json. Optional: defaults to
+	// application/json.
+	MediaTypes []string
+	// Routes maps a route name, such as "UploadEventAttachment", to the
+	// media types accepted on its bodies instead of MediaTypes.
+	Routes map[string][]string
+}
+
+// DefaultRouteMediaTypes returns the media types accepted on the bodies of
+// the routes which don't take JSON: the multipart form of
+// UploadEventAttachment.
+func DefaultRouteMediaTypes() map[string][]string {
+	return map[string][]string{"UploadEventAttachment": {"multipart/form-data"}}
+}
+
+// NewContentTypeMiddleware returns a middleware failing the POST, PUT and
+// PATCH requests with a body with 415 Unsupported Media Type when their
+// Content-Type is missing or not accepted by the policy, so that the server
+// never guesses the encoding of a body. Parameters like charset are
+// ignored, and requests without a body are let through.
+func NewContentTypeMiddleware(policy ContentTypePolicy) mux.MiddlewareFunc {
+	defaults := normalizeMediaTypes(policy.MediaTypes)
+	if len(defaults) == 0 {
+		defaults = []string{"application/json"}
+	}
+	routes := make(map[string][]string, len(policy.Routes))
+	for name, mediaTypes := range policy.Routes {
+		routes[name] = normalizeMediaTypes(mediaTypes)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if !hasBody(req) {
+				next.ServeHTTP(rw, req)
+				return
+			}
+			accepted := defaults
+			if route := mux.CurrentRoute(req); route != nil {
+				if mediaTypes, ok := routes[route.GetName()]; ok {
+					accepted = mediaTypes
+				}
+			}
+			if err := checkContentType(req.Header.Get("Content-Type"), accepted); err != nil {
+				if policy.Lenient {
+					log.Printf("%s %s: %v, accepted in lenient mode", req.Method, req.URL.Path, err)
+					next.ServeHTTP(rw, req)
+					return
+				}
+				rw.Header().Set("Accept", strings.Join(accepted, ", "))
+				http.Error(rw, err.Error(), http.StatusUnsupportedMediaType)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// hasBody returns whether the request is a write which may carry a body.
+// Requests of unknown length, with a chunked body, are assumed to have one.
+func hasBody(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return req.ContentLength != 0
+	default:
+		return false
+	}
+}
+
+// checkContentType returns an error unless the Content-Type header value
+// has one of the accepted media types.
+func checkContentType(contentType string, accepted []string) error {
+	if contentType == "" {
+		return fmt.Errorf("missing Content-Type, want one of %s", strings.Join(accepted, ", "))
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q: %w", contentType, err)
+	}
+	if !slices.Contains(accepted, mediaType) {
+		return fmt.Errorf("unsupported Content-Type %q, want one of %s", mediaType, strings.Join(accepted, ", "))
+	}
+	return nil
+}
+
+// normalizeMediaTypes returns the media types lower cased, without their
+// parameters.
+func normalizeMediaTypes(mediaTypes []string) []string {
+	normalized := make([]string, 0, len(mediaTypes))
+	for _, mediaType := range mediaTypes {
+		if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+			mediaType = parsed
+		}
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(mediaType)))
+	}
+	return normalized
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// DefaultEnrichmentPrefix is the default EventEnrichment.Prefix.
+const DefaultEnrichmentPrefix = "server."
+
+// Tags recorded by every [EventEnrichment], under its prefix.
+const (
+	// EnrichmentRequestIDTag records the ID of the request which appended
+	// the event, see [RequestIDHeader].
+	EnrichmentRequestIDTag = "requestId"
+	// EnrichmentPrincipalTag records the authenticated user of the request
+	// which appended the event. It is only recorded when the server
+	// authenticates requests.
+	EnrichmentPrincipalTag = "principal"
+)
+
+// EventEnrichment records server context on the events appended through
+// the sessions API, as tags, so that they can be audited without trusting
+// the clients to send it. The context is recorded under a protected prefix:
+// the tags under it of the events clients submit are dropped.
+//
+// The events of imported sessions are restored as they were exported, they
+// aren't enriched.
+type EventEnrichment struct {
+	// Prefix namespaces the enrichment tags. Optional: defaults to
+	// [DefaultEnrichmentPrefix].
+	Prefix string
+	// Tags are recorded on every event, e.g. {"version": "1.4.2"}.
+	Tags map[string]string
+	// Derive returns the tags derived from the request appending the
+	// events, e.g. from the headers set by a proxy. They override Tags, and
+	// are overridden by the request ID and principal tags. Optional.
+	Derive func(req *http.Request) map[string]string
+}
+
+// enrich returns the tags of an event appended by the request, with the
+// client's tags under the prefix replaced by the server context. It
+// returns the tags as they are when e is nil.
+func (e *EventEnrichment) enrich(req *http.Request, tags map[string]string) map[string]string {
+	if e == nil {
+		return tags
+	}
+	prefix := e.Prefix
+	if prefix == "" {
+		prefix = DefaultEnrichmentPrefix
+	}
+	enriched := make(map[string]string, len(tags)+len(e.Tags)+2)
+	for key, value := range tags {
+		if !strings.HasPrefix(key, prefix) {
+			enriched[key] = value
+		}
+	}
+	server := maps.Clone(e.Tags)
+	if server == nil {
+		server = map[string]string{}
+	}
+	if e.Derive != nil {
+		maps.Copy(server, e.Derive(req))
+	}
+	server[EnrichmentRequestIDTag] = requestID(req)
+	if principal, ok := authenticatedUser(req.Context()); ok {
+		server[EnrichmentPrincipalTag] = principal
+	} else {
+		delete(server, EnrichmentPrincipalTag)
+	}
+	for key, value := range server {
+		enriched[prefix+key] = value
+	}
+	return enriched
+}
+
+type requestIDKey struct{}
+
+// requestID returns the ID of the request, as set by the recovery
+// middleware, or sent by the client when the request didn't go through it.
+func requestID(req *http.Request) string {
+	if id, ok := req.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return req.Header.Get(RequestIDHeader)
+}
+
+type authenticatedUserKey struct{}
+
+// authenticatedUser returns the user authenticated by the auth middleware.
+func authenticatedUser(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(authenticatedUserKey{}).(string)
+	return userID, ok
+}
@@ -0,0 +1,103 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestEventEnrichment(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		EventEnrichment: &controllers.EventEnrichment{
+			Tags: map[string]string{"version": "1.4.2", "region": "default"},
+			Derive: func(req *http.Request) map[string]string {
+				return map[string]string{"region": req.Header.Get("X-Region")}
+			},
+		},
+	})
+	call := func(t *testing.T, handler http.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set(controllers.RequestIDHeader, "req-1")
+		req.Header.Set("X-Region", "eu")
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		return rr
+	}
+	wantServerTags := map[string]string{
+		"server.version":   "1.4.2",
+		"server.region":    "eu",
+		"server.requestId": "req-1",
+	}
+
+	// The client's tags under the prefix are dropped, including the
+	// principal of a request which isn't authenticated.
+	rr := call(t, apiController.AppendEventHandler, http.MethodPost, `{"author": "user", "tags": {
+		"topic": "billing",
+		"server.version": "0.0.1",
+		"server.requestId": "spoofed",
+		"server.principal": "admin"
+	}}`)
+	var appended models.Event
+	if err := json.NewDecoder(rr.Body).Decode(&appended); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := map[string]string{"topic": "billing"}
+	for key, value := range wantServerTags {
+		want[key] = value
+	}
+	if diff := cmp.Diff(want, appended.Tags); diff != "" {
+		t.Errorf("appended event tags mismatch (-want +got):\n%s", diff)
+	}
+
+	// The events recording state patches are enriched too.
+	call(t, apiController.UpdateSessionHandler, http.MethodPatch, `{"stateDelta": {"k": "v"}}`)
+
+	stored, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if n := stored.Session.Events().Len(); n != 2 {
+		t.Fatalf("got %d stored events, want 2", n)
+	}
+	if diff := cmp.Diff(want, models.FromSessionEvent(*stored.Session.Events().At(0)).Tags); diff != "" {
+		t.Errorf("stored event tags mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantServerTags, stored.Session.Events().At(1).Tags); diff != "" {
+		t.Errorf("state patch event tags mismatch (-want +got):\n%s", diff)
+	}
+}
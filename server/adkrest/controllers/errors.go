@@ -14,6 +14,15 @@
 
 package controllers
 
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/adk/session"
+)
+
 type statusError struct {
 	Err  error
 	Code int
@@ -32,3 +41,53 @@ func (se statusError) Error() string {
 func (se statusError) Status() int {
 	return se.Code
 }
+
+// statusFromError returns the HTTP status code reported for an error
+// returned by the session service.
+func statusFromError(err error) int {
+	var statusErr statusError
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Status()
+	case errors.Is(err, session.ErrSessionNotFound), errors.Is(err, session.ErrEventNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, session.ErrStateDirectiveFailed), errors.Is(err, session.ErrSessionFull), errors.Is(err, session.ErrTooManySessions),
+		errors.Is(err, session.ErrLeaseHeld), errors.Is(err, session.ErrLeaseNotHeld),
+		errors.Is(err, session.ErrNothingToUndo), errors.Is(err, session.ErrNothingToRedo):
+		return http.StatusConflict
+	case errors.Is(err, session.ErrEventContentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, session.ErrEventRejected), errors.Is(err, session.ErrStateKeysExceeded):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, session.ErrIngestionRateExceeded), errors.Is(err, session.ErrCreationRateExceeded),
+		errors.Is(err, session.ErrUserEventsExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, session.ErrServiceUnavailable), errors.Is(err, session.ErrServiceOverloaded):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errors.ErrUnsupported):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError writes the error with the status code reported by
+// statusFromError. Errors of an open circuit breaker carry a Retry-After
+// header telling the client when the service is probed again, and errors of
+// an exceeded creation rate one telling when a session may be created.
+// Missing sessions are reported by writeNotFound.
+func writeError(rw http.ResponseWriter, err error) {
+	if errors.Is(err, session.ErrSessionNotFound) {
+		writeNotFound(rw)
+		return
+	}
+	var openErr *session.CircuitOpenError
+	if errors.As(err, &openErr) {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+	}
+	var creationErr *session.CreationRateError
+	if errors.As(err, &creationErr) {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(creationErr.RetryAfter.Seconds()))))
+	}
+	http.Error(rw, err.Error(), statusFromError(err))
+}
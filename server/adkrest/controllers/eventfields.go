@@ -0,0 +1,73 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+)
+
+// eventProjectionFromRequest parses the fields and excludeFields query
+// parameters, comma-separated lists of the JSON fields of the events to
+// keep or to leave out. The fields must be among the allowed ones, unless
+// allowed is nil. It returns false if neither parameter is present.
+func eventProjectionFromRequest(req *http.Request, allowed []string) (models.EventProjection, bool, error) {
+	query := req.URL.Query()
+	fields, exclude := query.Get("fields"), query.Get("excludeFields")
+	if fields == "" && exclude == "" {
+		return models.EventProjection{}, false, nil
+	}
+	if fields != "" && exclude != "" {
+		return models.EventProjection{}, false, newStatusError(fmt.Errorf("fields and excludeFields can't be combined"), http.StatusBadRequest)
+	}
+	projection := models.EventProjection{Fields: strings.Split(fields, ","), Exclude: exclude != ""}
+	if projection.Exclude {
+		projection.Fields = strings.Split(exclude, ",")
+	}
+	if err := projection.Validate(); err != nil {
+		return models.EventProjection{}, false, newStatusError(err, http.StatusBadRequest)
+	}
+	if allowed != nil {
+		for _, field := range projection.Fields {
+			if !slices.Contains(allowed, field) {
+				return models.EventProjection{}, false, newStatusError(fmt.Errorf("projection of event field %q is not allowed", field), http.StatusBadRequest)
+			}
+		}
+	}
+	return projection, true, nil
+}
+
+// projectEvents returns the page with its events projected.
+func projectEvents(page models.Page[models.Event], projection models.EventProjection) (models.Page[map[string]json.RawMessage], error) {
+	items := make([]map[string]json.RawMessage, len(page.Items))
+	for i, event := range page.Items {
+		projected, err := projection.Project(event)
+		if err != nil {
+			return models.Page[map[string]json.RawMessage]{}, fmt.Errorf("failed to project event %q: %w", event.ID, err)
+		}
+		items[i] = projected
+	}
+	return models.Page[map[string]json.RawMessage]{
+		Items:         items,
+		PageSize:      page.PageSize,
+		NextPageToken: page.NextPageToken,
+		TotalSize:     page.TotalSize,
+	}, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+)
+
+// tagTerm matches events carrying the tag key, and its value when hasValue
+// is set.
+type tagTerm struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// tagFilter selects events by their tags. An event matches when, for every
+// group, it matches at least one of the group's terms.
+type tagFilter [][]tagTerm
+
+// tagFilterFromRequest parses the tag query parameters. Each tag parameter
+// is a comma-separated list of "key" or "key=value" terms that are ORed;
+// repeated tag parameters are ANDed.
+func tagFilterFromRequest(req *http.Request) (tagFilter, error) {
+	var filter tagFilter
+	for _, param := range req.URL.Query()["tag"] {
+		var group []tagTerm
+		for term := range strings.SplitSeq(param, ",") {
+			key, value, hasValue := strings.Cut(term, "=")
+			if key == "" {
+				return nil, newStatusError(fmt.Errorf("invalid tag filter %q", param), http.StatusBadRequest)
+			}
+			group = append(group, tagTerm{key: key, value: value, hasValue: hasValue})
+		}
+		filter = append(filter, group)
+	}
+	return filter, nil
+}
+
+// match reports whether the event satisfies the filter.
+func (f tagFilter) match(event models.Event) bool {
+	for _, group := range f {
+		if !matchAny(group, event.Tags) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(terms []tagTerm, tags map[string]string) bool {
+	for _, term := range terms {
+		value, ok := tags[term.key]
+		if ok && (!term.hasValue || value == term.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sinceFromRequest parses the since query parameter, an RFC 3339 timestamp
+// or a number of seconds since the epoch with an optional fraction. It
+// returns false if the parameter is absent.
+func sinceFromRequest(req *http.Request) (time.Time, bool, error) {
+	value := req.URL.Query().Get("since")
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if since, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return since, true, nil
+	}
+	since, err := parseEpoch(value)
+	if err != nil {
+		return time.Time{}, false, newStatusError(fmt.Errorf("since must be an RFC 3339 timestamp or epoch seconds, got %q", value), http.StatusBadRequest)
+	}
+	return since, true, nil
+}
+
+// afterSequenceFromRequest parses the afterSequence query parameter, the
+// [session.Event.Sequence] of the last event a client has seen. It returns
+// false if the parameter is absent.
+func afterSequenceFromRequest(req *http.Request) (int64, bool, error) {
+	value := req.URL.Query().Get("afterSequence")
+	if value == "" {
+		return 0, false, nil
+	}
+	after, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || after < 0 {
+		return 0, false, newStatusError(fmt.Errorf("afterSequence must be a non-negative integer, got %q", value), http.StatusBadRequest)
+	}
+	return after, true, nil
+}
+
+// parseEpoch parses seconds since the epoch, with up to nanosecond precision,
+// without going through a float.
+func parseEpoch(value string) (time.Time, error) {
+	secStr, fracStr, hasFrac := strings.Cut(value, ".")
+	sec, err := strconv.ParseInt(secStr, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsec int64
+	if hasFrac {
+		if fracStr == "" || len(fracStr) > 9 || strings.ContainsAny(fracStr, "+-") {
+			return time.Time{}, fmt.Errorf("invalid fraction %q", fracStr)
+		}
+		nsec, err = strconv.ParseInt(fracStr+strings.Repeat("0", 9-len(fracStr)), 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if strings.HasPrefix(secStr, "-") {
+			nsec = -nsec
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// EventSchemas maps an app name to the JSON Schema the events clients submit
+// for the app's sessions must conform to. Events are validated as sent by
+// the client, before defaults are filled in. Apps without an entry accept
+// any event.
+type EventSchemas map[string]*jsonschema.Schema
+
+// eventValidator validates events against the resolved [EventSchemas].
+type eventValidator struct {
+	resolved map[string]*jsonschema.Resolved
+	// errs holds the resolution errors of invalid schemas, reported when an
+	// event of their app is validated.
+	errs map[string]error
+}
+
+func (s EventSchemas) resolve() eventValidator {
+	v := eventValidator{resolved: map[string]*jsonschema.Resolved{}, errs: map[string]error{}}
+	for appName, schema := range s {
+		resolved, err := schema.Resolve(nil)
+		if err != nil {
+			v.errs[appName] = fmt.Errorf("invalid event schema for app %q: %w", appName, err)
+			continue
+		}
+		v.resolved[appName] = resolved
+	}
+	return v
+}
+
+// eventBody is where the events are in a request body.
+type eventBody int
+
+const (
+	// singleEvent is a body which is an event.
+	singleEvent eventBody = iota
+	// createEvents is a create session request, with its events field.
+	createEvents
+	// nestedEvent is a request with an event field.
+	nestedEvent
+)
+
+// checkEvent validates an event decoded from JSON against the schema of the
+// app. A nonconforming event is reported with 422 Unprocessable Entity.
+func (v eventValidator) checkEvent(appName string, event any) error {
+	if err, ok := v.errs[appName]; ok {
+		return newStatusError(err, http.StatusInternalServerError)
+	}
+	resolved, ok := v.resolved[appName]
+	if !ok {
+		return nil
+	}
+	if err := resolved.Validate(event); err != nil {
+		return newStatusError(fmt.Errorf("event does not conform to the event schema of app %q: %w", appName, err), http.StatusUnprocessableEntity)
+	}
+	return nil
+}
+
+// checkBody validates the events of the request body against the schema of
+// the app. The body is left for the handler to decode; a body that isn't
+// valid JSON is not an error here, decoding it reports it.
+// Nonconforming events are reported with 422 Unprocessable Entity.
+func (v eventValidator) checkBody(req *http.Request, appName string, kind eventBody) error {
+	if err, ok := v.errs[appName]; ok {
+		return newStatusError(err, http.StatusInternalServerError)
+	}
+	resolved, ok := v.resolved[appName]
+	if !ok || req.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return newStatusError(fmt.Errorf("failed to read request body: %w", err), http.StatusBadRequest)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		return nil
+	}
+
+	var events []any
+	switch kind {
+	case createEvents:
+		var createRequest struct {
+			Events []any `json:"events"`
+		}
+		if err := json.Unmarshal(body, &createRequest); err != nil {
+			return nil
+		}
+		events = createRequest.Events
+	case nestedEvent:
+		var request struct {
+			Event any `json:"event"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil
+		}
+		events = []any{request.Event}
+	default:
+		var event any
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil
+		}
+		events = []any{event}
+	}
+	for i, event := range events {
+		if err := resolved.Validate(event); err != nil {
+			if kind == createEvents {
+				return newStatusError(fmt.Errorf("event %d does not conform to the event schema of app %q: %w", i, appName, err), http.StatusUnprocessableEntity)
+			}
+			return newStatusError(fmt.Errorf("event does not conform to the event schema of app %q: %w", appName, err), http.StatusUnprocessableEntity)
+		}
+	}
+	return nil
+}
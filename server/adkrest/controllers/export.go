@@ -0,0 +1,209 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// ExportSessionsHandler streams every session of an app as NDJSON, one
+// [models.SessionExport] per line, ordered by user and session ID. The
+// sessions are listed once to collect their IDs, then loaded and streamed
+// one at a time, so while streaming only the IDs are held in memory. An
+// interrupted export is resumed by passing the cursor of the last
+// received line as the cursor query parameter. When the request has a
+// user_id, for instance because it is authenticated, only the sessions of
+// that user are exported.
+// With the canonical query parameter, every line is the canonical JSON
+// encoding of its session, see [models.CanonicalJSON], so that equivalent
+// sessions export to identical bytes.
+// With the checksum query parameter, every session carries a checksum of
+// its content, and with the sign parameter also an HMAC signature made
+// with the ArchiveKey setting, see [models.SealSessionExport]. Imports
+// verify them, rejecting corrupted or tampered sessions with 422.
+func (c *SessionsAPIController) ExportSessionsHandler(rw http.ResponseWriter, req *http.Request) {
+	canonical, err := boolQueryParam(req, "canonical")
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	checksum, err := boolQueryParam(req, "checksum")
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	sign, err := boolQueryParam(req, "sign")
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	if sign && len(c.config.ArchiveKey) == 0 {
+		http.Error(rw, "no archive key is configured to sign the export", http.StatusNotImplemented)
+		return
+	}
+	var key []byte
+	if sign {
+		key = c.config.ArchiveKey
+	}
+	c.exportSessions(rw, req, func(s session.Session) ([]byte, error) {
+		respSession, err := models.FromSession(s)
+		if err != nil {
+			return nil, err
+		}
+		export := models.NewSessionExport(respSession)
+		if checksum || sign {
+			if err := models.SealSessionExport(&export, key); err != nil {
+				return nil, err
+			}
+		}
+		if canonical {
+			return models.CanonicalJSON(export)
+		}
+		return json.Marshal(export)
+	})
+}
+
+// ExportSessionLogsHandler streams every session of an app as NDJSON, one
+// OTLP/JSON [models.OTLPLogs] per line, mapping every event to an
+// OpenTelemetry log record, so that sessions can be shipped to a log
+// pipeline. Sessions are ordered, filtered by user and resumed with the
+// cursor query parameter like by [SessionsAPIController.ExportSessionsHandler];
+// the cursor of a line is its adk.export.cursor resource attribute. Records
+// carry the trace and span IDs of their event when the Traces setting knows
+// them.
+func (c *SessionsAPIController) ExportSessionLogsHandler(rw http.ResponseWriter, req *http.Request) {
+	c.exportSessions(rw, req, func(s session.Session) ([]byte, error) {
+		return json.Marshal(models.NewOTLPLogs(s, c.config.Traces))
+	})
+}
+
+// verifyArchive checks the seal of the body of a CreateSession request,
+// and requires the imports to be signed when the RequireSignedImports
+// setting is on.
+func (c *SessionsAPIController) verifyArchive(sessionID models.SessionID, body []byte, createSessionRequest models.CreateSessionRequest) error {
+	requireSignature := createSessionRequest.Import && c.config.RequireSignedImports
+	if !requireSignature && createSessionRequest.Checksum == "" && createSessionRequest.Signature == "" {
+		return nil
+	}
+	if len(body) == 0 {
+		return newStatusError(fmt.Errorf("%w: archive is not signed", models.ErrArchiveIntegrity), http.StatusUnprocessableEntity)
+	}
+	if err := models.VerifySessionArchive(sessionID.AppName, sessionID.UserID, sessionID.ID, body, c.config.ArchiveKey, requireSignature); err != nil {
+		return newStatusError(err, http.StatusUnprocessableEntity)
+	}
+	return nil
+}
+
+// exportKey identifies an exported session.
+type exportKey struct{ userID, sessionID string }
+
+// exportKeys lists the sessions of the app, or of the user if not empty,
+// and returns the keys of those after the cursor in export order. Only
+// the keys are kept, the listed sessions are released on return.
+func (c *SessionsAPIController) exportKeys(ctx context.Context, appName, userID, cursor, afterUser, afterSession string) ([]exportKey, error) {
+	listResp, err := c.service.List(ctx, &session.ListRequest{AppName: appName, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]exportKey, 0, len(listResp.Sessions))
+	for _, s := range listResp.Sessions {
+		key := exportKey{userID: s.UserID(), sessionID: s.ID()}
+		if cursor != "" && cmp.Or(cmp.Compare(key.userID, afterUser), cmp.Compare(key.sessionID, afterSession)) <= 0 {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b exportKey) int {
+		return cmp.Or(cmp.Compare(a.userID, b.userID), cmp.Compare(a.sessionID, b.sessionID))
+	})
+	return keys, nil
+}
+
+// exportSessions streams the sessions of the app requested, after its
+// cursor, with a line per session returned by encode. The sessions deleted
+// after they are listed are left out.
+func (c *SessionsAPIController) exportSessions(rw http.ResponseWriter, req *http.Request, encode func(session.Session) ([]byte, error)) {
+	params := mux.Vars(req)
+	appName, userID := params["app_name"], params["user_id"]
+	if appName == "" {
+		http.Error(rw, "app_name parameter is required", http.StatusBadRequest)
+		return
+	}
+	var afterUser, afterSession string
+	cursor := req.URL.Query().Get("cursor")
+	if cursor != "" {
+		var err error
+		afterUser, afterSession, err = models.DecodeExportCursor(cursor)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	keys, err := c.exportKeys(req.Context(), appName, userID, cursor, afterUser, afterSession)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(rw)
+	abort := func(key exportKey, err error) {
+		if req.Context().Err() == nil {
+			log.Printf("export of app %q aborted at session %q of user %q: %v", appName, key.sessionID, key.userID, err)
+		}
+		// Abort the response, so the client doesn't mistake the truncated
+		// archive for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+	for _, key := range keys {
+		getResp, err := c.service.Get(req.Context(), &session.GetRequest{
+			AppName:   appName,
+			UserID:    key.userID,
+			SessionID: key.sessionID,
+		})
+		if errors.Is(err, session.ErrSessionNotFound) {
+			// The session was deleted since it was listed.
+			continue
+		}
+		if err != nil {
+			abort(key, err)
+		}
+		line, err := encode(getResp.Session)
+		if err != nil {
+			abort(key, err)
+		}
+		if _, err := rw.Write(append(line, '\n')); err != nil {
+			// The client is gone.
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,491 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/gorilla/mux"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestExportSessions(t *testing.T) {
+	ctx := t.Context()
+	source := session.InMemoryService()
+	for _, req := range []*session.CreateRequest{
+		{AppName: "testApp", UserID: "bob", SessionID: "s2", State: map[string]any{"n": float64(2)}},
+		{AppName: "testApp", UserID: "alice", SessionID: "s1", State: map[string]any{"n": float64(1)}},
+		{AppName: "testApp", UserID: "bob", SessionID: "s1"},
+		{AppName: "otherApp", UserID: "alice", SessionID: "s9"},
+	} {
+		created, err := source.Create(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := session.NewEvent("invocation")
+		event.Author = "user"
+		event.Actions.StateDelta = map[string]any{"last": req.UserID + "/" + req.SessionID}
+		if err := source.AppendEvent(ctx, created.Session, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exporter := controllers.NewSessionsAPIController(source)
+
+	exports := exportSessions(t, exporter, "")
+	var gotIDs []string
+	for _, export := range exports {
+		gotIDs = append(gotIDs, export.UserID+"/"+export.SessionID)
+	}
+	if diff := cmp.Diff([]string{"alice/s1", "bob/s1", "bob/s2"}, gotIDs); diff != "" {
+		t.Fatalf("exported sessions mismatch (-want +got):\n%s", diff)
+	}
+
+	// Every line is importable into an empty service as is.
+	target := session.InMemoryService()
+	importer := controllers.NewSessionsAPIControllerWithConfig(target, controllers.SessionsAPIConfig{StrictDecoding: true})
+	for _, export := range exports {
+		body, err := json.Marshal(export.Session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/"+export.UserID+"/sessions/"+export.SessionID, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": export.AppName, "user_id": export.UserID, "session_id": export.SessionID})
+		rr := httptest.NewRecorder()
+		importer.CreateSessionHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("import of %s/%s: got status %v, body: %s", export.UserID, export.SessionID, rr.Code, rr.Body.String())
+		}
+
+		want, err := source.Get(ctx, &session.GetRequest{AppName: export.AppName, UserID: export.UserID, SessionID: export.SessionID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := target.Get(ctx, &session.GetRequest{AppName: export.AppName, UserID: export.UserID, SessionID: export.SessionID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantSession, _ := models.FromSession(want.Session)
+		gotSession, _ := models.FromSession(got.Session)
+		if diff := cmp.Diff(wantSession, gotSession, cmpopts.IgnoreFields(models.Session{}, "UpdatedAt")); diff != "" {
+			t.Errorf("imported session %s/%s mismatch (-want +got):\n%s", export.UserID, export.SessionID, diff)
+		}
+	}
+
+	// Resuming from the cursor of a line exports the sessions after it.
+	resumed := exportSessions(t, exporter, exports[0].Cursor)
+	if diff := cmp.Diff(exports[1:], resumed); diff != "" {
+		t.Errorf("resumed export mismatch (-want +got):\n%s", diff)
+	}
+	if resumed := exportSessions(t, exporter, exports[2].Cursor); len(resumed) != 0 {
+		t.Errorf("export resumed after the last session returned %d sessions, want none", len(resumed))
+	}
+}
+
+func TestExportSessions_Canonical(t *testing.T) {
+	ctx := t.Context()
+	timestamp := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	// The two services hold equivalent sessions, whose state values have the
+	// same JSON content but different Go types.
+	newService := func(point any, count any) session.Service {
+		service := session.InMemoryService()
+		created, err := service.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "alice", SessionID: "s1", State: map[string]any{
+			"point": point,
+			"count": count,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := &session.Event{ID: "e1", InvocationID: "invocation", Author: "user", Timestamp: timestamp}
+		event.Actions.StateDelta = map[string]any{"last": point}
+		if err := service.AppendEvent(ctx, created.Session, event); err != nil {
+			t.Fatal(err)
+		}
+		return service
+	}
+	type point struct {
+		Y int `json:"y"`
+		X int `json:"x"`
+	}
+	first := newService(point{X: 1, Y: 2}, 3)
+	second := newService(map[string]any{"x": 1, "y": 2}, float64(3))
+
+	export := func(service session.Service, canonical bool) string {
+		target := "/apps/testApp/sessions:export"
+		if canonical {
+			target += "?canonical=true"
+		}
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp"})
+		rr := httptest.NewRecorder()
+		controllers.NewSessionsAPIController(service).ExportSessionsHandler(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+		}
+		return rr.Body.String()
+	}
+
+	if export(first, false) == export(second, false) {
+		t.Fatal("plain exports are identical, the test doesn't exercise canonicalization")
+	}
+	got, want := export(first, true), export(second, true)
+	if got != want {
+		t.Errorf("canonical exports differ:\n%s\n%s", got, want)
+	}
+	// Every object has its keys sorted.
+	if !strings.HasPrefix(got, `{"appName":"testApp","cursor":`) || !strings.Contains(got, `"point":{"x":1,"y":2}`) {
+		t.Errorf("canonical export = %s, want sorted keys", got)
+	}
+	// Canonical lines are still session exports.
+	var parsed models.SessionExport
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(got, "\n")), &parsed); err != nil {
+		t.Fatalf("canonical line is not a session export: %v", err)
+	}
+	if parsed.SessionID != "s1" || len(parsed.Session.Events) != 1 {
+		t.Errorf("canonical export = %+v, want session s1 with its event", parsed)
+	}
+}
+
+func TestExportSessions_Sealed(t *testing.T) {
+	ctx := t.Context()
+	source := session.InMemoryService()
+	created, err := source.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "alice", SessionID: "s1", State: map[string]any{"n": float64(2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := session.NewEvent("invocation")
+	event.Author = "user"
+	event.Actions.StateDelta = map[string]any{"big": float64(1 << 60)}
+	if err := source.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("archive-key")
+	exporter := controllers.NewSessionsAPIControllerWithConfig(source, controllers.SessionsAPIConfig{ArchiveKey: key})
+	export := func(t *testing.T, apiController *controllers.SessionsAPIController, query string) (*httptest.ResponseRecorder, json.RawMessage) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/sessions:export?"+query, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp"})
+		rr := httptest.NewRecorder()
+		apiController.ExportSessionsHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			return rr, nil
+		}
+		// The session is imported as found in the archive.
+		var line struct {
+			Session json.RawMessage `json:"session"`
+		}
+		if err := json.Unmarshal(bytes.TrimSpace(rr.Body.Bytes()), &line); err != nil {
+			t.Fatalf("decode export line: %v", err)
+		}
+		return rr, line.Session
+	}
+	importSession := func(t *testing.T, cfg controllers.SessionsAPIConfig, sessionID string, body []byte) int {
+		t.Helper()
+		importer := controllers.NewSessionsAPIControllerWithConfig(session.InMemoryService(), cfg)
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/alice/sessions/"+sessionID, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "alice", "session_id": sessionID})
+		rr := httptest.NewRecorder()
+		importer.CreateSessionHandler(rr, req)
+		return rr.Code
+	}
+
+	_, signed := export(t, exporter, "sign=true&canonical=true")
+	_, checksummed := export(t, exporter, "checksum=true")
+	_, unsealed := export(t, exporter, "")
+	var sealed models.CreateSessionRequest
+	if err := json.Unmarshal(signed, &sealed); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed.Checksum, "sha256:") || !strings.HasPrefix(sealed.Signature, "hmac-sha256:") {
+		t.Fatalf("signed export checksum = %q, signature = %q, want both", sealed.Checksum, sealed.Signature)
+	}
+
+	verifying := controllers.SessionsAPIConfig{ArchiveKey: key, RequireSignedImports: true}
+	tampered := bytes.Replace(signed, []byte(`"n":2`), []byte(`"n":3`), 1)
+	if bytes.Equal(tampered, signed) {
+		t.Fatalf("signed export %s has no state to tamper with", signed)
+	}
+	for _, tt := range []struct {
+		name       string
+		cfg        controllers.SessionsAPIConfig
+		sessionID  string
+		body       []byte
+		wantStatus int
+	}{
+		{name: "signed", cfg: verifying, sessionID: "s1", body: signed, wantStatus: http.StatusOK},
+		{name: "signed and reindented", cfg: verifying, sessionID: "s1", body: indentJSON(t, signed), wantStatus: http.StatusOK},
+		{name: "tampered", cfg: verifying, sessionID: "s1", body: tampered, wantStatus: http.StatusUnprocessableEntity},
+		{name: "under another ID", cfg: verifying, sessionID: "s2", body: signed, wantStatus: http.StatusUnprocessableEntity},
+		{name: "signed with another key", cfg: controllers.SessionsAPIConfig{ArchiveKey: []byte("other-key")}, sessionID: "s1", body: signed, wantStatus: http.StatusUnprocessableEntity},
+		{name: "checksum only", cfg: controllers.SessionsAPIConfig{}, sessionID: "s1", body: checksummed, wantStatus: http.StatusOK},
+		{name: "corrupted checksum only", cfg: controllers.SessionsAPIConfig{}, sessionID: "s1", body: bytes.Replace(checksummed, []byte(`"n":2`), []byte(`"n":3`), 1), wantStatus: http.StatusUnprocessableEntity},
+		{name: "checksum only with a signature required", cfg: verifying, sessionID: "s1", body: checksummed, wantStatus: http.StatusUnprocessableEntity},
+		{name: "unsealed with a signature required", cfg: verifying, sessionID: "s1", body: unsealed, wantStatus: http.StatusUnprocessableEntity},
+		{name: "unsealed", cfg: controllers.SessionsAPIConfig{}, sessionID: "s1", body: unsealed, wantStatus: http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := importSession(t, tt.cfg, tt.sessionID, tt.body); got != tt.wantStatus {
+				t.Errorf("import returned wrong status code: got %v want %v", got, tt.wantStatus)
+			}
+		})
+	}
+
+	if rr, _ := export(t, controllers.NewSessionsAPIController(source), "sign=true"); rr.Code != http.StatusNotImplemented {
+		t.Errorf("signed export without a key returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
+
+func indentJSON(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// deletingService deletes a session right after listing the sessions, as
+// a concurrent request would during an export.
+type deletingService struct {
+	session.Service
+	deleted *session.DeleteRequest
+}
+
+func (s deletingService) List(ctx context.Context, req *session.ListRequest) (*session.ListResponse, error) {
+	resp, err := s.Service.List(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Service.Delete(ctx, s.deleted); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func TestExportSessions_DeletedSession(t *testing.T) {
+	ctx := t.Context()
+	source := session.InMemoryService()
+	for _, req := range []*session.CreateRequest{
+		{AppName: "testApp", UserID: "alice", SessionID: "s1"},
+		{AppName: "testApp", UserID: "bob", SessionID: "s1"},
+		{AppName: "testApp", UserID: "bob", SessionID: "s2"},
+	} {
+		if _, err := source.Create(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exporter := controllers.NewSessionsAPIController(deletingService{
+		Service: source,
+		deleted: &session.DeleteRequest{AppName: "testApp", UserID: "bob", SessionID: "s1"},
+	})
+
+	var gotIDs []string
+	for _, export := range exportSessions(t, exporter, "") {
+		gotIDs = append(gotIDs, export.UserID+"/"+export.SessionID)
+	}
+	if diff := cmp.Diff([]string{"alice/s1", "bob/s2"}, gotIDs); diff != "" {
+		t.Errorf("exported sessions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExportSessions_InvalidCursor(t *testing.T) {
+	apiController := controllers.NewSessionsAPIController(session.InMemoryService())
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/sessions:export?cursor=bad", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp"})
+	rr := httptest.NewRecorder()
+
+	apiController.ExportSessionsHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestExportSessionLogs(t *testing.T) {
+	ctx := t.Context()
+	service := session.InMemoryService()
+	created, err := service.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "alice", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := time.Unix(1700000000, 123456789)
+	userEvent := session.NewEvent("inv1")
+	userEvent.ID = "e1"
+	userEvent.Timestamp = timestamp
+	userEvent.Author = "user"
+	userEvent.Content = genai.NewContentFromText("hello", genai.RoleUser)
+	failedEvent := session.NewEvent("inv1")
+	failedEvent.ID = "e2"
+	failedEvent.Timestamp = timestamp.Add(time.Second)
+	failedEvent.Author = "agent"
+	failedEvent.Branch = "agent.sub"
+	failedEvent.ErrorCode = "SAFETY"
+	failedEvent.ErrorMessage = "blocked"
+	callEvent := session.NewEvent("")
+	callEvent.ID = "e3"
+	callEvent.Timestamp = timestamp.Add(2 * time.Second)
+	callEvent.Author = "agent"
+	callEvent.Content = genai.NewContentFromFunctionCall("lookup", nil, genai.RoleModel)
+	for _, event := range []*session.Event{userEvent, failedEvent, callEvent} {
+		if err := service.AppendEvent(ctx, created.Session, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(service, controllers.SessionsAPIConfig{
+		Traces: func(eventID string) (string, string) {
+			if eventID == "e2" {
+				return "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"
+			}
+			return "", ""
+		},
+	})
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/sessions:exportLogs", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp"})
+	rr := httptest.NewRecorder()
+
+	apiController.ExportSessionLogsHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+	}
+	var got models.OTLPLogs
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	str := func(key, value string) models.OTLPKeyValue {
+		return models.OTLPKeyValue{Key: key, Value: models.OTLPAnyValue{StringValue: &value}}
+	}
+	body := func(value string) models.OTLPAnyValue { return models.OTLPAnyValue{StringValue: &value} }
+	want := models.OTLPLogs{ResourceLogs: []models.OTLPResourceLogs{{
+		Resource: models.OTLPResource{Attributes: []models.OTLPKeyValue{
+			str("service.name", "testApp"),
+			str("enduser.id", "alice"),
+			str("gcp.vertex.agent.session_id", "s1"),
+			str("adk.export.cursor", models.EncodeExportCursor("alice", "s1")),
+		}},
+		ScopeLogs: []models.OTLPScopeLogs{{
+			Scope: models.OTLPScope{Name: "google.golang.org/adk/server/adkrest"},
+			LogRecords: []models.OTLPLogRecord{
+				{
+					TimeUnixNano:   "1700000000123456789",
+					SeverityNumber: 9,
+					SeverityText:   "INFO",
+					Body:           body("hello"),
+					Attributes: []models.OTLPKeyValue{
+						str("gcp.vertex.agent.event_id", "e1"),
+						str("gcp.vertex.agent.author", "user"),
+						str("gcp.vertex.agent.invocation_id", "inv1"),
+					},
+				},
+				{
+					TimeUnixNano:   "1700000001123456789",
+					SeverityNumber: 17,
+					SeverityText:   "ERROR",
+					Body:           body(""),
+					Attributes: []models.OTLPKeyValue{
+						str("gcp.vertex.agent.event_id", "e2"),
+						str("gcp.vertex.agent.author", "agent"),
+						str("gcp.vertex.agent.invocation_id", "inv1"),
+						str("gcp.vertex.agent.branch", "agent.sub"),
+						str("error.type", "SAFETY"),
+						str("exception.message", "blocked"),
+					},
+					TraceID: "0af7651916cd43dd8448eb211c80319c",
+					SpanID:  "b7ad6b7169203331",
+				},
+				{
+					TimeUnixNano:   "1700000002123456789",
+					SeverityNumber: 9,
+					SeverityText:   "INFO",
+					Body:           body(`{"parts":[{"functionCall":{"name":"lookup"}}],"role":"model"}`),
+					Attributes: []models.OTLPKeyValue{
+						str("gcp.vertex.agent.event_id", "e3"),
+						str("gcp.vertex.agent.author", "agent"),
+					},
+				},
+			},
+		}},
+	}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("exported logs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// exportSessions exports the sessions of testApp, resuming after cursor if
+// not empty, and decodes the archive.
+func exportSessions(t *testing.T, apiController *controllers.SessionsAPIController, cursor string) []models.SessionExport {
+	t.Helper()
+	target := "/apps/testApp/sessions:export"
+	if cursor != "" {
+		target += "?cursor=" + url.QueryEscape(cursor)
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp"})
+	rr := httptest.NewRecorder()
+
+	apiController.ExportSessionsHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want %q", got, "application/x-ndjson")
+	}
+	var exports []models.SessionExport
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var export models.SessionExport
+		if err := json.Unmarshal(scanner.Bytes(), &export); err != nil {
+			t.Fatalf("line %q is not a session export: %v", scanner.Text(), err)
+		}
+		exports = append(exports, export)
+	}
+	return exports
+}
@@ -16,25 +16,58 @@
 package controllers
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 )
 
 // TODO: Move to an internal package, controllers doesn't have to be public API.
 
-// EncodeJSONResponse uses the json encoder to write an interface to the http response with an optional status code
+// EncodeJSONResponse uses the json encoder to write an interface to the http response with an optional status code.
+// The body is encoded by the serializer negotiated by [NewSerializerMiddleware], JSON by default.
 func EncodeJSONResponse(i any, status int, w http.ResponseWriter) {
+	serializer := responseSerializer(w)
 	wHeader := w.Header()
-	wHeader.Set("Content-Type", "application/json; charset=UTF-8")
+	wHeader.Set("Content-Type", serializer.ContentType())
 
+	if i == nil {
+		w.WriteHeader(status)
+		return
+	}
+	body, err := serializer.Marshal(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
 
-	if i != nil {
-		err := json.NewEncoder(w).Encode(i)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+// flushThreshold is the number of bytes a flushWriter buffers before
+// flushing them.
+const flushThreshold = 64 << 10
+
+// flushWriter writes to a response, flushing it every flushThreshold
+// bytes, so that long responses reach the client as they are encoded.
+type flushWriter struct {
+	rc        *http.ResponseController
+	w         http.ResponseWriter
+	unflushed int
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	return &flushWriter{rc: http.NewResponseController(w), w: w}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.unflushed += n
+	if err == nil && fw.unflushed >= flushThreshold {
+		fw.unflushed = 0
+		if err := fw.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return n, err
 		}
 	}
+	return n, err
 }
 
 type errorHandler func(http.ResponseWriter, *http.Request) error
@@ -0,0 +1,87 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"net/http"
+	"net/textproto"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultResponseHeaders returns the headers set on every response unless
+// the configuration overrides them: X-Content-Type-Options: nosniff, so
+// that browsers don't sniff JSON responses into something executable.
+func DefaultResponseHeaders() http.Header {
+	return http.Header{"X-Content-Type-Options": {"nosniff"}}
+}
+
+// ResponseHeaders are the headers the middleware of
+// [NewResponseHeadersMiddleware] sets on responses.
+type ResponseHeaders struct {
+	// Default is set on the responses of every route, on top of the
+	// [DefaultResponseHeaders].
+	Default http.Header
+	// Routes maps a route name, such as "GetSession", to the headers set on
+	// its responses, on top of the default ones.
+	Routes map[string]http.Header
+}
+
+// NewResponseHeadersMiddleware returns a middleware setting the configured
+// headers on the responses of the matched routes, for instance the
+// Cache-Control header a CDN expects. A header configured with no value
+// removes the header, for instance to drop one of the
+// [DefaultResponseHeaders]. Headers set by the handlers themselves, like
+// Content-Type or ETag, take precedence.
+func NewResponseHeadersMiddleware(headers ResponseHeaders) mux.MiddlewareFunc {
+	defaults := mergeHeaders(DefaultResponseHeaders(), headers.Default)
+	routes := make(map[string]http.Header, len(headers.Routes))
+	for name, routeHeaders := range headers.Routes {
+		routes[name] = mergeHeaders(defaults, routeHeaders)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			set := defaults
+			if route := mux.CurrentRoute(req); route != nil {
+				if routeHeaders, ok := routes[route.GetName()]; ok {
+					set = routeHeaders
+				}
+			}
+			header := rw.Header()
+			for key, values := range set {
+				if len(values) == 0 {
+					header.Del(key)
+					continue
+				}
+				header[key] = slices.Clone(values)
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// mergeHeaders returns the base headers overridden by the headers of
+// override, with canonical keys. The keys of override without values are
+// kept, so that they remove the header from responses.
+func mergeHeaders(base, override http.Header) http.Header {
+	merged := make(http.Header, len(base)+len(override))
+	for _, h := range []http.Header{base, override} {
+		for key, values := range h {
+			merged[textproto.CanonicalMIMEHeaderKey(key)] = slices.Clone(values)
+		}
+	}
+	return merged
+}
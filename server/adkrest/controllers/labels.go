@@ -0,0 +1,103 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// SetSessionLabelsHandler merges labels into the labels of a session, see
+// [session.LabelService]. Labels with an empty value are removed. The
+// response holds the labels of the session after the change. It fails with
+// 501 when the session service doesn't store labels.
+func (c *SessionsAPIController) SetSessionLabelsHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	sessionID, err := models.SessionIDFromHTTPParameters(mux.Vars(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	labelService, ok := c.service.(session.LabelService)
+	if !ok {
+		http.Error(rw, "session service does not support labels", http.StatusNotImplemented)
+		return
+	}
+	var labelsRequest models.SessionLabels
+	if err := c.decodeRequest(req, &labelsRequest); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkLabels(labelsRequest.Labels); err != nil {
+		writeError(rw, err)
+		return
+	}
+	resp, err := labelService.SetLabels(req.Context(), &session.SetLabelsRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+		Labels:    labelsRequest.Labels,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	labels := resp.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	EncodeJSONResponse(models.SessionLabels{Labels: labels}, http.StatusOK, rw)
+}
+
+// checkLabels returns an error if a label has an empty key.
+func checkLabels(labels map[string]string) error {
+	if _, ok := labels[""]; ok {
+		return newStatusError(fmt.Errorf("label keys must not be empty"), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// labelSelector parses the label query parameters of a list request, each
+// a key=value pair the sessions listed must have.
+func labelSelector(req *http.Request) (map[string]string, error) {
+	values := req.URL.Query()["label"]
+	if len(values) == 0 {
+		return nil, nil
+	}
+	selector := make(map[string]string, len(values))
+	for _, value := range values {
+		key, labelValue, ok := strings.Cut(value, "=")
+		if !ok || key == "" || labelValue == "" {
+			return nil, newStatusError(fmt.Errorf("label must be a key=value pair, got %q", value), http.StatusBadRequest)
+		}
+		if previous, ok := selector[key]; ok && previous != labelValue {
+			return nil, newStatusError(fmt.Errorf("label %q selected with both %q and %q", key, previous, labelValue), http.StatusBadRequest)
+		}
+		selector[key] = labelValue
+	}
+	return selector, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestSessionLabels(t *testing.T) {
+	apiController := controllers.NewSessionsAPIController(session.InMemoryService())
+	call := func(t *testing.T, handler http.HandlerFunc, method, target, sessionID, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, target, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		vars := map[string]string{"app_name": "testApp", "user_id": "testUser"}
+		if sessionID != "" {
+			vars["session_id"] = sessionID
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	for id, body := range map[string]string{
+		"s1": `{"state": {"k": "v"}, "labels": {"env": "prod", "arm": "a"}}`,
+		"s2": `{"labels": {"env": "prod", "arm": "b"}}`,
+		"s3": `{"labels": {"env": "staging"}}`,
+	} {
+		rr := call(t, apiController.CreateSessionHandler, http.MethodPost, "/apps/testApp/users/testUser/sessions/"+id, id, body)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("create returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+	list := func(t *testing.T, selectors ...string) []string {
+		t.Helper()
+		query := url.Values{"label": selectors}
+		rr := call(t, apiController.ListSessionsHandler, http.MethodGet, "/apps/testApp/users/testUser/sessions?"+query.Encode(), "", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("list returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var sessions []models.Session
+		if err := json.NewDecoder(rr.Body).Decode(&sessions); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		var ids []string
+		for _, s := range sessions {
+			ids = append(ids, s.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	if diff := cmp.Diff([]string{"s1", "s2"}, list(t, "env=prod")); diff != "" {
+		t.Errorf("sessions labeled env=prod mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"s2"}, list(t, "env=prod", "arm=b")); diff != "" {
+		t.Errorf("sessions labeled env=prod and arm=b mismatch (-want +got):\n%s", diff)
+	}
+
+	rr := call(t, apiController.SetSessionLabelsHandler, http.MethodPatch, "/apps/testApp/users/testUser/sessions/s1/labels", "s1", `{"labels": {"env": "staging", "arm": ""}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("set labels returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var got models.SessionLabels
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if diff := cmp.Diff(map[string]string{"env": "staging"}, got.Labels); diff != "" {
+		t.Errorf("labels mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"s1", "s3"}, list(t, "env=staging")); diff != "" {
+		t.Errorf("sessions labeled env=staging mismatch (-want +got):\n%s", diff)
+	}
+
+	// Labels are returned with the session, apart from its state.
+	rr = call(t, apiController.GetSessionHandler, http.MethodGet, "/apps/testApp/users/testUser/sessions/s1", "s1", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var gotSession models.Session
+	if err := json.NewDecoder(rr.Body).Decode(&gotSession); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if diff := cmp.Diff(map[string]string{"env": "staging"}, gotSession.Labels); diff != "" {
+		t.Errorf("session labels mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]any{"k": "v"}, gotSession.State); diff != "" {
+		t.Errorf("session state mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, selector := range []string{"env", "=prod", "env="} {
+		rr := call(t, apiController.ListSessionsHandler, http.MethodGet, "/apps/testApp/users/testUser/sessions?label="+url.QueryEscape(selector), "", "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("list with label %q returned wrong status code: got %v want %v", selector, rr.Code, http.StatusBadRequest)
+		}
+	}
+	rr = call(t, apiController.SetSessionLabelsHandler, http.MethodPatch, "/apps/testApp/users/testUser/sessions/s1/labels", "s1", `{"labels": {"": "x"}}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("set labels with an empty key returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	rr = call(t, apiController.SetSessionLabelsHandler, http.MethodPatch, "/apps/testApp/users/testUser/sessions/missing/labels", "missing", `{"labels": {"env": "prod"}}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("set labels of a missing session returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestSessionLabels_Unsupported(t *testing.T) {
+	apiController := controllers.NewSessionsAPIController(&fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{}})
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    string
+	}{
+		{name: "set labels", handler: apiController.SetSessionLabelsHandler, method: http.MethodPatch, body: `{"labels": {"env": "prod"}}`},
+		{name: "create with labels", handler: apiController.CreateSessionHandler, method: http.MethodPost, body: `{"labels": {"env": "prod"}}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+			rr := httptest.NewRecorder()
+
+			tt.handler(rr, req)
+
+			if status := rr.Code; status != http.StatusNotImplemented {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotImplemented)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// LeaseTokenHeader is the header carrying the token of a session lease.
+// It identifies the lease to renew or release, and lets writes through to a
+// session leased with it when the service requires leases.
+const LeaseTokenHeader = "X-Session-Lease"
+
+// defaultLeaseTTL is the TTL of leases acquired or renewed without one.
+const defaultLeaseTTL = 30 * time.Second
+
+// leaseContext returns the context of the request, carrying the lease token
+// of the request if it has one.
+func leaseContext(req *http.Request) context.Context {
+	if token := req.Header.Get(LeaseTokenHeader); token != "" {
+		return session.ContextWithLeaseToken(req.Context(), token)
+	}
+	return req.Context()
+}
+
+// leaseService returns the session service as a [session.LeaseService] and
+// the ID of the session of the request, or writes an error and returns
+// false.
+func (c *SessionsAPIController) leaseService(rw http.ResponseWriter, req *http.Request) (session.LeaseService, models.SessionID, bool) {
+	sessionID, err := models.SessionIDFromHTTPParameters(mux.Vars(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return nil, sessionID, false
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return nil, sessionID, false
+	}
+	leaseService, ok := c.service.(session.LeaseService)
+	if !ok {
+		http.Error(rw, "session service does not support leases", http.StatusNotImplemented)
+		return nil, sessionID, false
+	}
+	return leaseService, sessionID, true
+}
+
+// leaseTTL converts a TTL in seconds of a request, defaulting to
+// defaultLeaseTTL.
+func leaseTTL(seconds float64) (time.Duration, error) {
+	switch {
+	case seconds < 0:
+		return 0, fmt.Errorf("ttlSeconds must not be negative, got %v", seconds)
+	case seconds == 0:
+		return defaultLeaseTTL, nil
+	default:
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+}
+
+// AcquireSessionLeaseHandler acquires an exclusive lease on a session. It
+// fails with 409 Conflict while another holder has the lease, unless the
+// request waits for it, and with 503 in read-only mode, where the writes
+// the lease is for are rejected.
+func (c *SessionsAPIController) AcquireSessionLeaseHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	leaseService, sessionID, ok := c.leaseService(rw, req)
+	if !ok {
+		return
+	}
+	body := models.AcquireLeaseRequest{}
+	if err := c.decodeRequest(req, &body); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl, err := leaseTTL(body.TTLSeconds)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lease, err := leaseService.AcquireLease(req.Context(), &session.AcquireLeaseRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+		Holder:    body.Holder,
+		TTL:       ttl,
+		Wait:      body.Wait,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(models.FromSessionLease(lease), http.StatusOK, rw)
+}
+
+// RenewSessionLeaseHandler extends the lease whose token is in the
+// LeaseTokenHeader. It fails with 409 Conflict if the lease has ended.
+// Renewals are accepted in read-only mode, so that the holders of a lease
+// keep it until writes are enabled again.
+func (c *SessionsAPIController) RenewSessionLeaseHandler(rw http.ResponseWriter, req *http.Request) {
+	leaseService, sessionID, ok := c.leaseService(rw, req)
+	if !ok {
+		return
+	}
+	body := models.RenewLeaseRequest{}
+	if req.ContentLength > 0 {
+		if err := c.decodeRequest(req, &body); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ttl, err := leaseTTL(body.TTLSeconds)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lease, err := leaseService.RenewLease(req.Context(), &session.RenewLeaseRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+		Token:     req.Header.Get(LeaseTokenHeader),
+		TTL:       ttl,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(models.FromSessionLease(lease), http.StatusOK, rw)
+}
+
+// ReleaseSessionLeaseHandler ends the lease whose token is in the
+// LeaseTokenHeader. It fails with 409 Conflict if the lease has ended.
+// Releases are accepted in read-only mode, so that holders winding down
+// don't leave the session leased until the lease expires.
+func (c *SessionsAPIController) ReleaseSessionLeaseHandler(rw http.ResponseWriter, req *http.Request) {
+	leaseService, sessionID, ok := c.leaseService(rw, req)
+	if !ok {
+		return
+	}
+	err := leaseService.ReleaseLease(req.Context(), &session.ReleaseLeaseRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+		Token:     req.Header.Get(LeaseTokenHeader),
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(nil, http.StatusOK, rw)
+}
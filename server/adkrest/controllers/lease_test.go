@@ -0,0 +1,168 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestSessionLease(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{RequireLease: true})
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: id.AppName, UserID: id.UserID, SessionID: id.SessionID}); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	serve := func(handler http.HandlerFunc, method, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/apps/testApp/users/testUser/sessions/testSession/lease", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(controllers.LeaseTokenHeader, token)
+		}
+		req = mux.SetURLVars(req, sessionVars(id))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := serve(apiController.AcquireSessionLeaseHandler, http.MethodPost, `{"holder": "runner-a", "ttlSeconds": 60}`, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("acquire: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+	var lease models.Lease
+	if err := json.Unmarshal(rr.Body.Bytes(), &lease); err != nil {
+		t.Fatalf("decode lease: %v", err)
+	}
+	if lease.Holder != "runner-a" || lease.Token == "" || lease.ExpiresAt.IsZero() {
+		t.Errorf("acquired lease = %+v, want a lease of runner-a with a token and an expiry", lease)
+	}
+
+	if rr := serve(apiController.AcquireSessionLeaseHandler, http.MethodPost, `{"holder": "runner-b"}`, ""); rr.Code != http.StatusConflict {
+		t.Errorf("acquire of a leased session: got status %v, want %v", rr.Code, http.StatusConflict)
+	}
+
+	// Writes require the lease token while the session is leased.
+	appendEvent := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(`{"author": "user"}`))
+		if token != "" {
+			req.Header.Set(controllers.LeaseTokenHeader, token)
+		}
+		req = mux.SetURLVars(req, sessionVars(id))
+		rr := httptest.NewRecorder()
+		apiController.AppendEventHandler(rr, req)
+		return rr.Code
+	}
+	if got := appendEvent(""); got != http.StatusConflict {
+		t.Errorf("append without the lease: got status %v, want %v", got, http.StatusConflict)
+	}
+	if got := appendEvent(lease.Token); got != http.StatusOK {
+		t.Errorf("append with the lease: got status %v, want %v", got, http.StatusOK)
+	}
+
+	rr = serve(apiController.RenewSessionLeaseHandler, http.MethodPut, `{"ttlSeconds": 120}`, lease.Token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("renew: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+	var renewed models.Lease
+	if err := json.Unmarshal(rr.Body.Bytes(), &renewed); err != nil {
+		t.Fatalf("decode lease: %v", err)
+	}
+	if !renewed.ExpiresAt.After(lease.ExpiresAt) {
+		t.Errorf("renewed lease expires at %v, want after %v", renewed.ExpiresAt, lease.ExpiresAt)
+	}
+	if rr := serve(apiController.RenewSessionLeaseHandler, http.MethodPut, "", "wrong"); rr.Code != http.StatusConflict {
+		t.Errorf("renew with a wrong token: got status %v, want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := serve(apiController.AcquireSessionLeaseHandler, http.MethodPost, `{"ttlSeconds": -1}`, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("acquire with a negative TTL: got status %v, want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	if rr := serve(apiController.ReleaseSessionLeaseHandler, http.MethodDelete, "", lease.Token); rr.Code != http.StatusOK {
+		t.Fatalf("release: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := serve(apiController.ReleaseSessionLeaseHandler, http.MethodDelete, "", lease.Token); rr.Code != http.StatusConflict {
+		t.Errorf("second release: got status %v, want %v", rr.Code, http.StatusConflict)
+	}
+	if got := appendEvent(""); got != http.StatusOK {
+		t.Errorf("append after release: got status %v, want %v", got, http.StatusOK)
+	}
+}
+
+func TestSessionLease_ReadOnly(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: id.AppName, UserID: id.UserID, SessionID: id.SessionID}); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := &controllers.ReadOnlyMode{}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{ReadOnly: readOnly})
+	serve := func(handler http.HandlerFunc, method, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/apps/testApp/users/testUser/sessions/testSession/lease", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(controllers.LeaseTokenHeader, token)
+		}
+		req = mux.SetURLVars(req, sessionVars(id))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := serve(apiController.AcquireSessionLeaseHandler, http.MethodPost, `{"holder": "runner-a"}`, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("acquire: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+	var lease models.Lease
+	if err := json.Unmarshal(rr.Body.Bytes(), &lease); err != nil {
+		t.Fatalf("decode lease: %v", err)
+	}
+
+	// The holder keeps and releases its lease, new leases are refused.
+	readOnly.SetEnabled(true)
+	if rr := serve(apiController.AcquireSessionLeaseHandler, http.MethodPost, `{"holder": "runner-b"}`, ""); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("read-only acquire: got status %v, want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	if rr := serve(apiController.RenewSessionLeaseHandler, http.MethodPut, "", lease.Token); rr.Code != http.StatusOK {
+		t.Errorf("read-only renew: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := serve(apiController.ReleaseSessionLeaseHandler, http.MethodDelete, "", lease.Token); rr.Code != http.StatusOK {
+		t.Errorf("read-only release: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSessionLease_Unsupported(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	apiController := controllers.NewSessionsAPIController(&fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{}})
+	req := httptest.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/lease", strings.NewReader(`{}`))
+	req = mux.SetURLVars(req, sessionVars(id))
+	rr := httptest.NewRecorder()
+
+	apiController.AcquireSessionLeaseHandler(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/adk/session"
+)
+
+// MetricsAPIController is the controller for the Metrics API.
+type MetricsAPIController struct {
+	sessionService session.Service
+}
+
+// NewMetricsAPIController creates the controller for the Metrics API.
+func NewMetricsAPIController(sessionService session.Service) *MetricsAPIController {
+	return &MetricsAPIController{sessionService: sessionService}
+}
+
+// appGauges describes the per-app gauges exported by the MetricsHandler.
+var appGauges = []struct {
+	name  string
+	help  string
+	value func(session.AppStats) int64
+}{
+	{"adk_app_sessions", "Number of sessions stored for the app.", func(s session.AppStats) int64 { return int64(s.Sessions) }},
+	{"adk_app_state_bytes", "Size in bytes of the JSON encoded session state stored for the app.", func(s session.AppStats) int64 { return s.StateBytes }},
+	{"adk_app_events_total", "Number of events stored for the app.", func(s session.AppStats) int64 { return int64(s.Events) }},
+}
+
+// MetricsHandler writes the per-app storage gauges in the Prometheus text
+// exposition format. The statistics are maintained by the session service,
+// so a scrape does not scan the stored sessions.
+func (c *MetricsAPIController) MetricsHandler(rw http.ResponseWriter, req *http.Request) {
+	statsService, ok := c.sessionService.(session.StatsService)
+	if !ok {
+		http.Error(rw, "session service does not provide statistics", http.StatusNotImplemented)
+		return
+	}
+	stats, err := statsService.AppStats(req.Context())
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	var b strings.Builder
+	apps := slices.Sorted(maps.Keys(stats))
+	for _, gauge := range appGauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n", gauge.name, gauge.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", gauge.name)
+		for _, app := range apps {
+			fmt.Fprintf(&b, "%s{app=%q} %d\n", gauge.name, escapeLabelValue(app), gauge.value(stats[app]))
+		}
+	}
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	if _, err := rw.Write([]byte(b.String())); err != nil {
+		writeError(rw, err)
+	}
+}
+
+// escapeLabelValue prepares a label value for %q formatting, which already
+// escapes backslashes, quotes and newlines as the exposition format requires.
+// Other non-printable characters are dropped, since %q would escape them in
+// a way Prometheus does not understand.
+func escapeLabelValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && (r < 0x20 || r == 0x7f) {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,73 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+	"google.golang.org/adk/session"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	sessionService := session.InMemoryService()
+	for _, req := range []*session.CreateRequest{
+		{AppName: "app1", UserID: "user", SessionID: "s1", State: map[string]any{"k": "v"}},
+		{AppName: "app1", UserID: "user", SessionID: "s2"},
+		{AppName: "app2", UserID: "user", SessionID: "s1"},
+	} {
+		if _, err := sessionService.Create(t.Context(), req); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+
+	apiController := controllers.NewMetricsAPIController(sessionService)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+
+	apiController.MetricsHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE adk_app_sessions gauge\n",
+		`adk_app_sessions{app="app1"} 2` + "\n",
+		`adk_app_sessions{app="app2"} 1` + "\n",
+		`adk_app_state_bytes{app="app1"} 11` + "\n",
+		`adk_app_state_bytes{app="app2"} 2` + "\n",
+		`adk_app_events_total{app="app1"} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output does not contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsHandler_Unsupported(t *testing.T) {
+	apiController := controllers.NewMetricsAPIController(&fakes.FakeSessionService{})
+	rr := httptest.NewRecorder()
+
+	apiController.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
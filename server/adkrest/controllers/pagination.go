@@ -0,0 +1,104 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+)
+
+const (
+	// DefaultPageSize is the default SessionsAPIConfig.DefaultPageSize.
+	DefaultPageSize = 100
+	// DefaultMaxPageSize is the default SessionsAPIConfig.MaxPageSize.
+	DefaultMaxPageSize = 1000
+)
+
+// PageSizes are the page sizes of the paginated lists.
+type PageSizes struct {
+	// Default is the size of the pages of the requests omitting pageSize.
+	// Optional: defaults to [DefaultPageSize], and is capped by Max.
+	Default int
+	// Max is the largest page size, larger requested sizes are reduced to
+	// it. Optional: defaults to [DefaultMaxPageSize].
+	Max int
+}
+
+// resolve returns the sizes with their defaults applied.
+func (s PageSizes) resolve() PageSizes {
+	if s.Max <= 0 {
+		s.Max = DefaultMaxPageSize
+	}
+	if s.Default <= 0 {
+		s.Default = DefaultPageSize
+	}
+	s.Default = min(s.Default, s.Max)
+	return s
+}
+
+// pageParams are the pagination query parameters of a list request.
+type pageParams struct {
+	size  int
+	token string
+	// requested reports whether the client sent any pagination parameter.
+	requested bool
+}
+
+// pageParamsFromRequest parses the pageSize and pageToken query parameters,
+// the page size defaulting to and being clamped by the sizes.
+func pageParamsFromRequest(req *http.Request, sizes PageSizes) (pageParams, error) {
+	sizes = sizes.resolve()
+	query := req.URL.Query()
+	params := pageParams{
+		size:      sizes.Default,
+		token:     query.Get("pageToken"),
+		requested: query.Has("pageSize") || query.Has("pageToken"),
+	}
+	if sizeStr := query.Get("pageSize"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			return pageParams{}, newStatusError(fmt.Errorf("pageSize must be a positive integer, got %q", sizeStr), http.StatusBadRequest)
+		}
+		params.size = min(size, sizes.Max)
+	}
+	return params, nil
+}
+
+// paginate returns the page of items selected by params. The items must be
+// in a stable order across requests. The page tokens are signed by tokens for
+// the scope identifying the list, and rejected with 400 Bad Request when
+// presented for another list.
+func paginate[T any](items []T, params pageParams, tokens *models.PageTokenSigner, scope ...string) (models.Page[T], error) {
+	offset, err := tokens.Decode(params.token, scope...)
+	if err != nil {
+		return models.Page[T]{}, newStatusError(err, http.StatusBadRequest)
+	}
+	offset = min(offset, len(items))
+	end := min(offset+params.size, len(items))
+
+	total := len(items)
+	page := models.Page[T]{
+		Items:     items[offset:end],
+		PageSize:  params.size,
+		TotalSize: &total,
+	}
+	if end < len(items) {
+		page.NextPageToken = tokens.Encode(end, scope...)
+	}
+	return page, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/gorilla/mux"
+)
+
+// PathNormalization is what the server does with a request whose path is not
+// in its canonical form: with a trailing slash, duplicate slashes, or dot
+// segments. Paths are normalized in their escaped form, so encoded
+// characters of the IDs, including encoded slashes, are never altered.
+type PathNormalization int
+
+const (
+	// PathRedirect redirects the request to the canonical path with 308
+	// Permanent Redirect, which keeps its method and body.
+	PathRedirect PathNormalization = iota
+	// PathRewrite serves the request as if it had the canonical path.
+	PathRewrite
+	// PathReject fails the request with 400 Bad Request.
+	PathReject
+)
+
+// canonicalPath returns the canonical form of the escaped path.
+func canonicalPath(escaped string) string {
+	if escaped == "" || escaped == "/" {
+		return "/"
+	}
+	return path.Clean("/" + escaped)
+}
+
+// NewPathNormalizationMiddleware returns a middleware normalizing the request
+// paths according to the mode. It must wrap the router, since routes are
+// matched on the normalized path.
+func NewPathNormalizationMiddleware(mode PathNormalization) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			escaped := req.URL.EscapedPath()
+			canonical := canonicalPath(escaped)
+			if canonical == escaped {
+				next.ServeHTTP(rw, req)
+				return
+			}
+			switch mode {
+			case PathRewrite:
+				decoded, err := url.PathUnescape(canonical)
+				if err != nil {
+					http.Error(rw, fmt.Sprintf("invalid path %q: %v", escaped, err), http.StatusBadRequest)
+					return
+				}
+				req = req.Clone(req.Context())
+				req.URL.Path = decoded
+				req.URL.RawPath = canonical
+				next.ServeHTTP(rw, req)
+			case PathReject:
+				http.Error(rw, fmt.Sprintf("path %q is not canonical, use %q", escaped, canonical), http.StatusBadRequest)
+			default:
+				location := canonical
+				if req.URL.RawQuery != "" {
+					location += "?" + req.URL.RawQuery
+				}
+				rw.Header().Set("Location", location)
+				rw.WriteHeader(http.StatusPermanentRedirect)
+			}
+		})
+	}
+}
+
+// NewPathVarsMiddleware returns a middleware unescaping the route variables
+// of a router matching on escaped paths, so that handlers get the decoded
+// IDs, including the ones with an encoded slash. It must run before any
+// other middleware reading the variables.
+func NewPathVarsMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			vars := mux.Vars(req)
+			if len(vars) == 0 {
+				next.ServeHTTP(rw, req)
+				return
+			}
+			decoded := make(map[string]string, len(vars))
+			for name, value := range vars {
+				unescaped, err := url.PathUnescape(value)
+				if err != nil {
+					http.Error(rw, fmt.Sprintf("invalid %s parameter %q: %v", name, value, err), http.StatusBadRequest)
+					return
+				}
+				decoded[name] = unescaped
+			}
+			next.ServeHTTP(rw, mux.SetURLVars(req, decoded))
+		})
+	}
+}
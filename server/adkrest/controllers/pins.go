@@ -0,0 +1,67 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// PinEventHandler pins an event of a session on PUT and unpins it on
+// DELETE, see [session.PinnedTag]. Pinned events are never trimmed by the
+// event retention of the session service. The response holds the event
+// after the change. It fails with 501 when the session service doesn't
+// support pinning events.
+func (c *SessionsAPIController) PinEventHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	vars := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(vars)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	eventID := vars["event_id"]
+	if eventID == "" {
+		http.Error(rw, "event_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	pinService, ok := c.service.(session.PinService)
+	if !ok {
+		http.Error(rw, "session service does not support pinning events", http.StatusNotImplemented)
+		return
+	}
+	resp, err := pinService.PinEvent(leaseContext(req), &session.PinEventRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+		EventID:   eventID,
+		Pinned:    req.Method != http.MethodDelete,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(models.FromSessionEvent(*resp.Event), http.StatusOK, rw)
+}
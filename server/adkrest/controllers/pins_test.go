@@ -0,0 +1,98 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestPinEvent(t *testing.T) {
+	service := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		Retention: session.EventRetentionLimits{Default: session.EventRetention{MaxEvents: 1}},
+	})
+	apiController := controllers.NewSessionsAPIController(service)
+	created, err := service.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := session.NewEvent("inv")
+	event.ID = "handoff"
+	if err := service.AppendEvent(t.Context(), created.Session, event); err != nil {
+		t.Fatal(err)
+	}
+	pin := func(t *testing.T, method, eventID string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, "/apps/testApp/users/testUser/sessions/s1/events/"+eventID+"/pin", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "s1", "event_id": eventID})
+		rr := httptest.NewRecorder()
+		apiController.PinEventHandler(rr, req)
+		return rr
+	}
+
+	rr := pin(t, http.MethodPut, "handoff")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("pin returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var got models.Event
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Tags[session.PinnedTag] != "true" {
+		t.Errorf("pinned event tags = %v, want %s=true", got.Tags, session.PinnedTag)
+	}
+
+	// The pinned event survives the retention of a single event.
+	next := session.NewEvent("inv")
+	next.ID = "next"
+	if err := service.AppendEvent(t.Context(), created.Session, next); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := service.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Session.Events().Len(); got != 2 {
+		t.Errorf("events after append = %d, want 2", got)
+	}
+
+	if rr := pin(t, http.MethodDelete, "handoff"); rr.Code != http.StatusOK {
+		t.Errorf("unpin returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if rr := pin(t, http.MethodPut, "handoff"); rr.Code != http.StatusNotFound {
+		t.Errorf("pin of a trimmed event returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	fakeController := controllers.NewSessionsAPIController(&fakes.FakeSessionService{})
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/apps/testApp/users/testUser/sessions/s1/events/e1/pin", nil),
+		map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "s1", "event_id": "e1"})
+	rr = httptest.NewRecorder()
+	fakeController.PinEventHandler(rr, req)
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("pin with an unsupported service returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
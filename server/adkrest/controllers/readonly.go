@@ -0,0 +1,62 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// errReadOnly is the error of the writes rejected in read-only mode.
+var errReadOnly = errors.New("server is in read-only mode, writes are temporarily disabled")
+
+// ReadOnlyMode is a server-wide switch which makes the write handlers reject
+// requests while it is enabled. Reads keep working.
+// The zero value is disabled. It is safe for concurrent use.
+type ReadOnlyMode struct {
+	enabled atomic.Bool
+}
+
+// Enabled reports whether the read-only mode is enabled. A nil ReadOnlyMode
+// is never enabled.
+func (m *ReadOnlyMode) Enabled() bool {
+	return m != nil && m.enabled.Load()
+}
+
+// SetEnabled enables or disables the read-only mode.
+func (m *ReadOnlyMode) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// rejectWrite responds with 503 Service Unavailable and returns true if the
+// read-only mode is enabled.
+func (m *ReadOnlyMode) rejectWrite(rw http.ResponseWriter) bool {
+	if !m.Enabled() {
+		return false
+	}
+	http.Error(rw, errReadOnly.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// checkWrite is rejectWrite for the handlers returning their errors: it
+// returns an error reported with 503 Service Unavailable if the read-only
+// mode is enabled.
+func (m *ReadOnlyMode) checkWrite() error {
+	if !m.Enabled() {
+		return nil
+	}
+	return newStatusError(errReadOnly, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,109 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+	newID := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "newSession",
+	}
+	sessionService := fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{
+		id: {Id: id, SessionState: fakes.TestState{"foo": "bar"}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()},
+	}}
+	readOnly := &controllers.ReadOnlyMode{}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{ReadOnly: readOnly})
+	adminController := controllers.NewAdminAPIController(readOnly)
+
+	type call struct {
+		name    string
+		method  string
+		vars    fakes.SessionKey
+		body    string
+		handler http.HandlerFunc
+		write   bool
+	}
+	calls := []call{
+		{"get", http.MethodGet, id, "", apiController.GetSessionHandler, false},
+		{"list", http.MethodGet, fakes.SessionKey{AppName: id.AppName, UserID: id.UserID}, "", apiController.ListSessionsHandler, false},
+		{"create", http.MethodPost, newID, "", apiController.CreateSessionHandler, true},
+		{"patch", http.MethodPatch, id, `{"stateDelta": {"foo": "baz"}}`, apiController.UpdateSessionHandler, true},
+		{"append", http.MethodPost, id, `{"author": "user"}`, apiController.AppendEventHandler, true},
+		{"delete", http.MethodDelete, id, "", apiController.DeleteSessionHandler, true},
+	}
+	serve := func(c call) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(c.method, "/", strings.NewReader(c.body))
+		req = mux.SetURLVars(req, sessionVars(c.vars))
+		rr := httptest.NewRecorder()
+		c.handler(rr, req)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	adminController.SetReadOnlyHandler(rr, httptest.NewRequest(http.MethodPut, "/admin/read-only", strings.NewReader(`{"readOnly": true}`)))
+	if rr.Code != http.StatusOK || !readOnly.Enabled() {
+		t.Fatalf("SetReadOnlyHandler() = %v, read-only enabled: %v", rr.Code, readOnly.Enabled())
+	}
+
+	for _, c := range calls {
+		t.Run("read-only "+c.name, func(t *testing.T) {
+			rr := serve(c)
+			wantStatus := http.StatusOK
+			if c.write {
+				wantStatus = http.StatusServiceUnavailable
+			}
+			if rr.Code != wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, wantStatus, rr.Body.String())
+			}
+		})
+	}
+	if got := sessionService.Sessions[id].SessionState["foo"]; got != "bar" {
+		t.Errorf("session state changed in read-only mode, foo = %v", got)
+	}
+	if len(sessionService.Sessions) != 1 {
+		t.Errorf("sessions created or deleted in read-only mode, got %d sessions", len(sessionService.Sessions))
+	}
+
+	rr = httptest.NewRecorder()
+	adminController.SetReadOnlyHandler(rr, httptest.NewRequest(http.MethodPut, "/admin/read-only", strings.NewReader(`{"readOnly": false}`)))
+	if rr.Code != http.StatusOK || readOnly.Enabled() {
+		t.Fatalf("SetReadOnlyHandler() = %v, read-only enabled: %v", rr.Code, readOnly.Enabled())
+	}
+	for _, c := range calls {
+		t.Run("read-write "+c.name, func(t *testing.T) {
+			if rr := serve(c); rr.Code != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+		})
+	}
+}
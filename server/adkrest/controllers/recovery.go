@@ -0,0 +1,100 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader is the header carrying the ID of a request. The ID is
+// taken from the request when the client sets it, generated otherwise, and
+// always echoed in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// PanicFunc reports a panic recovered while serving a request.
+type PanicFunc func(req *http.Request, requestID string, recovered any, stack []byte)
+
+// NewRecoveryMiddleware returns a middleware which recovers the panics of
+// handlers, so that a bad request can't take the server down.
+//
+// The panic is reported to onPanic, or logged with its stack when onPanic is
+// nil, and the client receives a 500 error without details. If the response
+// was already started, the connection is aborted instead, so the client
+// doesn't mistake a partial response for a complete one. Responses aborted on
+// purpose with [http.ErrAbortHandler], and panics of requests whose client is
+// gone, are passed on to the server as they are.
+func NewRecoveryMiddleware(onPanic PanicFunc) mux.MiddlewareFunc {
+	if onPanic == nil {
+		onPanic = logPanic
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requestID := req.Header.Get(RequestIDHeader)
+			if requestID == "" {
+				requestID = uuid.NewString()
+			}
+			rw.Header().Set(RequestIDHeader, requestID)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, requestID))
+			recorder := &startedResponseWriter{ResponseWriter: rw}
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler || req.Context().Err() != nil {
+					panic(recovered)
+				}
+				onPanic(req, requestID, recovered, debug.Stack())
+				if recorder.started {
+					panic(http.ErrAbortHandler)
+				}
+				http.Error(rw, "internal server error, request ID "+requestID, http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(recorder, req)
+		})
+	}
+}
+
+func logPanic(req *http.Request, requestID string, recovered any, stack []byte) {
+	log.Printf("panic serving %s %s (request ID %s): %v\n%s", req.Method, req.URL.Path, requestID, recovered, stack)
+}
+
+// startedResponseWriter records whether the response was started.
+type startedResponseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *startedResponseWriter) WriteHeader(code int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *startedResponseWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets [http.ResponseController] reach the wrapped writer, for
+// instance to flush streamed responses.
+func (w *startedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	type report struct {
+		requestID string
+		recovered any
+		stack     string
+	}
+	var (
+		mu      sync.Mutex
+		reports []report
+	)
+	router := mux.NewRouter()
+	router.Use(controllers.NewRecoveryMiddleware(func(req *http.Request, requestID string, recovered any, stack []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, report{requestID: requestID, recovered: recovered, stack: string(stack)})
+	}))
+	router.HandleFunc("/panic", func(rw http.ResponseWriter, req *http.Request) {
+		panic("secret internal detail")
+	})
+	router.HandleFunc("/panic-after-write", func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(rw, "partial")
+		_ = http.NewResponseController(rw).Flush()
+		panic("late failure")
+	})
+	router.HandleFunc("/abort", func(rw http.ResponseWriter, req *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	router.HandleFunc("/ok", func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(rw, "ok")
+	})
+	server := httptest.NewUnstartedServer(router)
+	// Keep the server's own report of aborted connections out of the test
+	// output.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.Start()
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/panic", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set(controllers.RequestIDHeader, "req-1")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request to panicking handler failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got status %v, want %v", resp.StatusCode, http.StatusInternalServerError)
+	}
+	if strings.Contains(string(body), "secret") {
+		t.Errorf("response body %q leaks the panic value", body)
+	}
+	if got := resp.Header.Get(controllers.RequestIDHeader); got != "req-1" {
+		t.Errorf("%s = %q, want %q", controllers.RequestIDHeader, got, "req-1")
+	}
+
+	// A panic after the response started aborts the connection.
+	if resp, err := server.Client().Get(server.URL + "/panic-after-write"); err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			t.Errorf("response of handler panicking mid-response completed, want it aborted")
+		}
+	}
+
+	// Deliberate aborts are not reported.
+	if resp, err := server.Client().Get(server.URL + "/abort"); err == nil {
+		resp.Body.Close()
+		t.Errorf("aborted request returned status %v, want a connection error", resp.StatusCode)
+	}
+
+	// The server keeps serving.
+	resp, err = server.Client().Get(server.URL + "/ok")
+	if err != nil {
+		t.Fatalf("request after panics failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %v %q after panics, want 200 %q", resp.StatusCode, body, "ok")
+	}
+	if resp.Header.Get(controllers.RequestIDHeader) == "" {
+		t.Errorf("generated %s missing", controllers.RequestIDHeader)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) != 2 {
+		t.Fatalf("got %d panic reports, want 2: %+v", len(reports), reports)
+	}
+	if got := reports[0]; got.requestID != "req-1" || got.recovered != "secret internal detail" || !strings.Contains(got.stack, "recovery_test.go") {
+		t.Errorf("first report = %+v, want the request ID, the panic value and the stack", got)
+	}
+	if reports[1].recovered != "late failure" {
+		t.Errorf("second report recovered %v, want %q", reports[1].recovered, "late failure")
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+// defaultReorderMaxHeld is the number of events held by an event stream
+// when [EventReordering.MaxHeld] is not set.
+const defaultReorderMaxHeld = 64
+
+// EventReordering holds the events of the SSE event streams briefly, so that
+// the events of a session delivered out of order are sent in the order of
+// their sequence numbers. An event is sent as soon as the events before it
+// in its session are sent, or once it was held for the window, no longer
+// waiting for the events missing before it. Events without sequence
+// numbers, and events arriving after the ones following them were sent, are
+// sent as they arrive.
+type EventReordering struct {
+	// Window is how long an event is held waiting for the events before it.
+	// Optional: if zero, events are sent in the order they arrive.
+	Window time.Duration
+	// MaxHeld bounds the number of events held by a stream: past it, the
+	// event held the longest is sent without waiting for its window.
+	// Optional: defaults to 64.
+	MaxHeld int
+}
+
+// reorder returns the events of the channel reordered, or the channel
+// itself if reordering is off. The returned channel is closed when the
+// events channel is closed or the context is done.
+func (r EventReordering) reorder(ctx context.Context, events <-chan session.SessionEvent) <-chan session.SessionEvent {
+	if r.Window <= 0 {
+		return events
+	}
+	buf := &reorderBuffer{window: r.Window, maxHeld: r.MaxHeld, sessions: make(map[string]*heldEvents)}
+	if buf.maxHeld <= 0 {
+		buf.maxHeld = defaultReorderMaxHeld
+	}
+	out := make(chan session.SessionEvent)
+	go func() {
+		defer close(out)
+		for {
+			for _, event := range buf.ready(time.Now()) {
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			var timeout <-chan time.Time
+			if deadline, ok := buf.nextDeadline(); ok {
+				timeout = time.After(time.Until(deadline))
+			}
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				buf.add(event, time.Now())
+			case <-timeout:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// reorderBuffer holds the events of a stream until they are ready to send.
+type reorderBuffer struct {
+	window  time.Duration
+	maxHeld int
+	// sessions holds the state of every session of the stream, by ID.
+	sessions map[string]*heldEvents
+	// order lists the sessions with held events, in the order they started
+	// holding them, so that sessions ready together are sent in a stable
+	// order.
+	order []string
+	// held is the number of events held across sessions.
+	held int
+	// pass lists the events to send without holding them.
+	pass []session.SessionEvent
+}
+
+// heldEvents is the state of a session of a stream.
+type heldEvents struct {
+	// sent is the sequence number of the last event sent.
+	sent int64
+	// events are the held events, sorted by sequence number.
+	events []heldEvent
+}
+
+type heldEvent struct {
+	event    session.SessionEvent
+	deadline time.Time
+}
+
+// add holds the event, or lets it pass if it can't be reordered.
+func (b *reorderBuffer) add(event session.SessionEvent, now time.Time) {
+	seq := event.Event.Sequence
+	state := b.sessions[event.SessionID]
+	if state == nil {
+		state = &heldEvents{}
+		b.sessions[event.SessionID] = state
+	}
+	if seq == 0 || seq <= state.sent {
+		b.pass = append(b.pass, event)
+		return
+	}
+	if len(state.events) == 0 {
+		b.order = append(b.order, event.SessionID)
+	}
+	i, _ := slices.BinarySearchFunc(state.events, seq, func(held heldEvent, seq int64) int {
+		return cmp.Compare(held.event.Event.Sequence, seq)
+	})
+	state.events = slices.Insert(state.events, i, heldEvent{event: event, deadline: now.Add(b.window)})
+	b.held++
+}
+
+// ready removes the events ready to send from the buffer and returns them,
+// in the order to send them.
+func (b *reorderBuffer) ready(now time.Time) []session.SessionEvent {
+	ready := b.pass
+	b.pass = nil
+	for b.held > b.maxHeld {
+		state, i := b.oldest()
+		ready = b.release(ready, state, i+1)
+	}
+	for _, sessionID := range b.order {
+		state := b.sessions[sessionID]
+		// The events past their window are sent along with the ones held
+		// before them.
+		n := 0
+		for i, held := range state.events {
+			if !held.deadline.After(now) {
+				n = i + 1
+			}
+		}
+		ready = b.release(ready, state, n)
+	}
+	b.order = slices.DeleteFunc(b.order, func(sessionID string) bool {
+		return len(b.sessions[sessionID].events) == 0
+	})
+	return ready
+}
+
+// release appends the first n held events of the session to ready, then the
+// held events following the last sent one without a gap.
+func (b *reorderBuffer) release(ready []session.SessionEvent, state *heldEvents, n int) []session.SessionEvent {
+	for len(state.events) > 0 && (n > 0 || state.events[0].event.Event.Sequence == state.sent+1) {
+		event := state.events[0].event
+		ready = append(ready, event)
+		state.sent = event.Event.Sequence
+		state.events = state.events[1:]
+		b.held--
+		n--
+	}
+	return ready
+}
+
+// oldest returns the session holding the event with the earliest deadline,
+// and the index of the event.
+func (b *reorderBuffer) oldest() (*heldEvents, int) {
+	var oldest *heldEvents
+	index := 0
+	for _, sessionID := range b.order {
+		state := b.sessions[sessionID]
+		for i, held := range state.events {
+			if oldest == nil || held.deadline.Before(oldest.events[index].deadline) {
+				oldest, index = state, i
+			}
+		}
+	}
+	return oldest, index
+}
+
+// nextDeadline returns the earliest deadline of the held events.
+func (b *reorderBuffer) nextDeadline() (time.Time, bool) {
+	if b.held == 0 {
+		return time.Time{}, false
+	}
+	state, i := b.oldest()
+	return state.events[i].deadline, true
+}
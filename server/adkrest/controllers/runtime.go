@@ -17,7 +17,9 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
 	"net/http"
 	"time"
 
@@ -34,19 +36,79 @@ type RuntimeAPIController struct {
 	sessionService  session.Service
 	artifactService artifact.Service
 	agentLoader     agent.Loader
+	streams         *StreamCounter
+	protectSystem   bool
+	denial          AccessDenial
+	sessions        *SessionsAPIController
+	readOnly        *ReadOnlyMode
+}
+
+// RuntimeAPIConfig contains the settings of the Runtime API controller.
+type RuntimeAPIConfig struct {
+	SessionService  session.Service
+	AgentLoader     agent.Loader
+	ArtifactService artifact.Service
+	// SSEWriteTimeout is the write timeout of the SSE responses.
+	SSEWriteTimeout time.Duration
+	// Streams enforces the stream limits on the SSE runs. Optional: if nil,
+	// streams are not limited.
+	Streams *StreamCounter
+	// ProtectSystemState fails the runs whose agents write system state
+	// keys, see [runner.Config.ProtectSystemState].
+	ProtectSystemState bool
+	// AccessDenial is how runs for another user than the authenticated
+	// one are answered.
+	AccessDenial AccessDenial
+	// Sessions checks and audits the sessions the runs create with an
+	// initial state, like the sessions it creates. Optional: defaults to a
+	// controller of SessionService with the default config.
+	Sessions *SessionsAPIController
+	// ReadOnly rejects the runs with 503 while it is enabled, since they
+	// append events. Optional: if nil, runs are always accepted.
+	ReadOnly *ReadOnlyMode
 }
 
 // NewRuntimeAPIController creates the controller for the Runtime API.
 func NewRuntimeAPIController(sessionService session.Service, agentLoader agent.Loader, artifactService artifact.Service, sseTimeout time.Duration) *RuntimeAPIController {
-	return &RuntimeAPIController{sessionService: sessionService, agentLoader: agentLoader, artifactService: artifactService, sseTimeout: sseTimeout}
+	return NewRuntimeAPIControllerWithConfig(RuntimeAPIConfig{
+		SessionService:  sessionService,
+		AgentLoader:     agentLoader,
+		ArtifactService: artifactService,
+		SSEWriteTimeout: sseTimeout,
+	})
+}
+
+// NewRuntimeAPIControllerWithConfig creates the controller for the Runtime
+// API using the given config.
+func NewRuntimeAPIControllerWithConfig(config RuntimeAPIConfig) *RuntimeAPIController {
+	if config.Sessions == nil {
+		config.Sessions = NewSessionsAPIController(config.SessionService)
+	}
+	return &RuntimeAPIController{
+		sessionService:  config.SessionService,
+		agentLoader:     config.AgentLoader,
+		artifactService: config.ArtifactService,
+		sseTimeout:      config.SSEWriteTimeout,
+		streams:         config.Streams,
+		protectSystem:   config.ProtectSystemState,
+		denial:          config.AccessDenial,
+		sessions:        config.Sessions,
+		readOnly:        config.ReadOnly,
+	}
 }
 
 // RunAgent executes a non-streaming agent run for a given session and message.
 func (c *RuntimeAPIController) RunHandler(rw http.ResponseWriter, req *http.Request) error {
+	if err := c.readOnly.checkWrite(); err != nil {
+		return err
+	}
 	runAgentRequest, err := decodeRequestBody(req)
 	if err != nil {
 		return err
 	}
+	if err := c.authorizeUser(req, &runAgentRequest.UserId); err != nil {
+		return err
+	}
 	sessionEvents, err := c.runAgent(req.Context(), runAgentRequest)
 	if err != nil {
 		return err
@@ -84,7 +146,11 @@ func (c *RuntimeAPIController) runAgent(ctx context.Context, runAgentRequest mod
 }
 
 // RunSSEHandler executes an agent run and streams the resulting events using Server-Sent Events (SSE).
+// Runs past the stream limits are rejected with 503 before the agent runs.
 func (c *RuntimeAPIController) RunSSEHandler(rw http.ResponseWriter, req *http.Request) error {
+	if err := c.readOnly.checkWrite(); err != nil {
+		return err
+	}
 	rw.Header().Set("Content-Type", "text/event-stream")
 	rw.Header().Set("Cache-Control", "no-cache")
 	rw.Header().Set("Connection", "keep-alive")
@@ -101,6 +167,9 @@ func (c *RuntimeAPIController) RunSSEHandler(rw http.ResponseWriter, req *http.R
 	if err != nil {
 		return err
 	}
+	if err := c.authorizeUser(req, &runAgentRequest.UserId); err != nil {
+		return err
+	}
 
 	err = c.validateSessionExists(req.Context(), runAgentRequest.AppName, runAgentRequest.UserId, runAgentRequest.SessionId)
 	if err != nil {
@@ -112,9 +181,107 @@ func (c *RuntimeAPIController) RunSSEHandler(rw http.ResponseWriter, req *http.R
 		return err
 	}
 
+	release, ok := c.streams.acquire(rw, runAgentRequest.UserId)
+	if !ok {
+		return nil
+	}
+	defer release()
 	resp := r.Run(req.Context(), runAgentRequest.UserId, runAgentRequest.SessionId, &runAgentRequest.NewMessage, *rCfg)
 
 	rw.WriteHeader(http.StatusOK)
+	return streamEvents(rc, rw, resp)
+}
+
+// RunSessionSSEHandler creates the session of the run if it doesn't exist,
+// or reuses it, then executes the agent run and streams the resulting
+// events like RunSSEHandler, all in one response. The session is sent first,
+// as an SSE event named "session", so clients learn the ID of a session
+// created with a generated one.
+func (c *RuntimeAPIController) RunSessionSSEHandler(rw http.ResponseWriter, req *http.Request) error {
+	if err := c.readOnly.checkWrite(); err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+
+	rc := http.NewResponseController(rw)
+	err := rc.SetWriteDeadline(time.Now().Add(c.sseTimeout))
+	if err != nil {
+		return newStatusError(fmt.Errorf("failed to set write deadline: %w", err), http.StatusInternalServerError)
+	}
+
+	runSessionRequest, err := decodeRunSessionRequest(req)
+	if err != nil {
+		return err
+	}
+	if err := c.authorizeUser(req, &runSessionRequest.UserId); err != nil {
+		return err
+	}
+
+	r, rCfg, err := c.getRunner(runSessionRequest.RunAgentRequest)
+	if err != nil {
+		return err
+	}
+
+	release, ok := c.streams.acquire(rw, runSessionRequest.UserId)
+	if !ok {
+		return nil
+	}
+	defer release()
+
+	curSession, err := c.getOrCreateSession(req, runSessionRequest)
+	if err != nil {
+		return err
+	}
+	sessionModel, err := models.FromSession(curSession)
+	if err != nil {
+		return newStatusError(fmt.Errorf("failed to convert session: %w", err), http.StatusInternalServerError)
+	}
+	resp := r.Run(req.Context(), runSessionRequest.UserId, curSession.ID(), &runSessionRequest.NewMessage, *rCfg)
+
+	rw.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(rw, "event: session\n"); err != nil {
+		return newStatusError(fmt.Errorf("failed to write response: %w", err), http.StatusInternalServerError)
+	}
+	if err := flashData(rc, rw, sessionModel); err != nil {
+		return err
+	}
+	return streamEvents(rc, rw, resp)
+}
+
+// getOrCreateSession returns the session of the request, creating it with
+// the initial state of the request if it doesn't exist or if the request
+// has no session ID. The session is created like the sessions API creates
+// sessions, see [SessionsAPIController.CreateSessionHandler].
+func (c *RuntimeAPIController) getOrCreateSession(httpReq *http.Request, req models.RunSessionRequest) (session.Session, error) {
+	if req.SessionId != "" {
+		resp, err := c.sessionService.Get(httpReq.Context(), &session.GetRequest{
+			AppName:   req.AppName,
+			UserID:    req.UserId,
+			SessionID: req.SessionId,
+		})
+		if err == nil {
+			return resp.Session, nil
+		}
+		if !errors.Is(err, session.ErrSessionNotFound) {
+			return nil, newStatusError(fmt.Errorf("failed to get session: %w", err), statusFromError(err))
+		}
+	}
+	created, err := c.sessions.createRunSession(httpReq, models.SessionID{
+		AppName: req.AppName,
+		UserID:  req.UserId,
+		ID:      req.SessionId,
+	}, req.State)
+	if err != nil {
+		return nil, newStatusError(fmt.Errorf("failed to create session: %w", err), statusFromError(err))
+	}
+	return created, nil
+}
+
+// streamEvents writes the events of the run as they are produced. Errors of
+// the run are written in the stream, they don't end it.
+func streamEvents(rc *http.ResponseController, rw http.ResponseWriter, resp iter.Seq2[*session.Event, error]) error {
 	for event, err := range resp {
 		if err != nil {
 			_, err := fmt.Fprintf(rw, "Error while running agent: %v\n", err)
@@ -137,11 +304,15 @@ func (c *RuntimeAPIController) RunSSEHandler(rw http.ResponseWriter, req *http.R
 }
 
 func flashEvent(rc *http.ResponseController, rw http.ResponseWriter, event session.Event) error {
+	return flashData(rc, rw, models.FromSessionEvent(event))
+}
+
+func flashData(rc *http.ResponseController, rw http.ResponseWriter, data any) error {
 	_, err := fmt.Fprintf(rw, "data: ")
 	if err != nil {
 		return newStatusError(fmt.Errorf("failed to write response: %w", err), http.StatusInternalServerError)
 	}
-	err = json.NewEncoder(rw).Encode(models.FromSessionEvent(event))
+	err = json.NewEncoder(rw).Encode(data)
 	if err != nil {
 		return newStatusError(fmt.Errorf("failed to encode response: %w", err), http.StatusInternalServerError)
 	}
@@ -156,6 +327,24 @@ func flashEvent(rc *http.ResponseController, rw http.ResponseWriter, event sessi
 	return nil
 }
 
+// authorizeUser scopes the run to the user authenticated by the auth
+// middleware, if any: a run without a user ID runs as that user, and a run
+// for another user is denied like the resources of other users.
+func (c *RuntimeAPIController) authorizeUser(req *http.Request, userID *string) error {
+	principal, ok := authenticatedUser(req.Context())
+	if !ok {
+		return nil
+	}
+	if *userID == "" {
+		*userID = principal
+		return nil
+	}
+	if *userID != principal {
+		return c.denial.error(fmt.Sprintf("userId %q does not match the authenticated user", *userID))
+	}
+	return nil
+}
+
 func (c *RuntimeAPIController) validateSessionExists(ctx context.Context, appName, userID, sessionID string) error {
 	_, err := c.sessionService.Get(ctx, &session.GetRequest{
 		AppName:   appName,
@@ -175,10 +364,11 @@ func (c *RuntimeAPIController) getRunner(req models.RunAgentRequest) (*runner.Ru
 	}
 
 	r, err := runner.New(runner.Config{
-		AppName:         req.AppName,
-		Agent:           curAgent,
-		SessionService:  c.sessionService,
-		ArtifactService: c.artifactService,
+		AppName:            req.AppName,
+		Agent:              curAgent,
+		SessionService:     c.sessionService,
+		ArtifactService:    c.artifactService,
+		ProtectSystemState: c.protectSystem,
 	},
 	)
 	if err != nil {
@@ -206,3 +396,14 @@ func decodeRequestBody(req *http.Request) (decodedReq models.RunAgentRequest, er
 	}
 	return runAgentRequest, nil
 }
+
+func decodeRunSessionRequest(req *http.Request) (models.RunSessionRequest, error) {
+	defer req.Body.Close()
+	var runSessionRequest models.RunSessionRequest
+	d := json.NewDecoder(req.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&runSessionRequest); err != nil {
+		return runSessionRequest, newStatusError(fmt.Errorf("failed to decode request: %w", err), http.StatusBadRequest)
+	}
+	return runSessionRequest, nil
+}
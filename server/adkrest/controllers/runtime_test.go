@@ -0,0 +1,338 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/artifact"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// sseMessage is a message of an SSE stream.
+type sseMessage struct {
+	event, data string
+}
+
+// readSSE returns the messages of an SSE stream.
+func readSSE(t *testing.T, resp *http.Response) []sseMessage {
+	t.Helper()
+	var messages []sseMessage
+	var cur sseMessage
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if cur.data != "" {
+				messages = append(messages, cur)
+			}
+			cur = sseMessage{}
+		case strings.HasPrefix(line, "event: "):
+			cur.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			cur.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("reading the stream failed: %v", err)
+	}
+	return messages
+}
+
+// echoAgent replies to every message with its text, prefixed by "echo: ".
+func echoAgent(t *testing.T) agent.Agent {
+	t.Helper()
+	a, err := agent.New(agent.Config{
+		Name: "testApp",
+		Run: func(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
+			return func(yield func(*session.Event, error) bool) {
+				event := session.NewEvent(ctx.InvocationID())
+				event.Author = "testApp"
+				event.LLMResponse = model.LLMResponse{
+					Content: genai.NewContentFromText("echo: "+ctx.UserContent().Parts[0].Text, genai.RoleModel),
+				}
+				yield(event, nil)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("agent.New() failed: %v", err)
+	}
+	return a
+}
+
+func TestRunSessionSSE(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is the state of the session created before the run, if
+		// not nil.
+		existing  map[string]any
+		sessionID string
+		state     map[string]any
+		wantState map[string]any
+	}{
+		{
+			name:      "creates session with generated ID",
+			state:     map[string]any{"topic": "weather"},
+			wantState: map[string]any{"topic": "weather"},
+		},
+		{
+			name:      "creates session with given ID",
+			sessionID: "chat1",
+			state:     map[string]any{"topic": "weather"},
+			wantState: map[string]any{"topic": "weather"},
+		},
+		{
+			name:      "reuses existing session",
+			existing:  map[string]any{"topic": "news"},
+			sessionID: "chat1",
+			state:     map[string]any{"topic": "weather"},
+			wantState: map[string]any{"topic": "news"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			sessionService := session.InMemoryService()
+			if tt.existing != nil {
+				_, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: tt.sessionID, State: tt.existing})
+				if err != nil {
+					t.Fatalf("Create() failed: %v", err)
+				}
+			}
+			controller := controllers.NewRuntimeAPIController(sessionService, agent.NewSingleLoader(echoAgent(t)), artifact.InMemoryService(), time.Minute)
+			server := httptest.NewServer(controllers.NewErrorHandler(controller.RunSessionSSEHandler))
+			defer server.Close()
+
+			body, err := json.Marshal(models.RunSessionRequest{
+				RunAgentRequest: models.RunAgentRequest{
+					AppName:    "testApp",
+					UserId:     "testUser",
+					SessionId:  tt.sessionID,
+					NewMessage: *genai.NewContentFromText("hello", genai.RoleUser),
+				},
+				State: tt.state,
+			})
+			if err != nil {
+				t.Fatalf("json.Marshal() failed: %v", err)
+			}
+			resp, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("POST failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("Content-Type = %q, want text/event-stream", got)
+			}
+
+			messages := readSSE(t, resp)
+			if len(messages) != 2 {
+				t.Fatalf("got %d messages, want the session and one event: %v", len(messages), messages)
+			}
+			if messages[0].event != "session" {
+				t.Fatalf("first message is %q, want session", messages[0].event)
+			}
+			var gotSession models.Session
+			if err := json.Unmarshal([]byte(messages[0].data), &gotSession); err != nil {
+				t.Fatalf("decoding the session failed: %v", err)
+			}
+			if gotSession.ID == "" || (tt.sessionID != "" && gotSession.ID != tt.sessionID) {
+				t.Errorf("session ID = %q, want %q", gotSession.ID, tt.sessionID)
+			}
+			if diff := cmp.Diff(tt.wantState, gotSession.State); diff != "" {
+				t.Errorf("session state mismatch (-want +got):\n%s", diff)
+			}
+			var gotEvent models.Event
+			if err := json.Unmarshal([]byte(messages[1].data), &gotEvent); err != nil {
+				t.Fatalf("decoding the event failed: %v", err)
+			}
+			if messages[1].event != "" || gotEvent.Content == nil || gotEvent.Content.Parts[0].Text != "echo: hello" {
+				t.Errorf("streamed event = %+v, want the reply of the agent", gotEvent)
+			}
+
+			stored, err := sessionService.Get(ctx, &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: gotSession.ID})
+			if err != nil {
+				t.Fatalf("Get() failed: %v", err)
+			}
+			var got []string
+			for event := range stored.Session.Events().All() {
+				got = append(got, event.Author+": "+event.Content.Parts[0].Text)
+			}
+			want := []string{"user: hello", "testApp: echo: hello"}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("stored events mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunSessionSSE_CreationChecks(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      map[string]any
+		wantStatus int
+	}{
+		{
+			name:       "accepts allowed keys",
+			state:      map[string]any{"topic": "weather"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "rejects reserved keys",
+			state:      map[string]any{"$adk_topic": "weather"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "rejects system keys",
+			state:      map[string]any{session.KeyPrefixSystem + "topic": "weather"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "rejects keys out of the allowlist",
+			state:      map[string]any{"mood": "sunny"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			sessionService := session.InMemoryService()
+			sink := &auditRecorder{}
+			controller := controllers.NewRuntimeAPIControllerWithConfig(controllers.RuntimeAPIConfig{
+				SessionService:  sessionService,
+				AgentLoader:     agent.NewSingleLoader(echoAgent(t)),
+				ArtifactService: artifact.InMemoryService(),
+				SSEWriteTimeout: time.Minute,
+				Sessions: controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+					ProtectSystemState: true,
+					AllowedStateKeys:   controllers.StateKeyAllowlist{"testApp": {"topic"}},
+					Audit:              &controllers.AuditLog{Sink: sink},
+				}),
+			})
+			server := httptest.NewServer(controllers.NewErrorHandler(controller.RunSessionSSEHandler))
+			defer server.Close()
+
+			body, err := json.Marshal(models.RunSessionRequest{
+				RunAgentRequest: models.RunAgentRequest{
+					AppName:    "testApp",
+					UserId:     "testUser",
+					NewMessage: *genai.NewContentFromText("hello", genai.RoleUser),
+				},
+				State: tt.state,
+			})
+			if err != nil {
+				t.Fatalf("json.Marshal() failed: %v", err)
+			}
+			resp, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("POST failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			list, err := sessionService.List(ctx, &session.ListRequest{AppName: "testApp", UserID: "testUser"})
+			if err != nil {
+				t.Fatalf("List() failed: %v", err)
+			}
+			wantSessions := 0
+			if tt.wantStatus == http.StatusOK {
+				wantSessions = 1
+			}
+			if len(list.Sessions) != wantSessions {
+				t.Errorf("got %d sessions, want %d", len(list.Sessions), wantSessions)
+			}
+			if len(sink.records) != wantSessions {
+				t.Fatalf("got %d audit records, want %d: %+v", len(sink.records), wantSessions, sink.records)
+			}
+			if wantSessions == 1 && (sink.records[0].Operation != controllers.AuditCreate || sink.records[0].SessionID != list.Sessions[0].ID()) {
+				t.Errorf("audit record = %+v, want the creation of session %q", sink.records[0], list.Sessions[0].ID())
+			}
+		})
+	}
+}
+
+func TestRun_ReadOnly(t *testing.T) {
+	ctx := context.Background()
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "chat1"}); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	readOnly := &controllers.ReadOnlyMode{}
+	controller := controllers.NewRuntimeAPIControllerWithConfig(controllers.RuntimeAPIConfig{
+		SessionService:  sessionService,
+		AgentLoader:     agent.NewSingleLoader(echoAgent(t)),
+		ArtifactService: artifact.InMemoryService(),
+		ReadOnly:        readOnly,
+	})
+	body, err := json.Marshal(models.RunAgentRequest{
+		AppName:    "testApp",
+		UserId:     "testUser",
+		SessionId:  "chat1",
+		NewMessage: *genai.NewContentFromText("hello", genai.RoleUser),
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	run := func() int {
+		rr := httptest.NewRecorder()
+		controllers.NewErrorHandler(controller.RunHandler)(rr, httptest.NewRequest(http.MethodPost, "/run", bytes.NewReader(body)))
+		return rr.Code
+	}
+	storedEvents := func() int {
+		stored, err := sessionService.Get(ctx, &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "chat1"})
+		if err != nil {
+			t.Fatalf("Get() failed: %v", err)
+		}
+		return stored.Session.Events().Len()
+	}
+
+	readOnly.SetEnabled(true)
+	if got := run(); got != http.StatusServiceUnavailable {
+		t.Errorf("read-only run status = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+	if got := storedEvents(); got != 0 {
+		t.Errorf("read-only run stored %d events, want none", got)
+	}
+
+	readOnly.SetEnabled(false)
+	if got := run(); got != http.StatusOK {
+		t.Errorf("run status = %d, want %d", got, http.StatusOK)
+	}
+	if got := storedEvents(); got != 2 {
+		t.Errorf("run stored %d events, want 2", got)
+	}
+}
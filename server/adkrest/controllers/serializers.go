@@ -0,0 +1,297 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Serializer encodes the bodies of responses in a media type. Embedders
+// implement it for their own framing or envelopes, and register it with
+// [NewSerializerMiddleware].
+type Serializer interface {
+	// ContentType is the Content-Type of the encoded bodies. Its media type
+	// is matched against the Accept header of requests.
+	ContentType() string
+	// Marshal encodes the body of a response.
+	Marshal(v any) ([]byte, error)
+}
+
+// JSONSerializer returns the serializer of application/json, the default
+// encoding of responses.
+func JSONSerializer() Serializer {
+	return jsonSerializer{}
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) ContentType() string { return "application/json; charset=UTF-8" }
+
+func (jsonSerializer) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	// Encode, unlike Marshal, ends the body with a newline.
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MsgpackSerializer returns the serializer of application/msgpack. Values
+// are encoded as the MessagePack equivalent of their JSON encoding, so the
+// field names are the ones of the JSON responses; maps are encoded with
+// their keys sorted.
+func MsgpackSerializer() Serializer {
+	return msgpackSerializer{}
+}
+
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) ContentType() string { return "application/msgpack" }
+
+func (msgpackSerializer) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return appendMsgpack(nil, value)
+}
+
+// appendMsgpack appends the MessagePack encoding of a value decoded from
+// JSON with UseNumber.
+func appendMsgpack(b []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return appendMsgpackInt(b, i), nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), u), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", v, err)
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+	case string:
+		b = appendMsgpackHeader(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		return append(b, v...), nil
+	case []any:
+		b = appendMsgpackHeader(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, elem := range v {
+			var err error
+			if b, err = appendMsgpack(b, elem); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		b = appendMsgpackHeader(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			var err error
+			if b, err = appendMsgpack(b, key); err != nil {
+				return nil, err
+			}
+			if b, err = appendMsgpack(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON value of type %T", value)
+	}
+}
+
+// appendMsgpackHeader appends the header of a string, array or map of n
+// elements: the fix format below fixMax, then the 8 bit format if there is
+// one, the 16 and the 32 bit formats.
+func appendMsgpackHeader(b []byte, n int, fix byte, fixMax int, format8, format16, format32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case format8 != 0 && n <= math.MaxUint8:
+		return append(b, format8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, format16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, format32), uint32(n))
+	}
+}
+
+// appendMsgpackInt appends the shortest MessagePack encoding of i.
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(i)))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+// DefaultSerializers returns the serializers of responses unless the
+// configuration overrides them: JSON, preferred, and MessagePack.
+func DefaultSerializers() []Serializer {
+	return []Serializer{JSONSerializer(), MsgpackSerializer()}
+}
+
+// serializingWriter is a response writer carrying the serializer
+// negotiated for the response.
+type serializingWriter struct {
+	http.ResponseWriter
+	serializer Serializer
+}
+
+// Unwrap lets [http.ResponseController] reach the wrapped writer.
+func (w *serializingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseSerializer returns the serializer negotiated for the response
+// written by rw, or JSON if none was.
+func responseSerializer(rw http.ResponseWriter) Serializer {
+	for {
+		if w, ok := rw.(*serializingWriter); ok {
+			return w.serializer
+		}
+		wrapper, ok := rw.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return JSONSerializer()
+		}
+		rw = wrapper.Unwrap()
+	}
+}
+
+// isJSON reports whether the serializer is the built-in JSON one.
+func isJSON(serializer Serializer) bool {
+	_, ok := serializer.(jsonSerializer)
+	return ok
+}
+
+// NewSerializerMiddleware returns a middleware selecting the serializer of
+// the responses, see [EncodeJSONResponse], by content negotiation: the
+// serializer whose media type the Accept header of the request prefers,
+// the first of serializers breaking ties. Requests without an Accept header,
+// or accepting none of the serializers, get the first one rather than 406,
+// so that clients with a sloppy Accept header keep getting JSON. Errors are
+// still answered in plain text. Optional: serializers defaults to
+// [DefaultSerializers].
+func NewSerializerMiddleware(serializers []Serializer) mux.MiddlewareFunc {
+	if len(serializers) == 0 {
+		serializers = DefaultSerializers()
+	}
+	mediaTypes := make([]string, len(serializers))
+	for i, serializer := range serializers {
+		mediaType, _, err := mime.ParseMediaType(serializer.ContentType())
+		if err != nil {
+			mediaType = strings.ToLower(serializer.ContentType())
+		}
+		mediaTypes[i] = mediaType
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if len(serializers) > 1 {
+				rw.Header().Add("Vary", "Accept")
+			}
+			serializer := serializers[negotiate(req.Header.Values("Accept"), mediaTypes)]
+			next.ServeHTTP(&serializingWriter{ResponseWriter: rw, serializer: serializer}, req)
+		})
+	}
+}
+
+// negotiate returns the index of the media type the Accept header values
+// prefer, with the highest quality, the earliest winning ties. It returns 0
+// when none is accepted.
+func negotiate(accept []string, mediaTypes []string) int {
+	best, bestQuality := 0, 0.0
+	for i, mediaType := range mediaTypes {
+		if quality := acceptQuality(accept, mediaType); quality > bestQuality {
+			best, bestQuality = i, quality
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality the Accept header values give to the
+// media type, from its most specific matching range, or 0 if no range
+// matches it.
+func acceptQuality(accept []string, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			var s int
+			switch {
+			case mediaRange == mediaType:
+				s = 2
+			case mediaRange == "*/*":
+				s = 0
+			case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+				s = 1
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+			q := 1.0
+			if qStr, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(qStr, 64); err != nil {
+					continue
+				}
+			}
+			quality, specificity = q, s
+		}
+	}
+	return quality
+}
@@ -0,0 +1,159 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/session"
+)
+
+// framedSerializer prefixes the JSON body with its big endian length.
+type framedSerializer struct{}
+
+func (framedSerializer) ContentType() string { return "application/x-framed-json" }
+
+func (framedSerializer) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(data))), data...), nil
+}
+
+func TestSerializerMiddleware(t *testing.T) {
+	middleware := controllers.NewSerializerMiddleware(append(controllers.DefaultSerializers(), framedSerializer{}))
+	handler := middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		controllers.EncodeJSONResponse(map[string]any{"k": "v"}, http.StatusCreated, rw)
+	}))
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "no accept header",
+			wantContentType: "application/json; charset=UTF-8",
+			wantBody:        "{\"k\":\"v\"}\n",
+		},
+		{
+			name:            "custom serializer",
+			accept:          "application/x-framed-json",
+			wantContentType: "application/x-framed-json",
+			wantBody:        "\x00\x00\x00\x09{\"k\":\"v\"}",
+		},
+		{
+			name:            "msgpack",
+			accept:          "application/msgpack",
+			wantContentType: "application/msgpack",
+			wantBody:        "\x81\xa1k\xa1v",
+		},
+		{
+			name:            "quality preference",
+			accept:          "application/x-framed-json;q=0.5, application/json",
+			wantContentType: "application/json; charset=UTF-8",
+			wantBody:        "{\"k\":\"v\"}\n",
+		},
+		{
+			name:            "specific range over wildcard",
+			accept:          "*/*;q=0.1, application/x-framed-json",
+			wantContentType: "application/x-framed-json",
+			wantBody:        "\x00\x00\x00\x09{\"k\":\"v\"}",
+		},
+		{
+			name:            "nothing acceptable falls back to the first",
+			accept:          "text/html",
+			wantContentType: "application/json; charset=UTF-8",
+			wantBody:        "{\"k\":\"v\"}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated {
+				t.Errorf("status = %v, want %v", rr.Code, http.StatusCreated)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if got := rr.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("Vary = %q, want %q", got, "Accept")
+			}
+			if got := rr.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSerializerMiddleware_GetSession(t *testing.T) {
+	service := session.InMemoryService()
+	if _, err := service.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "s1", State: map[string]any{"k": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(service)
+	middleware := controllers.NewSerializerMiddleware([]controllers.Serializer{controllers.JSONSerializer(), framedSerializer{}})
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "s1"}
+
+	serve := func(t *testing.T, method string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		t.Helper()
+		req := mux.SetURLVars(httptest.NewRequest(method, "/apps/testApp/users/testUser/sessions/s1", nil), vars)
+		req.Header.Set("Accept", "application/x-framed-json")
+		rr := httptest.NewRecorder()
+		middleware(handler).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s status = %v, want %v, body: %s", method, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/x-framed-json" {
+			t.Errorf("%s Content-Type = %q, want the custom serializer", method, got)
+		}
+		return rr
+	}
+
+	body := serve(t, http.MethodGet, apiController.GetSessionHandler).Body.Bytes()
+	if len(body) < 4 || int(binary.BigEndian.Uint32(body)) != len(body)-4 {
+		t.Fatalf("body %q is not framed", body)
+	}
+	var got struct {
+		ID    string         `json:"id"`
+		State map[string]any `json:"state"`
+	}
+	if err := json.Unmarshal(body[4:], &got); err != nil {
+		t.Fatalf("decode framed session: %v", err)
+	}
+	if got.ID != "s1" || got.State["k"] != "v" {
+		t.Errorf("framed session = %+v, want s1 with its state", got)
+	}
+
+	head := serve(t, http.MethodHead, apiController.HeadSessionHandler)
+	if got, want := head.Header().Get("Content-Length"), strconv.Itoa(len(body)); got != want {
+		t.Errorf("HEAD Content-Length = %s, want the length of the framed body %s", got, want)
+	}
+}
@@ -15,14 +15,27 @@
 package controllers
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"google.golang.org/adk/artifact"
 	"google.golang.org/adk/server/adkrest/internal/models"
 	"google.golang.org/adk/session"
 )
@@ -31,60 +44,612 @@ import (
 
 // SessionsAPIController is the controller for the Sessions API.
 type SessionsAPIController struct {
-	service session.Service
+	service    session.Service
+	config     SessionsAPIConfig
+	events     eventValidator
+	pageTokens *models.PageTokenSigner
 }
 
+// UnknownDirectivePolicy is what the server does with a state delta
+// directive whose name it doesn't know, for instance one introduced by a
+// newer version of the clients.
+type UnknownDirectivePolicy = models.UnknownDirectivePolicy
+
+// Unknown directive policies.
+const (
+	// UnknownDirectiveError rejects the delta.
+	UnknownDirectiveError = models.UnknownDirectiveError
+	// UnknownDirectiveIgnore drops the key from the delta.
+	UnknownDirectiveIgnore = models.UnknownDirectiveIgnore
+	// UnknownDirectiveSetRaw sets the key to the directive object as is.
+	UnknownDirectiveSetRaw = models.UnknownDirectiveSetRaw
+)
+
+// SessionsAPIConfig contains optional settings of the Sessions API.
+// The zero value is a valid config.
+type SessionsAPIConfig struct {
+	// ReadOnly makes the write handlers fail with 503 while it is enabled.
+	// Touches are still accepted: they only extend the expiry of sessions,
+	// which would otherwise expire while they are read, see
+	// [SessionsAPIController.TouchSessionHandler]. Optional: if nil,
+	// writes are always accepted.
+	ReadOnly *ReadOnlyMode
+	// StrictDecoding rejects request bodies with unknown fields with 400,
+	// instead of ignoring the fields.
+	StrictDecoding bool
+	// RejectDuplicateKeys rejects request bodies with an object holding
+	// the same key twice with 400, instead of keeping the last value, so
+	// that two changes of a state delta can't silently target one key.
+	RejectDuplicateKeys bool
+	// DirectiveAliases maps deprecated state delta directive names to the
+	// built-in directive they stand for, e.g. {"move": "rename"}. Every use
+	// of an alias is logged as deprecated. Built-in names can't be aliased.
+	DirectiveAliases map[string]string
+	// DeprecationHeaders also reports the use of deprecated directive
+	// aliases to the client, in Warning response headers.
+	DeprecationHeaders bool
+	// UnknownDirectives is applied to the state delta directives with an
+	// unknown name. Optional: defaults to rejecting the delta with 400.
+	UnknownDirectives UnknownDirectivePolicy
+	// AllowedAuthors restricts the authors of the events submitted when
+	// creating a session or appending an event. Optional: if nil, any author
+	// is accepted.
+	AllowedAuthors AuthorAllowlist
+	// StateKeys enforces naming rules on the state keys written by clients.
+	// Optional: if nil, only the reserved $adk_ namespace is rejected.
+	StateKeys *StateKeyPolicy
+	// AllowedStateKeys restricts the top-level state keys clients write
+	// when creating a session or patching its state, checked after the
+	// StateKeys normalization. Optional: if nil, any key is accepted.
+	AllowedStateKeys StateKeyAllowlist
+	// StateCoercion coerces the values clients send as strings for the
+	// typed state keys of an app, in the states and state deltas of the
+	// session requests. Optional: if nil, values are kept as sent.
+	StateCoercion StateCoercion
+	// EventSchemas validates the events submitted when creating a session
+	// or appending an event. Optional: if nil, any event is accepted.
+	EventSchemas EventSchemas
+	// Templates are the session templates clients can create sessions
+	// from. Optional: if nil, naming a template fails with 400.
+	Templates SessionTemplates
+	// EventEnrichment records server context on the events appended
+	// through the API. Optional: if nil, events are stored as submitted.
+	EventEnrichment *EventEnrichment
+	// Audit writes an audit record of every mutation of a session, before
+	// it is applied. Optional: if nil, mutations aren't audited.
+	Audit *AuditLog
+	// Artifacts stores the files uploaded as event attachments. Optional: if
+	// nil, attachment uploads fail with 501.
+	Artifacts artifact.Service
+	// MaxAttachmentSize is the size limit in bytes of an uploaded
+	// attachment. Optional: defaults to 32 MiB.
+	MaxAttachmentSize int64
+	// Streams enforces the stream limits on the event streams the
+	// controller serves. Optional: if nil, streams are not limited.
+	Streams *StreamCounter
+	// ProjectableEventFields are the JSON fields of events clients may keep
+	// or leave out with the fields and excludeFields query parameters of
+	// the event listings. Optional: if nil, any field of [models.Event] may
+	// be projected.
+	ProjectableEventFields []string
+	// WatchReordering holds the events of the user event streams briefly,
+	// to send the events of a session delivered out of order in sequence
+	// order. Optional: by default events are sent as they arrive.
+	WatchReordering EventReordering
+	// ReadYourWrites returns the version of the sessions written by state
+	// patches and event appends, and makes the reads of sessions, of their
+	// state and of their events requiring a version wait for it.
+	// Optional: by default reads are served as the service returns them.
+	ReadYourWrites ReadYourWrites
+	// MaxStateDepth is the nesting depth past which the states and state
+	// deltas submitted by clients, including the ones of their events, are
+	// rejected with 400, see [models.CheckStateDepth]. Optional: defaults
+	// to [DefaultMaxStateDepth].
+	MaxStateDepth int
+	// ProtectSystemState rejects with 403 the states, state deltas and
+	// events clients submit which write system state keys, see
+	// [session.KeyPrefixSystem], including through directives. The admin
+	// API writes them.
+	ProtectSystemState bool
+	// SkipNoopStateDeltas makes the state patches which leave the state as
+	// it is, like empty deltas or values equal to the current ones, append
+	// nothing: the session, its update time and its ETag stay unchanged.
+	// By default every patch appends an event, bumping the update time.
+	SkipNoopStateDeltas bool
+	// MaxStateKeys bounds the number of keys of a session state: state
+	// patches, including the deltas of the appends with state and of the
+	// transactions, which would grow it past the limit are rejected with
+	// 422, whatever their size in bytes. Patches removing keys from a state
+	// already past the limit are accepted. The state is read before the
+	// write, so concurrent patches may together get past the limit; the
+	// session service enforces it atomically with its own MaxStateKeys,
+	// see [session.StateKeyLimits], whose errors are reported with 422 too.
+	// Optional: if zero, the number of keys is not limited.
+	MaxStateKeys int
+	// CollapsePartials leaves the partial events superseded by a final one
+	// out of the sessions and events returned, see
+	// [session.CollapsePartials]. Stored events are untouched. Clients
+	// override it with the collapsePartials query parameter.
+	CollapsePartials bool
+	// PageTokenSecret is the key signing the page tokens, which servers
+	// sharing their clients must have in common. Optional: if empty, a
+	// random key is generated and page tokens are invalidated by a
+	// restart.
+	PageTokenSecret []byte
+	// PageSizes are the default and maximum page sizes of the paginated
+	// lists of sessions and events. Optional: default to [DefaultPageSize]
+	// and [DefaultMaxPageSize].
+	PageSizes PageSizes
+	// Traces returns the hex-encoded trace and span IDs of the span which
+	// produced an event, for the log records of
+	// [SessionsAPIController.ExportSessionLogsHandler]. Optional: if nil,
+	// records have no trace context.
+	Traces func(eventID string) (traceID, spanID string)
+	// ArchiveKey is the HMAC key signing the sessions exported with the
+	// sign query parameter, and verifying the signatures of the imported
+	// ones. Optional: if empty, archives can only carry a checksum.
+	ArchiveKey []byte
+	// RequireSignedImports rejects with 422 the imports of sessions which
+	// aren't signed with ArchiveKey, so that archives can't be tampered
+	// with by stripping their seal.
+	RequireSignedImports bool
+}
+
+// DefaultMaxStateDepth is the default SessionsAPIConfig.MaxStateDepth.
+const DefaultMaxStateDepth = 64
+
 // NewSessionsAPIController creates a new SessionsAPIController.
 func NewSessionsAPIController(service session.Service) *SessionsAPIController {
-	return &SessionsAPIController{service: service}
+	return NewSessionsAPIControllerWithConfig(service, SessionsAPIConfig{})
+}
+
+// NewSessionsAPIControllerWithConfig creates a new SessionsAPIController
+// using the given config.
+func NewSessionsAPIControllerWithConfig(service session.Service, config SessionsAPIConfig) *SessionsAPIController {
+	return &SessionsAPIController{service: service, config: config, events: config.EventSchemas.resolve(), pageTokens: models.NewPageTokenSigner(config.PageTokenSecret)}
+}
+
+// checkStateDepth rejects with 400 the states and state deltas nested
+// deeper than the configured depth.
+func (c *SessionsAPIController) checkStateDepth(states ...map[string]any) error {
+	maxDepth := c.config.MaxStateDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxStateDepth
+	}
+	for _, state := range states {
+		if err := models.CheckStateDepth(state, maxDepth); err != nil {
+			return newStatusError(err, http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// checkEventsStateDepth is checkStateDepth for the state deltas of the
+// events.
+func (c *SessionsAPIController) checkEventsStateDepth(events ...models.Event) error {
+	for _, event := range events {
+		if err := c.checkStateDepth(event.Actions.StateDelta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareEventDelta normalizes the keys of the state delta of a client
+// event with the state key policy, which rejects the reserved $adk_
+// namespace and the protected system keys, and checks them against the allowlist of the app, like
+// prepareStateDelta does for state patches.
+func (c *SessionsAPIController) prepareEventDelta(appName string, event *models.Event) error {
+	delta, err := c.config.StateKeys.apply(event.Actions.StateDelta, c.config.ProtectSystemState)
+	if err != nil {
+		return err
+	}
+	if err := c.config.AllowedStateKeys.check(appName, delta); err != nil {
+		return err
+	}
+	event.Actions.StateDelta = delta
+	return nil
+}
+
+// checkStateKeyCount returns an error if applying the normalized delta to
+// a copy of the state of the session would grow its number of keys past
+// the MaxStateKeys setting.
+func (c *SessionsAPIController) checkStateKeyCount(storedSession session.Session, delta map[string]any) error {
+	return c.checkStateKeyCountAfter(storedSession, delta, nil)
+}
+
+// checkStateKeyCountAfter is checkStateKeyCount once the app and user keys
+// changed by the earlier deltas of a transaction, held by shared with nil
+// values for the deleted keys, are applied to the state. The changes of the
+// delta to these keys are added to shared.
+func (c *SessionsAPIController) checkStateKeyCountAfter(storedSession session.Session, delta, shared map[string]any) error {
+	if c.config.MaxStateKeys <= 0 {
+		return nil
+	}
+	before := maps.Collect(storedSession.State().All())
+	for key, value := range shared {
+		if value == nil {
+			delete(before, key)
+		} else {
+			before[key] = value
+		}
+	}
+	after, err := models.PreviewStateDelta(before, delta)
+	if err != nil {
+		return err
+	}
+	if len(after) > c.config.MaxStateKeys && len(after) > len(before) {
+		return newStatusError(fmt.Errorf("state delta would grow the state to %d keys, past the limit of %d", len(after), c.config.MaxStateKeys), http.StatusUnprocessableEntity)
+	}
+	if shared != nil {
+		for key := range before {
+			if _, ok := after[key]; !ok && isSharedStateKey(key) {
+				shared[key] = nil
+			}
+		}
+		for key, value := range after {
+			if isSharedStateKey(key) {
+				shared[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// isSharedStateKey reports whether the state key is shared by the sessions
+// of a user, as an app or user key.
+func isSharedStateKey(key string) bool {
+	return strings.HasPrefix(key, session.KeyPrefixApp) || strings.HasPrefix(key, session.KeyPrefixUser)
+}
+
+// checkStoredStateKeyCount is checkStateKeyCountAfter for the handlers
+// which don't load the session: the session is only loaded if the number
+// of keys is limited.
+func (c *SessionsAPIController) checkStoredStateKeyCount(ctx context.Context, sessionID models.SessionID, delta, shared map[string]any) error {
+	if c.config.MaxStateKeys <= 0 {
+		return nil
+	}
+	getResp, err := c.service.Get(ctx, &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		return err
+	}
+	return c.checkStateKeyCountAfter(getResp.Session, delta, shared)
+}
+
+// decodeRequest decodes the JSON request body into v, rejecting unknown
+// fields in strict decoding mode and duplicate keys when configured.
+func (c *SessionsAPIController) decodeRequest(req *http.Request, v any) error {
+	return c.decodeJSON(req.Body, v)
+}
+
+// decodeJSON decodes the JSON of r into v like decodeRequest.
+func (c *SessionsAPIController) decodeJSON(r io.Reader, v any) error {
+	if c.config.RejectDuplicateKeys {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckDuplicateKeys(data); err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	decoder := json.NewDecoder(r)
+	if c.config.StrictDecoding {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
 }
 
 // CreateSesssionHTTP is a HTTP handler for the create session API.
 func (c *SessionsAPIController) CreateSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
 	params := mux.Vars(req)
 	sessionID, err := models.SessionIDFromHTTPParameters(params)
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := c.events.checkBody(req, sessionID.AppName, createEvents); err != nil {
+		writeError(rw, err)
+		return
+	}
 	createSessionRequest := models.CreateSessionRequest{}
+	var body []byte
 	// No state and no events, fails to decode req.Body failing with "EOF"
 	if req.ContentLength > 0 {
-		err := json.NewDecoder(req.Body).Decode(&createSessionRequest)
+		// The body is kept to verify the seal of an imported archive.
+		body, err = io.ReadAll(req.Body)
 		if err != nil {
+			http.Error(rw, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := c.decodeJSON(bytes.NewReader(body), &createSessionRequest); err != nil {
 			http.Error(rw, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
-	respSession, err := c.createSession(req.Context(), sessionID, createSessionRequest)
+	if createSessionRequest.DedupKey != "" {
+		if sessionID.ID != "" {
+			http.Error(rw, "dedupKey can't be combined with a session ID", http.StatusBadRequest)
+			return
+		}
+		sessionID.ID = models.DedupSessionID(sessionID.AppName, sessionID.UserID, createSessionRequest.DedupKey)
+	}
+	if err := c.verifyArchive(sessionID, body, createSessionRequest); err != nil {
+		writeError(rw, err)
+		return
+	}
+	if createSessionRequest, err = c.prepareCreate(req, sessionID, createSessionRequest); err != nil {
+		writeError(rw, err)
+		return
+	}
+	// The ID generated for the audit record doesn't make the request one
+	// for a given session.
+	idFromClient := sessionID.ID != ""
+	if !idFromClient && c.config.Audit != nil {
+		sessionID.ID = uuid.NewString()
+	}
+	createdKeys := []map[string]any{createSessionRequest.State}
+	for _, event := range createSessionRequest.Events {
+		createdKeys = append(createdKeys, event.Actions.StateDelta)
+	}
+	record := AuditRecord{
+		Operation:   AuditCreate,
+		AppName:     sessionID.AppName,
+		UserID:      sessionID.UserID,
+		SessionID:   sessionID.ID,
+		ChangedKeys: auditKeys(createdKeys...),
+	}
+	var respSession models.Session
+	switch {
+	case createSessionRequest.Import && idFromClient:
+		respSession, err = c.auditCreate(req, record, func() (models.Session, error) {
+			return c.importSession(leaseContext(req), sessionID, createSessionRequest)
+		})
+	case createSessionRequest.DedupKey != "":
+		respSession, err = c.createOrGetSession(req, sessionID, createSessionRequest, record)
+	default:
+		respSession, err = c.auditCreate(req, record, func() (models.Session, error) {
+			return c.createSession(req.Context(), sessionID, createSessionRequest)
+		})
+	}
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 	EncodeJSONResponse(respSession, http.StatusOK, rw)
 }
 
+// prepareCreate checks the state, the events and the labels of a session
+// creation request, and returns it normalized and completed with its
+// template.
+func (c *SessionsAPIController) prepareCreate(req *http.Request, sessionID models.SessionID, createSessionRequest models.CreateSessionRequest) (models.CreateSessionRequest, error) {
+	if err := c.config.AllowedAuthors.check(sessionID.AppName, createSessionRequest.Events...); err != nil {
+		return models.CreateSessionRequest{}, err
+	}
+	if err := c.checkStateDepth(createSessionRequest.State); err != nil {
+		return models.CreateSessionRequest{}, err
+	}
+	if err := c.checkEventsStateDepth(createSessionRequest.Events...); err != nil {
+		return models.CreateSessionRequest{}, err
+	}
+	for i := range createSessionRequest.Events {
+		if err := c.prepareEventDelta(sessionID.AppName, &createSessionRequest.Events[i]); err != nil {
+			return models.CreateSessionRequest{}, err
+		}
+	}
+	var err error
+	if createSessionRequest.State, err = c.config.StateKeys.apply(createSessionRequest.State, c.config.ProtectSystemState); err != nil {
+		return models.CreateSessionRequest{}, err
+	}
+	if err := c.config.AllowedStateKeys.check(sessionID.AppName, createSessionRequest.State); err != nil {
+		return models.CreateSessionRequest{}, err
+	}
+	createSessionRequest.State = c.config.StateCoercion.apply(sessionID.AppName, createSessionRequest.State)
+	// The template is applied after the checks of the client's values, the
+	// values of the server's templates are trusted.
+	if createSessionRequest, err = c.config.Templates.apply(sessionID.AppName, createSessionRequest); err != nil {
+		return models.CreateSessionRequest{}, err
+	}
+	if !createSessionRequest.Import {
+		for i := range createSessionRequest.Events {
+			createSessionRequest.Events[i].Tags = c.config.EventEnrichment.enrich(req, createSessionRequest.Events[i].Tags)
+		}
+	}
+	if err := checkLabels(createSessionRequest.Labels); err != nil {
+		return models.CreateSessionRequest{}, err
+	}
+	if _, ok := c.service.(session.LabelService); !ok && len(createSessionRequest.Labels) > 0 {
+		return models.CreateSessionRequest{}, newStatusError(errors.New("session service does not support labels"), http.StatusNotImplemented)
+	}
+	return createSessionRequest, nil
+}
+
+// createRunSession creates the session of a run with the initial state
+// the run requests, applying the checks and the audit of
+// CreateSessionHandler.
+func (c *SessionsAPIController) createRunSession(req *http.Request, sessionID models.SessionID, state map[string]any) (session.Session, error) {
+	if sessionID.ID == "" && c.config.Audit != nil {
+		sessionID.ID = uuid.NewString()
+	}
+	createSessionRequest, err := c.prepareCreate(req, sessionID, models.CreateSessionRequest{State: state})
+	if err != nil {
+		return nil, err
+	}
+	audited, err := c.config.Audit.begin(req, AuditRecord{
+		Operation:   AuditCreate,
+		AppName:     sessionID.AppName,
+		UserID:      sessionID.UserID,
+		SessionID:   sessionID.ID,
+		ChangedKeys: auditKeys(createSessionRequest.State),
+	})
+	if err != nil {
+		return nil, err
+	}
+	created, err := c.service.Create(req.Context(), newCreateRequest(sessionID, createSessionRequest))
+	audited(err)
+	if err != nil {
+		return nil, err
+	}
+	return created.Session, nil
+}
+
 func (c *SessionsAPIController) createSession(ctx context.Context, sessionID models.SessionID, createSessionRequest models.CreateSessionRequest) (models.Session, error) {
-	session, err := c.service.Create(ctx, &session.CreateRequest{
+	created, err := c.service.Create(ctx, newCreateRequest(sessionID, createSessionRequest))
+	if err != nil {
+		return models.Session{}, err
+	}
+	return c.appendCreatedEvents(ctx, created.Session, createSessionRequest.Events)
+}
+
+func newCreateRequest(sessionID models.SessionID, createSessionRequest models.CreateSessionRequest) *session.CreateRequest {
+	return &session.CreateRequest{
 		AppName:   sessionID.AppName,
 		UserID:    sessionID.UserID,
 		SessionID: sessionID.ID,
 		State:     createSessionRequest.State,
-	})
+		Labels:    createSessionRequest.Labels,
+	}
+}
+
+// appendCreatedEvents appends the events of the creation request to the
+// created session.
+func (c *SessionsAPIController) appendCreatedEvents(ctx context.Context, created session.Session, events []models.Event) (models.Session, error) {
+	for _, event := range events {
+		if err := c.service.AppendEvent(ctx, created, models.ToSessionEvent(event)); err != nil {
+			return models.Session{}, err
+		}
+	}
+	return models.FromSession(created)
+}
+
+// createOrGetSession creates the session like createSession, unless it
+// already exists, in which case it is returned as it is. A creation failing
+// because a concurrent request created the session first returns that
+// session.
+func (c *SessionsAPIController) createOrGetSession(req *http.Request, sessionID models.SessionID, createSessionRequest models.CreateSessionRequest, record AuditRecord) (models.Session, error) {
+	ctx := req.Context()
+	getExisting := func() (models.Session, error) {
+		existing, err := c.service.Get(ctx, &session.GetRequest{
+			AppName:   sessionID.AppName,
+			UserID:    sessionID.UserID,
+			SessionID: sessionID.ID,
+		})
+		if err != nil {
+			return models.Session{}, err
+		}
+		return models.FromSession(existing.Session)
+	}
+	// Returning the session created earlier for the key creates nothing,
+	// only the creation is audited.
+	respSession, err := getExisting()
+	if !errors.Is(err, session.ErrSessionNotFound) {
+		return respSession, err
+	}
+	audited, err := c.config.Audit.begin(req, record)
 	if err != nil {
 		return models.Session{}, err
 	}
-	for _, event := range createSessionRequest.Events {
-		err = c.service.AppendEvent(ctx, session.Session, models.ToSessionEvent(event))
+	created, err := c.service.Create(ctx, newCreateRequest(sessionID, createSessionRequest))
+	if err != nil {
+		// The record of the losing request keeps the error, the session
+		// was created and audited by the other one.
+		audited(err)
+		if existing, getErr := getExisting(); getErr == nil {
+			return existing, nil
+		}
+		return models.Session{}, err
+	}
+	respSession, err = c.appendCreatedEvents(ctx, created.Session, createSessionRequest.Events)
+	audited(err)
+	return respSession, err
+}
+
+// auditCreate runs create between the audit records of a session creation.
+func (c *SessionsAPIController) auditCreate(req *http.Request, record AuditRecord, create func() (models.Session, error)) (models.Session, error) {
+	audited, err := c.config.Audit.begin(req, record)
+	if err != nil {
+		return models.Session{}, err
+	}
+	respSession, err := create()
+	audited(err)
+	return respSession, err
+}
+
+// importSession creates the session like createSession. If the session
+// already exists, only the events it doesn't contain yet are appended to it
+// and the state of the request is ignored, so importing the same archive
+// again is a no-op.
+func (c *SessionsAPIController) importSession(ctx context.Context, sessionID models.SessionID, createSessionRequest models.CreateSessionRequest) (models.Session, error) {
+	var target session.Session
+	created, createErr := c.service.Create(ctx, &session.CreateRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+		State:     createSessionRequest.State,
+		Labels:    createSessionRequest.Labels,
+	})
+	if createErr == nil {
+		target = created.Session
+	} else {
+		existing, err := c.service.Get(ctx, &session.GetRequest{
+			AppName:   sessionID.AppName,
+			UserID:    sessionID.UserID,
+			SessionID: sessionID.ID,
+		})
 		if err != nil {
+			return models.Session{}, createErr
+		}
+		target = existing.Session
+	}
+
+	imported := map[string]bool{}
+	for event := range target.Events().All() {
+		imported[eventDedupKey(models.FromSessionEvent(*event))] = true
+	}
+	for _, event := range createSessionRequest.Events {
+		key := eventDedupKey(event)
+		if imported[key] {
+			continue
+		}
+		imported[key] = true
+		if err := c.service.AppendEvent(ctx, target, models.ToSessionEvent(event)); err != nil {
 			return models.Session{}, err
 		}
 	}
-	return models.FromSession(session.Session)
+	return models.FromSession(target)
+}
+
+// eventDedupKey identifies an event by its ID, or by a hash of its content
+// when it has no ID.
+func eventDedupKey(event models.Event) string {
+	if event.ID != "" {
+		return "id:" + event.ID
+	}
+	// The sequence is assigned by the service, an imported event has
+	// another one than in the exported session.
+	event.Sequence = 0
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		// Unencodable events are never considered duplicates.
+		return "unencodable:" + uuid.NewString()
+	}
+	hash := sha256.Sum256(encoded)
+	return "hash:" + hex.EncodeToString(hash[:])
 }
 
 // DeleteSession handles deleting a specific session.
 func (c *SessionsAPIController) DeleteSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
 	params := mux.Vars(req)
 	sessionID, err := models.SessionIDFromHTTPParameters(params)
 	if err != nil {
@@ -96,45 +661,182 @@ func (c *SessionsAPIController) DeleteSessionHandler(rw http.ResponseWriter, req
 		return
 	}
 
+	audited, err := c.config.Audit.begin(req, AuditRecord{
+		Operation: AuditDelete,
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
 	err = c.service.Delete(req.Context(), &session.DeleteRequest{
 		AppName:   sessionID.AppName,
 		UserID:    sessionID.UserID,
 		SessionID: sessionID.ID,
 	})
+	audited(err)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 	EncodeJSONResponse(nil, http.StatusOK, rw)
 }
 
-// GetSession retrieves a specific session by its ID.
+// GetSession retrieves a specific session by its ID. With the maxDepth
+// query parameter, the state is truncated below that many levels of nesting,
+// see [models.TruncateStateDepth]. With collapsePartials, the superseded
+// partial events are left out. The hashes are still the ones of the whole
+// state and of all the events. With mergedState, the session also has the
+// merged view of its app, user and session state scopes, where narrower
+// scopes override wider ones, and with stateSources the scope of every key
+// of the view, see [models.MergeStateScopes]. The session is encoded one
+// event at a time and flushed as it goes, see [models.SessionStream], so
+// that large sessions aren't held in memory in full. Serializers other than
+// JSON, see [NewSerializerMiddleware], get the whole session as a
+// [json.RawMessage].
 func (c *SessionsAPIController) GetSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	stream, ok := c.loadSession(rw, req)
+	if !ok {
+		return
+	}
+	if serializer := responseSerializer(rw); !isJSON(serializer) {
+		var body bytes.Buffer
+		if _, err := stream.WriteTo(&body); err != nil {
+			writeError(rw, err)
+			return
+		}
+		EncodeJSONResponse(json.RawMessage(body.Bytes()), http.StatusOK, rw)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	rw.WriteHeader(http.StatusOK)
+	if _, err := stream.WriteTo(newFlushWriter(rw)); err != nil && req.Context().Err() == nil {
+		log.Printf("encoding of session %q aborted: %v", mux.Vars(req)["session_id"], err)
+		// Abort the response, so the client doesn't mistake the truncated
+		// session for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// HeadSessionHandler returns the headers GetSessionHandler returns for the
+// session, without the body, for clients checking the existence or the
+// freshness of a session. The ETag and Last-Modified headers are derived
+// from the session metadata; the Content-Length is the exact length of the
+// body, which is encoded to count its bytes but not held in memory, unless
+// a serializer other than JSON is negotiated.
+func (c *SessionsAPIController) HeadSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	stream, ok := c.loadSession(rw, req)
+	if !ok {
+		return
+	}
+	if serializer := responseSerializer(rw); !isJSON(serializer) {
+		var raw bytes.Buffer
+		if _, err := stream.WriteTo(&raw); err != nil {
+			writeError(rw, err)
+			return
+		}
+		body, err := serializer.Marshal(json.RawMessage(raw.Bytes()))
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+		rw.Header().Set("Content-Type", serializer.ContentType())
+		rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	var body byteCounter
+	if _, err := stream.WriteTo(&body); err != nil {
+		writeError(rw, err)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	rw.Header().Set("Content-Length", strconv.FormatInt(int64(body), 10))
+	rw.WriteHeader(http.StatusOK)
+}
+
+// byteCounter is an [io.Writer] counting the bytes written to it.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// sessionETag returns the weak entity tag of the session, built from its
+// version. The sequence of the last event changes with every append, even
+// when the update time is clamped and retention trims as many events as are
+// appended. The update time and the number of events tell apart the
+// versions of the services which don't number events, and the compactions.
+func sessionETag(s session.Session) string {
+	return fmt.Sprintf(`W/"%x-%x-%x"`, sessionVersion(s), s.LastUpdateTime().UnixMicro(), s.Events().Len())
+}
+
+// loadSession gets the session of the request, with its state truncated to
+// the maxDepth query parameter, its state scopes merged and its partial
+// events collapsed as requested, and sets its ETag and Last-Modified headers, or writes an error
+// and returns false.
+func (c *SessionsAPIController) loadSession(rw http.ResponseWriter, req *http.Request) (*models.SessionStream, bool) {
 	params := mux.Vars(req)
 	sessionID, err := models.SessionIDFromHTTPParameters(params)
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	if sessionID.ID == "" {
 		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
-		return
+		return nil, false
+	}
+	maxDepth, err := maxDepthQueryParam(req)
+	if err != nil {
+		writeError(rw, err)
+		return nil, false
 	}
-	storedSession, err := c.service.Get(req.Context(), &session.GetRequest{
+	collapse, err := c.collapsePartials(req)
+	if err != nil {
+		writeError(rw, err)
+		return nil, false
+	}
+	mergeState, err := boolQueryParam(req, "mergedState")
+	if err != nil {
+		writeError(rw, err)
+		return nil, false
+	}
+	stateSources, err := boolQueryParam(req, "stateSources")
+	if err != nil {
+		writeError(rw, err)
+		return nil, false
+	}
+	if stateSources && !mergeState {
+		http.Error(rw, "stateSources requires mergedState", http.StatusBadRequest)
+		return nil, false
+	}
+	storedSession, err := c.getSession(req, &session.GetRequest{
 		AppName:   sessionID.AppName,
 		UserID:    sessionID.UserID,
 		SessionID: sessionID.ID,
 	})
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
-		return
+		writeError(rw, err)
+		return nil, false
 	}
-	session, err := models.FromSession(storedSession.Session)
+	stream, err := models.NewSessionStream(storedSession.Session)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
-		return
+		writeError(rw, err)
+		return nil, false
+	}
+	if mergeState {
+		stream.MergeState(stateSources)
 	}
-	EncodeJSONResponse(session, http.StatusOK, rw)
+	stream.TruncateState(maxDepth)
+	if collapse {
+		stream.SetEvents(session.CollapsePartials(slices.Collect(storedSession.Session.Events().All())))
+	}
+	rw.Header().Set("ETag", sessionETag(storedSession.Session))
+	rw.Header().Set("Last-Modified", storedSession.Session.LastUpdateTime().UTC().Format(http.TimeFormat))
+	return stream, true
 }
 
 // ListSessions handles listing all sessions for a given app and user.
@@ -145,30 +847,61 @@ func (c *SessionsAPIController) ListSessionsHandler(rw http.ResponseWriter, req
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
+	page, err := pageParamsFromRequest(req, c.config.PageSizes)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	selector, err := labelSelector(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
 	var sessions []models.Session
-	resp, err := c.service.List(req.Context(), &session.ListRequest{
+	listResp, err := c.service.List(req.Context(), &session.ListRequest{
 		AppName: sessionID.AppName,
 		UserID:  sessionID.UserID,
+		Labels:  selector,
 	})
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
-	for _, session := range resp.Sessions {
-		respSession, err := models.FromSession(session)
+	for _, listed := range listResp.Sessions {
+		// Services which don't store labels ignore the selector.
+		if !session.MatchLabels(listed, selector) {
+			continue
+		}
+		respSession, err := models.FromSession(listed)
 		if err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			writeError(rw, err)
 			return
 		}
 		sessions = append(sessions, respSession)
 	}
-	EncodeJSONResponse(sessions, http.StatusOK, rw)
+	if !page.requested {
+		// Clients that don't page keep receiving the bare list.
+		EncodeJSONResponse(sessions, http.StatusOK, rw)
+		return
+	}
+	slices.SortStableFunc(sessions, func(a, b models.Session) int {
+		return cmp.Or(cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.ID, b.ID))
+	})
+	resp, err := paginate(sessions, page, c.pageTokens, "sessions", sessionID.AppName, sessionID.UserID)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(resp, http.StatusOK, rw)
 }
 
-// UpdateSessionHandler handles updating a session's state, specifically it performs a PATCH.
-// It creates and appends an event containing the state delta, ensuring all state changes
-// are recorded in the session's event history.
-func (c *SessionsAPIController) UpdateSessionHandler(rw http.ResponseWriter, req *http.Request) {
+// GetSessionStateHandler returns the value within the session state that
+// the JSON Pointer of the pointer query parameter refers to. The whole state
+// is returned when the pointer is empty or absent. The maxDepth query
+// parameter truncates the value below that many levels of nesting, so that
+// clients can drill down into large values with the pointers of the
+// placeholders, see [models.TruncateDepth].
+func (c *SessionsAPIController) GetSessionStateHandler(rw http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 	sessionID, err := models.SessionIDFromHTTPParameters(params)
 	if err != nil {
@@ -179,52 +912,794 @@ func (c *SessionsAPIController) UpdateSessionHandler(rw http.ResponseWriter, req
 		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
 		return
 	}
-
-	patchRequest := models.PatchSessionStateDeltaRequest{}
-	if err := json.NewDecoder(req.Body).Decode(&patchRequest); err != nil {
+	pointer := req.URL.Query().Get("pointer")
+	tokens, err := models.ParseJSONPointer(pointer)
+	if err != nil {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Normalize directives to nil values for the service layer
-	normalizedDelta, err := models.NormalizeStateDelta(patchRequest.StateDelta)
+	maxDepth, err := maxDepthQueryParam(req)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		writeError(rw, err)
 		return
 	}
-
-	// Fetch the current session
-	getResp, err := c.service.Get(req.Context(), &session.GetRequest{
+	storedSession, err := c.getSession(req, &session.GetRequest{
 		AppName:   sessionID.AppName,
 		UserID:    sessionID.UserID,
 		SessionID: sessionID.ID,
 	})
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
-
-	stateUpdateEvent := &session.Event{
-		ID:           uuid.NewString(),
-		InvocationID: "p-" + uuid.NewString(),
-		Author:       "user",
-		Timestamp:    time.Now(),
-		Actions: session.EventActions{
-			StateDelta: normalizedDelta,
-		},
+	value, ok := models.ResolveJSONPointer(maps.Collect(storedSession.Session.State().All()), tokens)
+	if !ok {
+		http.Error(rw, fmt.Sprintf("state path %q not found", pointer), http.StatusNotFound)
+		return
+	}
+	value = models.TruncateDepth(value, maxDepth)
+	if value == nil {
+		// EncodeJSONResponse writes no body for nil.
+		value = json.RawMessage("null")
 	}
+	EncodeJSONResponse(value, http.StatusOK, rw)
+}
 
-	// Append the event to the session, which applies the state delta through the event path
-	if err := c.service.AppendEvent(req.Context(), getResp.Session, stateUpdateEvent); err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+// ListEventsHandler handles listing the events of a session, one page at a
+// time, in the order they were appended. Events can be filtered by their tags
+// with the tag query parameter. With the since query parameter, only the
+// events with a timestamp strictly after it are listed, ordered by timestamp
+// and then by sequence and ID. With the afterSequence query parameter, only
+// the events with a sequence strictly after it are listed, ordered by
+// sequence, which unlike the timestamps never ties. With groupBy=invocation, the listed events are grouped by
+// invocation ID and the pages hold groups, see
+// [models.GroupEventsByInvocation]. With collapsePartials, the partial
+// events superseded by a final one are left out before filtering. With the
+// fields or excludeFields query parameter, only the named JSON fields of the
+// events are listed, or all but them, among the fields the server allows,
+// see [models.EventProjection]; projections can't be grouped.
+func (c *SessionsAPIController) ListEventsHandler(rw http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Return the updated session
-	respSession, err := models.FromSession(getResp.Session)
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	page, err := pageParamsFromRequest(req, c.config.PageSizes)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
-	EncodeJSONResponse(respSession, http.StatusOK, rw)
+	filter, err := tagFilterFromRequest(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	since, hasSince, err := sinceFromRequest(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	afterSequence, hasAfterSequence, err := afterSequenceFromRequest(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	groupBy := req.URL.Query().Get("groupBy")
+	if groupBy != "" && groupBy != "invocation" {
+		http.Error(rw, fmt.Sprintf("unsupported groupBy %q, only \"invocation\" is supported", groupBy), http.StatusBadRequest)
+		return
+	}
+	projection, hasProjection, err := eventProjectionFromRequest(req, c.config.ProjectableEventFields)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	if hasProjection && groupBy != "" {
+		http.Error(rw, "event fields can't be projected with groupBy", http.StatusBadRequest)
+		return
+	}
+	collapse, err := c.collapsePartials(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	storedSession, err := c.getSession(req, &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	sessionEvents := slices.Collect(storedSession.Session.Events().All())
+	if collapse {
+		sessionEvents = session.CollapsePartials(sessionEvents)
+	}
+	if hasSince {
+		sessionEvents = slices.DeleteFunc(sessionEvents, func(event *session.Event) bool {
+			return !event.Timestamp.After(since)
+		})
+		// Order by time, so that the events after a timestamp form a suffix
+		// of the result, breaking ties by ID for a stable pagination.
+		slices.SortStableFunc(sessionEvents, func(a, b *session.Event) int {
+			return cmp.Or(a.Timestamp.Compare(b.Timestamp), cmp.Compare(a.Sequence, b.Sequence), cmp.Compare(a.ID, b.ID))
+		})
+	}
+	if hasAfterSequence {
+		sessionEvents = slices.DeleteFunc(sessionEvents, func(event *session.Event) bool {
+			return event.Sequence <= afterSequence
+		})
+		if !hasSince {
+			slices.SortStableFunc(sessionEvents, func(a, b *session.Event) int {
+				return cmp.Compare(a.Sequence, b.Sequence)
+			})
+		}
+	}
+	events := []models.Event{}
+	for _, event := range sessionEvents {
+		if respEvent := models.FromSessionEvent(*event); filter.match(respEvent) {
+			events = append(events, respEvent)
+		}
+	}
+	if groupBy == "invocation" {
+		resp, err := paginate(models.GroupEventsByInvocation(events), page, c.pageTokens, "invocations", sessionID.AppName, sessionID.UserID, sessionID.ID)
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+		EncodeJSONResponse(resp, http.StatusOK, rw)
+		return
+	}
+	resp, err := paginate(events, page, c.pageTokens, "events", sessionID.AppName, sessionID.UserID, sessionID.ID)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	if hasProjection {
+		projected, err := projectEvents(resp, projection)
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+		EncodeJSONResponse(projected, http.StatusOK, rw)
+		return
+	}
+	EncodeJSONResponse(resp, http.StatusOK, rw)
+}
+
+// WatchUserEventsHandler streams the events appended to any session of the
+// user, including sessions created while streaming, using Server-Sent Events
+// (SSE). Each message carries the ID of the event's session. The stream ends
+// when the client disconnects; events a slow client can't keep up with are
+// dropped. Streams past the configured limits are rejected with 503.
+func (c *SessionsAPIController) WatchUserEventsHandler(rw http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	watchService, ok := c.service.(session.WatchService)
+	if !ok {
+		http.Error(rw, "session service does not support watching", http.StatusNotImplemented)
+		return
+	}
+	release, ok := c.config.Streams.acquire(rw, sessionID.UserID)
+	if !ok {
+		return
+	}
+	defer release()
+	sub, err := watchService.WatchUser(req.Context(), &session.WatchUserRequest{
+		AppName: sessionID.AppName,
+		UserID:  sessionID.UserID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	// the stream lives until the client disconnects, past server-wide timeouts
+	rc := http.NewResponseController(rw)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		http.Error(rw, fmt.Sprintf("failed to clear write deadline: %v", err), http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	for event := range c.config.WatchReordering.reorder(req.Context(), sub.Events()) {
+		msg := models.SessionEvent{SessionID: event.SessionID, Event: models.FromSessionEvent(*event.Event)}
+		if err := writeSSEMessage(rc, rw, msg); err != nil {
+			// The client is gone, the subscription ends with the request.
+			return
+		}
+	}
+}
+
+// writeSSEMessage writes v as the data of a single SSE message and flushes it.
+func writeSSEMessage(rc *http.ResponseController, rw http.ResponseWriter, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(rw, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// normalizeStateDelta normalizes the directives of the delta for the service
+// layer, resolving the configured directive aliases.
+func (c *SessionsAPIController) normalizeStateDelta(rw http.ResponseWriter, delta map[string]any) (map[string]any, error) {
+	return models.NormalizeStateDeltaWithConfig(delta, models.DirectiveConfig{
+		Aliases: c.config.DirectiveAliases,
+		OnAlias: func(key, alias, canonical string) {
+			warning := fmt.Sprintf("state update directive %q used for key %q is deprecated, use %q", alias, key, canonical)
+			log.Print(warning)
+			if c.config.DeprecationHeaders {
+				rw.Header().Add("Warning", fmt.Sprintf("299 - %q", warning))
+			}
+		},
+		UnknownDirectives: c.config.UnknownDirectives,
+		OnUnknown: func(key, name string) {
+			log.Printf("unknown state update directive %q used for key %q was not applied as a directive", name, key)
+		},
+	})
+}
+
+// prepareStateDelta checks the depth of a delta submitted by a client for
+// the app and its keys against the state key policy, coerces its typed
+// values and normalizes its directives. Errors are reported with 400 Bad
+// Request.
+func (c *SessionsAPIController) prepareStateDelta(rw http.ResponseWriter, appName string, delta map[string]any) (map[string]any, error) {
+	if err := c.checkStateDepth(delta); err != nil {
+		return nil, err
+	}
+	stateDelta, err := c.config.StateKeys.apply(delta, c.config.ProtectSystemState)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.config.AllowedStateKeys.check(appName, stateDelta); err != nil {
+		return nil, err
+	}
+	stateDelta = c.config.StateCoercion.apply(appName, stateDelta)
+	normalizedDelta, err := c.normalizeStateDelta(rw, stateDelta)
+	if err != nil {
+		return nil, newStatusError(err, http.StatusBadRequest)
+	}
+	return normalizedDelta, nil
+}
+
+// ValidateStateDeltaHandler validates a state delta without applying it to
+// any session, running the same checks as the PATCH of a session, and
+// returns its normalized form.
+func (c *SessionsAPIController) ValidateStateDeltaHandler(rw http.ResponseWriter, req *http.Request) {
+	appName := mux.Vars(req)["app_name"]
+	if appName == "" {
+		http.Error(rw, "app_name parameter is required", http.StatusBadRequest)
+		return
+	}
+	patchRequest := models.PatchSessionStateDeltaRequest{}
+	if err := c.decodeRequest(req, &patchRequest); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	normalizedDelta, err := c.prepareStateDelta(rw, appName, patchRequest.StateDelta)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	encoded, err := models.EncodeStateDelta(normalizedDelta)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(models.ValidateStateDeltaResponse{StateDelta: encoded}, http.StatusOK, rw)
+}
+
+// UpdateSessionHandler handles updating a session's state, specifically it performs a PATCH.
+// It creates and appends an event containing the state delta, ensuring all state changes
+// are recorded in the session's event history.
+// With the dryRun query parameter, the session is left unchanged and the state it would
+// have is returned instead, with the diff against the current state if diff is set.
+// With the verbose query parameter, the response also reports the outcome of every entry
+// of the delta, evaluated against the loaded state by [session.EvaluateStateDelta]:
+// whether it is applied, a no-op, or would fail the patch, which only a dry run returns.
+func (c *SessionsAPIController) UpdateSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	dryRun, err := boolQueryParam(req, "dryRun")
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	withDiff, err := boolQueryParam(req, "diff")
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	verbose, err := boolQueryParam(req, "verbose")
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	if !dryRun && c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	params := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	timings := requestTimings(req)
+	patchRequest := models.PatchSessionStateDeltaRequest{}
+	stop := timings.start("decode")
+	err = c.decodeRequest(req, &patchRequest)
+	stop()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Normalize directives to nil values for the service layer
+	stop = timings.start("normalize")
+	normalizedDelta, err := c.prepareStateDelta(rw, sessionID.AppName, patchRequest.StateDelta)
+	stop()
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	// Fetch the current session
+	stop = timings.start("load")
+	getResp, err := c.service.Get(req.Context(), &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	stop()
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	if err := c.checkStateKeyCount(getResp.Session, normalizedDelta); err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	if dryRun {
+		c.previewStateDelta(rw, getResp.Session, normalizedDelta, withDiff, verbose)
+		return
+	}
+
+	var outcomes map[string]models.DeltaOutcome
+	if verbose {
+		// The outcomes are evaluated before the append changes the state of
+		// the loaded session.
+		outcomes, _ = models.FromStateDeltaOutcomes(session.EvaluateStateDelta(maps.Collect(getResp.Session.State().All()), normalizedDelta))
+	}
+	if !c.skipStateDelta(getResp.Session, normalizedDelta) {
+		stateUpdateEvent := newStateUpdateEvent("p-"+uuid.NewString(), normalizedDelta)
+		stateUpdateEvent.Tags = c.config.EventEnrichment.enrich(req, nil)
+		audited, err := c.config.Audit.begin(req, AuditRecord{
+			Operation:   AuditPatch,
+			AppName:     sessionID.AppName,
+			UserID:      sessionID.UserID,
+			SessionID:   sessionID.ID,
+			ChangedKeys: auditKeys(normalizedDelta),
+		})
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+
+		// Append the event to the session, which applies the state delta through the event path
+		stop = timings.start("store")
+		err = c.service.AppendEvent(leaseContext(req), getResp.Session, stateUpdateEvent)
+		stop()
+		audited(err)
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+	}
+
+	// Return the updated session
+	defer timings.start("encode")()
+	respSession, err := models.FromSession(getResp.Session)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	rw.Header().Set("ETag", sessionETag(getResp.Session))
+	c.config.ReadYourWrites.setVersion(rw, sessionVersion(getResp.Session))
+	if verbose {
+		EncodeJSONResponse(models.VerbosePatchResponse{Session: respSession, Outcomes: outcomes}, http.StatusOK, rw)
+		return
+	}
+	EncodeJSONResponse(respSession, http.StatusOK, rw)
+}
+
+// skipStateDelta reports whether the state patch is left out because the
+// normalized delta wouldn't change the state of the session, see
+// SessionsAPIConfig.SkipNoopStateDeltas. Deltas whose directives fail are
+// appended, for the service to report the failure.
+func (c *SessionsAPIController) skipStateDelta(storedSession session.Session, delta map[string]any) bool {
+	if !c.config.SkipNoopStateDeltas {
+		return false
+	}
+	noop, err := session.IsNoopStateDelta(maps.Collect(storedSession.State().All()), delta)
+	return err == nil && noop
+}
+
+// newClientEvent returns the session event of an event submitted by a
+// client, with an ID and a timestamp assigned if it has none.
+func newClientEvent(event models.Event) *session.Event {
+	sessionEvent := models.ToSessionEvent(event)
+	if sessionEvent.ID == "" {
+		sessionEvent.ID = uuid.NewString()
+	}
+	if event.Time == 0 {
+		sessionEvent.Timestamp = time.Now()
+	}
+	return sessionEvent
+}
+
+// AppendEventHandler appends an event to a session. Events without an ID or
+// a timestamp get them assigned by the server.
+func (c *SessionsAPIController) AppendEventHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	params := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.events.checkBody(req, sessionID.AppName, singleEvent); err != nil {
+		writeError(rw, err)
+		return
+	}
+	timings := requestTimings(req)
+	event := models.Event{}
+	stop := timings.start("decode")
+	err = c.decodeRequest(req, &event)
+	stop()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.config.AllowedAuthors.check(sessionID.AppName, event); err != nil {
+		writeError(rw, err)
+		return
+	}
+	if err := c.checkEventsStateDepth(event); err != nil {
+		writeError(rw, err)
+		return
+	}
+	if err := c.prepareEventDelta(sessionID.AppName, &event); err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	stop = timings.start("load")
+	getResp, err := c.service.Get(req.Context(), &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	stop()
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	sessionEvent := newClientEvent(event)
+	sessionEvent.Tags = c.config.EventEnrichment.enrich(req, sessionEvent.Tags)
+	audited, err := c.config.Audit.begin(req, AuditRecord{
+		Operation:   AuditAppend,
+		AppName:     sessionID.AppName,
+		UserID:      sessionID.UserID,
+		SessionID:   sessionID.ID,
+		ChangedKeys: auditKeys(sessionEvent.Actions.StateDelta),
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	stop = timings.start("store")
+	err = c.service.AppendEvent(leaseContext(req), getResp.Session, sessionEvent)
+	stop()
+	audited(err)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	c.config.ReadYourWrites.setVersion(rw, sessionEvent.Sequence)
+	defer timings.start("encode")()
+	EncodeJSONResponse(models.FromSessionEvent(*sessionEvent), http.StatusOK, rw)
+}
+
+// AppendEventWithStateHandler applies a state delta to a session and appends
+// an event to it atomically: readers see both or neither. The delta is
+// recorded by a state update event followed by the submitted event. The
+// delta and the event are validated as by the PATCH of a session and the
+// append of an event, before either is applied.
+func (c *SessionsAPIController) AppendEventWithStateHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	params := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	txService, ok := c.service.(session.TransactionService)
+	if !ok {
+		http.Error(rw, "session service does not support transactions", http.StatusNotImplemented)
+		return
+	}
+
+	if err := c.events.checkBody(req, sessionID.AppName, nestedEvent); err != nil {
+		writeError(rw, err)
+		return
+	}
+	appendRequest := models.AppendEventWithStateRequest{}
+	if err := c.decodeRequest(req, &appendRequest); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(appendRequest.StateDelta) == 0 {
+		http.Error(rw, "stateDelta must not be empty", http.StatusBadRequest)
+		return
+	}
+	if appendRequest.Event == nil {
+		http.Error(rw, "event is required", http.StatusBadRequest)
+		return
+	}
+	normalizedDelta, err := c.prepareStateDelta(rw, sessionID.AppName, appendRequest.StateDelta)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	if err := c.checkStoredStateKeyCount(req.Context(), sessionID, normalizedDelta, nil); err != nil {
+		writeError(rw, err)
+		return
+	}
+	event := *appendRequest.Event
+	if err := c.config.AllowedAuthors.check(sessionID.AppName, event); err != nil {
+		writeError(rw, err)
+		return
+	}
+	if err := c.checkEventsStateDepth(event); err != nil {
+		writeError(rw, err)
+		return
+	}
+	if err := c.prepareEventDelta(sessionID.AppName, &event); err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	sessionEvent := newClientEvent(event)
+	sessionEvent.Tags = c.config.EventEnrichment.enrich(req, sessionEvent.Tags)
+	stateUpdateEvent := newStateUpdateEvent("p-"+uuid.NewString(), normalizedDelta)
+	stateUpdateEvent.Tags = c.config.EventEnrichment.enrich(req, nil)
+	audited, err := c.config.Audit.begin(req, AuditRecord{
+		Operation:   AuditAppend,
+		AppName:     sessionID.AppName,
+		UserID:      sessionID.UserID,
+		SessionID:   sessionID.ID,
+		ChangedKeys: auditKeys(normalizedDelta, sessionEvent.Actions.StateDelta),
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	// Both events are appended by one transaction, so the service checks
+	// them together and stores them under the same lock.
+	resp, err := txService.Transact(leaseContext(req), &session.TransactRequest{Ops: []session.TransactOp{
+		{AppName: sessionID.AppName, UserID: sessionID.UserID, SessionID: sessionID.ID, Event: stateUpdateEvent},
+		{AppName: sessionID.AppName, UserID: sessionID.UserID, SessionID: sessionID.ID, Event: sessionEvent},
+	}})
+	audited(err)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	respSession, err := models.FromSession(resp.Sessions[len(resp.Sessions)-1])
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	c.config.ReadYourWrites.setVersion(rw, sessionEvent.Sequence)
+	EncodeJSONResponse(models.AppendEventWithStateResponse{Session: respSession, Event: models.FromSessionEvent(*sessionEvent)}, http.StatusOK, rw)
+}
+
+// TransactSessionsHandler atomically applies state deltas to several sessions
+// of a user. Either every delta is applied or none of them is.
+func (c *SessionsAPIController) TransactSessionsHandler(rw http.ResponseWriter, req *http.Request) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	params := mux.Vars(req)
+	sessionID, err := models.SessionIDFromHTTPParameters(params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	txService, ok := c.service.(session.TransactionService)
+	if !ok {
+		http.Error(rw, "session service does not support transactions", http.StatusNotImplemented)
+		return
+	}
+
+	transactRequest := models.TransactSessionsRequest{}
+	if err := c.decodeRequest(req, &transactRequest); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(transactRequest.StateDeltas) == 0 {
+		http.Error(rw, "stateDeltas must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	// All deltas are normalized before the transaction starts, so that an
+	// invalid delta rejects the whole request.
+	invocationID := "p-" + uuid.NewString()
+	ops := make([]session.TransactOp, 0, len(transactRequest.StateDeltas))
+	records := make([]AuditRecord, 0, len(transactRequest.StateDeltas))
+	// The sessions share their app and user keys, the key count of each
+	// one is checked after the earlier deltas changed them.
+	shared := map[string]any{}
+	for _, id := range slices.Sorted(maps.Keys(transactRequest.StateDeltas)) {
+		normalizedDelta, err := c.prepareStateDelta(rw, sessionID.AppName, transactRequest.StateDeltas[id])
+		if err == nil {
+			err = c.checkStoredStateKeyCount(req.Context(), models.SessionID{AppName: sessionID.AppName, UserID: sessionID.UserID, ID: id}, normalizedDelta, shared)
+		}
+		if err != nil {
+			writeError(rw, fmt.Errorf("session %q: %w", id, err))
+			return
+		}
+		event := newStateUpdateEvent(invocationID, normalizedDelta)
+		event.Tags = c.config.EventEnrichment.enrich(req, nil)
+		ops = append(ops, session.TransactOp{
+			AppName:   sessionID.AppName,
+			UserID:    sessionID.UserID,
+			SessionID: id,
+			Event:     event,
+		})
+		records = append(records, AuditRecord{
+			Operation:   AuditPatch,
+			AppName:     sessionID.AppName,
+			UserID:      sessionID.UserID,
+			SessionID:   id,
+			ChangedKeys: auditKeys(normalizedDelta),
+		})
+	}
+
+	audited, err := c.config.Audit.begin(req, records...)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	resp, err := txService.Transact(leaseContext(req), &session.TransactRequest{Ops: ops})
+	audited(err)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	sessions := make([]models.Session, 0, len(resp.Sessions))
+	for _, s := range resp.Sessions {
+		respSession, err := models.FromSession(s)
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+		sessions = append(sessions, respSession)
+	}
+	EncodeJSONResponse(sessions, http.StatusOK, rw)
+}
+
+// previewStateDelta responds with the state the session would have after
+// applying the delta, and optionally with the diff and the outcomes of the
+// entries, without changing the session. With the outcomes, a delta with an
+// entry which would fail is reported rather than failed.
+func (c *SessionsAPIController) previewStateDelta(rw http.ResponseWriter, storedSession session.Session, delta map[string]any, withDiff, verbose bool) {
+	before := maps.Collect(storedSession.State().All())
+	var preview models.StatePreview
+	if verbose {
+		outcomes, failed := models.FromStateDeltaOutcomes(session.EvaluateStateDelta(before, delta))
+		preview.Outcomes = outcomes
+		if failed {
+			EncodeJSONResponse(preview, http.StatusOK, rw)
+			return
+		}
+	}
+	after, err := models.PreviewStateDelta(before, delta)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	preview.State = after
+	if withDiff {
+		diff := models.DiffStates(before, after)
+		preview.Diff = &diff
+	}
+	EncodeJSONResponse(preview, http.StatusOK, rw)
+}
+
+// boolQueryParam parses the boolean query parameter name, false if absent.
+func boolQueryParam(req *http.Request, name string) (bool, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, newStatusError(fmt.Errorf("%s must be a boolean, got %q", name, value), http.StatusBadRequest)
+	}
+	return parsed, nil
+}
+
+// collapsePartials parses the collapsePartials query parameter, defaulting
+// to the CollapsePartials setting.
+func (c *SessionsAPIController) collapsePartials(req *http.Request) (bool, error) {
+	if !req.URL.Query().Has("collapsePartials") {
+		return c.config.CollapsePartials, nil
+	}
+	return boolQueryParam(req, "collapsePartials")
+}
+
+// maxDepthQueryParam parses the maxDepth query parameter, a positive
+// number of levels of nesting, or 0 if absent.
+func maxDepthQueryParam(req *http.Request) (int, error) {
+	value := req.URL.Query().Get("maxDepth")
+	if value == "" {
+		return 0, nil
+	}
+	maxDepth, err := strconv.Atoi(value)
+	if err != nil || maxDepth < 1 {
+		return 0, newStatusError(fmt.Errorf("maxDepth must be a positive integer, got %q", value), http.StatusBadRequest)
+	}
+	return maxDepth, nil
+}
+
+// newStateUpdateEvent creates the event used to record a state delta
+// submitted through the API. The author is "user", matching Python behavior.
+func newStateUpdateEvent(invocationID string, stateDelta map[string]any) *session.Event {
+	return &session.Event{
+		ID:           uuid.NewString(),
+		InvocationID: invocationID,
+		Author:       "user",
+		Timestamp:    time.Now(),
+		Actions: session.EventActions{
+			StateDelta: stateDelta,
+		},
+	}
 }
@@ -15,22 +15,37 @@
 package controllers_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/gorilla/mux"
+	"google.golang.org/genai"
 
+	"google.golang.org/adk/model"
 	"google.golang.org/adk/server/adkrest/controllers"
 	"google.golang.org/adk/server/adkrest/internal/fakes"
 	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
 )
 
 func TestGetSession(t *testing.T) {
@@ -267,6 +282,153 @@ func TestCreateSession(t *testing.T) {
 	}
 }
 
+func TestCreateSession_Import(t *testing.T) {
+	archive := []models.Event{
+		{ID: "e1", Time: 1700000000, Author: "user"},
+		{ID: "e2", Time: 1700000001, Author: "model"},
+		{Time: 1700000002, Author: "model", Content: genai.NewContentFromText("no id", genai.RoleModel)},
+	}
+	superset := append(slices.Clone(archive),
+		models.Event{ID: "e3", Time: 1700000003, Author: "user"},
+		models.Event{Time: 1700000004, Author: "model", Content: genai.NewContentFromText("another without id", genai.RoleModel)},
+	)
+
+	sessionService := session.InMemoryService()
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+
+	steps := []struct {
+		name           string
+		request        models.CreateSessionRequest
+		wantEventCount int
+	}{
+		{name: "first import", request: models.CreateSessionRequest{Import: true, State: map[string]any{"k": "v"}, Events: archive}, wantEventCount: 3},
+		{name: "same archive again", request: models.CreateSessionRequest{Import: true, State: map[string]any{"k": "ignored"}, Events: archive}, wantEventCount: 3},
+		{name: "superset", request: models.CreateSessionRequest{Import: true, Events: superset}, wantEventCount: 5},
+		{name: "superset again", request: models.CreateSessionRequest{Import: true, Events: superset}, wantEventCount: 5},
+	}
+	for _, step := range steps {
+		reqBytes, err := json.Marshal(step.request)
+		if err != nil {
+			t.Fatalf("%s: marshal request: %v", step.name, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession", bytes.NewBuffer(reqBytes))
+		if err != nil {
+			t.Fatalf("%s: new request: %v", step.name, err)
+		}
+		req = mux.SetURLVars(req, sessionVars(id))
+		rr := httptest.NewRecorder()
+
+		apiController.CreateSessionHandler(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("%s: handler returned wrong status code: got %v want %v, body: %s", step.name, status, http.StatusOK, rr.Body.String())
+		}
+		var got models.Session
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: decode response: %v", step.name, err)
+		}
+		if n := len(got.Events); n != step.wantEventCount {
+			t.Errorf("%s: got %d events, want %d", step.name, n, step.wantEventCount)
+		}
+		if diff := cmp.Diff(map[string]any{"k": "v"}, got.State); diff != "" {
+			t.Errorf("%s: state mismatch (-want +got):\n%s", step.name, diff)
+		}
+	}
+	stored, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if n := stored.Session.Events().Len(); n != 5 {
+		t.Errorf("stored session has %d events, want 5", n)
+	}
+}
+
+func TestCreateSession_Template(t *testing.T) {
+	templates := controllers.SessionTemplates{
+		"testApp": {
+			"support": {
+				State: map[string]any{"model": "small", "temperature": 0.2},
+				Events: []*session.Event{{
+					Author:      "system",
+					LLMResponse: model.LLMResponse{Content: genai.NewContentFromText("You are a support agent.", genai.RoleModel)},
+					Actions:     session.EventActions{StateDelta: map[string]any{"seeded": true}},
+				}},
+			},
+		},
+	}
+	sessionService := session.InMemoryService()
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{Templates: templates})
+
+	create := func(sessionID string, request models.CreateSessionRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		reqBytes, err := json.Marshal(request)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/"+sessionID, bytes.NewBuffer(reqBytes))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, sessionVars(fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: sessionID}))
+		rr := httptest.NewRecorder()
+		apiController.CreateSessionHandler(rr, req)
+		return rr
+	}
+
+	var eventIDs []string
+	for _, sessionID := range []string{"s1", "s2"} {
+		rr := create(sessionID, models.CreateSessionRequest{
+			Template: "support",
+			State:    map[string]any{"temperature": 0.7, "ticket": "T-1"},
+			Events:   []models.Event{{ID: "client", Time: 1700000000, Author: "user"}},
+		})
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("%s: handler returned wrong status code: got %v want %v, body: %s", sessionID, status, http.StatusOK, rr.Body.String())
+		}
+		var got models.Session
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: decode response: %v", sessionID, err)
+		}
+		wantState := map[string]any{"model": "small", "temperature": 0.7, "ticket": "T-1", "seeded": true}
+		if diff := cmp.Diff(wantState, got.State); diff != "" {
+			t.Errorf("%s: state mismatch (-want +got):\n%s", sessionID, diff)
+		}
+		if len(got.Events) != 2 {
+			t.Fatalf("%s: got %d events, want 2", sessionID, len(got.Events))
+		}
+		seed, client := got.Events[0], got.Events[1]
+		if seed.Author != "system" || seed.Content.Parts[0].Text != "You are a support agent." || seed.ID == "" {
+			t.Errorf("%s: seed event = %+v, want the template's event with an ID", sessionID, seed)
+		}
+		if client.ID != "client" {
+			t.Errorf("%s: second event ID = %q, want the client's event", sessionID, client.ID)
+		}
+		eventIDs = append(eventIDs, seed.ID)
+	}
+	if eventIDs[0] == eventIDs[1] {
+		t.Errorf("the seed events of both sessions have the ID %q", eventIDs[0])
+	}
+
+	tc := []struct {
+		name    string
+		request models.CreateSessionRequest
+	}{
+		{name: "unknown template", request: models.CreateSessionRequest{Template: "sales"}},
+		{name: "template with import", request: models.CreateSessionRequest{Template: "support", Import: true}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := create("rejected", tt.request); rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusBadRequest, rr.Body.String())
+			}
+		})
+	}
+	if _, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "rejected"}); err == nil {
+		t.Errorf("a rejected request created the session")
+	}
+}
+
 func TestDeleteSession(t *testing.T) {
 	id := fakes.SessionKey{
 		AppName:   "testApp",
@@ -324,45 +486,816 @@ func TestDeleteSession(t *testing.T) {
 	}
 }
 
-func TestListSessions(t *testing.T) {
+func TestGetSession_Hashes(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	get := func(id string) models.SessionWithHashes {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/"+id, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": id})
+		rr := httptest.NewRecorder()
+		apiController.GetSessionHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.SessionWithHashes
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if got.StateHash == "" || got.EventsHash == "" {
+			t.Fatalf("GetSession() returned empty hashes: %q, %q", got.StateHash, got.EventsHash)
+		}
+		return got
+	}
+	patch := func(id, body string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/"+id, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": id})
+		rr := httptest.NewRecorder()
+		apiController.UpdateSessionHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("patch returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+
+	// Equivalent states built differently hash the same.
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "a", State: map[string]any{
+		"n": 1, "nested": map[string]any{"x": "1", "y": []any{1, 2}}, "s": "v",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "b", State: map[string]any{"s": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	patch("b", `{"stateDelta": {"nested": {"y": [1, 2], "x": "1"}, "n": 1.0}}`)
+	a, b := get("a"), get("b")
+	if a.StateHash != b.StateHash {
+		t.Errorf("equivalent states hash differently: %q and %q", a.StateHash, b.StateHash)
+	}
+	if a.EventsHash == b.EventsHash {
+		t.Errorf("different event histories hash the same: %q", a.EventsHash)
+	}
+	if again := get("a"); again.StateHash != a.StateHash || again.EventsHash != a.EventsHash {
+		t.Errorf("hashes of an unchanged session changed between reads")
+	}
+
+	// A no-op patch records an event but leaves the state hash unchanged.
+	patch("a", `{"stateDelta": {"s": "v"}}`)
+	noop := get("a")
+	if noop.StateHash != a.StateHash {
+		t.Errorf("no-op patch changed the state hash from %q to %q", a.StateHash, noop.StateHash)
+	}
+	if noop.EventsHash == a.EventsHash {
+		t.Errorf("appended event left the events hash unchanged")
+	}
+
+	// A real mutation changes the state hash.
+	patch("a", `{"stateDelta": {"nested": {"x": "2", "y": [1, 2]}}}`)
+	if changed := get("a"); changed.StateHash == noop.StateHash {
+		t.Errorf("state mutation left the state hash unchanged")
+	}
+}
+
+// flushCountingRecorder is a response recorder counting its flushes.
+type flushCountingRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushCountingRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestGetSession_Streamed(t *testing.T) {
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "large", State: map[string]any{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2000 {
+		event := session.NewEvent("invocation")
+		event.Author = "user"
+		event.Content = genai.NewContentFromText(fmt.Sprintf("%d: %s", i, strings.Repeat("x", 1000)), genai.RoleUser)
+		if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getResp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "large"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := models.FromSession(getResp.Session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHashed, err := want.WithHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantBody bytes.Buffer
+	if err := json.NewEncoder(&wantBody).Encode(wantHashed); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/large", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "large"})
+	rr := &flushCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	apiController.GetSessionHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	// The streamed encoding is the one of the whole session.
+	if !bytes.Equal(rr.Body.Bytes(), wantBody.Bytes()) {
+		t.Errorf("streamed body differs from the encoding of the session: got %d bytes, want %d", rr.Body.Len(), wantBody.Len())
+	}
+	// Over 2MB, the response is flushed as it is encoded.
+	if rr.flushes < 10 {
+		t.Errorf("response flushed %d times, want it flushed while encoding", rr.flushes)
+	}
+}
+
+func TestHeadSession(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"foo": "bar"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}
+	do := func(method string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, "/apps/testApp/users/testUser/sessions/testSession", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, mux.SetURLVars(req, vars))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s returned wrong status code: got %v want %v, body: %s", method, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		return rr
+	}
+
+	get := do(http.MethodGet, apiController.GetSessionHandler)
+	head := do(http.MethodHead, apiController.HeadSessionHandler)
+	if head.Body.Len() != 0 {
+		t.Errorf("HEAD returned a body of %d bytes, want none", head.Body.Len())
+	}
+	var got models.Session
+	if err := json.Unmarshal(get.Body.Bytes(), &got); err != nil {
+		t.Fatalf("GET returned an invalid session: %v", err)
+	}
+	if got.ID != "testSession" || got.State["foo"] != "bar" {
+		t.Errorf("GET returned session %+v, want the full session", got)
+	}
+	etag := get.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("GET returned no ETag")
+	}
+	for _, header := range []string{"ETag", "Last-Modified", "Content-Type"} {
+		if got, want := head.Header().Get(header), get.Header().Get(header); got != want {
+			t.Errorf("HEAD header %s = %q, want the GET header %q", header, got, want)
+		}
+	}
+	if got, want := head.Header().Get("Content-Length"), strconv.Itoa(get.Body.Len()); got != want {
+		t.Errorf("HEAD Content-Length = %q, want the GET body length %q", got, want)
+	}
+
+	// Appending an event changes the ETag.
+	if err := sessionService.AppendEvent(ctx, created.Session, session.NewEvent("invocation")); err != nil {
+		t.Fatal(err)
+	}
+	if got := do(http.MethodHead, apiController.HeadSessionHandler).Header().Get("ETag"); got == etag {
+		t.Errorf("HEAD ETag after an append = %q, want a new tag", got)
+	}
+}
+
+func TestHeadSession_ETagWithClampingAndRetention(t *testing.T) {
+	ctx := t.Context()
+	// One event is kept, and backdated events don't move the update time.
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		Retention: session.EventRetentionLimits{Default: session.EventRetention{MaxEvents: 1}},
+	})
+	created, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := session.NewEvent("invocation")
+	if err := sessionService.AppendEvent(ctx, created.Session, first); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	etag := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodHead, "/apps/testApp/users/testUser/sessions/testSession", nil)
+		rr := httptest.NewRecorder()
+		apiController.HeadSessionHandler(rr, mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("HEAD returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		return rr.Header().Get("ETag")
+	}
+
+	before := etag()
+	backdated := session.NewEvent("invocation")
+	backdated.Timestamp = first.Timestamp.Add(-time.Minute)
+	if err := sessionService.AppendEvent(ctx, created.Session, backdated); err != nil {
+		t.Fatal(err)
+	}
+	if got := etag(); got == before {
+		t.Errorf("ETag after an append with the same update time and number of events = %q, want a new tag", got)
+	}
+}
+
+func TestHeadSession_NotFound(t *testing.T) {
+	apiController := controllers.NewSessionsAPIController(session.InMemoryService())
+	req, err := http.NewRequest(http.MethodHead, "/apps/testApp/users/testUser/sessions/missing", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "missing"})
+	rr := httptest.NewRecorder()
+
+	apiController.HeadSessionHandler(rr, req)
+
+	if rr.Code == http.StatusOK {
+		t.Errorf("HEAD of a missing session returned %v, want an error", rr.Code)
+	}
+	if rr.Header().Get("ETag") != "" {
+		t.Errorf("HEAD of a missing session returned ETag %q, want none", rr.Header().Get("ETag"))
+	}
+}
+
+func TestGetSession_CircuitOpen(t *testing.T) {
+	sessionService := session.ServiceWithCircuitBreaker(&fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{}}, session.CircuitBreakerConfig{
+		FailureThreshold: 1,
+		Cooldown:         90 * time.Second,
+	})
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+
+	var rr *httptest.ResponseRecorder
+	wantStatuses := []int{http.StatusInternalServerError, http.StatusServiceUnavailable}
+	for i, wantStatus := range wantStatuses {
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, sessionVars(id))
+		rr = httptest.NewRecorder()
+
+		apiController.GetSessionHandler(rr, req)
+
+		if status := rr.Code; status != wantStatus {
+			t.Fatalf("request %d: handler returned wrong status code: got %v want %v", i, status, wantStatus)
+		}
+	}
+	if got := rr.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("Retry-After = %q, want %q", got, "90")
+	}
+}
+
+// blockingCreateService is a session service whose creations block until
+// released.
+type blockingCreateService struct {
+	session.Service
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingCreateService) Create(ctx context.Context, req *session.CreateRequest) (*session.CreateResponse, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.Service.Create(ctx, req)
+}
+
+func TestCreateSession_Overloaded(t *testing.T) {
+	inner := &blockingCreateService{Service: session.InMemoryService(), entered: make(chan struct{}), release: make(chan struct{})}
+	sessionService := session.ServiceWithConcurrencyLimit(inner, session.ConcurrencyLimitConfig{MaxConcurrent: 1})
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "running"})
+		errc <- err
+	}()
+	<-inner.entered
+	defer func() {
+		close(inner.release)
+		if err := <-errc; err != nil {
+			t.Errorf("Create() error = %v", err)
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/shed", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "shed"})
+	rr := httptest.NewRecorder()
+
+	apiController.CreateSessionHandler(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("create past the concurrency limit returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusServiceUnavailable, rr.Body.String())
+	}
+}
+
+func TestCreateSession_TooManySessions(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		MaxSessions: session.SessionCountLimits{Default: session.SessionCountLimit{MaxPerUser: 1}},
+	})
+	apiController := controllers.NewSessionsAPIController(sessionService)
+
+	for _, tc := range []struct {
+		sessionID string
+		want      int
+	}{
+		{sessionID: "first", want: http.StatusOK},
+		{sessionID: "second", want: http.StatusConflict},
+	} {
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/"+tc.sessionID, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": tc.sessionID})
+		rr := httptest.NewRecorder()
+
+		apiController.CreateSessionHandler(rr, req)
+
+		if rr.Code != tc.want {
+			t.Errorf("create %s returned wrong status code: got %v want %v, body: %s", tc.sessionID, rr.Code, tc.want, rr.Body.String())
+		}
+	}
+}
+
+func TestCreateSession_CreationRate(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		Creation: session.NewCreationLimiter(session.CreationLimits{Default: session.CreationRate{SessionsPerSecond: 0.5, Burst: 1}}),
+	})
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	vars := func(sessionID string) map[string]string {
+		return map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": sessionID}
+	}
+	create := func(sessionID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/"+sessionID, strings.NewReader("{}"))
+		req = mux.SetURLVars(req, vars(sessionID))
+		rr := httptest.NewRecorder()
+		apiController.CreateSessionHandler(rr, req)
+		return rr
+	}
+
+	if rr := create("first"); rr.Code != http.StatusOK {
+		t.Fatalf("create returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	rr := create("second")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("create past the creation rate returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusTooManyRequests, rr.Body.String())
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+
+	// The existing session is still read and patched.
+	req := httptest.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/first", nil)
+	req = mux.SetURLVars(req, vars("first"))
+	rr = httptest.NewRecorder()
+	apiController.GetSessionHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("get returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/first", strings.NewReader(`{"stateDelta": {"k": "v"}}`))
+	req = mux.SetURLVars(req, vars("first"))
+	rr = httptest.NewRecorder()
+	apiController.UpdateSessionHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("patch returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+}
+
+func TestCreateSession_DedupKey(t *testing.T) {
+	sessionService := session.InMemoryService()
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	create := func(userID, sessionID, body string) (int, models.Session) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/"+userID+"/sessions", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		vars := map[string]string{"app_name": "testApp", "user_id": userID}
+		if sessionID != "" {
+			vars["session_id"] = sessionID
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.CreateSessionHandler(rr, req)
+		var got models.Session
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+		}
+		return rr.Code, got
+	}
+
+	status, first := create("testUser", "", `{"dedupKey": "order-1", "state": {"n": 1}}`)
+	if status != http.StatusOK {
+		t.Fatalf("first create returned status %d, want %d", status, http.StatusOK)
+	}
+	if want := models.DedupSessionID("testApp", "testUser", "order-1"); first.ID != want {
+		t.Errorf("first create returned session %q, want %q", first.ID, want)
+	}
+	_, again := create("testUser", "", `{"dedupKey": "order-1", "state": {"n": 2}}`)
+	if again.ID != first.ID {
+		t.Errorf("create with the same key returned session %q, want %q", again.ID, first.ID)
+	}
+	if diff := cmp.Diff(map[string]any{"n": float64(1)}, again.State); diff != "" {
+		t.Errorf("create with the same key changed the state (-want +got):\n%s", diff)
+	}
+	_, other := create("testUser", "", `{"dedupKey": "order-2"}`)
+	if other.ID == first.ID {
+		t.Errorf("create with another key returned the same session %q", other.ID)
+	}
+	_, otherUser := create("otherUser", "", `{"dedupKey": "order-1"}`)
+	if otherUser.ID == first.ID {
+		t.Errorf("create of another user with the same key returned the same session %q", otherUser.ID)
+	}
+	list, err := sessionService.List(t.Context(), &session.ListRequest{AppName: "testApp", UserID: "testUser"})
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if got := len(list.Sessions); got != 2 {
+		t.Errorf("user has %d sessions, want 2", got)
+	}
+	if status, _ := create("testUser", "explicit", `{"dedupKey": "order-1"}`); status != http.StatusBadRequest {
+		t.Errorf("create with a dedup key and a session ID returned status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestGetSessionState(t *testing.T) {
 	id := fakes.SessionKey{
 		AppName:   "testApp",
 		UserID:    "testUser",
 		SessionID: "testSession",
 	}
-	newSessionID := fakes.SessionKey{
-		AppName:   "testApp",
-		UserID:    "testUser",
-		SessionID: "newSession",
+	storedSessions := map[fakes.SessionKey]fakes.TestSession{
+		id: {
+			Id: id,
+			SessionState: fakes.TestState{
+				"user": map[string]any{
+					"prefs": map[string]any{"theme": "dark"},
+					"tags":  []any{"a", map[string]any{"b": "c"}},
+				},
+				"a/b":    "slash",
+				"m~n":    "tilde",
+				"nested": map[string]any{"empty": nil},
+			},
+			SessionEvents: fakes.TestEvents{},
+			UpdatedAt:     time.Now(),
+		},
 	}
-	oldSessionID := fakes.SessionKey{
-		AppName:   "testApp",
-		UserID:    "testUser",
-		SessionID: "oldSession",
+
+	tc := []struct {
+		name       string
+		pointer    string
+		wantValue  any
+		wantStatus int
+	}{
+		{name: "leaf value", pointer: "/user/prefs/theme", wantValue: "dark", wantStatus: http.StatusOK},
+		{name: "object value", pointer: "/user/prefs", wantValue: map[string]any{"theme": "dark"}, wantStatus: http.StatusOK},
+		{name: "array element", pointer: "/user/tags/0", wantValue: "a", wantStatus: http.StatusOK},
+		{name: "into array element", pointer: "/user/tags/1/b", wantValue: "c", wantStatus: http.StatusOK},
+		{name: "escaped slash", pointer: "/a~1b", wantValue: "slash", wantStatus: http.StatusOK},
+		{name: "escaped tilde", pointer: "/m~0n", wantValue: "tilde", wantStatus: http.StatusOK},
+		{name: "null value", pointer: "/nested/empty", wantValue: nil, wantStatus: http.StatusOK},
+		{name: "missing key", pointer: "/user/prefs/font", wantStatus: http.StatusNotFound},
+		{name: "array index out of range", pointer: "/user/tags/2", wantStatus: http.StatusNotFound},
+		{name: "array index with leading zero", pointer: "/user/tags/01", wantStatus: http.StatusNotFound},
+		{name: "non-numeric array index", pointer: "/user/tags/-", wantStatus: http.StatusNotFound},
+		{name: "into scalar", pointer: "/user/prefs/theme/x", wantStatus: http.StatusNotFound},
+		{name: "missing leading slash", pointer: "user", wantStatus: http.StatusBadRequest},
+		{name: "invalid escape", pointer: "/a~2b", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := fakes.FakeSessionService{Sessions: storedSessions}
+			apiController := controllers.NewSessionsAPIController(&sessionService)
+			req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/state", nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req.URL.RawQuery = url.Values{"pointer": {tt.pointer}}.Encode()
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			apiController.GetSessionStateHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got any
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantValue, got); diff != "" {
+				t.Errorf("GetSessionState() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetSession_MaxDepth(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	state := map[string]any{
+		"theme": "dark",
+		"user": map[string]any{
+			"name":    "Ada",
+			"profile": map[string]any{"address": map[string]any{"city": "London"}},
+			"tags":    []any{"a", "b", "c"},
+		},
+	}
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: state}); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}
+	get := func(t *testing.T, maxDepth string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		if maxDepth != "" {
+			req.URL.RawQuery = url.Values{"maxDepth": {maxDepth}}.Encode()
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.GetSessionHandler(rr, req)
+		return rr
+	}
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) models.SessionWithHashes {
+		t.Helper()
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.SessionWithHashes
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return got
+	}
+	placeholder := func(typ string, size int) map[string]any {
+		return map[string]any{models.TruncatedKey: map[string]any{"type": typ, "size": float64(size)}}
 	}
 
+	full := decode(t, get(t, ""))
 	tc := []struct {
-		name           string
-		storedSessions map[fakes.SessionKey]fakes.TestSession
-		wantSessions   []models.Session
-		wantStatus     int
+		name      string
+		maxDepth  string
+		wantState map[string]any
 	}{
 		{
-			name: "session exists",
-			storedSessions: map[fakes.SessionKey]fakes.TestSession{
-				id: {
-					Id:            id,
-					SessionState:  fakes.TestState{"foo": "bar"},
-					SessionEvents: fakes.TestEvents{},
-					UpdatedAt:     time.Now(),
+			name:     "top level only",
+			maxDepth: "1",
+			wantState: map[string]any{
+				"theme": "dark",
+				"user":  placeholder("object", 3),
+			},
+		},
+		{
+			name:     "two levels",
+			maxDepth: "2",
+			wantState: map[string]any{
+				"theme": "dark",
+				"user": map[string]any{
+					"name":    "Ada",
+					"profile": placeholder("object", 1),
+					"tags":    placeholder("array", 3),
 				},
-				newSessionID: {
-					Id:            newSessionID,
-					SessionState:  fakes.TestState{"xyz": "abc"},
-					SessionEvents: fakes.TestEvents{},
-					UpdatedAt:     time.Now(),
+			},
+		},
+		{
+			name:     "deeper than the state",
+			maxDepth: "10",
+			wantState: map[string]any{
+				"theme": "dark",
+				"user": map[string]any{
+					"name":    "Ada",
+					"profile": map[string]any{"address": map[string]any{"city": "London"}},
+					"tags":    []any{"a", "b", "c"},
 				},
-				oldSessionID: {
+			},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decode(t, get(t, tt.maxDepth))
+			if diff := cmp.Diff(tt.wantState, got.State); diff != "" {
+				t.Errorf("GetSession() state mismatch (-want +got):\n%s", diff)
+			}
+			// The hash is the one of the whole state, so that truncation
+			// doesn't look like a change.
+			if got.StateHash != full.StateHash {
+				t.Errorf("StateHash = %q, want the hash of the whole state %q", got.StateHash, full.StateHash)
+			}
+		})
+	}
+
+	for _, maxDepth := range []string{"0", "-1", "two"} {
+		t.Run("invalid "+maxDepth, func(t *testing.T) {
+			if rr := get(t, maxDepth); rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	// A truncated subtree is fetched with the pointer of its placeholder,
+	// itself truncated.
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/state", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.URL.RawQuery = url.Values{"pointer": {"/user/profile"}, "maxDepth": {"1"}}.Encode()
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	apiController.GetSessionStateHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var got any
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if diff := cmp.Diff(map[string]any{"address": placeholder("object", 1)}, got); diff != "" {
+		t.Errorf("GetSessionState() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetSession_MergedState(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	state := map[string]any{
+		"app:theme":    "light",
+		"app:locale":   "en",
+		"app:limit":    10,
+		"user:theme":   "dark",
+		"user:limit":   20,
+		"user:profile": map[string]any{"name": "Ada", "address": map[string]any{"city": "London"}},
+		"limit":        30,
+		"draft":        "hello",
+	}
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: state}); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}
+	get := func(t *testing.T, query url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.URL.RawQuery = query.Encode()
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.GetSessionHandler(rr, req)
+		return rr
+	}
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) models.SessionWithHashes {
+		t.Helper()
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.SessionWithHashes
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return got
+	}
+	wantMerged := map[string]any{
+		"theme":   "dark",
+		"locale":  "en",
+		"limit":   float64(30),
+		"profile": map[string]any{"name": "Ada", "address": map[string]any{"city": "London"}},
+		"draft":   "hello",
+	}
+
+	t.Run("not requested", func(t *testing.T) {
+		got := decode(t, get(t, nil))
+		if got.MergedState != nil || got.StateSources != nil {
+			t.Errorf("got merged state %v with sources %v, want none", got.MergedState, got.StateSources)
+		}
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		got := decode(t, get(t, url.Values{"mergedState": {"true"}}))
+		if diff := cmp.Diff(wantMerged, got.MergedState); diff != "" {
+			t.Errorf("merged state mismatch (-want +got):\n%s", diff)
+		}
+		if got.StateSources != nil {
+			t.Errorf("got state sources %v, want none", got.StateSources)
+		}
+		// The scoped state is returned unchanged, for the writes.
+		if len(got.State) != len(state) || got.State["app:theme"] != "light" {
+			t.Errorf("state = %v, want the scoped state", got.State)
+		}
+	})
+
+	t.Run("merged with sources", func(t *testing.T) {
+		got := decode(t, get(t, url.Values{"mergedState": {"true"}, "stateSources": {"true"}}))
+		if diff := cmp.Diff(wantMerged, got.MergedState); diff != "" {
+			t.Errorf("merged state mismatch (-want +got):\n%s", diff)
+		}
+		wantSources := map[string]string{
+			"theme":   models.StateScopeUser,
+			"locale":  models.StateScopeApp,
+			"limit":   models.StateScopeSession,
+			"profile": models.StateScopeUser,
+			"draft":   models.StateScopeSession,
+		}
+		if diff := cmp.Diff(wantSources, got.StateSources); diff != "" {
+			t.Errorf("state sources mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("merged and truncated", func(t *testing.T) {
+		got := decode(t, get(t, url.Values{"mergedState": {"true"}, "maxDepth": {"1"}}))
+		profile, ok := got.MergedState["profile"].(map[string]any)
+		if !ok || profile[models.TruncatedKey] == nil {
+			t.Errorf("merged profile = %v, want a truncated placeholder", got.MergedState["profile"])
+		}
+	})
+
+	t.Run("sources without merge", func(t *testing.T) {
+		if rr := get(t, url.Values{"stateSources": {"true"}}); rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if rr := get(t, url.Values{"mergedState": {"yes please"}}); rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestListSessions(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+	newSessionID := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "newSession",
+	}
+	oldSessionID := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "oldSession",
+	}
+
+	tc := []struct {
+		name           string
+		storedSessions map[fakes.SessionKey]fakes.TestSession
+		wantSessions   []models.Session
+		wantStatus     int
+	}{
+		{
+			name: "session exists",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"foo": "bar"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+				newSessionID: {
+					Id:            newSessionID,
+					SessionState:  fakes.TestState{"xyz": "abc"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+				oldSessionID: {
 					Id:            oldSessionID,
 					SessionState:  fakes.TestState{},
 					SessionEvents: fakes.TestEvents{},
@@ -405,38 +1338,3762 @@ func TestListSessions(t *testing.T) {
 
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
-			sessionService := fakes.FakeSessionService{Sessions: tt.storedSessions}
-			apiController := controllers.NewSessionsAPIController(&sessionService)
-			req, err := http.NewRequest(http.MethodDelete, "/apps/testApp/users/testUser/sessions/testSession", nil)
+			sessionService := fakes.FakeSessionService{Sessions: tt.storedSessions}
+			apiController := controllers.NewSessionsAPIController(&sessionService)
+			req, err := http.NewRequest(http.MethodDelete, "/apps/testApp/users/testUser/sessions/testSession", nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			// Manually set the URL variables on the request using mux.SetURLVars.
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name": "testApp",
+				"user_id":  "testUser",
+			})
+			rr := httptest.NewRecorder()
+
+			apiController.ListSessionsHandler(rr, req)
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			got := []models.Session{}
+			err = json.NewDecoder(rr.Body).Decode(&got)
+			if err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantSessions, got, EquateApproxInt(int64(time.Second)), cmpopts.SortSlices(func(a, b models.Session) bool {
+				return a.ID < b.ID
+			})); diff != "" {
+				t.Errorf("ListSessions() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateSession(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+
+	tc := []struct {
+		name            string
+		storedSessions  map[fakes.SessionKey]fakes.TestSession
+		sessionID       fakes.SessionKey
+		patchBody       string
+		wantState       map[string]any
+		wantEventCount  int
+		wantStatus      int
+		wantErrContains string
+	}{
+		{
+			name: "patch adds new key and appends event",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"existing": "value"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"newKey": "newValue"}}`,
+			wantState:      map[string]any{"existing": "value", "newKey": "newValue"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch overwrites existing key",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"key": "oldValue"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"key": "newValue"}}`,
+			wantState:      map[string]any{"key": "newValue"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch deletes key with delete directive",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"toDelete": "value", "toKeep": "value"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"toDelete": {"$adk_state_update": "delete"}}}`,
+			wantState:      map[string]any{"toKeep": "value"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch renames key with rename directive",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"old": "value"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "new"}}}`,
+			wantState:      map[string]any{"new": "value"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch renames absent key with ignoreMissing is a no-op",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"key": "value"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "new", "ignoreMissing": true}}}`,
+			wantState:      map[string]any{"key": "value"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch renames absent key returns conflict",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "new"}}}`,
+			wantStatus:      http.StatusConflict,
+			wantErrContains: "state key does not exist",
+		},
+		{
+			name: "patch renames onto existing key returns conflict",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"old": "value", "new": "existing"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "new"}}}`,
+			wantStatus:      http.StatusConflict,
+			wantErrContains: "already exists",
+		},
+		{
+			name: "patch renames onto existing key with overwrite",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"old": "value", "new": "existing"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "new", "overwrite": true}}}`,
+			wantState:      map[string]any{"new": "value"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with rename directive missing target returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"old": "value"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"old": {"$adk_state_update": "rename"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires the "to" field`,
+		},
+		{
+			name: "patch copies key with copy directive",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"working": map[string]any{"step": 1}},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"backup": {"$adk_state_update": "copy", "from": "working"}}}`,
+			wantState:      map[string]any{"working": map[string]any{"step": float64(1)}, "backup": map[string]any{"step": float64(1)}},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch copies absent key returns conflict",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"backup": {"$adk_state_update": "copy", "from": "working"}}}`,
+			wantStatus:      http.StatusConflict,
+			wantErrContains: "state key does not exist",
+		},
+		{
+			name: "patch with copy directive missing source returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"backup": {"$adk_state_update": "copy"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires the "from" field`,
+		},
+		{
+			name: "patch swaps keys with swap directive",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"current": "c", "previous": "p"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"current": {"$adk_state_update": "swap", "with": "previous"}}}`,
+			wantState:      map[string]any{"current": "p", "previous": "c"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with swap directive missing other key returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"current": {"$adk_state_update": "swap"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires the "with" field`,
+		},
+		{
+			name: "patch sets key with setIf directive when predicate holds",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"progress": float64(100)},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"completed": {"$adk_state_update": "setIf", "when": {"key": "progress", "op": "gte", "value": 100}, "value": "done"}}}`,
+			wantState:      map[string]any{"progress": float64(100), "completed": "done"},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with setIf directive is a no-op when predicate fails",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"progress": float64(40)},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"completed": {"$adk_state_update": "setIf", "when": {"key": "progress", "op": "gte", "value": 100}, "value": "done"}}}`,
+			wantState:      map[string]any{"progress": float64(40)},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with setIf directive with unsupported operator returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"progress": float64(100)},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"completed": {"$adk_state_update": "setIf", "when": {"key": "progress", "op": "above", "value": 100}, "value": "done"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `unsupported predicate operator "above"`,
+		},
+		{
+			name: "patch with setIf directive missing value returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"completed": {"$adk_state_update": "setIf", "when": {"key": "progress", "op": "eq"}}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires the "value" field`,
+		},
+		{
+			name: "patch with min directive initializes an absent key",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"latency": {"$adk_state_update": "min", "value": 12.5}}}`,
+			wantState:      map[string]any{"latency": 12.5},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with max directive updates a lower value",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"latency": float64(10)},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"latency": {"$adk_state_update": "max", "value": 30}}}`,
+			wantState:      map[string]any{"latency": float64(30)},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with min directive keeps a lower value",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"latency": float64(10)},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"latency": {"$adk_state_update": "min", "value": 30}}}`,
+			wantState:      map[string]any{"latency": float64(10)},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with max directive on a non-numeric value returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"latency": "slow"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"latency": {"$adk_state_update": "max", "value": 30}}}`,
+			wantStatus:      http.StatusConflict,
+			wantErrContains: "current value must be a number",
+		},
+		{
+			name: "patch with min directive with a non-numeric value returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"latency": {"$adk_state_update": "min", "value": "fast"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires a number "value" field`,
+		},
+		{
+			name: "patch with addUnique directive appends a new element",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"seen": []any{"a"}},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"seen": {"$adk_state_update": "addUnique", "value": "b"}, "fresh": {"$adk_state_update": "addUnique", "value": 1}}}`,
+			wantState:      map[string]any{"seen": []any{"a", "b"}, "fresh": []any{float64(1)}},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with addUnique directive skips a duplicate",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"seen": []any{"a", "b"}},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"seen": {"$adk_state_update": "addUnique", "value": "a"}}}`,
+			wantState:      map[string]any{"seen": []any{"a", "b"}},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with addUnique directive on a non-slice value returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"seen": "a"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"seen": {"$adk_state_update": "addUnique", "value": "b"}}}`,
+			wantStatus:      http.StatusConflict,
+			wantErrContains: "current value must be a slice",
+		},
+		{
+			name: "patch with addUnique directive without a value returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"seen": {"$adk_state_update": "addUnique"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires the "value" field`,
+		},
+		{
+			name: "patch with merge directive merges at a nested path",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"profile": map[string]any{"name": "ada"}},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"profile": {"$adk_state_update": "merge", "path": "/settings/ui", "value": {"theme": "dark"}}}}`,
+			wantState:      map[string]any{"profile": map[string]any{"name": "ada", "settings": map[string]any{"ui": map[string]any{"theme": "dark"}}}},
+			wantEventCount: 1,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name: "patch with merge directive through a non-object returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"profile": map[string]any{"settings": "none"}},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"profile": {"$adk_state_update": "merge", "path": "/settings/ui", "value": {"theme": "dark"}}}}`,
+			wantStatus:      http.StatusConflict,
+			wantErrContains: `value at "/settings" must be an object`,
+		},
+		{
+			name: "patch with merge directive with an invalid path returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"profile": {"$adk_state_update": "merge", "path": "settings", "value": {"theme": "dark"}}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "invalid JSON pointer",
+		},
+		{
+			name: "patch on session with existing events adds one more",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:           id,
+					SessionState: fakes.TestState{"key": "value"},
+					SessionEvents: fakes.TestEvents{
+						{InvocationID: "existing-event"},
+					},
+					UpdatedAt: time.Now(),
+				},
+			},
+			sessionID:      id,
+			patchBody:      `{"stateDelta": {"newKey": "newValue"}}`,
+			wantState:      map[string]any{"key": "value", "newKey": "newValue"},
+			wantEventCount: 2,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name:            "patch on non-existent session returns error",
+			storedSessions:  map[fakes.SessionKey]fakes.TestSession{},
+			sessionID:       id,
+			patchBody:       `{"stateDelta": {"key": "value"}}`,
+			wantStatus:      http.StatusInternalServerError,
+			wantErrContains: "not found",
+		},
+		{
+			name: "patch with missing session_id returns error",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			},
+			sessionID: fakes.SessionKey{
+				AppName: "testApp",
+				UserID:  "testUser",
+			},
+			patchBody:       `{"stateDelta": {"key": "value"}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "session_id parameter is required",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := fakes.FakeSessionService{Sessions: tt.storedSessions}
+			apiController := controllers.NewSessionsAPIController(&sessionService)
+			req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(tt.patchBody))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req = mux.SetURLVars(req, sessionVars(tt.sessionID))
+			rr := httptest.NewRecorder()
+
+			apiController.UpdateSessionHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+
+			if tt.wantErrContains != "" {
+				if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+					t.Errorf("expected error containing %q, got %q", tt.wantErrContains, rr.Body.String())
+				}
+				return
+			}
+
+			// Decode response
+			var got models.Session
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			// Verify state
+			if diff := cmp.Diff(tt.wantState, got.State); diff != "" {
+				t.Errorf("UpdateSession() state mismatch (-want +got):\n%s", diff)
+			}
+
+			// Verify event count
+			if len(got.Events) != tt.wantEventCount {
+				t.Errorf("UpdateSession() event count = %d, want %d", len(got.Events), tt.wantEventCount)
+			}
+
+			// Verify the new event has correct properties (if events were added)
+			if tt.wantEventCount > 0 && len(got.Events) > 0 {
+				lastEvent := got.Events[len(got.Events)-1]
+				// Verify invocation ID starts with "p-" (matching Python behavior)
+				if !strings.HasPrefix(lastEvent.InvocationID, "p-") {
+					t.Errorf("UpdateSession() event invocation_id should start with 'p-', got %q", lastEvent.InvocationID)
+				}
+				// Verify author is "user" (matching Python behavior)
+				if lastEvent.Author != "user" {
+					t.Errorf("UpdateSession() event author should be 'user', got %q", lastEvent.Author)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateSession_DirectiveAliases(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+	aliases := map[string]string{
+		"move":   "rename",
+		"remove": "delete",
+		"delete": "rename",
+		"frob":   "frobnicate",
+	}
+
+	tc := []struct {
+		name            string
+		headers         bool
+		patchBody       string
+		wantState       map[string]any
+		wantStatus      int
+		wantErrContains string
+		wantWarning     string
+	}{
+		{
+			name:        "alias resolves to the canonical directive",
+			patchBody:   `{"stateDelta": {"old": {"$adk_state_update": "move", "to": "new"}}}`,
+			wantState:   map[string]any{"new": "value", "other": "kept"},
+			wantStatus:  http.StatusOK,
+			wantWarning: `state update directive "move" used for key "old" is deprecated, use "rename"`,
+		},
+		{
+			name:        "alias warning surfaced in header",
+			headers:     true,
+			patchBody:   `{"stateDelta": {"other": {"$adk_state_update": "remove"}}}`,
+			wantState:   map[string]any{"old": "value"},
+			wantStatus:  http.StatusOK,
+			wantWarning: `state update directive "remove" used for key "other" is deprecated, use "delete"`,
+		},
+		{
+			name:       "delete built-in can't be aliased",
+			headers:    true,
+			patchBody:  `{"stateDelta": {"other": {"$adk_state_update": "delete"}}}`,
+			wantState:  map[string]any{"old": "value"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "alias of unknown directive",
+			patchBody:       `{"stateDelta": {"old": {"$adk_state_update": "frob"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `is an alias of unknown directive "frobnicate"`,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			sessionService := fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"old": "value", "other": "kept"},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			}}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{
+				DirectiveAliases:   aliases,
+				DeprecationHeaders: tt.headers,
+			})
+			req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(tt.patchBody))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			apiController.UpdateSessionHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantErrContains != "" {
+				if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+					t.Errorf("expected error containing %q, got %q", tt.wantErrContains, rr.Body.String())
+				}
+				return
+			}
+			var got models.Session
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantState, got.State); diff != "" {
+				t.Errorf("UpdateSession() state mismatch (-want +got):\n%s", diff)
+			}
+
+			if tt.wantWarning == "" {
+				if logs.Len() != 0 {
+					t.Errorf("unexpected log output %q", logs.String())
+				}
+				if got := rr.Header().Values("Warning"); len(got) != 0 {
+					t.Errorf("unexpected Warning headers %q", got)
+				}
+				return
+			}
+			if !strings.Contains(logs.String(), tt.wantWarning) {
+				t.Errorf("log output %q, want it to contain %q", logs.String(), tt.wantWarning)
+			}
+			gotHeader := rr.Header().Get("Warning")
+			if tt.headers && !strings.Contains(gotHeader, strings.ReplaceAll(tt.wantWarning, `"`, `\"`)) {
+				t.Errorf("Warning header %q, want it to contain %q", gotHeader, tt.wantWarning)
+			}
+			if !tt.headers && gotHeader != "" {
+				t.Errorf("unexpected Warning header %q", gotHeader)
+			}
+		})
+	}
+}
+
+func TestUpdateSession_UnknownDirectives(t *testing.T) {
+	patchBody := `{"stateDelta": {"counter": {"$adk_state_update": "increment", "by": 2}, "other": "new"}}`
+	tc := []struct {
+		name       string
+		policy     controllers.UnknownDirectivePolicy
+		wantStatus int
+		wantState  map[string]any
+		wantLog    bool
+	}{
+		{
+			name:       "error",
+			policy:     controllers.UnknownDirectiveError,
+			wantStatus: http.StatusBadRequest,
+			wantState:  map[string]any{"counter": 1, "other": "old"},
+		},
+		{
+			name:       "ignore key",
+			policy:     controllers.UnknownDirectiveIgnore,
+			wantStatus: http.StatusOK,
+			wantState:  map[string]any{"counter": 1, "other": "new"},
+			wantLog:    true,
+		},
+		{
+			name:       "set raw value",
+			policy:     controllers.UnknownDirectiveSetRaw,
+			wantStatus: http.StatusOK,
+			wantState:  map[string]any{"counter": map[string]any{"$adk_state_update": "increment", "by": float64(2)}, "other": "new"},
+			wantLog:    true,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			sessionService := session.InMemoryService()
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"counter": 1, "other": "old"}}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{UnknownDirectives: tt.policy})
+			req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(patchBody))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name":   "testApp",
+				"user_id":    "testUser",
+				"session_id": "testSession",
+			})
+			rr := httptest.NewRecorder()
+
+			apiController.UpdateSessionHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK && !strings.Contains(rr.Body.String(), `unknown state update directive "increment"`) {
+				t.Errorf("expected error naming the unknown directive, got %q", rr.Body.String())
+			}
+			resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+			if err != nil {
+				t.Fatalf("get session: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantState, maps.Collect(resp.Session.State().All())); diff != "" {
+				t.Errorf("session state mismatch (-want +got):\n%s", diff)
+			}
+			if gotLog := strings.Contains(logs.String(), `unknown state update directive "increment" used for key "counter"`); gotLog != tt.wantLog {
+				t.Errorf("log output %q, want the unknown directive logged: %v", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestUpdateSession_DryRun(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+	updatedAt := time.Now().Add(-time.Hour)
+	patchBody := `{"stateDelta": {
+		"count": 2,
+		"stale": {"$adk_state_update": "delete"},
+		"old": {"$adk_state_update": "rename", "to": "new"},
+		"added": "value",
+		"completed": {"$adk_state_update": "setIf", "when": {"key": "progress", "op": "gte", "value": 100}, "value": "done"},
+		"temp:scratch": "ignored"
+	}}`
+	wantState := map[string]any{"count": float64(2), "new": "v", "added": "value", "completed": "done", "progress": float64(100)}
+
+	tc := []struct {
+		name       string
+		query      string
+		readOnly   bool
+		wantDiff   *models.StateDiff
+		wantStatus int
+	}{
+		{
+			name:  "dry run with diff",
+			query: "?dryRun=true&diff=true",
+			wantDiff: &models.StateDiff{
+				Added:   map[string]any{"new": "v", "added": "value", "completed": "done"},
+				Removed: map[string]any{"stale": "x", "old": "v"},
+				Changed: map[string]models.ValueChange{"count": {Before: float64(1), After: float64(2)}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "dry run without diff",
+			query:      "?dryRun=true",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "dry run allowed in read-only mode",
+			query:      "?dryRun=1",
+			readOnly:   true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid dryRun",
+			query:      "?dryRun=maybe",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"count": float64(1), "stale": "x", "old": "v", "progress": float64(100)},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     updatedAt,
+				},
+			}}
+			readOnly := &controllers.ReadOnlyMode{}
+			readOnly.SetEnabled(tt.readOnly)
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{ReadOnly: readOnly})
+			req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession"+tt.query, strings.NewReader(patchBody))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			apiController.UpdateSessionHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			// The session is never changed.
+			stored := sessionService.Sessions[id]
+			if len(stored.SessionEvents) != 0 || !stored.UpdatedAt.Equal(updatedAt) {
+				t.Errorf("dry run changed the session: %d events, updated at %v", len(stored.SessionEvents), stored.UpdatedAt)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.StatePreview
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if diff := cmp.Diff(wantState, got.State); diff != "" {
+				t.Errorf("previewed state mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantDiff, got.Diff); diff != "" {
+				t.Errorf("previewed diff mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateSession_Verbose(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+
+	tc := []struct {
+		name         string
+		query        string
+		delta        string
+		wantOutcomes map[string]models.DeltaOutcome
+		wantState    map[string]any
+		wantEvents   int
+	}{
+		{
+			name:  "applied",
+			query: "?verbose=true",
+			delta: `{"count": 2, "old": {"$adk_state_update": "rename", "to": "new"}}`,
+			wantOutcomes: map[string]models.DeltaOutcome{
+				"count": {Outcome: "applied", ChangedKeys: []string{"count"}},
+				"old":   {Outcome: "applied", ChangedKeys: []string{"new", "old"}},
+			},
+			wantState:  map[string]any{"count": float64(2), "new": "v", "progress": float64(50)},
+			wantEvents: 1,
+		},
+		{
+			name:  "no-op",
+			query: "?verbose=true",
+			delta: `{"count": 1, "completed": {"$adk_state_update": "setIf", "when": {"key": "progress", "op": "gte", "value": 100}, "value": "done"}}`,
+			wantOutcomes: map[string]models.DeltaOutcome{
+				"count":     {Outcome: "noop"},
+				"completed": {Outcome: "noop"},
+			},
+			wantState:  map[string]any{"count": float64(1), "old": "v", "progress": float64(50)},
+			wantEvents: 1,
+		},
+		{
+			name:  "mixed",
+			query: "?verbose=true",
+			delta: `{"count": 1, "added": "value", "missing": {"$adk_state_update": "delete"}}`,
+			wantOutcomes: map[string]models.DeltaOutcome{
+				"count":   {Outcome: "noop"},
+				"added":   {Outcome: "applied", ChangedKeys: []string{"added"}},
+				"missing": {Outcome: "noop"},
+			},
+			wantState:  map[string]any{"count": float64(1), "old": "v", "added": "value", "progress": float64(50)},
+			wantEvents: 1,
+		},
+		{
+			name:  "dry run reports failing entries",
+			query: "?dryRun=true&verbose=true",
+			delta: `{"added": "value", "missing": {"$adk_state_update": "rename", "to": "other"}}`,
+			wantOutcomes: map[string]models.DeltaOutcome{
+				"added":   {Outcome: "applied", ChangedKeys: []string{"added"}},
+				"missing": {Outcome: "error"},
+			},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {
+					Id:            id,
+					SessionState:  fakes.TestState{"count": float64(1), "old": "v", "progress": float64(50)},
+					SessionEvents: fakes.TestEvents{},
+					UpdatedAt:     time.Now(),
+				},
+			}}
+			apiController := controllers.NewSessionsAPIController(&sessionService)
+			req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession"+tt.query, strings.NewReader(`{"stateDelta": `+tt.delta+`}`))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			apiController.UpdateSessionHandler(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+			}
+			var gotOutcomes map[string]models.DeltaOutcome
+			var gotState map[string]any
+			if strings.Contains(tt.query, "dryRun") {
+				var got models.StatePreview
+				if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				gotOutcomes, gotState = got.Outcomes, got.State
+			} else {
+				var got models.VerbosePatchResponse
+				if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				gotOutcomes, gotState = got.Outcomes, got.Session.State
+			}
+			// Only whether a failing entry has an error is compared.
+			for key, outcome := range gotOutcomes {
+				if outcome.Outcome == "error" {
+					if outcome.Error == "" {
+						t.Errorf("outcome of %q has no error", key)
+					}
+					outcome.Error = ""
+					gotOutcomes[key] = outcome
+				}
+			}
+			if diff := cmp.Diff(tt.wantOutcomes, gotOutcomes); diff != "" {
+				t.Errorf("outcomes mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantState, gotState); diff != "" {
+				t.Errorf("state mismatch (-want +got):\n%s", diff)
+			}
+			if got := len(sessionService.Sessions[id].SessionEvents); got != tt.wantEvents {
+				t.Errorf("got %d events, want %d", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestUpdateSession_SkipNoopStateDeltas(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	tc := []struct {
+		name  string
+		delta string
+		noop  bool
+	}{
+		{name: "empty delta", delta: `{}`, noop: true},
+		{name: "no-op delta", delta: `{"count": 1, "temp:scratch": "x", "missing": {"$adk_state_update": "delete"}}`, noop: true},
+		{name: "changing delta", delta: `{"count": 2}`},
+	}
+	for _, skip := range []bool{false, true} {
+		for _, tt := range tc {
+			t.Run(fmt.Sprintf("%s skip=%v", tt.name, skip), func(t *testing.T) {
+				sessionService := session.InMemoryService()
+				if _, err := sessionService.Create(t.Context(), &session.CreateRequest{
+					AppName: id.AppName, UserID: id.UserID, SessionID: id.SessionID, State: map[string]any{"count": float64(1)},
+				}); err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+				apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{SkipNoopStateDeltas: skip})
+				getETag := func() string {
+					t.Helper()
+					req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession", nil), sessionVars(id))
+					rr := httptest.NewRecorder()
+					apiController.GetSessionHandler(rr, req)
+					if rr.Code != http.StatusOK {
+						t.Fatalf("get returned wrong status code: got %v, body: %s", rr.Code, rr.Body.String())
+					}
+					return rr.Header().Get("ETag")
+				}
+				before := getETag()
+
+				req := httptest.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(`{"stateDelta": `+tt.delta+`}`))
+				req = mux.SetURLVars(req, sessionVars(id))
+				rr := httptest.NewRecorder()
+				apiController.UpdateSessionHandler(rr, req)
+
+				if rr.Code != http.StatusOK {
+					t.Fatalf("patch returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+				}
+				patched := rr.Header().Get("ETag")
+				if after := getETag(); patched != after {
+					t.Errorf("patch returned ETag %s, the session has %s", patched, after)
+				}
+				if wantUnchanged := skip && tt.noop; (patched == before) != wantUnchanged {
+					t.Errorf("ETag went from %s to %s, want unchanged: %v", before, patched, wantUnchanged)
+				}
+			})
+		}
+	}
+}
+
+func TestStateKeyPolicy(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+	policy := &controllers.StateKeyPolicy{
+		Normalize: func(name string) string { return strings.ReplaceAll(strings.ToLower(name), " ", "_") },
+		Pattern:   regexp.MustCompile(`^[a-z][a-z0-9_]*$`),
+	}
+	nfcKeys := &controllers.StateKeyPolicy{Unicode: controllers.UnicodeNormalizationKeys}
+
+	tc := []struct {
+		name            string
+		policy          *controllers.StateKeyPolicy
+		create          bool
+		append          bool
+		body            string
+		wantState       map[string]any
+		wantStatus      int
+		wantErrContains string
+	}{
+		{
+			name:       "keys are normalized",
+			policy:     policy,
+			body:       `{"stateDelta": {"Mixed Case": 1, "user:Theme": "dark"}}`,
+			wantState:  map[string]any{"old": "v", "mixed_case": float64(1), "user:theme": "dark"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "directive target is normalized",
+			policy:     policy,
+			body:       `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "New Name"}}}`,
+			wantState:  map[string]any{"new_name": "v"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "key not matching the pattern is rejected",
+			policy:          policy,
+			body:            `{"stateDelta": {"bad-key!": 1}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "bad-key!" does not match the pattern`,
+		},
+		{
+			name:            "keys normalizing to the same key are rejected",
+			policy:          policy,
+			body:            `{"stateDelta": {"Key": 1, "key": 2}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state keys normalizing to "key" conflict`,
+		},
+		{
+			name:            "reserved prefix is rejected without policy",
+			body:            `{"stateDelta": {"$adk_internal": 1}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "$adk_internal" uses the reserved $adk_ prefix`,
+		},
+		{
+			name:            "reserved prefix is rejected after a scope prefix",
+			policy:          policy,
+			body:            `{"stateDelta": {"app:$adk_internal": 1}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "app:$adk_internal" uses the reserved $adk_ prefix`,
+		},
+		{
+			name:            "reserved directive target is rejected",
+			body:            `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "$adk_internal"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "$adk_internal" uses the reserved $adk_ prefix`,
+		},
+		{
+			name:            "reserved prefix is rejected in created state",
+			create:          true,
+			body:            `{"state": {"$adk_internal": 1}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "$adk_internal" uses the reserved $adk_ prefix`,
+		},
+		{
+			name:            "reserved prefix is rejected in created events",
+			create:          true,
+			body:            `{"events": [{"author": "user", "actions": {"stateDelta": {"$adk_internal": 1}}}]}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "$adk_internal" uses the reserved $adk_ prefix`,
+		},
+		{
+			name:            "reserved prefix is rejected in appended event",
+			append:          true,
+			body:            `{"author": "user", "actions": {"stateDelta": {"user:$adk_internal": 1}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "user:$adk_internal" uses the reserved $adk_ prefix`,
+		},
+		{
+			name:            "appended event keys are checked against the policy",
+			policy:          policy,
+			append:          true,
+			body:            `{"author": "user", "actions": {"stateDelta": {"bad-key!": 1}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `state key "bad-key!" does not match the pattern`,
+		},
+		{
+			name:       "created state is normalized",
+			policy:     policy,
+			create:     true,
+			body:       `{"state": {"Mixed Case": 1}}`,
+			wantState:  map[string]any{"mixed_case": float64(1)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "decomposed key is kept without unicode normalization",
+			body:       `{"stateDelta": {"cafe\u0301": 1}}`,
+			wantState:  map[string]any{"old": "v", "cafe\u0301": float64(1)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "decomposed key is composed",
+			policy:     nfcKeys,
+			body:       `{"stateDelta": {"user:cafe\u0301": 1}}`,
+			wantState:  map[string]any{"old": "v", "user:caf\u00e9": float64(1)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "composed and decomposed keys conflict",
+			policy:          nfcKeys,
+			body:            `{"stateDelta": {"caf\u00e9": 1, "cafe\u0301": 2}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "state keys normalizing to \"caf\u00e9\" conflict",
+		},
+		{
+			name:       "decomposed directive target is composed",
+			policy:     nfcKeys,
+			body:       `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "cafe\u0301"}}}`,
+			wantState:  map[string]any{"caf\u00e9": "v"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "values are kept when only keys are normalized",
+			policy:     nfcKeys,
+			body:       `{"stateDelta": {"drink": "cafe\u0301"}}`,
+			wantState:  map[string]any{"old": "v", "drink": "cafe\u0301"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "decomposed values are composed",
+			policy:     &controllers.StateKeyPolicy{Unicode: controllers.UnicodeNormalizationKeysAndValues},
+			create:     true,
+			body:       `{"state": {"cafe\u0301": "cafe\u0301", "order": {"items": ["cafe\u0301", 1]}}}`,
+			wantState:  map[string]any{"caf\u00e9": "caf\u00e9", "order": map[string]any{"items": []any{"caf\u00e9", float64(1)}}},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			storedSessions := map[fakes.SessionKey]fakes.TestSession{}
+			if !tt.create {
+				storedSessions[id] = fakes.TestSession{Id: id, SessionState: fakes.TestState{"old": "v"}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()}
+			}
+			sessionService := fakes.FakeSessionService{Sessions: storedSessions}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{StateKeys: tt.policy})
+			method, path := http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession"
+			switch {
+			case tt.create:
+				method = http.MethodPost
+			case tt.append:
+				method, path = http.MethodPost, path+"/events"
+			}
+			req, err := http.NewRequest(method, path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			switch {
+			case tt.create:
+				apiController.CreateSessionHandler(rr, req)
+			case tt.append:
+				apiController.AppendEventHandler(rr, req)
+			default:
+				apiController.UpdateSessionHandler(rr, req)
+			}
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantErrContains != "" {
+				if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+					t.Errorf("expected error containing %q, got %q", tt.wantErrContains, rr.Body.String())
+				}
+				return
+			}
+			var got models.Session
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantState, got.State); diff != "" {
+				t.Errorf("state mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStateKeyAllowlist(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	allowlist := controllers.StateKeyAllowlist{"testApp": {"cart", "old", "user:locale"}}
+
+	tc := []struct {
+		name            string
+		appName         string
+		create          bool
+		append          bool
+		body            string
+		wantStatus      int
+		wantErrContains string
+	}{
+		{name: "allowed keys", body: `{"stateDelta": {"cart": [], "user:locale": "fr"}}`, wantStatus: http.StatusOK},
+		{name: "delete of an allowed key", body: `{"stateDelta": {"old": null}}`, wantStatus: http.StatusOK},
+		{
+			name:            "unlisted key",
+			body:            `{"stateDelta": {"cart": [], "crat": []}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "crat" is not allowed for app "testApp"`,
+		},
+		{
+			name:            "scope prefix is part of the key",
+			body:            `{"stateDelta": {"app:cart": []}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "app:cart" is not allowed`,
+		},
+		{
+			name:            "delete of an unlisted key",
+			body:            `{"stateDelta": {"rogue": null}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "rogue" is not allowed`,
+		},
+		{
+			name:            "delete directive of an unlisted key",
+			body:            `{"stateDelta": {"rogue": {"$adk_state_update": "delete"}}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "rogue" is not allowed`,
+		},
+		{
+			name:            "directive targeting an unlisted key",
+			body:            `{"stateDelta": {"old": {"$adk_state_update": "rename", "to": "rogue"}}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "rogue" is not allowed`,
+		},
+		{
+			name:            "unlisted key in created state",
+			create:          true,
+			body:            `{"state": {"cart": [], "rogue": 1}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "rogue" is not allowed`,
+		},
+		{
+			name:            "unlisted key in created events",
+			create:          true,
+			body:            `{"events": [{"author": "user", "actions": {"stateDelta": {"rogue": 1}}}]}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "rogue" is not allowed`,
+		},
+		{name: "allowed key in appended event", append: true, body: `{"author": "user", "actions": {"stateDelta": {"cart": []}}}`, wantStatus: http.StatusOK},
+		{
+			name:            "unlisted key in appended event",
+			append:          true,
+			body:            `{"author": "user", "actions": {"stateDelta": {"rogue": 1}}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: `state key "rogue" is not allowed`,
+		},
+		{name: "app without allowlist", appName: "otherApp", body: `{"stateDelta": {"rogue": 1}}`, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			key := id
+			if tt.appName != "" {
+				key.AppName = tt.appName
+			}
+			storedSessions := map[fakes.SessionKey]fakes.TestSession{}
+			if !tt.create {
+				storedSessions[key] = fakes.TestSession{Id: key, SessionState: fakes.TestState{"old": "v"}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()}
+			}
+			sessionService := fakes.FakeSessionService{Sessions: storedSessions}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{AllowedStateKeys: allowlist})
+			method, path := http.MethodPatch, "/apps/"+key.AppName+"/users/testUser/sessions/testSession"
+			switch {
+			case tt.create:
+				method = http.MethodPost
+			case tt.append:
+				method, path = http.MethodPost, path+"/events"
+			}
+			req, err := http.NewRequest(method, path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(key))
+			rr := httptest.NewRecorder()
+
+			switch {
+			case tt.create:
+				apiController.CreateSessionHandler(rr, req)
+			case tt.append:
+				apiController.AppendEventHandler(rr, req)
+			default:
+				apiController.UpdateSessionHandler(rr, req)
+			}
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+				t.Errorf("expected body containing %q, got %q", tt.wantErrContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+// nestedState returns a JSON state with the key k nested depth levels deep.
+func nestedState(depth int) string {
+	return `{"k": ` + strings.Repeat(`{"x": `, depth-1) + "1" + strings.Repeat("}", depth-1) + "}"
+}
+
+func TestMaxStateDepth(t *testing.T) {
+	tc := []struct {
+		name       string
+		maxDepth   int
+		method     string
+		path       string
+		handler    func(c *controllers.SessionsAPIController) http.HandlerFunc
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "delta at the limit",
+			maxDepth:   3,
+			method:     http.MethodPatch,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.UpdateSessionHandler },
+			body:       `{"stateDelta": ` + nestedState(3) + `}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delta beyond the limit",
+			maxDepth:   3,
+			method:     http.MethodPatch,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.UpdateSessionHandler },
+			body:       `{"stateDelta": ` + nestedState(4) + `}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty container beyond the limit",
+			maxDepth:   1,
+			method:     http.MethodPatch,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.UpdateSessionHandler },
+			body:       `{"stateDelta": {"k": {}}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "arrays beyond the limit",
+			maxDepth:   3,
+			method:     http.MethodPatch,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.UpdateSessionHandler },
+			body:       `{"stateDelta": {"k": [[[1]]]}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "directive beyond the limit",
+			maxDepth:   3,
+			method:     http.MethodPatch,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.UpdateSessionHandler },
+			body:       `{"stateDelta": {"k": {"$adk_state_update": "merge", "value": {"x": {}}}}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "default limit",
+			method:     http.MethodPatch,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.UpdateSessionHandler },
+			body:       `{"stateDelta": ` + nestedState(controllers.DefaultMaxStateDepth+1) + `}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "created state beyond the limit",
+			maxDepth:   3,
+			method:     http.MethodPost,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.CreateSessionHandler },
+			body:       `{"state": ` + nestedState(4) + `}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "event delta beyond the limit",
+			maxDepth:   3,
+			method:     http.MethodPost,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.AppendEventHandler },
+			body:       `{"author": "user", "actions": {"stateDelta": ` + nestedState(4) + `}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "event delta at the limit",
+			maxDepth:   3,
+			method:     http.MethodPost,
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.AppendEventHandler },
+			body:       `{"author": "user", "actions": {"stateDelta": ` + nestedState(3) + `}}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			sessionID := "testSession"
+			if tt.name == "created state beyond the limit" {
+				sessionID = "newSession"
+			}
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{MaxStateDepth: tt.maxDepth})
+			req, err := http.NewRequest(tt.method, "/apps/testApp/users/testUser/sessions/"+sessionID, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name":   "testApp",
+				"user_id":    "testUser",
+				"session_id": sessionID,
+			})
+			rr := httptest.NewRecorder()
+
+			tt.handler(apiController)(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusBadRequest && !strings.Contains(rr.Body.String(), `state key "k" is nested deeper than`) {
+				t.Errorf("expected error naming the over-deep key, got %q", rr.Body.String())
+			}
+			resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+			if err != nil {
+				t.Fatalf("get session: %v", err)
+			}
+			_, err = resp.Session.State().Get("k")
+			if stored := err == nil; stored != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("state key stored = %v, want %v", stored, tt.wantStatus == http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestMaxStateKeys(t *testing.T) {
+	tc := []struct {
+		name       string
+		state      map[string]any
+		query      string
+		body       string
+		wantStatus int
+		wantKeys   int
+	}{
+		{
+			name:       "growth to the limit",
+			state:      map[string]any{"a": 1, "b": 2},
+			body:       `{"stateDelta": {"c": 3}}`,
+			wantStatus: http.StatusOK,
+			wantKeys:   3,
+		},
+		{
+			name:       "growth past the limit",
+			state:      map[string]any{"a": 1, "b": 2},
+			body:       `{"stateDelta": {"c": 3, "d": 4}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   2,
+		},
+		{
+			name:       "dry run past the limit",
+			state:      map[string]any{"a": 1, "b": 2},
+			query:      "?dryRun=true",
+			body:       `{"stateDelta": {"c": 3, "d": 4}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   2,
+		},
+		{
+			name:       "additions offset by removals",
+			state:      map[string]any{"a": 1, "b": 2, "c": 3},
+			body:       `{"stateDelta": {"a": {"$adk_state_update": "delete"}, "d": 4}}`,
+			wantStatus: http.StatusOK,
+			wantKeys:   3,
+		},
+		{
+			name:       "updates of existing keys",
+			state:      map[string]any{"a": 1, "b": 2, "c": 3},
+			body:       `{"stateDelta": {"a": 10, "b": 20}}`,
+			wantStatus: http.StatusOK,
+			wantKeys:   3,
+		},
+		{
+			name:       "temporary keys not counted",
+			state:      map[string]any{"a": 1, "b": 2, "c": 3},
+			body:       `{"stateDelta": {"temp:scratch": 1}}`,
+			wantStatus: http.StatusOK,
+			wantKeys:   3,
+		},
+		{
+			name:       "shrinking a state past the limit",
+			state:      map[string]any{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5},
+			body:       `{"stateDelta": {"a": {"$adk_state_update": "delete"}}}`,
+			wantStatus: http.StatusOK,
+			wantKeys:   4,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: tt.state}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{MaxStateKeys: 3})
+			req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession"+tt.query, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}))
+			rr := httptest.NewRecorder()
+
+			apiController.UpdateSessionHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnprocessableEntity && !strings.Contains(rr.Body.String(), "past the limit of 3") {
+				t.Errorf("expected error naming the limit, got %q", rr.Body.String())
+			}
+			resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+			if err != nil {
+				t.Fatalf("get session: %v", err)
+			}
+			if got := len(maps.Collect(resp.Session.State().All())); got != tt.wantKeys {
+				t.Errorf("stored state has %d keys, want %d", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestMaxStateKeys_AppendWithStateAndTransact(t *testing.T) {
+	tc := []struct {
+		name       string
+		handler    func(c *controllers.SessionsAPIController) http.HandlerFunc
+		body       string
+		wantStatus int
+		wantKeys   int
+	}{
+		{
+			name:       "append with state to the limit",
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.AppendEventWithStateHandler },
+			body:       `{"stateDelta": {"c": 3}, "event": {"author": "user"}}`,
+			wantStatus: http.StatusOK,
+			wantKeys:   3,
+		},
+		{
+			name:       "append with state past the limit",
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.AppendEventWithStateHandler },
+			body:       `{"stateDelta": {"c": 3, "d": 4}, "event": {"author": "user"}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   2,
+		},
+		{
+			name:       "transaction to the limit",
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.TransactSessionsHandler },
+			body:       `{"stateDeltas": {"testSession": {"c": 3}}}`,
+			wantStatus: http.StatusOK,
+			wantKeys:   3,
+		},
+		{
+			name:       "transaction past the limit",
+			handler:    func(c *controllers.SessionsAPIController) http.HandlerFunc { return c.TransactSessionsHandler },
+			body:       `{"stateDeltas": {"testSession": {"c": 3, "d": 4}}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   2,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"a": 1, "b": 2}}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{MaxStateKeys: 3})
+			req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}))
+			rr := httptest.NewRecorder()
+
+			tt.handler(apiController)(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnprocessableEntity && !strings.Contains(rr.Body.String(), "past the limit of 3") {
+				t.Errorf("expected error naming the limit, got %q", rr.Body.String())
+			}
+			resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+			if err != nil {
+				t.Fatalf("get session: %v", err)
+			}
+			if got := len(maps.Collect(resp.Session.State().All())); got != tt.wantKeys {
+				t.Errorf("stored state has %d keys, want %d", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestMaxStateKeys_SharedKeysAndServiceLimit(t *testing.T) {
+	newSessions := func(t *testing.T, sessionService session.Service) {
+		t.Helper()
+		for _, id := range []string{"s1", "s2"} {
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: id, State: map[string]any{"a": 1, "b": 2}}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+		}
+	}
+	transact := func(t *testing.T, apiController *controllers.SessionsAPIController) *httptest.ResponseRecorder {
+		t.Helper()
+		body := `{"stateDeltas": {"s1": {"user:x": 1}, "s2": {"user:y": 2}}}`
+		req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser"})
+		rr := httptest.NewRecorder()
+		apiController.TransactSessionsHandler(rr, req)
+		return rr
+	}
+
+	// Each delta alone keeps its session to the limit, the user key of the
+	// first one grows the second session past it.
+	sessionService := session.InMemoryService()
+	newSessions(t, sessionService)
+	rr := transact(t, controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{MaxStateKeys: 3}))
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), `session "s2"`) {
+		t.Errorf("transaction growing a shared key count returned %v %q, want %v naming s2", rr.Code, rr.Body.String(), http.StatusUnprocessableEntity)
+	}
+
+	// The limit of the service is enforced with the writes, and reported
+	// with 422 too.
+	sessionService = session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{MaxStateKeys: session.StateKeyLimits{Default: 3}})
+	newSessions(t, sessionService)
+	rr = transact(t, controllers.NewSessionsAPIController(sessionService))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("transaction past the limit of the service returned %v %q, want %v", rr.Code, rr.Body.String(), http.StatusUnprocessableEntity)
+	}
+	resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if got := len(maps.Collect(resp.Session.State().All())); got != 2 {
+		t.Errorf("stored state of s1 has %d keys after the aborted transaction, want 2", got)
+	}
+}
+
+func TestStateCoercion(t *testing.T) {
+	coercion := controllers.StateCoercion{"testApp": {
+		"count":    controllers.StateInteger,
+		"fraction": controllers.StateInteger,
+		"ratio":    controllers.StateNumber,
+		"flag":     controllers.StateBoolean,
+		"off":      controllers.StateBoolean,
+		"bad":      controllers.StateNumber,
+	}}
+	tc := []struct {
+		name       string
+		appName    string
+		createBody string
+		patchBody  string
+		wantState  map[string]any
+	}{
+		{
+			name:      "coerces typed keys",
+			appName:   "testApp",
+			patchBody: `{"stateDelta": {"count": "42", "fraction": "4.5", "ratio": " 0.25 ", "flag": "TRUE", "off": "false", "bad": "x4", "other": "7"}}`,
+			wantState: map[string]any{"count": float64(42), "fraction": "4.5", "ratio": 0.25, "flag": true, "off": false, "bad": "x4", "other": "7"},
+		},
+		{
+			name:      "keeps typed values",
+			appName:   "testApp",
+			patchBody: `{"stateDelta": {"count": 3, "flag": false}}`,
+			wantState: map[string]any{"count": float64(3), "flag": false},
+		},
+		{
+			name:       "coerces created state for numeric directives",
+			appName:    "testApp",
+			createBody: `{"state": {"count": "40"}}`,
+			patchBody:  `{"stateDelta": {"count": {"$adk_state_update": "max", "value": 42}}}`,
+			wantState:  map[string]any{"count": float64(42)},
+		},
+		{
+			name:      "other apps untouched",
+			appName:   "otherApp",
+			patchBody: `{"stateDelta": {"count": "42", "flag": "true"}}`,
+			wantState: map[string]any{"count": "42", "flag": "true"},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{StateCoercion: coercion})
+			vars := map[string]string{"app_name": tt.appName, "user_id": "testUser", "session_id": "testSession"}
+			createBody := tt.createBody
+			if createBody == "" {
+				createBody = `{}`
+			}
+			for _, step := range []struct {
+				method  string
+				body    string
+				handler http.HandlerFunc
+			}{
+				{http.MethodPost, createBody, apiController.CreateSessionHandler},
+				{http.MethodPatch, tt.patchBody, apiController.UpdateSessionHandler},
+			} {
+				req, err := http.NewRequest(step.method, "/apps/"+tt.appName+"/users/testUser/sessions/testSession", strings.NewReader(step.body))
+				if err != nil {
+					t.Fatalf("new request: %v", err)
+				}
+				req = mux.SetURLVars(req, vars)
+				rr := httptest.NewRecorder()
+
+				step.handler(rr, req)
+
+				if status := rr.Code; status != http.StatusOK {
+					t.Fatalf("%s returned wrong status code: got %v want %v, body: %s", step.method, status, http.StatusOK, rr.Body.String())
+				}
+			}
+			resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: tt.appName, UserID: "testUser", SessionID: "testSession"})
+			if err != nil {
+				t.Fatalf("get session: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantState, maps.Collect(resp.Session.State().All())); diff != "" {
+				t.Errorf("state mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAppendEvent(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+
+	tc := []struct {
+		name           string
+		storedSessions map[fakes.SessionKey]fakes.TestSession
+		body           string
+		wantStatus     int
+		wantEventCount int
+	}{
+		{
+			name: "appends event to existing session",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {Id: id, SessionState: fakes.TestState{}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()},
+			},
+			body:           `{"author": "user", "content": {"role": "user", "parts": [{"text": "hi"}]}}`,
+			wantStatus:     http.StatusOK,
+			wantEventCount: 1,
+		},
+		{
+			name:           "session does not exist",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{},
+			body:           `{"author": "user"}`,
+			wantStatus:     http.StatusInternalServerError,
+		},
+		{
+			name: "malformed body",
+			storedSessions: map[fakes.SessionKey]fakes.TestSession{
+				id: {Id: id, SessionState: fakes.TestState{}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()},
+			},
+			body:       `{"author": `,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := fakes.FakeSessionService{Sessions: tt.storedSessions}
+			apiController := controllers.NewSessionsAPIController(&sessionService)
+			req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			apiController.AppendEventHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.Event
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.ID == "" || got.Time == 0 {
+				t.Errorf("AppendEvent() event ID and time should be assigned, got %+v", got)
+			}
+			if n := len(sessionService.Sessions[id].SessionEvents); n != tt.wantEventCount {
+				t.Errorf("AppendEvent() event count = %d, want %d", n, tt.wantEventCount)
+			}
+		})
+	}
+}
+
+func TestAppendEvent_Replay(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{ReplayWindow: time.Minute})
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{ReadYourWrites: controllers.ReadYourWrites{Timeout: time.Second}})
+	appendEvent := func() (models.Event, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(`{"author": "user", "content": {"role": "user", "parts": [{"text": "hi"}]}}`))
+		req = mux.SetURLVars(req, sessionVars(fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}))
+		rr := httptest.NewRecorder()
+		apiController.AppendEventHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.Event
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return got, rr.Header().Get(controllers.SessionVersionHeader)
+	}
+
+	first, firstVersion := appendEvent()
+	retry, retryVersion := appendEvent()
+	if retry.ID != first.ID || retry.Sequence != first.Sequence || retry.Sequence == 0 {
+		t.Errorf("retry returned event %q with sequence %d, want the stored event %q with sequence %d", retry.ID, retry.Sequence, first.ID, first.Sequence)
+	}
+	if retryVersion != firstVersion || retryVersion == "" {
+		t.Errorf("retry returned version %q, want %q", retryVersion, firstVersion)
+	}
+}
+
+func TestAppendEvent_ContentLimits(t *testing.T) {
+	tc := []struct {
+		name       string
+		mode       session.ContentLimitMode
+		text       string
+		wantStatus int
+		wantParts  []string
+	}{
+		{name: "reject at the limit", mode: session.ContentLimitReject, text: "12345", wantStatus: http.StatusOK, wantParts: []string{"12345"}},
+		{name: "reject above the limit", mode: session.ContentLimitReject, text: "123456", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "truncate at the limit", mode: session.ContentLimitTruncate, text: "12345", wantStatus: http.StatusOK, wantParts: []string{"12345"}},
+		{name: "truncate above the limit", mode: session.ContentLimitTruncate, text: "123456", wantStatus: http.StatusOK, wantParts: []string{"12345", "[content truncated: 5 of 6 bytes kept]"}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+				ContentLimits: session.ContentLimits{
+					Apps: map[string]session.ContentLimit{"testApp": {MaxBytes: 5, Mode: tt.mode}},
+				},
+			})
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			apiController := controllers.NewSessionsAPIController(sessionService)
+			body := fmt.Sprintf(`{"author": "user", "content": {"role": "user", "parts": [{"text": %q}]}}`, tt.text)
+			req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name":   "testApp",
+				"user_id":    "testUser",
+				"session_id": "testSession",
+			})
+			rr := httptest.NewRecorder()
+
+			apiController.AppendEventHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.Event
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			var gotParts []string
+			for _, part := range got.Content.Parts {
+				gotParts = append(gotParts, part.Text)
+			}
+			if diff := cmp.Diff(tt.wantParts, gotParts); diff != "" {
+				t.Errorf("AppendEvent() content mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAppendEvent_SessionFull(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		MaxEvents: session.EventCountLimits{Default: 1},
+	})
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+
+	for i, wantStatus := range []int{http.StatusOK, http.StatusConflict} {
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(`{"author": "user"}`))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{
+			"app_name":   "testApp",
+			"user_id":    "testUser",
+			"session_id": "testSession",
+		})
+		rr := httptest.NewRecorder()
+
+		apiController.AppendEventHandler(rr, req)
+
+		if status := rr.Code; status != wantStatus {
+			t.Fatalf("append %d: handler returned wrong status code: got %v want %v, body: %s", i, status, wantStatus, rr.Body.String())
+		}
+		if wantStatus == http.StatusConflict && !strings.Contains(rr.Body.String(), "session is full") {
+			t.Errorf("append %d: body = %q, want a session full error", i, rr.Body.String())
+		}
+	}
+}
+
+func TestAppendEvent_UserEventsExceeded(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		MaxUserEvents: session.UserEventLimits{Default: 2},
+	})
+	for _, sessionID := range []string{"s1", "s2"} {
+		if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: sessionID}); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+
+	appends := []struct {
+		sessionID  string
+		wantStatus int
+	}{
+		{sessionID: "s1", wantStatus: http.StatusOK},
+		{sessionID: "s2", wantStatus: http.StatusOK},
+		{sessionID: "s1", wantStatus: http.StatusTooManyRequests},
+		{sessionID: "s2", wantStatus: http.StatusTooManyRequests},
+	}
+	for i, a := range appends {
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/"+a.sessionID+"/events", strings.NewReader(`{"author": "user"}`))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{
+			"app_name":   "testApp",
+			"user_id":    "testUser",
+			"session_id": a.sessionID,
+		})
+		rr := httptest.NewRecorder()
+
+		apiController.AppendEventHandler(rr, req)
+
+		if status := rr.Code; status != a.wantStatus {
+			t.Fatalf("append %d: handler returned wrong status code: got %v want %v, body: %s", i, status, a.wantStatus, rr.Body.String())
+		}
+		if a.wantStatus == http.StatusTooManyRequests && !strings.Contains(rr.Body.String(), "user event quota exceeded") {
+			t.Errorf("append %d: body = %q, want a user event quota error", i, rr.Body.String())
+		}
+	}
+}
+
+func TestAppendEvent_Interceptor(t *testing.T) {
+	// The interceptor rejects the events of the "blocked" author, and
+	// replaces the text of the others.
+	interceptor := func(ctx context.Context, appName, userID, sessionID string, event *session.Event) (*session.Event, error) {
+		if event.Author == "blocked" {
+			return nil, fmt.Errorf("author %q is blocked", event.Author)
+		}
+		event.Content = genai.NewContentFromText("[redacted]", genai.RoleUser)
+		return event, nil
+	}
+	sessionService := session.ServiceWithAppendInterceptor(session.InMemoryService(), interceptor)
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+
+	tests := []struct {
+		author     string
+		wantStatus int
+	}{
+		{author: "blocked", wantStatus: http.StatusUnprocessableEntity},
+		{author: "user", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		body := fmt.Sprintf(`{"author": %q, "content": {"role": "user", "parts": [{"text": "password: hunter2"}]}}`, tt.author)
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{
+			"app_name":   "testApp",
+			"user_id":    "testUser",
+			"session_id": "testSession",
+		})
+		rr := httptest.NewRecorder()
+
+		apiController.AppendEventHandler(rr, req)
+
+		if status := rr.Code; status != tt.wantStatus {
+			t.Fatalf("append by %s: handler returned wrong status code: got %v want %v, body: %s", tt.author, status, tt.wantStatus, rr.Body.String())
+		}
+	}
+
+	got, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	var texts []string
+	for event := range got.Session.Events().All() {
+		texts = append(texts, event.Content.Parts[0].Text)
+	}
+	if diff := cmp.Diff([]string{"[redacted]"}, texts); diff != "" {
+		t.Errorf("stored events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAppendEvent_IngestionRateExceeded(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		Ingestion: session.NewIngestionLimiter(session.IngestionLimits{
+			Default: session.IngestionRate{EventsPerSecond: 0.01, Burst: 2},
+		}),
+	})
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+
+	for i, wantStatus := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(`{"author": "user"}`))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{
+			"app_name":   "testApp",
+			"user_id":    "testUser",
+			"session_id": "testSession",
+		})
+		rr := httptest.NewRecorder()
+
+		apiController.AppendEventHandler(rr, req)
+
+		if status := rr.Code; status != wantStatus {
+			t.Fatalf("append %d: handler returned wrong status code: got %v want %v, body: %s", i, status, wantStatus, rr.Body.String())
+		}
+	}
+}
+
+func TestAllowedAuthors(t *testing.T) {
+	allowlist := controllers.AuthorAllowlist{"testApp": {"agent", "user"}}
+
+	tc := []struct {
+		name       string
+		appName    string
+		create     bool
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "append with allowed author",
+			appName:    "testApp",
+			body:       `{"author": "agent"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "append with unknown author",
+			appName:    "testApp",
+			body:       `{"author": "impostor"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "append with empty author",
+			appName:    "testApp",
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "append to app without allowlist",
+			appName:    "otherApp",
+			body:       `{"author": "impostor"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create with allowed authors",
+			appName:    "testApp",
+			create:     true,
+			body:       `{"events": [{"author": "user", "time": 1700000000}, {"author": "agent", "time": 1700000001}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create with one unknown author",
+			appName:    "testApp",
+			create:     true,
+			body:       `{"events": [{"author": "user", "time": 1700000000}, {"author": "impostor", "time": 1700000001}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			id := fakes.SessionKey{AppName: tt.appName, UserID: "testUser", SessionID: "testSession"}
+			storedSessions := map[fakes.SessionKey]fakes.TestSession{}
+			if !tt.create {
+				storedSessions[id] = fakes.TestSession{Id: id, SessionState: fakes.TestState{}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()}
+			}
+			sessionService := fakes.FakeSessionService{Sessions: storedSessions}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{AllowedAuthors: allowlist})
+			target := "/apps/" + tt.appName + "/users/testUser/sessions/testSession"
+			if !tt.create {
+				target += "/events"
+			}
+			req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			if tt.create {
+				apiController.CreateSessionHandler(rr, req)
+			} else {
+				apiController.AppendEventHandler(rr, req)
+			}
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				return
+			}
+			// Rejected events are not persisted.
+			stored, ok := sessionService.Sessions[id]
+			if tt.create && ok {
+				t.Errorf("session created despite the rejected event")
+			}
+			if !tt.create && len(stored.SessionEvents) != 0 {
+				t.Errorf("got %d stored events, want none", len(stored.SessionEvents))
+			}
+		})
+	}
+}
+
+func TestEventSchemas(t *testing.T) {
+	schemas := controllers.EventSchemas{
+		"testApp": {
+			Type:     "object",
+			Required: []string{"author", "content"},
+			Properties: map[string]*jsonschema.Schema{
+				"author": {Type: "string", Enum: []any{"agent", "user"}},
+				"content": {
+					Type:     "object",
+					Required: []string{"parts"},
+					Properties: map[string]*jsonschema.Schema{
+						"parts": {Type: "array", MinItems: jsonschema.Ptr(1)},
+					},
+				},
+			},
+		},
+		"brokenApp": {Type: "object", Pattern: "("},
+	}
+
+	tc := []struct {
+		name            string
+		appName         string
+		create          bool
+		body            string
+		wantStatus      int
+		wantErrContains string
+	}{
+		{
+			name:       "append conforming event",
+			appName:    "testApp",
+			body:       `{"author": "agent", "content": {"parts": [{"text": "hi"}]}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "append event missing a required field",
+			appName:         "testApp",
+			body:            `{"author": "agent"}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: "content",
+		},
+		{
+			name:            "append event with nonconforming content",
+			appName:         "testApp",
+			body:            `{"author": "agent", "content": {"parts": []}}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: "does not conform to the event schema",
+		},
+		{
+			name:       "append to app without schema",
+			appName:    "otherApp",
+			body:       `{"author": "anyone"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "append to app with invalid schema",
+			appName:         "brokenApp",
+			body:            `{"author": "agent"}`,
+			wantStatus:      http.StatusInternalServerError,
+			wantErrContains: "invalid event schema",
+		},
+		{
+			name:       "create with conforming events",
+			appName:    "testApp",
+			create:     true,
+			body:       `{"events": [{"author": "user", "time": 1700000000, "content": {"parts": [{"text": "hi"}]}}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "create with one nonconforming event",
+			appName:         "testApp",
+			create:          true,
+			body:            `{"events": [{"author": "user", "time": 1700000000, "content": {"parts": [{"text": "hi"}]}}, {"author": "robot", "time": 1700000001, "content": {"parts": [{"text": "hi"}]}}]}`,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantErrContains: "event 1 does not conform",
+		},
+		{
+			name:       "create without events",
+			appName:    "testApp",
+			create:     true,
+			body:       `{"state": {"k": "v"}}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			id := fakes.SessionKey{AppName: tt.appName, UserID: "testUser", SessionID: "testSession"}
+			storedSessions := map[fakes.SessionKey]fakes.TestSession{}
+			if !tt.create {
+				storedSessions[id] = fakes.TestSession{Id: id, SessionState: fakes.TestState{}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()}
+			}
+			sessionService := fakes.FakeSessionService{Sessions: storedSessions}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{EventSchemas: schemas})
+			target := "/apps/" + tt.appName + "/users/testUser/sessions/testSession"
+			if !tt.create {
+				target += "/events"
+			}
+			req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
+
+			if tt.create {
+				apiController.CreateSessionHandler(rr, req)
+			} else {
+				apiController.AppendEventHandler(rr, req)
+			}
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				return
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+				t.Errorf("response body %q does not contain %q", rr.Body.String(), tt.wantErrContains)
+			}
+			// Rejected events are not persisted.
+			stored, ok := sessionService.Sessions[id]
+			if tt.create && ok {
+				t.Errorf("session created despite the rejected event")
+			}
+			if !tt.create && len(stored.SessionEvents) != 0 {
+				t.Errorf("got %d stored events, want none", len(stored.SessionEvents))
+			}
+		})
+	}
+}
+
+func TestAppendEventWithState(t *testing.T) {
+	tc := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantState  map[string]any
+		wantEvents []string
+	}{
+		{
+			name:       "applies delta and appends event",
+			body:       `{"stateDelta": {"step": 2, "draft": {"$adk_state_update": "delete"}}, "event": {"author": "agent", "content": {"role": "model", "parts": [{"text": "done"}]}}}`,
+			wantStatus: http.StatusOK,
+			wantState:  map[string]any{"step": float64(2)},
+			wantEvents: []string{"user", "agent"},
+		},
+		{
+			name:       "invalid delta leaves session unchanged",
+			body:       `{"stateDelta": {"step": {"$adk_state_update": "unknown"}}, "event": {"author": "agent"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantState:  map[string]any{"step": 1, "draft": "text"},
+		},
+		{
+			name:       "disallowed author leaves session unchanged",
+			body:       `{"stateDelta": {"step": 2}, "event": {"author": "intruder"}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantState:  map[string]any{"step": 1, "draft": "text"},
+		},
+		{
+			name:       "event rejected by the service leaves session unchanged",
+			body:       `{"stateDelta": {"step": 2}, "event": {"author": "agent", "content": {"role": "model", "parts": [{"text": "far too long"}]}}}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantState:  map[string]any{"step": 1, "draft": "text"},
+		},
+		{
+			name:       "missing event",
+			body:       `{"stateDelta": {"step": 2}}`,
+			wantStatus: http.StatusBadRequest,
+			wantState:  map[string]any{"step": 1, "draft": "text"},
+		},
+		{
+			name:       "empty delta",
+			body:       `{"stateDelta": {}, "event": {"author": "agent"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantState:  map[string]any{"step": 1, "draft": "text"},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+				ContentLimits: session.ContentLimits{Default: session.ContentLimit{MaxBytes: 5}},
+			})
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"step": 1, "draft": "text"}}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+				AllowedAuthors: controllers.AuthorAllowlist{"testApp": {"user", "agent"}},
+			})
+			req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events:withState", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name":   "testApp",
+				"user_id":    "testUser",
+				"session_id": "testSession",
+			})
+			rr := httptest.NewRecorder()
+
+			apiController.AppendEventWithStateHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+			if err != nil {
+				t.Fatalf("get session: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantState, maps.Collect(resp.Session.State().All())); diff != "" {
+				t.Errorf("session state mismatch (-want +got):\n%s", diff)
+			}
+			var gotEvents []string
+			for event := range resp.Session.Events().All() {
+				gotEvents = append(gotEvents, event.Author)
+			}
+			if diff := cmp.Diff(tt.wantEvents, gotEvents); diff != "" {
+				t.Errorf("session event authors mismatch (-want +got):\n%s", diff)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.AppendEventWithStateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.Event.ID == "" || got.Event.Author != "agent" {
+				t.Errorf("response event = %+v, want the appended agent event with an ID", got.Event)
+			}
+			if diff := cmp.Diff(tt.wantState, got.Session.State); diff != "" {
+				t.Errorf("response session state mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTransactSessions(t *testing.T) {
+	tc := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFrom   map[string]any
+		wantTo     map[string]any
+	}{
+		{
+			name:       "moves value between sessions",
+			body:       `{"stateDeltas": {"from": {"coin": {"$adk_state_update": "delete"}}, "to": {"coin": 1}}}`,
+			wantStatus: http.StatusOK,
+			wantFrom:   map[string]any{},
+			wantTo:     map[string]any{"coin": float64(1)},
+		},
+		{
+			name:       "invalid second delta leaves both sessions unchanged",
+			body:       `{"stateDeltas": {"from": {"coin": {"$adk_state_update": "delete"}}, "to": {"coin": {"$adk_state_update": "unknown"}}}}`,
+			wantStatus: http.StatusBadRequest,
+			wantFrom:   map[string]any{"coin": 1},
+			wantTo:     map[string]any{},
+		},
+		{
+			name:       "second delta failing against the state leaves both sessions unchanged",
+			body:       `{"stateDeltas": {"from": {"coin": {"$adk_state_update": "delete"}}, "to": {"coin": {"$adk_state_update": "rename", "to": "gem"}}}}`,
+			wantStatus: http.StatusConflict,
+			wantFrom:   map[string]any{"coin": 1},
+			wantTo:     map[string]any{},
+		},
+		{
+			name:       "missing session leaves other sessions unchanged",
+			body:       `{"stateDeltas": {"from": {"coin": {"$adk_state_update": "delete"}}, "missing": {"coin": 1}}}`,
+			wantStatus: http.StatusNotFound,
+			wantFrom:   map[string]any{"coin": 1},
+			wantTo:     map[string]any{},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			for id, state := range map[string]map[string]any{"from": {"coin": 1}, "to": nil} {
+				if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: id, State: state}); err != nil {
+					t.Fatalf("create session: %v", err)
+				}
+			}
+			apiController := controllers.NewSessionsAPIController(sessionService)
+			req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/transactions", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name": "testApp",
+				"user_id":  "testUser",
+			})
+			rr := httptest.NewRecorder()
+
+			apiController.TransactSessionsHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			for id, want := range map[string]map[string]any{"from": tt.wantFrom, "to": tt.wantTo} {
+				resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: id})
+				if err != nil {
+					t.Fatalf("get session: %v", err)
+				}
+				got := maps.Collect(resp.Session.State().All())
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("session %q state mismatch (-want +got):\n%s", id, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestListSessions_Paginated(t *testing.T) {
+	sessionService := session.InMemoryService()
+	for _, id := range []string{"s1", "s2", "s3", "s4", "s5"} {
+		if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: id}); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+
+	type page struct {
+		ids           []string
+		hasNext       bool
+		wantTotalSize int
+	}
+	wantPages := []page{
+		{ids: []string{"s1", "s2"}, hasNext: true, wantTotalSize: 5},
+		{ids: []string{"s3", "s4"}, hasNext: true, wantTotalSize: 5},
+		{ids: []string{"s5"}, hasNext: false, wantTotalSize: 5},
+	}
+	pageToken := ""
+	for i, want := range wantPages {
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions?pageSize=2&pageToken="+pageToken, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{
+			"app_name": "testApp",
+			"user_id":  "testUser",
+		})
+		rr := httptest.NewRecorder()
+
+		apiController.ListSessionsHandler(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("page %d: handler returned wrong status code: got %v want %v, body: %s", i, status, http.StatusOK, rr.Body.String())
+		}
+		var got models.Page[models.Session]
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("page %d: decode response: %v", i, err)
+		}
+		var gotIDs []string
+		for _, s := range got.Items {
+			gotIDs = append(gotIDs, s.ID)
+		}
+		if diff := cmp.Diff(want.ids, gotIDs); diff != "" {
+			t.Errorf("page %d: items mismatch (-want +got):\n%s", i, diff)
+		}
+		if got.TotalSize == nil || *got.TotalSize != want.wantTotalSize {
+			t.Errorf("page %d: totalSize = %v, want %d", i, got.TotalSize, want.wantTotalSize)
+		}
+		if hasNext := got.NextPageToken != ""; hasNext != want.hasNext {
+			t.Errorf("page %d: nextPageToken = %q, want present: %v", i, got.NextPageToken, want.hasNext)
+		}
+		pageToken = got.NextPageToken
+	}
+}
+
+func TestPageSizes(t *testing.T) {
+	sessionService := session.InMemoryService()
+	for _, id := range []string{"s1", "s2", "s3", "s4", "s5"} {
+		created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: id})
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		if id != "s1" {
+			continue
+		}
+		for range 5 {
+			event := session.NewEvent("invocation")
+			event.Author = "user"
+			if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+				t.Fatalf("append event: %v", err)
+			}
+		}
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{
+		PageSizes: controllers.PageSizes{Default: 2, Max: 3},
+	})
+	tc := []struct {
+		name         string
+		events       bool
+		query        string
+		wantItems    int
+		wantPageSize int
+	}{
+		{name: "omitted", query: "pageToken=", wantItems: 2, wantPageSize: 2},
+		{name: "in range", query: "pageSize=1", wantItems: 1, wantPageSize: 1},
+		{name: "over max", query: "pageSize=50", wantItems: 3, wantPageSize: 3},
+		{name: "events omitted", events: true, query: "pageToken=", wantItems: 2, wantPageSize: 2},
+		{name: "events over max", events: true, query: "pageSize=50", wantItems: 3, wantPageSize: 3},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			target, handler := "/apps/testApp/users/testUser/sessions", apiController.ListSessionsHandler
+			vars := map[string]string{"app_name": "testApp", "user_id": "testUser"}
+			if tt.events {
+				target, handler = target+"/s1/events", apiController.ListEventsHandler
+				vars["session_id"] = "s1"
+			}
+			req, err := http.NewRequest(http.MethodGet, target+"?"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, vars)
+			rr := httptest.NewRecorder()
+
+			handler(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+			}
+			var got models.Page[json.RawMessage]
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(got.Items) != tt.wantItems {
+				t.Errorf("got %d items, want %d", len(got.Items), tt.wantItems)
+			}
+			if got.PageSize != tt.wantPageSize {
+				t.Errorf("pageSize = %d, want %d", got.PageSize, tt.wantPageSize)
+			}
+			if got.NextPageToken == "" {
+				t.Error("nextPageToken is empty, want a next page")
+			}
+		})
+	}
+}
+
+func TestListSessions_InvalidPageParams(t *testing.T) {
+	tc := []struct {
+		name  string
+		query string
+	}{
+		{name: "non-numeric page size", query: "pageSize=abc"},
+		{name: "zero page size", query: "pageSize=0"},
+		{name: "malformed page token", query: "pageToken=not-a-token"},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			apiController := controllers.NewSessionsAPIController(session.InMemoryService())
+			req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions?"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{
+				"app_name": "testApp",
+				"user_id":  "testUser",
+			})
+			rr := httptest.NewRecorder()
+
+			apiController.ListSessionsHandler(rr, req)
+
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// testPageTokenSecret is the page token secret of the controllers whose
+// tests create page tokens with pageToken.
+var testPageTokenSecret = []byte("test-secret")
+
+// pageToken returns the page token of the offset in the list of the scope.
+func pageToken(offset int, scope ...string) string {
+	return models.NewPageTokenSigner(testPageTokenSecret).Encode(offset, scope...)
+}
+
+func TestListPageTokens(t *testing.T) {
+	sessionService := session.InMemoryService()
+	for _, id := range []string{"s1", "s2"} {
+		created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: id})
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		for i := range 3 {
+			event := session.NewEvent("invocation")
+			event.ID = fmt.Sprintf("%s-event%d", id, i)
+			event.Author = "user"
+			if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+				t.Fatalf("append event: %v", err)
+			}
+		}
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{PageTokenSecret: testPageTokenSecret})
+	listEvents := func(sessionID, query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/"+sessionID+"/events?"+query, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": sessionID})
+		rr := httptest.NewRecorder()
+		apiController.ListEventsHandler(rr, req)
+		return rr
+	}
+
+	first := listEvents("s1", "pageSize=2")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first page: got status %v, body: %s", first.Code, first.Body.String())
+	}
+	var page models.Page[models.Event]
+	if err := json.NewDecoder(first.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	token := page.NextPageToken
+	if token != pageToken(2, "events", "testApp", "testUser", "s1") {
+		t.Errorf("nextPageToken = %q, want the signed token of offset 2", token)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte("o2:1")) + "." + signature
+	unsigned, _ := base64.RawURLEncoding.DecodeString(payload)
+
+	tc := []struct {
+		name       string
+		sessionID  string
+		token      string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{name: "valid token", sessionID: "s1", token: token, wantStatus: http.StatusOK, wantIDs: []string{"s1-event2"}},
+		{name: "forged offset", sessionID: "s1", token: forged, wantStatus: http.StatusBadRequest},
+		{name: "tampered signature", sessionID: "s1", token: payload + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")), wantStatus: http.StatusBadRequest},
+		{name: "unsigned token", sessionID: "s1", token: base64.RawURLEncoding.EncodeToString(unsigned), wantStatus: http.StatusBadRequest},
+		{name: "token of another session", sessionID: "s2", token: token, wantStatus: http.StatusBadRequest},
+		{name: "token of another secret", sessionID: "s1", token: models.NewPageTokenSigner([]byte("other")).Encode(2, "events", "testApp", "testUser", "s1"), wantStatus: http.StatusBadRequest},
+		{name: "token of the invocation groups", sessionID: "s1", token: pageToken(2, "invocations", "testApp", "testUser", "s1"), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := listEvents(tt.sessionID, "pageSize=2&pageToken="+url.QueryEscape(tt.token))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.Page[models.Event]
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			var gotIDs []string
+			for _, e := range got.Items {
+				gotIDs = append(gotIDs, e.ID)
+			}
+			if diff := cmp.Diff(tt.wantIDs, gotIDs); diff != "" {
+				t.Errorf("ListEvents() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for i := range 3 {
+		event := session.NewEvent(fmt.Sprintf("invocation%d", i))
+		event.ID = fmt.Sprintf("event%d", i)
+		event.Author = "user"
+		if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+			t.Fatalf("append event: %v", err)
+		}
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	vars := map[string]string{
+		"app_name":   "testApp",
+		"user_id":    "testUser",
+		"session_id": "testSession",
+	}
+
+	var gotIDs []string
+	pageToken := ""
+	for pages := 1; ; pages++ {
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?pageSize=2&pageToken="+pageToken, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+
+		apiController.ListEventsHandler(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+		}
+		var got models.Page[models.Event]
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if got.TotalSize == nil || *got.TotalSize != 3 {
+			t.Errorf("totalSize = %v, want 3", got.TotalSize)
+		}
+		for _, e := range got.Items {
+			gotIDs = append(gotIDs, e.ID)
+		}
+		if got.NextPageToken == "" {
+			if pages != 2 {
+				t.Errorf("got %d pages, want 2", pages)
+			}
+			break
+		}
+		pageToken = got.NextPageToken
+	}
+	if diff := cmp.Diff([]string{"event0", "event1", "event2"}, gotIDs); diff != "" {
+		t.Errorf("ListEvents() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEvents_StructuredArgs(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "copy"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	stringArgs := `{"city":"Paris","days":3,"filter":{"tags":["<b>sun</b>","rain"]}}`
+	content := &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{
+		{Text: "checking"},
+		{FunctionCall: &genai.FunctionCall{ID: "c1", Name: "weather", Args: map[string]any{models.StringArgsKey: stringArgs}}},
+		{FunctionCall: &genai.FunctionCall{ID: "c2", Name: "echo", Args: map[string]any{models.StringArgsKey: "not an object"}}},
+		{FunctionCall: &genai.FunctionCall{ID: "c3", Name: "weather", Args: map[string]any{"city": "Rome"}}},
+	}}
+	event := session.NewEvent("invocation")
+	event.ID = "call"
+	event.Author = "agent"
+	event.Content = content
+	if err := sessionService.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatalf("append event: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+
+	req := httptest.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events", nil)
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+	rr := httptest.NewRecorder()
+	apiController.ListEventsHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("list returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var page models.Page[json.RawMessage]
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(page.Items) != 1 {
+		t.Fatalf("got %d events, want 1", len(page.Items))
+	}
+	var got models.Event
+	if err := json.Unmarshal(page.Items[0], &got); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+
+	// The string arguments encoding an object are listed decoded.
+	if diff := cmp.Diff([]int{1}, got.StructuredArgs); diff != "" {
+		t.Errorf("structured args mismatch (-want +got):\n%s", diff)
+	}
+	wantArgs := []map[string]any{
+		{"city": "Paris", "days": float64(3), "filter": map[string]any{"tags": []any{"<b>sun</b>", "rain"}}},
+		{models.StringArgsKey: "not an object"},
+		{"city": "Rome"},
+	}
+	var gotArgs []map[string]any
+	for _, part := range got.Content.Parts[1:] {
+		gotArgs = append(gotArgs, part.FunctionCall.Args)
+	}
+	if diff := cmp.Diff(wantArgs, gotArgs); diff != "" {
+		t.Errorf("function call args mismatch (-want +got):\n%s", diff)
+	}
+	// The stored event is left as is.
+	if got := event.Content.Parts[1].FunctionCall.Args[models.StringArgsKey]; got != stringArgs {
+		t.Errorf("stored args = %v, want %q", got, stringArgs)
+	}
+
+	// Submitting the listed event stores the arguments as they were.
+	req = httptest.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/copy/events", bytes.NewReader(page.Items[0]))
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "copy"})
+	rr = httptest.NewRecorder()
+	apiController.AppendEventHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("append returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	copied, err := sessionService.Get(ctx, &session.GetRequest{AppName: "testApp", UserID: "testUser", SessionID: "copy"})
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if n := copied.Session.Events().Len(); n != 1 {
+		t.Fatalf("copied session has %d events, want 1", n)
+	}
+	if diff := cmp.Diff(content, copied.Session.Events().At(0).Content); diff != "" {
+		t.Errorf("round-tripped content mismatch (-want +got):\n%s", diff)
+	}
+
+	// The tool calls have the decoded arguments too.
+	calls := models.ToolCallsFromEvents([]*session.Event{event})
+	if got := calls.Calls[0].Args; got["city"] != "Paris" || got["days"] != json.Number("3") {
+		t.Errorf("tool call args = %v, want the decoded arguments", got)
+	}
+}
+
+func TestListEvents_Since(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for _, e := range []struct {
+		id   string
+		time time.Time
+	}{
+		{id: "z", time: base},
+		{id: "a", time: base},
+		{id: "b", time: base.Add(-time.Second)},
+		{id: "c", time: base.Add(500 * time.Millisecond)},
+		{id: "y", time: base.Add(time.Second)},
+		{id: "x", time: base.Add(time.Second)},
+	} {
+		event := session.NewEvent("invocation")
+		event.ID = e.id
+		event.Author = "user"
+		event.Timestamp = e.time
+		if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+			t.Fatalf("append event: %v", err)
+		}
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{PageTokenSecret: testPageTokenSecret})
+
+	tc := []struct {
+		name       string
+		query      string
+		wantIDs    []string
+		wantStatus int
+	}{
+		{
+			name:       "RFC 3339 boundary excludes events at the timestamp",
+			query:      "since=" + url.QueryEscape(base.Format(time.RFC3339)),
+			wantIDs:    []string{"c", "y", "x"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "epoch seconds",
+			query:      fmt.Sprintf("since=%d", base.Unix()),
+			wantIDs:    []string{"c", "y", "x"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "fractional epoch seconds",
+			query:      fmt.Sprintf("since=%d.5", base.Unix()),
+			wantIDs:    []string{"y", "x"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "just before the boundary includes ties ordered by sequence",
+			query:      "since=" + url.QueryEscape(base.Add(-time.Nanosecond).Format(time.RFC3339Nano)),
+			wantIDs:    []string{"z", "a", "c", "y", "x"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "composed with pagination",
+			query:      fmt.Sprintf("since=%d&pageSize=2&pageToken=%s", base.Unix(), pageToken(2, "events", "testApp", "testUser", "testSession")),
+			wantIDs:    []string{"x"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "after the last event",
+			query:      "since=" + url.QueryEscape(base.Add(time.Second).Format(time.RFC3339)),
+			wantIDs:    []string{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid timestamp",
+			query:      "since=yesterday",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+			rr := httptest.NewRecorder()
+
+			apiController.ListEventsHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.Page[models.Event]
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			gotIDs := []string{}
+			for _, e := range got.Items {
+				gotIDs = append(gotIDs, e.ID)
+			}
+			if diff := cmp.Diff(tt.wantIDs, gotIDs); diff != "" {
+				t.Errorf("ListEvents() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListEvents_AfterSequence(t *testing.T) {
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	// The events tie on their timestamp, only the sequence orders them.
+	now := time.Now()
+	for _, id := range []string{"z", "a", "y", "b"} {
+		event := session.NewEvent("invocation")
+		event.ID = id
+		event.Author = "user"
+		event.Timestamp = now
+		if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+			t.Fatalf("append event: %v", err)
+		}
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{PageTokenSecret: testPageTokenSecret})
+
+	tc := []struct {
+		name          string
+		query         string
+		wantIDs       []string
+		wantSequences []int64
+		wantStatus    int
+	}{
+		{
+			name:          "from the start",
+			query:         "afterSequence=0",
+			wantIDs:       []string{"z", "a", "y", "b"},
+			wantSequences: []int64{1, 2, 3, 4},
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "after a seen event",
+			query:         "afterSequence=2",
+			wantIDs:       []string{"y", "b"},
+			wantSequences: []int64{3, 4},
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "composed with pagination",
+			query:         fmt.Sprintf("afterSequence=1&pageSize=2&pageToken=%s", pageToken(2, "events", "testApp", "testUser", "testSession")),
+			wantIDs:       []string{"b"},
+			wantSequences: []int64{4},
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "after the last event",
+			query:         "afterSequence=4",
+			wantIDs:       []string{},
+			wantSequences: []int64{},
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:       "negative sequence",
+			query:      "afterSequence=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid sequence",
+			query:      "afterSequence=last",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+			rr := httptest.NewRecorder()
+
+			apiController.ListEventsHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.Page[models.Event]
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			gotIDs := []string{}
+			gotSequences := []int64{}
+			for _, e := range got.Items {
+				gotIDs = append(gotIDs, e.ID)
+				gotSequences = append(gotSequences, e.Sequence)
+			}
+			if diff := cmp.Diff(tt.wantIDs, gotIDs); diff != "" {
+				t.Errorf("ListEvents() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantSequences, gotSequences); diff != "" {
+				t.Errorf("ListEvents() sequences mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCollapsePartials(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	event := func(id, invocationID string, partial bool) *session.Event {
+		e := session.NewEvent(invocationID)
+		e.ID, e.Author, e.Partial = id, "agent", partial
+		return e
+	}
+	// The partial events of two invocations interleave, and the last one of
+	// invocation B is still streaming.
+	events := fakes.TestEvents{
+		event("a1", "invA", true),
+		event("b1", "invB", true),
+		event("a2", "invA", true),
+		event("fa", "invA", false),
+		event("b2", "invB", true),
+		event("fb", "invB", false),
+		event("b3", "invB", true),
+	}
+	sessionService := fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{
+		id: {Id: id, SessionState: fakes.TestState{}, SessionEvents: events, UpdatedAt: time.Now()},
+	}}
+	vars := sessionVars(id)
+	allIDs := []string{"a1", "b1", "a2", "fa", "b2", "fb", "b3"}
+	collapsedIDs := []string{"fa", "fb", "b3"}
+
+	listEvents := func(t *testing.T, apiController *controllers.SessionsAPIController, query string) []string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?"+query, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.ListEventsHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.Page[models.Event]
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		var ids []string
+		for _, e := range got.Items {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	getSession := func(t *testing.T, apiController *controllers.SessionsAPIController, query string) models.SessionWithHashes {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession?"+query, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.GetSessionHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.SessionWithHashes
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return got
+	}
+
+	tc := []struct {
+		name    string
+		config  controllers.SessionsAPIConfig
+		query   string
+		wantIDs []string
+	}{
+		{name: "kept by default", query: "", wantIDs: allIDs},
+		{name: "collapsed on request", query: "collapsePartials=true", wantIDs: collapsedIDs},
+		{name: "collapsed by config", config: controllers.SessionsAPIConfig{CollapsePartials: true}, query: "", wantIDs: collapsedIDs},
+		{name: "kept on request", config: controllers.SessionsAPIConfig{CollapsePartials: true}, query: "collapsePartials=false", wantIDs: allIDs},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, tt.config)
+			if diff := cmp.Diff(tt.wantIDs, listEvents(t, apiController, tt.query)); diff != "" {
+				t.Errorf("ListEvents() mismatch (-want +got):\n%s", diff)
+			}
+			got := getSession(t, apiController, tt.query)
+			var gotIDs []string
+			for _, e := range got.Events {
+				gotIDs = append(gotIDs, e.ID)
+			}
+			if diff := cmp.Diff(tt.wantIDs, gotIDs); diff != "" {
+				t.Errorf("GetSession() events mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// Collapsing doesn't change the hash of the events, nor the stored
+	// events.
+	apiController := controllers.NewSessionsAPIController(&sessionService)
+	if all, collapsed := getSession(t, apiController, ""), getSession(t, apiController, "collapsePartials=true"); all.EventsHash != collapsed.EventsHash {
+		t.Errorf("EventsHash = %q with collapsed partials, want %q", collapsed.EventsHash, all.EventsHash)
+	}
+	if got := sessionService.Sessions[id].SessionEvents.Len(); got != len(allIDs) {
+		t.Errorf("%d events stored, want %d", got, len(allIDs))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?collapsePartials=maybe", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	apiController.ListEventsHandler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestListEvents_GroupByInvocation(t *testing.T) {
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for _, e := range []struct{ id, invocationID string }{
+		{id: "1", invocationID: "turn-1"},
+		{id: "2", invocationID: ""},
+		{id: "3", invocationID: "turn-2"},
+		{id: "4", invocationID: "turn-1"},
+		{id: "5", invocationID: "turn-2"},
+		{id: "6", invocationID: ""},
+		{id: "7", invocationID: "turn-3"},
+	} {
+		event := session.NewEvent(e.invocationID)
+		event.ID = e.id
+		event.Author = "user"
+		if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+			t.Fatalf("append event: %v", err)
+		}
+	}
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{PageTokenSecret: testPageTokenSecret})
+
+	type group struct {
+		InvocationID string
+		Ungrouped    bool
+		IDs          []string
+	}
+	tc := []struct {
+		name       string
+		query      string
+		want       []group
+		wantStatus int
+	}{
+		{
+			name:  "groups in order of their first event",
+			query: "groupBy=invocation",
+			want: []group{
+				{InvocationID: "turn-1", IDs: []string{"1", "4"}},
+				{InvocationID: "turn-2", IDs: []string{"3", "5"}},
+				{InvocationID: "turn-3", IDs: []string{"7"}},
+				{Ungrouped: true, IDs: []string{"2", "6"}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "pages hold groups",
+			query: "groupBy=invocation&pageSize=2&pageToken=" + pageToken(2, "invocations", "testApp", "testUser", "testSession"),
+			want: []group{
+				{InvocationID: "turn-3", IDs: []string{"7"}},
+				{Ungrouped: true, IDs: []string{"2", "6"}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unsupported grouping",
+			query:      "groupBy=author",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+			rr := httptest.NewRecorder()
+
+			apiController.ListEventsHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.Page[models.EventGroup]
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			gotGroups := []group{}
+			for _, g := range got.Items {
+				ids := []string{}
+				for _, e := range g.Events {
+					ids = append(ids, e.ID)
+				}
+				gotGroups = append(gotGroups, group{InvocationID: g.InvocationID, Ungrouped: g.Ungrouped, IDs: ids})
+			}
+			if diff := cmp.Diff(tt.want, gotGroups); diff != "" {
+				t.Errorf("ListEvents() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateStateDelta(t *testing.T) {
+	// No session service: validation never looks up a session.
+	apiController := controllers.NewSessionsAPIControllerWithConfig(nil, controllers.SessionsAPIConfig{
+		DirectiveAliases: map[string]string{"move": "rename", "clone": "duplicate"},
+		StateKeys:        &controllers.StateKeyPolicy{Pattern: regexp.MustCompile(`^[a-z_]+$`)},
+	})
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tc := []struct {
+		name            string
+		body            string
+		want            map[string]any
+		wantStatus      int
+		wantErrContains string
+	}{
+		{
+			name: "values and directives in canonical form",
+			body: `{"stateDelta": {
+				"plain": {"nested": 1},
+				"gone": {"$adk_state_update": "delete"},
+				"old": {"$adk_state_update": "move", "to": "new"},
+				"dst": {"$adk_state_update": "copy", "from": "src"},
+				"left": {"$adk_state_update": "swap", "with": "right"},
+				"done": {"$adk_state_update": "setIf", "when": {"key": "progress", "op": "gte", "value": 100}, "value": true},
+				"low": {"$adk_state_update": "min", "value": 3}
+			}}`,
+			want: map[string]any{
+				"plain": map[string]any{"nested": float64(1)},
+				"gone":  nil,
+				"old":   map[string]any{"$adk_state_update": "rename", "to": "new", "ignoreMissing": false, "overwrite": false},
+				"dst":   map[string]any{"$adk_state_update": "copy", "from": "src"},
+				"left":  map[string]any{"$adk_state_update": "swap", "with": "right"},
+				"done":  map[string]any{"$adk_state_update": "setIf", "when": map[string]any{"key": "progress", "op": "gte", "value": float64(100)}, "value": true},
+				"low":   map[string]any{"$adk_state_update": "min", "value": float64(3)},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "empty delta",
+			body:       `{"stateDelta": {}}`,
+			want:       map[string]any{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "malformed body",
+			body:            `{"stateDelta": `,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "unexpected EOF",
+		},
+		{
+			name:            "unknown directive",
+			body:            `{"stateDelta": {"a": {"$adk_state_update": "increment"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `unknown state update directive "increment"`,
+		},
+		{
+			name:            "alias of unknown directive",
+			body:            `{"stateDelta": {"a": {"$adk_state_update": "clone"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `is an alias of unknown directive "duplicate"`,
+		},
+		{
+			name:            "directive name not a string",
+			body:            `{"stateDelta": {"a": {"$adk_state_update": 1}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "invalid directive value type",
+		},
+		{
+			name:            "missing directive field",
+			body:            `{"stateDelta": {"a": {"$adk_state_update": "copy"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires the "from" field`,
+		},
+		{
+			name:            "directive field of the wrong type",
+			body:            `{"stateDelta": {"a": {"$adk_state_update": "rename", "to": 1}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `"to"`,
+		},
+		{
+			name:            "invalid predicate",
+			body:            `{"stateDelta": {"a": {"$adk_state_update": "setIf", "when": {"key": "b", "op": "above"}, "value": 1}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `unsupported predicate operator "above"`,
+		},
+		{
+			name:            "invalid payload",
+			body:            `{"stateDelta": {"a": {"$adk_state_update": "max", "value": "high"}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `requires a number "value" field`,
+		},
+		{
+			name:            "reserved key",
+			body:            `{"stateDelta": {"$adk_internal": 1}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "$adk_internal",
+		},
+		{
+			name:            "key violating the naming policy",
+			body:            `{"stateDelta": {"Bad-Key": 1}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "Bad-Key",
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/apps/testApp/state:validate", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"app_name": "testApp"})
+			rr := httptest.NewRecorder()
+
+			apiController.ValidateStateDeltaHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+					t.Errorf("response body %q does not contain %q", rr.Body.String(), tt.wantErrContains)
+				}
+				return
+			}
+			var got models.ValidateStateDeltaResponse
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got.StateDelta); diff != "" {
+				t.Errorf("ValidateStateDelta() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListEvents_FieldProjection(t *testing.T) {
+	sessionService := session.InMemoryService()
+	created, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	event := session.NewEvent("invocation")
+	event.ID = "event"
+	event.Author = "user"
+	event.LLMResponse = model.LLMResponse{Content: genai.NewContentFromText("hi", genai.RoleUser)}
+	// The fields omitted when empty are set, to be listed.
+	event.Tags = map[string]string{"tag": "value"}
+	event.Content.Parts = append(event.Content.Parts, &genai.Part{FunctionCall: &genai.FunctionCall{Name: "f", Args: map[string]any{models.StringArgsKey: "{}"}}})
+	if err := sessionService.AppendEvent(t.Context(), created.Session, event); err != nil {
+		t.Fatalf("append event: %v", err)
+	}
+	allowed := []string{"author", "content", "groundingMetadata", "actions"}
+
+	tc := []struct {
+		name            string
+		allowed         []string
+		query           string
+		wantFields      []string
+		wantStatus      int
+		wantErrContains string
+	}{
+		{
+			name:       "all fields without projection",
+			allowed:    allowed,
+			wantFields: models.EventFields,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "fields keeps the named fields and the ID",
+			allowed:    allowed,
+			query:      "fields=author,content",
+			wantFields: []string{"author", "content", "id"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "excludeFields leaves out the named fields",
+			allowed: allowed,
+			query:   "excludeFields=groundingMetadata,actions",
+			wantFields: slices.DeleteFunc(slices.Clone(models.EventFields), func(field string) bool {
+				return field == "groundingMetadata" || field == "actions"
+			}),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "any field is projectable by default",
+			query:      "fields=branch",
+			wantFields: []string{"branch", "id"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "field not allowed is rejected",
+			allowed:         allowed,
+			query:           "fields=author,branch",
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `projection of event field "branch" is not allowed`,
+		},
+		{
+			name:            "unknown field is rejected",
+			query:           "excludeFields=rawResponse",
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `unknown event field "rawResponse"`,
+		},
+		{
+			name:            "fields and excludeFields are rejected together",
+			query:           "fields=author&excludeFields=content",
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "fields and excludeFields can't be combined",
+		},
+		{
+			name:            "projection is rejected with groupBy",
+			query:           "fields=author&groupBy=invocation",
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: "event fields can't be projected with groupBy",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{ProjectableEventFields: tt.allowed})
+			req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+			rr := httptest.NewRecorder()
+
+			apiController.ListEventsHandler(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantErrContains != "" {
+				if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+					t.Errorf("expected error containing %q, got %q", tt.wantErrContains, rr.Body.String())
+				}
+				return
+			}
+			var got models.Page[map[string]json.RawMessage]
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(got.Items) != 1 {
+				t.Fatalf("got %d events, want 1", len(got.Items))
+			}
+			if diff := cmp.Diff(tt.wantFields, slices.Collect(maps.Keys(got.Items[0])), cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("event fields mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListEvents_TagFilter(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	vars := map[string]string{
+		"app_name":   "testApp",
+		"user_id":    "testUser",
+		"session_id": "testSession",
+	}
+	for _, body := range []string{
+		`{"id": "billing", "author": "user", "tags": {"kind": "billing", "priority": "high"}}`,
+		`{"id": "error", "author": "user", "tags": {"kind": "error"}}`,
+		`{"id": "handoff", "author": "user", "tags": {"handoff": ""}}`,
+		`{"id": "untagged", "author": "user"}`,
+	} {
+		req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/events", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		apiController.AppendEventHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("append event: got status %v, body: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	tc := []struct {
+		name       string
+		query      string
+		wantIDs    []string
+		wantTags   map[string]map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "no filter",
+			query:      "",
+			wantIDs:    []string{"billing", "error", "handoff", "untagged"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "key and value",
+			query:      "tag=kind=billing",
+			wantIDs:    []string{"billing"},
+			wantTags:   map[string]map[string]string{"billing": {"kind": "billing", "priority": "high"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "key presence",
+			query:      "tag=handoff",
+			wantIDs:    []string{"handoff"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "OR within a parameter",
+			query:      "tag=kind=billing,kind=error",
+			wantIDs:    []string{"billing", "error"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "AND across parameters",
+			query:      "tag=kind=billing,kind=error&tag=priority=high",
+			wantIDs:    []string{"billing"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no match",
+			query:      "tag=kind=billing&tag=kind=error",
+			wantIDs:    nil,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "empty key",
+			query:      "tag==billing",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/events?"+tt.query, nil)
 			if err != nil {
 				t.Fatalf("new request: %v", err)
 			}
-			// Manually set the URL variables on the request using mux.SetURLVars.
-			req = mux.SetURLVars(req, map[string]string{
-				"app_name": "testApp",
-				"user_id":  "testUser",
-			})
+			req = mux.SetURLVars(req, vars)
 			rr := httptest.NewRecorder()
 
-			apiController.ListSessionsHandler(rr, req)
+			apiController.ListEventsHandler(rr, req)
+
 			if status := rr.Code; status != tt.wantStatus {
-				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
 			}
-			got := []models.Session{}
-			err = json.NewDecoder(rr.Body).Decode(&got)
-			if err != nil {
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got models.Page[models.Event]
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
 				t.Fatalf("decode response: %v", err)
 			}
-			if diff := cmp.Diff(tt.wantSessions, got, EquateApproxInt(int64(time.Second)), cmpopts.SortSlices(func(a, b models.Session) bool {
-				return a.ID < b.ID
-			})); diff != "" {
-				t.Errorf("ListSessions() mismatch (-want +got):\n%s", diff)
+			var gotIDs []string
+			for _, e := range got.Items {
+				gotIDs = append(gotIDs, e.ID)
+				if want, ok := tt.wantTags[e.ID]; ok {
+					if diff := cmp.Diff(want, e.Tags); diff != "" {
+						t.Errorf("event %q tags mismatch (-want +got):\n%s", e.ID, diff)
+					}
+				}
+			}
+			if diff := cmp.Diff(tt.wantIDs, gotIDs); diff != "" {
+				t.Errorf("ListEvents() mismatch (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
-func TestUpdateSession(t *testing.T) {
+func TestStrictDecoding(t *testing.T) {
 	id := fakes.SessionKey{
 		AppName:   "testApp",
 		UserID:    "testUser",
@@ -445,165 +5102,396 @@ func TestUpdateSession(t *testing.T) {
 
 	tc := []struct {
 		name            string
-		storedSessions  map[fakes.SessionKey]fakes.TestSession
-		sessionID       fakes.SessionKey
-		patchBody       string
-		wantState       map[string]any
-		wantEventCount  int
+		strict          bool
+		method          string
+		body            string
 		wantStatus      int
 		wantErrContains string
 	}{
 		{
-			name: "patch adds new key and appends event",
-			storedSessions: map[fakes.SessionKey]fakes.TestSession{
-				id: {
-					Id:            id,
-					SessionState:  fakes.TestState{"existing": "value"},
-					SessionEvents: fakes.TestEvents{},
-					UpdatedAt:     time.Now(),
-				},
-			},
-			sessionID:      id,
-			patchBody:      `{"stateDelta": {"newKey": "newValue"}}`,
-			wantState:      map[string]any{"existing": "value", "newKey": "newValue"},
-			wantEventCount: 1,
-			wantStatus:     http.StatusOK,
+			name:       "lenient create ignores unknown field",
+			method:     http.MethodPost,
+			body:       `{"state": {"k": "v"}, "stat": {}}`,
+			wantStatus: http.StatusOK,
 		},
 		{
-			name: "patch overwrites existing key",
-			storedSessions: map[fakes.SessionKey]fakes.TestSession{
-				id: {
-					Id:            id,
-					SessionState:  fakes.TestState{"key": "oldValue"},
-					SessionEvents: fakes.TestEvents{},
-					UpdatedAt:     time.Now(),
-				},
-			},
-			sessionID:      id,
-			patchBody:      `{"stateDelta": {"key": "newValue"}}`,
-			wantState:      map[string]any{"key": "newValue"},
-			wantEventCount: 1,
-			wantStatus:     http.StatusOK,
+			name:            "strict create rejects unknown field",
+			strict:          true,
+			method:          http.MethodPost,
+			body:            `{"state": {"k": "v"}, "stat": {}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `unknown field "stat"`,
 		},
 		{
-			name: "patch deletes key with delete directive",
-			storedSessions: map[fakes.SessionKey]fakes.TestSession{
-				id: {
-					Id:            id,
-					SessionState:  fakes.TestState{"toDelete": "value", "toKeep": "value"},
-					SessionEvents: fakes.TestEvents{},
-					UpdatedAt:     time.Now(),
-				},
-			},
-			sessionID:      id,
-			patchBody:      `{"stateDelta": {"toDelete": {"$adk_state_update": "delete"}}}`,
-			wantState:      map[string]any{"toKeep": "value"},
-			wantEventCount: 1,
-			wantStatus:     http.StatusOK,
+			name:            "strict create rejects unknown event field",
+			strict:          true,
+			method:          http.MethodPost,
+			body:            `{"events": [{"author": "user", "autor": "user"}]}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `unknown field "autor"`,
 		},
 		{
-			name: "patch on session with existing events adds one more",
-			storedSessions: map[fakes.SessionKey]fakes.TestSession{
-				id: {
-					Id:           id,
-					SessionState: fakes.TestState{"key": "value"},
-					SessionEvents: fakes.TestEvents{
-						{InvocationID: "existing-event"},
-					},
-					UpdatedAt: time.Now(),
-				},
-			},
-			sessionID:      id,
-			patchBody:      `{"stateDelta": {"newKey": "newValue"}}`,
-			wantState:      map[string]any{"key": "value", "newKey": "newValue"},
-			wantEventCount: 2,
-			wantStatus:     http.StatusOK,
+			name:       "strict create accepts known fields",
+			strict:     true,
+			method:     http.MethodPost,
+			body:       `{"state": {"k": "v"}}`,
+			wantStatus: http.StatusOK,
 		},
 		{
-			name:            "patch on non-existent session returns error",
-			storedSessions:  map[fakes.SessionKey]fakes.TestSession{},
-			sessionID:       id,
-			patchBody:       `{"stateDelta": {"key": "value"}}`,
-			wantStatus:      http.StatusInternalServerError,
-			wantErrContains: "not found",
+			name:       "lenient patch ignores unknown field",
+			method:     http.MethodPatch,
+			body:       `{"stateDelta": {"k": "v"}, "stateDeltaa": {}}`,
+			wantStatus: http.StatusOK,
 		},
 		{
-			name: "patch with missing session_id returns error",
-			storedSessions: map[fakes.SessionKey]fakes.TestSession{
-				id: {
-					Id:            id,
-					SessionState:  fakes.TestState{},
-					SessionEvents: fakes.TestEvents{},
-					UpdatedAt:     time.Now(),
-				},
-			},
-			sessionID: fakes.SessionKey{
-				AppName: "testApp",
-				UserID:  "testUser",
-			},
-			patchBody:       `{"stateDelta": {"key": "value"}}`,
+			name:            "strict patch rejects unknown field",
+			strict:          true,
+			method:          http.MethodPatch,
+			body:            `{"stateDeltaa": {"k": "v"}}`,
 			wantStatus:      http.StatusBadRequest,
-			wantErrContains: "session_id parameter is required",
+			wantErrContains: `unknown field "stateDeltaa"`,
 		},
 	}
 
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
-			sessionService := fakes.FakeSessionService{Sessions: tt.storedSessions}
-			apiController := controllers.NewSessionsAPIController(&sessionService)
-			req, err := http.NewRequest(http.MethodPatch, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(tt.patchBody))
+			storedSessions := map[fakes.SessionKey]fakes.TestSession{}
+			if tt.method == http.MethodPatch {
+				storedSessions[id] = fakes.TestSession{Id: id, SessionState: fakes.TestState{}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()}
+			}
+			sessionService := fakes.FakeSessionService{Sessions: storedSessions}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{StrictDecoding: tt.strict})
+			req, err := http.NewRequest(tt.method, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(tt.body))
 			if err != nil {
 				t.Fatalf("new request: %v", err)
 			}
-			req.Header.Set("Content-Type", "application/json")
-			req = mux.SetURLVars(req, sessionVars(tt.sessionID))
+			req = mux.SetURLVars(req, sessionVars(id))
 			rr := httptest.NewRecorder()
 
-			apiController.UpdateSessionHandler(rr, req)
+			if tt.method == http.MethodPatch {
+				apiController.UpdateSessionHandler(rr, req)
+			} else {
+				apiController.CreateSessionHandler(rr, req)
+			}
 
 			if status := rr.Code; status != tt.wantStatus {
 				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
 			}
+			if tt.wantErrContains != "" && !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+				t.Errorf("body = %q, want it to contain %q", rr.Body.String(), tt.wantErrContains)
+			}
+		})
+	}
+}
 
-			if tt.wantErrContains != "" {
-				if !strings.Contains(rr.Body.String(), tt.wantErrContains) {
-					t.Errorf("expected error containing %q, got %q", tt.wantErrContains, rr.Body.String())
-				}
-				return
+func TestRejectDuplicateKeys(t *testing.T) {
+	id := fakes.SessionKey{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "testSession",
+	}
+
+	tc := []struct {
+		name            string
+		reject          bool
+		method          string
+		body            string
+		wantStatus      int
+		wantErrContains string
+		wantState       fakes.TestState
+	}{
+		{
+			name:       "lenient patch keeps the last duplicate",
+			method:     http.MethodPatch,
+			body:       `{"stateDelta": {"k": "first", "k": "last"}}`,
+			wantStatus: http.StatusOK,
+			wantState:  fakes.TestState{"k": "last"},
+		},
+		{
+			name:            "strict patch rejects duplicate delta keys",
+			reject:          true,
+			method:          http.MethodPatch,
+			body:            `{"stateDelta": {"k": "first", "k": "last"}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `duplicate key "k" in the object at "/stateDelta"`,
+			wantState:       fakes.TestState{},
+		},
+		{
+			name:            "strict patch rejects duplicate directive keys",
+			reject:          true,
+			method:          http.MethodPatch,
+			body:            `{"stateDelta": {"n": {"$adk_state_update": "max", "value": 1, "value": 2}}}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `duplicate key "value" in the object at "/stateDelta/n"`,
+			wantState:       fakes.TestState{},
+		},
+		{
+			name:       "strict patch accepts the same key in different objects",
+			reject:     true,
+			method:     http.MethodPatch,
+			body:       `{"stateDelta": {"a": {"k": 1}, "b": [{"k": 2}, {"k": 3}]}}`,
+			wantStatus: http.StatusOK,
+			wantState:  fakes.TestState{"a": map[string]any{"k": float64(1)}, "b": []any{map[string]any{"k": float64(2)}, map[string]any{"k": float64(3)}}},
+		},
+		{
+			name:            "strict create rejects duplicate keys in an array",
+			reject:          true,
+			method:          http.MethodPost,
+			body:            `{"events": [{"author": "user"}, {"author": "user", "author": "agent"}]}`,
+			wantStatus:      http.StatusBadRequest,
+			wantErrContains: `duplicate key "author" in the object at "/events/1"`,
+		},
+		{
+			name:       "lenient create accepts duplicate keys",
+			method:     http.MethodPost,
+			body:       `{"state": {"k": "v", "k": "w"}}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			storedSessions := map[fakes.SessionKey]fakes.TestSession{}
+			if tt.method == http.MethodPatch {
+				storedSessions[id] = fakes.TestSession{Id: id, SessionState: fakes.TestState{}, SessionEvents: fakes.TestEvents{}, UpdatedAt: time.Now()}
+			}
+			sessionService := fakes.FakeSessionService{Sessions: storedSessions}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(&sessionService, controllers.SessionsAPIConfig{RejectDuplicateKeys: tt.reject})
+			req, err := http.NewRequest(tt.method, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
 			}
+			req = mux.SetURLVars(req, sessionVars(id))
+			rr := httptest.NewRecorder()
 
-			// Decode response
-			var got models.Session
-			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
-				t.Fatalf("decode response: %v", err)
+			if tt.method == http.MethodPatch {
+				apiController.UpdateSessionHandler(rr, req)
+			} else {
+				apiController.CreateSessionHandler(rr, req)
 			}
 
-			// Verify state
-			if diff := cmp.Diff(tt.wantState, got.State); diff != "" {
-				t.Errorf("UpdateSession() state mismatch (-want +got):\n%s", diff)
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantErrContains != "" && !strings.Contains(rr.Body.String(), tt.wantErrContains) {
+				t.Errorf("body = %q, want it to contain %q", rr.Body.String(), tt.wantErrContains)
+			}
+			if tt.wantState != nil {
+				if diff := cmp.Diff(tt.wantState, sessionService.Sessions[id].SessionState); diff != "" {
+					t.Errorf("stored state mismatch (-want +got):\n%s", diff)
+				}
 			}
+		})
+	}
+}
 
-			// Verify event count
-			if len(got.Events) != tt.wantEventCount {
-				t.Errorf("UpdateSession() event count = %d, want %d", len(got.Events), tt.wantEventCount)
+func TestWatchUserEvents(t *testing.T) {
+	ctx := t.Context()
+	sessionService := session.InMemoryService()
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser"})
+		apiController.WatchUserEventsHandler(rw, req)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/apps/testApp/users/testUser/events", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want %q", got, "text/event-stream")
+	}
+
+	// The sessions are created after the stream started.
+	for _, req := range []*session.CreateRequest{
+		{AppName: "testApp", UserID: "testUser", SessionID: "first"},
+		{AppName: "testApp", UserID: "otherUser", SessionID: "other"},
+		{AppName: "testApp", UserID: "testUser", SessionID: "second"},
+	} {
+		created, err := sessionService.Create(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := session.NewEvent("invocation")
+		event.Author = req.SessionID
+		if err := sessionService.AppendEvent(ctx, created.Session, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var got []models.SessionEvent
+	for len(got) < 2 && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var msg models.SessionEvent
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("unmarshal message %q: %v", data, err)
+		}
+		got = append(got, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	want := []models.SessionEvent{
+		{SessionID: "first", Event: models.Event{Author: "first", Sequence: 1}},
+		{SessionID: "second", Event: models.Event{Author: "second", Sequence: 1}},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(models.Event{}, "ID", "Time", "InvocationID"), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("streamed messages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// watchingService is a session service streaming the events sent on its
+// channel to the watchers of any user.
+type watchingService struct {
+	*fakes.FakeSessionService
+	events chan session.SessionEvent
+}
+
+func (s *watchingService) WatchUser(ctx context.Context, req *session.WatchUserRequest) (*session.Subscription, error) {
+	go func() {
+		<-ctx.Done()
+		close(s.events)
+	}()
+	return session.NewSubscription(s.events), nil
+}
+
+func TestWatchUserEvents_Reordering(t *testing.T) {
+	const window = 100 * time.Millisecond
+	tc := []struct {
+		name       string
+		reordering controllers.EventReordering
+		// events are the sessions and sequence numbers of the delivered
+		// events, in delivery order; "wait" waits for twice the window.
+		events []string
+		want   []string
+		// minElapsed is the least time the stream takes to send all events.
+		minElapsed time.Duration
+	}{
+		{
+			name:   "events are sent as they arrive by default",
+			events: []string{"a:2", "b:1", "a:1", "a:3"},
+			want:   []string{"a:2", "b:1", "a:1", "a:3"},
+		},
+		{
+			name:       "events are sent in sequence order",
+			reordering: controllers.EventReordering{Window: time.Hour},
+			events:     []string{"a:2", "b:1", "a:3", "a:1", "b:2"},
+			want:       []string{"b:1", "a:1", "a:2", "a:3", "b:2"},
+		},
+		{
+			name:       "event after a gap is sent once its window passed",
+			reordering: controllers.EventReordering{Window: window},
+			events:     []string{"a:1", "a:3", "a:2", "a:5"},
+			want:       []string{"a:1", "a:2", "a:3", "a:5"},
+			minElapsed: window,
+		},
+		{
+			name:       "late event is sent on arrival",
+			reordering: controllers.EventReordering{Window: window},
+			events:     []string{"a:2", "a:3", "wait", "a:1"},
+			want:       []string{"a:2", "a:3", "a:1"},
+			minElapsed: window,
+		},
+		{
+			name:       "oldest event is sent when the buffer is full",
+			reordering: controllers.EventReordering{Window: time.Hour, MaxHeld: 1},
+			events:     []string{"a:2", "a:4", "a:3"},
+			want:       []string{"a:2", "a:3", "a:4"},
+		},
+		{
+			name:       "events without sequence are not held",
+			reordering: controllers.EventReordering{Window: time.Hour},
+			events:     []string{"a:2", "a:0", "a:1"},
+			want:       []string{"a:0", "a:1", "a:2"},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &watchingService{FakeSessionService: &fakes.FakeSessionService{}, events: make(chan session.SessionEvent, len(tt.events))}
+			apiController := controllers.NewSessionsAPIControllerWithConfig(service, controllers.SessionsAPIConfig{WatchReordering: tt.reordering})
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser"})
+				apiController.WatchUserEventsHandler(rw, req)
+			}))
+			defer server.Close()
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+"/apps/testApp/users/testUser/events", nil)
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatalf("do request: %v", err)
 			}
+			defer resp.Body.Close()
 
-			// Verify the new event has correct properties (if events were added)
-			if tt.wantEventCount > 0 && len(got.Events) > 0 {
-				lastEvent := got.Events[len(got.Events)-1]
-				// Verify invocation ID starts with "p-" (matching Python behavior)
-				if !strings.HasPrefix(lastEvent.InvocationID, "p-") {
-					t.Errorf("UpdateSession() event invocation_id should start with 'p-', got %q", lastEvent.InvocationID)
+			start := time.Now()
+			for _, delivered := range tt.events {
+				if delivered == "wait" {
+					time.Sleep(2 * window)
+					continue
 				}
-				// Verify author is "user" (matching Python behavior)
-				if lastEvent.Author != "user" {
-					t.Errorf("UpdateSession() event author should be 'user', got %q", lastEvent.Author)
+				sessionID, seq, _ := strings.Cut(delivered, ":")
+				event := session.NewEvent("invocation")
+				event.Sequence, _ = strconv.ParseInt(seq, 10, 64)
+				service.events <- session.SessionEvent{SessionID: sessionID, Event: event}
+			}
+			scanner := bufio.NewScanner(resp.Body)
+			var got []string
+			for len(got) < len(tt.want) && scanner.Scan() {
+				data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+				if !ok {
+					continue
 				}
+				var msg models.SessionEvent
+				if err := json.Unmarshal([]byte(data), &msg); err != nil {
+					t.Fatalf("unmarshal message %q: %v", data, err)
+				}
+				got = append(got, fmt.Sprintf("%s:%d", msg.SessionID, msg.Event.Sequence))
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatalf("read stream: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("streamed events mismatch (-want +got):\n%s", diff)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("events were streamed after %v, want at least %v", elapsed, tt.minElapsed)
 			}
 		})
 	}
 }
 
+func TestWatchUserEvents_Unsupported(t *testing.T) {
+	apiController := controllers.NewSessionsAPIController(&fakes.FakeSessionService{})
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/events", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser"})
+	rr := httptest.NewRecorder()
+
+	apiController.WatchUserEventsHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotImplemented)
+	}
+}
+
 func sessionVars(sessionID fakes.SessionKey) map[string]string {
 	return map[string]string{
 		"app_name":   sessionID.AppName,
@@ -0,0 +1,219 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// reservedKeyPrefix is the state key namespace reserved for ADK itself.
+const reservedKeyPrefix = "$adk_"
+
+// directiveKeyFields are the fields of state update directives naming
+// another state key.
+var directiveKeyFields = []string{"to", "from", "with"}
+
+// StateKeyPolicy enforces naming rules on the state keys clients write.
+// The rules apply to the name of a key without its app:, user: or temp:
+// scope prefix, and to the keys state update directives refer to.
+type StateKeyPolicy struct {
+	// Unicode selects what is rewritten to the Unicode normalization form
+	// NFC, so that keys and values written in different forms are the
+	// same. Optional: by default nothing is rewritten.
+	Unicode UnicodeNormalization
+	// Normalize rewrites key names before they are checked, for instance
+	// to lower case. Optional: by default names are kept as they are.
+	Normalize func(name string) string
+	// Pattern is the pattern normalized names must match.
+	// Optional: by default any name is accepted.
+	Pattern *regexp.Regexp
+}
+
+// UnicodeNormalization selects the parts of the state clients write which
+// are rewritten to NFC.
+type UnicodeNormalization int
+
+const (
+	// UnicodeNormalizationNone keeps keys and values as they are.
+	UnicodeNormalizationNone UnicodeNormalization = iota
+	// UnicodeNormalizationKeys rewrites the key names, before Normalize.
+	UnicodeNormalizationKeys
+	// UnicodeNormalizationKeysAndValues also rewrites the string values,
+	// including the strings nested in maps and lists of a value, but not
+	// the keys of nested maps.
+	UnicodeNormalizationKeysAndValues
+)
+
+// apply returns the state with its keys normalized, or an error reported
+// with 400 Bad Request naming the first offending key. The $adk_ namespace
+// is rejected even when the policy is nil. With protectSystem, the keys
+// normalizing to system state keys are rejected with 403 Forbidden.
+func (p *StateKeyPolicy) apply(state map[string]any, protectSystem bool) (map[string]any, error) {
+	if len(state) == 0 {
+		return state, nil
+	}
+	sanitized := make(map[string]any, len(state))
+	for key, value := range state {
+		normalized, err := p.key(key, protectSystem)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := sanitized[normalized]; ok {
+			return nil, newStatusError(fmt.Errorf("state keys normalizing to %q conflict", normalized), http.StatusBadRequest)
+		}
+		if p != nil && p.Unicode == UnicodeNormalizationKeysAndValues {
+			value = nfcStrings(value)
+		}
+		if directive, ok := value.(map[string]any); ok {
+			if value, err = p.directive(directive, protectSystem); err != nil {
+				return nil, err
+			}
+		}
+		sanitized[normalized] = value
+	}
+	return sanitized, nil
+}
+
+// directive returns a copy of a state value with the keys named by its
+// directive fields normalized. Values that are not directives are returned
+// as they are.
+func (p *StateKeyPolicy) directive(value map[string]any, protectSystem bool) (map[string]any, error) {
+	if !models.IsStateDirective(value) {
+		return value, nil
+	}
+	var directive map[string]any
+	for _, field := range directiveKeyFields {
+		key, ok := value[field].(string)
+		if !ok || key == "" {
+			continue
+		}
+		normalized, err := p.key(key, protectSystem)
+		if err != nil {
+			return nil, err
+		}
+		if directive == nil {
+			directive = maps.Clone(value)
+		}
+		directive[field] = normalized
+	}
+	if directive == nil {
+		return value, nil
+	}
+	return directive, nil
+}
+
+// key returns the normalized key, or an error if it breaks the policy. The
+// system namespace is checked on the normalized key, so that no spelling of
+// a key gets around its protection.
+func (p *StateKeyPolicy) key(key string, protectSystem bool) (string, error) {
+	prefix, name := splitScope(key)
+	if strings.HasPrefix(name, reservedKeyPrefix) {
+		return "", newStatusError(fmt.Errorf("state key %q uses the reserved %s prefix", key, reservedKeyPrefix), http.StatusBadRequest)
+	}
+	if p != nil && p.Unicode != UnicodeNormalizationNone {
+		name = norm.NFC.String(name)
+	}
+	if p != nil && p.Normalize != nil {
+		name = p.Normalize(name)
+		if strings.HasPrefix(name, reservedKeyPrefix) {
+			return "", newStatusError(fmt.Errorf("state key %q normalizes to the reserved %s prefix", key, reservedKeyPrefix), http.StatusBadRequest)
+		}
+	}
+	normalized := prefix + name
+	if protectSystem && strings.HasPrefix(normalized, session.KeyPrefixSystem) {
+		if normalized != key {
+			return "", newStatusError(fmt.Errorf("%w: %q normalizes to %q", session.ErrSystemStateWrite, key, normalized), http.StatusForbidden)
+		}
+		return "", newStatusError(fmt.Errorf("%w: %q", session.ErrSystemStateWrite, key), http.StatusForbidden)
+	}
+	if p != nil && p.Pattern != nil && !p.Pattern.MatchString(name) {
+		return "", newStatusError(fmt.Errorf("state key %q does not match the pattern %s", key, p.Pattern), http.StatusBadRequest)
+	}
+	return normalized, nil
+}
+
+// nfcStrings returns the value with its strings rewritten to NFC. Maps and
+// lists are copied rather than changed in place.
+func nfcStrings(value any) any {
+	switch v := value.(type) {
+	case string:
+		return norm.NFC.String(v)
+	case map[string]any:
+		normalized := make(map[string]any, len(v))
+		for key, value := range v {
+			normalized[key] = nfcStrings(value)
+		}
+		return normalized
+	case []any:
+		normalized := make([]any, len(v))
+		for i, value := range v {
+			normalized[i] = nfcStrings(value)
+		}
+		return normalized
+	default:
+		return value
+	}
+}
+
+// splitScope splits the scope prefix off a state key.
+func splitScope(key string) (prefix, name string) {
+	for _, prefix := range []string{session.KeyPrefixApp, session.KeyPrefixUser, session.KeyPrefixTemp} {
+		if name, ok := strings.CutPrefix(key, prefix); ok {
+			return prefix, name
+		}
+	}
+	return "", key
+}
+
+// StateKeyAllowlist maps an app name to the top-level state keys clients
+// may write for the app's sessions, with their scope prefix, e.g. "cart"
+// and "user:locale". Apps without an entry accept any key.
+type StateKeyAllowlist map[string][]string
+
+// check returns an error reported with 422 Unprocessable Entity naming the
+// first key of the state, or the first key its directives refer to, which
+// is not allowed for the app. Deleting a key counts as writing it.
+func (a StateKeyAllowlist) check(appName string, state map[string]any) error {
+	allowed, ok := a[appName]
+	if !ok {
+		return nil
+	}
+	for _, key := range slices.Sorted(maps.Keys(state)) {
+		keys := []string{key}
+		if directive, ok := state[key].(map[string]any); ok && models.IsStateDirective(directive) {
+			for _, field := range directiveKeyFields {
+				if other, ok := directive[field].(string); ok && other != "" {
+					keys = append(keys, other)
+				}
+			}
+		}
+		for _, key := range keys {
+			if !slices.Contains(allowed, key) {
+				return newStatusError(fmt.Errorf("state key %q is not allowed for app %q", key, appName), http.StatusUnprocessableEntity)
+			}
+		}
+	}
+	return nil
+}
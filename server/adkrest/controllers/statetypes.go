@@ -0,0 +1,102 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// StateType is the type a state value sent as a string is coerced to.
+type StateType string
+
+const (
+	// StateInteger coerces strings like "42" to the number 42. Strings of
+	// numbers with a fraction are kept as they are.
+	StateInteger StateType = "integer"
+	// StateNumber coerces strings like "4.2" to the number 4.2.
+	StateNumber StateType = "number"
+	// StateBoolean coerces the strings "true" and "false", in any case.
+	StateBoolean StateType = "boolean"
+)
+
+// StateTypes maps a state key, as normalized by the state key policy, to
+// the type its string values are coerced to.
+type StateTypes map[string]StateType
+
+// StateCoercion maps an app name to the [StateTypes] of its sessions, for
+// clients sending numbers and booleans as strings. Only the plain values
+// clients write are coerced, not the fields of state update directives,
+// and strings that don't parse as their type are kept as they are. Apps
+// without an entry keep the values as sent.
+type StateCoercion map[string]StateTypes
+
+// apply returns the state with the values of the typed keys of the app
+// coerced. The state is returned as is when nothing is coerced.
+func (c StateCoercion) apply(appName string, state map[string]any) map[string]any {
+	types, ok := c[appName]
+	if !ok {
+		return state
+	}
+	var coerced map[string]any
+	for key, stateType := range types {
+		s, ok := state[key].(string)
+		if !ok {
+			continue
+		}
+		value, ok := stateType.coerce(s)
+		if !ok {
+			continue
+		}
+		if coerced == nil {
+			coerced = maps.Clone(state)
+		}
+		coerced[key] = value
+	}
+	if coerced == nil {
+		return state
+	}
+	return coerced
+}
+
+// coerce returns the value of the string, as decoded from JSON, if it
+// parses as the type.
+func (t StateType) coerce(s string) (any, bool) {
+	s = strings.TrimSpace(s)
+	switch t {
+	case StateInteger:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f != math.Trunc(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return f, true
+	case StateNumber:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, false
+		}
+		return f, true
+	case StateBoolean:
+		switch strings.ToLower(s) {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	}
+	return nil, false
+}
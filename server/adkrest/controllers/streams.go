@@ -0,0 +1,174 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultStreamRetryAfter is the Retry-After of the streams rejected
+// without a configured one.
+const defaultStreamRetryAfter = 5 * time.Second
+
+// StreamLimits caps the number of Server-Sent Events streams served at
+// once. A limit of zero or less means no limit.
+type StreamLimits struct {
+	// Max caps the streams of all users.
+	Max int
+	// MaxPerUser caps the streams of each user.
+	MaxPerUser int
+	// RetryAfter is the delay the rejected clients are told to wait before
+	// retrying. Optional: defaults to 5s.
+	RetryAfter time.Duration
+}
+
+// StreamCounter counts the Server-Sent Events responses being served, and
+// enforces the stream limits on the handlers that open streams.
+// The zero value is ready to use and has no limits. It is safe for
+// concurrent use.
+type StreamCounter struct {
+	// Limits caps the streams opened by the handlers. It must not change
+	// once the counter is used.
+	Limits StreamLimits
+
+	active atomic.Int64
+
+	mu sync.Mutex
+	// open and perUser count the streams admitted by acquire and not
+	// released yet.
+	open    int
+	perUser map[string]int
+}
+
+// Active returns the number of SSE responses being served.
+func (c *StreamCounter) Active() int64 {
+	return c.active.Load()
+}
+
+// Open returns the number of streams admitted under the limits and not
+// closed yet.
+func (c *StreamCounter) Open() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.open
+}
+
+// acquire admits a new stream of the user, returning the function to call
+// once the stream ends, or writes 503 Service Unavailable with a
+// Retry-After header and returns false if the stream would exceed the
+// limits. Handlers acquire the stream before doing any work, so that a
+// rejected request has no effect. A nil counter admits every stream.
+func (c *StreamCounter) acquire(rw http.ResponseWriter, userID string) (release func(), ok bool) {
+	if c == nil {
+		return func() {}, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	limits := c.Limits
+	var reason string
+	switch {
+	case limits.Max > 0 && c.open >= limits.Max:
+		reason = fmt.Sprintf("too many event streams, the limit is %d", limits.Max)
+	case limits.MaxPerUser > 0 && c.perUser[userID] >= limits.MaxPerUser:
+		reason = fmt.Sprintf("too many event streams for user %q, the limit is %d", userID, limits.MaxPerUser)
+	}
+	if reason != "" {
+		retryAfter := limits.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = defaultStreamRetryAfter
+		}
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(rw, reason, http.StatusServiceUnavailable)
+		return nil, false
+	}
+	if c.perUser == nil {
+		c.perUser = make(map[string]int)
+	}
+	c.open++
+	c.perUser[userID]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.open--
+			if c.perUser[userID]--; c.perUser[userID] <= 0 {
+				delete(c.perUser, userID)
+			}
+		})
+	}, true
+}
+
+// Middleware returns a middleware counting the responses with the
+// text/event-stream content type until their handler returns.
+func (c *StreamCounter) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			w := &streamResponseWriter{ResponseWriter: rw, counter: c}
+			defer func() {
+				if w.counted {
+					c.active.Add(-1)
+				}
+			}()
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// streamResponseWriter counts the response when it starts as an event
+// stream.
+type streamResponseWriter struct {
+	http.ResponseWriter
+	counter *StreamCounter
+	started bool
+	counted bool
+}
+
+func (w *streamResponseWriter) WriteHeader(code int) {
+	w.start()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *streamResponseWriter) Write(b []byte) (int, error) {
+	w.start()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *streamResponseWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		w.counted = true
+		w.counter.active.Add(1)
+	}
+}
+
+// Unwrap lets [http.ResponseController] reach the wrapped writer, for
+// instance to flush the events.
+func (w *streamResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
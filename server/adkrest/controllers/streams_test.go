@@ -0,0 +1,173 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/session"
+)
+
+func TestStreamCounter(t *testing.T) {
+	counter := &controllers.StreamCounter{}
+	var during int64
+	stream := counter.Middleware()(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		rw.WriteHeader(http.StatusOK)
+		if err := http.NewResponseController(rw).Flush(); err != nil {
+			t.Errorf("Flush() error = %v", err)
+		}
+		during = counter.Active()
+	}))
+	plain := counter.Middleware()(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if _, err := rw.Write([]byte("{}")); err != nil {
+			t.Errorf("Write() error = %v", err)
+		}
+		during = counter.Active()
+	}))
+
+	stream.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if during != 1 {
+		t.Errorf("Active() while streaming = %d, want 1", during)
+	}
+	plain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if during != 0 {
+		t.Errorf("Active() while serving a plain response = %d, want 0", during)
+	}
+	if got := counter.Active(); got != 0 {
+		t.Errorf("Active() after the responses = %d, want 0", got)
+	}
+}
+
+// watchServer serves the user event streams, limited by the counter.
+func watchServer(t *testing.T, counter *controllers.StreamCounter) *httptest.Server {
+	t.Helper()
+	apiController := controllers.NewSessionsAPIControllerWithConfig(session.InMemoryService(), controllers.SessionsAPIConfig{Streams: counter})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": req.URL.Query().Get("user")})
+		apiController.WatchUserEventsHandler(rw, req)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openStream opens an event stream of the user, returning the response and
+// the function closing the connection.
+func openStream(t *testing.T, server *httptest.Server, user string) (*http.Response, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/?user="+user, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, cancel
+}
+
+// waitOpen waits until the counter has the given number of open streams.
+func waitOpen(t *testing.T, counter *controllers.StreamCounter, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for counter.Open() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Open() = %d, want %d", counter.Open(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamCounter_Limits(t *testing.T) {
+	counter := &controllers.StreamCounter{Limits: controllers.StreamLimits{Max: 3, MaxPerUser: 2, RetryAfter: 1500 * time.Millisecond}}
+	server := watchServer(t, counter)
+
+	var closers []context.CancelFunc
+	for _, user := range []string{"alice", "alice", "bob"} {
+		resp, cancel := openStream(t, server, user)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("stream of %s returned status %d, want %d", user, resp.StatusCode, http.StatusOK)
+		}
+		closers = append(closers, cancel)
+	}
+	waitOpen(t, counter, 3)
+
+	// Both the total and the per-user limits are reached.
+	for _, user := range []string{"alice", "carol"} {
+		resp, cancel := openStream(t, server, user)
+		defer cancel()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("stream of %s past the limits returned status %d, want %d", user, resp.StatusCode, http.StatusServiceUnavailable)
+		}
+		if got := resp.Header.Get("Retry-After"); got != "2" {
+			t.Errorf("Retry-After = %q, want %q", got, "2")
+		}
+	}
+	waitOpen(t, counter, 3)
+
+	// Closing the stream of bob makes room for one stream, but alice is still
+	// at her limit.
+	closers[2]()
+	waitOpen(t, counter, 2)
+	resp, cancel := openStream(t, server, "alice")
+	defer cancel()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("stream of alice past her limit returned status %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	resp, cancel = openStream(t, server, "carol")
+	defer cancel()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("stream of carol after a close returned status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	waitOpen(t, counter, 3)
+
+	// Once every client disconnects, the counts are back to zero and the
+	// limits admit new streams.
+	closers[0]()
+	closers[1]()
+	cancel()
+	waitOpen(t, counter, 0)
+	for _, user := range []string{"alice", "alice"} {
+		resp, cancel := openStream(t, server, user)
+		defer cancel()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("stream of %s after the disconnects returned status %d, want %d", user, resp.StatusCode, http.StatusOK)
+		}
+	}
+	waitOpen(t, counter, 2)
+}
+
+func TestStreamCounter_NoLimits(t *testing.T) {
+	counter := &controllers.StreamCounter{}
+	server := watchServer(t, counter)
+	for range 5 {
+		resp, cancel := openStream(t, server, "alice")
+		defer cancel()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("stream returned status %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	}
+	waitOpen(t, counter, 5)
+}
@@ -0,0 +1,69 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// SyncSessionHandler returns the events appended to a session and the state
+// keys changed since the sync token of the token query parameter, along with
+// the token of the next sync, see [models.SyncSession]. Without a token, or
+// when its event is no longer stored, the whole session is returned with
+// reset set. Malformed tokens are rejected with 400.
+func (c *SessionsAPIController) SyncSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	sessionID, err := models.SessionIDFromHTTPParameters(mux.Vars(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	token := req.URL.Query().Get("token")
+	if token != "" {
+		if _, err := models.DecodeSyncToken(token); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	storedSession, err := c.service.Get(req.Context(), &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	resp, err := models.SyncSession(
+		slices.Collect(storedSession.Session.Events().All()),
+		maps.Collect(storedSession.Session.State().All()),
+		token,
+	)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(resp, http.StatusOK, rw)
+}
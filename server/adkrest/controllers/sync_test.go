@@ -0,0 +1,156 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestSyncSession(t *testing.T) {
+	service := session.InMemoryService()
+	apiController := controllers.NewSessionsAPIController(service)
+	created, err := service.Create(t.Context(), &session.CreateRequest{
+		AppName:   "testApp",
+		UserID:    "testUser",
+		SessionID: "s1",
+		State:     map[string]any{"a": "1", "app:x": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := service.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "s2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvent := func(t *testing.T, s session.Session, id string, delta map[string]any) {
+		t.Helper()
+		event := session.NewEvent("inv")
+		event.ID = id
+		event.Actions.StateDelta = delta
+		if err := service.AppendEvent(t.Context(), s, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync := func(t *testing.T, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/s1/sync?token="+url.QueryEscape(token), nil)
+		req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "s1"})
+		rr := httptest.NewRecorder()
+		apiController.SyncSessionHandler(rr, req)
+		return rr
+	}
+	type delta struct {
+		EventIDs         []string
+		State            map[string]any
+		RemovedKeys      []string
+		Reset            bool
+		SharedStateReset bool
+	}
+	round := func(t *testing.T, token string, want delta) string {
+		t.Helper()
+		rr := sync(t, token)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("sync returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var resp models.SyncResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		got := delta{
+			EventIDs:         []string{},
+			State:            resp.State,
+			RemovedKeys:      resp.RemovedKeys,
+			Reset:            resp.Reset,
+			SharedStateReset: resp.SharedStateReset,
+		}
+		for _, event := range resp.Events {
+			got.EventIDs = append(got.EventIDs, event.ID)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("sync mismatch (-want +got):\n%s", diff)
+		}
+		return resp.SyncToken
+	}
+
+	appendEvent(t, created.Session, "e1", map[string]any{"a": "2"})
+	token := round(t, "", delta{
+		EventIDs:    []string{"e1"},
+		State:       map[string]any{"a": "2", "app:x": "1"},
+		RemovedKeys: []string{},
+		Reset:       true,
+	})
+
+	appendEvent(t, created.Session, "e2", map[string]any{"b": "new"})
+	appendEvent(t, created.Session, "e3", map[string]any{"a": nil})
+	token = round(t, token, delta{
+		EventIDs:    []string{"e2", "e3"},
+		State:       map[string]any{"b": "new"},
+		RemovedKeys: []string{"a"},
+	})
+
+	token = round(t, token, delta{
+		EventIDs:    []string{},
+		State:       map[string]any{},
+		RemovedKeys: []string{},
+	})
+
+	// The app state is changed by another session, without an event of s1.
+	appendEvent(t, other.Session, "o1", map[string]any{"app:x": "2"})
+	appendEvent(t, created.Session, "e4", map[string]any{"b": "newer"})
+	staleToken := token
+	token = round(t, token, delta{
+		EventIDs:         []string{"e4"},
+		State:            map[string]any{"b": "newer", "app:x": "2"},
+		RemovedKeys:      []string{},
+		SharedStateReset: true,
+	})
+	round(t, token, delta{
+		EventIDs:    []string{},
+		State:       map[string]any{},
+		RemovedKeys: []string{},
+	})
+
+	// Replaying a token returns the same changes again.
+	round(t, staleToken, delta{
+		EventIDs:         []string{"e4"},
+		State:            map[string]any{"b": "newer", "app:x": "2"},
+		RemovedKeys:      []string{},
+		SharedStateReset: true,
+	})
+
+	// A token whose event is unknown resets the client.
+	unknown := models.EncodeSyncToken(models.SyncToken{EventID: "o1"})
+	round(t, unknown, delta{
+		EventIDs:    []string{"e1", "e2", "e3", "e4"},
+		State:       map[string]any{"b": "newer", "app:x": "2"},
+		RemovedKeys: []string{},
+		Reset:       true,
+	})
+
+	if rr := sync(t, "not-a-token"); rr.Code != http.StatusBadRequest {
+		t.Errorf("sync with a malformed token returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// SessionTemplate is the initial state and the seed events of the sessions
+// created from it, e.g. the configuration and the system prompt of a kind
+// of conversation.
+type SessionTemplate struct {
+	// State is the initial state of the session. The values of the state
+	// of the create request override the ones of the template.
+	State map[string]any
+	// Events are appended to the session before the events of the create
+	// request. Each session gets copies with their own IDs and timestamps.
+	Events []*session.Event
+}
+
+// SessionTemplates maps an app name to its templates by name, which clients
+// select with the template field of the create session request.
+type SessionTemplates map[string]map[string]SessionTemplate
+
+// apply returns the create request seeded from the template it names. A
+// template unknown for the app is reported with 400 Bad Request.
+func (t SessionTemplates) apply(appName string, req models.CreateSessionRequest) (models.CreateSessionRequest, error) {
+	if req.Template == "" {
+		return req, nil
+	}
+	if req.Import {
+		return req, newStatusError(fmt.Errorf("a session can't be both imported and created from a template"), http.StatusBadRequest)
+	}
+	template, ok := t[appName][req.Template]
+	if !ok {
+		return req, newStatusError(fmt.Errorf("unknown session template %q for app %q", req.Template, appName), http.StatusBadRequest)
+	}
+	if len(template.State) > 0 {
+		state := maps.Clone(template.State)
+		maps.Copy(state, req.State)
+		req.State = state
+	}
+	if len(template.Events) > 0 {
+		now := time.Now().Unix()
+		events := make([]models.Event, 0, len(template.Events)+len(req.Events))
+		for _, seed := range template.Events {
+			event := models.FromSessionEvent(*seed)
+			event.ID = uuid.NewString()
+			event.Time = now
+			event.Actions.StateDelta = maps.Clone(event.Actions.StateDelta)
+			events = append(events, event)
+		}
+		req.Events = append(events, req.Events...)
+	}
+	return req, nil
+}
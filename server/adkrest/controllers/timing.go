@@ -0,0 +1,104 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DebugTimingHeader is the request header asking the middleware of
+// [NewDebugTimingMiddleware] for the timing breakdown of the request.
+const DebugTimingHeader = "X-Debug-Timing"
+
+// NewDebugTimingMiddleware returns a middleware reporting where the time of
+// the requests with a [DebugTimingHeader] went: the handlers record phases
+// such as decode, normalize, store and encode, sent with the total in a
+// Server-Timing trailer, in milliseconds. The trailer is sent after the
+// body, so that it covers the encoding of the response.
+//
+// The breakdown reveals the internals of the server, only install the
+// middleware for triage.
+func NewDebugTimingMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get(DebugTimingHeader) == "" {
+				next.ServeHTTP(rw, req)
+				return
+			}
+			timings := &phaseTimings{}
+			rw.Header().Add("Trailer", "Server-Timing")
+			start := time.Now()
+			next.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), phaseTimingsKey{}, timings)))
+			timings.add("total", time.Since(start))
+			rw.Header().Set("Server-Timing", timings.String())
+		})
+	}
+}
+
+type phaseTimingsKey struct{}
+
+// phaseTimings accumulates the time spent in the phases of a request, in
+// the order they first started. A nil *phaseTimings records nothing.
+type phaseTimings struct {
+	mu     sync.Mutex
+	names  []string
+	phases map[string]time.Duration
+}
+
+// requestTimings returns the timings recorded for the request, or nil when
+// the request didn't ask for them.
+func requestTimings(req *http.Request) *phaseTimings {
+	timings, _ := req.Context().Value(phaseTimingsKey{}).(*phaseTimings)
+	return timings
+}
+
+// start starts the phase and returns the function ending it.
+func (t *phaseTimings) start(name string) (stop func()) {
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { t.add(name, time.Since(start)) }
+}
+
+func (t *phaseTimings) add(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.phases == nil {
+		t.phases = make(map[string]time.Duration)
+	}
+	if _, ok := t.phases[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.phases[name] += d
+}
+
+// String returns the timings as a Server-Timing header value.
+func (t *phaseTimings) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	metrics := make([]string, 0, len(t.names))
+	for _, name := range t.names {
+		metrics = append(metrics, name+";dur="+strconv.FormatFloat(t.phases[name].Seconds()*1000, 'f', 3, 64))
+	}
+	return strings.Join(metrics, ", ")
+}
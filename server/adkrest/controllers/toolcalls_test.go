@@ -0,0 +1,117 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestGetSessionToolCalls(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	event := func(eventID string, ms int, author string, parts ...*genai.Part) *session.Event {
+		e := session.NewEvent("inv1")
+		e.ID, e.Timestamp, e.Author = eventID, at(ms), author
+		e.Content = &genai.Content{Role: genai.RoleModel, Parts: parts}
+		return e
+	}
+	call := func(callID, name string, args map[string]any) *genai.Part {
+		return &genai.Part{FunctionCall: &genai.FunctionCall{ID: callID, Name: name, Args: args}}
+	}
+	response := func(callID, name string, resp map[string]any) *genai.Part {
+		return &genai.Part{FunctionResponse: &genai.FunctionResponse{ID: callID, Name: name, Response: resp}}
+	}
+
+	longRunning := event("e4", 400, "agent", call("c4", "approve", nil))
+	longRunning.LongRunningToolIDs = []string{"c4"}
+	events := fakes.TestEvents{
+		event("e0", 0, "user", &genai.Part{Text: "Weather in Paris and Rome?"}),
+		// Two parallel calls, answered out of order by separate events.
+		event("e1", 100, "agent", call("c1", "weather", map[string]any{"city": "Paris"}), call("c2", "weather", map[string]any{"city": "Rome"})),
+		event("e2", 350, "user", response("c2", "weather", map[string]any{"sky": "rainy"})),
+		event("e3", 600, "user", response("c1", "weather", map[string]any{"sky": "sunny"})),
+		// A long running call, not answered yet.
+		longRunning,
+		// A response whose call isn't in the session.
+		event("e5", 700, "user", response("gone", "search", map[string]any{"hits": 3.0})),
+		// A call without an ID can't be paired.
+		event("e6", 800, "agent", call("", "clock", nil)),
+	}
+	sessionService := fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{
+		id: {Id: id, SessionState: fakes.TestState{}, SessionEvents: events, UpdatedAt: time.Now()},
+	}}
+	apiController := controllers.NewSessionsAPIController(&sessionService)
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/tool-calls", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, sessionVars(id))
+	rr := httptest.NewRecorder()
+
+	apiController.GetSessionToolCallsHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+	}
+	var got models.ToolCalls
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	timeAt := func(ms int) *time.Time { ts := at(ms); return &ts }
+	latency := func(ms int64) *int64 { return &ms }
+	want := models.ToolCalls{Calls: []models.ToolCall{
+		{
+			ID: "c1", Name: "weather", Status: models.ToolCallCompleted,
+			Args: map[string]any{"city": "Paris"}, Response: map[string]any{"sky": "sunny"},
+			Author: "agent", InvocationID: "inv1", CallEventID: "e1", ResponseEventID: "e3",
+			CalledAt: timeAt(100), RespondedAt: timeAt(600), LatencyMs: latency(500),
+		},
+		{
+			ID: "c2", Name: "weather", Status: models.ToolCallCompleted,
+			Args: map[string]any{"city": "Rome"}, Response: map[string]any{"sky": "rainy"},
+			Author: "agent", InvocationID: "inv1", CallEventID: "e1", ResponseEventID: "e2",
+			CalledAt: timeAt(100), RespondedAt: timeAt(350), LatencyMs: latency(250),
+		},
+		{
+			ID: "c4", Name: "approve", Status: models.ToolCallPending,
+			Author: "agent", InvocationID: "inv1", LongRunning: true, CallEventID: "e4", CalledAt: timeAt(400),
+		},
+		{
+			ID: "gone", Name: "search", Status: models.ToolCallUnmatched,
+			Response: map[string]any{"hits": 3.0}, InvocationID: "inv1", ResponseEventID: "e5", RespondedAt: timeAt(700),
+		},
+		{
+			Name: "clock", Status: models.ToolCallPending,
+			Author: "agent", InvocationID: "inv1", CallEventID: "e6", CalledAt: timeAt(800),
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("tool calls mismatch (-want +got):\n%s", diff)
+	}
+}
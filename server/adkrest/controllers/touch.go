@@ -0,0 +1,59 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// TouchSessionHandler extends the expiry of a session without changing it,
+// see [session.TouchService], so that its ETag stays the same. Touching is
+// accepted in read-only mode, since it keeps the sessions being read alive.
+// It fails with 501 when the sessions don't expire.
+func (c *SessionsAPIController) TouchSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	sessionID, err := models.SessionIDFromHTTPParameters(mux.Vars(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	touchService, ok := c.service.(session.TouchService)
+	if !ok {
+		http.Error(rw, "session service does not support touching sessions", http.StatusNotImplemented)
+		return
+	}
+	resp, err := touchService.Touch(req.Context(), &session.TouchRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	touchResp := models.TouchResponse{}
+	if !resp.ExpiresAt.IsZero() {
+		touchResp.ExpiresAt = &resp.ExpiresAt
+	}
+	EncodeJSONResponse(touchResp, http.StatusOK, rw)
+}
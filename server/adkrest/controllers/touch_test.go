@@ -0,0 +1,105 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestTouchSession(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{
+		SessionTTL: time.Hour,
+		Now:        func() time.Time { return now },
+	})
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"k": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Touching is accepted in read-only mode.
+	readOnly := &controllers.ReadOnlyMode{}
+	readOnly.SetEnabled(true)
+	apiController := controllers.NewSessionsAPIControllerWithConfig(sessionService, controllers.SessionsAPIConfig{ReadOnly: readOnly})
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}
+	call := func(t *testing.T, handler http.HandlerFunc, method string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, "/apps/testApp/users/testUser/sessions/testSession", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	etag := func(t *testing.T) string {
+		t.Helper()
+		rr := call(t, apiController.GetSessionHandler, http.MethodGet)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("get returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		return rr.Header().Get("ETag")
+	}
+	before := etag(t)
+
+	now = now.Add(50 * time.Minute)
+	rr := call(t, apiController.TouchSessionHandler, http.MethodPost)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("touch returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var got models.TouchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if want := now.Add(time.Hour); got.ExpiresAt == nil || !got.ExpiresAt.Equal(want) {
+		t.Errorf("expiresAt = %v, want %v", got.ExpiresAt, want)
+	}
+
+	// The session outlives its initial expiry, unchanged.
+	now = now.Add(30 * time.Minute)
+	if after := etag(t); after != before {
+		t.Errorf("ETag after touch = %q, want %q", after, before)
+	}
+	now = now.Add(31 * time.Minute)
+	if rr := call(t, apiController.TouchSessionHandler, http.MethodPost); rr.Code == http.StatusOK {
+		t.Errorf("touch of the expired session succeeded, want an error")
+	}
+}
+
+func TestTouchSession_Unsupported(t *testing.T) {
+	apiController := controllers.NewSessionsAPIController(&fakes.FakeSessionService{})
+	req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/touch", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+	rr := httptest.NewRecorder()
+
+	apiController.TouchSessionHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// GetSessionTranscriptHandler returns the conversation of a session as a
+// chat transcript of role and content turns, for consumers like fine-tuning
+// pipelines which don't need the structure of the events. Partial events
+// are always collapsed, see [models.TranscriptFromEvents].
+func (c *SessionsAPIController) GetSessionTranscriptHandler(rw http.ResponseWriter, req *http.Request) {
+	sessionID, err := models.SessionIDFromHTTPParameters(mux.Vars(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	storedSession, err := c.service.Get(req.Context(), &session.GetRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	sessionEvents := session.CollapsePartials(slices.Collect(storedSession.Session.Events().All()))
+	events := make([]models.Event, 0, len(sessionEvents))
+	for _, event := range sessionEvents {
+		events = append(events, models.FromSessionEvent(*event))
+	}
+	EncodeJSONResponse(models.TranscriptFromEvents(events), http.StatusOK, rw)
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/fakes"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestGetSessionTranscript(t *testing.T) {
+	id := fakes.SessionKey{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}
+	event := func(invocationID, author string, partial bool, content *genai.Content) *session.Event {
+		e := session.NewEvent(invocationID)
+		e.Author, e.Partial, e.Content = author, partial, content
+		return e
+	}
+	events := fakes.TestEvents{
+		event("inv1", "user", false, genai.NewContentFromText("What's the weather in Paris?", genai.RoleUser)),
+		// The agent calls a tool, whose response is not conversational.
+		event("inv1", "agent", false, genai.NewContentFromFunctionCall("weather", map[string]any{"city": "Paris"}, genai.RoleModel)),
+		event("inv1", "user", false, genai.NewContentFromFunctionResponse("weather", map[string]any{"sky": "sunny"}, genai.RoleUser)),
+		// The answer streams, the partial events are superseded by the final one.
+		event("inv1", "agent", true, genai.NewContentFromText("It is", genai.RoleModel)),
+		event("inv1", "agent", true, genai.NewContentFromText("It is sunny", genai.RoleModel)),
+		event("inv1", "agent", false, &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{
+			{Text: "The user wants the weather.", Thought: true},
+			{Text: "It is sunny "},
+			{Text: "in Paris."},
+		}}),
+		// A state update without content.
+		event("", "user", false, nil),
+		event("inv2", "user", false, genai.NewContentFromText("Thanks!", genai.RoleUser)),
+		// The last answer is still streaming.
+		event("inv2", "agent", true, genai.NewContentFromText("You're", genai.RoleModel)),
+	}
+	sessionService := fakes.FakeSessionService{Sessions: map[fakes.SessionKey]fakes.TestSession{
+		id: {Id: id, SessionState: fakes.TestState{}, SessionEvents: events, UpdatedAt: time.Now()},
+	}}
+	apiController := controllers.NewSessionsAPIController(&sessionService)
+	req, err := http.NewRequest(http.MethodGet, "/apps/testApp/users/testUser/sessions/testSession/transcript", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, sessionVars(id))
+	rr := httptest.NewRecorder()
+
+	apiController.GetSessionTranscriptHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, http.StatusOK, rr.Body.String())
+	}
+	var got models.Transcript
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := models.Transcript{Turns: []models.TranscriptTurn{
+		{Role: "user", Content: "What's the weather in Paris?"},
+		{Role: "assistant", Content: "It is sunny in Paris."},
+		{Role: "user", Content: "Thanks!"},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("transcript mismatch (-want +got):\n%s", diff)
+	}
+}
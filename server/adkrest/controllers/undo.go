@@ -0,0 +1,91 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// UndoSessionHandler reverts the most recent state change of the session,
+// see [session.UndoService]. It fails with 409 Conflict when there is
+// nothing to undo, and with 501 when undo isn't enabled for the app.
+func (c *SessionsAPIController) UndoSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	c.undoOrRedo(rw, req, AuditUndo, session.UndoService.Undo)
+}
+
+// RedoSessionHandler reapplies the most recently undone state change of the
+// session. It fails with 409 Conflict when there is nothing to redo.
+func (c *SessionsAPIController) RedoSessionHandler(rw http.ResponseWriter, req *http.Request) {
+	c.undoOrRedo(rw, req, AuditRedo, session.UndoService.Redo)
+}
+
+func (c *SessionsAPIController) undoOrRedo(rw http.ResponseWriter, req *http.Request, operation string, apply func(session.UndoService, context.Context, *session.UndoRequest) (*session.UndoResponse, error)) {
+	if c.config.ReadOnly.rejectWrite(rw) {
+		return
+	}
+	sessionID, err := models.SessionIDFromHTTPParameters(mux.Vars(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionID.ID == "" {
+		http.Error(rw, "session_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	undoService, ok := c.service.(session.UndoService)
+	if !ok {
+		http.Error(rw, "session service does not support undo", http.StatusNotImplemented)
+		return
+	}
+	// The changed keys are only known once the service picks the change
+	// undone or redone.
+	audited, err := c.config.Audit.begin(req, AuditRecord{
+		Operation: operation,
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	resp, err := apply(undoService, leaseContext(req), &session.UndoRequest{
+		AppName:   sessionID.AppName,
+		UserID:    sessionID.UserID,
+		SessionID: sessionID.ID,
+	})
+	audited(err)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	respSession, err := models.FromSession(resp.Session)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	EncodeJSONResponse(models.UndoResponse{
+		Session:   respSession,
+		Event:     models.FromSessionEvent(*resp.Event),
+		UndoDepth: resp.UndoDepth,
+		RedoDepth: resp.RedoDepth,
+	}, http.StatusOK, rw)
+}
@@ -0,0 +1,108 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+func TestUndoRedoSession(t *testing.T) {
+	sessionService := session.InMemoryServiceWithConfig(session.InMemoryServiceConfig{UndoHistory: session.UndoHistoryLimits{Default: 10}})
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession", State: map[string]any{"theme": "light"}}); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	vars := map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"}
+	call := func(t *testing.T, handler http.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, "/apps/testApp/users/testUser/sessions/testSession", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	patch := func(t *testing.T, body string) {
+		t.Helper()
+		if rr := call(t, apiController.UpdateSessionHandler, http.MethodPatch, body); rr.Code != http.StatusOK {
+			t.Fatalf("patch returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+	step := func(t *testing.T, handler http.HandlerFunc, wantState map[string]any, undoDepth, redoDepth int) {
+		t.Helper()
+		rr := call(t, handler, http.MethodPost, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got models.UndoResponse
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if diff := cmp.Diff(wantState, got.Session.State); diff != "" {
+			t.Errorf("state mismatch (-want +got):\n%s", diff)
+		}
+		if got.UndoDepth != undoDepth || got.RedoDepth != redoDepth {
+			t.Errorf("depths = %d, %d, want %d, %d", got.UndoDepth, got.RedoDepth, undoDepth, redoDepth)
+		}
+		if got.Event.ID == "" || got.Event.Author != "user" {
+			t.Errorf("event = %+v, want the appended user event", got.Event)
+		}
+	}
+
+	patch(t, `{"stateDelta": {"theme": "dark", "font": "mono"}}`)
+	patch(t, `{"stateDelta": {"font": {"$adk_state_update": "delete"}}}`)
+
+	step(t, apiController.UndoSessionHandler, map[string]any{"theme": "dark", "font": "mono"}, 1, 1)
+	step(t, apiController.UndoSessionHandler, map[string]any{"theme": "light"}, 0, 2)
+	if rr := call(t, apiController.UndoSessionHandler, http.MethodPost, ""); rr.Code != http.StatusConflict {
+		t.Errorf("undo with an empty stack returned status %v, want %v", rr.Code, http.StatusConflict)
+	}
+	step(t, apiController.RedoSessionHandler, map[string]any{"theme": "dark", "font": "mono"}, 1, 1)
+	step(t, apiController.RedoSessionHandler, map[string]any{"theme": "dark"}, 2, 0)
+	if rr := call(t, apiController.RedoSessionHandler, http.MethodPost, ""); rr.Code != http.StatusConflict {
+		t.Errorf("redo with an empty stack returned status %v, want %v", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestUndoSession_NotEnabled(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "testApp", UserID: "testUser", SessionID: "testSession"}); err != nil {
+		t.Fatal(err)
+	}
+	apiController := controllers.NewSessionsAPIController(sessionService)
+	req, err := http.NewRequest(http.MethodPost, "/apps/testApp/users/testUser/sessions/testSession/undo", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"app_name": "testApp", "user_id": "testUser", "session_id": "testSession"})
+	rr := httptest.NewRecorder()
+	apiController.UndoSessionHandler(rr, req)
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
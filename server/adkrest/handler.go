@@ -15,36 +15,367 @@
 package adkrest
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
 	"net/http"
+	"slices"
 	"time"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/gorilla/mux"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"google.golang.org/adk/cmd/launcher"
 	"google.golang.org/adk/internal/telemetry"
 	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
 	"google.golang.org/adk/server/adkrest/internal/routers"
 	"google.golang.org/adk/server/adkrest/internal/services"
 )
 
+// ServerConfig contains the settings of the ADK REST API handler.
+type ServerConfig struct {
+	// SSEWriteTimeout is the write timeout of the SSE responses.
+	SSEWriteTimeout time.Duration
+	// PageTokenSecret is the key signing the page tokens of the list
+	// endpoints. The servers behind a load balancer must share it.
+	// Optional: if empty, a random key is generated at startup.
+	PageTokenSecret []byte
+	// PageSizes are the default and maximum page sizes of the list
+	// endpoints. Optional: default to 100 and 1000 items.
+	PageSizes controllers.PageSizes
+	// PathNormalization is applied to the requests whose path has a trailing
+	// slash, duplicate slashes or dot segments. Optional: defaults to
+	// redirecting them to the canonical path.
+	PathNormalization controllers.PathNormalization
+	// StreamLimits caps the SSE streams served at once, in total and per
+	// user. Streams past the limits are rejected with 503 and a
+	// Retry-After header. Optional: by default streams are not limited.
+	StreamLimits controllers.StreamLimits
+	// ContentTypes are the media types accepted on request bodies. Bodies
+	// with a missing or other Content-Type fail with 415, unless the policy
+	// is lenient. Optional: by default JSON is required, and the multipart
+	// form of the [controllers.DefaultRouteMediaTypes] on their route.
+	ContentTypes controllers.ContentTypePolicy
+	// ReadOnly starts the server in read-only mode, where session writes
+	// and agent runs fail with 503 while reads, and the touches keeping
+	// the sessions being read alive, keep working.
+	ReadOnly bool
+	// StrictDecoding rejects session request bodies with unknown fields
+	// with 400 instead of ignoring the fields.
+	StrictDecoding bool
+	// RejectDuplicateKeys rejects session request bodies with an object
+	// holding the same key twice with 400, instead of keeping the last
+	// value.
+	RejectDuplicateKeys bool
+	// DirectiveAliases maps deprecated state delta directive names to the
+	// built-in directive they stand for. Their use is logged as deprecated.
+	DirectiveAliases map[string]string
+	// DeprecationHeaders also reports deprecated directive aliases to the
+	// client, in Warning response headers.
+	DeprecationHeaders bool
+	// UnknownDirectives is applied to the state delta directives with an
+	// unknown name: rejecting the delta, ignoring the key or setting the
+	// directive as a raw value. Optional: defaults to rejecting the delta.
+	UnknownDirectives controllers.UnknownDirectivePolicy
+	// MaxStateDepth is the nesting depth past which the states and state
+	// deltas submitted by clients are rejected with 400. Optional: defaults
+	// to [controllers.DefaultMaxStateDepth].
+	MaxStateDepth int
+	// MaxStateKeys bounds the number of keys of a session state, the state
+	// patches growing it past the limit being rejected with 422. Optional:
+	// if zero, the number of keys is not limited.
+	MaxStateKeys int
+	// ArchiveKey is the HMAC key signing the session exports asking for a
+	// signature, and verifying the signed imports. Optional: if empty,
+	// exports can only carry a checksum.
+	ArchiveKey []byte
+	// RequireSignedImports rejects the session imports which aren't signed
+	// with ArchiveKey.
+	RequireSignedImports bool
+	// AllowedAuthors maps an app name to the authors allowed on the events
+	// clients submit for it. Apps without an entry accept any author.
+	AllowedAuthors map[string][]string
+	// StateKeys enforces naming rules on the state keys written by clients.
+	// Optional: if nil, only the reserved $adk_ namespace is rejected.
+	StateKeys *controllers.StateKeyPolicy
+	// AllowedStateKeys maps an app name to the top-level state keys clients
+	// may write for it, with their scope prefix. Writes of other keys are
+	// rejected with 422. Apps without an entry accept any key.
+	AllowedStateKeys controllers.StateKeyAllowlist
+	// StateCoercion maps an app name to the types of its state keys, the
+	// string values clients send for them being coerced to numbers and
+	// booleans. Optional: by default values are kept as sent.
+	StateCoercion controllers.StateCoercion
+	// EventSchemas maps an app name to the JSON Schema the events clients
+	// submit for it must conform to. Apps without an entry accept any event.
+	EventSchemas map[string]*jsonschema.Schema
+	// SessionTemplates maps an app name to the templates, by name, of the
+	// initial state and events clients can create its sessions from.
+	SessionTemplates controllers.SessionTemplates
+	// SkipNoopStateDeltas makes the state patches which wouldn't change the
+	// state of the session append nothing, so that its update time and
+	// ETag stay unchanged. By default every patch appends an event.
+	SkipNoopStateDeltas bool
+	// ProtectSystemState reserves the system state keys, see
+	// [session.KeyPrefixSystem], to the server: the writes of clients are
+	// rejected with 403 and the runs whose agents write them fail. They are
+	// written with the admin API.
+	ProtectSystemState bool
+	// ProjectableEventFields are the JSON fields of events clients may keep
+	// or leave out with the fields and excludeFields query parameters of
+	// the event listings. Optional: if nil, any event field may be
+	// projected.
+	ProjectableEventFields []string
+	// WatchReordering holds the events of the user event streams briefly,
+	// to send the events of a session delivered out of order in sequence
+	// order. Optional: by default events are sent as they arrive.
+	WatchReordering controllers.EventReordering
+	// ReadYourWrites returns the version of the sessions written by state
+	// patches and event appends, and makes the reads of sessions, of their
+	// state and of their events requiring a version wait for it.
+	// Optional: by default reads are served as the service returns them.
+	ReadYourWrites controllers.ReadYourWrites
+	// EventEnrichment records server context, like the request ID and the
+	// authenticated principal, on the events appended through the sessions
+	// API, as tags clients can't spoof. Optional: if nil, events are stored
+	// as submitted.
+	EventEnrichment *controllers.EventEnrichment
+	// Audit writes an audit record of every mutation of a session through
+	// the sessions and admin APIs, before it is applied, see
+	// [controllers.AuditLog]. Optional: if nil, mutations aren't audited.
+	Audit *controllers.AuditLog
+	// MaxAttachmentSize is the size limit in bytes of the files uploaded as
+	// event attachments, stored in the artifact service. Optional: defaults
+	// to 32 MiB.
+	MaxAttachmentSize int64
+	// CollapsePartials leaves the partial events superseded by a final one
+	// out of the sessions and events returned, unless clients ask for them
+	// with collapsePartials=false. Stored events are untouched.
+	CollapsePartials bool
+	// EnableAdminAPI registers the /admin routes, for instance the one
+	// toggling the read-only mode at runtime or the one reporting the
+	// effective configuration and runtime statistics. The routes are only
+	// registered with an Authenticator, which restricts them to AdminUsers,
+	// or with InsecureAdminAPI.
+	EnableAdminAPI bool
+	// InsecureAdminAPI registers the admin routes of EnableAdminAPI without
+	// an Authenticator. They don't check any permission then, only set it
+	// when the server is not reachable by untrusted clients.
+	InsecureAdminAPI bool
+	// AdminUsers are the authenticated users allowed to call the admin
+	// routes when an Authenticator is set. Other users get 403.
+	AdminUsers []string
+	// DebugTiming lets clients send the [controllers.DebugTimingHeader]
+	// request header to get the time spent in the phases of the request,
+	// like decoding or storing, in a Server-Timing trailer. Only enable it
+	// for triage: the breakdown reveals the internals of the server.
+	DebugTiming bool
+	// OnPanic reports the panics recovered while serving requests, which
+	// fail with 500 instead of crashing the server.
+	// Optional: by default the panics are logged with their stack.
+	OnPanic controllers.PanicFunc
+	// Authenticator enables bearer token authentication of every request.
+	// The user of a request is the authenticated principal, the user_id path
+	// segment becomes optional and must match the principal when present.
+	// Authentication is disabled when nil.
+	Authenticator Authenticator
+	// AccessDenial answers the authenticated requests for the sessions of
+	// other users. Optional: defaults to 404 Not Found, exactly as for a
+	// missing session, so that the existence of the sessions of other users
+	// doesn't leak; [controllers.DenyAsForbidden] answers 403 instead.
+	AccessDenial controllers.AccessDenial
+	// ResponseHeaders are set on every response, on top of the
+	// [controllers.DefaultResponseHeaders]. A header with no value removes
+	// the header, including a default one.
+	ResponseHeaders http.Header
+	// RouteResponseHeaders maps a route name, such as "GetSession", to the
+	// headers set on its responses, on top of ResponseHeaders.
+	RouteResponseHeaders map[string]http.Header
+	// Serializers encode the response bodies, in the media type the Accept
+	// header of each request prefers, see
+	// [controllers.NewSerializerMiddleware]. Embedders append their own to
+	// the [controllers.DefaultSerializers].
+	// Optional: defaults to the [controllers.DefaultSerializers].
+	Serializers []controllers.Serializer
+}
+
+// Authenticator authenticates the bearer token of a request.
+type Authenticator interface {
+	// Authenticate returns the user ID of the principal the token belongs
+	// to, or an error if the token is not valid.
+	Authenticate(ctx context.Context, token string) (userID string, err error)
+}
+
 // NewHandler creates and returns an http.Handler for the ADK REST API.
 func NewHandler(config *launcher.Config, sseWriteTimeout time.Duration) http.Handler {
+	return NewHandlerWithConfig(config, ServerConfig{SSEWriteTimeout: sseWriteTimeout})
+}
+
+// NewHandlerWithConfig creates and returns an http.Handler for the ADK REST
+// API using the given server config.
+func NewHandlerWithConfig(config *launcher.Config, serverConfig ServerConfig) http.Handler {
 	adkExporter := services.NewAPIServerSpanExporter()
 	telemetry.AddSpanProcessor(sdktrace.NewSimpleSpanProcessor(adkExporter))
 
-	router := mux.NewRouter().StrictSlash(true)
+	readOnly := &controllers.ReadOnlyMode{}
+	readOnly.SetEnabled(serverConfig.ReadOnly)
+
+	streams := &controllers.StreamCounter{Limits: serverConfig.StreamLimits}
+
+	sessionsController := controllers.NewSessionsAPIControllerWithConfig(config.SessionService, controllers.SessionsAPIConfig{
+		ReadOnly:               readOnly,
+		StrictDecoding:         serverConfig.StrictDecoding,
+		RejectDuplicateKeys:    serverConfig.RejectDuplicateKeys,
+		DirectiveAliases:       serverConfig.DirectiveAliases,
+		DeprecationHeaders:     serverConfig.DeprecationHeaders,
+		UnknownDirectives:      serverConfig.UnknownDirectives,
+		MaxStateDepth:          serverConfig.MaxStateDepth,
+		MaxStateKeys:           serverConfig.MaxStateKeys,
+		SkipNoopStateDeltas:    serverConfig.SkipNoopStateDeltas,
+		ProtectSystemState:     serverConfig.ProtectSystemState,
+		ArchiveKey:             serverConfig.ArchiveKey,
+		RequireSignedImports:   serverConfig.RequireSignedImports,
+		AllowedAuthors:         serverConfig.AllowedAuthors,
+		StateKeys:              serverConfig.StateKeys,
+		AllowedStateKeys:       serverConfig.AllowedStateKeys,
+		StateCoercion:          serverConfig.StateCoercion,
+		EventSchemas:           serverConfig.EventSchemas,
+		Templates:              serverConfig.SessionTemplates,
+		EventEnrichment:        serverConfig.EventEnrichment,
+		Audit:                  serverConfig.Audit,
+		Artifacts:              config.ArtifactService,
+		MaxAttachmentSize:      serverConfig.MaxAttachmentSize,
+		CollapsePartials:       serverConfig.CollapsePartials,
+		PageTokenSecret:        serverConfig.PageTokenSecret,
+		PageSizes:              serverConfig.PageSizes,
+		Streams:                streams,
+		WatchReordering:        serverConfig.WatchReordering,
+		ReadYourWrites:         serverConfig.ReadYourWrites,
+		ProjectableEventFields: serverConfig.ProjectableEventFields,
+		Traces:                 adkExporter.EventTrace,
+	})
+
+	// Routes are matched on the escaped path, normalized by the middleware
+	// wrapping the router, so that encoded slashes stay within their IDs.
+	router := mux.NewRouter().StrictSlash(true).SkipClean(true).UseEncodedPath()
 	// TODO: Allow taking a prefix to allow customizing the path
 	// where the ADK REST API will be served.
-	setupRouter(router,
-		routers.NewSessionsAPIRouter(controllers.NewSessionsAPIController(config.SessionService)),
-		routers.NewRuntimeAPIRouter(controllers.NewRuntimeAPIController(config.SessionService, config.AgentLoader, config.ArtifactService, sseWriteTimeout)),
+	subrouters := []routers.Router{
+		routers.NewSessionsAPIRouter(sessionsController),
+		routers.NewRuntimeAPIRouter(controllers.NewRuntimeAPIControllerWithConfig(controllers.RuntimeAPIConfig{
+			SessionService:     config.SessionService,
+			AgentLoader:        config.AgentLoader,
+			ArtifactService:    config.ArtifactService,
+			SSEWriteTimeout:    serverConfig.SSEWriteTimeout,
+			Streams:            streams,
+			ProtectSystemState: serverConfig.ProtectSystemState,
+			AccessDenial:       serverConfig.AccessDenial,
+			Sessions:           sessionsController,
+			ReadOnly:           readOnly,
+		})),
 		routers.NewAppsAPIRouter(controllers.NewAppsAPIController(config.AgentLoader)),
 		routers.NewDebugAPIRouter(controllers.NewDebugAPIController(config.SessionService, config.AgentLoader, adkExporter)),
 		routers.NewArtifactsAPIRouter(controllers.NewArtifactsAPIController(config.ArtifactService)),
+		routers.NewMetricsAPIRouter(controllers.NewMetricsAPIController(config.SessionService)),
 		&routers.EvalAPIRouter{},
-	)
-	return router
+	}
+	if serverConfig.EnableAdminAPI && serverConfig.Authenticator == nil && !serverConfig.InsecureAdminAPI {
+		log.Printf("admin API not registered: it requires an Authenticator, or InsecureAdminAPI to serve it unauthenticated")
+	}
+	if serverConfig.EnableAdminAPI && (serverConfig.Authenticator != nil || serverConfig.InsecureAdminAPI) {
+		var adminRouter routers.Router = routers.NewAdminAPIRouter(controllers.NewAdminAPIControllerWithConfig(controllers.AdminAPIConfig{
+			ReadOnly:       readOnly,
+			SessionService: config.SessionService,
+			Streams:        streams,
+			AgentLoader:    config.AgentLoader,
+			Settings:       serverSettings(config, serverConfig),
+			Audit:          serverConfig.Audit,
+		}))
+		if serverConfig.Authenticator != nil {
+			adminRouter = routers.WithMiddleware(adminRouter, controllers.NewAdminMiddleware(serverConfig.AdminUsers))
+		}
+		subrouters = append(subrouters, adminRouter)
+	}
+	router.Use(controllers.NewRecoveryMiddleware(serverConfig.OnPanic))
+	router.Use(controllers.NewPathVarsMiddleware())
+	if serverConfig.DebugTiming {
+		router.Use(controllers.NewDebugTimingMiddleware())
+	}
+	router.Use(streams.Middleware())
+	router.Use(controllers.NewResponseHeadersMiddleware(responseHeaders(serverConfig)))
+	if serverConfig.Authenticator != nil {
+		router.Use(controllers.NewAuthMiddlewareWithDenial(serverConfig.Authenticator.Authenticate, serverConfig.AccessDenial))
+		for i, subrouter := range subrouters {
+			subrouters[i] = routers.WithoutUserID(subrouter)
+		}
+	}
+	router.Use(controllers.NewContentTypeMiddleware(contentTypes(serverConfig)))
+	router.Use(controllers.NewSerializerMiddleware(serverConfig.Serializers))
+	setupRouter(router, subrouters...)
+	return controllers.NewPathNormalizationMiddleware(serverConfig.PathNormalization)(router)
+}
+
+// serverSettings returns the configuration reported by the admin API. The
+// authenticator and the panic hook are only reported as being set, and
+// services by their type, so that no credential they hold can leak.
+func serverSettings(config *launcher.Config, serverConfig ServerConfig) models.ServerSettings {
+	settings := models.ServerSettings{
+		SSEWriteTimeout:     serverConfig.SSEWriteTimeout.String(),
+		StrictDecoding:      serverConfig.StrictDecoding,
+		RejectDuplicateKeys: serverConfig.RejectDuplicateKeys,
+		DirectiveAliases:    serverConfig.DirectiveAliases,
+		DeprecationHeaders:  serverConfig.DeprecationHeaders,
+		CollapsePartials:    serverConfig.CollapsePartials,
+		AllowedAuthors:      serverConfig.AllowedAuthors,
+		EventSchemaApps:     slices.Sorted(maps.Keys(serverConfig.EventSchemas)),
+		Authentication:      serverConfig.Authenticator != nil,
+		AdminUsers:          serverConfig.AdminUsers,
+		PanicHandler:        serverConfig.OnPanic != nil,
+		SessionBackend:      fmt.Sprintf("%T", config.SessionService),
+	}
+	if policy := serverConfig.StateKeys; policy != nil {
+		if policy.Pattern != nil {
+			settings.StateKeyPattern = policy.Pattern.String()
+		}
+		settings.StateKeyNormalized = policy.Normalize != nil || policy.Unicode != controllers.UnicodeNormalizationNone
+	}
+	if config.ArtifactService != nil {
+		settings.ArtifactBackend = fmt.Sprintf("%T", config.ArtifactService)
+	}
+	if config.MemoryService != nil {
+		settings.MemoryBackend = fmt.Sprintf("%T", config.MemoryService)
+	}
+	return settings
+}
+
+// responseHeaders returns the response headers of the config. The routes
+// served without the user path segment have the headers of their route.
+func responseHeaders(serverConfig ServerConfig) controllers.ResponseHeaders {
+	headers := controllers.ResponseHeaders{Default: serverConfig.ResponseHeaders, Routes: maps.Clone(serverConfig.RouteResponseHeaders)}
+	if serverConfig.Authenticator != nil {
+		for name, routeHeaders := range serverConfig.RouteResponseHeaders {
+			headers.Routes[routers.WithoutUserIDRouteName(name)] = routeHeaders
+		}
+	}
+	return headers
+}
+
+// contentTypes returns the content type policy of the config, with the
+// default media types of the routes it doesn't configure. The routes served
+// without the user path segment have the media types of their route.
+func contentTypes(serverConfig ServerConfig) controllers.ContentTypePolicy {
+	policy := serverConfig.ContentTypes
+	policy.Routes = controllers.DefaultRouteMediaTypes()
+	maps.Copy(policy.Routes, serverConfig.ContentTypes.Routes)
+	if serverConfig.Authenticator != nil {
+		for name, mediaTypes := range maps.Clone(policy.Routes) {
+			policy.Routes[routers.WithoutUserIDRouteName(name)] = mediaTypes
+		}
+	}
+	return policy
 }
 
 func setupRouter(router *mux.Router, subrouters ...routers.Router) *mux.Router {
@@ -0,0 +1,713 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adkrest_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/cmd/launcher"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/server/adkrest"
+	"google.golang.org/adk/server/adkrest/controllers"
+	"google.golang.org/adk/server/adkrest/internal/models"
+	"google.golang.org/adk/session"
+)
+
+// tokenAuthenticator maps bearer tokens to user IDs.
+type tokenAuthenticator map[string]string
+
+func (a tokenAuthenticator) Authenticate(ctx context.Context, token string) (string, error) {
+	userID, ok := a[token]
+	if !ok {
+		return "", fmt.Errorf("unknown token")
+	}
+	return userID, nil
+}
+
+func TestNewHandlerWithConfig_Authenticator(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticator adkrest.Authenticator
+		path          string
+		token         string
+		wantStatus    int
+		wantSessions  []string
+	}{
+		{
+			name:          "user_id derived from token",
+			authenticator: tokenAuthenticator{"alice-token": "alice"},
+			path:          "/apps/app/sessions",
+			token:         "alice-token",
+			wantStatus:    http.StatusOK,
+			wantSessions:  []string{"alice-session"},
+		},
+		{
+			name:          "matching path user_id",
+			authenticator: tokenAuthenticator{"alice-token": "alice"},
+			path:          "/apps/app/users/alice/sessions",
+			token:         "alice-token",
+			wantStatus:    http.StatusOK,
+			wantSessions:  []string{"alice-session"},
+		},
+		{
+			name:          "mismatching path user_id",
+			authenticator: tokenAuthenticator{"alice-token": "alice"},
+			path:          "/apps/app/users/bob/sessions",
+			token:         "alice-token",
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "missing token",
+			authenticator: tokenAuthenticator{"alice-token": "alice"},
+			path:          "/apps/app/sessions",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "invalid token",
+			authenticator: tokenAuthenticator{"alice-token": "alice"},
+			path:          "/apps/app/sessions",
+			token:         "bob-token",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:         "auth disabled uses path user_id",
+			path:         "/apps/app/users/bob/sessions",
+			wantStatus:   http.StatusOK,
+			wantSessions: []string{"bob-session"},
+		},
+		{
+			name:       "auth disabled requires path user_id",
+			path:       "/apps/app/sessions",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			for _, userID := range []string{"alice", "bob"} {
+				if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: userID, SessionID: userID + "-session"}); err != nil {
+					t.Fatalf("create session: %v", err)
+				}
+			}
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, adkrest.ServerConfig{
+				Authenticator: tt.authenticator,
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %v, want %v, body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got []struct {
+				ID string `json:"id"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(got) != len(tt.wantSessions) {
+				t.Fatalf("got %d sessions, want %v", len(got), tt.wantSessions)
+			}
+			for i, want := range tt.wantSessions {
+				if got[i].ID != want {
+					t.Errorf("session %d = %q, want %q", i, got[i].ID, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHandlerWithConfig_AccessDenial(t *testing.T) {
+	tests := []struct {
+		name       string
+		denial     controllers.AccessDenial
+		path       string
+		wantStatus int
+	}{
+		{name: "authorized existing", path: "/apps/app/users/alice/sessions/alice-session", wantStatus: http.StatusOK},
+		{name: "authorized missing", path: "/apps/app/users/alice/sessions/missing", wantStatus: http.StatusNotFound},
+		{name: "unauthorized existing", path: "/apps/app/users/bob/sessions/bob-session", wantStatus: http.StatusNotFound},
+		{name: "unauthorized missing", path: "/apps/app/users/bob/sessions/missing", wantStatus: http.StatusNotFound},
+		{name: "forbidden authorized existing", denial: controllers.DenyAsForbidden, path: "/apps/app/users/alice/sessions/alice-session", wantStatus: http.StatusOK},
+		{name: "forbidden authorized missing", denial: controllers.DenyAsForbidden, path: "/apps/app/users/alice/sessions/missing", wantStatus: http.StatusNotFound},
+		{name: "forbidden unauthorized existing", denial: controllers.DenyAsForbidden, path: "/apps/app/users/bob/sessions/bob-session", wantStatus: http.StatusForbidden},
+	}
+	var notFoundBody string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			for _, userID := range []string{"alice", "bob"} {
+				if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: userID, SessionID: userID + "-session"}); err != nil {
+					t.Fatalf("create session: %v", err)
+				}
+			}
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, adkrest.ServerConfig{
+				Authenticator: tokenAuthenticator{"alice-token": "alice"},
+				AccessDenial:  tt.denial,
+			})
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer alice-token")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %v, want %v, body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if rr.Code != http.StatusNotFound {
+				return
+			}
+			// Denied and missing sessions are indistinguishable.
+			if notFoundBody == "" {
+				notFoundBody = rr.Body.String()
+			} else if got := rr.Body.String(); got != notFoundBody {
+				t.Errorf("body = %q, want %q as for the other sessions not found", got, notFoundBody)
+			}
+		})
+	}
+}
+
+// replyAgent replies "ok" to every message.
+func replyAgent(t *testing.T) agent.Agent {
+	t.Helper()
+	a, err := agent.New(agent.Config{
+		Name: "app",
+		Run: func(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
+			return func(yield func(*session.Event, error) bool) {
+				event := session.NewEvent(ctx.InvocationID())
+				event.Author = "app"
+				event.LLMResponse = model.LLMResponse{Content: genai.NewContentFromText("ok", genai.RoleModel)}
+				yield(event, nil)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("agent.New() failed: %v", err)
+	}
+	return a
+}
+
+func TestNewHandlerWithConfig_RunAuthorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		userID     string
+		sessionID  string
+		denial     controllers.AccessDenial
+		wantStatus int
+	}{
+		{name: "run as authenticated user", path: "/run", userID: "alice", sessionID: "alice-session", wantStatus: http.StatusOK},
+		{name: "run without user", path: "/run", sessionID: "alice-session", wantStatus: http.StatusOK},
+		{name: "run as other user", path: "/run", userID: "bob", sessionID: "bob-session", wantStatus: http.StatusNotFound},
+		{name: "run as other user forbidden", path: "/run", userID: "bob", sessionID: "bob-session", denial: controllers.DenyAsForbidden, wantStatus: http.StatusForbidden},
+		{name: "sse run as other user", path: "/run_sse", userID: "bob", sessionID: "bob-session", wantStatus: http.StatusNotFound},
+		{name: "session sse run as other user", path: "/run_session_sse", userID: "bob", sessionID: "new-session", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			for _, userID := range []string{"alice", "bob"} {
+				if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: userID, SessionID: userID + "-session"}); err != nil {
+					t.Fatalf("create session: %v", err)
+				}
+			}
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{
+				SessionService: sessionService,
+				AgentLoader:    agent.NewSingleLoader(replyAgent(t)),
+			}, adkrest.ServerConfig{
+				Authenticator:   tokenAuthenticator{"alice-token": "alice"},
+				AccessDenial:    tt.denial,
+				SSEWriteTimeout: time.Minute,
+			})
+			// The SSE runs set a write deadline, which needs a real connection.
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			body := fmt.Sprintf(`{"appName": "app", "userId": %q, "sessionId": %q, "newMessage": {"role": "user", "parts": [{"text": "hi"}]}}`, tt.userID, tt.sessionID)
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, server.URL+tt.path, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer alice-token")
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			// Denied runs leave the sessions of the other users untouched.
+			listResp, err := sessionService.List(t.Context(), &session.ListRequest{AppName: "app", UserID: "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listResp.Sessions) != 1 {
+				t.Errorf("got %d sessions of bob, want 1", len(listResp.Sessions))
+			}
+			getResp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "app", UserID: "bob", SessionID: "bob-session"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := getResp.Session.Events().Len(); n != 0 {
+				t.Errorf("got %d events in the session of bob, want 0", n)
+			}
+		})
+	}
+}
+
+func TestNewHandlerWithConfig_AdminAPIRequiresAuthentication(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     adkrest.ServerConfig
+		wantStatus int
+	}{
+		{
+			name:       "without an authenticator",
+			config:     adkrest.ServerConfig{EnableAdminAPI: true},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "insecure opt-in",
+			config:     adkrest.ServerConfig{EnableAdminAPI: true, InsecureAdminAPI: true},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "disabled",
+			config:     adkrest.ServerConfig{InsecureAdminAPI: true},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: session.InMemoryService()}, tt.config)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/info", nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("GET /admin/info: got status %v, want %v", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNewHandlerWithConfig_SetSystemState(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "alice", SessionID: "s1"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, adkrest.ServerConfig{
+		ProtectSystemState: true,
+		EnableAdminAPI:     true,
+		AdminUsers:         []string{"admin"},
+		Authenticator:      tokenAuthenticator{"admin-token": "admin", "alice-token": "alice"},
+	})
+	patch := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/admin/apps/app/users/alice/sessions/s1/system-state", strings.NewReader(`{"stateDelta": {"sys:tier": "gold"}}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The user of the path is the one of the session, not the caller.
+	if rr := patch("alice-token"); rr.Code != http.StatusForbidden {
+		t.Errorf("system state write of a non-admin user: got status %v, want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := patch("admin-token"); rr.Code != http.StatusOK {
+		t.Fatalf("system state write of the admin to the session of alice: got status %v, want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	resp, err := sessionService.Get(t.Context(), &session.GetRequest{AppName: "app", UserID: "alice", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := resp.Session.State().Get("sys:tier"); err != nil || got != "gold" {
+		t.Errorf("sys:tier of the session of alice = %v, %v, want gold", got, err)
+	}
+}
+
+func TestNewHandlerWithConfig_AdminInfo(t *testing.T) {
+	const adminToken = "s3cret-admin-token"
+	sessionService := session.InMemoryService()
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "alice", SessionID: id}); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+	handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, adkrest.ServerConfig{
+		SSEWriteTimeout: 2 * time.Minute,
+		ReadOnly:        true,
+		AllowedAuthors:  map[string][]string{"app": {"user"}},
+		StateKeys:       &controllers.StateKeyPolicy{Pattern: regexp.MustCompile(`^[a-z_:]+$`)},
+		EnableAdminAPI:  true,
+		AdminUsers:      []string{"admin"},
+		Authenticator:   tokenAuthenticator{adminToken: "admin", "alice-token": "alice"},
+	})
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/info", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get(""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated request: got status %v, want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := get("alice-token"); rr.Code != http.StatusForbidden {
+		t.Errorf("request of a non-admin user: got status %v, want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr := get(adminToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), adminToken) {
+		t.Errorf("response leaks the authenticator's token: %s", rr.Body.String())
+	}
+	var got struct {
+		Config map[string]any `json:"config"`
+		Stats  map[string]any `json:"stats"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	wantConfig := map[string]any{
+		"sseWriteTimeout":     "2m0s",
+		"readOnly":            true,
+		"strictDecoding":      false,
+		"rejectDuplicateKeys": false,
+		"collapsePartials":    false,
+		"deprecationHeaders":  false,
+		"allowedAuthors":      map[string]any{"app": []any{"user"}},
+		"stateKeyPattern":     `^[a-z_:]+$`,
+		"stateKeyNormalized":  false,
+		"authentication":      true,
+		"adminUsers":          []any{"admin"},
+		"panicHandler":        false,
+		"sessionBackend":      fmt.Sprintf("%T", sessionService),
+	}
+	if diff := cmp.Diff(wantConfig, got.Config); diff != "" {
+		t.Errorf("config mismatch (-want +got):\n%s", diff)
+	}
+	wantStats := map[string]any{"sessions": float64(2), "events": float64(0), "activeStreams": float64(0)}
+	if diff := cmp.Diff(wantStats, got.Stats); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewHandlerWithConfig_ResponseHeaders(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "alice", SessionID: "s1"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	serverConfig := adkrest.ServerConfig{
+		ResponseHeaders: http.Header{"x-app": {"adk"}},
+		RouteResponseHeaders: map[string]http.Header{
+			"GetSession":   {"Cache-Control": {"private, max-age=60"}},
+			"ListSessions": {"X-Content-Type-Options": nil, "X-App": {"sessions"}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		authenticator adkrest.Authenticator
+		path          string
+		want          map[string]string
+	}{
+		{
+			name: "defaults",
+			path: "/apps/app/users/alice/sessions/s1/events",
+			want: map[string]string{"X-Content-Type-Options": "nosniff", "X-App": "adk", "Cache-Control": ""},
+		},
+		{
+			name: "route headers",
+			path: "/apps/app/users/alice/sessions/s1",
+			want: map[string]string{"X-Content-Type-Options": "nosniff", "X-App": "adk", "Cache-Control": "private, max-age=60"},
+		},
+		{
+			name: "route headers without user segment",
+			// The user is authenticated, so the path has no user segment.
+			authenticator: tokenAuthenticator{"alice-token": "alice"},
+			path:          "/apps/app/sessions/s1",
+			want:          map[string]string{"X-Content-Type-Options": "nosniff", "X-App": "adk", "Cache-Control": "private, max-age=60"},
+		},
+		{
+			name: "route overrides and removes defaults",
+			path: "/apps/app/users/alice/sessions",
+			want: map[string]string{"X-Content-Type-Options": "", "X-App": "sessions"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig.Authenticator = tt.authenticator
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, serverConfig)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authenticator != nil {
+				req.Header.Set("Authorization", "Bearer alice-token")
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %v, want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			for key, want := range tt.want {
+				if got := rr.Header().Get(key); got != want {
+					t.Errorf("header %s = %q, want %q", key, got, want)
+				}
+			}
+			// Handler headers take precedence.
+			if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", got)
+			}
+		})
+	}
+}
+
+func TestNewHandlerWithConfig_PathNormalization(t *testing.T) {
+	sessionService := session.InMemoryService()
+	for _, id := range []string{"s1", "a/b", "a//b", "a b"} {
+		if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "alice", SessionID: id}); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		mode         controllers.PathNormalization
+		path         string
+		wantStatus   int
+		wantID       string
+		wantLocation string
+	}{
+		{name: "canonical", path: "/apps/app/users/alice/sessions/s1", wantStatus: http.StatusOK, wantID: "s1"},
+		{name: "redirect trailing slash", path: "/apps/app/users/alice/sessions/s1/?maxDepth=2", wantStatus: http.StatusPermanentRedirect, wantLocation: "/apps/app/users/alice/sessions/s1?maxDepth=2"},
+		{name: "redirect double slashes", path: "/apps//app/users/alice//sessions/s1", wantStatus: http.StatusPermanentRedirect, wantLocation: "/apps/app/users/alice/sessions/s1"},
+		{name: "redirect keeps encoded slashes", path: "/apps/app/users/alice/sessions/a%2F%2Fb/", wantStatus: http.StatusPermanentRedirect, wantLocation: "/apps/app/users/alice/sessions/a%2F%2Fb"},
+		{name: "rewrite trailing slash", mode: controllers.PathRewrite, path: "/apps/app/users/alice/sessions/s1/", wantStatus: http.StatusOK, wantID: "s1"},
+		{name: "rewrite double slashes", mode: controllers.PathRewrite, path: "//apps/app/users/alice//sessions//s1//", wantStatus: http.StatusOK, wantID: "s1"},
+		{name: "rewrite keeps encoded slashes", mode: controllers.PathRewrite, path: "/apps/app/users/alice//sessions/a%2F%2Fb/", wantStatus: http.StatusOK, wantID: "a//b"},
+		{name: "reject trailing slash", mode: controllers.PathReject, path: "/apps/app/users/alice/sessions/s1/", wantStatus: http.StatusBadRequest},
+		{name: "reject double slashes", mode: controllers.PathReject, path: "/apps/app//users/alice/sessions/s1", wantStatus: http.StatusBadRequest},
+		{name: "encoded slash", mode: controllers.PathReject, path: "/apps/app/users/alice/sessions/a%2Fb", wantStatus: http.StatusOK, wantID: "a/b"},
+		{name: "encoded double slash", mode: controllers.PathReject, path: "/apps/app/users/alice/sessions/a%2F%2Fb", wantStatus: http.StatusOK, wantID: "a//b"},
+		{name: "encoded space", path: "/apps/app/users/alice/sessions/a%20b", wantStatus: http.StatusOK, wantID: "a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, adkrest.ServerConfig{PathNormalization: tt.mode})
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %v, want %v, body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if got := rr.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if tt.wantID == "" {
+				return
+			}
+			var got models.Session
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.ID != tt.wantID {
+				t.Errorf("session ID = %q, want %q", got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestNewHandlerWithConfig_ContentTypes(t *testing.T) {
+	const (
+		createPath = "/apps/app/users/alice/sessions"
+		uploadPath = "/apps/app/users/alice/sessions/s1/events:upload"
+	)
+	tests := []struct {
+		name         string
+		policy       controllers.ContentTypePolicy
+		path         string
+		contentType  string
+		body         string
+		wantRejected bool
+	}{
+		{name: "json", path: createPath, contentType: "application/json", body: `{}`},
+		{name: "json with charset", path: createPath, contentType: "Application/JSON; charset=utf-8", body: `{}`},
+		{name: "wrong", path: createPath, contentType: "text/plain", body: `{}`, wantRejected: true},
+		{name: "missing", path: createPath, body: `{}`, wantRejected: true},
+		{name: "invalid", path: createPath, contentType: "application/", body: `{}`, wantRejected: true},
+		{name: "no body", path: createPath},
+		{name: "lenient wrong", policy: controllers.ContentTypePolicy{Lenient: true}, path: createPath, contentType: "text/plain", body: `{}`},
+		{name: "lenient missing", policy: controllers.ContentTypePolicy{Lenient: true}, path: createPath, body: `{}`},
+		{
+			name:        "negotiated alternative",
+			policy:      controllers.ContentTypePolicy{MediaTypes: []string{"application/json", "application/msgpack"}},
+			path:        createPath,
+			contentType: "application/msgpack",
+			body:        `{}`,
+		},
+		{
+			name:         "alternative replaces json",
+			policy:       controllers.ContentTypePolicy{MediaTypes: []string{"application/msgpack"}},
+			path:         createPath,
+			contentType:  "application/json",
+			body:         `{}`,
+			wantRejected: true,
+		},
+		{name: "multipart route", path: uploadPath, contentType: "multipart/form-data; boundary=x", body: "--x--"},
+		{name: "json on multipart route", path: uploadPath, contentType: "application/json", body: `{}`, wantRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: session.InMemoryService()}, adkrest.ServerConfig{ContentTypes: tt.policy})
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rejected := rr.Code == http.StatusUnsupportedMediaType; rejected != tt.wantRejected {
+				t.Fatalf("got status %v, want rejected %v, body: %s", rr.Code, tt.wantRejected, rr.Body.String())
+			}
+			if tt.wantRejected && rr.Header().Get("Accept") == "" {
+				t.Errorf("rejected response has no Accept header listing the accepted media types")
+			}
+		})
+	}
+}
+
+func TestNewHandlerWithConfig_DebugTiming(t *testing.T) {
+	tests := []struct {
+		name        string
+		debugTiming bool
+		header      string
+		wantPhases  []string
+	}{
+		{name: "enabled", debugTiming: true, header: "1", wantPhases: []string{"decode", "normalize", "load", "store", "encode", "total"}},
+		{name: "not requested", debugTiming: true},
+		{name: "disabled", header: "1"},
+	}
+	metric := regexp.MustCompile(`^([a-z]+);dur=(\d+\.\d{3})$`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionService := session.InMemoryService()
+			if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "alice", SessionID: "s1"}); err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, adkrest.ServerConfig{DebugTiming: tt.debugTiming})
+			req := httptest.NewRequest(http.MethodPatch, "/apps/app/users/alice/sessions/s1", strings.NewReader(`{"stateDelta": {"k": "v"}}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(controllers.DebugTimingHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %v, want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			serverTiming := rr.Result().Trailer.Get("Server-Timing")
+			if tt.wantPhases == nil {
+				if serverTiming != "" {
+					t.Errorf("Server-Timing trailer = %q, want none", serverTiming)
+				}
+				return
+			}
+			var gotPhases []string
+			durations := map[string]float64{}
+			for _, m := range strings.Split(serverTiming, ", ") {
+				match := metric.FindStringSubmatch(m)
+				if match == nil {
+					t.Fatalf("Server-Timing metric %q is not of the form name;dur=milliseconds", m)
+				}
+				gotPhases = append(gotPhases, match[1])
+				durations[match[1]], _ = strconv.ParseFloat(match[2], 64)
+			}
+			if diff := cmp.Diff(tt.wantPhases, gotPhases); diff != "" {
+				t.Errorf("Server-Timing phases mismatch (-want +got):\n%s", diff)
+			}
+			for phase, d := range durations {
+				if d > durations["total"] {
+					t.Errorf("phase %s took %vms, more than the %vms total", phase, d, durations["total"])
+				}
+			}
+		})
+	}
+}
+
+func TestNewHandlerWithConfig_EventEnrichment(t *testing.T) {
+	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "alice", SessionID: "s1"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	handler := adkrest.NewHandlerWithConfig(&launcher.Config{SessionService: sessionService}, adkrest.ServerConfig{
+		Authenticator:   tokenAuthenticator{"alice-token": "alice"},
+		EventEnrichment: &controllers.EventEnrichment{Prefix: "audit.", Tags: map[string]string{"version": "1.4.2"}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/apps/app/sessions/s1/events", strings.NewReader(`{"author": "user", "tags": {"audit.principal": "bob"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var got models.Event
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	// The request ID the server generated is the one echoed to the client.
+	requestID := rr.Header().Get(controllers.RequestIDHeader)
+	if requestID == "" {
+		t.Fatalf("response has no %s header", controllers.RequestIDHeader)
+	}
+	want := map[string]string{
+		"audit.version":   "1.4.2",
+		"audit.principal": "alice",
+		"audit.requestId": requestID,
+	}
+	if diff := cmp.Diff(want, got.Tags); diff != "" {
+		t.Errorf("event tags mismatch (-want +got):\n%s", diff)
+	}
+}
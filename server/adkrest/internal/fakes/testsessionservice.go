@@ -179,6 +179,13 @@ func (s *FakeSessionService) AppendEvent(ctx context.Context, curSession session
 	if !ok {
 		return fmt.Errorf("invalid session type")
 	}
+	if session.HasStateDirectives(event.Actions.StateDelta) {
+		resolved, err := session.ResolveStateDelta(testSession.SessionState, event.Actions.StateDelta)
+		if err != nil {
+			return err
+		}
+		event.Actions.StateDelta = resolved
+	}
 	testSession.SessionEvents = append(testSession.SessionEvents, event)
 	testSession.UpdatedAt = event.Timestamp
 
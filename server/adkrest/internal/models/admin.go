@@ -0,0 +1,93 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "time"
+
+// ReadOnlyStatus represents the read-only mode of the server.
+type ReadOnlyStatus struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+// ServerInfo is the effective configuration and the runtime statistics of
+// the server, as reported by the admin API.
+type ServerInfo struct {
+	Config ServerSettings `json:"config"`
+	Stats  ServerStats    `json:"stats"`
+}
+
+// ServerSettings is the effective configuration of the server. Credentials
+// and hooks are never reported, only whether they are configured.
+type ServerSettings struct {
+	SSEWriteTimeout     string              `json:"sseWriteTimeout"`
+	ReadOnly            bool                `json:"readOnly"`
+	StrictDecoding      bool                `json:"strictDecoding"`
+	RejectDuplicateKeys bool                `json:"rejectDuplicateKeys"`
+	DirectiveAliases    map[string]string   `json:"directiveAliases,omitempty"`
+	DeprecationHeaders  bool                `json:"deprecationHeaders"`
+	CollapsePartials    bool                `json:"collapsePartials"`
+	AllowedAuthors      map[string][]string `json:"allowedAuthors,omitempty"`
+	EventSchemaApps     []string            `json:"eventSchemaApps,omitempty"`
+	StateKeyPattern     string              `json:"stateKeyPattern,omitempty"`
+	StateKeyNormalized  bool                `json:"stateKeyNormalized"`
+	Authentication      bool                `json:"authentication"`
+	AdminUsers          []string            `json:"adminUsers,omitempty"`
+	PanicHandler        bool                `json:"panicHandler"`
+	SessionBackend      string              `json:"sessionBackend"`
+	ArtifactBackend     string              `json:"artifactBackend,omitempty"`
+	MemoryBackend       string              `json:"memoryBackend,omitempty"`
+}
+
+// ServerStats are the runtime statistics of the server. The session and
+// event counts are omitted when the session service doesn't maintain
+// statistics.
+type ServerStats struct {
+	Sessions      *int64 `json:"sessions,omitempty"`
+	Events        *int64 `json:"events,omitempty"`
+	ActiveStreams int64  `json:"activeStreams"`
+}
+
+// DeleteSessionsRequest selects the sessions deleted by the admin API. At
+// least one of AppName, UserID and OlderThan must be set.
+type DeleteSessionsRequest struct {
+	// AppName restricts the deletion to an app. All apps are searched when
+	// empty.
+	AppName string `json:"appName,omitempty"`
+	// UserID restricts the deletion to a user.
+	UserID string `json:"userId,omitempty"`
+	// OlderThan restricts the deletion to the sessions last updated before
+	// it.
+	OlderThan *time.Time `json:"olderThan,omitempty"`
+	// DryRun reports the matching sessions without deleting them.
+	DryRun bool `json:"dryRun,omitempty"`
+	// ExpectedCount is required unless DryRun is set: the sessions are only
+	// deleted if that many match, normally the count of a previous dry run.
+	ExpectedCount *int `json:"expectedCount,omitempty"`
+}
+
+// DeleteSessionsResponse lists the sessions deleted by the admin API, or
+// which would be deleted by a dry run.
+type DeleteSessionsResponse struct {
+	DryRun   bool             `json:"dryRun"`
+	Count    int              `json:"count"`
+	Sessions []DeletedSession `json:"sessions"`
+}
+
+// DeletedSession identifies a session deleted by the admin API.
+type DeletedSession struct {
+	AppName string `json:"appName"`
+	UserID  string `json:"userId"`
+	ID      string `json:"id"`
+}
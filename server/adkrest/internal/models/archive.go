@@ -0,0 +1,127 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrArchiveIntegrity is returned, wrapped, when an imported archive
+// doesn't match its checksum or signature.
+var ErrArchiveIntegrity = errors.New("archive integrity check failed")
+
+const (
+	archiveChecksumPrefix  = "sha256:"
+	archiveSignaturePrefix = "hmac-sha256:"
+)
+
+// SealSessionExport sets the checksum of the exported session, and its
+// signature if key is not empty. Both cover the canonical JSON of the app,
+// user and session IDs along with the import request, so that a session
+// can't be altered nor imported under other IDs without failing
+// [VerifySessionArchive].
+func SealSessionExport(export *SessionExport, key []byte) error {
+	export.Session.Checksum, export.Session.Signature = "", ""
+	body, err := json.Marshal(export.Session)
+	if err != nil {
+		return err
+	}
+	payload, err := archivePayload(export.AppName, export.UserID, export.SessionID, body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload)
+	export.Session.Checksum = archiveChecksumPrefix + hex.EncodeToString(sum[:])
+	if len(key) > 0 {
+		export.Session.Signature = archiveSignaturePrefix + hex.EncodeToString(archiveMAC(key, payload))
+	}
+	return nil
+}
+
+// VerifySessionArchive checks the checksum and the signature of body, the
+// JSON of a CreateSession request importing the session with the given
+// IDs. A request without checksum is accepted, unless requireSignature is
+// set; a signature can only be verified with the key it was made with.
+func VerifySessionArchive(appName, userID, sessionID string, body, key []byte, requireSignature bool) error {
+	var seal struct {
+		Checksum  string `json:"checksum"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(body, &seal); err != nil {
+		return fmt.Errorf("%w: %w", ErrArchiveIntegrity, err)
+	}
+	if seal.Signature == "" && requireSignature {
+		return fmt.Errorf("%w: archive is not signed", ErrArchiveIntegrity)
+	}
+	if seal.Checksum == "" && seal.Signature == "" {
+		return nil
+	}
+	payload, err := archivePayload(appName, userID, sessionID, body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrArchiveIntegrity, err)
+	}
+	if seal.Checksum != "" {
+		want, ok := strings.CutPrefix(seal.Checksum, archiveChecksumPrefix)
+		sum := sha256.Sum256(payload)
+		if !ok || want != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("%w: checksum mismatch", ErrArchiveIntegrity)
+		}
+	}
+	if seal.Signature != "" {
+		if len(key) == 0 {
+			return fmt.Errorf("%w: no key to verify the signature", ErrArchiveIntegrity)
+		}
+		encoded, ok := strings.CutPrefix(seal.Signature, archiveSignaturePrefix)
+		mac, err := hex.DecodeString(encoded)
+		if !ok || err != nil || !hmac.Equal(mac, archiveMAC(key, payload)) {
+			return fmt.Errorf("%w: signature mismatch", ErrArchiveIntegrity)
+		}
+	}
+	return nil
+}
+
+// archivePayload returns the canonical JSON the checksum and the signature
+// of an archived session cover: its IDs and the import request body,
+// without its checksum and signature. Numbers are kept as encoded, so the
+// payload doesn't depend on how they are decoded.
+func archivePayload(appName, userID, sessionID string, body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var request map[string]any
+	if err := decoder.Decode(&request); err != nil {
+		return nil, err
+	}
+	delete(request, "checksum")
+	delete(request, "signature")
+	return CanonicalJSON(map[string]any{
+		"appName":   appName,
+		"userId":    userID,
+		"sessionId": sessionID,
+		"session":   request,
+	})
+}
+
+func archiveMAC(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,46 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "encoding/json"
+
+// AppendEventsRequest represents a request to append several events to a
+// session, each accepted or rejected on its own.
+type AppendEventsRequest struct {
+	// Events are decoded one by one, so that a malformed event only fails
+	// itself.
+	Events []json.RawMessage `json:"events"`
+}
+
+// AppendEventsResponse reports the result of every event of an
+// [AppendEventsRequest], in request order.
+type AppendEventsResponse struct {
+	Results []AppendEventResult `json:"results"`
+	// Accepted is the number of events appended.
+	Accepted int `json:"accepted"`
+}
+
+// AppendEventResult is the result of appending one event of an
+// [AppendEventsRequest].
+type AppendEventResult struct {
+	// ID is the ID of the appended event, assigned by the server if the
+	// event had none. It is empty when the event was rejected.
+	ID string `json:"id,omitempty"`
+	// Status is the HTTP status the event would have been answered with on
+	// its own: 200 when it was appended.
+	Status int `json:"status"`
+	// Error tells why the event was rejected.
+	Error string `json:"error,omitempty"`
+}
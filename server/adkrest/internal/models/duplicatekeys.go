@@ -0,0 +1,97 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// jsonFrame is an object or array being tokenized by [CheckDuplicateKeys].
+type jsonFrame struct {
+	object bool
+	keys   map[string]bool
+	// wantKey reports whether the next token of an object is a key.
+	wantKey bool
+	// label is the key or index of the current member, in the JSON Pointer
+	// of its values.
+	label string
+	index int
+}
+
+// CheckDuplicateKeys returns an error naming the first object key that
+// appears twice in the same object of the JSON document, which the standard
+// decoder silently resolves by keeping the last value. The document is
+// tokenized rather than decoded into maps, which would lose the duplicates.
+// Syntax errors are left to the decoder of the document and not reported.
+func CheckDuplicateKeys(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var stack []*jsonFrame
+	// valueDone advances the parent of a complete value to its next member.
+	valueDone := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.object {
+			top.wantKey = true
+		} else {
+			top.index++
+			top.label = strconv.Itoa(top.index)
+		}
+	}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			// The end of the document, or a syntax error.
+			return nil
+		}
+		if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].wantKey {
+			top := stack[n-1]
+			key, ok := token.(string)
+			if !ok {
+				// The end of the object.
+				stack = stack[:n-1]
+				valueDone()
+				continue
+			}
+			if top.keys[key] {
+				path := make([]string, 0, n-1)
+				for _, frame := range stack[:n-1] {
+					path = append(path, frame.label)
+				}
+				return fmt.Errorf("duplicate key %q in the object at %q", key, FormatJSONPointer(path))
+			}
+			top.keys[key] = true
+			top.label = key
+			top.wantKey = false
+			continue
+		}
+		switch token {
+		case json.Delim('{'):
+			stack = append(stack, &jsonFrame{object: true, keys: map[string]bool{}, wantKey: true})
+		case json.Delim('['):
+			stack = append(stack, &jsonFrame{label: "0"})
+		case json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+}
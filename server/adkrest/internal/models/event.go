@@ -31,23 +31,76 @@ type EventActions struct {
 
 // Event represents a single event in a session.
 type Event struct {
-	ID                 string                   `json:"id"`
-	Time               int64                    `json:"time"`
-	InvocationID       string                   `json:"invocationId"`
-	Branch             string                   `json:"branch"`
-	Author             string                   `json:"author"`
-	Partial            bool                     `json:"partial"`
-	LongRunningToolIDs []string                 `json:"longRunningToolIds"`
-	Content            *genai.Content           `json:"content"`
-	GroundingMetadata  *genai.GroundingMetadata `json:"groundingMetadata"`
-	TurnComplete       bool                     `json:"turnComplete"`
-	Interrupted        bool                     `json:"interrupted"`
-	ErrorCode          string                   `json:"errorCode"`
-	ErrorMessage       string                   `json:"errorMessage"`
-	Actions            EventActions             `json:"actions"`
+	ID   string `json:"id"`
+	Time int64  `json:"time"`
+	// Sequence is the position of the event in its session, assigned by
+	// the session service, see [session.Event.Sequence]. It is ignored in
+	// the events clients submit.
+	Sequence           int64          `json:"sequence,omitempty"`
+	InvocationID       string         `json:"invocationId"`
+	Branch             string         `json:"branch"`
+	Author             string         `json:"author"`
+	Partial            bool           `json:"partial"`
+	LongRunningToolIDs []string       `json:"longRunningToolIds"`
+	Content            *genai.Content `json:"content"`
+	// StructuredArgs holds the indexes of the content parts whose function
+	// call arguments are stored as a JSON string, under [StringArgsKey],
+	// and are decoded in Content so that clients get them as an object.
+	// They are stored as a string again by [ToSessionEvent].
+	StructuredArgs    []int                    `json:"structuredArgs,omitempty"`
+	GroundingMetadata *genai.GroundingMetadata `json:"groundingMetadata"`
+	TurnComplete      bool                     `json:"turnComplete"`
+	Interrupted       bool                     `json:"interrupted"`
+	ErrorCode         string                   `json:"errorCode"`
+	ErrorMessage      string                   `json:"errorMessage"`
+	Actions           EventActions             `json:"actions"`
+	Tags              map[string]string        `json:"tags,omitempty"`
 }
 
-// ToSessionEvent maps Event data struct to session.Event
+// SessionEvent is a message of the user event stream: an event tagged with
+// the ID of the session it was appended to.
+type SessionEvent struct {
+	SessionID string `json:"sessionId"`
+	Event     Event  `json:"event"`
+}
+
+// EventGroup is the events of one invocation, in the order they were
+// listed.
+type EventGroup struct {
+	InvocationID string `json:"invocationId,omitempty"`
+	// Ungrouped is set on the group of the events without an invocation ID.
+	Ungrouped bool    `json:"ungrouped,omitempty"`
+	Events    []Event `json:"events"`
+}
+
+// GroupEventsByInvocation groups the events by invocation ID. Groups are
+// ordered by their first event and keep the order of their events. The
+// events without an invocation ID form an ungrouped group, listed last.
+func GroupEventsByInvocation(events []Event) []EventGroup {
+	groups := []EventGroup{}
+	index := make(map[string]int)
+	var ungrouped []Event
+	for _, event := range events {
+		if event.InvocationID == "" {
+			ungrouped = append(ungrouped, event)
+			continue
+		}
+		i, ok := index[event.InvocationID]
+		if !ok {
+			i = len(groups)
+			index[event.InvocationID] = i
+			groups = append(groups, EventGroup{InvocationID: event.InvocationID})
+		}
+		groups[i].Events = append(groups[i].Events, event)
+	}
+	if len(ungrouped) > 0 {
+		groups = append(groups, EventGroup{Ungrouped: true, Events: ungrouped})
+	}
+	return groups
+}
+
+// ToSessionEvent maps Event data struct to session.Event. The function call
+// arguments of the StructuredArgs parts are encoded as a JSON string again.
 func ToSessionEvent(event Event) *session.Event {
 	return &session.Event{
 		ID:                 event.ID,
@@ -56,8 +109,9 @@ func ToSessionEvent(event Event) *session.Event {
 		Branch:             event.Branch,
 		Author:             event.Author,
 		LongRunningToolIDs: event.LongRunningToolIDs,
+		Tags:               event.Tags,
 		LLMResponse: model.LLMResponse{
-			Content:           event.Content,
+			Content:           destructureArgs(event.Content, event.StructuredArgs),
 			GroundingMetadata: event.GroundingMetadata,
 			Partial:           event.Partial,
 			TurnComplete:      event.TurnComplete,
@@ -72,17 +126,23 @@ func ToSessionEvent(event Event) *session.Event {
 	}
 }
 
-// FromSessionEvent maps session.Event to Event data struct
+// FromSessionEvent maps session.Event to Event data struct. The function
+// call arguments stored as a JSON string encoding an object are decoded, see
+// Event.StructuredArgs.
 func FromSessionEvent(event session.Event) Event {
+	content, structuredArgs := structureArgs(event.LLMResponse.Content)
 	return Event{
 		ID:                 event.ID,
 		Time:               event.Timestamp.Unix(),
+		Sequence:           event.Sequence,
 		InvocationID:       event.InvocationID,
 		Branch:             event.Branch,
 		Author:             event.Author,
 		Partial:            event.Partial,
 		LongRunningToolIDs: event.LongRunningToolIDs,
-		Content:            event.LLMResponse.Content,
+		Tags:               event.Tags,
+		Content:            content,
+		StructuredArgs:     structuredArgs,
 		GroundingMetadata:  event.LLMResponse.GroundingMetadata,
 		TurnComplete:       event.LLMResponse.TurnComplete,
 		Interrupted:        event.LLMResponse.Interrupted,
@@ -0,0 +1,77 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// EventFields are the names of the JSON fields of [Event], in their order.
+var EventFields = jsonFieldNames(reflect.TypeFor[Event]())
+
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// EventProjection selects the JSON fields of the events sent to clients.
+// The ID of an event is always kept, so that projected events can still be
+// told apart.
+type EventProjection struct {
+	// Fields are the JSON names of the fields kept, or of the fields left
+	// out if Exclude is set.
+	Fields  []string
+	Exclude bool
+}
+
+// Validate returns an error naming the first field of the projection which
+// is not a field of [Event].
+func (p EventProjection) Validate() error {
+	for _, field := range p.Fields {
+		if !slices.Contains(EventFields, field) {
+			return fmt.Errorf("unknown event field %q", field)
+		}
+	}
+	return nil
+}
+
+// Project returns the JSON object of the event with the projected fields
+// only.
+func (p EventProjection) Project(event Event) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for name := range fields {
+		if name != "id" && slices.Contains(p.Fields, name) == p.Exclude {
+			delete(fields, name)
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// exportCursorPrefix versions the export cursor format.
+const exportCursorPrefix = "e1:"
+
+// SessionExport is the envelope of an exported session, one per line of an
+// export archive.
+type SessionExport struct {
+	// Cursor is passed as cursor to resume the export after this session.
+	Cursor    string `json:"cursor"`
+	AppName   string `json:"appName"`
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId"`
+	// Session is the body of the CreateSession request importing the
+	// session again, its import field is set.
+	Session CreateSessionRequest `json:"session"`
+}
+
+// NewSessionExport returns the export envelope of the session.
+func NewSessionExport(s Session) SessionExport {
+	return SessionExport{
+		Cursor:    EncodeExportCursor(s.UserID, s.ID),
+		AppName:   s.AppName,
+		UserID:    s.UserID,
+		SessionID: s.ID,
+		Session: CreateSessionRequest{
+			State:  s.State,
+			Events: s.Events,
+			Import: true,
+			Labels: s.Labels,
+		},
+	}
+}
+
+// EncodeExportCursor returns the opaque cursor pointing after the session
+// with the given user and session IDs.
+func EncodeExportCursor(userID, sessionID string) string {
+	// Encoding errors are impossible for a slice of strings.
+	encoded, _ := json.Marshal([]string{userID, sessionID})
+	return base64.RawURLEncoding.EncodeToString([]byte(exportCursorPrefix + string(encoded)))
+}
+
+// DecodeExportCursor returns the user and session IDs encoded in a cursor
+// created by [EncodeExportCursor].
+func DecodeExportCursor(cursor string) (userID, sessionID string, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid export cursor")
+	}
+	encoded, ok := strings.CutPrefix(string(decoded), exportCursorPrefix)
+	if !ok {
+		return "", "", fmt.Errorf("invalid export cursor")
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(encoded), &ids); err != nil || len(ids) != 2 {
+		return "", "", fmt.Errorf("invalid export cursor")
+	}
+	return ids[0], ids[1], nil
+}
+
+// CanonicalJSON returns the canonical JSON encoding of v: the keys of every
+// object, including the fields of structs, are sorted, numbers are kept as
+// encoded, and the encoding has no insignificant whitespace or HTML
+// escaping. Values with the same JSON content have byte-identical canonical
+// encodings, whatever the declaration order of their fields.
+func CanonicalJSON(v any) ([]byte, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	// Maps are encoded with their keys sorted.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(generic); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
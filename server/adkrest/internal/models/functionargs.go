@@ -0,0 +1,116 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+
+	"google.golang.org/genai"
+)
+
+// StringArgsKey is the single argument of the function calls whose
+// arguments are stored as a JSON string, as the integrations of APIs
+// returning them encoded, like the OpenAI compatible ones, store them.
+const StringArgsKey = "arguments"
+
+// structureArgs returns the content with the arguments of its function
+// calls stored as a JSON string decoded, with the indexes of their parts.
+// Only the strings encoding a JSON object are decoded; numbers are kept as
+// [json.Number] so that they are encoded back as they were. The content is
+// returned as is if it has no such calls, and copied otherwise.
+func structureArgs(content *genai.Content) (*genai.Content, []int) {
+	if content == nil {
+		return nil, nil
+	}
+	var indexes []int
+	var parts []*genai.Part
+	for i, part := range content.Parts {
+		args, ok := decodeStringArgs(part)
+		if !ok {
+			continue
+		}
+		if parts == nil {
+			parts = slices.Clone(content.Parts)
+		}
+		call := *part.FunctionCall
+		call.Args = args
+		structured := *part
+		structured.FunctionCall = &call
+		parts[i] = &structured
+		indexes = append(indexes, i)
+	}
+	if indexes == nil {
+		return content, nil
+	}
+	structured := *content
+	structured.Parts = parts
+	return &structured, indexes
+}
+
+// decodeStringArgs returns the decoded arguments of the function call of
+// the part if they are stored as a JSON string encoding an object.
+func decodeStringArgs(part *genai.Part) (map[string]any, bool) {
+	if part == nil || part.FunctionCall == nil || len(part.FunctionCall.Args) != 1 {
+		return nil, false
+	}
+	encoded, ok := part.FunctionCall.Args[StringArgsKey].(string)
+	if !ok {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(encoded)))
+	decoder.UseNumber()
+	var args map[string]any
+	if err := decoder.Decode(&args); err != nil || args == nil || decoder.More() {
+		return nil, false
+	}
+	return args, true
+}
+
+// destructureArgs reverts structureArgs: it returns the content with the
+// arguments of the function calls of the parts at the indexes encoded as a
+// JSON string again, copying the content. The string is the compact
+// encoding of the arguments with sorted keys, without HTML escaping, which
+// is the original string when it was encoded that way, as most APIs do.
+func destructureArgs(content *genai.Content, indexes []int) *genai.Content {
+	if content == nil || len(indexes) == 0 {
+		return content
+	}
+	parts := slices.Clone(content.Parts)
+	for _, i := range indexes {
+		if i < 0 || i >= len(parts) || parts[i] == nil || parts[i].FunctionCall == nil {
+			continue
+		}
+		var encoded bytes.Buffer
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false)
+		args := parts[i].FunctionCall.Args
+		if args == nil {
+			args = map[string]any{}
+		}
+		if err := encoder.Encode(args); err != nil {
+			continue
+		}
+		call := *parts[i].FunctionCall
+		call.Args = map[string]any{StringArgsKey: string(bytes.TrimSuffix(encoded.Bytes(), []byte("\n")))}
+		part := *parts[i]
+		part.FunctionCall = &call
+		parts[i] = &part
+	}
+	destructured := *content
+	destructured.Parts = parts
+	return &destructured
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ParseJSONPointer splits a JSON Pointer (RFC 6901) into its unescaped
+// reference tokens. The empty pointer refers to the whole document and has
+// no tokens.
+func ParseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must be empty or start with \"/\"", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, fmt.Errorf("invalid JSON pointer %q: invalid escape in %q", pointer, token)
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// FormatJSONPointer returns the JSON Pointer of the reference tokens, the
+// inverse of [ParseJSONPointer].
+func FormatJSONPointer(tokens []string) string {
+	var pointer strings.Builder
+	for _, token := range tokens {
+		pointer.WriteString("/")
+		pointer.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return pointer.String()
+}
+
+// ResolveJSONPointer returns the value the reference tokens of a parsed JSON
+// Pointer point to within value, and whether it exists. Maps are indexed by
+// key and slices by their decimal index.
+func ResolveJSONPointer(value any, tokens []string) (any, bool) {
+	for _, token := range tokens {
+		var ok bool
+		if value, ok = jsonPointerStep(value, token); !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func jsonPointerStep(value any, token string) (any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		child, ok := v[token]
+		return child, ok
+	case []any:
+		i, ok := jsonPointerIndex(token, len(v))
+		if !ok {
+			return nil, false
+		}
+		return v[i], true
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		child := rv.MapIndex(reflect.ValueOf(token).Convert(rv.Type().Key()))
+		if !child.IsValid() {
+			return nil, false
+		}
+		return child.Interface(), true
+	case reflect.Slice, reflect.Array:
+		i, ok := jsonPointerIndex(token, rv.Len())
+		if !ok {
+			return nil, false
+		}
+		return rv.Index(i).Interface(), true
+	default:
+		return nil, false
+	}
+}
+
+// jsonPointerIndex parses an array index token, which must be a decimal
+// number without leading zeros.
+func jsonPointerIndex(token string, length int) (int, bool) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= length {
+		return 0, false
+	}
+	return i, true
+}
@@ -0,0 +1,47 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+// AcquireLeaseRequest is the body of a request leasing a session.
+type AcquireLeaseRequest struct {
+	Holder     string  `json:"holder"`
+	TTLSeconds float64 `json:"ttlSeconds"`
+	// Wait makes the request wait for the current lease to end instead of
+	// failing with 409.
+	Wait bool `json:"wait,omitempty"`
+}
+
+// RenewLeaseRequest is the body of a request extending a lease.
+type RenewLeaseRequest struct {
+	TTLSeconds float64 `json:"ttlSeconds"`
+}
+
+// Lease is an exclusive lease on a session.
+type Lease struct {
+	Holder    string    `json:"holder"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// FromSessionLease maps a session.Lease to its API representation.
+func FromSessionLease(lease *session.Lease) Lease {
+	return Lease{Holder: lease.Holder, Token: lease.Token, ExpiresAt: lease.ExpiresAt}
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"strings"
+
+	"google.golang.org/adk/session"
+)
+
+// State scopes, the sources of the keys of a merged state.
+const (
+	StateScopeApp     = "app"
+	StateScopeUser    = "user"
+	StateScopeSession = "session"
+)
+
+// MergeStateScopes returns the merged view of a session state: its app,
+// user and session keys in a single map, the app and user keys without
+// their [session.KeyPrefixApp] and [session.KeyPrefixUser] prefixes. A key
+// set in several scopes has the value of the narrowest: session keys
+// override user keys, which override app keys. Sources maps every key of
+// the merged view to the scope its value comes from.
+//
+// The merged view is for reads: writes still target the scoped keys of the
+// state.
+func MergeStateScopes(state map[string]any) (merged map[string]any, sources map[string]string) {
+	merged = make(map[string]any, len(state))
+	sources = make(map[string]string, len(state))
+	// The scopes are merged from the widest to the narrowest, so that the
+	// narrower ones override.
+	for _, scope := range []string{StateScopeApp, StateScopeUser, StateScopeSession} {
+		for key, value := range state {
+			name, keyScope := stateKeyScope(key)
+			if keyScope == scope {
+				merged[name] = value
+				sources[name] = scope
+			}
+		}
+	}
+	return merged, sources
+}
+
+// stateKeyScope returns the name of the state key within its scope, and
+// the scope.
+func stateKeyScope(key string) (name, scope string) {
+	if name, ok := strings.CutPrefix(key, session.KeyPrefixApp); ok {
+		return name, StateScopeApp
+	}
+	if name, ok := strings.CutPrefix(key, session.KeyPrefixUser); ok {
+		return name, StateScopeUser
+	}
+	return key, StateScopeSession
+}
@@ -0,0 +1,195 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"google.golang.org/adk/session"
+)
+
+// OpenTelemetry attribute keys of the exported log records. The event,
+// invocation and session keys are the ones of the spans recorded by the
+// agents, so that logs and traces correlate.
+const (
+	OTLPAttributeEventID      = "gcp.vertex.agent.event_id"
+	OTLPAttributeInvocationID = "gcp.vertex.agent.invocation_id"
+	OTLPAttributeSessionID    = "gcp.vertex.agent.session_id"
+	OTLPAttributeAuthor       = "gcp.vertex.agent.author"
+	OTLPAttributeBranch       = "gcp.vertex.agent.branch"
+	OTLPAttributePartial      = "gcp.vertex.agent.partial"
+	OTLPAttributeErrorCode    = "error.type"
+	OTLPAttributeErrorMessage = "exception.message"
+	OTLPAttributeAppName      = "service.name"
+	OTLPAttributeUserID       = "enduser.id"
+	OTLPAttributeCursor       = "adk.export.cursor"
+)
+
+// Severity numbers of the exported log records, as defined by the
+// OpenTelemetry log data model.
+const (
+	OTLPSeverityInfo  = 9
+	OTLPSeverityError = 17
+)
+
+// otlpScopeName is the instrumentation scope of the exported log records.
+const otlpScopeName = "google.golang.org/adk/server/adkrest"
+
+// OTLPLogs is the OTLP/JSON encoding of an ExportLogsServiceRequest, as
+// accepted by the /v1/logs endpoint of OpenTelemetry collectors.
+type OTLPLogs struct {
+	ResourceLogs []OTLPResourceLogs `json:"resourceLogs"`
+}
+
+// OTLPResourceLogs holds the log records of a resource, here a session.
+type OTLPResourceLogs struct {
+	Resource  OTLPResource    `json:"resource"`
+	ScopeLogs []OTLPScopeLogs `json:"scopeLogs"`
+}
+
+// OTLPResource describes the entity producing the log records.
+type OTLPResource struct {
+	Attributes []OTLPKeyValue `json:"attributes"`
+}
+
+// OTLPScopeLogs holds the log records of an instrumentation scope.
+type OTLPScopeLogs struct {
+	Scope      OTLPScope       `json:"scope"`
+	LogRecords []OTLPLogRecord `json:"logRecords"`
+}
+
+// OTLPScope is an instrumentation scope.
+type OTLPScope struct {
+	Name string `json:"name"`
+}
+
+// OTLPLogRecord is a log record, one per event.
+type OTLPLogRecord struct {
+	// TimeUnixNano is the decimal timestamp of the event, in nanoseconds
+	// since the epoch, a string as 64-bit integers are in OTLP/JSON.
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           OTLPAnyValue   `json:"body"`
+	Attributes     []OTLPKeyValue `json:"attributes"`
+	// TraceID and SpanID are the hex-encoded IDs of the span which produced
+	// the event, when known.
+	TraceID string `json:"traceId,omitempty"`
+	SpanID  string `json:"spanId,omitempty"`
+}
+
+// OTLPKeyValue is an attribute.
+type OTLPKeyValue struct {
+	Key   string       `json:"key"`
+	Value OTLPAnyValue `json:"value"`
+}
+
+// OTLPAnyValue is an attribute value or a log body. Exactly one field is
+// set.
+type OTLPAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func otlpString(key, value string) OTLPKeyValue {
+	return OTLPKeyValue{Key: key, Value: OTLPAnyValue{StringValue: &value}}
+}
+
+func otlpBool(key string, value bool) OTLPKeyValue {
+	return OTLPKeyValue{Key: key, Value: OTLPAnyValue{BoolValue: &value}}
+}
+
+// TraceLookup returns the hex-encoded trace and span IDs of the span which
+// produced the event, or empty strings if they are unknown.
+type TraceLookup func(eventID string) (traceID, spanID string)
+
+// NewOTLPLogs maps the events of the session to OpenTelemetry log records,
+// in order, under a resource identifying the session. Every record is
+// timestamped with its event and carries the author, event and invocation
+// IDs as attributes; its body is the text of the event, without thoughts,
+// and events with an error are logged at the ERROR severity. traces may be
+// nil.
+func NewOTLPLogs(s session.Session, traces TraceLookup) OTLPLogs {
+	records := []OTLPLogRecord{}
+	for event := range s.Events().All() {
+		records = append(records, otlpLogRecord(event, traces))
+	}
+	return OTLPLogs{ResourceLogs: []OTLPResourceLogs{{
+		Resource: OTLPResource{Attributes: []OTLPKeyValue{
+			otlpString(OTLPAttributeAppName, s.AppName()),
+			otlpString(OTLPAttributeUserID, s.UserID()),
+			otlpString(OTLPAttributeSessionID, s.ID()),
+			otlpString(OTLPAttributeCursor, EncodeExportCursor(s.UserID(), s.ID())),
+		}},
+		ScopeLogs: []OTLPScopeLogs{{
+			Scope:      OTLPScope{Name: otlpScopeName},
+			LogRecords: records,
+		}},
+	}}}
+}
+
+func otlpLogRecord(event *session.Event, traces TraceLookup) OTLPLogRecord {
+	record := OTLPLogRecord{
+		TimeUnixNano:   strconv.FormatInt(event.Timestamp.UnixNano(), 10),
+		SeverityNumber: OTLPSeverityInfo,
+		SeverityText:   "INFO",
+		Attributes: []OTLPKeyValue{
+			otlpString(OTLPAttributeEventID, event.ID),
+			otlpString(OTLPAttributeAuthor, event.Author),
+		},
+	}
+	var text strings.Builder
+	if event.Content != nil {
+		for _, part := range event.Content.Parts {
+			if part != nil && !part.Thought {
+				text.WriteString(part.Text)
+			}
+		}
+	}
+	body := text.String()
+	if body == "" && event.Content != nil {
+		// Events without text, like tool calls and responses, are logged
+		// with their content as JSON.
+		if encoded, err := json.Marshal(event.Content); err == nil {
+			body = string(encoded)
+		}
+	}
+	record.Body = OTLPAnyValue{StringValue: &body}
+	if event.InvocationID != "" {
+		record.Attributes = append(record.Attributes, otlpString(OTLPAttributeInvocationID, event.InvocationID))
+	}
+	if event.Branch != "" {
+		record.Attributes = append(record.Attributes, otlpString(OTLPAttributeBranch, event.Branch))
+	}
+	if event.Partial {
+		record.Attributes = append(record.Attributes, otlpBool(OTLPAttributePartial, true))
+	}
+	if event.ErrorCode != "" || event.ErrorMessage != "" {
+		record.SeverityNumber = OTLPSeverityError
+		record.SeverityText = "ERROR"
+		if event.ErrorCode != "" {
+			record.Attributes = append(record.Attributes, otlpString(OTLPAttributeErrorCode, event.ErrorCode))
+		}
+		if event.ErrorMessage != "" {
+			record.Attributes = append(record.Attributes, otlpString(OTLPAttributeErrorMessage, event.ErrorMessage))
+		}
+	}
+	if traces != nil {
+		record.TraceID, record.SpanID = traces(event.ID)
+	}
+	return record
+}
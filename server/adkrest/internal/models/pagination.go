@@ -0,0 +1,110 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pageTokenPrefix versions the page token format.
+const pageTokenPrefix = "o2:"
+
+// Page is the envelope of a paginated list response.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// PageSize is the effective size of the pages, after the default and
+	// the maximum of the server are applied to the requested one.
+	PageSize int `json:"pageSize"`
+	// NextPageToken is passed as pageToken to retrieve the next page.
+	// It is empty on the last page.
+	NextPageToken string `json:"nextPageToken,omitempty"`
+	// TotalSize is the number of items across all pages. It is omitted when
+	// the store can't compute it cheaply.
+	TotalSize *int `json:"totalSize,omitempty"`
+}
+
+// PageTokenSigner creates and verifies page tokens. A token holds the offset
+// of the next item and an HMAC-SHA256 signature binding it to the scope of
+// the list it pages through, so that clients can neither forge an offset
+// nor replay a token against another list. It is safe for concurrent use.
+type PageTokenSigner struct {
+	secret []byte
+}
+
+// NewPageTokenSigner returns a signer using the secret. If the secret is
+// empty, a random one is generated: the tokens are then only accepted by the
+// signer which created them, and not after a restart.
+func NewPageTokenSigner(secret []byte) *PageTokenSigner {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		// Read never fails, see crypto/rand.
+		_, _ = rand.Read(secret)
+	}
+	return &PageTokenSigner{secret: secret}
+}
+
+// Encode returns the opaque page token pointing at the item with the given
+// offset of the list identified by the scope.
+func (s *PageTokenSigner) Encode(offset int, scope ...string) string {
+	payload := pageTokenPrefix + strconv.Itoa(offset)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload, scope))
+}
+
+// Decode returns the offset of a page token created by [PageTokenSigner.Encode]
+// for the same scope. An empty token points at the first item. Tokens that
+// are malformed, tampered with or created for another scope are rejected.
+func (s *PageTokenSigner) Decode(token string, scope ...string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, s.sign(string(payload), scope)) {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	offsetStr, ok := strings.CutPrefix(string(payload), pageTokenPrefix)
+	if !ok {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	return offset, nil
+}
+
+// sign returns the signature of the payload for the scope.
+func (s *PageTokenSigner) sign(payload string, scope []string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	for _, part := range scope {
+		// Length prefixes keep the parts apart, whatever they contain.
+		fmt.Fprintf(mac, "\x00%d:%s", len(part), part)
+	}
+	return mac.Sum(nil)
+}
@@ -34,6 +34,16 @@ type RunAgentRequest struct {
 	StateDelta *map[string]any `json:"stateDelta,omitempty"`
 }
 
+// RunSessionRequest is the body of a run which creates its session if it
+// doesn't exist. Its SessionId is optional: a session with a generated ID is
+// created if it is empty.
+type RunSessionRequest struct {
+	RunAgentRequest
+
+	// State is the initial state of the session, if it is created.
+	State map[string]any `json:"state,omitempty"`
+}
+
 // AssertRunAgentRequestRequired checks if the required fields are not zero-ed
 func (req RunAgentRequest) AssertRunAgentRequestRequired() error {
 	elements := map[string]any{
@@ -15,6 +15,10 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 
@@ -31,6 +35,42 @@ const (
 
 	// stateUpdateDelete is the directive value indicating a key should be deleted.
 	stateUpdateDelete = "delete"
+
+	// stateUpdateRename is the directive value indicating a key should be
+	// renamed to the key given in the "to" field.
+	stateUpdateRename = "rename"
+
+	// stateUpdateCopy is the directive value indicating a key should be set
+	// to a copy of the value of the key given in the "from" field.
+	stateUpdateCopy = "copy"
+
+	// stateUpdateSwap is the directive value indicating a key should
+	// exchange its value with the key given in the "with" field.
+	stateUpdateSwap = "swap"
+
+	// stateUpdateSetIf is the directive value indicating a key should be
+	// set to the "value" field only if the "when" predicate holds.
+	stateUpdateSetIf = "setIf"
+
+	// stateUpdateMin is the directive value indicating a key should be set
+	// to the "value" field only if it is absent or lower than the number it
+	// holds.
+	stateUpdateMin = "min"
+
+	// stateUpdateMax is the directive value indicating a key should be set
+	// to the "value" field only if it is absent or higher than the number it
+	// holds.
+	stateUpdateMax = "max"
+
+	// stateUpdateAddUnique is the directive value indicating the "value"
+	// field should be appended to the list at the key, unless an equal
+	// element is already present.
+	stateUpdateAddUnique = "addUnique"
+
+	// stateUpdateMerge is the directive value indicating the "value" object
+	// should be merged into the object at the key, or at the optional JSON
+	// Pointer "path" within it.
+	stateUpdateMerge = "merge"
 )
 
 // Session represents an agent's session.
@@ -41,17 +81,122 @@ type Session struct {
 	UpdatedAt int64          `json:"lastUpdateTime"`
 	Events    []Event        `json:"events"`
 	State     map[string]any `json:"state"`
+	// Labels are the operational labels of the session, kept apart from
+	// its state, see [session.LabelService].
+	Labels map[string]string `json:"labels,omitempty"`
+	// MergedState is the merged view of the app, user and session scopes
+	// of the state, when requested, see [MergeStateScopes].
+	MergedState map[string]any `json:"mergedState,omitempty"`
+	// StateSources maps the keys of MergedState to the scope of their
+	// values, when requested.
+	StateSources map[string]string `json:"stateSources,omitempty"`
+}
+
+// SessionWithHashes is a [Session] with content hashes of its state and
+// events, letting clients detect changes without comparing payloads.
+type SessionWithHashes struct {
+	Session
+	// StateHash changes if and only if the state changes. It doesn't
+	// depend on the order of the keys.
+	StateHash string `json:"stateHash"`
+	// EventsHash changes whenever an event is added or removed.
+	EventsHash string `json:"eventsHash"`
+}
+
+// WithHashes returns the session with the content hashes of its state and
+// events.
+func (s Session) WithHashes() (SessionWithHashes, error) {
+	stateHash, err := contentHash(s.State)
+	if err != nil {
+		return SessionWithHashes{}, fmt.Errorf("failed to hash state: %w", err)
+	}
+	eventsHash, err := contentHash(s.Events)
+	if err != nil {
+		return SessionWithHashes{}, fmt.Errorf("failed to hash events: %w", err)
+	}
+	return SessionWithHashes{Session: s, StateHash: stateHash, EventsHash: eventsHash}, nil
+}
+
+// DedupSessionID returns the session ID derived from the dedup key of a
+// session of the user: the hex encoding of a 128-bit prefix of the SHA-256 of
+// the app name, the user ID and the key. The same key yields different IDs
+// for different users and apps.
+func DedupSessionID(appName, userID, dedupKey string) string {
+	// The JSON encoding of the parts keeps them apart, whatever they contain.
+	encoded, _ := json.Marshal([]string{appName, userID, dedupKey})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:16])
+}
+
+// contentHash returns the SHA-256 of the JSON encoding of v. The encoding
+// sorts map keys, so the hash is independent of map iteration order, and
+// numbers are encoded by value, so 1 and 1.0 hash the same.
+func contentHash(v any) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
 }
 
 type CreateSessionRequest struct {
 	State  map[string]any `json:"state"`
 	Events []Event        `json:"events"`
+	// Import makes the request idempotent: if the session already exists,
+	// only the events it doesn't contain yet are appended. Events are
+	// matched by ID, or by content when they have no ID.
+	Import bool `json:"import,omitempty"`
+	// Template names the session template of the app the session is
+	// seeded from. Its state and events are overridden and followed by
+	// the ones of the request.
+	Template string `json:"template,omitempty"`
+	// DedupKey is a client identifier the ID of the session is derived
+	// from, see [DedupSessionID], making the creation idempotent: creating
+	// a session with the key again returns the session created first,
+	// ignoring the state, events and labels of the request. It can't be
+	// combined with a session ID.
+	DedupKey string `json:"dedupKey,omitempty"`
+	// Labels are the initial labels of the session. They are not part of
+	// the state: the state key policies and coercions don't apply to them.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Checksum and Signature seal an exported session, see
+	// [SealSessionExport]. They are verified on import.
+	Checksum  string `json:"checksum,omitempty"`
+	Signature string `json:"signature,omitempty"`
 }
 
 type PatchSessionStateDeltaRequest struct {
 	StateDelta map[string]any `json:"stateDelta"`
 }
 
+// ValidateStateDeltaResponse is the normalized form of a validated state
+// delta, see [EncodeStateDelta].
+type ValidateStateDeltaResponse struct {
+	StateDelta map[string]any `json:"stateDelta"`
+}
+
+// AppendEventWithStateRequest represents a request to atomically apply a
+// state delta to a session and append an event to it.
+type AppendEventWithStateRequest struct {
+	StateDelta map[string]any `json:"stateDelta"`
+	Event      *Event         `json:"event"`
+}
+
+// AppendEventWithStateResponse is the session after an
+// [AppendEventWithStateRequest], with the appended event.
+type AppendEventWithStateResponse struct {
+	Session Session `json:"session"`
+	Event   Event   `json:"event"`
+}
+
+// TransactSessionsRequest represents a request to atomically apply state
+// deltas to several sessions of a user.
+type TransactSessionsRequest struct {
+	// StateDeltas maps a session ID to the state delta applied to it.
+	StateDeltas map[string]map[string]any `json:"stateDeltas"`
+}
+
 type SessionID struct {
 	ID      string `mapstructure:"session_id,optional"`
 	AppName string `mapstructure:"app_name,required"`
@@ -80,22 +225,27 @@ func SessionIDFromHTTPParameters(vars map[string]string) (SessionID, error) {
 	return sessionID, nil
 }
 
-func FromSession(session session.Session) (Session, error) {
+func FromSession(s session.Session) (Session, error) {
+	mappedSession := sessionHeader(s)
+	for event := range s.Events().All() {
+		mappedSession.Events = append(mappedSession.Events, FromSessionEvent(*event))
+	}
+	return mappedSession, mappedSession.Validate()
+}
+
+// sessionHeader maps everything of the session but its events, left empty.
+func sessionHeader(s session.Session) Session {
 	state := map[string]any{}
-	maps.Insert(state, session.State().All())
-	events := []Event{}
-	for event := range session.Events().All() {
-		events = append(events, FromSessionEvent(*event))
-	}
-	mappedSession := Session{
-		ID:        session.ID(),
-		AppName:   session.AppName(),
-		UserID:    session.UserID(),
-		UpdatedAt: session.LastUpdateTime().Unix(),
-		Events:    events,
+	maps.Insert(state, s.State().All())
+	return Session{
+		ID:        s.ID(),
+		AppName:   s.AppName(),
+		UserID:    s.UserID(),
+		UpdatedAt: s.LastUpdateTime().Unix(),
+		Events:    []Event{},
 		State:     state,
+		Labels:    session.SessionLabels(s),
 	}
-	return mappedSession, mappedSession.Validate()
 }
 
 func (s Session) Validate() error {
@@ -120,20 +270,99 @@ func (s Session) Validate() error {
 	return nil
 }
 
+// DirectiveConfig contains optional settings of state delta directive
+// processing. The zero value is a valid config.
+type DirectiveConfig struct {
+	// Aliases maps alternative directive names to the name of the built-in
+	// directive they stand for. Aliases named like a built-in directive are
+	// ignored, the built-in always wins.
+	Aliases map[string]string
+	// OnAlias, if set, is called for every directive spelled with an alias.
+	OnAlias func(key, alias, canonical string)
+	// UnknownDirectives is applied to the directives with an unknown name.
+	// Aliases of unknown directives are always an error.
+	UnknownDirectives UnknownDirectivePolicy
+	// OnUnknown, if set, is called for every unknown directive the policy
+	// doesn't reject.
+	OnUnknown func(key, name string)
+}
+
+// UnknownDirectivePolicy is what the normalization of a state delta does
+// with a directive whose name it doesn't know, for instance one introduced
+// by a newer version.
+type UnknownDirectivePolicy int
+
+const (
+	// UnknownDirectiveError fails the normalization.
+	UnknownDirectiveError UnknownDirectivePolicy = iota
+	// UnknownDirectiveIgnore drops the key from the delta, leaving it
+	// unchanged in the state.
+	UnknownDirectiveIgnore
+	// UnknownDirectiveSetRaw sets the key to the directive object as is,
+	// like any other map value.
+	UnknownDirectiveSetRaw
+)
+
+// errIgnoredDirective is returned by processDirective for a directive
+// dropped by [UnknownDirectiveIgnore].
+var errIgnoredDirective = errors.New("ignored directive")
+
+// resolve returns the built-in directive name stands for.
+func (c DirectiveConfig) resolve(key, name string) string {
+	if isBuiltinDirective(name) {
+		return name
+	}
+	canonical, ok := c.Aliases[name]
+	if !ok {
+		return name
+	}
+	if c.OnAlias != nil {
+		c.OnAlias(key, name, canonical)
+	}
+	return canonical
+}
+
+func isBuiltinDirective(name string) bool {
+	switch name {
+	case stateUpdateDelete, stateUpdateRename, stateUpdateCopy, stateUpdateSwap, stateUpdateSetIf, stateUpdateMin, stateUpdateMax, stateUpdateAddUnique, stateUpdateMerge:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsStateDirective reports whether a state delta value is a state update
+// directive.
+func IsStateDirective(value map[string]any) bool {
+	_, ok := value[stateUpdateKey]
+	return ok
+}
+
 // NormalizeStateDelta processes state delta directives and converts them
 // into a normalized representation suitable for the service layer.
 // Delete directives ({"$adk_state_update": "delete"}) are converted to nil values.
+// Directives depending on the current state, like rename, copy or swap, are converted to
+// [session.StateDirective] values resolved by the service layer.
 // Returns a new map with normalized values.
 func NormalizeStateDelta(stateDelta map[string]any) (map[string]any, error) {
+	return NormalizeStateDeltaWithConfig(stateDelta, DirectiveConfig{})
+}
+
+// NormalizeStateDeltaWithConfig is like [NormalizeStateDelta], using the
+// given config.
+func NormalizeStateDeltaWithConfig(stateDelta map[string]any, cfg DirectiveConfig) (map[string]any, error) {
 	normalized := make(map[string]any, len(stateDelta))
 	for key, value := range stateDelta {
 		// Check if value is a directive (map with special key)
 		directive, isDirective := value.(map[string]any)
 		if isDirective {
 			// Check if this map contains a state update directive
-			updateValue, hasDirective := directive[stateUpdateKey]
+			_, hasDirective := directive[stateUpdateKey]
 			if hasDirective {
-				normalizedValue, err := processDirective(key, updateValue)
+				normalizedValue, err := processDirective(key, directive, cfg)
+				if errors.Is(err, errIgnoredDirective) {
+					continue
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -151,7 +380,8 @@ func NormalizeStateDelta(stateDelta map[string]any) (map[string]any, error) {
 }
 
 // processDirective handles a state update directive and returns the normalized value.
-func processDirective(key string, updateValue any) (any, error) {
+func processDirective(key string, directive map[string]any, cfg DirectiveConfig) (any, error) {
+	updateValue := directive[stateUpdateKey]
 	updateStr, ok := updateValue.(string)
 	if !ok {
 		return nil, fmt.Errorf(
@@ -161,11 +391,168 @@ func processDirective(key string, updateValue any) (any, error) {
 		)
 	}
 
-	switch updateStr {
+	name := cfg.resolve(key, updateStr)
+	switch name {
 	case stateUpdateDelete:
 		// Delete directive: return nil to indicate deletion
 		return nil, nil
+	case stateUpdateRename:
+		to, err := directiveField[string](key, directive, "to", true)
+		if err != nil {
+			return nil, err
+		}
+		ignoreMissing, err := directiveField[bool](key, directive, "ignoreMissing", false)
+		if err != nil {
+			return nil, err
+		}
+		overwrite, err := directiveField[bool](key, directive, "overwrite", false)
+		if err != nil {
+			return nil, err
+		}
+		if to == "" {
+			return nil, fmt.Errorf("rename directive for key %q requires a non-empty \"to\" field", key)
+		}
+		return session.RenameKey{To: to, IgnoreMissing: ignoreMissing, Overwrite: overwrite}, nil
+	case stateUpdateCopy:
+		from, err := directiveField[string](key, directive, "from", true)
+		if err != nil {
+			return nil, err
+		}
+		if from == "" {
+			return nil, fmt.Errorf("copy directive for key %q requires a non-empty \"from\" field", key)
+		}
+		return session.CopyKey{From: from}, nil
+	case stateUpdateSwap:
+		with, err := directiveField[string](key, directive, "with", true)
+		if err != nil {
+			return nil, err
+		}
+		if with == "" {
+			return nil, fmt.Errorf("swap directive for key %q requires a non-empty \"with\" field", key)
+		}
+		return session.SwapKeys{With: with}, nil
+	case stateUpdateSetIf:
+		when, err := directiveField[map[string]any](key, directive, "when", true)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := directive["value"]
+		if !ok {
+			return nil, fmt.Errorf("setIf directive for key %q requires the \"value\" field", key)
+		}
+		predicateKey, ok := when["key"].(string)
+		if !ok {
+			return nil, fmt.Errorf("setIf directive for key %q requires a string \"key\" in its \"when\" field", key)
+		}
+		op, ok := when["op"].(string)
+		if !ok {
+			return nil, fmt.Errorf("setIf directive for key %q requires a string \"op\" in its \"when\" field", key)
+		}
+		predicate := session.Predicate{Key: predicateKey, Op: session.CompareOp(op), Value: when["value"]}
+		if err := predicate.Validate(); err != nil {
+			return nil, fmt.Errorf("setIf directive for key %q: %w", key, err)
+		}
+		return session.SetIf{When: predicate, Value: value}, nil
+	case stateUpdateMin, stateUpdateMax:
+		value, ok := directive["value"]
+		if !ok {
+			return nil, fmt.Errorf("%s directive for key %q requires the \"value\" field", name, key)
+		}
+		if _, ok := value.(float64); !ok {
+			return nil, fmt.Errorf("%s directive for key %q requires a number \"value\" field, got %T", name, key, value)
+		}
+		if name == stateUpdateMin {
+			return session.KeepMin{Value: value}, nil
+		}
+		return session.KeepMax{Value: value}, nil
+	case stateUpdateAddUnique:
+		value, ok := directive["value"]
+		if !ok {
+			return nil, fmt.Errorf("addUnique directive for key %q requires the \"value\" field", key)
+		}
+		return session.AddUnique{Value: value}, nil
+	case stateUpdateMerge:
+		value, err := directiveField[map[string]any](key, directive, "value", true)
+		if err != nil {
+			return nil, err
+		}
+		pointer, err := directiveField[string](key, directive, "path", false)
+		if err != nil {
+			return nil, err
+		}
+		path, err := ParseJSONPointer(pointer)
+		if err != nil {
+			return nil, fmt.Errorf("merge directive for key %q: %w", key, err)
+		}
+		return session.MergeValue{Path: path, Value: value}, nil
 	default:
+		if name != updateStr {
+			return nil, fmt.Errorf("state update directive %q for key %q is an alias of unknown directive %q", updateStr, key, name)
+		}
+		if cfg.UnknownDirectives != UnknownDirectiveError && cfg.OnUnknown != nil {
+			cfg.OnUnknown(key, updateStr)
+		}
+		switch cfg.UnknownDirectives {
+		case UnknownDirectiveIgnore:
+			return nil, errIgnoredDirective
+		case UnknownDirectiveSetRaw:
+			return directive, nil
+		}
 		return nil, fmt.Errorf("unknown state update directive %q for key %q", updateStr, key)
 	}
 }
+
+// EncodeStateDelta returns the JSON form of a delta normalized by
+// [NormalizeStateDelta]: deletions are nil values, and the other directives
+// are spelled out with their canonical name and all their fields.
+func EncodeStateDelta(normalized map[string]any) (map[string]any, error) {
+	encoded := make(map[string]any, len(normalized))
+	for key, value := range normalized {
+		directive, ok := value.(session.StateDirective)
+		if !ok {
+			encoded[key] = value
+			continue
+		}
+		switch d := directive.(type) {
+		case session.RenameKey:
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateRename, "to": d.To, "ignoreMissing": d.IgnoreMissing, "overwrite": d.Overwrite}
+		case session.CopyKey:
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateCopy, "from": d.From}
+		case session.SwapKeys:
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateSwap, "with": d.With}
+		case session.SetIf:
+			when := map[string]any{"key": d.When.Key, "op": string(d.When.Op), "value": d.When.Value}
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateSetIf, "when": when, "value": d.Value}
+		case session.KeepMin:
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateMin, "value": d.Value}
+		case session.KeepMax:
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateMax, "value": d.Value}
+		case session.AddUnique:
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateAddUnique, "value": d.Value}
+		case session.MergeValue:
+			encoded[key] = map[string]any{stateUpdateKey: stateUpdateMerge, "value": d.Value, "path": FormatJSONPointer(d.Path)}
+		default:
+			return nil, fmt.Errorf("state directive %T for key %q has no JSON form", directive, key)
+		}
+	}
+	return encoded, nil
+}
+
+// directiveField returns the field of a directive converted to T.
+// It returns an error if the field has a different type, or if it is
+// required and absent.
+func directiveField[T any](key string, directive map[string]any, field string, required bool) (T, error) {
+	var zero T
+	value, ok := directive[field]
+	if !ok {
+		if required {
+			return zero, fmt.Errorf("%v directive for key %q requires the %q field", directive[stateUpdateKey], key, field)
+		}
+		return zero, nil
+	}
+	typed, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("invalid %q field type in %v directive for key %q: expected %T, got %T", field, directive[stateUpdateKey], key, zero, value)
+	}
+	return typed, nil
+}
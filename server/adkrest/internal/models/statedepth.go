@@ -0,0 +1,135 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// TruncatedKey is the key of the placeholder replacing the objects and
+// arrays nested deeper than requested, see [TruncateDepth].
+const TruncatedKey = "$adk_truncated"
+
+// Truncated describes a truncated object or array.
+type Truncated struct {
+	// Type is "object" or "array".
+	Type string `json:"type"`
+	// Size is the number of entries of the object or elements of the
+	// array.
+	Size int `json:"size"`
+}
+
+// TruncateDepth returns a copy of value keeping maxDepth levels of nesting
+// below it. The objects and arrays below that are replaced by a placeholder
+// {"$adk_truncated": {"type": ..., "size": ...}} telling the client more
+// data exists; it can be fetched with the JSON Pointer of the placeholder.
+// Scalars are kept at any depth, and value is returned as is if maxDepth is
+// zero or less.
+func TruncateDepth(value any, maxDepth int) any {
+	if maxDepth <= 0 {
+		return value
+	}
+	return truncateDepth(value, maxDepth)
+}
+
+// TruncateStateDepth is [TruncateDepth] for a session state, whose keys are
+// the first level.
+func TruncateStateDepth(state map[string]any, maxDepth int) map[string]any {
+	if maxDepth <= 0 {
+		return state
+	}
+	return truncateDepth(state, maxDepth).(map[string]any)
+}
+
+// CheckStateDepth returns an error naming the first key of the state, in
+// key order, whose value nests objects and arrays deeper than maxDepth
+// levels, the keys of the state being the first level as for
+// [TruncateStateDepth]: {"a": 1} has a depth of 1 and {"a": {}} of 2. The
+// decoded JSON values are walked without recursion, so that over-deep
+// values are rejected before the recursive processing of directives, merges
+// and diffs. Any depth is accepted if maxDepth is zero or less.
+func CheckStateDepth(state map[string]any, maxDepth int) error {
+	if maxDepth <= 0 {
+		return nil
+	}
+	type level struct {
+		value any
+		depth int
+	}
+	var stack []level
+	for _, key := range slices.Sorted(maps.Keys(state)) {
+		stack = append(stack[:0], level{state[key], 1})
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			var children []any
+			switch v := top.value.(type) {
+			case map[string]any:
+				children = slices.AppendSeq(make([]any, 0, len(v)), maps.Values(v))
+			case []any:
+				children = v
+			default:
+				continue
+			}
+			if top.depth >= maxDepth {
+				return fmt.Errorf("state key %q is nested deeper than %d levels", key, maxDepth)
+			}
+			for _, child := range children {
+				stack = append(stack, level{child, top.depth + 1})
+			}
+		}
+	}
+	return nil
+}
+
+// truncateDepth copies the containers of value down to depth levels below
+// it, and replaces value with a placeholder if it is a container and depth
+// is zero.
+func truncateDepth(value any, depth int) any {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String || rv.IsNil() {
+			return value
+		}
+		if depth == 0 {
+			return map[string]any{TruncatedKey: Truncated{Type: "object", Size: rv.Len()}}
+		}
+		truncated := make(map[string]any, rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			truncated[iter.Key().String()] = truncateDepth(iter.Value().Interface(), depth-1)
+		}
+		return truncated
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && (rv.IsNil() || rv.Type().Elem().Kind() == reflect.Uint8) {
+			// Nil slices are encoded as null and byte slices as base64
+			// strings, which are scalars.
+			return value
+		}
+		if depth == 0 {
+			return map[string]any{TruncatedKey: Truncated{Type: "array", Size: rv.Len()}}
+		}
+		truncated := make([]any, rv.Len())
+		for i := range truncated {
+			truncated[i] = truncateDepth(rv.Index(i).Interface(), depth-1)
+		}
+		return truncated
+	default:
+		return value
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"maps"
+	"reflect"
+	"strings"
+
+	"google.golang.org/adk/session"
+)
+
+// StatePreview is the response of a dry-run state patch.
+type StatePreview struct {
+	// State is the state the session would have after the patch.
+	State map[string]any `json:"state"`
+	// Diff lists the changes the patch would make, when requested.
+	Diff *StateDiff `json:"diff,omitempty"`
+	// Outcomes maps the keys of the delta to their outcome, when requested.
+	// State is then null if an entry would fail.
+	Outcomes map[string]DeltaOutcome `json:"outcomes,omitempty"`
+}
+
+// VerbosePatchResponse is the response of a state patch reporting the
+// outcome of its entries.
+type VerbosePatchResponse struct {
+	Session Session `json:"session"`
+	// Outcomes maps the keys of the delta to their outcome.
+	Outcomes map[string]DeltaOutcome `json:"outcomes"`
+}
+
+// DeltaOutcome is the outcome of an entry of a state delta: "applied",
+// "noop" or "error", see [session.EvaluateStateDelta].
+type DeltaOutcome struct {
+	Outcome string `json:"outcome"`
+	// ChangedKeys are the keys the entry changes.
+	ChangedKeys []string `json:"changedKeys,omitempty"`
+	// Error is the error a failing entry would fail the patch with.
+	Error string `json:"error,omitempty"`
+}
+
+// FromStateDeltaOutcomes converts the outcomes of the entries of a delta,
+// and reports whether one of them fails.
+func FromStateDeltaOutcomes(outcomes map[string]session.StateDeltaEntryOutcome) (map[string]DeltaOutcome, bool) {
+	converted := make(map[string]DeltaOutcome, len(outcomes))
+	failed := false
+	for key, outcome := range outcomes {
+		c := DeltaOutcome{Outcome: string(outcome.Outcome), ChangedKeys: outcome.ChangedKeys}
+		if outcome.Err != nil {
+			c.Error = outcome.Err.Error()
+			failed = true
+		}
+		converted[key] = c
+	}
+	return converted, failed
+}
+
+// StateDiff lists the differences between two states.
+type StateDiff struct {
+	// Added maps the new keys to their value.
+	Added map[string]any `json:"added"`
+	// Removed maps the removed keys to their previous value.
+	Removed map[string]any `json:"removed"`
+	// Changed maps the keys with a new value to the change.
+	Changed map[string]ValueChange `json:"changed"`
+}
+
+// ValueChange is the change of the value of a state key.
+type ValueChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// DiffStates returns the differences from the before to the after state.
+// Values are compared deeply.
+func DiffStates(before, after map[string]any) StateDiff {
+	diff := StateDiff{
+		Added:   map[string]any{},
+		Removed: map[string]any{},
+		Changed: map[string]ValueChange{},
+	}
+	for key, beforeValue := range before {
+		afterValue, ok := after[key]
+		switch {
+		case !ok:
+			diff.Removed[key] = beforeValue
+		case !reflect.DeepEqual(beforeValue, afterValue):
+			diff.Changed[key] = ValueChange{Before: beforeValue, After: afterValue}
+		}
+	}
+	for key, afterValue := range after {
+		if _, ok := before[key]; !ok {
+			diff.Added[key] = afterValue
+		}
+	}
+	return diff
+}
+
+// PreviewStateDelta returns the state resulting from applying a normalized
+// delta to a copy of state, resolving its directives like the service layer
+// does. Temporary keys are left out, as they are never persisted.
+func PreviewStateDelta(state, delta map[string]any) (map[string]any, error) {
+	resolved, err := session.ResolveStateDelta(state, delta)
+	if err != nil {
+		return nil, err
+	}
+	preview := maps.Clone(state)
+	if preview == nil {
+		preview = map[string]any{}
+	}
+	for key, value := range resolved {
+		if strings.HasPrefix(key, session.KeyPrefixTemp) {
+			continue
+		}
+		if value == nil {
+			delete(preview, key)
+		} else {
+			preview[key] = value
+		}
+	}
+	return preview, nil
+}
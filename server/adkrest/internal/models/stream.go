@@ -0,0 +1,159 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"google.golang.org/adk/session"
+)
+
+// SessionStream encodes a session with its hashes, see [SessionWithHashes],
+// one event at a time: events are converted and encoded as they are
+// written, so that the memory used by the encoding is bounded by the
+// largest event rather than by the whole session. The encoding is the one
+// json.Encoder produces for the SessionWithHashes of [FromSession].
+type SessionStream struct {
+	// header is the session without its events.
+	header SessionWithHashes
+	events []*session.Event
+}
+
+// NewSessionStream returns the stream of the session. Like [FromSession], it
+// fails if the session lacks an ID. The hashes are computed here, one event
+// at a time.
+func NewSessionStream(s session.Session) (*SessionStream, error) {
+	header := sessionHeader(s)
+	if err := header.Validate(); err != nil {
+		return nil, err
+	}
+	events := slices.Collect(s.Events().All())
+	stateHash, err := contentHash(header.State)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash state: %w", err)
+	}
+	eventsHash := sha256.New()
+	hashWriter := &stickyWriter{w: eventsHash}
+	if writeEvents(hashWriter, events); hashWriter.err != nil {
+		return nil, fmt.Errorf("failed to hash events: %w", hashWriter.err)
+	}
+	return &SessionStream{
+		header: SessionWithHashes{
+			Session:    header,
+			StateHash:  stateHash,
+			EventsHash: "sha256:" + hex.EncodeToString(eventsHash.Sum(nil)),
+		},
+		events: events,
+	}, nil
+}
+
+// SetEvents replaces the events written, for instance by the collapsed
+// ones. The hashes stay the ones of all the events of the session.
+func (s *SessionStream) SetEvents(events []*session.Event) {
+	s.events = events
+}
+
+// TruncateState truncates the state written, and its merged view, see
+// [TruncateStateDepth]. The hash stays the one of the whole state.
+func (s *SessionStream) TruncateState(maxDepth int) {
+	s.header.State = TruncateStateDepth(s.header.State, maxDepth)
+	if s.header.MergedState != nil {
+		s.header.MergedState = TruncateStateDepth(s.header.MergedState, maxDepth)
+	}
+}
+
+// MergeState adds the merged view of the state scopes to the session
+// written, with the source scope of every key if withSources is set, see
+// [MergeStateScopes].
+func (s *SessionStream) MergeState(withSources bool) {
+	merged, sources := MergeStateScopes(s.header.State)
+	s.header.MergedState = merged
+	if withSources {
+		s.header.StateSources = sources
+	}
+}
+
+// eventsKey is the events key of an encoded [SessionWithHashes] whose events
+// are empty. It is the first occurrence of the sequence: the fields before
+// it are strings, whose quotes are escaped.
+var eventsKey = []byte(`"events":[]`)
+
+// WriteTo implements [io.WriterTo]. The events are written one Write call
+// each.
+func (s *SessionStream) WriteTo(w io.Writer) (int64, error) {
+	// The header is encoded with empty events, which are spliced in.
+	var header bytes.Buffer
+	if err := json.NewEncoder(&header).Encode(s.header); err != nil {
+		return 0, err
+	}
+	prefix, suffix, ok := bytes.Cut(header.Bytes(), eventsKey)
+	if !ok {
+		return 0, fmt.Errorf("encoded session has no events")
+	}
+	sw := &stickyWriter{w: w}
+	sw.Write(prefix)
+	sw.Write(eventsKey[:len(eventsKey)-2])
+	writeEvents(sw, s.events)
+	sw.Write(suffix)
+	return sw.n, sw.err
+}
+
+// writeEvents writes the JSON array of the events, as json.Marshal encodes
+// a []Event, with a Write call per event.
+func writeEvents(sw *stickyWriter, events []*session.Event) {
+	sw.Write([]byte("["))
+	for i, event := range events {
+		encoded, err := json.Marshal(FromSessionEvent(*event))
+		if err != nil {
+			sw.fail(err)
+			return
+		}
+		if i > 0 {
+			encoded = append([]byte(","), encoded...)
+		}
+		sw.Write(encoded)
+	}
+	sw.Write([]byte("]"))
+}
+
+// stickyWriter counts the bytes written to w, and drops the writes after
+// the first error, which it keeps.
+type stickyWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (sw *stickyWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	n, err := sw.w.Write(p)
+	sw.n += int64(n)
+	sw.err = err
+	return n, err
+}
+
+func (sw *stickyWriter) fail(err error) {
+	if sw.err == nil {
+		sw.err = err
+	}
+}
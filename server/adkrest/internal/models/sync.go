@@ -0,0 +1,169 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"google.golang.org/adk/session"
+)
+
+// syncTokenPrefix versions the sync token format.
+const syncTokenPrefix = "s1:"
+
+// SyncToken is the position of a client in the history of a session: the
+// last event it received, and the version of the state shared with other
+// sessions it holds.
+type SyncToken struct {
+	// EventID is the ID of the last event received, empty when the session
+	// had no events.
+	EventID string `json:"event"`
+	// SharedState is the version of the app and user state, see
+	// [SharedStateVersion].
+	SharedState string `json:"state"`
+}
+
+// EncodeSyncToken returns the opaque form of the token.
+func EncodeSyncToken(token SyncToken) string {
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(append([]byte(syncTokenPrefix), data...))
+}
+
+// DecodeSyncToken parses a token created by [EncodeSyncToken].
+func DecodeSyncToken(s string) (SyncToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return SyncToken{}, fmt.Errorf("invalid sync token")
+	}
+	payload, ok := strings.CutPrefix(string(data), syncTokenPrefix)
+	if !ok {
+		return SyncToken{}, fmt.Errorf("invalid sync token")
+	}
+	var token SyncToken
+	if err := json.Unmarshal([]byte(payload), &token); err != nil {
+		return SyncToken{}, fmt.Errorf("invalid sync token")
+	}
+	return token, nil
+}
+
+// SharedStateVersion returns a digest of the app and user keys of the
+// state. They are changed by other sessions too, without an event of the
+// synced session, which the version lets a sync detect.
+func SharedStateVersion(state map[string]any) (string, error) {
+	shared := map[string]any{}
+	for key, value := range state {
+		if strings.HasPrefix(key, session.KeyPrefixApp) || strings.HasPrefix(key, session.KeyPrefixUser) {
+			shared[key] = value
+		}
+	}
+	// Marshal sorts the keys, which makes the encoding canonical.
+	data, err := json.Marshal(shared)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode shared state: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// SyncResponse holds the changes of a session since a sync token.
+type SyncResponse struct {
+	// Events are the events appended since the token, in order.
+	Events []Event `json:"events"`
+	// State maps the keys changed since the token to their value.
+	State map[string]any `json:"state"`
+	// RemovedKeys lists the keys removed since the token.
+	RemovedKeys []string `json:"removedKeys"`
+	// Reset reports that the token could not be resumed, because it is
+	// empty or its event is no longer stored: Events holds all the events
+	// and State the whole state, which replace the copy of the client.
+	Reset bool `json:"reset,omitempty"`
+	// SharedStateReset reports that the app or user state changed outside
+	// of the events: State holds all their keys, which replace the app and
+	// user keys of the client.
+	SharedStateReset bool `json:"sharedStateReset,omitempty"`
+	// SyncToken is passed to the next sync to get the changes since this
+	// one.
+	SyncToken string `json:"syncToken"`
+}
+
+// SyncSession returns the changes of the session since the token. The
+// changes of the session state are those of the state deltas of the events
+// since the token; the changes of the app and user state are detected with
+// the version of the token. An empty token returns everything.
+func SyncSession(events []*session.Event, state map[string]any, token string) (SyncResponse, error) {
+	version, err := SharedStateVersion(state)
+	if err != nil {
+		return SyncResponse{}, err
+	}
+	next := SyncToken{SharedState: version}
+	if len(events) > 0 {
+		next.EventID = events[len(events)-1].ID
+	}
+	resp := SyncResponse{Events: []Event{}, State: map[string]any{}, RemovedKeys: []string{}, SyncToken: EncodeSyncToken(next)}
+
+	start, resumed := 0, false
+	var prev SyncToken
+	if token != "" {
+		if prev, err = DecodeSyncToken(token); err != nil {
+			return SyncResponse{}, err
+		}
+		if prev.EventID == "" {
+			resumed = true
+		} else if i := slices.IndexFunc(events, func(e *session.Event) bool { return e.ID == prev.EventID }); i >= 0 {
+			start, resumed = i+1, true
+		}
+	}
+	for _, event := range events[start:] {
+		resp.Events = append(resp.Events, FromSessionEvent(*event))
+	}
+	if !resumed {
+		resp.Reset = true
+		maps.Copy(resp.State, state)
+		return resp, nil
+	}
+
+	changed := map[string]bool{}
+	for _, event := range events[start:] {
+		for key := range event.Actions.StateDelta {
+			if !strings.HasPrefix(key, session.KeyPrefixTemp) {
+				changed[key] = true
+			}
+		}
+	}
+	if prev.SharedState != version {
+		resp.SharedStateReset = true
+		for key := range state {
+			if strings.HasPrefix(key, session.KeyPrefixApp) || strings.HasPrefix(key, session.KeyPrefixUser) {
+				changed[key] = true
+			}
+		}
+	}
+	for key := range changed {
+		if value, ok := state[key]; ok {
+			resp.State[key] = value
+		} else {
+			resp.RemovedKeys = append(resp.RemovedKeys, key)
+		}
+	}
+	slices.Sort(resp.RemovedKeys)
+	return resp, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"slices"
+	"time"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/session"
+)
+
+// Tool call statuses.
+const (
+	// ToolCallCompleted is a call paired with its response.
+	ToolCallCompleted = "completed"
+	// ToolCallPending is a call without a response yet.
+	ToolCallPending = "pending"
+	// ToolCallUnmatched is a response without the call it answers, for
+	// instance one whose call was compacted away.
+	ToolCallUnmatched = "unmatched"
+)
+
+// ToolCalls is the tool invocations of a session.
+type ToolCalls struct {
+	Calls []ToolCall `json:"calls"`
+}
+
+// ToolCall is a tool invocation of a [ToolCalls]: a function call of an
+// event, paired by ID with the function response of a later event.
+type ToolCall struct {
+	// ID is the ID of the function call.
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Args are the arguments of the call, and Response the response of the
+	// tool.
+	Args     map[string]any `json:"args,omitempty"`
+	Response map[string]any `json:"response,omitempty"`
+	// Author is the agent which called the tool.
+	Author       string `json:"author,omitempty"`
+	InvocationID string `json:"invocationId,omitempty"`
+	// LongRunning is set for the calls of long running tools, see
+	// [session.Event.LongRunningToolIDs].
+	LongRunning bool `json:"longRunning,omitempty"`
+	// CallEventID and ResponseEventID are the IDs of the events holding
+	// the call and the response.
+	CallEventID     string `json:"callEventId,omitempty"`
+	ResponseEventID string `json:"responseEventId,omitempty"`
+	// CalledAt and RespondedAt are the timestamps of the events of the call
+	// and of the response, and LatencyMs the milliseconds between the two.
+	CalledAt    *time.Time `json:"calledAt,omitempty"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+	LatencyMs   *int64     `json:"latencyMs,omitempty"`
+}
+
+// ToolCallsFromEvents extracts the tool invocations of the events, in the
+// order of the calls. A response is paired with the latest call of its ID
+// not answered yet; calls and responses without an ID are never paired.
+// Partial events are left out, callers collapse them first.
+func ToolCallsFromEvents(events []*session.Event) ToolCalls {
+	calls := ToolCalls{Calls: []ToolCall{}}
+	// pending maps a call ID to the index of its unanswered call.
+	pending := map[string]int{}
+	for _, event := range events {
+		if event.Partial || event.Content == nil {
+			continue
+		}
+		timestamp := event.Timestamp
+		for _, part := range event.Content.Parts {
+			if part == nil {
+				continue
+			}
+			if call := part.FunctionCall; call != nil {
+				if call.ID != "" {
+					pending[call.ID] = len(calls.Calls)
+				}
+				calls.Calls = append(calls.Calls, ToolCall{
+					ID:           call.ID,
+					Name:         call.Name,
+					Status:       ToolCallPending,
+					Args:         callArgs(part),
+					Author:       event.Author,
+					InvocationID: event.InvocationID,
+					LongRunning:  call.ID != "" && slices.Contains(event.LongRunningToolIDs, call.ID),
+					CallEventID:  event.ID,
+					CalledAt:     &timestamp,
+				})
+			}
+			if response := part.FunctionResponse; response != nil {
+				i, ok := pending[response.ID]
+				if !ok || response.ID == "" {
+					calls.Calls = append(calls.Calls, ToolCall{
+						ID:              response.ID,
+						Name:            response.Name,
+						Status:          ToolCallUnmatched,
+						Response:        response.Response,
+						InvocationID:    event.InvocationID,
+						ResponseEventID: event.ID,
+						RespondedAt:     &timestamp,
+					})
+					continue
+				}
+				delete(pending, response.ID)
+				call := &calls.Calls[i]
+				call.Status = ToolCallCompleted
+				call.Response = response.Response
+				call.ResponseEventID = event.ID
+				call.RespondedAt = &timestamp
+				latency := timestamp.Sub(*call.CalledAt).Milliseconds()
+				call.LatencyMs = &latency
+			}
+		}
+	}
+	return calls
+}
+
+// callArgs returns the arguments of the function call of the part, decoded
+// if they are stored as a JSON string, see [Event.StructuredArgs].
+func callArgs(part *genai.Part) map[string]any {
+	if args, ok := decodeStringArgs(part); ok {
+		return args
+	}
+	return part.FunctionCall.Args
+}
@@ -0,0 +1,68 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "strings"
+
+// Transcript roles.
+const (
+	TranscriptRoleUser      = "user"
+	TranscriptRoleAssistant = "assistant"
+)
+
+// Transcript is the conversation of a session as a chat transcript.
+type Transcript struct {
+	Turns []TranscriptTurn `json:"turns"`
+}
+
+// TranscriptTurn is a turn of a [Transcript].
+type TranscriptTurn struct {
+	// Role is "user" for the turns of the user and "assistant" for the ones
+	// of the agents.
+	Role string `json:"role"`
+	// Content is the text of the turn.
+	Content string `json:"content"`
+}
+
+// TranscriptFromEvents projects the events into a transcript, in order.
+// The projection is lossy: partial events, the events without text like
+// tool calls and responses, and the thoughts of the model are left out,
+// and the text parts of an event are concatenated into one turn. Callers
+// collapse the partial events superseded by a final one first, so that
+// the final events hold the text of the partial ones.
+func TranscriptFromEvents(events []Event) Transcript {
+	transcript := Transcript{Turns: []TranscriptTurn{}}
+	for _, event := range events {
+		if event.Partial || event.Content == nil {
+			continue
+		}
+		var text strings.Builder
+		for _, part := range event.Content.Parts {
+			if part == nil || part.Thought {
+				continue
+			}
+			text.WriteString(part.Text)
+		}
+		if text.Len() == 0 {
+			continue
+		}
+		role := TranscriptRoleAssistant
+		if event.Content.Role == "user" {
+			role = TranscriptRoleUser
+		}
+		transcript.Turns = append(transcript.Turns, TranscriptTurn{Role: role, Content: text.String()})
+	}
+	return transcript
+}
@@ -0,0 +1,27 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+// UndoResponse is the response of an undo or redo of a session state
+// change.
+type UndoResponse struct {
+	Session Session `json:"session"`
+	// Event is the appended event reverting or reapplying the change.
+	Event Event `json:"event"`
+	// UndoDepth and RedoDepth are the number of changes left to undo and
+	// to redo.
+	UndoDepth int `json:"undoDepth"`
+	RedoDepth int `json:"redoDepth"`
+}
@@ -0,0 +1,69 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routers
+
+import (
+	"net/http"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+)
+
+// AdminAPIRouter defines the routes for the Admin API.
+type AdminAPIRouter struct {
+	adminController *controllers.AdminAPIController
+}
+
+// NewAdminAPIRouter creates a new AdminAPIRouter.
+func NewAdminAPIRouter(controller *controllers.AdminAPIController) *AdminAPIRouter {
+	return &AdminAPIRouter{adminController: controller}
+}
+
+// Routes returns the routes for the Admin API.
+func (r *AdminAPIRouter) Routes() Routes {
+	return Routes{
+		Route{
+			Name:        "GetReadOnly",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/admin/read-only",
+			HandlerFunc: r.adminController.GetReadOnlyHandler,
+		},
+		Route{
+			Name:        "SetReadOnly",
+			Methods:     []string{http.MethodPut},
+			Pattern:     "/admin/read-only",
+			HandlerFunc: r.adminController.SetReadOnlyHandler,
+		},
+		Route{
+			Name:        "GetServerInfo",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/admin/info",
+			HandlerFunc: r.adminController.ServerInfoHandler,
+		},
+		Route{
+			Name:        "DeleteSessions",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/admin/sessions:delete",
+			HandlerFunc: r.adminController.DeleteSessionsHandler,
+		},
+		// The session's user is a route variable of its own, user_id is the
+		// authenticated admin.
+		Route{
+			Name:        "SetSystemState",
+			Methods:     []string{http.MethodPatch},
+			Pattern:     "/admin/apps/{app_name}/users/{target_user_id}/sessions/{session_id}/system-state",
+			HandlerFunc: r.adminController.SetSystemStateHandler,
+		},
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routers
+
+import (
+	"net/http"
+
+	"google.golang.org/adk/server/adkrest/controllers"
+)
+
+// MetricsAPIRouter defines the routes for the Metrics API.
+type MetricsAPIRouter struct {
+	metricsController *controllers.MetricsAPIController
+}
+
+// NewMetricsAPIRouter creates a new MetricsAPIRouter.
+func NewMetricsAPIRouter(controller *controllers.MetricsAPIController) *MetricsAPIRouter {
+	return &MetricsAPIRouter{metricsController: controller}
+}
+
+// Routes returns the routes for the Metrics API.
+func (r *MetricsAPIRouter) Routes() Routes {
+	return Routes{
+		Route{
+			Name:        "Metrics",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/metrics",
+			HandlerFunc: r.metricsController.MetricsHandler,
+		},
+	}
+}
@@ -17,6 +17,7 @@ package routers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -58,3 +59,62 @@ func SetupSubRouters(router *mux.Router, subrouters ...Router) {
 		}
 	}
 }
+
+// userPathSegment is the path segment naming the user in user scoped routes.
+const userPathSegment = "/users/{user_id}"
+
+// WithoutUserIDRouteName returns the name of the variant of the route which
+// [WithoutUserID] adds.
+func WithoutUserIDRouteName(name string) string {
+	return name + "WithoutUserID"
+}
+
+// withoutUserID wraps a router, adding a variant of every user scoped route
+// with the user segment removed from its path.
+type withoutUserID struct {
+	router Router
+}
+
+// WithoutUserID returns a router serving the routes of router, and the user
+// scoped routes again without the /users/{user_id} path segment. It is used
+// when the user is derived from the request's credentials instead.
+func WithoutUserID(router Router) Router {
+	return withoutUserID{router: router}
+}
+
+// Routes returns the routes of the wrapped router and their variants without
+// the user segment.
+func (r withoutUserID) Routes() Routes {
+	routes := r.router.Routes()
+	for _, route := range routes {
+		if !strings.Contains(route.Pattern, userPathSegment) {
+			continue
+		}
+		route.Name = WithoutUserIDRouteName(route.Name)
+		route.Pattern = strings.Replace(route.Pattern, userPathSegment, "", 1)
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// withMiddleware wraps a router, applying a middleware to all its routes.
+type withMiddleware struct {
+	router     Router
+	middleware mux.MiddlewareFunc
+}
+
+// WithMiddleware returns a router serving the routes of router through the
+// middleware, for instance to restrict them to some users.
+func WithMiddleware(router Router, middleware mux.MiddlewareFunc) Router {
+	return withMiddleware{router: router, middleware: middleware}
+}
+
+// Routes returns the routes of the wrapped router, with their handlers
+// wrapped by the middleware.
+func (r withMiddleware) Routes() Routes {
+	routes := r.router.Routes()
+	for i, route := range routes {
+		routes[i].HandlerFunc = r.middleware(route.HandlerFunc).ServeHTTP
+	}
+	return routes
+}
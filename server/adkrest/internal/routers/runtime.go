@@ -45,5 +45,11 @@ func (r *RuntimeAPIRouter) Routes() Routes {
 			Pattern:     "/run_sse",
 			HandlerFunc: controllers.NewErrorHandler(r.runtimeController.RunSSEHandler),
 		},
+		Route{
+			Name:        "RunSessionSse",
+			Methods:     []string{http.MethodPost, http.MethodOptions},
+			Pattern:     "/run_session_sse",
+			HandlerFunc: controllers.NewErrorHandler(r.runtimeController.RunSessionSSEHandler),
+		},
 	}
 }
@@ -39,6 +39,12 @@ func (r *SessionsAPIRouter) Routes() Routes {
 			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}",
 			HandlerFunc: r.sessionController.GetSessionHandler,
 		},
+		Route{
+			Name:        "HeadSession",
+			Methods:     []string{http.MethodHead},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}",
+			HandlerFunc: r.sessionController.HeadSessionHandler,
+		},
 		Route{
 			Name:        "CreateSession",
 			Methods:     []string{http.MethodPost},
@@ -69,5 +75,143 @@ func (r *SessionsAPIRouter) Routes() Routes {
 			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}",
 			HandlerFunc: r.sessionController.UpdateSessionHandler,
 		},
+		Route{
+			Name:        "AppendEvent",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/events",
+			HandlerFunc: r.sessionController.AppendEventHandler,
+		},
+		Route{
+			Name:        "AppendEventWithState",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/events:withState",
+			HandlerFunc: r.sessionController.AppendEventWithStateHandler,
+		},
+		Route{
+			Name:        "AppendEvents",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/events:batch",
+			HandlerFunc: r.sessionController.AppendEventsHandler,
+		},
+		Route{
+			Name:        "UploadEventAttachment",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/events:upload",
+			HandlerFunc: r.sessionController.UploadEventAttachmentHandler,
+		},
+		Route{
+			Name:        "GetSessionState",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/state",
+			HandlerFunc: r.sessionController.GetSessionStateHandler,
+		},
+		Route{
+			Name:        "SetSessionLabels",
+			Methods:     []string{http.MethodPatch},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/labels",
+			HandlerFunc: r.sessionController.SetSessionLabelsHandler,
+		},
+		Route{
+			Name:        "PinEvent",
+			Methods:     []string{http.MethodPut},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/events/{event_id}/pin",
+			HandlerFunc: r.sessionController.PinEventHandler,
+		},
+		Route{
+			Name:        "UnpinEvent",
+			Methods:     []string{http.MethodDelete},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/events/{event_id}/pin",
+			HandlerFunc: r.sessionController.PinEventHandler,
+		},
+		Route{
+			Name:        "GetSessionTranscript",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/transcript",
+			HandlerFunc: r.sessionController.GetSessionTranscriptHandler,
+		},
+		Route{
+			Name:        "GetSessionToolCalls",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/tool-calls",
+			HandlerFunc: r.sessionController.GetSessionToolCallsHandler,
+		},
+		Route{
+			Name:        "ListEvents",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/events",
+			HandlerFunc: r.sessionController.ListEventsHandler,
+		},
+		Route{
+			Name:        "SyncSession",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/sync",
+			HandlerFunc: r.sessionController.SyncSessionHandler,
+		},
+		Route{
+			Name:        "WatchUserEvents",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/users/{user_id}/events",
+			HandlerFunc: r.sessionController.WatchUserEventsHandler,
+		},
+		Route{
+			Name:        "ExportSessions",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/sessions:export",
+			HandlerFunc: r.sessionController.ExportSessionsHandler,
+		},
+		Route{
+			Name:        "ExportSessionLogs",
+			Methods:     []string{http.MethodGet},
+			Pattern:     "/apps/{app_name}/sessions:exportLogs",
+			HandlerFunc: r.sessionController.ExportSessionLogsHandler,
+		},
+		Route{
+			Name:        "ValidateStateDelta",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/state:validate",
+			HandlerFunc: r.sessionController.ValidateStateDeltaHandler,
+		},
+		Route{
+			Name:        "TransactSessions",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/transactions",
+			HandlerFunc: r.sessionController.TransactSessionsHandler,
+		},
+		Route{
+			Name:        "AcquireSessionLease",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/lease",
+			HandlerFunc: r.sessionController.AcquireSessionLeaseHandler,
+		},
+		Route{
+			Name:        "RenewSessionLease",
+			Methods:     []string{http.MethodPut},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/lease",
+			HandlerFunc: r.sessionController.RenewSessionLeaseHandler,
+		},
+		Route{
+			Name:        "ReleaseSessionLease",
+			Methods:     []string{http.MethodDelete},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/lease",
+			HandlerFunc: r.sessionController.ReleaseSessionLeaseHandler,
+		},
+		Route{
+			Name:        "TouchSession",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/touch",
+			HandlerFunc: r.sessionController.TouchSessionHandler,
+		},
+		Route{
+			Name:        "UndoSession",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/undo",
+			HandlerFunc: r.sessionController.UndoSessionHandler,
+		},
+		Route{
+			Name:        "RedoSession",
+			Methods:     []string{http.MethodPost},
+			Pattern:     "/apps/{app_name}/users/{user_id}/sessions/{session_id}/redo",
+			HandlerFunc: r.sessionController.RedoSessionHandler,
+		},
 	}
 }
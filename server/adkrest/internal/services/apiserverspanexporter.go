@@ -16,7 +16,9 @@ package services
 
 import (
 	"context"
+	"maps"
 	"strings"
+	"sync"
 
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
@@ -26,6 +28,7 @@ import (
 // This is used for debugging individual events.
 // APIServerSpanExporter implements sdktrace.SpanExporter interface.
 type APIServerSpanExporter struct {
+	mu        sync.RWMutex
 	traceDict map[string]map[string]string
 }
 
@@ -38,7 +41,18 @@ func NewAPIServerSpanExporter() *APIServerSpanExporter {
 
 // GetTraceDict returns stored trace informations
 func (s *APIServerSpanExporter) GetTraceDict() map[string]map[string]string {
-	return s.traceDict
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.traceDict)
+}
+
+// EventTrace returns the trace and span IDs of the span stored for the
+// event, or empty strings if there is none.
+func (s *APIServerSpanExporter) EventTrace(eventID string) (traceID, spanID string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	attributes := s.traceDict[eventID]
+	return attributes["trace_id"], attributes["span_id"]
 }
 
 // ExportSpans implements custom export function for sdktrace.SpanExporter.
@@ -54,7 +68,9 @@ func (s *APIServerSpanExporter) ExportSpans(ctx context.Context, spans []sdktrac
 			attributes["trace_id"] = span.SpanContext().TraceID().String()
 			attributes["span_id"] = span.SpanContext().SpanID().String()
 			if eventID, ok := attributes["gcp.vertex.agent.event_id"]; ok {
+				s.mu.Lock()
 				s.traceDict[eventID] = attributes
+				s.mu.Unlock()
 			}
 		}
 	}
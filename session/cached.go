@@ -0,0 +1,686 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// WritePolicy is how a [CachedService] writes appended events to its
+// durable service.
+type WritePolicy int
+
+const (
+	// WriteThrough appends the event to the durable service before
+	// returning, and updates the cache once it is stored.
+	WriteThrough WritePolicy = iota
+	// WriteBehind appends the event to the cache and returns; the event is
+	// appended to the durable service in the background, in the order of
+	// the session. Events changing app or user state are written through
+	// regardless, since the other sessions of the app or user read that
+	// state from the durable service.
+	WriteBehind
+)
+
+// CacheConfig contains the settings of a [CachedService]. The zero value is
+// a valid config.
+type CacheConfig struct {
+	// WritePolicy is how appended events reach the durable service.
+	// Optional: defaults to WriteThrough.
+	WritePolicy WritePolicy
+	// OnWriteBehindError is called with every event the durable service
+	// failed to append in the background. The session is reloaded from the
+	// durable service on its next read, so the event is no longer served.
+	// Optional: defaults to logging the error.
+	OnWriteBehindError func(appName, userID, sessionID string, event *Event, err error)
+}
+
+// CachedService chains a cache, holding the sessions in memory, in front
+// of a durable service. Sessions are read from the cache, and read through
+// the durable service the first time, populating the cache. Sessions are
+// created and deleted on the durable service, and appended events are
+// written through or behind according to the [WritePolicy].
+//
+// Writes made through the CachedService are never hidden by the cache: an
+// event appended with write-through is served once AppendEvent returns, a
+// change of app or user state invalidates the cached sessions of the app or
+// user, and the optional capabilities changing sessions, like
+// [TransactionService] and [UndoService], invalidate the sessions they
+// change. Writes made to the durable service by others are only seen once
+// the session is evicted with [CachedService.Invalidate].
+//
+// The CachedService implements the optional capabilities like
+// [TransactionService]; they fail with an error wrapping
+// [errors.ErrUnsupported] if the durable service lacks them.
+type CachedService struct {
+	durable Service
+	cfg     CacheConfig
+
+	mu sync.Mutex
+	// entries holds the cached sessions by encoded id.
+	entries map[string]*cachedSession
+}
+
+// cachedSession is a session of the cache.
+type cachedSession struct {
+	// mu guards the fields below, and serializes the writes of the session
+	// to the durable service, except for the ones written behind.
+	mu sync.Mutex
+	// snapshot is the session as served to readers. It is nil until the
+	// session is read from the durable service, and once it is invalidated.
+	snapshot *session
+	// durable is the session of the durable service the events are
+	// appended to. It is set whenever snapshot is.
+	durable Session
+	// queue holds the events written behind which are not appended to the
+	// durable service yet, in order.
+	queue []pendingWrite
+	// draining is set while a worker appends the queue to the durable
+	// service, and closed once the queue is empty.
+	draining chan struct{}
+}
+
+type pendingWrite struct {
+	ctx   context.Context
+	event *Event
+}
+
+// NewCachedService returns a service caching the sessions of the durable
+// service.
+func NewCachedService(durable Service, cfg CacheConfig) *CachedService {
+	if cfg.OnWriteBehindError == nil {
+		cfg.OnWriteBehindError = func(appName, userID, sessionID string, event *Event, err error) {
+			log.Printf("failed to write event %q of session %q behind: %v", event.ID, sessionID, err)
+		}
+	}
+	return &CachedService{
+		durable: durable,
+		cfg:     cfg,
+		entries: make(map[string]*cachedSession),
+	}
+}
+
+// entry returns the cache entry of the session, adding an empty one if the
+// session isn't cached.
+func (s *CachedService) entry(appName, userID, sessionID string) *cachedSession {
+	key := id{appName: appName, userID: userID, sessionID: sessionID}.Encode()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &cachedSession{}
+		s.entries[key] = e
+	}
+	return e
+}
+
+// forget removes the entry of the session if it holds nothing.
+func (s *CachedService) forget(appName, userID, sessionID string, e *cachedSession) {
+	key := id{appName: appName, userID: userID, sessionID: sessionID}.Encode()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s.entries[key] == e && e.snapshot == nil && e.draining == nil {
+		delete(s.entries, key)
+	}
+}
+
+// waitIdle waits until the events written behind are appended to the
+// durable service. The caller must hold e.mu, which is released while
+// waiting.
+func (e *cachedSession) waitIdle(ctx context.Context) error {
+	for e.draining != nil {
+		draining := e.draining
+		e.mu.Unlock()
+		select {
+		case <-draining:
+		case <-ctx.Done():
+			e.mu.Lock()
+			return fmt.Errorf("waiting for the writes of the session: %w", ctx.Err())
+		}
+		e.mu.Lock()
+	}
+	return nil
+}
+
+// load reads the session through the durable service unless it is cached.
+// If idle is set it also waits until the events written behind are
+// appended. The caller must hold e.mu.
+func (s *CachedService) load(ctx context.Context, e *cachedSession, appName, userID, sessionID string, idle bool) error {
+	for e.snapshot == nil || (idle && e.draining != nil) {
+		if e.draining != nil {
+			// The durable service misses the events written behind.
+			if err := e.waitIdle(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		resp, err := s.durable.Get(ctx, &GetRequest{AppName: appName, UserID: userID, SessionID: sessionID})
+		if err != nil {
+			return err
+		}
+		e.durable = resp.Session
+		e.snapshot = snapshotOf(resp.Session)
+	}
+	return nil
+}
+
+// invalidate evicts the session from the cache. The caller must hold e.mu.
+func (e *cachedSession) invalidate() {
+	e.snapshot = nil
+	if e.draining == nil {
+		e.durable = nil
+	}
+}
+
+// invalidateShared evicts the cached sessions of the app, or only those of
+// the user, other than the given one, after a change of the app or user
+// state. The caller must not hold the mu of any entry.
+func (s *CachedService) invalidateShared(appName, userID, sessionID string, appScope bool) {
+	s.mu.Lock()
+	var evicted []*cachedSession
+	for key, e := range s.entries {
+		var other id
+		if err := other.Decode(key); err != nil || other.appName != appName {
+			continue
+		}
+		if (!appScope && other.userID != userID) || (other.userID == userID && other.sessionID == sessionID) {
+			continue
+		}
+		evicted = append(evicted, e)
+	}
+	s.mu.Unlock()
+	for _, e := range evicted {
+		e.mu.Lock()
+		e.invalidate()
+		e.mu.Unlock()
+	}
+}
+
+// invalidateDelta calls invalidateShared if the delta changes app or user
+// state.
+func (s *CachedService) invalidateDelta(appName, userID, sessionID string, delta map[string]any) {
+	if app, user := sharedKeys(delta); app || user {
+		s.invalidateShared(appName, userID, sessionID, app)
+	}
+}
+
+// sharedKeys reports whether the delta changes app state, and whether it
+// changes user state.
+func sharedKeys(delta map[string]any) (app, user bool) {
+	for key := range delta {
+		app = app || strings.HasPrefix(key, KeyPrefixApp)
+		user = user || strings.HasPrefix(key, KeyPrefixUser)
+	}
+	return app, user
+}
+
+// snapshotOf copies the session of the durable service into a session of
+// the cache.
+func snapshotOf(sess Session) *session {
+	snapshot := &session{
+		id:        id{appName: sess.AppName(), userID: sess.UserID(), sessionID: sess.ID()},
+		state:     make(map[string]any),
+		updatedAt: sess.LastUpdateTime(),
+	}
+	for key, value := range sess.State().All() {
+		snapshot.state[key] = value
+	}
+	for event := range sess.Events().All() {
+		snapshot.events = append(snapshot.events, event)
+		snapshot.sequence = max(snapshot.sequence, event.Sequence)
+	}
+	if labeled, ok := sess.(LabeledSession); ok {
+		snapshot.labels = labeled.Labels()
+	}
+	return snapshot
+}
+
+// copyOf returns a copy of the cached session for a reader, with the
+// events selected by the request.
+func copyOf(snapshot *session, req *GetRequest) *session {
+	copied := copySessionWithoutStateAndEvents(snapshot)
+	copied.state = maps.Clone(snapshot.state)
+	copied.events = slices.Clone(filterEvents(snapshot.events, req))
+	return copied
+}
+
+// Flush waits until the events written behind are appended to the durable
+// service.
+func (s *CachedService) Flush(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		var draining []chan struct{}
+		for _, e := range s.entries {
+			e.mu.Lock()
+			if e.draining != nil {
+				draining = append(draining, e.draining)
+			}
+			e.mu.Unlock()
+		}
+		s.mu.Unlock()
+		if len(draining) == 0 {
+			return nil
+		}
+		for _, ch := range draining {
+			select {
+			case <-ch:
+			case <-ctx.Done():
+				return fmt.Errorf("flushing the session cache: %w", ctx.Err())
+			}
+		}
+	}
+}
+
+// Invalidate evicts the session from the cache, so that its next read goes
+// to the durable service. It is meant for writers of the durable service
+// other than the CachedService. Events written behind are kept.
+func (s *CachedService) Invalidate(appName, userID, sessionID string) {
+	e := s.entry(appName, userID, sessionID)
+	e.mu.Lock()
+	e.invalidate()
+	e.mu.Unlock()
+	s.forget(appName, userID, sessionID, e)
+}
+
+func (s *CachedService) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	resp, err := s.durable.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	created := resp.Session
+	e := s.entry(created.AppName(), created.UserID(), created.ID())
+	e.mu.Lock()
+	e.durable = created
+	e.snapshot = snapshotOf(created)
+	copied := copyOf(e.snapshot, &GetRequest{})
+	e.mu.Unlock()
+	s.invalidateDelta(created.AppName(), created.UserID(), created.ID(), req.State)
+	return &CreateResponse{Session: copied}, nil
+}
+
+func (s *CachedService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
+	if appName == "" || userID == "" || sessionID == "" {
+		return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
+	}
+	e := s.entry(appName, userID, sessionID)
+	e.mu.Lock()
+	if err := s.load(ctx, e, appName, userID, sessionID, false); err != nil {
+		e.mu.Unlock()
+		s.forget(appName, userID, sessionID, e)
+		return nil, err
+	}
+	copied := copyOf(e.snapshot, req)
+	e.mu.Unlock()
+	return &GetResponse{Session: copied}, nil
+}
+
+// List is served by the durable service. The update times of the sessions
+// don't account for the events not written behind yet.
+func (s *CachedService) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	return s.durable.List(ctx, req)
+}
+
+// Delete waits for the events of the session written behind, deletes the
+// session from the durable service and evicts it.
+func (s *CachedService) Delete(ctx context.Context, req *DeleteRequest) error {
+	e := s.entry(req.AppName, req.UserID, req.SessionID)
+	e.mu.Lock()
+	if err := e.waitIdle(ctx); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	err := s.durable.Delete(ctx, req)
+	e.invalidate()
+	e.mu.Unlock()
+	s.forget(req.AppName, req.UserID, req.SessionID, e)
+	return err
+}
+
+func (s *CachedService) AppendEvent(ctx context.Context, curSession Session, event *Event) error {
+	if curSession == nil {
+		return fmt.Errorf("session is nil")
+	}
+	if event == nil {
+		return fmt.Errorf("event is nil")
+	}
+	if event.Partial {
+		return nil
+	}
+	sess, ok := curSession.(*session)
+	if !ok {
+		return fmt.Errorf("unexpected session type %T", curSession)
+	}
+	appName, userID, sessionID := sess.AppName(), sess.UserID(), sess.ID()
+	app, user := sharedKeys(event.Actions.StateDelta)
+	if s.cfg.WritePolicy == WriteBehind && !app && !user {
+		return s.writeBehind(ctx, sess, event)
+	}
+
+	e := s.entry(appName, userID, sessionID)
+	e.mu.Lock()
+	if err := s.load(ctx, e, appName, userID, sessionID, true); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	stored := e.durable.Events().Len()
+	if err := s.durable.AppendEvent(ctx, e.durable, event); err != nil {
+		// The session of the durable service may be partially updated.
+		e.invalidate()
+		e.mu.Unlock()
+		return err
+	}
+	if e.durable.Events().Len() > stored {
+		// The durable service may leave replays out.
+		if err := e.snapshot.appendEvent(event); err != nil {
+			e.invalidate()
+			e.mu.Unlock()
+			return err
+		}
+		e.snapshot.sequence = max(e.snapshot.sequence, event.Sequence)
+		e.snapshot.updatedAt = e.durable.LastUpdateTime()
+		if err := sess.appendEvent(event); err != nil {
+			e.mu.Unlock()
+			return fmt.Errorf("fail to set state on appendEvent: %w", err)
+		}
+		sess.updatedAt = e.snapshot.updatedAt
+	}
+	e.mu.Unlock()
+	if app || user {
+		s.invalidateShared(appName, userID, sessionID, app)
+	}
+	return nil
+}
+
+// writeBehind appends the event to the cached session and queues it for
+// the durable service.
+func (s *CachedService) writeBehind(ctx context.Context, sess *session, event *Event) error {
+	appName, userID, sessionID := sess.AppName(), sess.UserID(), sess.ID()
+	e := s.entry(appName, userID, sessionID)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := s.load(ctx, e, appName, userID, sessionID, false); err != nil {
+		return err
+	}
+	// Directives are resolved against the cached state, the durable service
+	// misses the events still queued.
+	if HasStateDirectives(event.Actions.StateDelta) {
+		resolved, err := ResolveStateDelta(e.snapshot.state, event.Actions.StateDelta)
+		if err != nil {
+			return fmt.Errorf("failed to resolve state delta: %w", err)
+		}
+		event.Actions.StateDelta = resolved
+	}
+	if err := e.snapshot.appendEvent(event); err != nil {
+		e.invalidate()
+		return err
+	}
+	e.snapshot.sequence++
+	event.Sequence = e.snapshot.sequence
+	if err := sess.appendEvent(event); err != nil {
+		return fmt.Errorf("fail to set state on appendEvent: %w", err)
+	}
+
+	// The durable service gets its own copy, which it may update while the
+	// cached one is read.
+	durableEvent := *event
+	durableEvent.Actions.StateDelta = maps.Clone(event.Actions.StateDelta)
+	e.queue = append(e.queue, pendingWrite{ctx: context.WithoutCancel(ctx), event: &durableEvent})
+	if e.draining == nil {
+		e.draining = make(chan struct{})
+		go s.drain(e)
+	}
+	return nil
+}
+
+// drain appends the queue of the session to the durable service, until it
+// is empty.
+func (s *CachedService) drain(e *cachedSession) {
+	for {
+		e.mu.Lock()
+		if len(e.queue) == 0 {
+			close(e.draining)
+			e.draining = nil
+			if e.snapshot == nil {
+				e.durable = nil
+			}
+			e.mu.Unlock()
+			return
+		}
+		write, durable := e.queue[0], e.durable
+		e.mu.Unlock()
+
+		err := s.durable.AppendEvent(write.ctx, durable, write.event)
+
+		e.mu.Lock()
+		e.queue = e.queue[1:]
+		if err != nil {
+			e.snapshot = nil
+		}
+		e.mu.Unlock()
+		if err != nil {
+			s.cfg.OnWriteBehindError(durable.AppName(), durable.UserID(), durable.ID(), write.event, err)
+		}
+	}
+}
+
+// exclusive runs fn, changing the given sessions on the durable service,
+// once their events written behind are appended. The sessions are evicted,
+// and no event is appended to them while fn runs.
+func (s *CachedService) exclusive(ctx context.Context, ids []id, fn func() error) error {
+	slices.SortFunc(ids, func(a, b id) int { return strings.Compare(a.Encode(), b.Encode()) })
+	ids = slices.CompactFunc(ids, func(a, b id) bool { return a == b })
+	entries := make([]*cachedSession, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, s.entry(id.appName, id.userID, id.sessionID))
+	}
+	// The entries are locked in order, so that concurrent calls don't
+	// deadlock.
+	var locked []*cachedSession
+	defer func() {
+		for _, e := range locked {
+			e.invalidate()
+			e.mu.Unlock()
+		}
+	}()
+	for _, e := range entries {
+		e.mu.Lock()
+		locked = append(locked, e)
+		if err := e.waitIdle(ctx); err != nil {
+			return err
+		}
+	}
+	return fn()
+}
+
+// Transact implements [TransactionService].
+func (s *CachedService) Transact(ctx context.Context, req *TransactRequest) (*TransactResponse, error) {
+	txService, ok := s.durable.(TransactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support transactions: %w", s.durable, errors.ErrUnsupported)
+	}
+	ids := make([]id, 0, len(req.Ops))
+	for _, op := range req.Ops {
+		ids = append(ids, id{appName: op.AppName, userID: op.UserID, sessionID: op.SessionID})
+	}
+	var resp *TransactResponse
+	err := s.exclusive(ctx, ids, func() (err error) {
+		resp, err = txService.Transact(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range req.Ops {
+		if op.Event != nil {
+			s.invalidateDelta(op.AppName, op.UserID, op.SessionID, op.Event.Actions.StateDelta)
+		}
+	}
+	return resp, nil
+}
+
+// AppStats implements [StatsService]. The statistics don't account for the
+// events not written behind yet.
+func (s *CachedService) AppStats(ctx context.Context) (map[string]AppStats, error) {
+	statsService, ok := s.durable.(StatsService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not provide statistics: %w", s.durable, errors.ErrUnsupported)
+	}
+	return statsService.AppStats(ctx)
+}
+
+// Compact implements [CompactionService].
+func (s *CachedService) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	compactionService, ok := s.durable.(CompactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support compaction: %w", s.durable, errors.ErrUnsupported)
+	}
+	var resp *CompactResponse
+	err := s.exclusive(ctx, []id{{appName: req.AppName, userID: req.UserID, sessionID: req.SessionID}}, func() (err error) {
+		resp, err = compactionService.Compact(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateDelta(req.AppName, req.UserID, req.SessionID, map[string]any{req.SummaryKey: nil})
+	return resp, nil
+}
+
+// WatchUser implements [WatchService]. Events written behind are watched
+// once they are appended to the durable service.
+func (s *CachedService) WatchUser(ctx context.Context, req *WatchUserRequest) (*Subscription, error) {
+	watchService, ok := s.durable.(WatchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support watching: %w", s.durable, errors.ErrUnsupported)
+	}
+	return watchService.WatchUser(ctx, req)
+}
+
+// AcquireLease implements [LeaseService].
+func (s *CachedService) AcquireLease(ctx context.Context, req *AcquireLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.durable.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.durable, errors.ErrUnsupported)
+	}
+	return leaseService.AcquireLease(ctx, req)
+}
+
+// RenewLease implements [LeaseService].
+func (s *CachedService) RenewLease(ctx context.Context, req *RenewLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.durable.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.durable, errors.ErrUnsupported)
+	}
+	return leaseService.RenewLease(ctx, req)
+}
+
+// ReleaseLease implements [LeaseService].
+func (s *CachedService) ReleaseLease(ctx context.Context, req *ReleaseLeaseRequest) error {
+	leaseService, ok := s.durable.(LeaseService)
+	if !ok {
+		return fmt.Errorf("%T does not support leases: %w", s.durable, errors.ErrUnsupported)
+	}
+	return leaseService.ReleaseLease(ctx, req)
+}
+
+// Undo implements [UndoService].
+func (s *CachedService) Undo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	return s.undoOrRedo(ctx, req, UndoService.Undo)
+}
+
+// Redo implements [UndoService].
+func (s *CachedService) Redo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	return s.undoOrRedo(ctx, req, UndoService.Redo)
+}
+
+func (s *CachedService) undoOrRedo(ctx context.Context, req *UndoRequest, fn func(UndoService, context.Context, *UndoRequest) (*UndoResponse, error)) (*UndoResponse, error) {
+	undoService, ok := s.durable.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.durable, errors.ErrUnsupported)
+	}
+	var resp *UndoResponse
+	err := s.exclusive(ctx, []id{{appName: req.AppName, userID: req.UserID, sessionID: req.SessionID}}, func() (err error) {
+		resp, err = fn(undoService, ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Event != nil {
+		s.invalidateDelta(req.AppName, req.UserID, req.SessionID, resp.Event.Actions.StateDelta)
+	}
+	return resp, nil
+}
+
+// Touch implements [TouchService]. Touching a session changes nothing
+// served from the cache, it isn't evicted.
+func (s *CachedService) Touch(ctx context.Context, req *TouchRequest) (*TouchResponse, error) {
+	touchService, ok := s.durable.(TouchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support touching sessions: %w", s.durable, errors.ErrUnsupported)
+	}
+	return touchService.Touch(ctx, req)
+}
+
+// SetLabels implements [LabelService].
+func (s *CachedService) SetLabels(ctx context.Context, req *SetLabelsRequest) (*SetLabelsResponse, error) {
+	labelService, ok := s.durable.(LabelService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support labels: %w", s.durable, errors.ErrUnsupported)
+	}
+	var resp *SetLabelsResponse
+	err := s.exclusive(ctx, []id{{appName: req.AppName, userID: req.UserID, sessionID: req.SessionID}}, func() (err error) {
+		resp, err = labelService.SetLabels(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// PinEvent implements [PinService].
+func (s *CachedService) PinEvent(ctx context.Context, req *PinEventRequest) (*PinEventResponse, error) {
+	pinService, ok := s.durable.(PinService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support pinning events: %w", s.durable, errors.ErrUnsupported)
+	}
+	var resp *PinEventResponse
+	err := s.exclusive(ctx, []id{{appName: req.AppName, userID: req.UserID, sessionID: req.SessionID}}, func() (err error) {
+		resp, err = pinService.PinEvent(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+var (
+	_ Service            = (*CachedService)(nil)
+	_ TransactionService = (*CachedService)(nil)
+	_ StatsService       = (*CachedService)(nil)
+	_ CompactionService  = (*CachedService)(nil)
+	_ WatchService       = (*CachedService)(nil)
+	_ LeaseService       = (*CachedService)(nil)
+	_ UndoService        = (*CachedService)(nil)
+	_ TouchService       = (*CachedService)(nil)
+	_ LabelService       = (*CachedService)(nil)
+	_ PinService         = (*CachedService)(nil)
+)
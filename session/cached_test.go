@@ -0,0 +1,305 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// recordingService is a Service counting its reads, whose appends can be
+// held back or failed.
+type recordingService struct {
+	Service
+
+	mu   sync.Mutex
+	gets int
+	// hold, if set, blocks the appends until it is closed.
+	hold chan struct{}
+	// fail, if set, is returned by the appends.
+	fail error
+}
+
+func (s *recordingService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	s.mu.Lock()
+	s.gets++
+	s.mu.Unlock()
+	return s.Service.Get(ctx, req)
+}
+
+func (s *recordingService) AppendEvent(ctx context.Context, curSession Session, event *Event) error {
+	s.mu.Lock()
+	hold, fail := s.hold, s.fail
+	s.mu.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	if fail != nil {
+		return fail
+	}
+	return s.Service.AppendEvent(ctx, curSession, event)
+}
+
+func (s *recordingService) Transact(ctx context.Context, req *TransactRequest) (*TransactResponse, error) {
+	return s.Service.(TransactionService).Transact(ctx, req)
+}
+
+func (s *recordingService) getCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets
+}
+
+func newTestCache(t *testing.T, cfg CacheConfig) (*CachedService, *recordingService) {
+	t.Helper()
+	durable := &recordingService{Service: InMemoryService()}
+	return NewCachedService(durable, cfg), durable
+}
+
+func getState(t *testing.T, s Service, sessionID, key string) any {
+	t.Helper()
+	resp, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", sessionID, err)
+	}
+	value, err := resp.Session.State().Get(key)
+	if err != nil && !errors.Is(err, ErrStateKeyNotExist) {
+		t.Fatalf("State().Get(%q) error = %v", key, err)
+	}
+	return value
+}
+
+func eventIDs(t *testing.T, s Service, sessionID string) []string {
+	t.Helper()
+	resp, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", sessionID, err)
+	}
+	var ids []string
+	for event := range resp.Session.Events().All() {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+// cachedEvent returns a [stateEvent] with the given ID.
+func cachedEvent(id string, delta map[string]any) *Event {
+	event := stateEvent(delta)
+	event.ID = id
+	return event
+}
+
+func TestCachedService_ReadThrough(t *testing.T) {
+	ctx := t.Context()
+	cache, durable := newTestCache(t, CacheConfig{})
+	created, err := durable.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1", State: map[string]any{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"e1", "e2"} {
+		if err := durable.AppendEvent(ctx, created.Session, cachedEvent(id, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 3 {
+		if got := getState(t, cache, "s1", "k"); got != "v" {
+			t.Errorf("state k = %v, want %q", got, "v")
+		}
+	}
+	if got := durable.getCount(); got != 1 {
+		t.Errorf("durable reads = %d, want 1: the first read populates the cache", got)
+	}
+
+	resp, err := cache.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "s1", NumRecentEvents: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Session.Events().Len(); got != 1 || resp.Session.Events().At(0).ID != "e2" {
+		t.Errorf("Get(NumRecentEvents: 1) returned %d events, want e2", got)
+	}
+	if got := durable.getCount(); got != 1 {
+		t.Errorf("durable reads = %d, want 1: filtered reads are served from the cache", got)
+	}
+
+	if _, err := cache.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "missing"}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get(missing) error = %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestCachedService_WriteThrough(t *testing.T) {
+	ctx := t.Context()
+	cache, durable := newTestCache(t, CacheConfig{})
+	created, err := cache.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.AppendEvent(ctx, created.Session, cachedEvent("e1", map[string]any{"k": 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	// Written to the durable service before AppendEvent returns.
+	if got := getState(t, durable.Service, "s1", "k"); got != 1 {
+		t.Errorf("durable state k = %v, want 1", got)
+	}
+	// The cache serves the write without reading the durable service.
+	reads := durable.getCount()
+	if got := getState(t, cache, "s1", "k"); got != 1 {
+		t.Errorf("cached state k = %v, want 1", got)
+	}
+	if got := created.Session.Events().Len(); got != 1 {
+		t.Errorf("appended session has %d events, want 1", got)
+	}
+	if got := durable.getCount(); got != reads {
+		t.Errorf("durable reads = %d, want %d", got, reads)
+	}
+
+	// A failed write isn't served.
+	durable.fail = errors.New("storage down")
+	if err := cache.AppendEvent(ctx, created.Session, cachedEvent("e2", map[string]any{"k": 2})); err == nil {
+		t.Fatal("AppendEvent() succeeded with a failing durable service")
+	}
+	durable.fail = nil
+	if got, want := eventIDs(t, cache, "s1"), []string{"e1"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("cached events = %v, want %v", got, want)
+	}
+}
+
+func TestCachedService_WriteBehind(t *testing.T) {
+	ctx := t.Context()
+	cache, durable := newTestCache(t, CacheConfig{WritePolicy: WriteBehind})
+	created, err := cache.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hold := make(chan struct{})
+	durable.hold = hold
+	for i, id := range []string{"e1", "e2"} {
+		if err := cache.AppendEvent(ctx, created.Session, cachedEvent(id, map[string]any{"k": i})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := getState(t, cache, "s1", "k"); got != 1 {
+		t.Errorf("cached state k = %v, want 1 before the durable write", got)
+	}
+	if got := eventIDs(t, durable.Service, "s1"); len(got) != 0 {
+		t.Errorf("durable events = %v, want none before the durable write", got)
+	}
+
+	durable.mu.Lock()
+	durable.hold = nil
+	durable.mu.Unlock()
+	close(hold)
+	if err := cache.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := durable.Service.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for event := range resp.Session.Events().All() {
+		got = append(got, event.ID)
+		if want := int64(len(got)); event.Sequence != want {
+			t.Errorf("durable event %s has sequence %d, want %d", event.ID, event.Sequence, want)
+		}
+	}
+	if len(got) != 2 || got[0] != "e1" || got[1] != "e2" {
+		t.Errorf("durable events = %v, want [e1 e2] in order", got)
+	}
+}
+
+func TestCachedService_WriteBehindError(t *testing.T) {
+	ctx := t.Context()
+	var failed []string
+	cache, durable := newTestCache(t, CacheConfig{
+		WritePolicy: WriteBehind,
+		OnWriteBehindError: func(appName, userID, sessionID string, event *Event, err error) {
+			failed = append(failed, event.ID)
+		},
+	})
+	created, err := cache.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	durable.fail = errors.New("storage down")
+	if err := cache.AppendEvent(ctx, created.Session, cachedEvent("e1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	durable.fail = nil
+
+	if len(failed) != 1 || failed[0] != "e1" {
+		t.Errorf("OnWriteBehindError called with %v, want [e1]", failed)
+	}
+	if got := eventIDs(t, cache, "s1"); len(got) != 0 {
+		t.Errorf("cached events = %v, want the failed write not to be served", got)
+	}
+}
+
+func TestCachedService_SharedStateNotStale(t *testing.T) {
+	for _, policy := range []WritePolicy{WriteThrough, WriteBehind} {
+		ctx := t.Context()
+		cache, _ := newTestCache(t, CacheConfig{WritePolicy: policy})
+		s1, err := cache.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cache.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s2", State: map[string]any{"user:k": "old"}}); err != nil {
+			t.Fatal(err)
+		}
+		// Both sessions are cached, s1 still with the old user state.
+		if got := getState(t, cache, "s1", "user:k"); got != "old" {
+			t.Fatalf("policy %d: s1 user:k = %v, want %q", policy, got, "old")
+		}
+
+		if err := cache.AppendEvent(ctx, s1.Session, cachedEvent("e1", map[string]any{"user:k": "new"})); err != nil {
+			t.Fatal(err)
+		}
+		if got := getState(t, cache, "s2", "user:k"); got != "new" {
+			t.Errorf("policy %d: s2 user:k = %v after the write of s1, want %q", policy, got, "new")
+		}
+	}
+}
+
+func TestCachedService_TransactNotStale(t *testing.T) {
+	ctx := t.Context()
+	cache, _ := newTestCache(t, CacheConfig{WritePolicy: WriteBehind})
+	created, err := cache.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.AppendEvent(ctx, created.Session, cachedEvent("e1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cache.Transact(ctx, &TransactRequest{Ops: []TransactOp{
+		{AppName: "app", UserID: "user", SessionID: "s1", Event: cachedEvent("e2", map[string]any{"k": "v"})},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := eventIDs(t, cache, "s1"), []string{"e1", "e2"}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("cached events = %v, want %v", got, want)
+	}
+	if got := getState(t, cache, "s1", "k"); got != "v" {
+		t.Errorf("cached state k = %v, want %q", got, "v")
+	}
+}
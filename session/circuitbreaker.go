@@ -0,0 +1,385 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrServiceUnavailable is returned, wrapped in a [*CircuitOpenError], by a
+// service wrapped with [ServiceWithCircuitBreaker] while its circuit is
+// open.
+var ErrServiceUnavailable = errors.New("session service unavailable")
+
+// CircuitOpenError is returned when a call is rejected by an open circuit
+// breaker without reaching the wrapped service.
+type CircuitOpenError struct {
+	// RetryAfter is the time left until the breaker lets a call probe the
+	// wrapped service again.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", ErrServiceUnavailable, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrServiceUnavailable
+}
+
+// CircuitBreakerConfig contains the settings of [ServiceWithCircuitBreaker].
+// The zero value is a valid config.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures which opens
+	// the circuit.
+	// Optional: defaults to 5.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a single call is
+	// let through to probe whether the service recovered.
+	// Optional: defaults to 30 seconds.
+	Cooldown time.Duration
+	// IsFailure reports whether an error returned by the wrapped service
+	// counts as a failure of the service.
+	// Optional: by default every error counts, except context cancellation
+	// and the errors of this package caused by the request itself, like
+	// [ErrSessionNotFound]. Services reporting missing sessions with errors
+	// of their own should set it so lookups of missing sessions don't open
+	// the circuit.
+	IsFailure func(error) bool
+	// ServeStaleReads makes Get and List return the last successful
+	// response to the same request while the circuit is open, instead of
+	// failing. Responses are kept in memory for every distinct request.
+	ServeStaleReads bool
+}
+
+// ServiceWithCircuitBreaker wraps the service with a circuit breaker.
+//
+// After FailureThreshold consecutive failures the circuit opens and calls
+// fail fast with a [*CircuitOpenError] until the cooldown elapses. The next
+// call then probes the service: the circuit closes if it succeeds and opens
+// again otherwise.
+//
+// The returned service implements the optional capabilities like
+// [TransactionService]; they fail with an error wrapping
+// [errors.ErrUnsupported] if the wrapped service lacks them.
+func ServiceWithCircuitBreaker(service Service, cfg CircuitBreakerConfig) Service {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = isServiceFailure
+	}
+	return &circuitBreakerService{
+		service:    service,
+		cfg:        cfg,
+		now:        time.Now,
+		staleGets:  make(map[GetRequest]*GetResponse),
+		staleLists: make(map[staleListKey]*ListResponse),
+	}
+}
+
+// isServiceFailure is the default [CircuitBreakerConfig.IsFailure].
+func isServiceFailure(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, ErrStateDirectiveFailed),
+		errors.Is(err, ErrEventContentTooLarge),
+		errors.Is(err, ErrSessionFull),
+		errors.Is(err, ErrUserEventsExceeded),
+		errors.Is(err, ErrStateKeysExceeded),
+		errors.Is(err, ErrEventRejected),
+		errors.Is(err, ErrIngestionRateExceeded),
+		errors.Is(err, ErrCreationRateExceeded),
+		errors.Is(err, ErrStateKeyNotExist),
+		errors.Is(err, ErrLeaseHeld),
+		errors.Is(err, ErrLeaseNotHeld),
+		errors.Is(err, ErrNothingToUndo),
+		errors.Is(err, ErrNothingToRedo),
+		errors.Is(err, ErrEventNotFound),
+		errors.Is(err, ErrServiceOverloaded),
+		errors.Is(err, ErrSessionNotFound),
+		errors.Is(err, ErrTooManySessions),
+		errors.Is(err, ErrSystemStateWrite),
+		errors.Is(err, errors.ErrUnsupported):
+		return false
+	default:
+		return true
+	}
+}
+
+type circuitBreakerService struct {
+	service Service
+	cfg     CircuitBreakerConfig
+	now     func() time.Time
+
+	mu sync.Mutex
+	// failures is the number of consecutive failures.
+	failures int
+	// openUntil is the end of the cooldown while the circuit is open.
+	openUntil time.Time
+	// probing is set while a call probes the service of a half-open
+	// circuit, other calls keep failing fast meanwhile.
+	probing bool
+
+	staleGets  map[GetRequest]*GetResponse
+	staleLists map[staleListKey]*ListResponse
+}
+
+// staleListKey identifies the stale response of a [ListRequest], which
+// isn't comparable because of its labels.
+type staleListKey struct {
+	appName, userID string
+	// labels is the JSON encoding of the label selector, whose keys are
+	// sorted, or empty for an empty selector.
+	labels string
+}
+
+func staleListKeyOf(req *ListRequest) staleListKey {
+	key := staleListKey{appName: req.AppName, userID: req.UserID}
+	if len(req.Labels) > 0 {
+		// Encoding errors are impossible for a map of strings.
+		encoded, _ := json.Marshal(req.Labels)
+		key.labels = string(encoded)
+	}
+	return key
+}
+
+// acquire reports whether a call may reach the wrapped service. It returns
+// a [*CircuitOpenError] otherwise.
+func (s *circuitBreakerService) acquire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures < s.cfg.FailureThreshold {
+		return nil
+	}
+	if left := s.openUntil.Sub(s.now()); left > 0 || s.probing {
+		return &CircuitOpenError{RetryAfter: max(left, 0)}
+	}
+	s.probing = true
+	return nil
+}
+
+// release records the outcome of a call which reached the wrapped service.
+func (s *circuitBreakerService) release(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.probing = false
+	if err == nil || !s.cfg.IsFailure(err) {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures >= s.cfg.FailureThreshold {
+		s.openUntil = s.now().Add(s.cfg.Cooldown)
+	}
+}
+
+// call runs fn through the circuit breaker.
+func call[T any](s *circuitBreakerService, fn func() (T, error)) (T, error) {
+	if err := s.acquire(); err != nil {
+		var zero T
+		return zero, err
+	}
+	resp, err := fn()
+	s.release(err)
+	return resp, err
+}
+
+func (s *circuitBreakerService) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	return call(s, func() (*CreateResponse, error) { return s.service.Create(ctx, req) })
+}
+
+func (s *circuitBreakerService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	resp, err := call(s, func() (*GetResponse, error) { return s.service.Get(ctx, req) })
+	if !s.cfg.ServeStaleReads {
+		return resp, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.staleGets[*req] = resp
+	} else if stale, ok := s.staleGets[*req]; ok && errors.Is(err, ErrServiceUnavailable) {
+		return stale, nil
+	}
+	return resp, err
+}
+
+func (s *circuitBreakerService) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	resp, err := call(s, func() (*ListResponse, error) { return s.service.List(ctx, req) })
+	if !s.cfg.ServeStaleReads {
+		return resp, err
+	}
+	key := staleListKeyOf(req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.staleLists[key] = resp
+	} else if stale, ok := s.staleLists[key]; ok && errors.Is(err, ErrServiceUnavailable) {
+		return stale, nil
+	}
+	return resp, err
+}
+
+func (s *circuitBreakerService) Delete(ctx context.Context, req *DeleteRequest) error {
+	_, err := call(s, func() (struct{}, error) { return struct{}{}, s.service.Delete(ctx, req) })
+	if err == nil && s.cfg.ServeStaleReads {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for staleReq := range s.staleGets {
+			if staleReq.AppName == req.AppName && staleReq.UserID == req.UserID && staleReq.SessionID == req.SessionID {
+				delete(s.staleGets, staleReq)
+			}
+		}
+	}
+	return err
+}
+
+func (s *circuitBreakerService) AppendEvent(ctx context.Context, curSession Session, event *Event) error {
+	_, err := call(s, func() (struct{}, error) { return struct{}{}, s.service.AppendEvent(ctx, curSession, event) })
+	return err
+}
+
+// Transact implements [TransactionService].
+func (s *circuitBreakerService) Transact(ctx context.Context, req *TransactRequest) (*TransactResponse, error) {
+	txService, ok := s.service.(TransactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support transactions: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*TransactResponse, error) { return txService.Transact(ctx, req) })
+}
+
+// AppStats implements [StatsService].
+func (s *circuitBreakerService) AppStats(ctx context.Context) (map[string]AppStats, error) {
+	statsService, ok := s.service.(StatsService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not provide statistics: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (map[string]AppStats, error) { return statsService.AppStats(ctx) })
+}
+
+// Compact implements [CompactionService].
+func (s *circuitBreakerService) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	compactionService, ok := s.service.(CompactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support compaction: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*CompactResponse, error) { return compactionService.Compact(ctx, req) })
+}
+
+// WatchUser implements [WatchService]. Only starting the subscription goes
+// through the breaker.
+func (s *circuitBreakerService) WatchUser(ctx context.Context, req *WatchUserRequest) (*Subscription, error) {
+	watchService, ok := s.service.(WatchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support watching: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*Subscription, error) { return watchService.WatchUser(ctx, req) })
+}
+
+// AcquireLease implements [LeaseService].
+func (s *circuitBreakerService) AcquireLease(ctx context.Context, req *AcquireLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*Lease, error) { return leaseService.AcquireLease(ctx, req) })
+}
+
+// RenewLease implements [LeaseService].
+func (s *circuitBreakerService) RenewLease(ctx context.Context, req *RenewLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*Lease, error) { return leaseService.RenewLease(ctx, req) })
+}
+
+// ReleaseLease implements [LeaseService].
+func (s *circuitBreakerService) ReleaseLease(ctx context.Context, req *ReleaseLeaseRequest) error {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	_, err := call(s, func() (struct{}, error) { return struct{}{}, leaseService.ReleaseLease(ctx, req) })
+	return err
+}
+
+// Undo implements [UndoService].
+func (s *circuitBreakerService) Undo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*UndoResponse, error) { return undoService.Undo(ctx, req) })
+}
+
+// Redo implements [UndoService].
+func (s *circuitBreakerService) Redo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*UndoResponse, error) { return undoService.Redo(ctx, req) })
+}
+
+// Touch implements [TouchService].
+func (s *circuitBreakerService) Touch(ctx context.Context, req *TouchRequest) (*TouchResponse, error) {
+	touchService, ok := s.service.(TouchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support touching sessions: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*TouchResponse, error) { return touchService.Touch(ctx, req) })
+}
+
+// SetLabels implements [LabelService].
+func (s *circuitBreakerService) SetLabels(ctx context.Context, req *SetLabelsRequest) (*SetLabelsResponse, error) {
+	labelService, ok := s.service.(LabelService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support labels: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*SetLabelsResponse, error) { return labelService.SetLabels(ctx, req) })
+}
+
+// PinEvent implements [PinService].
+func (s *circuitBreakerService) PinEvent(ctx context.Context, req *PinEventRequest) (*PinEventResponse, error) {
+	pinService, ok := s.service.(PinService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support pinning events: %w", s.service, errors.ErrUnsupported)
+	}
+	return call(s, func() (*PinEventResponse, error) { return pinService.PinEvent(ctx, req) })
+}
+
+var (
+	_ Service            = (*circuitBreakerService)(nil)
+	_ TransactionService = (*circuitBreakerService)(nil)
+	_ StatsService       = (*circuitBreakerService)(nil)
+	_ CompactionService  = (*circuitBreakerService)(nil)
+	_ WatchService       = (*circuitBreakerService)(nil)
+	_ LeaseService       = (*circuitBreakerService)(nil)
+	_ UndoService        = (*circuitBreakerService)(nil)
+	_ TouchService       = (*circuitBreakerService)(nil)
+	_ LabelService       = (*circuitBreakerService)(nil)
+	_ PinService         = (*circuitBreakerService)(nil)
+)
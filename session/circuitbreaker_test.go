@@ -0,0 +1,224 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// flakyService is a Service whose calls fail while down is set.
+type flakyService struct {
+	Service
+	down  bool
+	calls int
+}
+
+var errDown = errors.New("database is down")
+
+func (s *flakyService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	s.calls++
+	if s.down {
+		return nil, errDown
+	}
+	return s.Service.Get(ctx, req)
+}
+
+func newTestBreaker(t *testing.T, cfg CircuitBreakerConfig) (*circuitBreakerService, *flakyService, *time.Time) {
+	t.Helper()
+	inner := &flakyService{Service: InMemoryService()}
+	if _, err := inner.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := ServiceWithCircuitBreaker(inner, cfg).(*circuitBreakerService)
+	breaker.now = func() time.Time { return now }
+	return breaker, inner, &now
+}
+
+var testGetRequest = &GetRequest{AppName: "app", UserID: "user", SessionID: "session"}
+
+func TestCircuitBreaker_Trips(t *testing.T) {
+	breaker, inner, _ := newTestBreaker(t, CircuitBreakerConfig{FailureThreshold: 3, Cooldown: 10 * time.Second})
+	inner.down = true
+
+	for range 3 {
+		if _, err := breaker.Get(t.Context(), testGetRequest); !errors.Is(err, errDown) {
+			t.Fatalf("Get() error = %v, want %v", err, errDown)
+		}
+	}
+	_, err := breaker.Get(t.Context(), testGetRequest)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("Get() error = %v, want CircuitOpenError", err)
+	}
+	if openErr.RetryAfter != 10*time.Second {
+		t.Errorf("RetryAfter = %v, want %v", openErr.RetryAfter, 10*time.Second)
+	}
+	if inner.calls != 3 {
+		t.Errorf("wrapped service got %d calls, want 3", inner.calls)
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	breaker, inner, _ := newTestBreaker(t, CircuitBreakerConfig{FailureThreshold: 2})
+
+	for range 3 {
+		inner.down = true
+		if _, err := breaker.Get(t.Context(), testGetRequest); !errors.Is(err, errDown) {
+			t.Fatalf("Get() error = %v, want %v", err, errDown)
+		}
+		inner.down = false
+		if _, err := breaker.Get(t.Context(), testGetRequest); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	tests := []struct {
+		name          string
+		recovered     bool
+		wantProbeErr  error
+		wantNextError error
+	}{
+		{
+			name:          "successful probe closes the circuit",
+			recovered:     true,
+			wantProbeErr:  nil,
+			wantNextError: nil,
+		},
+		{
+			name:          "failed probe opens the circuit again",
+			recovered:     false,
+			wantProbeErr:  errDown,
+			wantNextError: ErrServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker, inner, now := newTestBreaker(t, CircuitBreakerConfig{FailureThreshold: 1, Cooldown: 10 * time.Second})
+			inner.down = true
+			_, _ = breaker.Get(t.Context(), testGetRequest)
+
+			*now = now.Add(5 * time.Second)
+			if _, err := breaker.Get(t.Context(), testGetRequest); !errors.Is(err, ErrServiceUnavailable) {
+				t.Fatalf("Get() during cooldown error = %v, want ErrServiceUnavailable", err)
+			}
+
+			*now = now.Add(5 * time.Second)
+			inner.down = !tt.recovered
+			if _, err := breaker.Get(t.Context(), testGetRequest); !errors.Is(err, tt.wantProbeErr) {
+				t.Fatalf("probe Get() error = %v, want %v", err, tt.wantProbeErr)
+			}
+			if _, err := breaker.Get(t.Context(), testGetRequest); !errors.Is(err, tt.wantNextError) {
+				t.Fatalf("Get() after probe error = %v, want %v", err, tt.wantNextError)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_OneProbeAtATime(t *testing.T) {
+	breaker, inner, now := newTestBreaker(t, CircuitBreakerConfig{FailureThreshold: 1, Cooldown: time.Second})
+	inner.down = true
+	_, _ = breaker.Get(t.Context(), testGetRequest)
+	*now = now.Add(time.Second)
+
+	if err := breaker.acquire(); err != nil {
+		t.Fatalf("acquire() of the probe error = %v", err)
+	}
+	if err := breaker.acquire(); !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("acquire() during the probe error = %v, want ErrServiceUnavailable", err)
+	}
+	breaker.release(nil)
+	if err := breaker.acquire(); err != nil {
+		t.Errorf("acquire() after the probe error = %v", err)
+	}
+}
+
+func TestCircuitBreaker_ServeStaleReads(t *testing.T) {
+	breaker, inner, _ := newTestBreaker(t, CircuitBreakerConfig{FailureThreshold: 1, ServeStaleReads: true})
+	fresh, err := breaker.Get(t.Context(), testGetRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner.down = true
+	if _, err := breaker.Get(t.Context(), testGetRequest); !errors.Is(err, errDown) {
+		t.Fatalf("Get() error = %v, want %v", err, errDown)
+	}
+	stale, err := breaker.Get(t.Context(), testGetRequest)
+	if err != nil {
+		t.Fatalf("Get() with open circuit error = %v, want the stale response", err)
+	}
+	if stale != fresh {
+		t.Errorf("Get() with open circuit = %v, want the last successful response %v", stale, fresh)
+	}
+	other := &GetRequest{AppName: "app", UserID: "user", SessionID: "other"}
+	if _, err := breaker.Get(t.Context(), other); !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("Get() of uncached request error = %v, want ErrServiceUnavailable", err)
+	}
+}
+
+func TestCircuitBreaker_IgnoresRequestErrors(t *testing.T) {
+	breaker, _, _ := newTestBreaker(t, CircuitBreakerConfig{FailureThreshold: 1})
+	resp, err := breaker.Get(t.Context(), testGetRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		err := breaker.AppendEvent(t.Context(), resp.Session, stateEvent(map[string]any{"backup": CopyKey{From: "missing"}}))
+		if !errors.Is(err, ErrStateDirectiveFailed) {
+			t.Fatalf("AppendEvent() error = %v, want ErrStateDirectiveFailed", err)
+		}
+	}
+	if _, err := breaker.Get(t.Context(), testGetRequest); err != nil {
+		t.Errorf("Get() error = %v, want the circuit to stay closed", err)
+	}
+}
+
+func TestCircuitBreaker_IgnoresMissingSessions(t *testing.T) {
+	breaker := ServiceWithCircuitBreaker(InMemoryService(), CircuitBreakerConfig{FailureThreshold: 2})
+	missing := &GetRequest{AppName: "app", UserID: "user", SessionID: "missing"}
+	for range 3 {
+		if _, err := breaker.Get(t.Context(), missing); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("Get() error = %v, want ErrSessionNotFound", err)
+		}
+	}
+	if _, err := breaker.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "missing"}); err != nil {
+		t.Errorf("Create() error = %v, want the circuit to stay closed", err)
+	}
+}
+
+func TestIsServiceFailure(t *testing.T) {
+	for _, err := range []error{ErrSessionNotFound, ErrTooManySessions, ErrSystemStateWrite} {
+		if isServiceFailure(fmt.Errorf("wrapped: %w", err)) {
+			t.Errorf("isServiceFailure(%v) = true, want false", err)
+		}
+	}
+	if !isServiceFailure(errors.New("connection refused")) {
+		t.Error("isServiceFailure(connection refused) = false, want true")
+	}
+}
+
+func TestCircuitBreaker_UnsupportedCapability(t *testing.T) {
+	breaker := ServiceWithCircuitBreaker(&flakyService{}, CircuitBreakerConfig{})
+	if _, err := breaker.(TransactionService).Transact(t.Context(), &TransactRequest{}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Transact() error = %v, want errors.ErrUnsupported", err)
+	}
+}
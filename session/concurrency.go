@@ -0,0 +1,271 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrServiceOverloaded is returned, wrapped, by a service wrapped with
+// [ServiceWithConcurrencyLimit] when a mutation is shed because too many
+// are running and queued. The mutation doesn't reach the wrapped service,
+// clients are expected to retry later.
+var ErrServiceOverloaded = errors.New("session service overloaded")
+
+// ConcurrencyLimitConfig contains the settings of
+// [ServiceWithConcurrencyLimit]. The zero value is a valid config.
+type ConcurrencyLimitConfig struct {
+	// MaxConcurrent is the number of mutations executed at once.
+	// Optional: defaults to 16.
+	MaxConcurrent int
+	// MaxQueued is the number of mutations waiting for one of the running
+	// ones to finish. Mutations past it are shed.
+	// Optional: if zero, mutations are shed as soon as MaxConcurrent are
+	// running.
+	MaxQueued int
+	// MaxWait bounds the time a mutation is queued, it is shed once it
+	// waited that long.
+	// Optional: if zero, a mutation waits as long as its context allows.
+	MaxWait time.Duration
+}
+
+// ServiceWithConcurrencyLimit wraps the service so that at most
+// MaxConcurrent mutations, like creating sessions and appending events,
+// reach it at once. Further mutations are queued, up to MaxQueued, and the
+// ones past the queue fail with an error wrapping [ErrServiceOverloaded].
+// Reads are not limited.
+//
+// The returned service implements the optional capabilities like
+// [TransactionService]; they fail with an error wrapping
+// [errors.ErrUnsupported] if the wrapped service lacks them.
+func ServiceWithConcurrencyLimit(service Service, cfg ConcurrencyLimitConfig) Service {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 16
+	}
+	cfg.MaxQueued = max(cfg.MaxQueued, 0)
+	return &concurrencyLimitedService{
+		service: service,
+		cfg:     cfg,
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+	}
+}
+
+type concurrencyLimitedService struct {
+	service Service
+	cfg     ConcurrencyLimitConfig
+	// slots holds a value for every running mutation.
+	slots chan struct{}
+
+	mu sync.Mutex
+	// queued is the number of mutations waiting for a slot.
+	queued int
+}
+
+// acquire returns nil once a mutation may reach the wrapped service, and
+// an error if it is shed or its context is done while queued.
+func (s *concurrencyLimitedService) acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	s.mu.Lock()
+	if s.queued >= s.cfg.MaxQueued {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %d mutations running and %d queued", ErrServiceOverloaded, s.cfg.MaxConcurrent, s.cfg.MaxQueued)
+	}
+	s.queued++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.queued--
+		s.mu.Unlock()
+	}()
+
+	waitCtx := ctx
+	if s.cfg.MaxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, s.cfg.MaxWait)
+		defer cancel()
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for a session service slot: %w", ctx.Err())
+		}
+		return fmt.Errorf("%w: queued for %v", ErrServiceOverloaded, s.cfg.MaxWait)
+	}
+}
+
+// limit runs the mutation fn once it may reach the wrapped service.
+func limit[T any](ctx context.Context, s *concurrencyLimitedService, fn func() (T, error)) (T, error) {
+	if err := s.acquire(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+	defer func() { <-s.slots }()
+	return fn()
+}
+
+func (s *concurrencyLimitedService) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	return limit(ctx, s, func() (*CreateResponse, error) { return s.service.Create(ctx, req) })
+}
+
+func (s *concurrencyLimitedService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	return s.service.Get(ctx, req)
+}
+
+func (s *concurrencyLimitedService) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	return s.service.List(ctx, req)
+}
+
+func (s *concurrencyLimitedService) Delete(ctx context.Context, req *DeleteRequest) error {
+	_, err := limit(ctx, s, func() (struct{}, error) { return struct{}{}, s.service.Delete(ctx, req) })
+	return err
+}
+
+func (s *concurrencyLimitedService) AppendEvent(ctx context.Context, curSession Session, event *Event) error {
+	_, err := limit(ctx, s, func() (struct{}, error) { return struct{}{}, s.service.AppendEvent(ctx, curSession, event) })
+	return err
+}
+
+// Transact implements [TransactionService].
+func (s *concurrencyLimitedService) Transact(ctx context.Context, req *TransactRequest) (*TransactResponse, error) {
+	txService, ok := s.service.(TransactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support transactions: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*TransactResponse, error) { return txService.Transact(ctx, req) })
+}
+
+// AppStats implements [StatsService].
+func (s *concurrencyLimitedService) AppStats(ctx context.Context) (map[string]AppStats, error) {
+	statsService, ok := s.service.(StatsService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not provide statistics: %w", s.service, errors.ErrUnsupported)
+	}
+	return statsService.AppStats(ctx)
+}
+
+// Compact implements [CompactionService].
+func (s *concurrencyLimitedService) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	compactionService, ok := s.service.(CompactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support compaction: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*CompactResponse, error) { return compactionService.Compact(ctx, req) })
+}
+
+// WatchUser implements [WatchService].
+func (s *concurrencyLimitedService) WatchUser(ctx context.Context, req *WatchUserRequest) (*Subscription, error) {
+	watchService, ok := s.service.(WatchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support watching: %w", s.service, errors.ErrUnsupported)
+	}
+	return watchService.WatchUser(ctx, req)
+}
+
+// AcquireLease implements [LeaseService].
+func (s *concurrencyLimitedService) AcquireLease(ctx context.Context, req *AcquireLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*Lease, error) { return leaseService.AcquireLease(ctx, req) })
+}
+
+// RenewLease implements [LeaseService].
+func (s *concurrencyLimitedService) RenewLease(ctx context.Context, req *RenewLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*Lease, error) { return leaseService.RenewLease(ctx, req) })
+}
+
+// ReleaseLease implements [LeaseService].
+func (s *concurrencyLimitedService) ReleaseLease(ctx context.Context, req *ReleaseLeaseRequest) error {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	_, err := limit(ctx, s, func() (struct{}, error) { return struct{}{}, leaseService.ReleaseLease(ctx, req) })
+	return err
+}
+
+// Undo implements [UndoService].
+func (s *concurrencyLimitedService) Undo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*UndoResponse, error) { return undoService.Undo(ctx, req) })
+}
+
+// Redo implements [UndoService].
+func (s *concurrencyLimitedService) Redo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*UndoResponse, error) { return undoService.Redo(ctx, req) })
+}
+
+// Touch implements [TouchService].
+func (s *concurrencyLimitedService) Touch(ctx context.Context, req *TouchRequest) (*TouchResponse, error) {
+	touchService, ok := s.service.(TouchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support touching sessions: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*TouchResponse, error) { return touchService.Touch(ctx, req) })
+}
+
+// SetLabels implements [LabelService].
+func (s *concurrencyLimitedService) SetLabels(ctx context.Context, req *SetLabelsRequest) (*SetLabelsResponse, error) {
+	labelService, ok := s.service.(LabelService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support labels: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*SetLabelsResponse, error) { return labelService.SetLabels(ctx, req) })
+}
+
+// PinEvent implements [PinService].
+func (s *concurrencyLimitedService) PinEvent(ctx context.Context, req *PinEventRequest) (*PinEventResponse, error) {
+	pinService, ok := s.service.(PinService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support pinning events: %w", s.service, errors.ErrUnsupported)
+	}
+	return limit(ctx, s, func() (*PinEventResponse, error) { return pinService.PinEvent(ctx, req) })
+}
+
+var (
+	_ Service            = (*concurrencyLimitedService)(nil)
+	_ TransactionService = (*concurrencyLimitedService)(nil)
+	_ StatsService       = (*concurrencyLimitedService)(nil)
+	_ CompactionService  = (*concurrencyLimitedService)(nil)
+	_ WatchService       = (*concurrencyLimitedService)(nil)
+	_ LeaseService       = (*concurrencyLimitedService)(nil)
+	_ UndoService        = (*concurrencyLimitedService)(nil)
+	_ TouchService       = (*concurrencyLimitedService)(nil)
+	_ LabelService       = (*concurrencyLimitedService)(nil)
+	_ PinService         = (*concurrencyLimitedService)(nil)
+)
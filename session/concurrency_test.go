@@ -0,0 +1,129 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingService is a Service whose creations block until released.
+type blockingService struct {
+	Service
+	entered chan string
+	release chan struct{}
+}
+
+func (s *blockingService) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	s.entered <- req.SessionID
+	<-s.release
+	return s.Service.Create(ctx, req)
+}
+
+func newTestLimiter(t *testing.T, cfg ConcurrencyLimitConfig) (*concurrencyLimitedService, *blockingService) {
+	t.Helper()
+	inner := &blockingService{Service: InMemoryService(), entered: make(chan string), release: make(chan struct{})}
+	return ServiceWithConcurrencyLimit(inner, cfg).(*concurrencyLimitedService), inner
+}
+
+// waitQueued waits until n mutations are queued by the limiter.
+func waitQueued(t *testing.T, s *concurrencyLimitedService, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		queued := s.queued
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d mutations queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimit_QueuesThenSheds(t *testing.T) {
+	ctx := t.Context()
+	limiter, inner := newTestLimiter(t, ConcurrencyLimitConfig{MaxConcurrent: 2, MaxQueued: 1})
+	create := func(sessionID string) <-chan error {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := limiter.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+			errc <- err
+		}()
+		return errc
+	}
+
+	running := []<-chan error{create("s1"), create("s2")}
+	for range running {
+		<-inner.entered
+	}
+	queued := create("s3")
+	waitQueued(t, limiter, 1)
+
+	_, err := limiter.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s4"})
+	if !errors.Is(err, ErrServiceOverloaded) {
+		t.Fatalf("Create() past the queue error = %v, want %v", err, ErrServiceOverloaded)
+	}
+	// Reads are not limited.
+	if _, err := limiter.List(ctx, &ListRequest{AppName: "app", UserID: "user"}); err != nil {
+		t.Errorf("List() of a saturated service error = %v", err)
+	}
+
+	// Finishing a running mutation lets the queued one through.
+	inner.release <- struct{}{}
+	if got := <-inner.entered; got != "s3" {
+		t.Errorf("mutation let through = %q, want %q", got, "s3")
+	}
+	waitQueued(t, limiter, 0)
+	close(inner.release)
+	for _, errc := range append(running, queued) {
+		if err := <-errc; err != nil {
+			t.Errorf("Create() error = %v", err)
+		}
+	}
+}
+
+func TestConcurrencyLimit_MaxWait(t *testing.T) {
+	limiter, inner := newTestLimiter(t, ConcurrencyLimitConfig{MaxConcurrent: 1, MaxQueued: 1, MaxWait: 10 * time.Millisecond})
+	errc := make(chan error, 1)
+	go func() {
+		_, err := limiter.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+		errc <- err
+	}()
+	<-inner.entered
+
+	_, err := limiter.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "s2"})
+	if !errors.Is(err, ErrServiceOverloaded) {
+		t.Errorf("Create() queued past MaxWait error = %v, want %v", err, ErrServiceOverloaded)
+	}
+
+	// A canceled context ends the wait with its own error.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = limiter.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s3"})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrServiceOverloaded) {
+		t.Errorf("Create() with a canceled context error = %v, want %v", err, context.Canceled)
+	}
+
+	close(inner.release)
+	if err := <-errc; err != nil {
+		t.Errorf("Create() error = %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+// ErrEventContentTooLarge is returned, wrapped, when an appended event's
+// content exceeds the limit of a [ContentLimit] in reject mode.
+var ErrEventContentTooLarge = errors.New("event content too large")
+
+// ContentLimitMode selects what happens to an event whose content exceeds
+// the limit.
+type ContentLimitMode int
+
+const (
+	// ContentLimitReject fails the append with [ErrEventContentTooLarge].
+	ContentLimitReject ContentLimitMode = iota
+	// ContentLimitTruncate cuts the content down to the limit and appends a
+	// text part marking the truncation.
+	ContentLimitTruncate
+)
+
+// ContentLimit limits the size of the content of appended events.
+//
+// The size of a content is the sum of the sizes of its parts: the length of
+// the text for text parts, the length of the JSON encoding for other parts.
+type ContentLimit struct {
+	// MaxBytes is the largest accepted content size.
+	// Optional: if zero, the content size is not limited.
+	MaxBytes int
+	Mode     ContentLimitMode
+}
+
+// ContentLimits holds the content limits of the apps of a service.
+type ContentLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default ContentLimit
+	// Apps maps an app name to its content limit.
+	Apps map[string]ContentLimit
+}
+
+// ForApp returns the content limit of the app.
+func (l ContentLimits) ForApp(appName string) ContentLimit {
+	if limit, ok := l.Apps[appName]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Apply enforces the limit on the event before it is stored. In truncate
+// mode the event content is replaced by its truncated copy.
+func (l ContentLimit) Apply(event *Event) error {
+	if l.MaxBytes <= 0 || event.Content == nil {
+		return nil
+	}
+	size := contentSize(event.Content)
+	if size <= l.MaxBytes {
+		return nil
+	}
+	if l.Mode == ContentLimitReject {
+		return fmt.Errorf("%w: %d bytes exceed the limit of %d bytes", ErrEventContentTooLarge, size, l.MaxBytes)
+	}
+	event.Content = truncateContent(event.Content, l.MaxBytes, size)
+	return nil
+}
+
+// contentSize returns the size of the content as defined by [ContentLimit].
+func contentSize(content *genai.Content) int {
+	size := 0
+	for _, part := range content.Parts {
+		size += partSize(part)
+	}
+	return size
+}
+
+func partSize(part *genai.Part) int {
+	if part == nil {
+		return 0
+	}
+	if isTextPart(part) {
+		return len(part.Text)
+	}
+	encoded, err := json.Marshal(part)
+	if err != nil {
+		return 0
+	}
+	return len(encoded)
+}
+
+func isTextPart(part *genai.Part) bool {
+	return part.Text != "" && part.InlineData == nil && part.FileData == nil &&
+		part.FunctionCall == nil && part.FunctionResponse == nil &&
+		part.ExecutableCode == nil && part.CodeExecutionResult == nil
+}
+
+// truncateContent returns a copy of the content holding at most maxBytes,
+// followed by a text part marking the truncation. Text parts are cut, other
+// parts are kept whole or dropped.
+func truncateContent(content *genai.Content, maxBytes, size int) *genai.Content {
+	truncated := &genai.Content{Role: content.Role}
+	remaining := maxBytes
+	for _, part := range content.Parts {
+		if part == nil {
+			continue
+		}
+		partBytes := partSize(part)
+		if partBytes <= remaining {
+			truncated.Parts = append(truncated.Parts, part)
+			remaining -= partBytes
+			continue
+		}
+		if isTextPart(part) && remaining > 0 {
+			cut := *part
+			cut.Text = truncateUTF8(part.Text, remaining)
+			truncated.Parts = append(truncated.Parts, &cut)
+			remaining -= len(cut.Text)
+		}
+		break
+	}
+	truncated.Parts = append(truncated.Parts, genai.NewPartFromText(fmt.Sprintf("[content truncated: %d of %d bytes kept]", maxBytes-remaining, size)))
+	return truncated
+}
+
+// truncateUTF8 returns the longest prefix of s of at most n bytes which
+// doesn't split a rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genai"
+)
+
+func TestContentLimit_Apply(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       ContentLimit
+		content     *genai.Content
+		wantErr     error
+		wantContent *genai.Content
+	}{
+		{
+			name:        "no limit",
+			limit:       ContentLimit{},
+			content:     genai.NewContentFromText("0123456789", genai.RoleModel),
+			wantContent: genai.NewContentFromText("0123456789", genai.RoleModel),
+		},
+		{
+			name:        "reject at the limit",
+			limit:       ContentLimit{MaxBytes: 10, Mode: ContentLimitReject},
+			content:     genai.NewContentFromText("0123456789", genai.RoleModel),
+			wantContent: genai.NewContentFromText("0123456789", genai.RoleModel),
+		},
+		{
+			name:        "reject above the limit",
+			limit:       ContentLimit{MaxBytes: 9, Mode: ContentLimitReject},
+			content:     genai.NewContentFromText("0123456789", genai.RoleModel),
+			wantErr:     ErrEventContentTooLarge,
+			wantContent: genai.NewContentFromText("0123456789", genai.RoleModel),
+		},
+		{
+			name:        "truncate at the limit",
+			limit:       ContentLimit{MaxBytes: 10, Mode: ContentLimitTruncate},
+			content:     genai.NewContentFromText("0123456789", genai.RoleModel),
+			wantContent: genai.NewContentFromText("0123456789", genai.RoleModel),
+		},
+		{
+			name:    "truncate above the limit",
+			limit:   ContentLimit{MaxBytes: 9, Mode: ContentLimitTruncate},
+			content: genai.NewContentFromText("0123456789", genai.RoleModel),
+			wantContent: genai.NewContentFromParts([]*genai.Part{
+				genai.NewPartFromText("012345678"),
+				genai.NewPartFromText("[content truncated: 9 of 10 bytes kept]"),
+			}, genai.RoleModel),
+		},
+		{
+			name:  "truncate across parts",
+			limit: ContentLimit{MaxBytes: 6, Mode: ContentLimitTruncate},
+			content: genai.NewContentFromParts([]*genai.Part{
+				genai.NewPartFromText("0123"),
+				genai.NewPartFromText("4567"),
+				genai.NewPartFromText("89"),
+			}, genai.RoleModel),
+			wantContent: genai.NewContentFromParts([]*genai.Part{
+				genai.NewPartFromText("0123"),
+				genai.NewPartFromText("45"),
+				genai.NewPartFromText("[content truncated: 6 of 10 bytes kept]"),
+			}, genai.RoleModel),
+		},
+		{
+			name:    "truncate doesn't split runes",
+			limit:   ContentLimit{MaxBytes: 4, Mode: ContentLimitTruncate},
+			content: genai.NewContentFromText("ééé", genai.RoleModel),
+			wantContent: genai.NewContentFromParts([]*genai.Part{
+				genai.NewPartFromText("éé"),
+				genai.NewPartFromText("[content truncated: 4 of 6 bytes kept]"),
+			}, genai.RoleModel),
+		},
+		{
+			name:  "truncate drops non-text parts",
+			limit: ContentLimit{MaxBytes: 4, Mode: ContentLimitTruncate},
+			content: genai.NewContentFromParts([]*genai.Part{
+				genai.NewPartFromText("0123"),
+				genai.NewPartFromFunctionResponse("tool", map[string]any{"result": "large"}),
+			}, genai.RoleUser),
+			wantContent: genai.NewContentFromParts([]*genai.Part{
+				genai.NewPartFromText("0123"),
+				genai.NewPartFromText("[content truncated: 4 of 70 bytes kept]"),
+			}, genai.RoleUser),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &Event{}
+			event.Content = tt.content
+			err := tt.limit.Apply(event)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.wantContent, event.Content); diff != "" {
+				t.Errorf("Apply() content mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestContentLimits_ForApp(t *testing.T) {
+	limits := ContentLimits{
+		Default: ContentLimit{MaxBytes: 100},
+		Apps:    map[string]ContentLimit{"app": {MaxBytes: 10, Mode: ContentLimitTruncate}},
+	}
+	if got, want := limits.ForApp("app"), (ContentLimit{MaxBytes: 10, Mode: ContentLimitTruncate}); got != want {
+		t.Errorf("ForApp(app) = %+v, want %+v", got, want)
+	}
+	if got, want := limits.ForApp("other"), (ContentLimit{MaxBytes: 100}); got != want {
+		t.Errorf("ForApp(other) = %+v, want %+v", got, want)
+	}
+}
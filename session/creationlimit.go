@@ -0,0 +1,118 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrCreationRateExceeded is returned, wrapped in a [*CreationRateError],
+// when sessions are created faster than the creation rate of their app or
+// user allows. The session is not created, clients are expected to retry
+// later.
+var ErrCreationRateExceeded = errors.New("session creation rate exceeded")
+
+// CreationRateError is returned when a session creation is rejected by a
+// [CreationLimiter].
+type CreationRateError struct {
+	AppName, UserID string
+	// RetryAfter is the time until the rate allows the creation.
+	RetryAfter time.Duration
+}
+
+func (e *CreationRateError) Error() string {
+	return fmt.Sprintf("%v for user %q of app %q, retry after %v", ErrCreationRateExceeded, e.UserID, e.AppName, e.RetryAfter)
+}
+
+func (e *CreationRateError) Unwrap() error {
+	return ErrCreationRateExceeded
+}
+
+// CreationRate is the rate at which sessions are created. A rate of zero or
+// less means no limit.
+type CreationRate struct {
+	// SessionsPerSecond is the sustained rate of created sessions.
+	SessionsPerSecond float64
+	// Burst is the number of sessions created at once above the sustained
+	// rate. Optional: defaults to 1.
+	Burst int
+}
+
+// CreationLimits holds the session creation rates, per app and per user.
+type CreationLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default CreationRate
+	// Apps maps an app name to the rate of the app as a whole.
+	Apps map[string]CreationRate
+	// PerUser applies to each user of every app, in addition to the rate
+	// of the app.
+	PerUser CreationRate
+}
+
+// ForApp returns the creation rate of the app.
+func (l CreationLimits) ForApp(appName string) CreationRate {
+	if r, ok := l.Apps[appName]; ok {
+		return r
+	}
+	return l.Default
+}
+
+// CreationLimiter limits the rate at which sessions are created in a
+// session service, separately from the rate of the other calls: reads and
+// appends to existing sessions are not limited. It is safe for concurrent
+// use, and can be shared by several services to limit their combined rate.
+type CreationLimiter struct {
+	limits   CreationLimits
+	limiters rateLimiters
+}
+
+// NewCreationLimiter returns a limiter enforcing the limits.
+func NewCreationLimiter(limits CreationLimits) *CreationLimiter {
+	return &CreationLimiter{limits: limits}
+}
+
+// Admit returns nil if a session of the user may be created now, according
+// to the rates of its app and of its user, and a [*CreationRateError]
+// otherwise. Rejected creations don't count against the rates. A nil
+// limiter admits every creation.
+func (l *CreationLimiter) Admit(appName, userID string) error {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	var appReservation *rate.Reservation
+	if r := l.limits.ForApp(appName); r.SessionsPerSecond > 0 {
+		appReservation = l.limiters.get(id{appName: appName}.Encode(), r.SessionsPerSecond, r.Burst).ReserveN(now, 1)
+		if delay := appReservation.DelayFrom(now); delay > 0 {
+			appReservation.CancelAt(now)
+			return &CreationRateError{AppName: appName, UserID: userID, RetryAfter: delay}
+		}
+	}
+	if r := l.limits.PerUser; r.SessionsPerSecond > 0 {
+		userReservation := l.limiters.get(id{appName: appName, userID: userID}.Encode(), r.SessionsPerSecond, r.Burst).ReserveN(now, 1)
+		if delay := userReservation.DelayFrom(now); delay > 0 {
+			userReservation.CancelAt(now)
+			if appReservation != nil {
+				appReservation.CancelAt(now)
+			}
+			return &CreationRateError{AppName: appName, UserID: userID, RetryAfter: delay}
+		}
+	}
+	return nil
+}
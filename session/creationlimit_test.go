@@ -0,0 +1,83 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_inMemoryService_CreationLimit(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		Creation: NewCreationLimiter(CreationLimits{
+			Apps:    map[string]CreationRate{"stormy": {SessionsPerSecond: 0.1, Burst: 3}},
+			PerUser: CreationRate{SessionsPerSecond: 0.1, Burst: 2},
+		}),
+	})
+
+	// A user gets its burst, and the creations past it are rejected with
+	// the time until the next one is allowed.
+	first, err := s.Create(ctx, &CreateRequest{AppName: "stormy", UserID: "loop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "stormy", UserID: "loop"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Create(ctx, &CreateRequest{AppName: "stormy", UserID: "loop"})
+	var rateErr *CreationRateError
+	if !errors.As(err, &rateErr) || !errors.Is(err, ErrCreationRateExceeded) {
+		t.Fatalf("Create() past the user burst error = %v, want CreationRateError", err)
+	}
+	if rateErr.RetryAfter <= 0 || rateErr.RetryAfter > 10*time.Second {
+		t.Errorf("RetryAfter = %v, want at most the 10s interval of the rate", rateErr.RetryAfter)
+	}
+
+	// The sessions created stay readable and writable.
+	if _, err := s.Get(ctx, &GetRequest{AppName: "stormy", UserID: "loop", SessionID: first.Session.ID()}); err != nil {
+		t.Errorf("Get() of a created session error = %v", err)
+	}
+	if err := s.AppendEvent(ctx, first.Session, stateEvent(map[string]any{"n": 1})); err != nil {
+		t.Errorf("AppendEvent() to a created session error = %v", err)
+	}
+
+	// The rejected creation didn't count against the app: another user
+	// gets the last session of the app burst.
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "stormy", UserID: "other"}); err != nil {
+		t.Fatalf("Create() by another user error = %v", err)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "stormy", UserID: "third"}); !errors.Is(err, ErrCreationRateExceeded) {
+		t.Errorf("Create() past the app burst error = %v, want ErrCreationRateExceeded", err)
+	}
+
+	// Other apps only have the per user rate.
+	for range 2 {
+		if _, err := s.Create(ctx, &CreateRequest{AppName: "calm", UserID: "loop"}); err != nil {
+			t.Fatalf("Create() in another app error = %v", err)
+		}
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "calm", UserID: "loop"}); !errors.Is(err, ErrCreationRateExceeded) {
+		t.Errorf("Create() past the user burst in another app error = %v, want ErrCreationRateExceeded", err)
+	}
+}
+
+func TestCreationLimiter_Nil(t *testing.T) {
+	var l *CreationLimiter
+	if err := l.Admit("app", "user"); err != nil {
+		t.Errorf("Admit() of a nil limiter error = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	"google.golang.org/adk/session"
+)
+
+// SQLite result codes of the failures which may not happen again when the
+// statement is retried: the database, or a table, is locked by another
+// connection.
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// markTransient marks the error of a service call with
+// [session.MarkTransient] if it is a transient failure of the database, so
+// that [session.IsTransient] and [session.ServiceWithRetries] recognize it.
+// The errors are recognized by their types rather than their messages:
+//   - the bad connections reported by database/sql drivers;
+//   - the SQLite busy and locked result codes, of errors with a Code method
+//     like the ones of the SQLite drivers;
+//   - the SQLSTATE classes of connection exceptions (08) and transaction
+//     rollbacks (40), such as serialization failures and deadlocks, of
+//     errors with a SQLState method like the ones of the PostgreSQL driver.
+func markTransient(err *error) {
+	if isTransientDBError(*err) {
+		*err = session.MarkTransient(*err)
+	}
+}
+
+// isTransientDBError reports whether the error is a transient failure of
+// the database, see markTransient.
+func isTransientDBError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) {
+		// Extended result codes keep the primary code in their low byte.
+		switch coded.Code() & 0xff {
+		case sqliteBusy, sqliteLocked:
+			return true
+		}
+	}
+	var stated interface{ SQLState() string }
+	if errors.As(err, &stated) {
+		state := stated.SQLState()
+		return len(state) == 5 && (state[:2] == "08" || state[:2] == "40")
+	}
+	return false
+}
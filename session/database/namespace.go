@@ -0,0 +1,119 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"regexp"
+
+	"gorm.io/gorm"
+)
+
+// AppNamespaces maps app names to the storage namespaces holding their
+// sessions, events and states, so that the data of different apps is kept
+// apart. A namespace is a prefix of the table names: with the namespace
+// "tenant_a_", the sessions of an app are stored in "tenant_a_sessions". On
+// databases with schemas, such as PostgreSQL, a namespace ending with a dot,
+// like "tenant_a.", designates a schema, which must exist before
+// [AutoMigrate] runs.
+type AppNamespaces struct {
+	// Default is the namespace of the apps without an entry in Apps.
+	// Optional: by default they use the unprefixed tables.
+	Default string
+	// Apps maps an app name to its namespace.
+	Apps map[string]string
+}
+
+// ForApp returns the namespace of the app.
+func (n AppNamespaces) ForApp(appName string) string {
+	if namespace, ok := n.Apps[appName]; ok {
+		return namespace
+	}
+	return n.Default
+}
+
+// all returns the distinct namespaces, the default one first.
+func (n AppNamespaces) all() []string {
+	namespaces := []string{n.Default}
+	seen := map[string]bool{n.Default: true}
+	for _, namespace := range n.Apps {
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+var namespacePattern = regexp.MustCompile(`^(\w+\.)?\w*$`)
+
+// validate checks that the namespaces make valid table names.
+func (n AppNamespaces) validate() error {
+	if !namespacePattern.MatchString(n.Default) {
+		return fmt.Errorf("invalid default namespace %q", n.Default)
+	}
+	for appName, namespace := range n.Apps {
+		if !namespacePattern.MatchString(namespace) {
+			return fmt.Errorf("invalid namespace %q of app %q", namespace, appName)
+		}
+	}
+	return nil
+}
+
+// tables holds the table names of a namespace.
+type tables struct {
+	sessions, events, appStates, userStates string
+}
+
+func namespaceTables(namespace string) tables {
+	return tables{
+		sessions:   namespace + storageSession{}.TableName(),
+		events:     namespace + storageEvent{}.TableName(),
+		appStates:  namespace + storageAppState{}.TableName(),
+		userStates: namespace + storageUserState{}.TableName(),
+	}
+}
+
+// tablesFor returns the tables of the namespace of the app.
+func (s *databaseService) tablesFor(appName string) tables {
+	return namespaceTables(s.cfg.Namespaces.ForApp(appName))
+}
+
+// migrateNamespace creates or updates the tables of the namespace.
+func migrateNamespace(db *gorm.DB, namespace string) error {
+	if namespace == "" {
+		return db.AutoMigrate(&storageSession{}, &storageEvent{}, &storageAppState{}, &storageUserState{})
+	}
+	// The relation between events and sessions refers to the unprefixed
+	// tables, so the tables of a namespace are migrated without it, and
+	// without its foreign key.
+	db = db.Session(&gorm.Session{})
+	db.Config.IgnoreRelationshipsWhenMigrating = true
+	t := namespaceTables(namespace)
+	for _, m := range []struct {
+		table string
+		model any
+	}{
+		{t.sessions, &storageSession{}},
+		{t.events, &storageEvent{}},
+		{t.appStates, &storageAppState{}},
+		{t.userStates, &storageUserState{}},
+	} {
+		if err := db.Table(m.table).AutoMigrate(m.model); err != nil {
+			return fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+	}
+	return nil
+}
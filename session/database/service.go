@@ -30,7 +30,54 @@ import (
 
 // databaseService is an database implementation of sessionService.Service.
 type databaseService struct {
-	db *gorm.DB
+	db  *gorm.DB
+	cfg ServiceConfig
+}
+
+// ServiceConfig contains optional settings of the database session service.
+// The zero value is a valid config.
+type ServiceConfig struct {
+	// ContentLimits limits the content size of appended events, per app.
+	// Optional: by default the content size is not limited.
+	ContentLimits session.ContentLimits
+	// MaxEvents caps the number of events of a session, per app. Appends to
+	// a full session fail with [session.ErrSessionFull].
+	// Optional: by default the number of events is not limited.
+	MaxEvents session.EventCountLimits
+	// MaxUserEvents caps the total number of events across all the
+	// sessions of a user, per app, checked in the transaction appending an
+	// event. Appends past the cap fail with [session.ErrUserEventsExceeded].
+	// Optional: by default the number of events of a user is not limited.
+	MaxUserEvents session.UserEventLimits
+	// MaxStateKeys caps the number of keys of a session state, its app and
+	// user keys included, per app, checked in the transaction appending an
+	// event. Appends growing a state past the cap fail with
+	// [session.ErrStateKeysExceeded].
+	// Optional: by default the number of state keys is not limited.
+	MaxStateKeys session.StateKeyLimits
+	// MaxSessions caps the number of sessions of each user, and of each
+	// app, checked in the transaction creating a session. Creations past
+	// the cap fail with [session.ErrTooManySessions] or delete the oldest
+	// idle sessions, depending on the eviction of the limit.
+	// Optional: by default the number of sessions is not limited.
+	MaxSessions session.SessionCountLimits
+	// AllowUpdatedAtRegression sets the update time of a session to the
+	// timestamp of each appended event, even when it is earlier than the
+	// stored update time. By default the update time never moves backward,
+	// so that an event stamped by a lagging clock doesn't make the session
+	// look stale to the next append.
+	AllowUpdatedAtRegression bool
+	// Ingestion limits the rate of appended events, before their
+	// transaction starts, see [session.NewIngestionLimiter].
+	// Optional: if nil, the rate is not limited.
+	Ingestion *session.IngestionLimiter
+	// Creation limits the rate of created sessions, per app and per user,
+	// see [session.NewCreationLimiter].
+	// Optional: if nil, the rate is not limited.
+	Creation *session.CreationLimiter
+	// Namespaces maps app names to the namespaces of their tables.
+	// Optional: by default every app uses the unprefixed tables.
+	Namespaces AppNamespaces
 }
 
 // NewSessionService creates a new [session.Service] implementation that uses a
@@ -42,15 +89,25 @@ type databaseService struct {
 // It returns the new [session.Service] or an error if the database connection
 // [gorm.Open] fails.
 func NewSessionService(dialector gorm.Dialector, opts ...gorm.Option) (session.Service, error) {
+	return NewSessionServiceWithConfig(dialector, ServiceConfig{}, opts...)
+}
+
+// NewSessionServiceWithConfig is like [NewSessionService], using the given
+// service config.
+func NewSessionServiceWithConfig(dialector gorm.Dialector, cfg ServiceConfig, opts ...gorm.Option) (session.Service, error) {
+	if err := cfg.Namespaces.validate(); err != nil {
+		return nil, fmt.Errorf("error creating database session service: %w", err)
+	}
 	db, err := gorm.Open(dialector, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating database session service: %w", err)
 	}
-	return &databaseService{db: db}, nil
+	return &databaseService{db: db, cfg: cfg}, nil
 }
 
 // AutoMigrate runs the GORM auto-migration tool to ensure the database schema
-// matches the internal storage models (e.g., storageSession, storageEvent).
+// matches the internal storage models (e.g., storageSession, storageEvent),
+// in every namespace of the service config.
 //
 // NOTE: This function relies on a type assertion to the concrete *databaseService
 // implementation. It will return an error if the provided session.Service is
@@ -60,18 +117,23 @@ func AutoMigrate(service session.Service) error {
 	if !ok {
 		return fmt.Errorf("invalid session service type")
 	}
-	err := dbservice.db.AutoMigrate(&storageSession{}, &storageEvent{}, &storageAppState{}, &storageUserState{})
-	if err != nil {
-		return fmt.Errorf("auto migrate failed: %w", err)
+	for _, namespace := range dbservice.cfg.Namespaces.all() {
+		if err := migrateNamespace(dbservice.db, namespace); err != nil {
+			return fmt.Errorf("auto migrate failed: %w", err)
+		}
 	}
 	return nil
 }
 
 // Create generates a session and inserts it to the db, implements session.Service
-func (s *databaseService) Create(ctx context.Context, req *session.CreateRequest) (*session.CreateResponse, error) {
+func (s *databaseService) Create(ctx context.Context, req *session.CreateRequest) (_ *session.CreateResponse, err error) {
+	defer markTransient(&err)
 	if req.AppName == "" || req.UserID == "" {
 		return nil, fmt.Errorf("app_name and user_id are required")
 	}
+	if err := s.cfg.Creation.Admit(req.AppName, req.UserID); err != nil {
+		return nil, err
+	}
 
 	sessionID := req.SessionID
 	if sessionID == "" {
@@ -94,12 +156,13 @@ func (s *databaseService) Create(ctx context.Context, req *session.CreateRequest
 		return nil, err
 	}
 
+	t := s.tablesFor(req.AppName)
 	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		storageApp, err := fetchStorageAppState(tx, req.AppName)
+		storageApp, err := fetchStorageAppState(tx.Table(t.appStates), req.AppName)
 		if err != nil {
 			return fmt.Errorf("error on create session: %w", err)
 		}
-		storageUser, err := fetchStorageUserState(tx, req.AppName, req.UserID)
+		storageUser, err := fetchStorageUserState(tx.Table(t.userStates), req.AppName, req.UserID)
 		if err != nil {
 			return fmt.Errorf("error on create session: %w", err)
 		}
@@ -109,19 +172,22 @@ func (s *databaseService) Create(ctx context.Context, req *session.CreateRequest
 		// apply state delta
 		if len(appDelta) > 0 {
 			maps.Copy(storageApp.State, appDelta)
-			if err := tx.Save(&storageApp).Error; err != nil {
+			if err := tx.Table(t.appStates).Save(&storageApp).Error; err != nil {
 				return fmt.Errorf("failed to save app state: %w", err)
 			}
 		}
 		if len(userDelta) > 0 {
 			maps.Copy(storageUser.State, userDelta)
-			if err := tx.Save(&storageUser).Error; err != nil {
+			if err := tx.Table(t.userStates).Save(&storageUser).Error; err != nil {
 				return fmt.Errorf("failed to save user state: %w", err)
 			}
 		}
 		createdSession.State = sessionState
 
-		if err := tx.Create(createdSession).Error; err != nil {
+		if err := s.admitSession(tx, t, req.AppName, req.UserID); err != nil {
+			return err
+		}
+		if err := tx.Table(t.sessions).Create(createdSession).Error; err != nil {
 			return fmt.Errorf("error creating session on database: %w", err)
 		}
 
@@ -138,16 +204,64 @@ func (s *databaseService) Create(ctx context.Context, req *session.CreateRequest
 	}, nil
 }
 
+// admitSession makes room for a session of the user under the session
+// count limit of the app, deleting the oldest idle sessions if the limit
+// allows it. The sessions are counted with the primary key index, whose
+// prefix is the app and user.
+func (s *databaseService) admitSession(tx *gorm.DB, t tables, appName, userID string) error {
+	limit := s.cfg.MaxSessions.ForApp(appName)
+	if limit.MaxPerUser <= 0 && limit.MaxPerApp <= 0 {
+		return nil
+	}
+	for {
+		var userSessions, appSessions int64
+		if limit.MaxPerUser > 0 {
+			if err := tx.Table(t.sessions).Where("app_name = ? AND user_id = ?", appName, userID).Count(&userSessions).Error; err != nil {
+				return fmt.Errorf("failed to count sessions: %w", err)
+			}
+		}
+		if limit.MaxPerApp > 0 {
+			if err := tx.Table(t.sessions).Where("app_name = ?", appName).Count(&appSessions).Error; err != nil {
+				return fmt.Errorf("failed to count sessions: %w", err)
+			}
+		}
+		perUser, err := limit.Check(appName, userID, int(userSessions), int(appSessions))
+		if err == nil || limit.Eviction != session.SessionEvictionOldestIdle {
+			return err
+		}
+
+		scope := tx.Table(t.sessions).Where("app_name = ?", appName)
+		if perUser {
+			scope = scope.Where("user_id = ?", userID)
+		}
+		var oldest storageSession
+		if err := scope.Order("update_time ASC").First(&oldest).Error; err != nil {
+			return fmt.Errorf("failed to find the oldest idle session: %w", err)
+		}
+		if err := tx.Table(t.events).Where("app_name = ? AND user_id = ? AND session_id = ?", oldest.AppName, oldest.UserID, oldest.ID).
+			Delete(&storageEvent{}).Error; err != nil {
+			return fmt.Errorf("failed to delete the events of evicted session: %w", err)
+		}
+		if err := tx.Table(t.sessions).Where(&storageSession{AppName: oldest.AppName, UserID: oldest.UserID, ID: oldest.ID}).
+			Delete(&storageSession{}).Error; err != nil {
+			return fmt.Errorf("failed to evict session: %w", err)
+		}
+	}
+}
+
 // Get retrieves a single session from the database using its composite primary key.
-func (s *databaseService) Get(ctx context.Context, req *session.GetRequest) (*session.GetResponse, error) {
+func (s *databaseService) Get(ctx context.Context, req *session.GetRequest) (_ *session.GetResponse, err error) {
+	defer markTransient(&err)
 	// Ensure all parts of the composite key are provided.
 	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
 	if appName == "" || userID == "" || sessionID == "" {
 		return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
 	}
 
+	t := s.tablesFor(appName)
 	var foundSession storageSession
-	err := s.db.WithContext(ctx).
+	err = s.db.WithContext(ctx).
+		Table(t.sessions).
 		Where(&storageSession{
 			AppName: appName,
 			UserID:  userID,
@@ -161,7 +275,7 @@ func (s *databaseService) Get(ctx context.Context, req *session.GetRequest) (*se
 
 	// Fetch events
 	eventQuery := s.db.WithContext(ctx).
-		Model(&storageEvent{}).
+		Table(t.events).
 		Where("app_name = ?", appName).
 		Where("user_id = ?", userID).
 		Where("session_id = ?", sessionID)
@@ -171,8 +285,10 @@ func (s *databaseService) Get(ctx context.Context, req *session.GetRequest) (*se
 		eventQuery = eventQuery.Where("timestamp >= ?", req.After)
 	}
 
-	// Order by timestamp DESC to get the most recent events when limiting
-	eventQuery = eventQuery.Order("timestamp DESC")
+	// Order by sequence DESC to get the most recent events when limiting.
+	// The events appended before sequences were assigned have none, they
+	// are ordered by timestamp before the others.
+	eventQuery = eventQuery.Order("sequence DESC").Order("timestamp DESC")
 
 	if req.NumRecentEvents > 0 {
 		eventQuery = eventQuery.Limit(req.NumRecentEvents)
@@ -185,11 +301,11 @@ func (s *databaseService) Get(ctx context.Context, req *session.GetRequest) (*se
 	}
 
 	// fetch app and user states
-	storageApp, err := fetchStorageAppState(s.db.WithContext(ctx), appName)
+	storageApp, err := fetchStorageAppState(s.db.WithContext(ctx).Table(t.appStates), appName)
 	if err != nil {
 		return nil, fmt.Errorf("error on get session: %w", err)
 	}
-	storageUser, err := fetchStorageUserState(s.db.WithContext(ctx), appName, userID)
+	storageUser, err := fetchStorageUserState(s.db.WithContext(ctx).Table(t.userStates), appName, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error on get session: %w", err)
 	}
@@ -219,14 +335,17 @@ func (s *databaseService) Get(ctx context.Context, req *session.GetRequest) (*se
 }
 
 // List retrieves sessions from the database using its appName and optional UserID
-func (s *databaseService) List(ctx context.Context, req *session.ListRequest) (*session.ListResponse, error) {
+func (s *databaseService) List(ctx context.Context, req *session.ListRequest) (_ *session.ListResponse, err error) {
+	defer markTransient(&err)
 	appName, userID := req.AppName, req.UserID
 	if appName == "" {
 		return nil, fmt.Errorf("app_name is required, got app_name: %q", req.AppName)
 	}
 
+	t := s.tablesFor(appName)
 	var foundSessions []storageSession
 	listQuery := s.db.WithContext(ctx).
+		Table(t.sessions).
 		Where(&storageSession{
 			AppName: appName,
 		})
@@ -237,7 +356,7 @@ func (s *databaseService) List(ctx context.Context, req *session.ListRequest) (*
 		})
 	}
 
-	err := listQuery.Find(&foundSessions).Error
+	err = listQuery.Find(&foundSessions).Error
 	if err != nil {
 		// Specifically check if the error is "record not found".
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -250,20 +369,20 @@ func (s *databaseService) List(ctx context.Context, req *session.ListRequest) (*
 		return nil, fmt.Errorf("database error while fetching session: %w", err)
 	}
 
-	storageApp, err := fetchStorageAppState(s.db.WithContext(ctx), appName)
+	storageApp, err := fetchStorageAppState(s.db.WithContext(ctx).Table(t.appStates), appName)
 	if err != nil {
 		return nil, fmt.Errorf("error on list sessions: %w", err)
 	}
 
 	var userStates map[string]*storageUserState
 	if userID != "" {
-		userState, err := fetchStorageUserState(s.db.WithContext(ctx), appName, userID)
+		userState, err := fetchStorageUserState(s.db.WithContext(ctx).Table(t.userStates), appName, userID)
 		if err != nil {
 			return nil, fmt.Errorf("error on list sessions: %w", err)
 		}
 		userStates = map[string]*storageUserState{userID: userState}
 	} else {
-		userStates, err = fetchAllAppStorageUserState(s.db.WithContext(ctx), appName)
+		userStates, err = fetchAllAppStorageUserState(s.db.WithContext(ctx).Table(t.userStates), appName)
 		if err != nil {
 			return nil, fmt.Errorf("error on list sessions: %w", err)
 		}
@@ -293,16 +412,18 @@ func (s *databaseService) List(ctx context.Context, req *session.ListRequest) (*
 }
 
 // Delete, deletes a session given a specific id returning error on failure, implements session.Service
-func (s *databaseService) Delete(ctx context.Context, req *session.DeleteRequest) error {
+func (s *databaseService) Delete(ctx context.Context, req *session.DeleteRequest) (err error) {
+	defer markTransient(&err)
 	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
 	if appName == "" || userID == "" || sessionID == "" {
 		return fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
 	}
 
+	t := s.tablesFor(appName)
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		target := &storageSession{}
 
-		result := tx.Where(&storageSession{
+		result := tx.Table(t.sessions).Where(&storageSession{
 			AppName: req.AppName,
 			UserID:  req.UserID,
 			ID:      req.SessionID,
@@ -316,7 +437,8 @@ func (s *databaseService) Delete(ctx context.Context, req *session.DeleteRequest
 	})
 }
 
-func (s *databaseService) AppendEvent(ctx context.Context, curSession session.Session, event *session.Event) error {
+func (s *databaseService) AppendEvent(ctx context.Context, curSession session.Session, event *session.Event) (err error) {
+	defer markTransient(&err)
 	if curSession == nil {
 		return fmt.Errorf("session is nil")
 	}
@@ -339,8 +461,15 @@ func (s *databaseService) AppendEvent(ctx context.Context, curSession session.Se
 		return fmt.Errorf("unexpected session type %T", sess)
 	}
 
+	if err := s.cfg.ContentLimits.ForApp(sess.AppName()).Apply(event); err != nil {
+		return err
+	}
+	if err := s.cfg.Ingestion.Admit(ctx, sess.AppName(), sess.UserID(), sess.ID()); err != nil {
+		return err
+	}
+
 	// applyChanges and persist them
-	err := s.applyEvent(ctx, sess, event)
+	err = s.applyEvent(ctx, sess, event)
 	if err != nil {
 		return err
 	}
@@ -349,14 +478,39 @@ func (s *databaseService) AppendEvent(ctx context.Context, curSession session.Se
 	return sess.appendEvent(event)
 }
 
+// checkUserEvents returns an error wrapping [session.ErrUserEventsExceeded]
+// if the user can't take one more event under the per-user event limit of
+// the app. Events are only deleted with their session, so the sequences of
+// the sessions of the user add up to its events; they are summed with the
+// primary key index, whose prefix is the app and user. Events appended
+// before sequences were assigned aren't counted.
+func (s *databaseService) checkUserEvents(tx *gorm.DB, t tables, appName, userID string) error {
+	if s.cfg.MaxUserEvents.ForApp(appName) <= 0 {
+		return nil
+	}
+	var count int64
+	err := tx.Table(t.sessions).Where("app_name = ? AND user_id = ?", appName, userID).
+		Select("COALESCE(SUM(event_sequence), 0)").Scan(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to count the events of user: %w", err)
+	}
+	return s.cfg.MaxUserEvents.Check(appName, userID, int(count), 1)
+}
+
 // applyEvent fetches the session, validates it, applies state changes from an
 // event, and saves the event atomically.
 func (s *databaseService) applyEvent(ctx context.Context, session *localSession, event *session.Event) error {
+	t := s.tablesFor(session.AppName())
+	// The event and the session are only changed once the transaction is
+	// committed: a failed attempt, which may be retried, leaves them as
+	// they were, with the directives unresolved and the update time of the
+	// stale session check.
+	stored, updatedAt := *event, session.updatedAt
 	// Wrap database operations in a single transaction.
 	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Fetch the session object from storage.
 		var storageSess storageSession
-		err := tx.Where(&storageSession{AppName: session.AppName(), UserID: session.UserID(), ID: session.ID()}).
+		err := tx.Table(t.sessions).Where(&storageSession{AppName: session.AppName(), UserID: session.UserID(), ID: session.ID()}).
 			First(&storageSess).Error
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -377,58 +531,123 @@ func (s *databaseService) applyEvent(ctx context.Context, session *localSession,
 			)
 		}
 
+		if limit := s.cfg.MaxEvents.ForApp(session.AppName()); limit > 0 {
+			var count int64
+			err := tx.Table(t.events).
+				Where(&storageEvent{AppName: session.AppName(), UserID: session.UserID(), SessionID: session.ID()}).
+				Count(&count).Error
+			if err != nil {
+				return fmt.Errorf("failed to count events: %w", err)
+			}
+			if err := s.cfg.MaxEvents.Check(session.AppName(), session.ID(), int(count), 1); err != nil {
+				return err
+			}
+		}
+		if err := s.checkUserEvents(tx, t, session.AppName(), session.UserID()); err != nil {
+			return err
+		}
+
 		// Fetch App and User states.
-		storageApp, err := fetchStorageAppState(tx, session.AppName())
+		storageApp, err := fetchStorageAppState(tx.Table(t.appStates), session.AppName())
 		if err != nil {
 			return err
 		}
-		storageUser, err := fetchStorageUserState(tx, session.AppName(), session.UserID())
+		storageUser, err := fetchStorageUserState(tx.Table(t.userStates), session.AppName(), session.UserID())
 		if err != nil {
 			return err
 		}
 
-		appDelta, userDelta, sessionDelta := extractStateDeltas(event.Actions.StateDelta)
+		// Resolve state directives inside the transaction, against the
+		// state they are applied to.
+		state := mergeStates(storageApp.State, storageUser.State, storageSess.State)
+		resolved, err := resolveStateDirectives(state, event.Actions.StateDelta)
+		if err != nil {
+			return err
+		}
+		if err := s.cfg.MaxStateKeys.Check(session.AppName(), session.ID(), state, resolved); err != nil {
+			return err
+		}
+		attempt := *event
+		attempt.Actions.StateDelta = resolved
+
+		appDelta, userDelta, sessionDelta := extractStateDeltas(resolved)
 
 		// Merge state deltas and update the storage objects.
 		// GORM's .Save() method will correctly perform an INSERT or UPDATE.
 		if len(appDelta) > 0 {
-			maps.Copy(storageApp.State, appDelta)
-			if err := tx.Save(&storageApp).Error; err != nil {
+			applyStateDelta(storageApp.State, appDelta)
+			if err := tx.Table(t.appStates).Save(&storageApp).Error; err != nil {
 				return fmt.Errorf("failed to save app state: %w", err)
 			}
 		}
 		if len(userDelta) > 0 {
-			maps.Copy(storageUser.State, userDelta)
-			if err := tx.Save(&storageUser).Error; err != nil {
+			applyStateDelta(storageUser.State, userDelta)
+			if err := tx.Table(t.userStates).Save(&storageUser).Error; err != nil {
 				return fmt.Errorf("failed to save user state: %w", err)
 			}
 		}
 		if len(sessionDelta) > 0 {
-			maps.Copy(storageSess.State, sessionDelta)
+			applyStateDelta(storageSess.State, sessionDelta)
 			// The session state update will be saved along with the event timestamp update.
 		}
 
+		// The sequence is saved with the session, the update of the row
+		// serializing the concurrent appends to the session.
+		storageSess.EventSequence++
+		attempt.Sequence = storageSess.EventSequence
+
 		// Create the new event record in the database.
-		storageEv, err := createStorageEvent(session, event)
+		storageEv, err := createStorageEvent(session, &attempt)
 		if err != nil {
 			return fmt.Errorf("failed to map event to storage model: %w", err)
 		}
-		if err := tx.Create(storageEv).Error; err != nil {
+		if err := tx.Table(t.events).Create(storageEv).Error; err != nil {
 			return fmt.Errorf("failed to save event: %w", err)
 		}
 
-		storageSess.UpdateTime = event.Timestamp
+		if s.cfg.AllowUpdatedAtRegression || event.Timestamp.After(storageSess.UpdateTime) {
+			storageSess.UpdateTime = event.Timestamp
+		}
 		// Save the session to update its state and UpdateTime.
-		if err := tx.Save(&storageSess).Error; err != nil {
+		if err := tx.Table(t.sessions).Save(&storageSess).Error; err != nil {
 			return fmt.Errorf("failed to save session state: %w", err)
 		}
 
-		session.updatedAt = storageSess.UpdateTime
-
+		stored, updatedAt = attempt, storageSess.UpdateTime
 		return nil // Returning nil commits the transaction.
 	})
+	if err != nil {
+		return err
+	}
+
+	*event = stored
+	session.updatedAt = updatedAt
+	return nil
+}
 
-	return err
+// applyStateDelta applies the delta to the state. A nil value in the delta
+// deletes the key, like a delete directive.
+func applyStateDelta(state, delta map[string]any) {
+	for key, value := range delta {
+		if value == nil {
+			delete(state, key)
+		} else {
+			state[key] = value
+		}
+	}
+}
+
+// resolveStateDirectives returns the delta with its state directives
+// replaced by the changes they resolve to against the given state.
+func resolveStateDirectives(state, delta map[string]any) (map[string]any, error) {
+	if !session.HasStateDirectives(delta) {
+		return delta, nil
+	}
+	resolved, err := session.ResolveStateDelta(state, delta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve state delta: %w", err)
+	}
+	return resolved, nil
 }
 
 func fetchStorageAppState(tx *gorm.DB, appName string) (*storageAppState, error) {
@@ -15,7 +15,11 @@
 package database
 
 import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"maps"
+	"slices"
 	"strconv"
 	"testing"
 	"time"
@@ -287,11 +291,11 @@ func Test_databaseService_Get(t *testing.T) {
 				AppName: "my_app", UserID: "user", SessionID: "s1",
 			},
 			wantEvents: []*session.Event{
-				{ID: "1", Author: "user", Timestamp: time.Time{}.Add(1 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "2", Author: "user", Timestamp: time.Time{}.Add(2 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), LLMResponse: model.LLMResponse{}},
+				{ID: "1", Author: "user", Timestamp: time.Time{}.Add(1 * time.Microsecond), Sequence: 1, LLMResponse: model.LLMResponse{}},
+				{ID: "2", Author: "user", Timestamp: time.Time{}.Add(2 * time.Microsecond), Sequence: 2, LLMResponse: model.LLMResponse{}},
+				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3 * time.Microsecond), Sequence: 3, LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 		{
@@ -302,9 +306,9 @@ func Test_databaseService_Get(t *testing.T) {
 				NumRecentEvents: 3,
 			},
 			wantEvents: []*session.Event{
-				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), LLMResponse: model.LLMResponse{}},
+				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3 * time.Microsecond), Sequence: 3, LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 		{
@@ -315,8 +319,8 @@ func Test_databaseService_Get(t *testing.T) {
 				After: time.Time{}.Add(4 * time.Microsecond),
 			},
 			wantEvents: []*session.Event{
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 		{
@@ -328,8 +332,8 @@ func Test_databaseService_Get(t *testing.T) {
 				After:           time.Time{}.Add(4 * time.Microsecond),
 			},
 			wantEvents: []*session.Event{
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4 * time.Microsecond), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5 * time.Microsecond), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 	}
@@ -503,7 +507,8 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				sessionID: "session1",
 				events: []*session.Event{
 					{
-						ID: "new_event1",
+						ID:       "new_event1",
+						Sequence: 1,
 						LLMResponse: model.LLMResponse{
 							Partial: false,
 						},
@@ -535,13 +540,15 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				sessionID: "session2",
 				events: []*session.Event{
 					{
-						ID: "existing_event1",
+						ID:       "existing_event1",
+						Sequence: 1,
 						LLMResponse: model.LLMResponse{
 							Partial: false,
 						},
 					},
 					{
-						ID: "new_event1",
+						ID:       "new_event1",
+						Sequence: 2,
 						LLMResponse: model.LLMResponse{
 							Partial: false,
 						},
@@ -595,8 +602,9 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				sessionID: "session1",
 				events: []*session.Event{
 					{
-						ID:     "event_with_bytes",
-						Author: "user",
+						ID:       "event_with_bytes",
+						Sequence: 1,
+						Author:   "user",
 						LLMResponse: model.LLMResponse{
 							Content: genai.NewContentFromBytes([]byte("test_image_data"), "image/png", "user"),
 							GroundingMetadata: &genai.GroundingMetadata{
@@ -625,6 +633,7 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				ID:                 "event_complete",
 				Author:             "user",
 				LongRunningToolIDs: []string{"tool123"},
+				Tags:               map[string]string{"kind": "billing"},
 				Actions:            session.EventActions{StateDelta: map[string]any{"k2": "v2"}},
 				LLMResponse: model.LLMResponse{
 					Content:      genai.NewContentFromText("test_text", "user"),
@@ -656,8 +665,10 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				events: []*session.Event{
 					{
 						ID:                 "event_complete",
+						Sequence:           1,
 						Author:             "user",
 						LongRunningToolIDs: []string{"tool123"},
+						Tags:               map[string]string{"kind": "billing"},
 						Actions:            session.EventActions{StateDelta: map[string]any{"k2": "v2"}},
 						LLMResponse: model.LLMResponse{
 							Content:      genai.NewContentFromText("test_text", "user"),
@@ -766,6 +777,490 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 	}
 }
 
+func Test_databaseService_MaxSessions(t *testing.T) {
+	sessionIDs := func(t *testing.T, s *databaseService, userID string) []string {
+		t.Helper()
+		resp, err := s.List(t.Context(), &session.ListRequest{AppName: "capped_app", UserID: userID})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		var ids []string
+		for _, sess := range resp.Sessions {
+			ids = append(ids, sess.ID())
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		ctx := t.Context()
+		s := emptyService(t)
+		s.cfg.MaxSessions = session.SessionCountLimits{Apps: map[string]session.SessionCountLimit{"capped_app": {MaxPerUser: 2, MaxPerApp: 3}}}
+
+		for _, id := range []string{"s1", "s2"} {
+			if _, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: "u1", SessionID: id}); err != nil {
+				t.Fatalf("Create(%s) error = %v", id, err)
+			}
+		}
+		if _, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: "u1", SessionID: "s3"}); !errors.Is(err, session.ErrTooManySessions) {
+			t.Errorf("Create() past the per-user cap error = %v, want ErrTooManySessions", err)
+		}
+		if _, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: "u2", SessionID: "s1"}); err != nil {
+			t.Errorf("Create() for another user error = %v", err)
+		}
+		if _, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: "u3", SessionID: "s1"}); !errors.Is(err, session.ErrTooManySessions) {
+			t.Errorf("Create() past the per-app cap error = %v, want ErrTooManySessions", err)
+		}
+		if got, want := sessionIDs(t, s, "u1"), []string{"s1", "s2"}; !slices.Equal(got, want) {
+			t.Errorf("sessions of u1 = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("evict oldest idle", func(t *testing.T) {
+		ctx := t.Context()
+		s := emptyService(t)
+		s.cfg.MaxSessions = session.SessionCountLimits{Default: session.SessionCountLimit{MaxPerUser: 2, Eviction: session.SessionEvictionOldestIdle}}
+
+		var first *localSession
+		for _, id := range []string{"s1", "s2"} {
+			created, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: "u1", SessionID: id})
+			if err != nil {
+				t.Fatalf("Create(%s) error = %v", id, err)
+			}
+			if first == nil {
+				first = created.Session.(*localSession)
+			}
+		}
+		// s1 is used again, which leaves s2 the oldest idle session.
+		if err := s.AppendEvent(ctx, first, &session.Event{ID: "event", Timestamp: time.Now().Add(time.Second)}); err != nil {
+			t.Fatalf("AppendEvent() error = %v", err)
+		}
+
+		if _, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: "u1", SessionID: "s3"}); err != nil {
+			t.Fatalf("Create() past the cap error = %v", err)
+		}
+		if got, want := sessionIDs(t, s, "u1"), []string{"s1", "s3"}; !slices.Equal(got, want) {
+			t.Errorf("sessions of u1 = %v, want %v", got, want)
+		}
+		got, err := s.Get(ctx, &session.GetRequest{AppName: "capped_app", UserID: "u1", SessionID: "s1"})
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if got.Session.Events().Len() != 1 {
+			t.Errorf("kept session has %d events, want 1", got.Session.Events().Len())
+		}
+	})
+}
+
+func Test_databaseService_MaxEvents(t *testing.T) {
+	ctx := t.Context()
+	s := emptyService(t)
+	s.cfg.MaxEvents = session.EventCountLimits{Apps: map[string]int{"capped_app": 2}}
+
+	created, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	sess := created.Session.(*localSession)
+	for i := range 3 {
+		err := s.AppendEvent(ctx, sess, &session.Event{ID: fmt.Sprintf("event%d", i), Timestamp: time.Now()})
+		if i < 2 && err != nil {
+			t.Fatalf("AppendEvent() %d error = %v", i, err)
+		}
+		if i == 2 && !errors.Is(err, session.ErrSessionFull) {
+			t.Fatalf("AppendEvent() past the cap error = %v, want ErrSessionFull", err)
+		}
+	}
+
+	got, err := s.Get(ctx, &session.GetRequest{AppName: "capped_app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if n := got.Session.Events().Len(); n != 2 {
+		t.Errorf("got %d stored events, want 2", n)
+	}
+}
+
+func Test_databaseService_MaxStateKeys(t *testing.T) {
+	ctx := t.Context()
+	s := emptyService(t)
+	s.cfg.MaxStateKeys = session.StateKeyLimits{Default: 2}
+
+	created, err := s.Create(ctx, &session.CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: map[string]any{"a": 1}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	sess := created.Session.(*localSession)
+	deltas := []struct {
+		delta   map[string]any
+		wantErr bool
+	}{
+		{delta: map[string]any{"user:b": 2}},
+		{delta: map[string]any{"c": 3}, wantErr: true},
+		// Renaming a key doesn't grow the state.
+		{delta: map[string]any{"a": session.RenameKey{To: "c"}}},
+	}
+	for i, d := range deltas {
+		err := s.AppendEvent(ctx, sess, &session.Event{ID: fmt.Sprintf("event%d", i), Timestamp: time.Now(), Actions: session.EventActions{StateDelta: d.delta}})
+		if d.wantErr && !errors.Is(err, session.ErrStateKeysExceeded) || !d.wantErr && err != nil {
+			t.Fatalf("AppendEvent() %d error = %v, want ErrStateKeysExceeded: %v", i, err, d.wantErr)
+		}
+	}
+
+	got, err := s.Get(ctx, &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if diff := cmp.Diff(map[string]any{"c": float64(1), "user:b": float64(2)}, maps.Collect(got.Session.State().All())); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_databaseService_MaxUserEvents(t *testing.T) {
+	ctx := t.Context()
+	s := emptyService(t)
+	s.cfg.MaxUserEvents = session.UserEventLimits{Apps: map[string]int{"capped_app": 3}}
+
+	sessions := make(map[string]*localSession)
+	for _, key := range [][2]string{{"user", "s1"}, {"user", "s2"}, {"other", "s1"}} {
+		created, err := s.Create(ctx, &session.CreateRequest{AppName: "capped_app", UserID: key[0], SessionID: key[1]})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		sessions[key[0]+"/"+key[1]] = created.Session.(*localSession)
+	}
+	appends := []struct {
+		session string
+		wantErr bool
+	}{
+		{session: "user/s1"},
+		{session: "user/s1"},
+		{session: "user/s2"},
+		// The sessions of the user hold 3 events together.
+		{session: "user/s2", wantErr: true},
+		{session: "user/s1", wantErr: true},
+		// Other users have their own quota.
+		{session: "other/s1"},
+	}
+	for i, a := range appends {
+		err := s.AppendEvent(ctx, sessions[a.session], &session.Event{ID: fmt.Sprintf("event%d", i), Timestamp: time.Now()})
+		if a.wantErr && !errors.Is(err, session.ErrUserEventsExceeded) || !a.wantErr && err != nil {
+			t.Fatalf("AppendEvent() %d to %s error = %v, want ErrUserEventsExceeded: %v", i, a.session, err, a.wantErr)
+		}
+	}
+
+	// Deleting a session of the user frees its events.
+	if err := s.Delete(ctx, &session.DeleteRequest{AppName: "capped_app", UserID: "user", SessionID: "s1"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := s.AppendEvent(ctx, sessions["user/s2"], &session.Event{ID: "after-delete", Timestamp: time.Now()}); err != nil {
+		t.Errorf("AppendEvent() after deleting a session error = %v", err)
+	}
+}
+
+func Test_databaseService_UpdatedAtClockSkew(t *testing.T) {
+	ctx := t.Context()
+	s := emptyService(t)
+
+	created, err := s.Create(ctx, &session.CreateRequest{AppName: "skewed_app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	sess := created.Session.(*localSession)
+	// The clock of the replica stamping the events goes backward.
+	ahead := time.UnixMicro(time.Now().Add(time.Hour).UnixMicro())
+	clock := []time.Time{ahead, ahead.Add(-2 * time.Hour), ahead.Add(time.Hour)}
+	want := []time.Time{ahead, ahead, ahead.Add(time.Hour)}
+	for i, now := range clock {
+		// Every append succeeds: a regressed update time would make the
+		// session look stale to the next one.
+		if err := s.AppendEvent(ctx, sess, &session.Event{ID: fmt.Sprintf("event%d", i), Timestamp: now}); err != nil {
+			t.Fatalf("AppendEvent() %d error = %v", i, err)
+		}
+		if got := sess.LastUpdateTime(); !got.Equal(want[i]) {
+			t.Errorf("after event %d, session LastUpdateTime() = %v, want %v", i, got, want[i])
+		}
+		got, err := s.Get(ctx, &session.GetRequest{AppName: "skewed_app", UserID: "user", SessionID: "session"})
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if got := got.Session.LastUpdateTime(); !got.Equal(want[i]) {
+			t.Errorf("after event %d, stored LastUpdateTime() = %v, want %v", i, got, want[i])
+		}
+	}
+
+	// With regressions allowed, the update time follows the event.
+	s.cfg.AllowUpdatedAtRegression = true
+	behind := ahead.Add(-3 * time.Hour)
+	if err := s.AppendEvent(ctx, sess, &session.Event{ID: "behind", Timestamp: behind}); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+	if got := sess.LastUpdateTime(); !got.Equal(behind) {
+		t.Errorf("session LastUpdateTime() = %v, want %v", got, behind)
+	}
+}
+
+func Test_databaseService_EventSequence(t *testing.T) {
+	ctx := t.Context()
+	s := emptyService(t)
+
+	created, err := s.Create(ctx, &session.CreateRequest{AppName: "seq_app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	sess := created.Session.(*localSession)
+	// The events tie on their timestamp, and their IDs sort in another
+	// order than they are appended.
+	now := time.UnixMicro(time.Now().UnixMicro())
+	ids := []string{"c", "a", "d", "b"}
+	for i, id := range ids {
+		event := &session.Event{ID: id, Timestamp: now}
+		if err := s.AppendEvent(ctx, sess, event); err != nil {
+			t.Fatalf("AppendEvent() %d error = %v", i, err)
+		}
+		if want := int64(i + 1); event.Sequence != want {
+			t.Errorf("event %s has sequence %d, want %d", id, event.Sequence, want)
+		}
+	}
+
+	for _, numRecent := range []int{0, 2} {
+		got, err := s.Get(ctx, &session.GetRequest{AppName: "seq_app", UserID: "user", SessionID: "session", NumRecentEvents: numRecent})
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		wantIDs := ids
+		if numRecent > 0 {
+			wantIDs = ids[len(ids)-numRecent:]
+		}
+		var gotIDs []string
+		var gotSequences []int64
+		for event := range got.Session.Events().All() {
+			gotIDs = append(gotIDs, event.ID)
+			gotSequences = append(gotSequences, event.Sequence)
+		}
+		if diff := cmp.Diff(wantIDs, gotIDs); diff != "" {
+			t.Errorf("Get(NumRecentEvents: %d) event order mismatch (-want +got):\n%s", numRecent, diff)
+		}
+		if !slices.IsSorted(gotSequences) {
+			t.Errorf("Get(NumRecentEvents: %d) sequences %v are not increasing", numRecent, gotSequences)
+		}
+	}
+}
+
+func Test_databaseService_Namespaces(t *testing.T) {
+	ctx := t.Context()
+	cfg := ServiceConfig{Namespaces: AppNamespaces{
+		Default: "shared_",
+		Apps:    map[string]string{"app_a": "tenant_a_", "app_b": "tenant_b_"},
+	}}
+	service, err := NewSessionServiceWithConfig(sqlite.Open("file:namespaces?mode=memory&cache=shared"), cfg)
+	if err != nil {
+		t.Fatalf("Failed to create session service: %v", err)
+	}
+	if err := AutoMigrate(service); err != nil {
+		t.Fatalf("Failed to AutoMigrate db: %v", err)
+	}
+	s := service.(*databaseService)
+
+	for _, appName := range []string{"app_a", "app_b", "app_c"} {
+		created, err := s.Create(ctx, &session.CreateRequest{
+			AppName:   appName,
+			UserID:    "user",
+			SessionID: "session",
+			State:     map[string]any{"owner": appName, "app:owner": appName},
+		})
+		if err != nil {
+			t.Fatalf("Create(%q) error = %v", appName, err)
+		}
+		event := &session.Event{ID: "event", Timestamp: time.Now(), Actions: session.EventActions{StateDelta: map[string]any{"user:owner": appName}}}
+		if err := s.AppendEvent(ctx, created.Session, event); err != nil {
+			t.Fatalf("AppendEvent(%q) error = %v", appName, err)
+		}
+	}
+
+	for _, namespace := range []string{"tenant_a_", "tenant_b_", "shared_"} {
+		tables := namespaceTables(namespace)
+		for _, table := range []string{tables.sessions, tables.events, tables.appStates, tables.userStates} {
+			var count int64
+			if err := s.db.Table(table).Count(&count).Error; err != nil {
+				t.Fatalf("counting rows of %s: %v", table, err)
+			}
+			if count != 1 {
+				t.Errorf("table %s has %d rows, want 1", table, count)
+			}
+		}
+	}
+	if s.db.Migrator().HasTable("sessions") {
+		t.Errorf("the unprefixed sessions table exists, want every app in a namespace")
+	}
+
+	for _, appName := range []string{"app_a", "app_b", "app_c"} {
+		got, err := s.Get(ctx, &session.GetRequest{AppName: appName, UserID: "user", SessionID: "session"})
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", appName, err)
+		}
+		wantState := map[string]any{"owner": appName, "app:owner": appName, "user:owner": appName}
+		if diff := cmp.Diff(wantState, maps.Collect(got.Session.State().All())); diff != "" {
+			t.Errorf("Get(%q) state mismatch (-want +got):\n%s", appName, diff)
+		}
+		if n := got.Session.Events().Len(); n != 1 {
+			t.Errorf("Get(%q) got %d events, want 1", appName, n)
+		}
+	}
+
+	if err := s.Delete(ctx, &session.DeleteRequest{AppName: "app_a", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	listed, err := s.List(ctx, &session.ListRequest{AppName: "app_b"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if n := len(listed.Sessions); n != 1 {
+		t.Errorf("List() of app_b after deleting the session of app_a got %d sessions, want 1", n)
+	}
+}
+
+func Test_databaseService_InvalidNamespace(t *testing.T) {
+	cfg := ServiceConfig{Namespaces: AppNamespaces{Apps: map[string]string{"app": "tenant; DROP TABLE sessions"}}}
+	if _, err := NewSessionServiceWithConfig(sqlite.Open("file::memory:"), cfg); err == nil {
+		t.Errorf("NewSessionServiceWithConfig() with an invalid namespace succeeded, want error")
+	}
+}
+
+// codedError is a driver error with a result code, like the ones of the
+// SQLite drivers.
+type codedError int
+
+func (e codedError) Error() string { return fmt.Sprintf("driver error %d", int(e)) }
+func (e codedError) Code() int     { return int(e) }
+
+// stateError is a driver error with a SQLSTATE, like the ones of the
+// PostgreSQL driver.
+type stateError string
+
+func (e stateError) Error() string    { return "driver error " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+func Test_isTransientDBError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{gorm.ErrRecordNotFound, false},
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("query: %w", driver.ErrBadConn), true},
+		{codedError(5), true},        // SQLITE_BUSY
+		{codedError(6), true},        // SQLITE_LOCKED
+		{codedError(5 | 2<<8), true}, // SQLITE_BUSY_SNAPSHOT
+		{codedError(19), false},      // SQLITE_CONSTRAINT
+		{stateError("40001"), true},  // serialization_failure
+		{stateError("40P01"), true},  // deadlock_detected
+		{stateError("08006"), true},  // connection_failure
+		{stateError("23505"), false}, // unique_violation
+	}
+	for _, tt := range tests {
+		if got := isTransientDBError(tt.err); got != tt.want {
+			t.Errorf("isTransientDBError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func Test_databaseService_TransientErrors(t *testing.T) {
+	s := emptyService(t)
+	if _, err := s.Create(t.Context(), &session.CreateRequest{AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+	var fail error
+	if err := s.db.Callback().Query().Before("gorm:query").Register("test:fail", func(tx *gorm.DB) {
+		if fail != nil {
+			_ = tx.AddError(fail)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fail = codedError(5)
+	_, err := s.Get(t.Context(), &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if !session.IsTransient(err) || !errors.Is(err, codedError(5)) {
+		t.Errorf("Get() with a busy database error = %v, want a transient error wrapping it", err)
+	}
+
+	fail = codedError(19)
+	_, err = s.Get(t.Context(), &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err == nil || session.IsTransient(err) {
+		t.Errorf("Get() with a constraint error = %v, want a permanent error", err)
+	}
+
+	// Retries recover from the transient failure.
+	retrying := session.ServiceWithRetries(s, session.RetryConfig{InitialBackoff: time.Millisecond})
+	fail = codedError(6)
+	attempts := 0
+	if err := s.db.Callback().Query().Before("test:fail").Register("test:recover", func(*gorm.DB) {
+		if attempts++; attempts > 1 {
+			fail = nil
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retrying.Get(t.Context(), &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Errorf("Get() with retries = %v, want success", err)
+	}
+}
+
+func Test_databaseService_TransientAppendLeavesEventUnchanged(t *testing.T) {
+	ctx := t.Context()
+	s := emptyService(t)
+	created, err := s.Create(ctx, &session.CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: map[string]any{"a": "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := created.Session.(*localSession)
+	updatedAt := sess.updatedAt
+	// The event insert fails once, after the directives are resolved and
+	// the session row is read.
+	failures := 1
+	if err := s.db.Callback().Create().Before("gorm:create").Register("test:fail", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(*storageEvent); ok && failures > 0 {
+			failures--
+			_ = tx.AddError(codedError(5))
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := &session.Event{
+		ID:        "event1",
+		Timestamp: time.Now(),
+		Actions:   session.EventActions{StateDelta: map[string]any{"b": session.CopyKey{From: "a"}}},
+	}
+	if err := s.AppendEvent(ctx, sess, event); !session.IsTransient(err) {
+		t.Fatalf("AppendEvent() error = %v, want a transient error", err)
+	}
+	if _, ok := event.Actions.StateDelta["b"].(session.CopyKey); !ok || event.Sequence != 0 {
+		t.Errorf("event after the failed attempt = %+v, want its directive unresolved and no sequence", event)
+	}
+	if !sess.updatedAt.Equal(updatedAt) {
+		t.Errorf("session update time after the failed attempt = %v, want %v", sess.updatedAt, updatedAt)
+	}
+
+	// A concurrent writer changes the state the directive is resolved
+	// against, the retry copies the new value.
+	other, err := s.Get(ctx, &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, other.Session, &session.Event{ID: "event0", Timestamp: time.Now(), Actions: session.EventActions{StateDelta: map[string]any{"a": "2"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, other.Session, event); err != nil {
+		t.Fatalf("AppendEvent() retry error = %v", err)
+	}
+	if got := event.Actions.StateDelta["b"]; got != "2" {
+		t.Errorf("delta of the retried event b = %v, want 2", got)
+	}
+}
+
 func Test_databaseService_StateManagement(t *testing.T) {
 	ctx := t.Context()
 	appName := "my_app"
@@ -80,8 +80,8 @@ func (s *localSession) appendEvent(event *session.Event) error {
 		return fmt.Errorf("failed to update localSession state: %w", err)
 	}
 
+	// updatedAt is already set by applyEvent to the stored update time.
 	s.events = append(s.events, event)
-	s.updatedAt = event.Timestamp
 	return nil
 }
 
@@ -184,7 +184,11 @@ func updateSessionState(sess *localSession, event *session.Event) error {
 		if strings.HasPrefix(key, session.KeyPrefixTemp) {
 			continue
 		}
-		sess.state[key] = value
+		if value == nil {
+			delete(sess.state, key)
+		} else {
+			sess.state[key] = value
+		}
 	}
 
 	return nil
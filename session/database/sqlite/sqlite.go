@@ -0,0 +1,115 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite provides a durable [session.Service] stored in a single
+// SQLite database file, for deployments without a database server.
+//
+// It is the database session service of package
+// [google.golang.org/adk/session/database] preconfigured for SQLite: the
+// state is stored as JSON and the events in their own table. The SQLite
+// driver is pure Go, so no cgo toolchain is needed.
+//
+// The service is pluggable through the [session.Service] interface, like
+// the other backends; this package adds no store interface of its own.
+// State deltas, delete directives included, are resolved against the state
+// read by the transaction appending the event, and the JSON of the changed
+// states is written whole: the same code then runs on every database, and
+// the resolution checks the directives against the state they apply to,
+// which SQLite's JSON functions can't do.
+//
+// # Crash recovery
+//
+// Every mutation, such as appending an event together with its state delta,
+// is a single transaction. The database runs in write-ahead logging mode: a
+// transaction is recorded in the log next to the database file, and only
+// copied into the database file once committed. When the database is
+// opened after a crash, SQLite replays the committed transactions of the log
+// and discards the uncommitted ones, so a crash in the middle of a patch
+// leaves the state as it was before the patch rather than half-written.
+package sqlite
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/session/database"
+)
+
+// Config contains optional settings of the SQLite session service.
+// The zero value is a valid config.
+type Config struct {
+	// Service contains the settings shared with the other database backends.
+	Service database.ServiceConfig
+	// BusyTimeout is how long a writer waits for another writer to finish
+	// before failing. Defaults to 5 seconds.
+	BusyTimeout time.Duration
+	// RelaxedSync stops waiting for the write-ahead log to reach the disk
+	// on every commit, which makes writes faster. Committed writes still
+	// survive a crash of the process, but the last ones can be lost on a
+	// power failure or an operating system crash.
+	// By default every commit is synced to the disk.
+	RelaxedSync bool
+}
+
+// NewSessionService opens, or creates, the SQLite database at path and
+// returns a [session.Service] storing the sessions in it. The schema is
+// migrated on open.
+//
+// The database uses write-ahead logging, so reads run concurrently with a
+// write, and transactions take the write lock when they begin, so that
+// concurrent writers queue up for BusyTimeout instead of failing to upgrade
+// a read lock.
+func NewSessionService(path string, cfg Config) (session.Service, error) {
+	return newSessionService(path, cfg, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
+func newSessionService(path string, cfg Config, gormConfig *gorm.Config) (session.Service, error) {
+	if path == "" {
+		return nil, fmt.Errorf("database path is required")
+	}
+	if cfg.BusyTimeout <= 0 {
+		cfg.BusyTimeout = 5 * time.Second
+	}
+	service, err := database.NewSessionServiceWithConfig(sqlite.Open(dsn(path, cfg)), cfg.Service, gormConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.AutoMigrate(service); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// dsn returns the data source name opening the database at path with the
+// settings of cfg.
+func dsn(path string, cfg Config) string {
+	query := url.Values{}
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", cfg.BusyTimeout.Milliseconds()))
+	if cfg.RelaxedSync {
+		query.Add("_pragma", "synchronous(NORMAL)")
+	} else {
+		query.Add("_pragma", "synchronous(FULL)")
+	}
+	query.Set("_txlock", "immediate")
+	return "file:" + path + "?" + query.Encode()
+}
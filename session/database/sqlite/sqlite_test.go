@@ -0,0 +1,260 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"google.golang.org/adk/session"
+)
+
+func TestNewSessionService_Durable(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "sessions.db")
+
+	service, err := NewSessionService(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := service.Create(ctx, &session.CreateRequest{
+		AppName:   "app",
+		UserID:    "user",
+		SessionID: "session",
+		State:     map[string]any{"kept": "v", "removed": "v"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := session.NewEvent("invocation")
+	event.Author = "user"
+	// A nil value is a delete directive.
+	event.Actions.StateDelta = map[string]any{"removed": nil, "added": float64(1)}
+	if err := service.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session survives reopening the database.
+	reopened, err := NewSessionService(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(ctx, &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Session.Events().Len(); n != 1 {
+		t.Errorf("got %d events, want 1", n)
+	}
+	for key, want := range map[string]any{"kept": "v", "added": float64(1)} {
+		if v, err := got.Session.State().Get(key); err != nil || v != want {
+			t.Errorf("state %q = %v, %v, want %v", key, v, err, want)
+		}
+	}
+	if _, err := got.Session.State().Get("removed"); err == nil {
+		t.Errorf("deleted state key %q is still present", "removed")
+	}
+}
+
+func TestNewSessionService_ConcurrentWriters(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	service, err := NewSessionService(path, Config{BusyTimeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, events = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := service.Create(ctx, &session.CreateRequest{AppName: "app", UserID: "user", SessionID: fmt.Sprintf("s%d", w)})
+			if err != nil {
+				errs <- err
+				return
+			}
+			for i := range events {
+				event := session.NewEvent("invocation")
+				event.Author = "user"
+				// Every writer also updates the shared app state row.
+				event.Actions.StateDelta = map[string]any{"n": float64(i), "app:last": w}
+				if err := service.AppendEvent(ctx, created.Session, event); err != nil {
+					errs <- fmt.Errorf("writer %d, event %d: %w", w, i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for w := range writers {
+		got, err := service.Get(ctx, &session.GetRequest{AppName: "app", UserID: "user", SessionID: fmt.Sprintf("s%d", w)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := got.Session.Events().Len(); n != events {
+			t.Errorf("session s%d has %d events, want %d", w, n, events)
+		}
+		if n, _ := got.Session.State().Get("n"); n != float64(events-1) {
+			t.Errorf("session s%d has n = %v, want %d", w, n, events-1)
+		}
+	}
+}
+
+func TestNewSessionService_RequiresPath(t *testing.T) {
+	if _, err := NewSessionService("", Config{}); err == nil {
+		t.Error("NewSessionService(\"\") succeeded, want error")
+	}
+}
+
+// crashSnapshot is a gorm plugin which copies the database files, as a crash
+// would leave them on disk, right after the session row is updated inside
+// the transaction appending an event.
+type crashSnapshot struct {
+	path, dir string
+}
+
+func (crashSnapshot) Name() string { return "crashSnapshot" }
+
+func (p crashSnapshot) Initialize(db *gorm.DB) error {
+	return db.Callback().Update().After("gorm:update").Register("crash_snapshot", func(tx *gorm.DB) {
+		if tx.Statement.Table != "sessions" || tx.Error != nil {
+			return
+		}
+		if err := copyDatabase(p.path, filepath.Join(p.dir, filepath.Base(p.path))); err != nil {
+			_ = tx.AddError(err)
+		}
+	})
+}
+
+// copyDatabase copies the database file and its write-ahead log, if any.
+func copyDatabase(from, to string) error {
+	for _, suffix := range []string{"", "-wal"} {
+		data, err := os.ReadFile(from + suffix)
+		if errors.Is(err, fs.ErrNotExist) && suffix != "" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(to+suffix, data, 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestNewSessionService_CrashBeforeCommit(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	crashDir := t.TempDir()
+	service, err := newSessionService(path, Config{}, &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		Plugins: map[string]gorm.Plugin{"crashSnapshot": crashSnapshot{path: path, dir: crashDir}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := service.Create(ctx, &session.CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: map[string]any{"step": float64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := session.NewEvent("invocation")
+	event.Author = "user"
+	event.Actions.StateDelta = map[string]any{"step": float64(2), "user:seen": true}
+	if err := service.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the files as they were in the middle of the transaction
+	// recovers the state from before the patch, not a half-written one.
+	recovered, err := NewSessionService(filepath.Join(crashDir, filepath.Base(path)), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := recovered.Get(ctx, &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Session.Events().Len(); n != 0 {
+		t.Errorf("recovered session has %d events, want none", n)
+	}
+	if step, _ := got.Session.State().Get("step"); step != float64(1) {
+		t.Errorf("recovered step = %v, want the value before the patch, 1", step)
+	}
+	if _, err := got.Session.State().Get("user:seen"); err == nil {
+		t.Errorf("recovered state has the user key of the uncommitted patch")
+	}
+}
+
+func TestNewSessionService_RecoverCommitted(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	crashDir := t.TempDir()
+	service, err := NewSessionService(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := service.Create(ctx, &session.CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: map[string]any{"step": float64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := session.NewEvent("invocation")
+	event.Author = "user"
+	event.Actions.StateDelta = map[string]any{"step": float64(2)}
+	if err := service.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatal(err)
+	}
+	// Crash right after the commit, before the log is checkpointed into
+	// the database file.
+	crashPath := filepath.Join(crashDir, "sessions.db")
+	if err := copyDatabase(path, crashPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(crashPath + "-wal"); err != nil {
+		t.Fatalf("no write-ahead log to recover from: %v", err)
+	}
+
+	recovered, err := NewSessionService(crashPath, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := recovered.Get(ctx, &session.GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Session.Events().Len(); n != 1 {
+		t.Errorf("recovered session has %d events, want 1", n)
+	}
+	if step, _ := got.Session.State().Get("step"); step != float64(2) {
+		t.Errorf("recovered step = %v, want the committed value, 2", step)
+	}
+}
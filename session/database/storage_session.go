@@ -33,6 +33,9 @@ type storageSession struct {
 	State      stateMap
 	CreateTime time.Time `gorm:"precision:6"`
 	UpdateTime time.Time `gorm:"precision:6"`
+	// EventSequence is the sequence of the last event appended to the
+	// session.
+	EventSequence int64
 
 	// Has-Many relationship: A session has many events.
 	Events []storageEvent `gorm:"foreignKey:AppName,UserID,SessionID;references:AppName,UserID,ID"`
@@ -81,6 +84,9 @@ type storageEvent struct {
 	LongRunningToolIDsJSON dynamicJSON
 	Branch                 *string
 	Timestamp              time.Time `gorm:"precision:6"`
+	// Sequence is zero for the events appended before sequences were
+	// assigned.
+	Sequence int64
 
 	// Fields from llm_response
 	Content           dynamicJSON
@@ -88,6 +94,7 @@ type storageEvent struct {
 	CustomMetadata    dynamicJSON
 	UsageMetadata     dynamicJSON
 	CitationMetadata  dynamicJSON
+	Tags              dynamicJSON
 
 	Partial      *bool
 	TurnComplete *bool
@@ -116,6 +123,7 @@ func createStorageEvent(session session.Session, event *session.Event) (*storage
 		AppName:      session.AppName(),
 		UserID:       session.UserID(),
 		Timestamp:    event.Timestamp,
+		Sequence:     event.Sequence,
 	}
 
 	// --- Handle complex or nullable fields ---
@@ -183,6 +191,12 @@ func createStorageEvent(session session.Session, event *session.Event) (*storage
 			return nil, fmt.Errorf("failed to marshal citation metadata: %w", err)
 		}
 	}
+	if len(event.Tags) > 0 {
+		storageEv.Tags, err = json.Marshal(event.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tags: %w", err)
+		}
+	}
 
 	return storageEv, nil
 }
@@ -242,6 +256,13 @@ func createEventFromStorageEvent(se *storageEvent) (*session.Event, error) {
 		}
 	}
 
+	var tags map[string]string
+	if len(se.Tags) > 0 {
+		if err := json.Unmarshal(se.Tags, &tags); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tags: %w", err)
+		}
+	}
+
 	// --- Handle JSON-encoded *string field ---
 	var toolIDs []string
 	if se.LongRunningToolIDsJSON != nil {
@@ -265,9 +286,11 @@ func createEventFromStorageEvent(se *storageEvent) (*session.Event, error) {
 		InvocationID:       se.InvocationID,
 		Author:             se.Author,
 		Timestamp:          se.Timestamp,
+		Sequence:           se.Sequence,
 		Actions:            actions,
 		LongRunningToolIDs: toolIDs,
 		Branch:             branch,
+		Tags:               tags,
 		LLMResponse: model.LLMResponse{
 			Content:           content,
 			GroundingMetadata: groundingMetadata,
@@ -0,0 +1,603 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// StateDirective is a value of a state delta which depends on the current
+// state of the session. Service implementations resolve directives with
+// [ResolveStateDelta] while holding the lock under which the delta is
+// applied, so read-modify-write operations don't race with other writers.
+type StateDirective interface {
+	// Resolve returns the changes the directive makes when set for key,
+	// given the current state. A nil value in the returned map deletes
+	// the corresponding key.
+	Resolve(key string, state map[string]any) (map[string]any, error)
+}
+
+// ErrStateDirectiveFailed is returned, wrapped, by [ResolveStateDelta] when
+// a delta can't be applied to the current state.
+var ErrStateDirectiveFailed = errors.New("state directive failed")
+
+// ResolveStateDelta returns a copy of delta in which every [StateDirective]
+// is replaced by the concrete changes it resolves to against state.
+// Directives are resolved against the same state, independently of each
+// other, so the result does not depend on the iteration order of delta.
+// It returns an error if a directive fails or if two entries of the delta
+// change the same key.
+func ResolveStateDelta(state, delta map[string]any) (map[string]any, error) {
+	resolved := make(map[string]any, len(delta))
+	// owner tracks which entry of the delta changes a key, to report conflicts.
+	owner := make(map[string]string, len(delta))
+	set := func(from, key string, value any) error {
+		if prev, ok := owner[key]; ok && prev != from {
+			a, b := min(prev, from), max(prev, from)
+			return fmt.Errorf("%w: state delta entries %q and %q both change key %q", ErrStateDirectiveFailed, a, b, key)
+		}
+		owner[key] = from
+		resolved[key] = value
+		return nil
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(delta)) {
+		directive, ok := delta[key].(StateDirective)
+		if !ok {
+			if err := set(key, key, delta[key]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		changes, err := directive.Resolve(key, state)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrStateDirectiveFailed, err)
+		}
+		for _, changedKey := range slices.Sorted(maps.Keys(changes)) {
+			if err := set(key, changedKey, changes[changedKey]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// HasStateDirectives reports whether the delta contains a [StateDirective].
+func HasStateDirectives(delta map[string]any) bool {
+	for _, value := range delta {
+		if _, ok := value.(StateDirective); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StateChangeOutcome is what an entry of a state delta does to the state,
+// see [EvaluateStateDelta].
+type StateChangeOutcome string
+
+const (
+	// StateChangeApplied is the outcome of an entry changing the value of
+	// at least one key.
+	StateChangeApplied StateChangeOutcome = "applied"
+	// StateChangeNoop is the outcome of an entry leaving the state as it
+	// is, such as a SetIf whose predicate doesn't hold, a value equal to the
+	// current one or the deletion of an absent key.
+	StateChangeNoop StateChangeOutcome = "noop"
+	// StateChangeFailed is the outcome of an entry whose directive fails
+	// against the state.
+	StateChangeFailed StateChangeOutcome = "error"
+)
+
+// StateDeltaEntryOutcome is the outcome of an entry of a state delta.
+type StateDeltaEntryOutcome struct {
+	Outcome StateChangeOutcome
+	// ChangedKeys are the keys the entry changes the value of, sorted.
+	ChangedKeys []string
+	// Err is the error of a failed entry.
+	Err error
+}
+
+// EvaluateStateDelta returns the outcome of every entry of the delta,
+// comparing the values of the keys it changes before and after. Every
+// entry is resolved on its own against state, like [ResolveStateDelta]
+// does, so that the entries which would fail are reported along with the
+// others rather than failing the evaluation.
+func EvaluateStateDelta(state, delta map[string]any) map[string]StateDeltaEntryOutcome {
+	outcomes := make(map[string]StateDeltaEntryOutcome, len(delta))
+	for key, value := range delta {
+		changes := map[string]any{key: value}
+		if directive, ok := value.(StateDirective); ok {
+			var err error
+			if changes, err = directive.Resolve(key, state); err != nil {
+				outcomes[key] = StateDeltaEntryOutcome{Outcome: StateChangeFailed, Err: err}
+				continue
+			}
+		}
+		outcome := StateDeltaEntryOutcome{Outcome: StateChangeNoop}
+		for _, changedKey := range slices.Sorted(maps.Keys(changes)) {
+			if keyUnchanged(state, changedKey, changes[changedKey]) {
+				continue
+			}
+			outcome.Outcome = StateChangeApplied
+			outcome.ChangedKeys = append(outcome.ChangedKeys, changedKey)
+		}
+		outcomes[key] = outcome
+	}
+	return outcomes
+}
+
+// IsNoopStateDelta reports whether applying the delta leaves state as it
+// is, comparing the state before and after the resolved delta is applied.
+// An empty delta is a no-op, and so is one which only changes temporary
+// keys, which aren't stored. It returns an error if a directive of the
+// delta fails against state.
+func IsNoopStateDelta(state, delta map[string]any) (bool, error) {
+	resolved, err := ResolveStateDelta(state, delta)
+	if err != nil {
+		return false, err
+	}
+	for key, after := range resolved {
+		if !strings.HasPrefix(key, KeyPrefixTemp) && !keyUnchanged(state, key, after) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// keyUnchanged reports whether setting the key to after, or deleting it if
+// after is nil, leaves state as it is.
+func keyUnchanged(state map[string]any, key string, after any) bool {
+	before, exists := state[key]
+	return !exists && after == nil || exists && after != nil && valuesEqual(before, after)
+}
+
+// RenameKey is a [StateDirective] which moves the value of the key it is
+// set for to the key To.
+type RenameKey struct {
+	// To is the new name of the key.
+	To string
+	// IgnoreMissing makes the rename a no-op when the key is absent.
+	// By default an absent key is an error.
+	IgnoreMissing bool
+	// Overwrite allows replacing an existing value of To.
+	// By default an existing target is an error.
+	Overwrite bool
+}
+
+// Resolve implements [StateDirective].
+func (r RenameKey) Resolve(key string, state map[string]any) (map[string]any, error) {
+	if r.To == "" {
+		return nil, fmt.Errorf("rename of key %q: target key is required", key)
+	}
+	if r.To == key {
+		return nil, fmt.Errorf("rename of key %q: target key is the same as the source", key)
+	}
+	value, ok := state[key]
+	if !ok {
+		if r.IgnoreMissing {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("rename of key %q: %w", key, ErrStateKeyNotExist)
+	}
+	if _, exists := state[r.To]; exists && !r.Overwrite {
+		return nil, fmt.Errorf("rename of key %q: target key %q already exists", key, r.To)
+	}
+	return map[string]any{key: nil, r.To: value}, nil
+}
+
+// CopyKey is a [StateDirective] which sets the key it is set for to a deep
+// copy of the value of the key From, so later changes of either value don't
+// affect the other.
+type CopyKey struct {
+	// From is the key whose value is copied.
+	From string
+}
+
+// Resolve implements [StateDirective].
+func (c CopyKey) Resolve(key string, state map[string]any) (map[string]any, error) {
+	if c.From == "" {
+		return nil, fmt.Errorf("copy to key %q: source key is required", key)
+	}
+	if c.From == key {
+		return nil, fmt.Errorf("copy to key %q: source key is the same as the target", key)
+	}
+	value, ok := state[c.From]
+	if !ok {
+		return nil, fmt.Errorf("copy to key %q from %q: %w", key, c.From, ErrStateKeyNotExist)
+	}
+	return map[string]any{key: deepCopy(value)}, nil
+}
+
+// SwapKeys is a [StateDirective] which exchanges the values of the key it
+// is set for and the key With. An absent key counts as a nil value, so
+// swapping with an absent key moves the value and makes the other key
+// absent.
+type SwapKeys struct {
+	// With is the key exchanging its value with the directive's key.
+	With string
+}
+
+// Resolve implements [StateDirective].
+func (w SwapKeys) Resolve(key string, state map[string]any) (map[string]any, error) {
+	if w.With == "" {
+		return nil, fmt.Errorf("swap of key %q: other key is required", key)
+	}
+	if w.With == key {
+		return nil, fmt.Errorf("swap of key %q: other key is the same key", key)
+	}
+	return map[string]any{key: state[w.With], w.With: state[key]}, nil
+}
+
+// CompareOp is a comparison operator of a [Predicate].
+type CompareOp string
+
+// Comparison operators of a [Predicate]. Eq and Neq compare any values, the
+// ordering operators compare numbers with numbers and strings with strings.
+const (
+	OpEq  CompareOp = "eq"
+	OpNeq CompareOp = "neq"
+	OpGt  CompareOp = "gt"
+	OpGte CompareOp = "gte"
+	OpLt  CompareOp = "lt"
+	OpLte CompareOp = "lte"
+)
+
+// Predicate compares the current value of a state key with Value.
+type Predicate struct {
+	Key   string
+	Op    CompareOp
+	Value any
+}
+
+// Validate returns an error if the predicate can't be evaluated.
+func (p Predicate) Validate() error {
+	if p.Key == "" {
+		return fmt.Errorf("predicate key is required")
+	}
+	switch p.Op {
+	case OpEq, OpNeq, OpGt, OpGte, OpLt, OpLte:
+		return nil
+	default:
+		return fmt.Errorf("unsupported predicate operator %q", p.Op)
+	}
+}
+
+// Eval reports whether the predicate holds for the state. An absent key
+// counts as a nil value for Eq and Neq, and fails the ordering operators.
+// Numbers compare by value regardless of their Go type.
+func (p Predicate) Eval(state map[string]any) (bool, error) {
+	if err := p.Validate(); err != nil {
+		return false, err
+	}
+	current, ok := state[p.Key]
+	switch p.Op {
+	case OpEq:
+		return valuesEqual(current, p.Value), nil
+	case OpNeq:
+		return !valuesEqual(current, p.Value), nil
+	}
+	if !ok {
+		return false, nil
+	}
+	c, err := compareValues(current, p.Value)
+	if err != nil {
+		return false, fmt.Errorf("predicate on key %q: %w", p.Key, err)
+	}
+	switch p.Op {
+	case OpGt:
+		return c > 0, nil
+	case OpGte:
+		return c >= 0, nil
+	case OpLt:
+		return c < 0, nil
+	default: // OpLte
+		return c <= 0, nil
+	}
+}
+
+// valuesEqual reports whether a and b are deeply equal, comparing numbers by
+// value so that for instance int 1 equals float64 1.
+func valuesEqual(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues returns -1, 0 or +1 depending on whether a is less than,
+// equal to or greater than b. They must both be numbers or both strings.
+func compareValues(a, b any) (int, error) {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return cmp.Compare(x, y), nil
+		}
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return cmp.Compare(x, y), nil
+		}
+	}
+	return 0, fmt.Errorf("can't order %T and %T values", a, b)
+}
+
+// toFloat converts numbers of any Go type to a float64.
+func toFloat(v any) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// SetIf is a [StateDirective] which sets the key it is set for to Value when
+// the predicate When holds, and changes nothing otherwise. The predicate is
+// evaluated under the same lock the change is applied under, so there is no
+// window for another writer between the check and the write.
+type SetIf struct {
+	When Predicate
+	// Value is the new value of the key, nil deletes it.
+	Value any
+}
+
+// Resolve implements [StateDirective].
+func (s SetIf) Resolve(key string, state map[string]any) (map[string]any, error) {
+	ok, err := s.When.Eval(state)
+	if err != nil {
+		return nil, fmt.Errorf("conditional set of key %q: %w", key, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return map[string]any{key: s.Value}, nil
+}
+
+// KeepMin is a [StateDirective] which sets the key it is set for to Value
+// if Value is lower than the current value, or if the key is absent. The
+// current value and Value must be numbers.
+type KeepMin struct {
+	Value any
+}
+
+// Resolve implements [StateDirective].
+func (m KeepMin) Resolve(key string, state map[string]any) (map[string]any, error) {
+	return resolveExtremum("min", key, state, m.Value, -1)
+}
+
+// KeepMax is a [StateDirective] which sets the key it is set for to Value
+// if Value is higher than the current value, or if the key is absent. The
+// current value and Value must be numbers.
+type KeepMax struct {
+	Value any
+}
+
+// Resolve implements [StateDirective].
+func (m KeepMax) Resolve(key string, state map[string]any) (map[string]any, error) {
+	return resolveExtremum("max", key, state, m.Value, +1)
+}
+
+// resolveExtremum sets key to value if the key is absent or if comparing
+// value with the current value gives want.
+func resolveExtremum(name, key string, state map[string]any, value any, want int) (map[string]any, error) {
+	v, ok := toFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("%s of key %q: value must be a number, got %T", name, key, value)
+	}
+	current, ok := state[key]
+	if !ok {
+		return map[string]any{key: value}, nil
+	}
+	c, ok := toFloat(current)
+	if !ok {
+		return nil, fmt.Errorf("%s of key %q: current value must be a number, got %T", name, key, current)
+	}
+	if cmp.Compare(v, c) != want {
+		return nil, nil
+	}
+	return map[string]any{key: value}, nil
+}
+
+// AddUnique is a [StateDirective] which appends Value to the slice held by
+// the key it is set for, unless an equal element is already present. An
+// absent key is set to a slice holding only Value; a key holding anything
+// but a slice is an error.
+//
+// Elements equal Value if they are numbers of the same value, whatever their
+// Go types, or if they are deeply equal otherwise. Maps and slices are
+// compared with [reflect.DeepEqual], so the numbers they hold must also have
+// the same Go types: {"n": 1} equals {"n": 1} decoded from JSON, but not an
+// int constructed in Go as map[string]any{"n": 1}.
+type AddUnique struct {
+	Value any
+}
+
+// Resolve implements [StateDirective].
+func (a AddUnique) Resolve(key string, state map[string]any) (map[string]any, error) {
+	current, ok := state[key]
+	if !ok || current == nil {
+		return map[string]any{key: []any{a.Value}}, nil
+	}
+	slice := reflect.ValueOf(current)
+	if slice.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("addUnique to key %q: current value must be a slice, got %T", key, current)
+	}
+	for i := range slice.Len() {
+		if valuesEqual(slice.Index(i).Interface(), a.Value) {
+			return nil, nil
+		}
+	}
+	elem := reflect.ValueOf(a.Value)
+	if a.Value == nil {
+		elem = reflect.Zero(slice.Type().Elem())
+	}
+	if !elem.Type().AssignableTo(slice.Type().Elem()) {
+		return nil, fmt.Errorf("addUnique to key %q: can't add a %T value to a %T", key, a.Value, current)
+	}
+	// The stored slice is copied rather than appended to, so that it isn't
+	// changed before the delta is applied.
+	added := reflect.MakeSlice(slice.Type(), slice.Len(), slice.Len()+1)
+	reflect.Copy(added, slice)
+	return map[string]any{key: reflect.Append(added, elem).Interface()}, nil
+}
+
+// MergeValue is a [StateDirective] which merges the object Value into the
+// object held by the key it is set for, or into the object Path points to
+// within it. The merge follows JSON Merge Patch (RFC 7386): the members of
+// Value replace the ones of the target, objects are merged recursively and
+// nil members remove the target's.
+//
+// An absent key, and the absent objects along Path, are created. An
+// intermediate value of Path, or a target, which is not an object is an
+// error.
+type MergeValue struct {
+	// Path holds the reference tokens of the JSON Pointer of the target
+	// within the value of the key. Optional: by default the value of the
+	// key itself is the target.
+	Path  []string
+	Value map[string]any
+}
+
+// Resolve implements [StateDirective].
+func (m MergeValue) Resolve(key string, state map[string]any) (map[string]any, error) {
+	merged, err := mergeAt(state[key], m.Path, 0, m.Value)
+	if err != nil {
+		return nil, fmt.Errorf("merge into key %q: %w", key, err)
+	}
+	return map[string]any{key: merged}, nil
+}
+
+// mergeAt returns a copy of target, the value at path[:depth], in which
+// patch is merged into the object at the path. target is left unchanged.
+func mergeAt(target any, path []string, depth int, patch map[string]any) (any, error) {
+	var object map[string]any
+	switch t := target.(type) {
+	case nil:
+		object = map[string]any{}
+	case map[string]any:
+		object = maps.Clone(t)
+	default:
+		if depth == 0 {
+			return nil, fmt.Errorf("current value must be an object, got %T", target)
+		}
+		return nil, fmt.Errorf("value at %q must be an object, got %T", jsonPointer(path[:depth]), target)
+	}
+	if depth == len(path) {
+		return mergePatch(object, patch), nil
+	}
+	child, err := mergeAt(object[path[depth]], path, depth+1, patch)
+	if err != nil {
+		return nil, err
+	}
+	object[path[depth]] = child
+	return object, nil
+}
+
+// jsonPointer returns the JSON Pointer of the reference tokens.
+func jsonPointer(tokens []string) string {
+	var pointer strings.Builder
+	for _, token := range tokens {
+		pointer.WriteString("/")
+		pointer.WriteString(jsonPointerEscaper.Replace(token))
+	}
+	return pointer.String()
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// mergePatch merges patch into object, which it changes, as described by
+// JSON Merge Patch. The values of patch are copied.
+func mergePatch(object, patch map[string]any) map[string]any {
+	for name, value := range patch {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		valuePatch, ok := value.(map[string]any)
+		if !ok {
+			object[name] = deepCopy(value)
+			continue
+		}
+		current, _ := object[name].(map[string]any)
+		merged := maps.Clone(current)
+		if merged == nil {
+			merged = map[string]any{}
+		}
+		object[name] = mergePatch(merged, valuePatch)
+	}
+	return object
+}
+
+// deepCopy returns a copy of v which shares no maps, slices or arrays with
+// it. Values reached through pointers, channels or struct fields are shared.
+func deepCopy(v any) any {
+	if v == nil {
+		return nil
+	}
+	return deepCopyValue(reflect.ValueOf(v)).Interface()
+}
+
+func deepCopyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			c.SetMapIndex(iter.Key(), deepCopyValue(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(deepCopyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := range v.Len() {
+			c.Index(i).Set(deepCopyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopyValue(v.Elem()))
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,615 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolveStateDelta(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   map[string]any
+		delta   map[string]any
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:  "plain values pass through",
+			state: map[string]any{"a": 1},
+			delta: map[string]any{"a": 2, "b": nil},
+			want:  map[string]any{"a": 2, "b": nil},
+		},
+		{
+			name:  "rename present source to absent target",
+			state: map[string]any{"old": "v"},
+			delta: map[string]any{"old": RenameKey{To: "new"}},
+			want:  map[string]any{"old": nil, "new": "v"},
+		},
+		{
+			name:    "rename absent source fails",
+			state:   map[string]any{},
+			delta:   map[string]any{"old": RenameKey{To: "new"}},
+			wantErr: true,
+		},
+		{
+			name:  "rename absent source is a no-op with IgnoreMissing",
+			state: map[string]any{},
+			delta: map[string]any{"old": RenameKey{To: "new", IgnoreMissing: true}},
+			want:  map[string]any{},
+		},
+		{
+			name:    "rename to existing target fails",
+			state:   map[string]any{"old": "v", "new": "existing"},
+			delta:   map[string]any{"old": RenameKey{To: "new"}},
+			wantErr: true,
+		},
+		{
+			name:  "rename to existing target overwrites with Overwrite",
+			state: map[string]any{"old": "v", "new": "existing"},
+			delta: map[string]any{"old": RenameKey{To: "new", Overwrite: true}},
+			want:  map[string]any{"old": nil, "new": "v"},
+		},
+		{
+			name:    "rename conflicting with a set of the target fails",
+			state:   map[string]any{"old": "v"},
+			delta:   map[string]any{"old": RenameKey{To: "new"}, "new": "other"},
+			wantErr: true,
+		},
+		{
+			name:    "rename to itself fails",
+			state:   map[string]any{"old": "v"},
+			delta:   map[string]any{"old": RenameKey{To: "old"}},
+			wantErr: true,
+		},
+		{
+			name:  "copy scalar",
+			state: map[string]any{"src": 1},
+			delta: map[string]any{"dst": CopyKey{From: "src"}},
+			want:  map[string]any{"dst": 1},
+		},
+		{
+			name:  "copy over existing target",
+			state: map[string]any{"src": 1, "dst": 2},
+			delta: map[string]any{"dst": CopyKey{From: "src"}},
+			want:  map[string]any{"dst": 1},
+		},
+		{
+			name:    "copy absent source fails",
+			state:   map[string]any{},
+			delta:   map[string]any{"dst": CopyKey{From: "src"}},
+			wantErr: true,
+		},
+		{
+			name:    "copy to itself fails",
+			state:   map[string]any{"src": 1},
+			delta:   map[string]any{"src": CopyKey{From: "src"}},
+			wantErr: true,
+		},
+		{
+			name:  "swap present keys",
+			state: map[string]any{"current": 2, "previous": 1},
+			delta: map[string]any{"current": SwapKeys{With: "previous"}},
+			want:  map[string]any{"current": 1, "previous": 2},
+		},
+		{
+			name:  "swap present with absent key",
+			state: map[string]any{"current": 2},
+			delta: map[string]any{"current": SwapKeys{With: "previous"}},
+			want:  map[string]any{"current": nil, "previous": 2},
+		},
+		{
+			name:    "swap with itself fails",
+			state:   map[string]any{"current": 2},
+			delta:   map[string]any{"current": SwapKeys{With: "current"}},
+			wantErr: true,
+		},
+		{
+			name:    "two swaps of one key fail",
+			state:   map[string]any{"a": 1, "b": 2},
+			delta:   map[string]any{"a": SwapKeys{With: "b"}, "b": SwapKeys{With: "a"}},
+			wantErr: true,
+		},
+		{
+			name:  "setIf with true predicate sets the key",
+			state: map[string]any{"progress": 100},
+			delta: map[string]any{"completed": SetIf{When: Predicate{Key: "progress", Op: OpGte, Value: float64(100)}, Value: "done"}},
+			want:  map[string]any{"completed": "done"},
+		},
+		{
+			name:  "setIf with false predicate is a no-op",
+			state: map[string]any{"progress": 99},
+			delta: map[string]any{"completed": SetIf{When: Predicate{Key: "progress", Op: OpGte, Value: 100}, Value: "done"}},
+			want:  map[string]any{},
+		},
+		{
+			name:  "setIf on absent key with ordering operator is a no-op",
+			state: map[string]any{},
+			delta: map[string]any{"completed": SetIf{When: Predicate{Key: "progress", Op: OpLt, Value: 100}, Value: "done"}},
+			want:  map[string]any{},
+		},
+		{
+			name:  "setIf with nil value deletes the key",
+			state: map[string]any{"status": "stale", "completed": "done"},
+			delta: map[string]any{"completed": SetIf{When: Predicate{Key: "status", Op: OpEq, Value: "stale"}, Value: nil}},
+			want:  map[string]any{"completed": nil},
+		},
+		{
+			name:    "setIf with unsupported operator fails",
+			state:   map[string]any{"progress": 100},
+			delta:   map[string]any{"completed": SetIf{When: Predicate{Key: "progress", Op: "between", Value: 100}, Value: "done"}},
+			wantErr: true,
+		},
+		{
+			name:    "setIf ordering a string and a number fails",
+			state:   map[string]any{"progress": "high"},
+			delta:   map[string]any{"completed": SetIf{When: Predicate{Key: "progress", Op: OpGt, Value: 1}, Value: "done"}},
+			wantErr: true,
+		},
+		{
+			name:  "min initializes an absent key",
+			state: map[string]any{},
+			delta: map[string]any{"low": KeepMin{Value: 3.5}},
+			want:  map[string]any{"low": 3.5},
+		},
+		{
+			name:  "min updates a higher value",
+			state: map[string]any{"low": 5},
+			delta: map[string]any{"low": KeepMin{Value: float64(2)}},
+			want:  map[string]any{"low": float64(2)},
+		},
+		{
+			name:  "min keeps a lower or equal value",
+			state: map[string]any{"low": 2, "same": 4},
+			delta: map[string]any{"low": KeepMin{Value: float64(3)}, "same": KeepMin{Value: float64(4)}},
+			want:  map[string]any{},
+		},
+		{
+			name:  "max updates a lower value",
+			state: map[string]any{"high": float64(5)},
+			delta: map[string]any{"high": KeepMax{Value: 7}},
+			want:  map[string]any{"high": 7},
+		},
+		{
+			name:  "max keeps a higher value",
+			state: map[string]any{"high": float64(5)},
+			delta: map[string]any{"high": KeepMax{Value: 1}},
+			want:  map[string]any{},
+		},
+		{
+			name:  "max initializes an absent key",
+			state: map[string]any{},
+			delta: map[string]any{"high": KeepMax{Value: -1}},
+			want:  map[string]any{"high": -1},
+		},
+		{
+			name:    "min of a non-numeric value fails",
+			state:   map[string]any{"low": "cold"},
+			delta:   map[string]any{"low": KeepMin{Value: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "max with a non-numeric value fails",
+			state:   map[string]any{"high": 1},
+			delta:   map[string]any{"high": KeepMax{Value: "hot"}},
+			wantErr: true,
+		},
+		{
+			name:  "addUnique creates an absent slice",
+			state: map[string]any{},
+			delta: map[string]any{"seen": AddUnique{Value: "a"}},
+			want:  map[string]any{"seen": []any{"a"}},
+		},
+		{
+			name:  "addUnique appends a new element",
+			state: map[string]any{"seen": []any{"a", float64(1)}},
+			delta: map[string]any{"seen": AddUnique{Value: "b"}},
+			want:  map[string]any{"seen": []any{"a", float64(1), "b"}},
+		},
+		{
+			name:  "addUnique appends to a typed slice",
+			state: map[string]any{"seen": []string{"a"}},
+			delta: map[string]any{"seen": AddUnique{Value: "b"}},
+			want:  map[string]any{"seen": []string{"a", "b"}},
+		},
+		{
+			name:  "addUnique skips a duplicate",
+			state: map[string]any{"seen": []any{"a", float64(1)}},
+			delta: map[string]any{"seen": AddUnique{Value: "a"}},
+			want:  map[string]any{},
+		},
+		{
+			name:  "addUnique compares numbers by value",
+			state: map[string]any{"seen": []any{1}},
+			delta: map[string]any{"seen": AddUnique{Value: float64(1)}},
+			want:  map[string]any{},
+		},
+		{
+			name:  "addUnique compares maps deeply",
+			state: map[string]any{"seen": []any{map[string]any{"id": "a", "n": float64(1)}}},
+			delta: map[string]any{"seen": AddUnique{Value: map[string]any{"id": "a", "n": float64(1)}}},
+			want:  map[string]any{},
+		},
+		{
+			name:    "addUnique to a non-slice value fails",
+			state:   map[string]any{"seen": "a"},
+			delta:   map[string]any{"seen": AddUnique{Value: "b"}},
+			wantErr: true,
+		},
+		{
+			name:    "addUnique of a mismatched element type fails",
+			state:   map[string]any{"seen": []string{"a"}},
+			delta:   map[string]any{"seen": AddUnique{Value: 1}},
+			wantErr: true,
+		},
+		{
+			name:  "merge creates an absent key",
+			state: map[string]any{},
+			delta: map[string]any{"prefs": MergeValue{Value: map[string]any{"theme": "dark"}}},
+			want:  map[string]any{"prefs": map[string]any{"theme": "dark"}},
+		},
+		{
+			name:  "merge replaces, merges and removes members",
+			state: map[string]any{"prefs": map[string]any{"theme": "light", "font": map[string]any{"size": float64(12), "face": "serif"}, "beta": true}},
+			delta: map[string]any{"prefs": MergeValue{Value: map[string]any{"theme": "dark", "font": map[string]any{"size": float64(14)}, "beta": nil}}},
+			want:  map[string]any{"prefs": map[string]any{"theme": "dark", "font": map[string]any{"size": float64(14), "face": "serif"}}},
+		},
+		{
+			name:  "merge at a nested path",
+			state: map[string]any{"profile": map[string]any{"name": "ada", "settings": map[string]any{"ui": map[string]any{"lang": "en"}}}},
+			delta: map[string]any{"profile": MergeValue{Path: []string{"settings", "ui"}, Value: map[string]any{"theme": "dark"}}},
+			want:  map[string]any{"profile": map[string]any{"name": "ada", "settings": map[string]any{"ui": map[string]any{"lang": "en", "theme": "dark"}}}},
+		},
+		{
+			name:  "merge creates the intermediate objects",
+			state: map[string]any{"profile": map[string]any{"name": "ada"}},
+			delta: map[string]any{"profile": MergeValue{Path: []string{"settings", "a/b"}, Value: map[string]any{"on": true}}},
+			want:  map[string]any{"profile": map[string]any{"name": "ada", "settings": map[string]any{"a/b": map[string]any{"on": true}}}},
+		},
+		{
+			name:    "merge through a non-object intermediate fails",
+			state:   map[string]any{"profile": map[string]any{"settings": "none"}},
+			delta:   map[string]any{"profile": MergeValue{Path: []string{"settings", "ui"}, Value: map[string]any{"theme": "dark"}}},
+			wantErr: true,
+		},
+		{
+			name:    "merge into a non-object value fails",
+			state:   map[string]any{"prefs": []any{"dark"}},
+			delta:   map[string]any{"prefs": MergeValue{Value: map[string]any{"theme": "dark"}}},
+			wantErr: true,
+		},
+		{
+			name:    "copy conflicting with a set of the target fails",
+			state:   map[string]any{"src": 1},
+			delta:   map[string]any{"dst": CopyKey{From: "src"}, "src": RenameKey{To: "dst"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveStateDelta(tt.state, tt.delta)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveStateDelta() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrStateDirectiveFailed) {
+					t.Errorf("ResolveStateDelta() error = %v, want wrapped ErrStateDirectiveFailed", err)
+				}
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ResolveStateDelta() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEvaluateStateDelta(t *testing.T) {
+	state := map[string]any{"a": 1, "s": "v", "progress": 50}
+	tests := []struct {
+		name  string
+		delta map[string]any
+		want  map[string]StateChangeOutcome
+	}{
+		{
+			name:  "applied",
+			delta: map[string]any{"a": 2, "new": "x", "s": nil},
+			want:  map[string]StateChangeOutcome{"a": StateChangeApplied, "new": StateChangeApplied, "s": StateChangeApplied},
+		},
+		{
+			name: "no-op",
+			delta: map[string]any{
+				"a":       1.0,
+				"s":       "v",
+				"missing": nil,
+				"done":    SetIf{When: Predicate{Key: "progress", Op: OpGte, Value: 100}, Value: true},
+			},
+			want: map[string]StateChangeOutcome{"a": StateChangeNoop, "s": StateChangeNoop, "missing": StateChangeNoop, "done": StateChangeNoop},
+		},
+		{
+			name: "mixed",
+			delta: map[string]any{
+				"a":     1,
+				"s":     RenameKey{To: "t"},
+				"half":  SetIf{When: Predicate{Key: "progress", Op: OpGte, Value: 50}, Value: true},
+				"ghost": RenameKey{To: "other"},
+			},
+			want: map[string]StateChangeOutcome{"a": StateChangeNoop, "s": StateChangeApplied, "half": StateChangeApplied, "ghost": StateChangeFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcomes := EvaluateStateDelta(state, tt.delta)
+			got := make(map[string]StateChangeOutcome, len(outcomes))
+			for key, outcome := range outcomes {
+				got[key] = outcome.Outcome
+				if (outcome.Outcome == StateChangeFailed) != (outcome.Err != nil) {
+					t.Errorf("outcome of %q = %v with error %v, want an error exactly when failed", key, outcome.Outcome, outcome.Err)
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("EvaluateStateDelta() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if got := EvaluateStateDelta(state, map[string]any{"s": RenameKey{To: "t"}})["s"].ChangedKeys; !slices.Equal(got, []string{"s", "t"}) {
+		t.Errorf("ChangedKeys of a rename = %v, want both keys", got)
+	}
+}
+
+func TestPredicate_Eval(t *testing.T) {
+	state := map[string]any{"n": 5, "s": "b", "m": map[string]any{"k": "v"}}
+	tests := []struct {
+		predicate Predicate
+		want      bool
+	}{
+		{predicate: Predicate{Key: "n", Op: OpEq, Value: float64(5)}, want: true},
+		{predicate: Predicate{Key: "n", Op: OpEq, Value: 6}, want: false},
+		{predicate: Predicate{Key: "n", Op: OpNeq, Value: 6}, want: true},
+		{predicate: Predicate{Key: "n", Op: OpGt, Value: 4.5}, want: true},
+		{predicate: Predicate{Key: "n", Op: OpGt, Value: 5}, want: false},
+		{predicate: Predicate{Key: "n", Op: OpGte, Value: 5}, want: true},
+		{predicate: Predicate{Key: "n", Op: OpLt, Value: 5}, want: false},
+		{predicate: Predicate{Key: "n", Op: OpLte, Value: 5}, want: true},
+		{predicate: Predicate{Key: "s", Op: OpLt, Value: "c"}, want: true},
+		{predicate: Predicate{Key: "m", Op: OpEq, Value: map[string]any{"k": "v"}}, want: true},
+		{predicate: Predicate{Key: "absent", Op: OpEq, Value: nil}, want: true},
+		{predicate: Predicate{Key: "absent", Op: OpNeq, Value: 1}, want: true},
+		{predicate: Predicate{Key: "absent", Op: OpGte, Value: 0}, want: false},
+	}
+	for _, tt := range tests {
+		got, err := tt.predicate.Eval(state)
+		if err != nil {
+			t.Errorf("%+v.Eval() error = %v", tt.predicate, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%+v.Eval() = %v, want %v", tt.predicate, got, tt.want)
+		}
+	}
+}
+
+func Test_inMemoryService_RenameKey(t *testing.T) {
+	s := InMemoryService()
+	created, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: map[string]any{"old": "v", "user:old": "u"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := stateEvent(map[string]any{"old": RenameKey{To: "new"}, "user:old": RenameKey{To: "user:new"}})
+	if err := s.AppendEvent(t.Context(), created.Session, event); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+
+	// The stored event records the resolved changes, not the directive.
+	wantDelta := map[string]any{"old": nil, "new": "v", "user:old": nil, "user:new": "u"}
+	if diff := cmp.Diff(wantDelta, event.Actions.StateDelta); diff != "" {
+		t.Errorf("event state delta mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantState := map[string]any{"new": "v", "user:new": "u"}
+	if diff := cmp.Diff(wantState, maps.Collect(got.Session.State().All())); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	// A failing directive leaves the session unchanged.
+	err = s.AppendEvent(t.Context(), got.Session, stateEvent(map[string]any{"old": RenameKey{To: "new"}}))
+	if !errors.Is(err, ErrStateDirectiveFailed) {
+		t.Fatalf("AppendEvent() error = %v, want ErrStateDirectiveFailed", err)
+	}
+	got, err = s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Session.Events().Len() != 1 {
+		t.Errorf("got %d events, want 1", got.Session.Events().Len())
+	}
+}
+
+func TestCopyKey_Independent(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		mutate func(v any)
+		want   any
+	}{
+		{
+			name:   "map",
+			value:  map[string]any{"theme": "dark", "nested": map[string]any{"size": 1}},
+			mutate: func(v any) { v.(map[string]any)["nested"].(map[string]any)["size"] = 2 },
+			want:   map[string]any{"theme": "dark", "nested": map[string]any{"size": 1}},
+		},
+		{
+			name:   "slice",
+			value:  []any{"a", []string{"b", "c"}},
+			mutate: func(v any) { v.([]any)[1].([]string)[0] = "x" },
+			want:   []any{"a", []string{"b", "c"}},
+		},
+		{
+			name:   "typed map",
+			value:  map[string][]int{"k": {1, 2}},
+			mutate: func(v any) { v.(map[string][]int)["k"][0] = 9 },
+			want:   map[string][]int{"k": {1, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := map[string]any{"src": tt.value}
+			got, err := ResolveStateDelta(state, map[string]any{"dst": CopyKey{From: "src"}})
+			if err != nil {
+				t.Fatalf("ResolveStateDelta() error = %v", err)
+			}
+			tt.mutate(state["src"])
+			if diff := cmp.Diff(tt.want, got["dst"]); diff != "" {
+				t.Errorf("copy changed with its source (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_inMemoryService_CopyKey(t *testing.T) {
+	s := InMemoryService()
+	state := map[string]any{"scalar": "v", "map": map[string]any{"k": "v"}, "slice": []any{1, 2}}
+	created, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := stateEvent(map[string]any{
+		"scalar_backup": CopyKey{From: "scalar"},
+		"map_backup":    CopyKey{From: "map"},
+		"slice_backup":  CopyKey{From: "slice"},
+	})
+	if err := s.AppendEvent(t.Context(), created.Session, event); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+	// Mutating the stored source values doesn't affect the copies.
+	state["map"].(map[string]any)["k"] = "changed"
+	state["slice"].([]any)[0] = 9
+
+	got, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantState := map[string]any{
+		"scalar":        "v",
+		"map":           map[string]any{"k": "changed"},
+		"slice":         []any{9, 2},
+		"scalar_backup": "v",
+		"map_backup":    map[string]any{"k": "v"},
+		"slice_backup":  []any{1, 2},
+	}
+	if diff := cmp.Diff(wantState, maps.Collect(got.Session.State().All())); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	// Copying an absent key fails and leaves the session unchanged.
+	err = s.AppendEvent(t.Context(), got.Session, stateEvent(map[string]any{"backup": CopyKey{From: "missing"}}))
+	if !errors.Is(err, ErrStateKeyNotExist) {
+		t.Fatalf("AppendEvent() error = %v, want ErrStateKeyNotExist", err)
+	}
+}
+
+func Test_inMemoryService_SwapKeys(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryService()
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: map[string]any{"current": "c", "previous": "p"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every swap runs atomically under the session lock: after an even
+	// number of concurrent swaps the values are back in place, a racy
+	// read-copy-write would end up with one value in both keys.
+	const swaps = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, swaps)
+	for range swaps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"current": SwapKeys{With: "previous"}}))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AppendEvent() error = %v", err)
+		}
+	}
+
+	got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantState := map[string]any{"current": "c", "previous": "p"}
+	if diff := cmp.Diff(wantState, maps.Collect(got.Session.State().All())); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	// Swapping with an absent key moves the value.
+	if err := s.AppendEvent(ctx, got.Session, stateEvent(map[string]any{"previous": SwapKeys{With: "next"}})); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+	got, err = s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantState = map[string]any{"current": "c", "next": "p"}
+	if diff := cmp.Diff(wantState, maps.Collect(got.Session.State().All())); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestIsNoopStateDelta(t *testing.T) {
+	state := map[string]any{"count": 1, "a": "x", "b": "x"}
+	tests := []struct {
+		name    string
+		delta   map[string]any
+		want    bool
+		wantErr bool
+	}{
+		{name: "empty", delta: map[string]any{}, want: true},
+		{name: "equal values", delta: map[string]any{"count": float64(1), "a": "x"}, want: true},
+		{name: "absent key deleted", delta: map[string]any{"missing": nil}, want: true},
+		{name: "temporary keys", delta: map[string]any{"temp:scratch": "y"}, want: true},
+		{name: "swap of equal values", delta: map[string]any{"a": SwapKeys{With: "b"}}, want: true},
+		{name: "changed value", delta: map[string]any{"count": 2}},
+		{name: "deleted key", delta: map[string]any{"a": nil}},
+		{name: "failing directive", delta: map[string]any{"missing": RenameKey{To: "other"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsNoopStateDelta(state, tt.delta)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IsNoopStateDelta() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IsNoopStateDelta() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
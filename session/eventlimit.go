@@ -0,0 +1,86 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSessionFull is returned, wrapped, when an event is appended to a
+// session which already holds the maximum number of events of its app.
+// The session is left unchanged, clients are expected to start a new one.
+var ErrSessionFull = errors.New("session is full")
+
+// EventCountLimits holds the maximum number of events of a session, per
+// app. A limit of zero or less means no limit.
+type EventCountLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default int
+	// Apps maps an app name to its limit.
+	Apps map[string]int
+}
+
+// ForApp returns the event count limit of the app.
+func (l EventCountLimits) ForApp(appName string) int {
+	if limit, ok := l.Apps[appName]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Check returns an error wrapping [ErrSessionFull] if a session of the app
+// holding count events can't take added more events.
+func (l EventCountLimits) Check(appName, sessionID string, count, added int) error {
+	limit := l.ForApp(appName)
+	if limit <= 0 || count+added <= limit {
+		return nil
+	}
+	return fmt.Errorf("%w: session %q holds %d events, the limit is %d", ErrSessionFull, sessionID, count, limit)
+}
+
+// ErrUserEventsExceeded is returned, wrapped, when an event is appended by
+// a user whose sessions of the app already hold the maximum total number
+// of events. Deleting or compacting sessions of the user frees room.
+var ErrUserEventsExceeded = errors.New("user event quota exceeded")
+
+// UserEventLimits holds the maximum total number of events across all the
+// sessions of a user, per app. It complements [EventCountLimits], which
+// caps a single session. A limit of zero or less means no limit.
+type UserEventLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default int
+	// Apps maps an app name to its limit.
+	Apps map[string]int
+}
+
+// ForApp returns the per-user event limit of the app.
+func (l UserEventLimits) ForApp(appName string) int {
+	if limit, ok := l.Apps[appName]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Check returns an error wrapping [ErrUserEventsExceeded] if the sessions
+// of the app's user holding count events in total can't take added more
+// events.
+func (l UserEventLimits) Check(appName, userID string, count, added int) error {
+	limit := l.ForApp(appName)
+	if limit <= 0 || count+added <= limit {
+		return nil
+	}
+	return fmt.Errorf("%w: user %q holds %d events, the limit is %d", ErrUserEventsExceeded, userID, count, limit)
+}
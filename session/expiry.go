@@ -0,0 +1,136 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TouchService is implemented by a [Service] whose sessions expire after a
+// period of inactivity. Touching a session keeps it alive, for instance
+// while it is viewed but not written, without changing its state, its
+// events or its update time.
+type TouchService interface {
+	// Touch extends the expiry of the session as if it was just written.
+	Touch(context.Context, *TouchRequest) (*TouchResponse, error)
+}
+
+// TouchRequest represents a request to touch a session.
+type TouchRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+}
+
+// TouchResponse represents a response from [TouchService.Touch].
+type TouchResponse struct {
+	// ExpiresAt is the new expiry time of the session. It is zero when the
+	// sessions don't expire.
+	ExpiresAt time.Time
+}
+
+// Touch implements [TouchService].
+func (s *inMemoryService) Touch(ctx context.Context, req *TouchRequest) (*TouchResponse, error) {
+	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
+	if appName == "" || userID == "" || sessionID == "" {
+		return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
+	}
+	key := id{appName: appName, userID: userID, sessionID: sessionID}.Encode()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup(key); !ok {
+		return nil, fmt.Errorf("%w: %q", ErrSessionNotFound, sessionID)
+	}
+	return &TouchResponse{ExpiresAt: s.extendExpiry(key)}, nil
+}
+
+// now returns the current time of the session expiry.
+func (s *inMemoryService) now() time.Time {
+	if s.cfg.Now != nil {
+		return s.cfg.Now()
+	}
+	return time.Now()
+}
+
+// lookup returns the stored session of the key, unless it expired. The
+// caller must hold s.mu.
+func (s *inMemoryService) lookup(key string) (*session, bool) {
+	if s.expired(key) {
+		return nil, false
+	}
+	return s.sessions.Get(key)
+}
+
+// expired reports whether the session of the key expired. The caller must
+// hold s.mu.
+func (s *inMemoryService) expired(key string) bool {
+	expiresAt, ok := s.expiresAt[key]
+	return ok && !s.now().Before(expiresAt)
+}
+
+// setDeadline records the time the session of the key, just created,
+// reaches MaxSessionAge. The caller must hold s.mu for writing.
+func (s *inMemoryService) setDeadline(key string) {
+	if s.cfg.MaxSessionAge <= 0 {
+		return
+	}
+	if s.deadlines == nil {
+		s.deadlines = make(map[string]time.Time)
+	}
+	s.deadlines[key] = s.now().Add(s.cfg.MaxSessionAge)
+}
+
+// extendExpiry moves the expiry of the session of the key to SessionTTL
+// from now, but never past its deadline, and returns it. It returns the
+// zero time if sessions don't expire. The caller must hold s.mu for
+// writing.
+func (s *inMemoryService) extendExpiry(key string) time.Time {
+	deadline, hasDeadline := s.deadlines[key]
+	if s.cfg.SessionTTL <= 0 && !hasDeadline {
+		return time.Time{}
+	}
+	if s.expiresAt == nil {
+		s.expiresAt = make(map[string]time.Time)
+	}
+	expiresAt := deadline
+	if s.cfg.SessionTTL > 0 {
+		if idle := s.now().Add(s.cfg.SessionTTL); !hasDeadline || idle.Before(deadline) {
+			expiresAt = idle
+		}
+	}
+	s.expiresAt[key] = expiresAt
+	return expiresAt
+}
+
+// sweepExpired removes the expired sessions, which are otherwise only
+// hidden, so that they don't accumulate. The caller must hold s.mu for
+// writing.
+func (s *inMemoryService) sweepExpired() {
+	for key := range s.expiresAt {
+		if !s.expired(key) {
+			continue
+		}
+		if storedSession, ok := s.sessions.Get(key); ok {
+			s.remove(key, storedSession)
+		} else {
+			delete(s.expiresAt, key)
+			delete(s.deadlines, key)
+		}
+	}
+	s.sweepAt = max(2*len(s.expiresAt), 64)
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for the session expiry.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestInMemoryService_Touch(t *testing.T) {
+	ctx := t.Context()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{SessionTTL: time.Hour, Now: clock.Now})
+	touchService := s.(TouchService)
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "viewed", State: map[string]any{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"k": "w"})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "idle"}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(sessionID string) (Session, error) {
+		resp, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+		if err != nil {
+			return nil, err
+		}
+		return resp.Session, nil
+	}
+	before, err := get("viewed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(50 * time.Minute)
+	resp, err := touchService.Touch(ctx, &TouchRequest{AppName: "app", UserID: "user", SessionID: "viewed"})
+	if err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	if want := clock.now.Add(time.Hour); !resp.ExpiresAt.Equal(want) {
+		t.Errorf("Touch() ExpiresAt = %v, want %v", resp.ExpiresAt, want)
+	}
+	// Reading a session doesn't extend its expiry.
+	if _, err := get("idle"); err != nil {
+		t.Fatalf("Get() of the idle session before its expiry: %v", err)
+	}
+
+	clock.advance(30 * time.Minute)
+	after, err := get("viewed")
+	if err != nil {
+		t.Fatalf("Get() of the touched session after its first expiry: %v", err)
+	}
+	if !after.LastUpdateTime().Equal(before.LastUpdateTime()) {
+		t.Errorf("LastUpdateTime() after Touch() = %v, want %v", after.LastUpdateTime(), before.LastUpdateTime())
+	}
+	if after.Events().Len() != before.Events().Len() {
+		t.Errorf("Touch() changed the events: got %d, want %d", after.Events().Len(), before.Events().Len())
+	}
+	if got, _ := after.State().Get("k"); got != "w" {
+		t.Errorf("state after Touch() = %v, want %q", got, "w")
+	}
+	if _, err := get("idle"); err == nil {
+		t.Error("Get() of the expired idle session succeeded, want an error")
+	}
+	if _, err := touchService.Touch(ctx, &TouchRequest{AppName: "app", UserID: "user", SessionID: "idle"}); err == nil {
+		t.Error("Touch() of the expired idle session succeeded, want an error")
+	}
+	list, err := s.List(ctx, &ListRequest{AppName: "app", UserID: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, listed := range list.Sessions {
+		ids = append(ids, listed.ID())
+	}
+	if !slices.Equal(ids, []string{"viewed"}) {
+		t.Errorf("List() = %v, want only the touched session", ids)
+	}
+
+	clock.advance(31 * time.Minute)
+	if _, err := get("viewed"); err == nil {
+		t.Error("Get() of the touched session after its extended expiry succeeded, want an error")
+	}
+	// The ID of an expired session can be reused.
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "idle"}); err != nil {
+		t.Errorf("Create() with the ID of an expired session: %v", err)
+	}
+}
+
+func TestInMemoryService_TouchWithoutTTL(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryService()
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.(TouchService).Touch(ctx, &TouchRequest{AppName: "app", UserID: "user", SessionID: "s"})
+	if err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	if !resp.ExpiresAt.IsZero() {
+		t.Errorf("Touch() ExpiresAt = %v, want zero for sessions that don't expire", resp.ExpiresAt)
+	}
+	if _, err := s.(TouchService).Touch(ctx, &TouchRequest{AppName: "app", UserID: "user", SessionID: "missing"}); err == nil {
+		t.Error("Touch() of a missing session succeeded, want an error")
+	}
+}
+
+func TestInMemoryService_MaxSessionAge(t *testing.T) {
+	ctx := t.Context()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		t.Run(fmt.Sprintf("ttl=%v", ttl), func(t *testing.T) {
+			clock := &fakeClock{now: start}
+			s := InMemoryServiceWithConfig(InMemoryServiceConfig{SessionTTL: ttl, MaxSessionAge: 3 * time.Hour, Now: clock.Now})
+			created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "busy"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The session is written every 20 minutes, which keeps it from
+			// idling out but not from aging out.
+			for clock.now.Before(start.Add(3 * time.Hour)) {
+				if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"k": clock.now.String()})); err != nil {
+					t.Fatalf("AppendEvent() at %v: %v", clock.now, err)
+				}
+				resp, err := s.(TouchService).Touch(ctx, &TouchRequest{AppName: "app", UserID: "user", SessionID: "busy"})
+				if err != nil {
+					t.Fatalf("Touch() at %v: %v", clock.now, err)
+				}
+				want := start.Add(3 * time.Hour)
+				if idle := clock.now.Add(ttl); ttl > 0 && idle.Before(want) {
+					want = idle
+				}
+				if !resp.ExpiresAt.Equal(want) {
+					t.Errorf("Touch() at %v ExpiresAt = %v, want %v", clock.now, resp.ExpiresAt, want)
+				}
+				clock.advance(20 * time.Minute)
+			}
+
+			_, err = s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "busy"})
+			if !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("Get() past the maximum age error = %v, want ErrSessionNotFound", err)
+			}
+			if _, err := s.(TouchService).Touch(ctx, &TouchRequest{AppName: "app", UserID: "user", SessionID: "busy"}); err == nil {
+				t.Error("Touch() past the maximum age succeeded, want an error")
+			}
+
+			service := s.(*inMemoryService)
+			service.mu.Lock()
+			service.sweepExpired()
+			_, stored := service.sessions.Get(id{appName: "app", userID: "user", sessionID: "busy"}.Encode())
+			deadlines := len(service.deadlines)
+			service.mu.Unlock()
+			if stored || deadlines != 0 {
+				t.Errorf("after the sweep, session stored = %v and %d deadlines, want the session purged", stored, deadlines)
+			}
+		})
+	}
+}
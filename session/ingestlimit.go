@@ -0,0 +1,171 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrIngestionRateExceeded is returned, wrapped, when an event is appended
+// faster than the ingestion rate of its app allows. The event is not stored,
+// clients are expected to retry later.
+var ErrIngestionRateExceeded = errors.New("event ingestion rate exceeded")
+
+// IngestionPolicy is what an [IngestionLimiter] does with the events
+// appended past the rate limit.
+type IngestionPolicy int
+
+const (
+	// IngestionShed fails the append with [ErrIngestionRateExceeded].
+	IngestionShed IngestionPolicy = iota
+	// IngestionWait delays the append until the rate allows it, for at most
+	// IngestionLimits.MaxWait, and fails it with [ErrIngestionRateExceeded]
+	// if it would have to wait longer.
+	IngestionWait
+)
+
+// IngestionRate is the rate at which events are accepted. A rate of zero or
+// less means no limit.
+type IngestionRate struct {
+	// EventsPerSecond is the sustained rate of accepted events.
+	EventsPerSecond float64
+	// Burst is the number of events accepted at once above the sustained
+	// rate. Optional: defaults to 1.
+	Burst int
+}
+
+// IngestionLimits holds the event ingestion rates, per app.
+type IngestionLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default IngestionRate
+	// Apps maps an app name to its rate.
+	Apps map[string]IngestionRate
+	// PerSession applies the rate to each session of an app rather than to
+	// the app as a whole.
+	PerSession bool
+	// Policy is applied to the events appended past the rate.
+	Policy IngestionPolicy
+	// MaxWait bounds the time an append is delayed by the IngestionWait
+	// policy. Optional: if zero, the append waits as long as its context
+	// allows.
+	MaxWait time.Duration
+}
+
+// ForApp returns the ingestion rate of the app.
+func (l IngestionLimits) ForApp(appName string) IngestionRate {
+	if r, ok := l.Apps[appName]; ok {
+		return r
+	}
+	return l.Default
+}
+
+// IngestionLimiter limits the rate at which events are appended to a
+// session service. It is safe for concurrent use, and can be shared by
+// several services to limit their combined rate.
+type IngestionLimiter struct {
+	limits   IngestionLimits
+	limiters rateLimiters
+}
+
+// NewIngestionLimiter returns a limiter enforcing the limits.
+func NewIngestionLimiter(limits IngestionLimits) *IngestionLimiter {
+	return &IngestionLimiter{limits: limits}
+}
+
+// Admit returns nil once an event may be appended to the session, according
+// to the rate of its app and the policy. A nil limiter admits every event.
+func (l *IngestionLimiter) Admit(ctx context.Context, appName, userID, sessionID string) error {
+	if l == nil {
+		return nil
+	}
+	r := l.limits.ForApp(appName)
+	if r.EventsPerSecond <= 0 {
+		return nil
+	}
+	key := id{appName: appName}.Encode()
+	if l.limits.PerSession {
+		key = id{appName: appName, userID: userID, sessionID: sessionID}.Encode()
+	}
+	limiter := l.limiters.get(key, r.EventsPerSecond, r.Burst)
+
+	if l.limits.Policy != IngestionWait {
+		if !limiter.Allow() {
+			return fmt.Errorf("%w: app %q accepts %v events per second", ErrIngestionRateExceeded, appName, r.EventsPerSecond)
+		}
+		return nil
+	}
+	waitCtx := ctx
+	if l.limits.MaxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, l.limits.MaxWait)
+		defer cancel()
+	}
+	// Wait fails at once when the delay exceeds the deadline, without
+	// consuming a token.
+	if err := limiter.Wait(waitCtx); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for the ingestion rate of app %q: %w", appName, ctx.Err())
+		}
+		return fmt.Errorf("%w: app %q accepts %v events per second, waited up to %v", ErrIngestionRateExceeded, appName, r.EventsPerSecond, l.limits.MaxWait)
+	}
+	return nil
+}
+
+// rateLimiters holds the rate limiters of keys, like apps or sessions,
+// created on first use. It is safe for concurrent use.
+type rateLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	// sweepAt is the number of limiters past which the idle ones are
+	// dropped.
+	sweepAt int
+}
+
+// get returns the limiter of the key, creating it with the rate if needed.
+func (l *rateLimiters) get(key string, perSecond float64, burst int) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limiter, ok := l.limiters[key]; ok {
+		return limiter
+	}
+	if l.limiters == nil {
+		l.limiters = make(map[string]*rate.Limiter)
+	}
+	if len(l.limiters) >= l.sweepAt {
+		l.sweep()
+	}
+	limiter := rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))
+	l.limiters[key] = limiter
+	return limiter
+}
+
+// sweep drops the limiters which have refilled their burst, as if they had
+// never been used, so that per-session limiters don't accumulate. The
+// caller must hold l.mu.
+func (l *rateLimiters) sweep() {
+	now := time.Now()
+	for key, limiter := range l.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(l.limiters, key)
+		}
+	}
+	l.sweepAt = max(2*len(l.limiters), 64)
+}
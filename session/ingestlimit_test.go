@@ -0,0 +1,209 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_inMemoryService_IngestionShed(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		Ingestion: NewIngestionLimiter(IngestionLimits{
+			Apps: map[string]IngestionRate{"chatty": {EventsPerSecond: 0.01, Burst: 3}},
+		}),
+	})
+	chatty, err := s.Create(ctx, &CreateRequest{AppName: "chatty", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Create(ctx, &CreateRequest{AppName: "chatty", UserID: "user", SessionID: "s2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet, err := s.Create(ctx, &CreateRequest{AppName: "quiet", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The burst is accepted, the events past it are shed at once.
+	for i := range 3 {
+		if err := s.AppendEvent(ctx, chatty.Session, stateEvent(map[string]any{"n": i})); err != nil {
+			t.Fatalf("AppendEvent() %d of the burst error = %v", i, err)
+		}
+	}
+	start := time.Now()
+	if err := s.AppendEvent(ctx, chatty.Session, stateEvent(map[string]any{"n": 3})); !errors.Is(err, ErrIngestionRateExceeded) {
+		t.Fatalf("AppendEvent() past the burst error = %v, want ErrIngestionRateExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("shedding took %v, want no wait", elapsed)
+	}
+	// The rate applies to the app as a whole.
+	if err := s.AppendEvent(ctx, other.Session, stateEvent(map[string]any{"n": 0})); !errors.Is(err, ErrIngestionRateExceeded) {
+		t.Errorf("AppendEvent() to another session of the app error = %v, want ErrIngestionRateExceeded", err)
+	}
+	// Other apps are not limited.
+	for i := range 10 {
+		if err := s.AppendEvent(ctx, quiet.Session, stateEvent(map[string]any{"n": i})); err != nil {
+			t.Fatalf("AppendEvent() %d to an unlimited app error = %v", i, err)
+		}
+	}
+
+	// The shed event was not stored.
+	got, err := s.Get(ctx, &GetRequest{AppName: "chatty", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Session.Events().Len(); n != 3 {
+		t.Errorf("got %d events, want 3", n)
+	}
+}
+
+func Test_inMemoryService_IngestionShed_Transact(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		Ingestion: NewIngestionLimiter(IngestionLimits{
+			Default: IngestionRate{EventsPerSecond: 0.01, Burst: 3},
+		}),
+	})
+	for _, sessionID := range []string{"s1", "s2"} {
+		if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: sessionID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transact := func(n int) error {
+		var ops []TransactOp
+		for i := range n {
+			ops = append(ops, TransactOp{AppName: "app", UserID: "user", SessionID: []string{"s1", "s2"}[i%2], Event: stateEvent(map[string]any{"n": i})})
+		}
+		_, err := s.(TransactionService).Transact(ctx, &TransactRequest{Ops: ops})
+		return err
+	}
+
+	// Every event of a transaction counts, the one past the burst aborts
+	// it.
+	if err := transact(2); err != nil {
+		t.Fatalf("Transact() within the burst error = %v", err)
+	}
+	if err := transact(2); !errors.Is(err, ErrIngestionRateExceeded) {
+		t.Fatalf("Transact() past the burst error = %v, want ErrIngestionRateExceeded", err)
+	}
+	for _, sessionID := range []string{"s1", "s2"} {
+		got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := got.Session.Events().Len(); n != 1 {
+			t.Errorf("got %d events in %s, want 1 of the first transaction", n, sessionID)
+		}
+	}
+}
+
+func Test_inMemoryService_IngestionShed_PerSession(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		Ingestion: NewIngestionLimiter(IngestionLimits{
+			Default:    IngestionRate{EventsPerSecond: 0.01, Burst: 2},
+			PerSession: true,
+		}),
+	})
+	for _, sessionID := range []string{"s1", "s2"} {
+		created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 2 {
+			if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": i})); err != nil {
+				t.Fatalf("AppendEvent() %d to %s error = %v", i, sessionID, err)
+			}
+		}
+		if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": 2})); !errors.Is(err, ErrIngestionRateExceeded) {
+			t.Errorf("AppendEvent() past the burst of %s error = %v, want ErrIngestionRateExceeded", sessionID, err)
+		}
+	}
+}
+
+func Test_inMemoryService_IngestionWait(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		Ingestion: NewIngestionLimiter(IngestionLimits{
+			Default: IngestionRate{EventsPerSecond: 20, Burst: 1},
+			Policy:  IngestionWait,
+			MaxWait: time.Second,
+		}),
+	})
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The burst past the rate is delayed rather than rejected: 4 events
+	// beyond the first one take 4 intervals of 50ms.
+	start := time.Now()
+	for i := range 5 {
+		if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": i})); err != nil {
+			t.Fatalf("AppendEvent() %d error = %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("5 events at 20 per second were appended in %v, want backpressure", elapsed)
+	}
+	got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Session.Events().Len(); n != 5 {
+		t.Errorf("got %d events, want 5", n)
+	}
+}
+
+func Test_inMemoryService_IngestionWait_Bounded(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		Ingestion: NewIngestionLimiter(IngestionLimits{
+			Default: IngestionRate{EventsPerSecond: 0.1, Burst: 1},
+			Policy:  IngestionWait,
+			MaxWait: 50 * time.Millisecond,
+		}),
+	})
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": 0})); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next token is 10s away, past the maximum wait: the append fails
+	// without waiting for it.
+	start := time.Now()
+	if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": 1})); !errors.Is(err, ErrIngestionRateExceeded) {
+		t.Fatalf("AppendEvent() error = %v, want ErrIngestionRateExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("append failed after %v, want at most the maximum wait", elapsed)
+	}
+
+	// A canceled context reports the cancellation, not the rate.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.AppendEvent(canceled, created.Session, stateEvent(map[string]any{"n": 1})); !errors.Is(err, context.Canceled) {
+		t.Errorf("AppendEvent() with a canceled context error = %v, want context.Canceled", err)
+	}
+}
@@ -15,7 +15,10 @@
 package session
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"iter"
 	"maps"
@@ -37,16 +40,41 @@ type stateMap map[string]any
 // inMemoryService is an in-memory implementation of sessionService.Service.
 // Thread-safe.
 type inMemoryService struct {
+	cfg InMemoryServiceConfig
+
 	mu        sync.RWMutex
 	sessions  omap.Map[string, *session] // session.ID) -> storedSession
 	userState map[string]map[string]stateMap
 	appState  map[string]stateMap
+	// appStats is updated incrementally on every change of a session.
+	appStats map[string]*AppStats
+	// userSessions counts the stored sessions of each user of each app,
+	// for InMemoryServiceConfig.MaxSessions.
+	userSessions map[string]map[string]int
+	// userEvents counts the stored events of each user of each app, across
+	// their sessions, for InMemoryServiceConfig.MaxUserEvents.
+	userEvents map[string]map[string]int
+	// watchers receives every stored event.
+	watchers watchHub
+	leases   leaseTable
+	// expiresAt holds the expiry time of each session when sessions
+	// expire, see InMemoryServiceConfig.SessionTTL and MaxSessionAge.
+	expiresAt map[string]time.Time
+	// deadlines holds the time each session reaches the maximum age, which
+	// its expiry is never extended past.
+	deadlines map[string]time.Time
+	// sweepAt is the number of expiry times past which the expired
+	// sessions are removed.
+	sweepAt int
 }
 
 func (s *inMemoryService) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
 	if req.AppName == "" || req.UserID == "" {
 		return nil, fmt.Errorf("app_name and user_id are required, got app_name: %q, user_id: %q", req.AppName, req.UserID)
 	}
+	if err := s.cfg.Creation.Admit(req.AppName, req.UserID); err != nil {
+		return nil, err
+	}
 
 	sessionID := req.SessionID
 	if sessionID == "" {
@@ -63,9 +91,19 @@ func (s *inMemoryService) Create(ctx context.Context, req *CreateRequest) (*Crea
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.sessions.Get(encodedKey); ok {
+	if _, ok := s.lookup(encodedKey); ok {
 		return nil, fmt.Errorf("session %s already exists", req.SessionID)
 	}
+	if len(s.expiresAt) >= s.sweepAt {
+		s.sweepExpired()
+	}
+	if expired, ok := s.sessions.Get(encodedKey); ok {
+		// The ID of an expired session is free again.
+		s.remove(encodedKey, expired)
+	}
+	if err := s.admitSession(req.AppName, req.UserID); err != nil {
+		return nil, err
+	}
 
 	state := req.State
 	if state == nil {
@@ -76,15 +114,32 @@ func (s *inMemoryService) Create(ctx context.Context, req *CreateRequest) (*Crea
 		state:     state,
 		updatedAt: time.Now(),
 	}
+	for key, value := range req.Labels {
+		if value == "" {
+			continue
+		}
+		if val.labels == nil {
+			val.labels = make(map[string]string)
+		}
+		val.labels[key] = value
+	}
 
 	s.sessions.Set(encodedKey, val)
-	appDelta, userDelta, _ := sessionutils.ExtractStateDeltas(req.State)
+	s.setDeadline(encodedKey)
+	s.extendExpiry(encodedKey)
+	appDelta, userDelta, sessionState := sessionutils.ExtractStateDeltas(state)
 	appState := s.updateAppState(appDelta, req.AppName)
 	userState := s.updateUserState(userDelta, req.AppName, req.UserID)
-	val.state = sessionutils.MergeStates(appState, userState, state)
+	// Only the session scoped keys are stored with the session, app and user
+	// state are merged in on read.
+	val.state = sessionState
+	stats := s.statsFor(req.AppName)
+	stats.Sessions++
+	s.countUserSession(req.AppName, req.UserID, 1)
+	s.updateStateBytes(val)
 
 	copiedSession := copySessionWithoutStateAndEvents(val)
-	copiedSession.state = maps.Clone(val.state)
+	copiedSession.state = sessionutils.MergeStates(appState, userState, sessionState)
 	copiedSession.events = slices.Clone(val.events)
 
 	return &CreateResponse{
@@ -107,35 +162,40 @@ func (s *inMemoryService) Get(ctx context.Context, req *GetRequest) (*GetRespons
 		sessionID: sessionID,
 	}
 
-	res, ok := s.sessions.Get(id.Encode())
+	res, ok := s.lookup(id.Encode())
 	if !ok {
-		return nil, fmt.Errorf("session %+v not found", req.SessionID)
+		return nil, fmt.Errorf("%w: %+v", ErrSessionNotFound, req.SessionID)
 	}
 
 	copiedSession := copySessionWithoutStateAndEvents(res)
 	copiedSession.state = s.mergeStates(res.state, appName, userID)
 
-	filteredEvents := res.events
+	filteredEvents := filterEvents(res.events, req)
+	copiedSession.events = make([]*Event, 0, len(filteredEvents))
+	copiedSession.events = append(copiedSession.events, filteredEvents...)
+
+	return &GetResponse{
+		Session: copiedSession,
+	}, nil
+}
+
+// filterEvents returns the events selected by the NumRecentEvents and
+// After of the request, sharing the array of events.
+func filterEvents(events []*Event, req *GetRequest) []*Event {
 	if req.NumRecentEvents > 0 {
-		start := max(len(filteredEvents)-req.NumRecentEvents, 0)
+		start := max(len(events)-req.NumRecentEvents, 0)
 		// create a new slice header pointing to the same array
-		filteredEvents = filteredEvents[start:]
+		events = events[start:]
 	}
 	// apply timestamp filter, assuming list is sorted
-	if !req.After.IsZero() && len(filteredEvents) > 0 {
-		firstIndexToKeep := sort.Search(len(filteredEvents), func(i int) bool {
+	if !req.After.IsZero() && len(events) > 0 {
+		firstIndexToKeep := sort.Search(len(events), func(i int) bool {
 			// Find the first event that is not before the timestamp
-			return !filteredEvents[i].Timestamp.Before(req.After)
+			return !events[i].Timestamp.Before(req.After)
 		})
-		filteredEvents = filteredEvents[firstIndexToKeep:]
+		events = events[firstIndexToKeep:]
 	}
-
-	copiedSession.events = make([]*Event, 0, len(filteredEvents))
-	copiedSession.events = append(copiedSession.events, filteredEvents...)
-
-	return &GetResponse{
-		Session: copiedSession,
-	}, nil
+	return events
 }
 
 func (s *inMemoryService) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
@@ -166,6 +226,9 @@ func (s *inMemoryService) List(ctx context.Context, req *ListRequest) (*ListResp
 		if key.appName != appName && key.userID != userID {
 			break
 		}
+		if s.expired(k) || !MatchLabels(storedSession, req.Labels) {
+			continue
+		}
 		copiedSession := copySessionWithoutStateAndEvents(storedSession)
 		copiedSession.state = s.mergeStates(storedSession.state, appName, storedSession.UserID())
 		sessions = append(sessions, copiedSession)
@@ -190,10 +253,112 @@ func (s *inMemoryService) Delete(ctx context.Context, req *DeleteRequest) error
 		sessionID: sessionID,
 	}
 
-	s.sessions.Delete(id.Encode())
+	if storedSession, ok := s.sessions.Get(id.Encode()); ok {
+		s.remove(id.Encode(), storedSession)
+	}
 	return nil
 }
 
+// remove deletes the stored session, and its share of the app statistics.
+// The caller must hold s.mu.
+func (s *inMemoryService) remove(key string, storedSession *session) {
+	stats := s.statsFor(storedSession.AppName())
+	stats.Sessions--
+	s.countEvents(storedSession, -len(storedSession.events))
+	stats.StateBytes -= storedSession.stateBytes
+	s.countUserSession(storedSession.AppName(), storedSession.UserID(), -1)
+	s.sessions.Delete(key)
+	delete(s.expiresAt, key)
+	delete(s.deadlines, key)
+}
+
+// countEvents adds n to the number of events of the app statistics and of
+// the user of the stored session. The caller must hold s.mu for writing.
+func (s *inMemoryService) countEvents(storedSession *session, n int) {
+	s.statsFor(storedSession.AppName()).Events += n
+	if s.userEvents == nil {
+		s.userEvents = make(map[string]map[string]int)
+	}
+	users := s.userEvents[storedSession.AppName()]
+	if users == nil {
+		users = make(map[string]int)
+		s.userEvents[storedSession.AppName()] = users
+	}
+	users[storedSession.UserID()] += n
+	if users[storedSession.UserID()] <= 0 {
+		delete(users, storedSession.UserID())
+	}
+}
+
+// checkUserEvents returns an error wrapping [ErrUserEventsExceeded] if the
+// user of the stored session can't take added more events. The caller must
+// hold s.mu for writing.
+func (s *inMemoryService) checkUserEvents(storedSession *session, added int) error {
+	appName, userID := storedSession.AppName(), storedSession.UserID()
+	err := s.cfg.MaxUserEvents.Check(appName, userID, s.userEvents[appName][userID], added)
+	if err != nil && len(s.expiresAt) > 0 {
+		// The events of expired sessions don't count, they are only
+		// removed lazily.
+		s.sweepExpired()
+		err = s.cfg.MaxUserEvents.Check(appName, userID, s.userEvents[appName][userID], added)
+	}
+	return err
+}
+
+// countUserSession adds n to the number of sessions of the user. The
+// caller must hold s.mu for writing.
+func (s *inMemoryService) countUserSession(appName, userID string, n int) {
+	if s.userSessions == nil {
+		s.userSessions = make(map[string]map[string]int)
+	}
+	users := s.userSessions[appName]
+	if users == nil {
+		users = make(map[string]int)
+		s.userSessions[appName] = users
+	}
+	users[userID] += n
+	if users[userID] <= 0 {
+		delete(users, userID)
+	}
+}
+
+// AppStats implements [StatsService].
+func (s *inMemoryService) AppStats(ctx context.Context) (map[string]AppStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make(map[string]AppStats, len(s.appStats))
+	for appName, appStats := range s.appStats {
+		stats[appName] = *appStats
+	}
+	return stats, nil
+}
+
+// statsFor returns the statistics of the app, creating them if needed.
+// The caller must hold s.mu.
+func (s *inMemoryService) statsFor(appName string) *AppStats {
+	if s.appStats == nil {
+		s.appStats = make(map[string]*AppStats)
+	}
+	stats, ok := s.appStats[appName]
+	if !ok {
+		stats = &AppStats{}
+		s.appStats[appName] = stats
+	}
+	return stats
+}
+
+// updateStateBytes recomputes the state size of the stored session and
+// applies the difference to the app statistics. The caller must hold s.mu.
+func (s *inMemoryService) updateStateBytes(storedSession *session) {
+	var size int64
+	if encoded, err := json.Marshal(storedSession.state); err == nil {
+		size = int64(len(encoded))
+	}
+	s.statsFor(storedSession.AppName()).StateBytes += size - storedSession.stateBytes
+	storedSession.stateBytes = size
+}
+
 func (s *inMemoryService) AppendEvent(ctx context.Context, curSession Session, event *Event) error {
 	if curSession == nil {
 		return fmt.Errorf("session is nil")
@@ -209,13 +374,41 @@ func (s *inMemoryService) AppendEvent(ctx context.Context, curSession Session, e
 	if !ok {
 		return fmt.Errorf("unexpected session type %T", sess)
 	}
+	if err := s.cfg.ContentLimits.ForApp(sess.AppName()).Apply(event); err != nil {
+		return err
+	}
+	if err := s.cfg.Ingestion.Admit(ctx, sess.AppName(), sess.UserID(), sess.ID()); err != nil {
+		return err
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	stored_session, ok := s.sessions.Get(sess.id.Encode())
+	stored_session, ok := s.lookup(sess.id.Encode())
 	if !ok {
-		return fmt.Errorf("session not found, cannot apply event")
+		return fmt.Errorf("%w, cannot apply event", ErrSessionNotFound)
+	}
+
+	if err := s.checkLease(ctx, stored_session); err != nil {
+		return err
+	}
+	if err := s.resolveDirectives(stored_session, event); err != nil {
+		return err
+	}
+	if original := s.replayedEvent(stored_session, trimTempDeltaState(event)); original != nil {
+		// The retry gets the stored event, with its ID and sequence, as if
+		// it was the append which stored it.
+		*event = *original
+		return nil
+	}
+	if err := s.cfg.MaxEvents.Check(stored_session.AppName(), stored_session.ID(), len(stored_session.events), 1); err != nil {
+		return err
+	}
+	if err := s.checkUserEvents(stored_session, 1); err != nil {
+		return err
+	}
+	if err := s.cfg.MaxStateKeys.Check(stored_session.AppName(), stored_session.ID(), s.stateAfter(stored_session, nil), event.Actions.StateDelta); err != nil {
+		return err
 	}
 
 	// update the in-memory session
@@ -224,21 +417,444 @@ func (s *inMemoryService) AppendEvent(ctx context.Context, curSession Session, e
 	}
 
 	// update the in-memory session service
-	stored_session.events = append(stored_session.events, event)
-	stored_session.updatedAt = event.Timestamp
-	if len(event.Actions.StateDelta) > 0 {
-		appDelta, userDelta, sessionDelta := sessionutils.ExtractStateDeltas(event.Actions.StateDelta)
-		s.updateAppState(appDelta, curSession.AppName())
-		s.updateUserState(userDelta, curSession.AppName(), curSession.UserID())
-		for key, value := range sessionDelta {
+	s.storeEvent(stored_session, event)
+	sess.updatedAt = stored_session.updatedAt
+	return nil
+}
+
+// Transact implements [TransactionService]. All sessions are looked up
+// before any event is stored, so a failing operation leaves every session
+// unchanged.
+func (s *inMemoryService) Transact(ctx context.Context, req *TransactRequest) (*TransactResponse, error) {
+	if req == nil || len(req.Ops) == 0 {
+		return nil, fmt.Errorf("transaction has no operations")
+	}
+
+	// Process the operations ordered by session key. The whole transaction
+	// runs under s.mu, the stable order keeps concurrent transactions
+	// deadlock-free should the locking become more fine-grained.
+	order := make([]int, len(req.Ops))
+	for i := range order {
+		order[i] = i
+	}
+	keys := make([]string, len(req.Ops))
+	for i, op := range req.Ops {
+		if op.AppName == "" || op.UserID == "" || op.SessionID == "" {
+			return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", op.AppName, op.UserID, op.SessionID)
+		}
+		if op.Event == nil {
+			return nil, fmt.Errorf("event is nil for session %q", op.SessionID)
+		}
+		if err := s.cfg.ContentLimits.ForApp(op.AppName).Apply(op.Event); err != nil {
+			return nil, fmt.Errorf("session %q: %w, transaction aborted", op.SessionID, err)
+		}
+		if !op.Event.Partial {
+			// Admitted before s.mu is taken, like the appends.
+			if err := s.cfg.Ingestion.Admit(ctx, op.AppName, op.UserID, op.SessionID); err != nil {
+				return nil, fmt.Errorf("session %q: %w, transaction aborted", op.SessionID, err)
+			}
+		}
+		keys[i] = id{appName: op.AppName, userID: op.UserID, sessionID: op.SessionID}.Encode()
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return strings.Compare(keys[a], keys[b])
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make([]*session, len(req.Ops))
+	// added counts the events appended to each session by the transaction,
+	// userAdded to each user.
+	added := make(map[*session]int)
+	userAdded := make(map[[2]string]int)
+	// earlier holds the resolved deltas of the operations processed so
+	// far, which the directives of the next ones are resolved after.
+	var earlier []pendingDelta
+	for _, i := range order {
+		storedSession, ok := s.lookup(keys[i])
+		if !ok {
+			return nil, fmt.Errorf("%w: %q, transaction aborted", ErrSessionNotFound, req.Ops[i].SessionID)
+		}
+		stored[i] = storedSession
+		if err := s.checkLease(ctx, storedSession); err != nil {
+			return nil, fmt.Errorf("%w, transaction aborted", err)
+		}
+		if !req.Ops[i].Event.Partial {
+			added[storedSession]++
+			if err := s.cfg.MaxEvents.Check(storedSession.AppName(), storedSession.ID(), len(storedSession.events), added[storedSession]); err != nil {
+				return nil, fmt.Errorf("%w, transaction aborted", err)
+			}
+			user := [2]string{storedSession.AppName(), storedSession.UserID()}
+			userAdded[user]++
+			if err := s.checkUserEvents(storedSession, userAdded[user]); err != nil {
+				return nil, fmt.Errorf("%w, transaction aborted", err)
+			}
+		}
+		if err := s.resolveDirectivesAfter(storedSession, req.Ops[i].Event, earlier); err != nil {
+			return nil, fmt.Errorf("session %q: %w, transaction aborted", req.Ops[i].SessionID, err)
+		}
+		if !req.Ops[i].Event.Partial {
+			if err := s.cfg.MaxStateKeys.Check(storedSession.AppName(), storedSession.ID(), s.stateAfter(storedSession, earlier), req.Ops[i].Event.Actions.StateDelta); err != nil {
+				return nil, fmt.Errorf("%w, transaction aborted", err)
+			}
+			earlier = append(earlier, pendingDelta{session: storedSession, delta: req.Ops[i].Event.Actions.StateDelta})
+		}
+	}
+
+	for _, i := range order {
+		event := trimTempDeltaState(req.Ops[i].Event)
+		if event.Partial {
+			continue
+		}
+		s.storeEvent(stored[i], event)
+	}
+
+	sessions := make([]Session, len(req.Ops))
+	for i, storedSession := range stored {
+		copiedSession := copySessionWithoutStateAndEvents(storedSession)
+		copiedSession.state = s.mergeStates(storedSession.state, storedSession.AppName(), storedSession.UserID())
+		copiedSession.events = slices.Clone(storedSession.events)
+		sessions[i] = copiedSession
+	}
+	return &TransactResponse{Sessions: sessions}, nil
+}
+
+// Compact implements [CompactionService].
+func (s *inMemoryService) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
+	if appName == "" || userID == "" || sessionID == "" {
+		return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
+	}
+	if req.Before.IsZero() == (req.Count <= 0) {
+		return nil, fmt.Errorf("exactly one of before and count is required")
+	}
+	if req.SummaryKey == "" || strings.HasPrefix(req.SummaryKey, KeyPrefixTemp) {
+		return nil, fmt.Errorf("invalid summary key %q", req.SummaryKey)
+	}
+	if req.Summarizer == nil {
+		return nil, fmt.Errorf("summarizer is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := id{
+		appName:   appName,
+		userID:    userID,
+		sessionID: sessionID,
+	}
+	storedSession, ok := s.lookup(id.Encode())
+	if !ok {
+		return nil, fmt.Errorf("%w: %+v", ErrSessionNotFound, sessionID)
+	}
+	if err := s.checkLease(ctx, storedSession); err != nil {
+		return nil, err
+	}
+
+	// Events are sorted by timestamp, the compacted events are a prefix.
+	n := min(req.Count, len(storedSession.events))
+	if !req.Before.IsZero() {
+		n = sort.Search(len(storedSession.events), func(i int) bool {
+			return !storedSession.events[i].Timestamp.Before(req.Before)
+		})
+	}
+	if n > 0 {
+		summary, err := req.Summarizer(ctx, slices.Clone(storedSession.events[:n]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize events: %w", err)
+		}
+		storedSession.events = slices.Delete(storedSession.events, 0, n)
+		s.countEvents(storedSession, -n)
+		s.applyStateDelta(storedSession, map[string]any{req.SummaryKey: summary})
+	}
+
+	copiedSession := copySessionWithoutStateAndEvents(storedSession)
+	copiedSession.state = s.mergeStates(storedSession.state, appName, userID)
+	copiedSession.events = slices.Clone(storedSession.events)
+	return &CompactResponse{
+		Session:   copiedSession,
+		Compacted: n,
+	}, nil
+}
+
+// Undo implements [UndoService].
+func (s *inMemoryService) Undo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	return s.undoOrRedo(ctx, req, false)
+}
+
+// Redo implements [UndoService].
+func (s *inMemoryService) Redo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	return s.undoOrRedo(ctx, req, true)
+}
+
+// undoOrRedo appends the event reverting the last change of the undo stack,
+// or reapplying the last one of the redo stack, and moves the change to the
+// other stack.
+func (s *inMemoryService) undoOrRedo(ctx context.Context, req *UndoRequest, redo bool) (*UndoResponse, error) {
+	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
+	if appName == "" || userID == "" || sessionID == "" {
+		return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
+	}
+	if s.cfg.UndoHistory.ForApp(appName) <= 0 {
+		return nil, fmt.Errorf("undo is not enabled for app %q: %w", appName, errors.ErrUnsupported)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storedSession, ok := s.lookup(id{appName: appName, userID: userID, sessionID: sessionID}.Encode())
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrSessionNotFound, sessionID)
+	}
+	if err := s.checkLease(ctx, storedSession); err != nil {
+		return nil, err
+	}
+	if storedSession.history == nil {
+		storedSession.history = &undoHistory{}
+	}
+	history := storedSession.history
+	stack, action := &history.undo, "undo"
+	if redo {
+		stack, action = &history.redo, "redo"
+	}
+	if len(*stack) == 0 {
+		if redo {
+			return nil, fmt.Errorf("%w in session %q", ErrNothingToRedo, sessionID)
+		}
+		return nil, fmt.Errorf("%w in session %q", ErrNothingToUndo, sessionID)
+	}
+	if err := s.cfg.MaxEvents.Check(appName, sessionID, len(storedSession.events), 1); err != nil {
+		return nil, err
+	}
+	if err := s.checkUserEvents(storedSession, 1); err != nil {
+		return nil, err
+	}
+	change := (*stack)[len(*stack)-1]
+	*stack = (*stack)[:len(*stack)-1]
+
+	event := NewEvent(action + "-" + uuid.NewString())
+	event.Author = cmp.Or(req.Author, "user")
+	if redo {
+		// The inverse is taken again from the current state, which must be
+		// the one the change was first applied to since the redo stack is
+		// cleared by any other change.
+		state := s.mergeStates(storedSession.state, appName, userID)
+		change, _ = newStateChange(state, change.delta)
+		event.Actions.StateDelta = maps.Clone(change.delta)
+		history.undo = append(history.undo, change)
+	} else {
+		event.Actions.StateDelta = maps.Clone(change.inverse)
+		history.redo = append(history.redo, change)
+	}
+	s.appendStoredEvent(storedSession, event)
+
+	copiedSession := copySessionWithoutStateAndEvents(storedSession)
+	copiedSession.state = s.mergeStates(storedSession.state, appName, userID)
+	copiedSession.events = slices.Clone(storedSession.events)
+	return &UndoResponse{
+		Session:   copiedSession,
+		Event:     event,
+		UndoDepth: len(history.undo),
+		RedoDepth: len(history.redo),
+	}, nil
+}
+
+// WatchUser implements [WatchService].
+func (s *inMemoryService) WatchUser(ctx context.Context, req *WatchUserRequest) (*Subscription, error) {
+	return s.watchers.subscribe(ctx, req)
+}
+
+// AcquireLease implements [LeaseService].
+func (s *inMemoryService) AcquireLease(ctx context.Context, req *AcquireLeaseRequest) (*Lease, error) {
+	key, err := s.leaseKey(req.AppName, req.UserID, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.leases.acquire(ctx, key, req)
+}
+
+// RenewLease implements [LeaseService].
+func (s *inMemoryService) RenewLease(ctx context.Context, req *RenewLeaseRequest) (*Lease, error) {
+	key, err := s.leaseKey(req.AppName, req.UserID, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.leases.renew(key, req)
+}
+
+// ReleaseLease implements [LeaseService].
+func (s *inMemoryService) ReleaseLease(ctx context.Context, req *ReleaseLeaseRequest) error {
+	key, err := s.leaseKey(req.AppName, req.UserID, req.SessionID)
+	if err != nil {
+		return err
+	}
+	return s.leases.release(key, req)
+}
+
+// leaseKey returns the key of the leases of an existing session.
+func (s *inMemoryService) leaseKey(appName, userID, sessionID string) (string, error) {
+	if appName == "" || userID == "" || sessionID == "" {
+		return "", fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
+	}
+	key := id{appName: appName, userID: userID, sessionID: sessionID}.Encode()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.lookup(key); !ok {
+		return "", fmt.Errorf("%w: %q", ErrSessionNotFound, sessionID)
+	}
+	return key, nil
+}
+
+// checkLease returns an error if leases are required and the session is
+// leased with another token than the one of the context.
+func (s *inMemoryService) checkLease(ctx context.Context, storedSession *session) error {
+	if !s.cfg.RequireLease {
+		return nil
+	}
+	return s.leases.checkWrite(ctx, storedSession.id.Encode(), storedSession.ID())
+}
+
+// resolveDirectives replaces the state directives of the event delta with
+// the changes they resolve to against the stored session state.
+// The caller must hold s.mu.
+func (s *inMemoryService) resolveDirectives(storedSession *session, event *Event) error {
+	return s.resolveDirectivesAfter(storedSession, event, nil)
+}
+
+// pendingDelta is the resolved state delta of an operation of a
+// transaction, not stored yet.
+type pendingDelta struct {
+	session *session
+	delta   map[string]any
+}
+
+// resolveDirectivesAfter is resolveDirectives against the stored session
+// state as the earlier deltas of a transaction leave it, see stateAfter.
+// The caller must hold s.mu.
+func (s *inMemoryService) resolveDirectivesAfter(storedSession *session, event *Event, earlier []pendingDelta) error {
+	if !HasStateDirectives(event.Actions.StateDelta) {
+		return nil
+	}
+	resolved, err := ResolveStateDelta(s.stateAfter(storedSession, earlier), event.Actions.StateDelta)
+	if err != nil {
+		return fmt.Errorf("failed to resolve state delta: %w", err)
+	}
+	event.Actions.StateDelta = resolved
+	return nil
+}
+
+// stateAfter returns the merged state of the stored session as the earlier
+// deltas of a transaction leave it: they apply to it if they change its
+// session keys, or the user or app keys it shares. The caller must hold
+// s.mu.
+func (s *inMemoryService) stateAfter(storedSession *session, earlier []pendingDelta) stateMap {
+	state := s.mergeStates(storedSession.state, storedSession.AppName(), storedSession.UserID())
+	if len(earlier) > 0 {
+		state = maps.Clone(state)
+	}
+	for _, pending := range earlier {
+		sameApp := pending.session.AppName() == storedSession.AppName()
+		for key, value := range pending.delta {
+			switch {
+			case strings.HasPrefix(key, KeyPrefixTemp):
+				continue
+			case strings.HasPrefix(key, KeyPrefixApp):
+				if !sameApp {
+					continue
+				}
+			case strings.HasPrefix(key, KeyPrefixUser):
+				if !sameApp || pending.session.UserID() != storedSession.UserID() {
+					continue
+				}
+			default:
+				if pending.session != storedSession {
+					continue
+				}
+			}
 			if value == nil {
-				delete(stored_session.state, key)
+				delete(state, key)
 			} else {
-				stored_session.state[key] = value
+				state[key] = value
 			}
 		}
 	}
-	return nil
+	return state
+}
+
+// replayedEvent returns the most recent event of the stored session if the
+// event repeats it within the configured replay window, or nil. The window
+// is measured with the clock of the service from the time the event was
+// stored, the timestamps clients set don't matter.
+func (s *inMemoryService) replayedEvent(storedSession *session, event *Event) *Event {
+	if s.cfg.ReplayWindow <= 0 || len(storedSession.events) == 0 {
+		return nil
+	}
+	last := storedSession.events[len(storedSession.events)-1]
+	if last.Author != event.Author || s.now().Sub(storedSession.appendedAt) > s.cfg.ReplayWindow {
+		return nil
+	}
+	lastHash, err := eventContentHash(last)
+	if err != nil {
+		return nil
+	}
+	hash, err := eventContentHash(event)
+	if err != nil || lastHash != hash {
+		return nil
+	}
+	return last
+}
+
+// storeEvent appends the event to the stored session and applies its state
+// delta to the session, user and app states, recording the change for undo
+// if enabled. The caller must hold s.mu.
+func (s *inMemoryService) storeEvent(storedSession *session, event *Event) {
+	if limit := s.cfg.UndoHistory.ForApp(storedSession.AppName()); limit > 0 && len(event.Actions.StateDelta) > 0 {
+		state := s.mergeStates(storedSession.state, storedSession.AppName(), storedSession.UserID())
+		if change, ok := newStateChange(state, event.Actions.StateDelta); ok {
+			if storedSession.history == nil {
+				storedSession.history = &undoHistory{}
+			}
+			storedSession.history.record(change, limit)
+		}
+	}
+	s.appendStoredEvent(storedSession, event)
+}
+
+// appendStoredEvent is storeEvent without recording the change for undo.
+// The caller must hold s.mu.
+func (s *inMemoryService) appendStoredEvent(storedSession *session, event *Event) {
+	storedSession.sequence++
+	event.Sequence = storedSession.sequence
+	storedSession.events = append(storedSession.events, event)
+	storedSession.appendedAt = s.now()
+	if s.cfg.AllowUpdatedAtRegression || event.Timestamp.After(storedSession.updatedAt) {
+		storedSession.updatedAt = event.Timestamp
+	}
+	s.countEvents(storedSession, 1)
+	s.applyStateDelta(storedSession, event.Actions.StateDelta)
+	s.trimEvents(storedSession)
+	s.watchers.publish(storedSession.AppName(), storedSession.UserID(), storedSession.ID(), event)
+	s.extendExpiry(storedSession.id.Encode())
+}
+
+// applyStateDelta applies the delta to the session, user and app states of
+// the stored session. The caller must hold s.mu.
+func (s *inMemoryService) applyStateDelta(storedSession *session, delta map[string]any) {
+	if len(delta) == 0 {
+		return
+	}
+	defer s.updateStateBytes(storedSession)
+	appDelta, userDelta, sessionDelta := sessionutils.ExtractStateDeltas(delta)
+	s.updateAppState(appDelta, storedSession.AppName())
+	s.updateUserState(userDelta, storedSession.AppName(), storedSession.UserID())
+	for key, value := range sessionDelta {
+		if value == nil {
+			delete(storedSession.state, key)
+		} else {
+			storedSession.state[key] = value
+		}
+	}
 }
 
 func (s *inMemoryService) updateAppState(appDelta stateMap, appName string) stateMap {
@@ -310,6 +926,23 @@ type session struct {
 	events    []*Event
 	state     map[string]any
 	updatedAt time.Time
+	// labels are the labels of the session, see [LabelService].
+	labels map[string]string
+
+	// stateBytes is the size of the JSON encoded state, tracked for
+	// [AppStats] of stored sessions.
+	stateBytes int64
+	// history holds the state changes of stored sessions, for
+	// [UndoService]. It is nil until a change is recorded.
+	history *undoHistory
+	// sequence is the [Event.Sequence] of the last event appended to a
+	// stored session. Events trimmed or compacted away keep their
+	// sequence used.
+	sequence int64
+	// appendedAt is the time, on the clock of the service, the last event
+	// was appended to a stored session, see
+	// [InMemoryServiceConfig.ReplayWindow].
+	appendedAt time.Time
 }
 
 func (s *session) ID() string {
@@ -473,7 +1106,20 @@ func copySessionWithoutStateAndEvents(sess *session) *session {
 			sessionID: sess.id.sessionID,
 		},
 		updatedAt: sess.updatedAt,
+		labels:    maps.Clone(sess.labels),
 	}
 }
 
-var _ Service = (*inMemoryService)(nil)
+var (
+	_ Service            = (*inMemoryService)(nil)
+	_ TransactionService = (*inMemoryService)(nil)
+	_ StatsService       = (*inMemoryService)(nil)
+	_ CompactionService  = (*inMemoryService)(nil)
+	_ WatchService       = (*inMemoryService)(nil)
+	_ LeaseService       = (*inMemoryService)(nil)
+	_ UndoService        = (*inMemoryService)(nil)
+	_ TouchService       = (*inMemoryService)(nil)
+	_ LabelService       = (*inMemoryService)(nil)
+	_ PinService         = (*inMemoryService)(nil)
+	_ LabeledSession     = (*session)(nil)
+)
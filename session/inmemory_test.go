@@ -15,6 +15,9 @@
 package session
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"maps"
 	"strconv"
 	"strings"
@@ -291,11 +294,11 @@ func Test_databaseService_Get(t *testing.T) {
 				AppName: "my_app", UserID: "user", SessionID: "s1",
 			},
 			wantEvents: []*Event{
-				{ID: "1", Author: "user", Timestamp: time.Time{}.Add(1), LLMResponse: model.LLMResponse{}},
-				{ID: "2", Author: "user", Timestamp: time.Time{}.Add(2), LLMResponse: model.LLMResponse{}},
-				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3), LLMResponse: model.LLMResponse{}},
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), LLMResponse: model.LLMResponse{}},
+				{ID: "1", Author: "user", Timestamp: time.Time{}.Add(1), Sequence: 1, LLMResponse: model.LLMResponse{}},
+				{ID: "2", Author: "user", Timestamp: time.Time{}.Add(2), Sequence: 2, LLMResponse: model.LLMResponse{}},
+				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3), Sequence: 3, LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 		{
@@ -306,9 +309,9 @@ func Test_databaseService_Get(t *testing.T) {
 				NumRecentEvents: 3,
 			},
 			wantEvents: []*Event{
-				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3), LLMResponse: model.LLMResponse{}},
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), LLMResponse: model.LLMResponse{}},
+				{ID: "3", Author: "user", Timestamp: time.Time{}.Add(3), Sequence: 3, LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 		{
@@ -319,8 +322,8 @@ func Test_databaseService_Get(t *testing.T) {
 				After: time.Time{}.Add(4),
 			},
 			wantEvents: []*Event{
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 		{
@@ -332,8 +335,8 @@ func Test_databaseService_Get(t *testing.T) {
 				After:           time.Time{}.Add(4),
 			},
 			wantEvents: []*Event{
-				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), LLMResponse: model.LLMResponse{}},
-				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), LLMResponse: model.LLMResponse{}},
+				{ID: "4", Author: "user", Timestamp: time.Time{}.Add(4), Sequence: 4, LLMResponse: model.LLMResponse{}},
+				{ID: "5", Author: "user", Timestamp: time.Time{}.Add(5), Sequence: 5, LLMResponse: model.LLMResponse{}},
 			},
 		},
 	}
@@ -543,7 +546,8 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				},
 				events: []*Event{
 					{
-						ID: "new_event1",
+						ID:       "new_event1",
+						Sequence: 1,
 						LLMResponse: model.LLMResponse{
 							Partial: false,
 						},
@@ -585,7 +589,8 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 						},
 					},
 					{
-						ID: "new_event1",
+						ID:       "new_event1",
+						Sequence: 1,
 						LLMResponse: model.LLMResponse{
 							Partial: false,
 						},
@@ -648,8 +653,9 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				},
 				events: []*Event{
 					{
-						ID:     "event_with_bytes",
-						Author: "user",
+						ID:       "event_with_bytes",
+						Sequence: 1,
+						Author:   "user",
 						LLMResponse: model.LLMResponse{
 							Content: genai.NewContentFromBytes([]byte("test_image_data"), "image/png", "user"),
 							GroundingMetadata: &genai.GroundingMetadata{
@@ -716,6 +722,7 @@ func Test_databaseService_AppendEvent(t *testing.T) {
 				events: []*Event{
 					{
 						ID:                 "event_complete",
+						Sequence:           1,
 						Author:             "user",
 						LongRunningToolIDs: []string{"tool123"},
 						Actions:            EventActions{StateDelta: map[string]any{"k2": "v2"}},
@@ -1232,3 +1239,795 @@ func Test_inMemoryService_CreateConcurrentAccess(t *testing.T) {
 		t.Errorf("expected %d 'already exists' errors, but got %d", expectedErrors, errorCount.Load())
 	}
 }
+
+func Test_inMemoryService_EventSequenceConcurrentAppends(t *testing.T) {
+	s := InMemoryService()
+	const goroutines = 16
+	const appends = 32
+	ctx := t.Context()
+	req := &GetRequest{AppName: "race-app", UserID: "race-user", SessionID: "race-session"}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: req.AppName, UserID: req.UserID, SessionID: req.SessionID}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Every event has the same timestamp, only the sequence orders them.
+	timestamp := time.Now()
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for g := range goroutines {
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := range appends {
+				got, err := s.Get(ctx, req)
+				if err != nil {
+					t.Errorf("Get() error = %v", err)
+					return
+				}
+				event := &Event{ID: fmt.Sprintf("%d-%d", g, i), Timestamp: timestamp}
+				if err := s.AppendEvent(ctx, got.Session, event); err != nil {
+					t.Errorf("AppendEvent() error = %v", err)
+					return
+				}
+				if event.Sequence == 0 {
+					t.Errorf("AppendEvent() left the sequence of event %s unassigned", event.ID)
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	got, err := s.Get(ctx, req)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if n := got.Session.Events().Len(); n != goroutines*appends {
+		t.Fatalf("got %d events, want %d", n, goroutines*appends)
+	}
+	// The events are in the order of their sequences, which have no gap,
+	// and the events of each goroutine in the order it appended them.
+	last := map[int]int{}
+	for i := 0; i < got.Session.Events().Len(); i++ {
+		event := got.Session.Events().At(i)
+		if want := int64(i + 1); event.Sequence != want {
+			t.Errorf("event %d (%s) has sequence %d, want %d", i, event.ID, event.Sequence, want)
+		}
+		var g, n int
+		if _, err := fmt.Sscanf(event.ID, "%d-%d", &g, &n); err != nil {
+			t.Fatalf("unexpected event ID %q", event.ID)
+		}
+		if prev, ok := last[g]; ok && n <= prev {
+			t.Errorf("event %s is after event %d-%d", event.ID, g, prev)
+		}
+		last[g] = n
+	}
+}
+
+func Test_inMemoryService_Transact(t *testing.T) {
+	tests := []struct {
+		name       string
+		ops        func(from, to Session) []TransactOp
+		wantErr    bool
+		wantFrom   map[string]any
+		wantTo     map[string]any
+		wantEvents int
+	}{
+		{
+			name: "moves value between sessions",
+			ops: func(from, to Session) []TransactOp {
+				return []TransactOp{
+					{AppName: "app", UserID: "user", SessionID: from.ID(), Event: stateEvent(map[string]any{"coin": nil})},
+					{AppName: "app", UserID: "user", SessionID: to.ID(), Event: stateEvent(map[string]any{"coin": 1})},
+				}
+			},
+			wantFrom:   map[string]any{},
+			wantTo:     map[string]any{"coin": 1},
+			wantEvents: 1,
+		},
+		{
+			name: "failing second operation leaves both sessions unchanged",
+			ops: func(from, to Session) []TransactOp {
+				return []TransactOp{
+					{AppName: "app", UserID: "user", SessionID: from.ID(), Event: stateEvent(map[string]any{"coin": nil})},
+					{AppName: "app", UserID: "user", SessionID: "missing", Event: stateEvent(map[string]any{"coin": 1})},
+				}
+			},
+			wantErr:  true,
+			wantFrom: map[string]any{"coin": 1},
+			wantTo:   map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := InMemoryService()
+			from, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "from", State: map[string]any{"coin": 1}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "to"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.(TransactionService).Transact(t.Context(), &TransactRequest{Ops: tt.ops(from.Session, to.Session)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for sessionID, want := range map[string]map[string]any{"from": tt.wantFrom, "to": tt.wantTo} {
+				got, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(want, maps.Collect(got.Session.State().All())); diff != "" {
+					t.Errorf("session %q state mismatch (-want +got):\n%s", sessionID, diff)
+				}
+				if got.Session.Events().Len() != tt.wantEvents {
+					t.Errorf("session %q has %d events, want %d", sessionID, got.Session.Events().Len(), tt.wantEvents)
+				}
+			}
+		})
+	}
+}
+
+func Test_inMemoryService_Transact_SequentialDirectives(t *testing.T) {
+	s := InMemoryService()
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := s.(TransactionService).Transact(t.Context(), &TransactRequest{Ops: []TransactOp{
+		{AppName: "app", UserID: "user", SessionID: "s1", Event: stateEvent(map[string]any{"tags": AddUnique{Value: "a"}, "user:best": KeepMax{Value: 2}})},
+		{AppName: "app", UserID: "user", SessionID: "s1", Event: stateEvent(map[string]any{"tags": AddUnique{Value: "b"}})},
+		{AppName: "app", UserID: "user", SessionID: "s2", Event: stateEvent(map[string]any{"tags": AddUnique{Value: "c"}, "user:best": KeepMax{Value: 1}})},
+	}})
+	if err != nil {
+		t.Fatalf("Transact() error = %v", err)
+	}
+
+	want := map[string]map[string]any{
+		"s1": {"tags": []any{"a", "b"}, "user:best": 2},
+		"s2": {"tags": []any{"c"}, "user:best": 2},
+	}
+	for id, want := range want {
+		got, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, maps.Collect(got.Session.State().All())); diff != "" {
+			t.Errorf("session %q state mismatch (-want +got):\n%s", id, diff)
+		}
+	}
+}
+
+func stateEvent(delta map[string]any) *Event {
+	event := NewEvent("invocation")
+	event.Author = "user"
+	event.Actions.StateDelta = delta
+	return event
+}
+
+func Test_inMemoryService_ReplayWindow(t *testing.T) {
+	const window = 2 * time.Second
+	tests := []struct {
+		name      string
+		replayWin time.Duration
+		delay     time.Duration
+		// stamp is the timestamp of the retry, after the first event.
+		stamp      time.Duration
+		author     string
+		text       string
+		wantEvents int
+	}{
+		{
+			name:       "duplicate within the window is suppressed",
+			replayWin:  window,
+			delay:      time.Second,
+			author:     "user",
+			text:       "hello",
+			wantEvents: 1,
+		},
+		{
+			name:       "duplicate after the window is appended",
+			replayWin:  window,
+			delay:      3 * time.Second,
+			author:     "user",
+			text:       "hello",
+			wantEvents: 2,
+		},
+		{
+			name:       "backdated duplicate after the window is appended",
+			replayWin:  window,
+			delay:      3 * time.Second,
+			stamp:      time.Second,
+			author:     "user",
+			text:       "hello",
+			wantEvents: 2,
+		},
+		{
+			name:       "postdated duplicate within the window is suppressed",
+			replayWin:  window,
+			delay:      time.Second,
+			stamp:      time.Hour,
+			author:     "user",
+			text:       "hello",
+			wantEvents: 1,
+		},
+		{
+			name:       "different content within the window is appended",
+			replayWin:  window,
+			delay:      time.Second,
+			author:     "user",
+			text:       "hello again",
+			wantEvents: 2,
+		},
+		{
+			name:       "different author within the window is appended",
+			replayWin:  window,
+			delay:      time.Second,
+			author:     "agent",
+			text:       "hello",
+			wantEvents: 2,
+		},
+		{
+			name:       "replay protection disabled by default",
+			delay:      time.Second,
+			author:     "user",
+			text:       "hello",
+			wantEvents: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+			s := InMemoryServiceWithConfig(InMemoryServiceConfig{ReplayWindow: tt.replayWin, Now: clock.Now})
+			created, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := clock.now
+			first := &Event{
+				ID:          "first",
+				Author:      "user",
+				Timestamp:   start,
+				LLMResponse: model.LLMResponse{Content: genai.NewContentFromText("hello", genai.RoleUser)},
+			}
+			if err := s.AppendEvent(t.Context(), created.Session, first); err != nil {
+				t.Fatalf("AppendEvent() error = %v", err)
+			}
+			clock.advance(tt.delay)
+			retry := &Event{
+				ID:          "retry",
+				Author:      tt.author,
+				Timestamp:   start.Add(tt.stamp),
+				LLMResponse: model.LLMResponse{Content: genai.NewContentFromText(tt.text, genai.RoleUser)},
+			}
+			if err := s.AppendEvent(t.Context(), created.Session, retry); err != nil {
+				t.Fatalf("AppendEvent() error = %v", err)
+			}
+
+			got, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Session.Events().Len() != tt.wantEvents {
+				t.Errorf("got %d events, want %d", got.Session.Events().Len(), tt.wantEvents)
+			}
+			// A suppressed retry is set to the stored event.
+			wantID, wantSequence := "retry", int64(2)
+			if tt.wantEvents == 1 {
+				wantID, wantSequence = "first", 1
+			}
+			if retry.ID != wantID || retry.Sequence != wantSequence {
+				t.Errorf("retry is event %q with sequence %d, want %q with sequence %d", retry.ID, retry.Sequence, wantID, wantSequence)
+			}
+		})
+	}
+}
+
+func Test_inMemoryService_AppStats(t *testing.T) {
+	s := InMemoryService()
+	ctx := t.Context()
+
+	created := map[string]Session{}
+	for _, req := range []*CreateRequest{
+		{AppName: "app1", UserID: "user", SessionID: "s1"},
+		{AppName: "app1", UserID: "user", SessionID: "s2"},
+		{AppName: "app2", UserID: "user", SessionID: "s1", State: map[string]any{"k": "v"}},
+	} {
+		resp, err := s.Create(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		created[req.AppName+"/"+req.SessionID] = resp.Session
+	}
+
+	assertStats := func(want map[string]AppStats) {
+		t.Helper()
+		got, err := s.(StatsService).AppStats(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("AppStats() mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	assertStats(map[string]AppStats{
+		"app1": {Sessions: 2, StateBytes: 4, Events: 0},
+		"app2": {Sessions: 1, StateBytes: 9, Events: 0},
+	})
+
+	if err := s.AppendEvent(ctx, created["app1/s1"], stateEvent(map[string]any{"key": "value"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, created["app2/s1"], stateEvent(map[string]any{"k": nil})); err != nil {
+		t.Fatal(err)
+	}
+	assertStats(map[string]AppStats{
+		"app1": {Sessions: 2, StateBytes: 17, Events: 1},
+		"app2": {Sessions: 1, StateBytes: 2, Events: 1},
+	})
+
+	if err := s.Delete(ctx, &DeleteRequest{AppName: "app1", UserID: "user", SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	assertStats(map[string]AppStats{
+		"app1": {Sessions: 1, StateBytes: 2, Events: 0},
+		"app2": {Sessions: 1, StateBytes: 2, Events: 1},
+	})
+}
+
+func Test_inMemoryService_Compact(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// stubSummarizer joins the IDs of the summarized events.
+	stubSummarizer := func(ctx context.Context, events []*Event) (any, error) {
+		var ids []string
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		return strings.Join(ids, ","), nil
+	}
+
+	tests := []struct {
+		name          string
+		req           CompactRequest
+		wantErr       bool
+		wantCompacted int
+		wantEventIDs  []string
+		wantSummary   any
+	}{
+		{
+			name:          "by count",
+			req:           CompactRequest{Count: 2, SummaryKey: "summary", Summarizer: stubSummarizer},
+			wantCompacted: 2,
+			wantEventIDs:  []string{"e2", "e3"},
+			wantSummary:   "e0,e1",
+		},
+		{
+			name:          "count larger than history",
+			req:           CompactRequest{Count: 10, SummaryKey: "summary", Summarizer: stubSummarizer},
+			wantCompacted: 4,
+			wantEventIDs:  []string{},
+			wantSummary:   "e0,e1,e2,e3",
+		},
+		{
+			name:          "by age",
+			req:           CompactRequest{Before: base.Add(3 * time.Minute), SummaryKey: "summary", Summarizer: stubSummarizer},
+			wantCompacted: 3,
+			wantEventIDs:  []string{"e3"},
+			wantSummary:   "e0,e1,e2",
+		},
+		{
+			name:          "nothing to compact",
+			req:           CompactRequest{Before: base, SummaryKey: "summary", Summarizer: stubSummarizer},
+			wantCompacted: 0,
+			wantEventIDs:  []string{"e0", "e1", "e2", "e3"},
+			wantSummary:   nil,
+		},
+		{
+			name:         "summarizer error leaves session unchanged",
+			req:          CompactRequest{Count: 2, SummaryKey: "summary", Summarizer: func(context.Context, []*Event) (any, error) { return nil, fmt.Errorf("boom") }},
+			wantErr:      true,
+			wantEventIDs: []string{"e0", "e1", "e2", "e3"},
+		},
+		{
+			name:         "both cutoffs",
+			req:          CompactRequest{Count: 2, Before: base, SummaryKey: "summary", Summarizer: stubSummarizer},
+			wantErr:      true,
+			wantEventIDs: []string{"e0", "e1", "e2", "e3"},
+		},
+		{
+			name:         "temp summary key",
+			req:          CompactRequest{Count: 2, SummaryKey: KeyPrefixTemp + "summary", Summarizer: stubSummarizer},
+			wantErr:      true,
+			wantEventIDs: []string{"e0", "e1", "e2", "e3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := t.Context()
+			s := InMemoryService()
+			created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range 4 {
+				event := stateEvent(map[string]any{fmt.Sprintf("k%d", i): i})
+				event.ID = fmt.Sprintf("e%d", i)
+				event.Timestamp = base.Add(time.Duration(i) * time.Minute)
+				if err := s.AppendEvent(ctx, created.Session, event); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := tt.req
+			req.AppName, req.UserID, req.SessionID = "app", "user", "session"
+			resp, err := s.(CompactionService).Compact(ctx, &req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && resp.Compacted != tt.wantCompacted {
+				t.Errorf("Compact() compacted = %d, want %d", resp.Compacted, tt.wantCompacted)
+			}
+
+			got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotEventIDs := []string{}
+			for e := range got.Session.Events().All() {
+				gotEventIDs = append(gotEventIDs, e.ID)
+			}
+			if diff := cmp.Diff(tt.wantEventIDs, gotEventIDs); diff != "" {
+				t.Errorf("events mismatch (-want +got):\n%s", diff)
+			}
+			summary, err := got.Session.State().Get("summary")
+			if tt.wantSummary == nil {
+				if !errors.Is(err, ErrStateKeyNotExist) {
+					t.Errorf("State().Get(summary) = %v, %v, want ErrStateKeyNotExist", summary, err)
+				}
+				return
+			}
+			if diff := cmp.Diff(tt.wantSummary, summary); diff != "" {
+				t.Errorf("summary mismatch (-want +got):\n%s", diff)
+			}
+			// The state written by the compacted events is kept.
+			if _, err := got.Session.State().Get("k0"); err != nil {
+				t.Errorf("State().Get(k0) error = %v", err)
+			}
+		})
+	}
+}
+
+func Test_inMemoryService_ContentLimits(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		ContentLimits: ContentLimits{
+			Apps: map[string]ContentLimit{
+				"strict":  {MaxBytes: 5, Mode: ContentLimitReject},
+				"lenient": {MaxBytes: 5, Mode: ContentLimitTruncate},
+			},
+		},
+	})
+
+	tests := []struct {
+		appName   string
+		text      string
+		wantErr   error
+		wantParts []string
+	}{
+		{appName: "strict", text: "12345", wantParts: []string{"12345"}},
+		{appName: "strict", text: "123456", wantErr: ErrEventContentTooLarge},
+		{appName: "lenient", text: "12345", wantParts: []string{"12345"}},
+		{appName: "lenient", text: "123456", wantParts: []string{"12345", "[content truncated: 5 of 6 bytes kept]"}},
+		{appName: "unlimited", text: "123456", wantParts: []string{"123456"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.appName+"/"+tt.text, func(t *testing.T) {
+			created, err := s.Create(ctx, &CreateRequest{AppName: tt.appName, UserID: "user"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := NewEvent("invocation")
+			event.Content = genai.NewContentFromText(tt.text, genai.RoleModel)
+			if err := s.AppendEvent(ctx, created.Session, event); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AppendEvent() error = %v, want %v", err, tt.wantErr)
+			}
+
+			got, err := s.Get(ctx, &GetRequest{AppName: tt.appName, UserID: "user", SessionID: created.Session.ID()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotParts []string
+			for e := range got.Session.Events().All() {
+				for _, part := range e.Content.Parts {
+					gotParts = append(gotParts, part.Text)
+				}
+			}
+			if diff := cmp.Diff(tt.wantParts, gotParts); diff != "" {
+				t.Errorf("stored content mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_inMemoryService_MaxEvents(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		MaxEvents: EventCountLimits{Default: 3, Apps: map[string]int{"small": 2}},
+	})
+
+	tests := []struct {
+		appName   string
+		wantLimit int
+	}{
+		{appName: "small", wantLimit: 2},
+		{appName: "other", wantLimit: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.appName, func(t *testing.T) {
+			created, err := s.Create(ctx, &CreateRequest{AppName: tt.appName, UserID: "user", SessionID: "session", State: map[string]any{"n": 0}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range tt.wantLimit {
+				if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": i + 1})); err != nil {
+					t.Fatalf("AppendEvent() %d error = %v", i, err)
+				}
+			}
+			err = s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": -1}))
+			if !errors.Is(err, ErrSessionFull) {
+				t.Fatalf("AppendEvent() past the cap error = %v, want ErrSessionFull", err)
+			}
+
+			// The rejected event leaves the session unchanged.
+			got, err := s.Get(ctx, &GetRequest{AppName: tt.appName, UserID: "user", SessionID: "session"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := got.Session.Events().Len(); n != tt.wantLimit {
+				t.Errorf("got %d events, want %d", n, tt.wantLimit)
+			}
+			if n, _ := got.Session.State().Get("n"); n != tt.wantLimit {
+				t.Errorf("state n = %v, want %d", n, tt.wantLimit)
+			}
+
+			// A transaction overflowing the session is rejected as a whole.
+			_, err = s.(TransactionService).Transact(ctx, &TransactRequest{Ops: []TransactOp{
+				{AppName: tt.appName, UserID: "user", SessionID: "session", Event: stateEvent(map[string]any{"n": -1})},
+			}})
+			if !errors.Is(err, ErrSessionFull) {
+				t.Errorf("Transact() error = %v, want ErrSessionFull", err)
+			}
+		})
+	}
+}
+
+func Test_inMemoryService_MaxUserEvents(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		MaxUserEvents: UserEventLimits{Default: 3},
+	})
+
+	sessions := make(map[string]Session)
+	for _, key := range [][2]string{{"user", "s1"}, {"user", "s2"}, {"other", "s1"}} {
+		created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: key[0], SessionID: key[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[key[0]+"/"+key[1]] = created.Session
+	}
+	appends := []struct {
+		session string
+		wantErr bool
+	}{
+		{session: "user/s1"},
+		{session: "user/s1"},
+		{session: "user/s2"},
+		// The sessions of the user hold 3 events together.
+		{session: "user/s2", wantErr: true},
+		{session: "user/s1", wantErr: true},
+		// Other users have their own quota.
+		{session: "other/s1"},
+	}
+	for i, a := range appends {
+		err := s.AppendEvent(ctx, sessions[a.session], stateEvent(map[string]any{"n": i}))
+		if a.wantErr && !errors.Is(err, ErrUserEventsExceeded) || !a.wantErr && err != nil {
+			t.Fatalf("AppendEvent() %d to %s error = %v, want ErrUserEventsExceeded: %v", i, a.session, err, a.wantErr)
+		}
+	}
+
+	// A transaction overflowing the quota across sessions is rejected as a
+	// whole.
+	_, err := s.(TransactionService).Transact(ctx, &TransactRequest{Ops: []TransactOp{
+		{AppName: "app", UserID: "other", SessionID: "s1", Event: stateEvent(map[string]any{"n": 1})},
+		{AppName: "app", UserID: "other", SessionID: "s1", Event: stateEvent(map[string]any{"n": 2})},
+		{AppName: "app", UserID: "user", SessionID: "s2", Event: stateEvent(map[string]any{"n": 3})},
+	}})
+	if !errors.Is(err, ErrUserEventsExceeded) {
+		t.Fatalf("Transact() error = %v, want ErrUserEventsExceeded", err)
+	}
+	got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "other", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Session.Events().Len(); n != 1 {
+		t.Errorf("got %d events after the aborted transaction, want 1", n)
+	}
+
+	// Compacting and deleting sessions of the user frees their events.
+	_, err = s.(CompactionService).Compact(ctx, &CompactRequest{
+		AppName: "app", UserID: "user", SessionID: "s1", Count: 1, SummaryKey: "summary",
+		Summarizer: func(ctx context.Context, events []*Event) (any, error) { return "summary", nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, sessions["user/s2"], stateEvent(map[string]any{"n": -1})); err != nil {
+		t.Fatalf("AppendEvent() after compaction error = %v", err)
+	}
+	if err := s.Delete(ctx, &DeleteRequest{AppName: "app", UserID: "user", SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, sessions["user/s2"], stateEvent(map[string]any{"n": -2})); err != nil {
+		t.Errorf("AppendEvent() after delete error = %v", err)
+	}
+}
+
+func Test_inMemoryService_MaxUserEventsExpiredSessions(t *testing.T) {
+	ctx := t.Context()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		SessionTTL:    time.Minute,
+		MaxUserEvents: UserEventLimits{Default: 2},
+		Now:           clock.Now,
+	})
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": i})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The events of the expired session don't count, although it isn't
+	// swept yet.
+	clock.advance(2 * time.Minute)
+	created, err = s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": 1})); err != nil {
+		t.Fatalf("AppendEvent() error = %v, want the events of the expired session not to count", err)
+	}
+	_, err = s.(TransactionService).Transact(ctx, &TransactRequest{Ops: []TransactOp{
+		{AppName: "app", UserID: "user", SessionID: "s2", Event: stateEvent(map[string]any{"n": 2})},
+	}})
+	if err != nil {
+		t.Fatalf("Transact() error = %v", err)
+	}
+	if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": 3})); !errors.Is(err, ErrUserEventsExceeded) {
+		t.Errorf("AppendEvent() error = %v, want ErrUserEventsExceeded", err)
+	}
+}
+
+func Test_inMemoryService_MaxStateKeys(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		MaxStateKeys: StateKeyLimits{Default: 3, Apps: map[string]int{"unlimited": 0}},
+	})
+	created := make(map[string]Session)
+	for _, key := range [][2]string{{"app", "s1"}, {"app", "s2"}, {"unlimited", "s1"}} {
+		resp, err := s.Create(ctx, &CreateRequest{AppName: key[0], UserID: "user", SessionID: key[1], State: map[string]any{"a": 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created[key[0]+"/"+key[1]] = resp.Session
+	}
+
+	appends := []struct {
+		session string
+		delta   map[string]any
+		wantErr bool
+	}{
+		{session: "app/s1", delta: map[string]any{"b": 2, "temp:t": 0}},
+		{session: "app/s1", delta: map[string]any{"c": 3}},
+		{session: "app/s1", delta: map[string]any{"d": 4}, wantErr: true},
+		// Changing and deleting keys doesn't grow the state.
+		{session: "app/s1", delta: map[string]any{"c": 30, "b": nil}},
+		{session: "app/s1", delta: map[string]any{"d": 4}},
+		// User keys count in every session of the user.
+		{session: "app/s2", delta: map[string]any{"user:u": 1, "b": 2}},
+		{session: "app/s1", delta: map[string]any{"e": 5}, wantErr: true},
+		{session: "unlimited/s1", delta: map[string]any{"b": 2, "c": 3, "d": 4}},
+	}
+	for i, a := range appends {
+		err := s.AppendEvent(ctx, created[a.session], stateEvent(a.delta))
+		if a.wantErr && !errors.Is(err, ErrStateKeysExceeded) || !a.wantErr && err != nil {
+			t.Fatalf("AppendEvent() %d to %s error = %v, want ErrStateKeysExceeded: %v", i, a.session, err, a.wantErr)
+		}
+	}
+
+	// The operations of a transaction are checked after the earlier ones:
+	// room freed by one is taken by the next, and operations each fine
+	// alone can't grow the state past the limit together.
+	transact := func(deltas ...map[string]any) error {
+		var ops []TransactOp
+		for _, delta := range deltas {
+			ops = append(ops, TransactOp{AppName: "app", UserID: "user", SessionID: "s2", Event: stateEvent(delta)})
+		}
+		_, err := s.(TransactionService).Transact(ctx, &TransactRequest{Ops: ops})
+		return err
+	}
+	if err := transact(map[string]any{"a": nil}, map[string]any{"c": 3}); err != nil {
+		t.Fatalf("Transact() freeing room first error = %v", err)
+	}
+	if err := transact(map[string]any{"b": nil, "c": nil}, map[string]any{"d": 4}, map[string]any{"e": 5}, map[string]any{"f": 6}); !errors.Is(err, ErrStateKeysExceeded) {
+		t.Fatalf("Transact() error = %v, want ErrStateKeysExceeded", err)
+	}
+	got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "s2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]any{"b": 2, "c": 3, "user:u": 1}, maps.Collect(got.Session.State().All())); diff != "" {
+		t.Errorf("state after the aborted transaction mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_inMemoryService_UpdatedAtClockSkew(t *testing.T) {
+	// The clock of the replica stamping the events goes backward.
+	start := time.Now()
+	clock := []time.Time{start.Add(time.Hour), start.Add(-time.Hour), start.Add(2 * time.Hour)}
+
+	tests := []struct {
+		name  string
+		cfg   InMemoryServiceConfig
+		wantT []time.Time
+	}{
+		{
+			name:  "clamped",
+			wantT: []time.Time{clock[0], clock[0], clock[2]},
+		},
+		{
+			name:  "regression allowed",
+			cfg:   InMemoryServiceConfig{AllowUpdatedAtRegression: true},
+			wantT: clock,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := t.Context()
+			s := InMemoryServiceWithConfig(tt.cfg)
+			created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, now := range clock {
+				event := stateEvent(map[string]any{"n": i})
+				event.Timestamp = now
+				if err := s.AppendEvent(ctx, created.Session, event); err != nil {
+					t.Fatalf("AppendEvent() %d error = %v", i, err)
+				}
+				if got := created.Session.LastUpdateTime(); !got.Equal(tt.wantT[i]) {
+					t.Errorf("after event %d, session LastUpdateTime() = %v, want %v", i, got, tt.wantT[i])
+				}
+				got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := got.Session.LastUpdateTime(); !got.Equal(tt.wantT[i]) {
+					t.Errorf("after event %d, stored LastUpdateTime() = %v, want %v", i, got, tt.wantT[i])
+				}
+			}
+		})
+	}
+}
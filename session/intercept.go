@@ -0,0 +1,269 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrEventRejected is returned, wrapped, when an [AppendInterceptor]
+// rejects an appended event. The event is not stored.
+var ErrEventRejected = errors.New("event rejected")
+
+// AppendInterceptor is called with every event before it is appended to
+// the session of the app and user, and returns the event to store: the
+// given one, modified or not, or a replacement, for instance without the
+// secrets it contains. A nil event keeps the given one. An error rejects
+// the append.
+type AppendInterceptor func(ctx context.Context, appName, userID, sessionID string, event *Event) (*Event, error)
+
+// ChainAppendInterceptors returns an interceptor calling the interceptors
+// in order, each with the event returned by the previous one. The first
+// error rejects the append without calling the next interceptors.
+func ChainAppendInterceptors(interceptors ...AppendInterceptor) AppendInterceptor {
+	return func(ctx context.Context, appName, userID, sessionID string, event *Event) (*Event, error) {
+		for _, interceptor := range interceptors {
+			if interceptor == nil {
+				continue
+			}
+			next, err := interceptor(ctx, appName, userID, sessionID, event)
+			if err != nil {
+				return nil, err
+			}
+			if next != nil {
+				event = next
+			}
+		}
+		return event, nil
+	}
+}
+
+// ServiceWithAppendInterceptor wraps the service so that the events
+// appended to it, including by transactions, go through the interceptor
+// before they are stored. Errors of the interceptor are returned wrapping
+// [ErrEventRejected]. Partial events, which aren't stored, and the events
+// the service creates itself, like those of [UndoService], aren't
+// intercepted.
+//
+// After a successful append the given event holds the stored one, with
+// the fields the service sets like its sequence.
+//
+// The returned service implements the optional capabilities like
+// [TransactionService]; they fail with an error wrapping
+// [errors.ErrUnsupported] if the wrapped service lacks them.
+func ServiceWithAppendInterceptor(service Service, interceptor AppendInterceptor) Service {
+	return &interceptingService{service: service, interceptor: interceptor}
+}
+
+type interceptingService struct {
+	service     Service
+	interceptor AppendInterceptor
+}
+
+// intercept returns the event to store in place of the given one.
+func (s *interceptingService) intercept(ctx context.Context, appName, userID, sessionID string, event *Event) (*Event, error) {
+	if event == nil || event.Partial || s.interceptor == nil {
+		return event, nil
+	}
+	stored, err := s.interceptor(ctx, appName, userID, sessionID, event)
+	if err != nil {
+		if errors.Is(err, ErrEventRejected) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrEventRejected, err)
+	}
+	if stored == nil {
+		return event, nil
+	}
+	return stored, nil
+}
+
+func (s *interceptingService) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	return s.service.Create(ctx, req)
+}
+
+func (s *interceptingService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	return s.service.Get(ctx, req)
+}
+
+func (s *interceptingService) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	return s.service.List(ctx, req)
+}
+
+func (s *interceptingService) Delete(ctx context.Context, req *DeleteRequest) error {
+	return s.service.Delete(ctx, req)
+}
+
+func (s *interceptingService) AppendEvent(ctx context.Context, curSession Session, event *Event) error {
+	if curSession == nil {
+		return s.service.AppendEvent(ctx, curSession, event)
+	}
+	stored, err := s.intercept(ctx, curSession.AppName(), curSession.UserID(), curSession.ID(), event)
+	if err != nil {
+		return err
+	}
+	if err := s.service.AppendEvent(ctx, curSession, stored); err != nil {
+		return err
+	}
+	if stored != event {
+		*event = *stored
+	}
+	return nil
+}
+
+// Transact implements [TransactionService]. Every event is intercepted
+// before the transaction starts, a rejected one aborts it.
+func (s *interceptingService) Transact(ctx context.Context, req *TransactRequest) (*TransactResponse, error) {
+	txService, ok := s.service.(TransactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support transactions: %w", s.service, errors.ErrUnsupported)
+	}
+	if req == nil {
+		return txService.Transact(ctx, req)
+	}
+	intercepted := &TransactRequest{Ops: make([]TransactOp, len(req.Ops))}
+	for i, op := range req.Ops {
+		stored, err := s.intercept(ctx, op.AppName, op.UserID, op.SessionID, op.Event)
+		if err != nil {
+			return nil, fmt.Errorf("session %q: %w, transaction aborted", op.SessionID, err)
+		}
+		op.Event = stored
+		intercepted.Ops[i] = op
+	}
+	resp, err := txService.Transact(ctx, intercepted)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range req.Ops {
+		if stored := intercepted.Ops[i].Event; stored != op.Event {
+			*op.Event = *stored
+		}
+	}
+	return resp, nil
+}
+
+// AppStats implements [StatsService].
+func (s *interceptingService) AppStats(ctx context.Context) (map[string]AppStats, error) {
+	statsService, ok := s.service.(StatsService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not provide statistics: %w", s.service, errors.ErrUnsupported)
+	}
+	return statsService.AppStats(ctx)
+}
+
+// Compact implements [CompactionService].
+func (s *interceptingService) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	compactionService, ok := s.service.(CompactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support compaction: %w", s.service, errors.ErrUnsupported)
+	}
+	return compactionService.Compact(ctx, req)
+}
+
+// WatchUser implements [WatchService].
+func (s *interceptingService) WatchUser(ctx context.Context, req *WatchUserRequest) (*Subscription, error) {
+	watchService, ok := s.service.(WatchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support watching: %w", s.service, errors.ErrUnsupported)
+	}
+	return watchService.WatchUser(ctx, req)
+}
+
+// AcquireLease implements [LeaseService].
+func (s *interceptingService) AcquireLease(ctx context.Context, req *AcquireLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return leaseService.AcquireLease(ctx, req)
+}
+
+// RenewLease implements [LeaseService].
+func (s *interceptingService) RenewLease(ctx context.Context, req *RenewLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return leaseService.RenewLease(ctx, req)
+}
+
+// ReleaseLease implements [LeaseService].
+func (s *interceptingService) ReleaseLease(ctx context.Context, req *ReleaseLeaseRequest) error {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return leaseService.ReleaseLease(ctx, req)
+}
+
+// Undo implements [UndoService].
+func (s *interceptingService) Undo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return undoService.Undo(ctx, req)
+}
+
+// Redo implements [UndoService].
+func (s *interceptingService) Redo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return undoService.Redo(ctx, req)
+}
+
+// Touch implements [TouchService].
+func (s *interceptingService) Touch(ctx context.Context, req *TouchRequest) (*TouchResponse, error) {
+	touchService, ok := s.service.(TouchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support touching sessions: %w", s.service, errors.ErrUnsupported)
+	}
+	return touchService.Touch(ctx, req)
+}
+
+// SetLabels implements [LabelService].
+func (s *interceptingService) SetLabels(ctx context.Context, req *SetLabelsRequest) (*SetLabelsResponse, error) {
+	labelService, ok := s.service.(LabelService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support labels: %w", s.service, errors.ErrUnsupported)
+	}
+	return labelService.SetLabels(ctx, req)
+}
+
+// PinEvent implements [PinService].
+func (s *interceptingService) PinEvent(ctx context.Context, req *PinEventRequest) (*PinEventResponse, error) {
+	pinService, ok := s.service.(PinService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support pinning events: %w", s.service, errors.ErrUnsupported)
+	}
+	return pinService.PinEvent(ctx, req)
+}
+
+var (
+	_ Service            = (*interceptingService)(nil)
+	_ TransactionService = (*interceptingService)(nil)
+	_ StatsService       = (*interceptingService)(nil)
+	_ CompactionService  = (*interceptingService)(nil)
+	_ WatchService       = (*interceptingService)(nil)
+	_ LeaseService       = (*interceptingService)(nil)
+	_ UndoService        = (*interceptingService)(nil)
+	_ TouchService       = (*interceptingService)(nil)
+	_ LabelService       = (*interceptingService)(nil)
+	_ PinService         = (*interceptingService)(nil)
+)
@@ -0,0 +1,153 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+var errSecret = errors.New("event contains a secret")
+
+// rejectSecrets rejects the events whose text contains "secret".
+func rejectSecrets(ctx context.Context, appName, userID, sessionID string, event *Event) (*Event, error) {
+	if event.Content != nil {
+		for _, part := range event.Content.Parts {
+			if strings.Contains(part.Text, "secret") {
+				return nil, errSecret
+			}
+		}
+	}
+	return event, nil
+}
+
+// redact returns a copy of the event with old replaced by new in its text.
+func redact(old, new string) AppendInterceptor {
+	return func(ctx context.Context, appName, userID, sessionID string, event *Event) (*Event, error) {
+		redacted := *event
+		if event.Content != nil {
+			content := *event.Content
+			content.Parts = nil
+			for _, part := range event.Content.Parts {
+				copied := *part
+				copied.Text = strings.ReplaceAll(part.Text, old, new)
+				content.Parts = append(content.Parts, &copied)
+			}
+			redacted.Content = &content
+		}
+		return &redacted, nil
+	}
+}
+
+func textEvent(text string) *Event {
+	event := NewEvent("invocation")
+	event.Author = "user"
+	event.LLMResponse = model.LLMResponse{Content: genai.NewContentFromText(text, genai.RoleUser)}
+	return event
+}
+
+func storedTexts(t *testing.T, s Service, sessionID string) []string {
+	t.Helper()
+	got, err := s.Get(t.Context(), &GetRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for event := range got.Session.Events().All() {
+		texts = append(texts, event.Content.Parts[0].Text)
+	}
+	return texts
+}
+
+func TestServiceWithAppendInterceptor_Reject(t *testing.T) {
+	ctx := t.Context()
+	s := ServiceWithAppendInterceptor(InMemoryService(), rejectSecrets)
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AppendEvent(ctx, created.Session, textEvent("hello")); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+	err = s.AppendEvent(ctx, created.Session, textEvent("my secret"))
+	if !errors.Is(err, ErrEventRejected) || !errors.Is(err, errSecret) {
+		t.Fatalf("AppendEvent() error = %v, want ErrEventRejected wrapping the error of the interceptor", err)
+	}
+	if diff := cmp.Diff([]string{"hello"}, storedTexts(t, s, "s1")); diff != "" {
+		t.Errorf("stored events mismatch (-want +got):\n%s", diff)
+	}
+
+	// A rejected event aborts the whole transaction.
+	_, err = s.(TransactionService).Transact(ctx, &TransactRequest{Ops: []TransactOp{
+		{AppName: "app", UserID: "user", SessionID: "s2", Event: textEvent("fine")},
+		{AppName: "app", UserID: "user", SessionID: "s1", Event: textEvent("another secret")},
+	}})
+	if !errors.Is(err, ErrEventRejected) {
+		t.Fatalf("Transact() error = %v, want ErrEventRejected", err)
+	}
+	if texts := storedTexts(t, s, "s2"); len(texts) != 0 {
+		t.Errorf("aborted transaction stored %q", texts)
+	}
+}
+
+func TestServiceWithAppendInterceptor_Transform(t *testing.T) {
+	ctx := t.Context()
+	// The interceptors are chained in order: the redacted event is not
+	// rejected.
+	s := ServiceWithAppendInterceptor(InMemoryService(), ChainAppendInterceptors(redact("secret", "[redacted]"), rejectSecrets))
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := textEvent("my secret")
+	if err := s.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+	// The appended event holds the stored one.
+	if got := event.Content.Parts[0].Text; got != "my [redacted]" {
+		t.Errorf("appended event text = %q, want the redacted text", got)
+	}
+	if event.Sequence != 1 {
+		t.Errorf("appended event sequence = %d, want 1", event.Sequence)
+	}
+
+	txEvent := textEvent("another secret")
+	_, err = s.(TransactionService).Transact(ctx, &TransactRequest{Ops: []TransactOp{
+		{AppName: "app", UserID: "user", SessionID: "s1", Event: txEvent},
+	}})
+	if err != nil {
+		t.Fatalf("Transact() error = %v", err)
+	}
+	if txEvent.Sequence != 2 {
+		t.Errorf("transacted event sequence = %d, want 2", txEvent.Sequence)
+	}
+
+	want := []string{"my [redacted]", "another [redacted]"}
+	if diff := cmp.Diff(want, storedTexts(t, s, "s1")); diff != "" {
+		t.Errorf("stored events mismatch (-want +got):\n%s", diff)
+	}
+}
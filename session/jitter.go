@@ -0,0 +1,60 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter is how the delay between two attempts of a retried call is
+// randomized, so that the clients of a failed dependency, like the replicas
+// of a server, don't retry in lockstep once it recovers.
+type Jitter int
+
+const (
+	// JitterFull waits a random delay between zero and the backoff.
+	JitterFull Jitter = iota
+	// JitterEqual waits half the backoff plus a random delay up to the
+	// other half.
+	JitterEqual
+	// JitterNone waits exactly the backoff.
+	JitterNone
+)
+
+// Apply returns the delay to wait for the backoff, drawn from r, or from the
+// global source of math/rand/v2 if r is nil. A given r is not safe for
+// concurrent use, the callers sharing it must serialize their calls.
+func (j Jitter) Apply(backoff time.Duration, r *rand.Rand) time.Duration {
+	switch j {
+	case JitterNone:
+		return backoff
+	case JitterEqual:
+		return backoff/2 + randDuration(backoff-backoff/2, r)
+	default:
+		return randDuration(backoff, r)
+	}
+}
+
+// randDuration returns a random duration in [0, d].
+func randDuration(d time.Duration, r *rand.Rand) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	if r == nil {
+		return time.Duration(rand.Int64N(int64(d) + 1))
+	}
+	return time.Duration(r.Int64N(int64(d) + 1))
+}
@@ -0,0 +1,124 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+)
+
+// LabelService is implemented by a [Service] which stores labels on its
+// sessions: operational metadata like the environment, an experiment arm
+// or a tenant tier, set by clients and used to filter sessions. Labels are
+// not part of the session state, agents don't see them.
+//
+// The sessions of a LabelService implement [LabeledSession], and the
+// service honors CreateRequest.Labels and ListRequest.Labels.
+type LabelService interface {
+	// SetLabels merges the labels of the request into the labels of the
+	// session. Labels with an empty value are removed.
+	SetLabels(context.Context, *SetLabelsRequest) (*SetLabelsResponse, error)
+}
+
+// LabeledSession is implemented by the sessions of a [LabelService].
+type LabeledSession interface {
+	Session
+	// Labels returns a copy of the labels of the session.
+	Labels() map[string]string
+}
+
+// SetLabelsRequest represents a request to change the labels of a session.
+type SetLabelsRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+	// Labels are merged into the labels of the session. Labels with an
+	// empty value are removed.
+	Labels map[string]string
+}
+
+// SetLabelsResponse represents a response from [LabelService.SetLabels].
+type SetLabelsResponse struct {
+	// Labels are the labels of the session after the change.
+	Labels map[string]string
+}
+
+// SessionLabels returns the labels of the session, or nil if it has none
+// or its service doesn't store labels.
+func SessionLabels(s Session) map[string]string {
+	if labeled, ok := s.(LabeledSession); ok {
+		return labeled.Labels()
+	}
+	return nil
+}
+
+// MatchLabels reports whether the session has every label of the selector,
+// with the same value. Every session matches an empty selector.
+func MatchLabels(s Session, selector map[string]string) bool {
+	if len(selector) == 0 {
+		return true
+	}
+	labels := SessionLabels(s)
+	for key, value := range selector {
+		if got, ok := labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SetLabels implements [LabelService]. Changing the labels of a session
+// moves its update time, so that its ETag changes.
+func (s *inMemoryService) SetLabels(ctx context.Context, req *SetLabelsRequest) (*SetLabelsResponse, error) {
+	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
+	if appName == "" || userID == "" || sessionID == "" {
+		return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
+	}
+	key := id{appName: appName, userID: userID, sessionID: sessionID}.Encode()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storedSession, ok := s.lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrSessionNotFound, sessionID)
+	}
+	storedSession.mu.Lock()
+	defer storedSession.mu.Unlock()
+	labels := maps.Clone(storedSession.labels)
+	for key, value := range req.Labels {
+		if value == "" {
+			delete(labels, key)
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+	if !maps.Equal(labels, storedSession.labels) {
+		storedSession.labels = labels
+		storedSession.updatedAt = time.Now()
+	}
+	return &SetLabelsResponse{Labels: maps.Clone(labels)}, nil
+}
+
+// Labels implements [LabeledSession].
+func (s *session) Labels() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.labels)
+}
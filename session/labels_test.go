@@ -0,0 +1,95 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestInMemoryService_Labels(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryService()
+	labelService := s.(LabelService)
+	for _, req := range []*CreateRequest{
+		{AppName: "app", UserID: "user", SessionID: "prod-a", State: map[string]any{"k": "v"}, Labels: map[string]string{"env": "prod", "arm": "a"}},
+		{AppName: "app", UserID: "user", SessionID: "prod-b", Labels: map[string]string{"env": "prod", "arm": "b", "unset": ""}},
+		{AppName: "app", UserID: "user", SessionID: "plain"},
+	} {
+		if _, err := s.Create(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(selector map[string]string) []string {
+		t.Helper()
+		resp, err := s.List(ctx, &ListRequest{AppName: "app", UserID: "user", Labels: selector})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, listed := range resp.Sessions {
+			ids = append(ids, listed.ID())
+		}
+		return ids
+	}
+	get := func(sessionID string) Session {
+		t.Helper()
+		resp, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: sessionID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Session
+	}
+
+	if got, want := SessionLabels(get("prod-b")), map[string]string{"env": "prod", "arm": "b"}; !maps.Equal(got, want) {
+		t.Errorf("labels of the created session = %v, want %v", got, want)
+	}
+	if _, err := get("prod-a").State().Get("env"); err == nil {
+		t.Error("labels leaked into the state")
+	}
+	if got, want := list(map[string]string{"env": "prod"}), []string{"prod-a", "prod-b"}; !slices.Equal(got, want) {
+		t.Errorf("List(env=prod) = %v, want %v", got, want)
+	}
+	if got, want := list(map[string]string{"env": "prod", "arm": "b"}), []string{"prod-b"}; !slices.Equal(got, want) {
+		t.Errorf("List(env=prod, arm=b) = %v, want %v", got, want)
+	}
+	if got, want := list(nil), []string{"plain", "prod-a", "prod-b"}; !slices.Equal(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+
+	before := get("prod-a").LastUpdateTime()
+	resp, err := labelService.SetLabels(ctx, &SetLabelsRequest{AppName: "app", UserID: "user", SessionID: "prod-a", Labels: map[string]string{"arm": "", "tier": "gold"}})
+	if err != nil {
+		t.Fatalf("SetLabels() error = %v", err)
+	}
+	if want := map[string]string{"env": "prod", "tier": "gold"}; !maps.Equal(resp.Labels, want) {
+		t.Errorf("SetLabels() labels = %v, want %v", resp.Labels, want)
+	}
+	updated := get("prod-a")
+	if !maps.Equal(SessionLabels(updated), resp.Labels) {
+		t.Errorf("labels after SetLabels() = %v, want %v", SessionLabels(updated), resp.Labels)
+	}
+	if !updated.LastUpdateTime().After(before) {
+		t.Errorf("LastUpdateTime() after SetLabels() = %v, want after %v", updated.LastUpdateTime(), before)
+	}
+	if got, want := list(map[string]string{"tier": "gold"}), []string{"prod-a"}; !slices.Equal(got, want) {
+		t.Errorf("List(tier=gold) = %v, want %v", got, want)
+	}
+
+	if _, err := labelService.SetLabels(ctx, &SetLabelsRequest{AppName: "app", UserID: "user", SessionID: "missing", Labels: map[string]string{"env": "prod"}}); err == nil {
+		t.Error("SetLabels() of a missing session succeeded, want an error")
+	}
+}
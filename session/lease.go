@@ -0,0 +1,230 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrLeaseHeld is returned, wrapped, when a session is leased by another
+// holder, by [LeaseService.AcquireLease] and by the writes of a service
+// requiring leases.
+var ErrLeaseHeld = errors.New("session is leased by another holder")
+
+// ErrLeaseNotHeld is returned, wrapped, when renewing or releasing a lease
+// which has expired, was released, or has a different token.
+var ErrLeaseNotHeld = errors.New("lease is not held")
+
+// LeaseService is implemented by a [Service] that can grant a runner
+// exclusive access to a session for a limited time.
+type LeaseService interface {
+	// AcquireLease grants an exclusive lease on the session. It fails with
+	// [ErrLeaseHeld] if another unexpired lease exists, or waits for it to
+	// be released or to expire if the request says so.
+	AcquireLease(context.Context, *AcquireLeaseRequest) (*Lease, error)
+	// RenewLease extends an unexpired lease, as a heartbeat of its holder.
+	RenewLease(context.Context, *RenewLeaseRequest) (*Lease, error)
+	// ReleaseLease ends a lease before it expires.
+	ReleaseLease(context.Context, *ReleaseLeaseRequest) error
+}
+
+// Lease is an exclusive lease on a session. It ends when it is released or
+// at ExpiresAt, unless it is renewed before.
+type Lease struct {
+	AppName   string
+	UserID    string
+	SessionID string
+
+	// Holder identifies the runner holding the lease, for diagnostics.
+	Holder string
+	// Token is the secret proving the possession of the lease, required to
+	// renew or release it and passed with [ContextWithLeaseToken] to write
+	// to the session.
+	Token     string
+	ExpiresAt time.Time
+}
+
+// AcquireLeaseRequest represents a request to lease a session.
+type AcquireLeaseRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+
+	// Holder identifies the runner requesting the lease.
+	Holder string
+	// TTL is the time the lease lasts without being renewed.
+	TTL time.Duration
+	// Wait makes AcquireLease wait for the current lease to end instead of
+	// failing, until the context is done.
+	Wait bool
+}
+
+// RenewLeaseRequest represents a request to extend a lease.
+type RenewLeaseRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+
+	Token string
+	// TTL is the time the lease lasts from now on without being renewed.
+	TTL time.Duration
+}
+
+// ReleaseLeaseRequest represents a request to end a lease.
+type ReleaseLeaseRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+
+	Token string
+}
+
+type leaseTokenKey struct{}
+
+// ContextWithLeaseToken returns a context carrying the token of a lease,
+// allowing the writes made with it to a session leased with that token.
+func ContextWithLeaseToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, leaseTokenKey{}, token)
+}
+
+// LeaseTokenFromContext returns the lease token set by
+// [ContextWithLeaseToken], or "" if there is none.
+func LeaseTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(leaseTokenKey{}).(string)
+	return token
+}
+
+// leaseTable holds the leases of sessions, by encoded session ID.
+// The zero value is ready to use.
+type leaseTable struct {
+	mu     sync.Mutex
+	leases map[string]Lease
+	// released is closed and replaced whenever a lease is released, waking
+	// up the waiting acquirers.
+	released chan struct{}
+	// now returns the current time. Optional: defaults to time.Now.
+	now func() time.Time
+}
+
+func (t *leaseTable) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// active returns the unexpired lease of the session. The caller must hold
+// t.mu.
+func (t *leaseTable) active(key string) (Lease, bool) {
+	lease, ok := t.leases[key]
+	if ok && !t.clock().Before(lease.ExpiresAt) {
+		delete(t.leases, key)
+		return Lease{}, false
+	}
+	return lease, ok
+}
+
+func (t *leaseTable) acquire(ctx context.Context, key string, req *AcquireLeaseRequest) (*Lease, error) {
+	if req.TTL <= 0 {
+		return nil, fmt.Errorf("lease TTL must be positive, got %v", req.TTL)
+	}
+	for {
+		t.mu.Lock()
+		current, held := t.active(key)
+		if !held {
+			if t.leases == nil {
+				t.leases = make(map[string]Lease)
+			}
+			lease := Lease{
+				AppName:   req.AppName,
+				UserID:    req.UserID,
+				SessionID: req.SessionID,
+				Holder:    req.Holder,
+				Token:     uuid.NewString(),
+				ExpiresAt: t.clock().Add(req.TTL),
+			}
+			t.leases[key] = lease
+			t.mu.Unlock()
+			return &lease, nil
+		}
+		if !req.Wait {
+			t.mu.Unlock()
+			return nil, fmt.Errorf("%w: session %q is leased by %q until %v", ErrLeaseHeld, req.SessionID, current.Holder, current.ExpiresAt)
+		}
+		if t.released == nil {
+			t.released = make(chan struct{})
+		}
+		released := t.released
+		t.mu.Unlock()
+
+		expiry := time.NewTimer(current.ExpiresAt.Sub(t.clock()))
+		select {
+		case <-released:
+		case <-expiry.C:
+		case <-ctx.Done():
+			expiry.Stop()
+			return nil, fmt.Errorf("waiting for the lease of session %q: %w", req.SessionID, ctx.Err())
+		}
+		expiry.Stop()
+	}
+}
+
+func (t *leaseTable) renew(key string, req *RenewLeaseRequest) (*Lease, error) {
+	if req.TTL <= 0 {
+		return nil, fmt.Errorf("lease TTL must be positive, got %v", req.TTL)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lease, ok := t.active(key)
+	if !ok || lease.Token != req.Token {
+		return nil, fmt.Errorf("%w: no lease of session %q with this token", ErrLeaseNotHeld, req.SessionID)
+	}
+	lease.ExpiresAt = t.clock().Add(req.TTL)
+	t.leases[key] = lease
+	return &lease, nil
+}
+
+func (t *leaseTable) release(key string, req *ReleaseLeaseRequest) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lease, ok := t.active(key)
+	if !ok || lease.Token != req.Token {
+		return fmt.Errorf("%w: no lease of session %q with this token", ErrLeaseNotHeld, req.SessionID)
+	}
+	delete(t.leases, key)
+	if t.released != nil {
+		close(t.released)
+		t.released = nil
+	}
+	return nil
+}
+
+// checkWrite returns an error wrapping [ErrLeaseHeld] if the session is
+// leased with another token than the one of the context.
+func (t *leaseTable) checkWrite(ctx context.Context, key, sessionID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lease, ok := t.active(key)
+	if !ok || lease.Token == LeaseTokenFromContext(ctx) {
+		return nil
+	}
+	return fmt.Errorf("%w: session %q is leased by %q", ErrLeaseHeld, sessionID, lease.Holder)
+}
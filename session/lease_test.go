@@ -0,0 +1,203 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newLeaseTestService returns an in-memory service with a session, whose
+// lease clock is driven by the returned function.
+func newLeaseTestService(t *testing.T, cfg InMemoryServiceConfig) (*inMemoryService, Session, func(time.Duration)) {
+	t.Helper()
+	s := InMemoryServiceWithConfig(cfg).(*inMemoryService)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.leases.now = func() time.Time { return now }
+	created, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, created.Session, func(d time.Duration) { now = now.Add(d) }
+}
+
+func acquireRequest(holder string, ttl time.Duration) *AcquireLeaseRequest {
+	return &AcquireLeaseRequest{AppName: "app", UserID: "user", SessionID: "session", Holder: holder, TTL: ttl}
+}
+
+func Test_inMemoryService_AcquireLease_Contention(t *testing.T) {
+	ctx := t.Context()
+	s, _, _ := newLeaseTestService(t, InMemoryServiceConfig{})
+
+	lease, err := s.AcquireLease(ctx, acquireRequest("runner-a", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Holder != "runner-a" || lease.Token == "" {
+		t.Errorf("AcquireLease() = %+v, want a lease of runner-a with a token", lease)
+	}
+	if _, err := s.AcquireLease(ctx, acquireRequest("runner-b", time.Minute)); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AcquireLease() of a leased session error = %v, want ErrLeaseHeld", err)
+	}
+	if _, err := s.AcquireLease(ctx, acquireRequest("runner-a", time.Minute)); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AcquireLease() by the holder again error = %v, want ErrLeaseHeld", err)
+	}
+
+	if err := s.ReleaseLease(ctx, &ReleaseLeaseRequest{AppName: "app", UserID: "user", SessionID: "session", Token: "wrong"}); !errors.Is(err, ErrLeaseNotHeld) {
+		t.Errorf("ReleaseLease() with a wrong token error = %v, want ErrLeaseNotHeld", err)
+	}
+	if err := s.ReleaseLease(ctx, &ReleaseLeaseRequest{AppName: "app", UserID: "user", SessionID: "session", Token: lease.Token}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AcquireLease(ctx, acquireRequest("runner-b", time.Minute)); err != nil {
+		t.Errorf("AcquireLease() after release error = %v", err)
+	}
+}
+
+func Test_inMemoryService_AcquireLease_Expiry(t *testing.T) {
+	ctx := t.Context()
+	s, _, advance := newLeaseTestService(t, InMemoryServiceConfig{})
+
+	lease, err := s.AcquireLease(ctx, acquireRequest("runner-a", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	advance(time.Minute)
+
+	if _, err := s.AcquireLease(ctx, acquireRequest("runner-b", time.Minute)); err != nil {
+		t.Fatalf("AcquireLease() after expiry error = %v", err)
+	}
+	if _, err := s.RenewLease(ctx, &RenewLeaseRequest{AppName: "app", UserID: "user", SessionID: "session", Token: lease.Token, TTL: time.Minute}); !errors.Is(err, ErrLeaseNotHeld) {
+		t.Errorf("RenewLease() of an expired lease error = %v, want ErrLeaseNotHeld", err)
+	}
+}
+
+func Test_inMemoryService_RenewLease(t *testing.T) {
+	ctx := t.Context()
+	s, _, advance := newLeaseTestService(t, InMemoryServiceConfig{})
+
+	lease, err := s.AcquireLease(ctx, acquireRequest("runner-a", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Heartbeats keep the lease past its initial TTL.
+	for range 3 {
+		advance(45 * time.Second)
+		renewed, err := s.RenewLease(ctx, &RenewLeaseRequest{AppName: "app", UserID: "user", SessionID: "session", Token: lease.Token, TTL: time.Minute})
+		if err != nil {
+			t.Fatalf("RenewLease() error = %v", err)
+		}
+		if !renewed.ExpiresAt.After(lease.ExpiresAt) {
+			t.Errorf("RenewLease() expires at %v, want after %v", renewed.ExpiresAt, lease.ExpiresAt)
+		}
+		lease = renewed
+	}
+	if _, err := s.AcquireLease(ctx, acquireRequest("runner-b", time.Minute)); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AcquireLease() of a renewed lease error = %v, want ErrLeaseHeld", err)
+	}
+}
+
+func Test_inMemoryService_AcquireLease_Wait(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryService().(*inMemoryService)
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+	lease, err := s.AcquireLease(ctx, acquireRequest("runner-a", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		req := acquireRequest("runner-b", time.Minute)
+		req.Wait = true
+		_, err := s.AcquireLease(ctx, req)
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("waiting AcquireLease() returned %v while the session is leased", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := s.ReleaseLease(ctx, &ReleaseLeaseRequest{AppName: "app", UserID: "user", SessionID: "session", Token: lease.Token}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("waiting AcquireLease() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting AcquireLease() not woken up by the release")
+	}
+
+	// A waiting acquirer gives up when its context is done.
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	req := acquireRequest("runner-c", time.Minute)
+	req.Wait = true
+	if _, err := s.AcquireLease(waitCtx, req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AcquireLease() with a done context error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func Test_inMemoryService_RequireLease(t *testing.T) {
+	ctx := t.Context()
+	s, sess, advance := newLeaseTestService(t, InMemoryServiceConfig{RequireLease: true})
+
+	if err := s.AppendEvent(ctx, sess, stateEvent(map[string]any{"n": 1})); err != nil {
+		t.Fatalf("AppendEvent() to an unleased session error = %v", err)
+	}
+	lease, err := s.AcquireLease(ctx, acquireRequest("runner-a", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendEvent(ctx, sess, stateEvent(map[string]any{"n": 2})); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AppendEvent() without the lease error = %v, want ErrLeaseHeld", err)
+	}
+	if err := s.AppendEvent(ContextWithLeaseToken(ctx, lease.Token), sess, stateEvent(map[string]any{"n": 3})); err != nil {
+		t.Errorf("AppendEvent() with the lease error = %v", err)
+	}
+	compact := &CompactRequest{AppName: "app", UserID: "user", SessionID: "session", Count: 1, SummaryKey: "summary", Summarizer: func(ctx context.Context, events []*Event) (any, error) {
+		return len(events), nil
+	}}
+	if _, err := s.Compact(ctx, compact); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("Compact() without the lease error = %v, want ErrLeaseHeld", err)
+	}
+	if _, err := s.Compact(ContextWithLeaseToken(ctx, lease.Token), compact); err != nil {
+		t.Errorf("Compact() with the lease error = %v", err)
+	}
+	advance(time.Minute)
+	if err := s.AppendEvent(ctx, sess, stateEvent(map[string]any{"n": 4})); err != nil {
+		t.Errorf("AppendEvent() after the lease expired error = %v", err)
+	}
+}
+
+func TestLease_InvalidRequest(t *testing.T) {
+	ctx := t.Context()
+	s, _, _ := newLeaseTestService(t, InMemoryServiceConfig{})
+	for _, req := range []*AcquireLeaseRequest{
+		{AppName: "app", UserID: "user", SessionID: "session"},
+		{AppName: "app", UserID: "user", SessionID: "missing", TTL: time.Minute},
+		{UserID: "user", SessionID: "session", TTL: time.Minute},
+	} {
+		if _, err := s.AcquireLease(ctx, req); err == nil {
+			t.Errorf("AcquireLease(%+v) succeeded, want error", req)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import "slices"
+
+// CollapsePartials returns the events without the partial events superseded
+// by a final one, leaving the events passed in untouched. A partial event is
+// a chunk of a streamed response, which is superseded by the next
+// non-partial event of the same invocation, author and branch, carrying the
+// complete response. Partial events of different invocations or agents may
+// interleave, each run is collapsed into its own final event. The partial
+// events without a later final event, such as the ones of a response still
+// being streamed, are kept.
+//
+// The built-in services don't store partial events. CollapsePartials is
+// meant for the services which do, to shorten the events returned to
+// clients while keeping the stored ones.
+func CollapsePartials(events []*Event) []*Event {
+	type stream struct {
+		invocationID, author, branch string
+	}
+	// Walking backwards, a partial event is superseded if a final event of
+	// its stream was seen.
+	finalized := map[stream]bool{}
+	superseded := make([]bool, len(events))
+	collapsed := 0
+	for i, event := range slices.Backward(events) {
+		key := stream{event.InvocationID, event.Author, event.Branch}
+		if !event.Partial {
+			finalized[key] = true
+			continue
+		}
+		if finalized[key] {
+			superseded[i] = true
+			collapsed++
+		}
+	}
+	if collapsed == 0 {
+		return events
+	}
+	kept := make([]*Event, 0, len(events)-collapsed)
+	for i, event := range events {
+		if !superseded[i] {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
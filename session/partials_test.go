@@ -0,0 +1,123 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollapsePartials(t *testing.T) {
+	event := func(id, invocationID, author string, partial bool) *Event {
+		e := NewEvent(invocationID)
+		e.ID, e.Author, e.Partial = id, author, partial
+		return e
+	}
+	branched := func(e *Event, branch string) *Event {
+		e.Branch = branch
+		return e
+	}
+
+	tc := []struct {
+		name   string
+		events []*Event
+		want   []string
+	}{
+		{
+			name:   "no partials",
+			events: []*Event{event("u", "inv1", "user", false), event("f", "inv1", "agent", false)},
+			want:   []string{"u", "f"},
+		},
+		{
+			name: "run collapsed into its final",
+			events: []*Event{
+				event("u", "inv1", "user", false),
+				event("p1", "inv1", "agent", true),
+				event("p2", "inv1", "agent", true),
+				event("p3", "inv1", "agent", true),
+				event("f", "inv1", "agent", false),
+			},
+			want: []string{"u", "f"},
+		},
+		{
+			name: "successive runs of an invocation",
+			events: []*Event{
+				event("p1", "inv1", "agent", true),
+				event("f1", "inv1", "agent", false),
+				event("p2", "inv1", "agent", true),
+				event("f2", "inv1", "agent", false),
+			},
+			want: []string{"f1", "f2"},
+		},
+		{
+			name: "interleaved invocations",
+			events: []*Event{
+				event("a1", "invA", "agent", true),
+				event("b1", "invB", "agent", true),
+				event("a2", "invA", "agent", true),
+				event("fa", "invA", "agent", false),
+				event("b2", "invB", "agent", true),
+				event("fb", "invB", "agent", false),
+			},
+			want: []string{"fa", "fb"},
+		},
+		{
+			name: "final of another invocation doesn't supersede",
+			events: []*Event{
+				event("a1", "invA", "agent", true),
+				event("b1", "invB", "agent", true),
+				event("fb", "invB", "agent", false),
+			},
+			want: []string{"a1", "fb"},
+		},
+		{
+			name: "interleaved authors and branches",
+			events: []*Event{
+				event("x1", "inv1", "x", true),
+				branched(event("y1", "inv1", "y", true), "root.y"),
+				event("y2", "inv1", "y", true),
+				event("fx", "inv1", "x", false),
+				event("fy", "inv1", "y", false),
+			},
+			want: []string{"y1", "fx", "fy"},
+		},
+		{
+			name: "trailing partials still streaming",
+			events: []*Event{
+				event("p1", "inv1", "agent", true),
+				event("f1", "inv1", "agent", false),
+				event("p2", "inv1", "agent", true),
+				event("p3", "inv1", "agent", true),
+			},
+			want: []string{"f1", "p2", "p3"},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			before := append([]*Event(nil), tt.events...)
+			var got []string
+			for _, e := range CollapsePartials(tt.events) {
+				got = append(got, e.ID)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("CollapsePartials() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(before, tt.events); diff != "" {
+				t.Errorf("CollapsePartials() modified its input (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
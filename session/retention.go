@@ -0,0 +1,190 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+)
+
+// ErrEventNotFound is returned, wrapped, when an event is not in its
+// session.
+var ErrEventNotFound = errors.New("event not found")
+
+// PinnedTag is the event tag which pins an event when set to "true". Pinned
+// events, such as handoffs or errors worth keeping, are never trimmed by the
+// event retention. Events are pinned when appended, or later through
+// [PinService].
+const PinnedTag = "pinned"
+
+// IsPinned reports whether the event is pinned.
+func IsPinned(event *Event) bool {
+	return event.Tags[PinnedTag] == "true"
+}
+
+// EventRetention bounds the events kept in a session. Trimming removes the
+// oldest events past the bounds, except the pinned ones. A bound of zero or
+// less means no bound.
+type EventRetention struct {
+	// MaxEvents is the number of unpinned events kept. Pinned events don't
+	// count, they are kept in addition.
+	MaxEvents int
+	// MaxAge is how long unpinned events are kept after their timestamp.
+	MaxAge time.Duration
+}
+
+// EventRetentionLimits holds the event retention, per app.
+type EventRetentionLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default EventRetention
+	// Apps maps an app name to its retention.
+	Apps map[string]EventRetention
+}
+
+// ForApp returns the event retention of the app.
+func (l EventRetentionLimits) ForApp(appName string) EventRetention {
+	if r, ok := l.Apps[appName]; ok {
+		return r
+	}
+	return l.Default
+}
+
+// trim returns the events to keep at now, in order, and the number of
+// events trimmed. events is left unchanged.
+func (r EventRetention) trim(events []*Event, now time.Time) ([]*Event, int) {
+	if r.MaxEvents <= 0 && r.MaxAge <= 0 {
+		return events, 0
+	}
+	// Events are sorted by timestamp: the unpinned events past the count,
+	// counted from the newest, are the oldest unpinned ones.
+	drop := 0
+	if r.MaxEvents > 0 {
+		unpinned := 0
+		for _, event := range events {
+			if !IsPinned(event) {
+				unpinned++
+			}
+		}
+		drop = max(unpinned-r.MaxEvents, 0)
+	}
+	cutoff := now.Add(-r.MaxAge)
+	kept := make([]*Event, 0, len(events))
+	for _, event := range events {
+		switch {
+		case IsPinned(event):
+		case drop > 0:
+			drop--
+			continue
+		case r.MaxAge > 0 && event.Timestamp.Before(cutoff):
+			continue
+		}
+		kept = append(kept, event)
+	}
+	if len(kept) == len(events) {
+		return events, 0
+	}
+	return kept, len(events) - len(kept)
+}
+
+// PinService is implemented by a [Service] which can pin the events already
+// stored, see [PinnedTag].
+type PinService interface {
+	// PinEvent pins or unpins an event of a session.
+	PinEvent(context.Context, *PinEventRequest) (*PinEventResponse, error)
+}
+
+// PinEventRequest represents a request to pin or unpin an event.
+type PinEventRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+	EventID   string
+	// Pinned pins the event when true, and unpins it when false.
+	Pinned bool
+}
+
+// PinEventResponse represents a response from [PinService.PinEvent].
+type PinEventResponse struct {
+	// Event is the event after the change.
+	Event *Event
+}
+
+// PinEvent implements [PinService]. Changing the pin of an event moves the
+// update time of its session, so that its ETag changes. An unpinned event
+// past the retention is trimmed at once, the response still holds it.
+func (s *inMemoryService) PinEvent(ctx context.Context, req *PinEventRequest) (*PinEventResponse, error) {
+	appName, userID, sessionID := req.AppName, req.UserID, req.SessionID
+	if appName == "" || userID == "" || sessionID == "" {
+		return nil, fmt.Errorf("app_name, user_id, session_id are required, got app_name: %q, user_id: %q, session_id: %q", appName, userID, sessionID)
+	}
+	if req.EventID == "" {
+		return nil, fmt.Errorf("event_id is required")
+	}
+	key := id{appName: appName, userID: userID, sessionID: sessionID}.Encode()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storedSession, ok := s.lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrSessionNotFound, sessionID)
+	}
+	if err := s.checkLease(ctx, storedSession); err != nil {
+		return nil, err
+	}
+	i := -1
+	for j, event := range storedSession.events {
+		if event.ID == req.EventID {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %q in session %q", ErrEventNotFound, req.EventID, sessionID)
+	}
+	event := storedSession.events[i]
+	if IsPinned(event) == req.Pinned {
+		return &PinEventResponse{Event: event}, nil
+	}
+
+	// Stored events are shared with the sessions already returned, the
+	// changed event replaces the stored one rather than being changed.
+	changed := *event
+	changed.Tags = maps.Clone(event.Tags)
+	if req.Pinned {
+		if changed.Tags == nil {
+			changed.Tags = make(map[string]string)
+		}
+		changed.Tags[PinnedTag] = "true"
+	} else {
+		delete(changed.Tags, PinnedTag)
+	}
+	storedSession.mu.Lock()
+	defer storedSession.mu.Unlock()
+	storedSession.events[i] = &changed
+	storedSession.updatedAt = time.Now()
+	s.trimEvents(storedSession)
+	return &PinEventResponse{Event: &changed}, nil
+}
+
+// trimEvents removes the events of the stored session past the retention
+// of its app. The caller must hold s.mu.
+func (s *inMemoryService) trimEvents(storedSession *session) {
+	var trimmed int
+	storedSession.events, trimmed = s.cfg.Retention.ForApp(storedSession.AppName()).trim(storedSession.events, s.now())
+	s.countEvents(storedSession, -trimmed)
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventRetention_trim(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	event := func(id string, age time.Duration, pinned string) *Event {
+		e := &Event{ID: id, Timestamp: now.Add(-age)}
+		if pinned != "" {
+			e.Tags = map[string]string{PinnedTag: pinned}
+		}
+		return e
+	}
+	events := []*Event{
+		event("handoff", 5*time.Hour, "true"),
+		event("old", 4*time.Hour, "false"),
+		event("error", 3*time.Hour, "true"),
+		event("older", 2*time.Hour, ""),
+		event("recent", time.Hour, ""),
+		event("latest", 0, ""),
+	}
+	tests := []struct {
+		name      string
+		retention EventRetention
+		want      []string
+	}{
+		{
+			name: "no bound keeps every event",
+			want: []string{"handoff", "old", "error", "older", "recent", "latest"},
+		},
+		{
+			name:      "count keeps the pinned events besides the newest",
+			retention: EventRetention{MaxEvents: 2},
+			want:      []string{"handoff", "error", "recent", "latest"},
+		},
+		{
+			name:      "age keeps the old pinned events",
+			retention: EventRetention{MaxAge: 90 * time.Minute},
+			want:      []string{"handoff", "error", "recent", "latest"},
+		},
+		{
+			name:      "count and age trim past either bound",
+			retention: EventRetention{MaxEvents: 3, MaxAge: 150 * time.Minute},
+			want:      []string{"handoff", "error", "older", "recent", "latest"},
+		},
+		{
+			name:      "count trims the events tagged as not pinned",
+			retention: EventRetention{MaxEvents: 1},
+			want:      []string{"handoff", "error", "latest"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, trimmed := tt.retention.trim(events, now)
+			var got []string
+			for _, e := range kept {
+				got = append(got, e.ID)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("trim() kept events mismatch (-want +got):\n%s", diff)
+			}
+			if want := len(events) - len(tt.want); trimmed != want {
+				t.Errorf("trim() trimmed = %d, want %d", trimmed, want)
+			}
+		})
+	}
+}
+
+func TestInMemoryService_Retention(t *testing.T) {
+	ctx := t.Context()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		Retention: EventRetentionLimits{Default: EventRetention{MaxEvents: 2, MaxAge: time.Hour}},
+		Now:       clock.Now,
+	})
+	pinService := s.(PinService)
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvent := func(id string, tags map[string]string) {
+		t.Helper()
+		event := NewEvent("inv")
+		event.ID, event.Timestamp, event.Tags = id, clock.now, tags
+		if err := s.AppendEvent(ctx, created.Session, event); err != nil {
+			t.Fatalf("AppendEvent(%q) error = %v", id, err)
+		}
+		clock.advance(time.Minute)
+	}
+	eventIDs := func() []string {
+		t.Helper()
+		resp, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for e := range resp.Session.Events().All() {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	appendEvent("handoff", map[string]string{PinnedTag: "true"})
+	appendEvent("a", nil)
+	appendEvent("b", nil)
+	appendEvent("c", nil)
+	if diff := cmp.Diff([]string{"handoff", "b", "c"}, eventIDs()); diff != "" {
+		t.Errorf("events after count trimming mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := pinService.PinEvent(ctx, &PinEventRequest{AppName: "app", UserID: "user", SessionID: "s", EventID: "b", Pinned: true}); err != nil {
+		t.Fatalf("PinEvent() error = %v", err)
+	}
+	clock.advance(2 * time.Hour)
+	appendEvent("d", nil)
+	if diff := cmp.Diff([]string{"handoff", "b", "d"}, eventIDs()); diff != "" {
+		t.Errorf("events after age trimming mismatch (-want +got):\n%s", diff)
+	}
+
+	// Unpinning an event past the retention trims it at once.
+	resp, err := pinService.PinEvent(ctx, &PinEventRequest{AppName: "app", UserID: "user", SessionID: "s", EventID: "handoff"})
+	if err != nil {
+		t.Fatalf("PinEvent() error = %v", err)
+	}
+	if IsPinned(resp.Event) {
+		t.Error("PinEvent() returned a pinned event, want it unpinned")
+	}
+	if diff := cmp.Diff([]string{"b", "d"}, eventIDs()); diff != "" {
+		t.Errorf("events after unpinning mismatch (-want +got):\n%s", diff)
+	}
+
+	stats, err := s.(StatsService).AppStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stats["app"].Events; got != 2 {
+		t.Errorf("AppStats() events = %d, want 2", got)
+	}
+	if _, err := pinService.PinEvent(ctx, &PinEventRequest{AppName: "app", UserID: "user", SessionID: "s", EventID: "a", Pinned: true}); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("PinEvent() of a trimmed event error = %v, want %v", err, ErrEventNotFound)
+	}
+}
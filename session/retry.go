@@ -0,0 +1,318 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrTransient is matched by the errors of failures which may not happen
+// again if the call is retried, like a lost connection or a lock timeout of
+// the database. Services report them with [MarkTransient]; only failures
+// which applied nothing may be reported as transient, since
+// [ServiceWithRetries] retries mutations too.
+var ErrTransient = errors.New("transient session service failure")
+
+// MarkTransient returns the error wrapped so that it matches
+// [ErrTransient], with the same message. It returns nil for nil.
+func MarkTransient(err error) error {
+	if err == nil || errors.Is(err, ErrTransient) {
+		return err
+	}
+	return &transientError{err: err}
+}
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() []error {
+	return []error{e.err, ErrTransient}
+}
+
+// temporary is implemented by the errors reporting themselves whether they
+// are transient, like the ones of the net package.
+type temporary interface {
+	Temporary() bool
+}
+
+// IsTransient reports whether the error is of a failure which may not
+// happen again if the call is retried: the errors matching [ErrTransient],
+// [ErrServiceUnavailable] or [ErrServiceOverloaded], and the errors with a
+// Temporary method reporting true. The cancellation and the deadline of the
+// context of the call are never transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrTransient) || errors.Is(err, ErrServiceUnavailable) || errors.Is(err, ErrServiceOverloaded) {
+		return true
+	}
+	var temp temporary
+	return errors.As(err, &temp) && temp.Temporary()
+}
+
+// RetryConfig contains the settings of [ServiceWithRetries]. The zero value
+// is a valid config.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts of a call, including the first
+	// one.
+	// Optional: defaults to 3.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled after
+	// every further failure.
+	// Optional: defaults to 50ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	// Optional: defaults to 2s.
+	MaxBackoff time.Duration
+	// Jitter randomizes the delay between two attempts within the backoff,
+	// so that the replicas sharing a store don't retry in lockstep.
+	// Optional: defaults to JitterFull.
+	Jitter Jitter
+	// Rand is the source of the jitter, for instance a seeded one in tests.
+	// Optional: defaults to the global source of math/rand/v2.
+	Rand *rand.Rand
+	// IsRetryable reports whether a call failing with the error is
+	// retried. Classifiers extending the default one can fall back to
+	// [IsTransient].
+	// Optional: defaults to IsTransient.
+	IsRetryable func(error) bool
+}
+
+// ServiceWithRetries wraps the service so that calls failing with errors
+// the IsRetryable classifier accepts are retried, with jittered exponential
+// backoff, until they succeed, fail with another error, or exhaust MaxAttempts. The
+// error of the last attempt is returned. Retries stop early when the
+// context of the call is done.
+//
+// The returned service implements the optional capabilities like
+// [TransactionService]; they fail with an error wrapping
+// [errors.ErrUnsupported] if the wrapped service lacks them.
+func ServiceWithRetries(service Service, cfg RetryConfig) Service {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 50 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 2 * time.Second
+	}
+	if cfg.IsRetryable == nil {
+		cfg.IsRetryable = IsTransient
+	}
+	return &retryingService{service: service, cfg: cfg, sleep: sleepContext}
+}
+
+// sleepContext waits for the delay, or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type retryingService struct {
+	service Service
+	cfg     RetryConfig
+	sleep   func(context.Context, time.Duration) error
+
+	// randMu guards cfg.Rand, which is not safe for concurrent use.
+	randMu sync.Mutex
+}
+
+// delay returns the jittered delay to wait for the backoff.
+func (s *retryingService) delay(backoff time.Duration) time.Duration {
+	if s.cfg.Rand != nil {
+		s.randMu.Lock()
+		defer s.randMu.Unlock()
+	}
+	return s.cfg.Jitter.Apply(backoff, s.cfg.Rand)
+}
+
+// retryCall runs fn until it succeeds, fails with an error which isn't
+// retryable, or exhausts the attempts.
+func retryCall[T any](ctx context.Context, s *retryingService, fn func() (T, error)) (T, error) {
+	backoff := s.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := fn()
+		if err == nil || attempt >= s.cfg.MaxAttempts || !s.cfg.IsRetryable(err) {
+			return resp, err
+		}
+		if s.sleep(ctx, s.delay(backoff)) != nil {
+			return resp, err
+		}
+		backoff = min(2*backoff, s.cfg.MaxBackoff)
+	}
+}
+
+func (s *retryingService) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	return retryCall(ctx, s, func() (*CreateResponse, error) { return s.service.Create(ctx, req) })
+}
+
+func (s *retryingService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	return retryCall(ctx, s, func() (*GetResponse, error) { return s.service.Get(ctx, req) })
+}
+
+func (s *retryingService) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	return retryCall(ctx, s, func() (*ListResponse, error) { return s.service.List(ctx, req) })
+}
+
+func (s *retryingService) Delete(ctx context.Context, req *DeleteRequest) error {
+	_, err := retryCall(ctx, s, func() (struct{}, error) { return struct{}{}, s.service.Delete(ctx, req) })
+	return err
+}
+
+func (s *retryingService) AppendEvent(ctx context.Context, curSession Session, event *Event) error {
+	_, err := retryCall(ctx, s, func() (struct{}, error) { return struct{}{}, s.service.AppendEvent(ctx, curSession, event) })
+	return err
+}
+
+// Transact implements [TransactionService].
+func (s *retryingService) Transact(ctx context.Context, req *TransactRequest) (*TransactResponse, error) {
+	txService, ok := s.service.(TransactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support transactions: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*TransactResponse, error) { return txService.Transact(ctx, req) })
+}
+
+// AppStats implements [StatsService].
+func (s *retryingService) AppStats(ctx context.Context) (map[string]AppStats, error) {
+	statsService, ok := s.service.(StatsService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not provide statistics: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (map[string]AppStats, error) { return statsService.AppStats(ctx) })
+}
+
+// Compact implements [CompactionService].
+func (s *retryingService) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	compactionService, ok := s.service.(CompactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support compaction: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*CompactResponse, error) { return compactionService.Compact(ctx, req) })
+}
+
+// WatchUser implements [WatchService]. Only starting the subscription is
+// retried.
+func (s *retryingService) WatchUser(ctx context.Context, req *WatchUserRequest) (*Subscription, error) {
+	watchService, ok := s.service.(WatchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support watching: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*Subscription, error) { return watchService.WatchUser(ctx, req) })
+}
+
+// AcquireLease implements [LeaseService].
+func (s *retryingService) AcquireLease(ctx context.Context, req *AcquireLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*Lease, error) { return leaseService.AcquireLease(ctx, req) })
+}
+
+// RenewLease implements [LeaseService].
+func (s *retryingService) RenewLease(ctx context.Context, req *RenewLeaseRequest) (*Lease, error) {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*Lease, error) { return leaseService.RenewLease(ctx, req) })
+}
+
+// ReleaseLease implements [LeaseService].
+func (s *retryingService) ReleaseLease(ctx context.Context, req *ReleaseLeaseRequest) error {
+	leaseService, ok := s.service.(LeaseService)
+	if !ok {
+		return fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	_, err := retryCall(ctx, s, func() (struct{}, error) { return struct{}{}, leaseService.ReleaseLease(ctx, req) })
+	return err
+}
+
+// Undo implements [UndoService].
+func (s *retryingService) Undo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*UndoResponse, error) { return undoService.Undo(ctx, req) })
+}
+
+// Redo implements [UndoService].
+func (s *retryingService) Redo(ctx context.Context, req *UndoRequest) (*UndoResponse, error) {
+	undoService, ok := s.service.(UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*UndoResponse, error) { return undoService.Redo(ctx, req) })
+}
+
+// Touch implements [TouchService].
+func (s *retryingService) Touch(ctx context.Context, req *TouchRequest) (*TouchResponse, error) {
+	touchService, ok := s.service.(TouchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support touching sessions: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*TouchResponse, error) { return touchService.Touch(ctx, req) })
+}
+
+// SetLabels implements [LabelService].
+func (s *retryingService) SetLabels(ctx context.Context, req *SetLabelsRequest) (*SetLabelsResponse, error) {
+	labelService, ok := s.service.(LabelService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support labels: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*SetLabelsResponse, error) { return labelService.SetLabels(ctx, req) })
+}
+
+// PinEvent implements [PinService].
+func (s *retryingService) PinEvent(ctx context.Context, req *PinEventRequest) (*PinEventResponse, error) {
+	pinService, ok := s.service.(PinService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support pinning events: %w", s.service, errors.ErrUnsupported)
+	}
+	return retryCall(ctx, s, func() (*PinEventResponse, error) { return pinService.PinEvent(ctx, req) })
+}
+
+var (
+	_ Service            = (*retryingService)(nil)
+	_ TransactionService = (*retryingService)(nil)
+	_ StatsService       = (*retryingService)(nil)
+	_ CompactionService  = (*retryingService)(nil)
+	_ WatchService       = (*retryingService)(nil)
+	_ LeaseService       = (*retryingService)(nil)
+	_ UndoService        = (*retryingService)(nil)
+	_ TouchService       = (*retryingService)(nil)
+	_ LabelService       = (*retryingService)(nil)
+	_ PinService         = (*retryingService)(nil)
+)
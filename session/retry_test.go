@@ -0,0 +1,257 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// scriptedService is a Service whose Get calls fail with the errors of the
+// script, in order, and succeed once it is exhausted.
+type scriptedService struct {
+	Service
+	errs  []error
+	calls int
+}
+
+func (s *scriptedService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return s.Service.Get(ctx, req)
+}
+
+// temporaryError is an error reporting whether it is temporary, like the
+// ones of the net package.
+type temporaryError bool
+
+func (e temporaryError) Error() string   { return fmt.Sprintf("temporary: %v", bool(e)) }
+func (e temporaryError) Temporary() bool { return bool(e) }
+
+func newTestRetrier(t *testing.T, cfg RetryConfig, errs ...error) (*retryingService, *scriptedService, *[]time.Duration) {
+	t.Helper()
+	inner := &scriptedService{Service: InMemoryService(), errs: errs}
+	if _, err := inner.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+	retrier := ServiceWithRetries(inner, cfg).(*retryingService)
+	var sleeps []time.Duration
+	retrier.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+	return retrier, inner, &sleeps
+}
+
+func TestIsTransient(t *testing.T) {
+	errPermanent := errors.New("permanent")
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errPermanent, false},
+		{MarkTransient(errPermanent), true},
+		{fmt.Errorf("wrapped: %w", MarkTransient(errPermanent)), true},
+		{&CircuitOpenError{RetryAfter: time.Second}, true},
+		{fmt.Errorf("shed: %w", ErrServiceOverloaded), true},
+		{temporaryError(true), true},
+		{temporaryError(false), false},
+		{ErrSessionNotFound, false},
+		{context.Canceled, false},
+		{MarkTransient(context.DeadlineExceeded), false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+	if got := MarkTransient(errPermanent).Error(); got != errPermanent.Error() {
+		t.Errorf("MarkTransient() message = %q, want %q", got, errPermanent.Error())
+	}
+	if MarkTransient(nil) != nil {
+		t.Errorf("MarkTransient(nil) != nil")
+	}
+}
+
+func TestRetries_TransientErrors(t *testing.T) {
+	retrier, inner, sleeps := newTestRetrier(t, RetryConfig{MaxAttempts: 4, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 15 * time.Millisecond, Jitter: JitterNone},
+		MarkTransient(errors.New("connection reset")), temporaryError(true), ErrServiceOverloaded)
+
+	if _, err := retrier.Get(t.Context(), testGetRequest); err != nil {
+		t.Fatalf("Get() error = %v, want success after the retries", err)
+	}
+	if inner.calls != 4 {
+		t.Errorf("wrapped service got %d calls, want 4", inner.calls)
+	}
+	if diff := cmp.Diff([]time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 15 * time.Millisecond}, *sleeps); diff != "" {
+		t.Errorf("backoffs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRetries_BackoffJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter Jitter
+		// min and max are the bounds of the delays before the 4 retries,
+		// with a backoff doubling from 1s up to 5s.
+		min, max []time.Duration
+	}{
+		{
+			name:   "none",
+			jitter: JitterNone,
+			min:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+			max:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		},
+		{
+			name:   "equal",
+			jitter: JitterEqual,
+			min:    []time.Duration{time.Second / 2, time.Second, 2 * time.Second, 5 * time.Second / 2},
+			max:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		},
+		{
+			name:   "full",
+			jitter: JitterFull,
+			min:    []time.Duration{0, 0, 0, 0},
+			max:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := RetryConfig{
+				MaxAttempts:    5,
+				InitialBackoff: time.Second,
+				MaxBackoff:     5 * time.Second,
+				Jitter:         tt.jitter,
+				Rand:           rand.New(rand.NewPCG(1, 2)),
+			}
+			distinct := make([]map[time.Duration]bool, 4)
+			for i := range distinct {
+				distinct[i] = map[time.Duration]bool{}
+			}
+			for range 100 {
+				errs := make([]error, 4)
+				for i := range errs {
+					errs[i] = ErrServiceOverloaded
+				}
+				retrier, _, sleeps := newTestRetrier(t, cfg, errs...)
+				if _, err := retrier.Get(t.Context(), testGetRequest); err != nil {
+					t.Fatalf("Get() error = %v, want success after the retries", err)
+				}
+				if len(*sleeps) != 4 {
+					t.Fatalf("got %d sleeps, want 4", len(*sleeps))
+				}
+				for i, d := range *sleeps {
+					if d < tt.min[i] || d > tt.max[i] {
+						t.Fatalf("delay before retry %d = %v, want within [%v, %v]", i+1, d, tt.min[i], tt.max[i])
+					}
+					distinct[i][d] = true
+				}
+			}
+			// Jittered delays spread over their window.
+			for i := range distinct {
+				if tt.min[i] != tt.max[i] && len(distinct[i]) < 90 {
+					t.Errorf("delay before retry %d took %d distinct values out of 100, want them spread", i+1, len(distinct[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestRetries_PermanentErrors(t *testing.T) {
+	retrier, inner, sleeps := newTestRetrier(t, RetryConfig{}, temporaryError(false))
+
+	if _, err := retrier.Get(t.Context(), testGetRequest); !errors.Is(err, temporaryError(false)) {
+		t.Fatalf("Get() error = %v, want %v", err, temporaryError(false))
+	}
+	if inner.calls != 1 || len(*sleeps) != 0 {
+		t.Errorf("wrapped service got %d calls after %d sleeps, want 1 call", inner.calls, len(*sleeps))
+	}
+}
+
+func TestRetries_MaxAttempts(t *testing.T) {
+	errBusy := MarkTransient(errors.New("database is locked"))
+	retrier, inner, _ := newTestRetrier(t, RetryConfig{MaxAttempts: 2}, errBusy, errBusy, errBusy)
+
+	if _, err := retrier.Get(t.Context(), testGetRequest); !errors.Is(err, errBusy) {
+		t.Fatalf("Get() error = %v, want %v", err, errBusy)
+	}
+	if inner.calls != 2 {
+		t.Errorf("wrapped service got %d calls, want 2", inner.calls)
+	}
+}
+
+func TestRetries_CustomClassifier(t *testing.T) {
+	errRetry := errors.New("retry me")
+	errStop := MarkTransient(errors.New("transient but not retried"))
+	classify := func(err error) bool {
+		switch {
+		case errors.Is(err, errRetry):
+			return true
+		case errors.Is(err, errStop):
+			return false
+		default:
+			return IsTransient(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "classified retryable", errs: []error{errRetry, errRetry}, wantCalls: 3},
+		{name: "classified not retryable", errs: []error{errStop}, wantErr: errStop, wantCalls: 1},
+		{name: "falls back to the default", errs: []error{temporaryError(true)}, wantCalls: 2},
+		{name: "default not retryable", errs: []error{errDown}, wantErr: errDown, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retrier, inner, _ := newTestRetrier(t, RetryConfig{MaxAttempts: 5, IsRetryable: classify}, tt.errs...)
+			_, err := retrier.Get(t.Context(), testGetRequest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Errorf("wrapped service got %d calls, want %d", inner.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetries_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	errBusy := MarkTransient(errors.New("database is locked"))
+	retrier, inner, _ := newTestRetrier(t, RetryConfig{MaxAttempts: 5}, errBusy, errBusy)
+	cancel()
+
+	if _, err := retrier.Get(ctx, testGetRequest); !errors.Is(err, errBusy) {
+		t.Fatalf("Get() error = %v, want %v", err, errBusy)
+	}
+	if inner.calls != 1 {
+		t.Errorf("wrapped service got %d calls, want 1", inner.calls)
+	}
+}
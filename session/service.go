@@ -16,9 +16,14 @@ package session
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrSessionNotFound is returned, wrapped, when the session an operation
+// targets doesn't exist.
+var ErrSessionNotFound = errors.New("session not found")
+
 // Service is a session storage service.
 //
 // It provides a set of methods for managing sessions and events.
@@ -33,12 +38,101 @@ type Service interface {
 
 // InMemoryService returns an in-memory implementation of the session service.
 func InMemoryService() Service {
+	return InMemoryServiceWithConfig(InMemoryServiceConfig{})
+}
+
+// InMemoryServiceWithConfig returns an in-memory implementation of the
+// session service using the given config.
+func InMemoryServiceWithConfig(cfg InMemoryServiceConfig) Service {
 	return &inMemoryService{
+		cfg:       cfg,
 		appState:  make(map[string]stateMap),
 		userState: make(map[string]map[string]stateMap),
 	}
 }
 
+// InMemoryServiceConfig contains optional settings of the in-memory session
+// service. The zero value is a valid config.
+type InMemoryServiceConfig struct {
+	// ReplayWindow enables replay protection of appended events.
+	// An event with the same author and content as the most recent event of
+	// the session, appended at most ReplayWindow after it by the clock of
+	// Now, is treated as a retry of that event: it is not stored, and the
+	// appended event is set to the stored one.
+	// Optional: if zero, every appended event is stored.
+	ReplayWindow time.Duration
+	// ContentLimits limits the content size of appended events, per app.
+	// Optional: by default the content size is not limited.
+	ContentLimits ContentLimits
+	// MaxEvents caps the number of events of a session, per app. Appends to
+	// a full session fail with [ErrSessionFull].
+	// Optional: by default the number of events is not limited.
+	MaxEvents EventCountLimits
+	// MaxUserEvents caps the total number of events across all the
+	// sessions of a user, per app. Appends past the cap fail with
+	// [ErrUserEventsExceeded].
+	// Optional: by default the number of events of a user is not limited.
+	MaxUserEvents UserEventLimits
+	// MaxStateKeys caps the number of keys of a session state, its app and
+	// user keys included, per app. Appends and transactions growing a state
+	// past the cap fail with [ErrStateKeysExceeded]; the check runs under the
+	// lock storing the event, so concurrent writers can't get past it.
+	// Optional: by default the number of state keys is not limited.
+	MaxStateKeys StateKeyLimits
+	// MaxSessions caps the number of sessions of each user, and of each
+	// app, enforced when sessions are created. Creations past the cap fail
+	// with [ErrTooManySessions] or evict the oldest idle sessions,
+	// depending on the eviction of the limit.
+	// Optional: by default the number of sessions is not limited.
+	MaxSessions SessionCountLimits
+	// Retention trims the oldest events of a session past a count or an
+	// age, per app, whenever an event is appended. Pinned events are kept,
+	// see [PinnedTag].
+	// Optional: by default every event is kept.
+	Retention EventRetentionLimits
+	// RequireLease makes appends to and compactions of a leased session
+	// fail with [ErrLeaseHeld] unless their context carries the token of
+	// the lease, see [ContextWithLeaseToken]. Sessions without a lease
+	// accept any write.
+	RequireLease bool
+	// AllowUpdatedAtRegression sets the update time of a session to the
+	// timestamp of each appended event, even when it is earlier than the
+	// current update time. By default the update time never moves backward:
+	// it is the latest of the current update time and the event timestamp,
+	// so that events stamped by a lagging clock don't break the ordering of
+	// sessions or their ETags.
+	AllowUpdatedAtRegression bool
+	// Ingestion limits the rate of appended events, see
+	// [NewIngestionLimiter]. Appends are limited before they are applied, so
+	// that waiting for the rate doesn't block other sessions. Every event of
+	// a transaction is admitted, one shed event aborts the transaction.
+	// Optional: if nil, the rate is not limited.
+	Ingestion *IngestionLimiter
+	// Creation limits the rate of created sessions, per app and per user,
+	// see [NewCreationLimiter].
+	// Optional: if nil, the rate is not limited.
+	Creation *CreationLimiter
+	// UndoHistory enables [UndoService] for the apps with a limit, and
+	// bounds the number of state changes recorded per session.
+	// Optional: by default undo is disabled and nothing is recorded.
+	UndoHistory UndoHistoryLimits
+	// SessionTTL makes the sessions expire once they have been inactive for
+	// that long. Creating a session, appending to it and touching it, see
+	// [TouchService], extend its expiry; reading it doesn't. Expired
+	// sessions are treated as deleted.
+	// Optional: if zero, sessions never expire.
+	SessionTTL time.Duration
+	// MaxSessionAge makes the sessions expire once they have existed for
+	// that long since their creation, however active they are. With a
+	// SessionTTL too, a session expires at the sooner of the two. Expired
+	// sessions are treated as deleted.
+	// Optional: if zero, the age of sessions is not limited.
+	MaxSessionAge time.Duration
+	// Now returns the current time of the session expiry and of the
+	// replay window. Optional: defaults to time.Now.
+	Now func() time.Time
+}
+
 // CreateRequest represents a request to create a session.
 type CreateRequest struct {
 	AppName string
@@ -48,6 +142,10 @@ type CreateRequest struct {
 	SessionID string
 	// State is the initial state of the session.
 	State map[string]any
+	// Labels are the initial labels of the session, see [LabelService].
+	// Labels with an empty value are left out. Services which don't store
+	// labels ignore them.
+	Labels map[string]string
 }
 
 // CreateResponse represents a response for newly created session.
@@ -78,6 +176,12 @@ type GetResponse struct {
 type ListRequest struct {
 	AppName string
 	UserID  string
+	// Labels selects the sessions having all of these labels, see
+	// [MatchLabels]. Services which don't store labels ignore it, callers
+	// filter the listed sessions with MatchLabels to be independent of the
+	// service.
+	// Optional: if empty, every session is listed.
+	Labels map[string]string
 }
 
 // ListResponse represents a response from [Service.List].
@@ -91,3 +195,93 @@ type DeleteRequest struct {
 	UserID    string
 	SessionID string
 }
+
+// TransactionService is implemented by a [Service] that can append events
+// to several sessions atomically.
+type TransactionService interface {
+	// Transact appends the event of every operation to its session, applying
+	// the state deltas of all events or none of them. The directives of an
+	// operation are resolved against the state the operations before it
+	// leave, the operations on the same session being applied in order.
+	Transact(context.Context, *TransactRequest) (*TransactResponse, error)
+}
+
+// TransactRequest represents a request to atomically append events to
+// multiple sessions.
+type TransactRequest struct {
+	Ops []TransactOp
+}
+
+// TransactOp is a single operation of a [TransactRequest].
+type TransactOp struct {
+	AppName   string
+	UserID    string
+	SessionID string
+	// Event is appended to the session, its state delta is applied to the
+	// session state.
+	Event *Event
+}
+
+// TransactResponse represents a response from [TransactionService.Transact].
+type TransactResponse struct {
+	// Sessions contains the updated sessions, in the order of the request
+	// operations.
+	Sessions []Session
+}
+
+// StatsService is implemented by a [Service] that keeps storage statistics
+// of the apps it stores sessions for.
+type StatsService interface {
+	// AppStats returns the current statistics keyed by app name.
+	AppStats(context.Context) (map[string]AppStats, error)
+}
+
+// AppStats contains the aggregated storage statistics of an app.
+type AppStats struct {
+	// Sessions is the number of stored sessions.
+	Sessions int
+	// StateBytes is the size of the JSON encoded state of all sessions.
+	StateBytes int64
+	// Events is the number of stored events across all sessions.
+	Events int
+}
+
+// CompactionService is implemented by a [Service] that can fold the oldest
+// events of a session into a summary stored in the session state.
+type CompactionService interface {
+	// Compact summarizes the events selected by the request, writes the
+	// summary to the request's state key and removes the summarized events.
+	// Either all of it happens or nothing does.
+	Compact(context.Context, *CompactRequest) (*CompactResponse, error)
+}
+
+// Summarizer produces the summary of the events being compacted. The events
+// are passed oldest first.
+type Summarizer func(ctx context.Context, events []*Event) (any, error)
+
+// CompactRequest represents a request to compact the event history of a
+// session. Exactly one of Before and Count selects the events to compact.
+type CompactRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+
+	// Before selects the events with a timestamp before it.
+	Before time.Time
+	// Count selects the Count oldest events.
+	Count int
+
+	// SummaryKey is the state key the summary is written to. It may use the
+	// app: and user: prefixes, temp: keys are rejected.
+	SummaryKey string
+	// Summarizer produces the summary of the selected events. It is called
+	// with the session locked, so it shouldn't use the session service.
+	Summarizer Summarizer
+}
+
+// CompactResponse represents a response from [CompactionService.Compact].
+type CompactResponse struct {
+	Session Session
+	// Compacted is the number of events folded into the summary.
+	Compacted int
+}
@@ -15,11 +15,16 @@
 package session
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"iter"
 	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/genai"
 
 	"google.golang.org/adk/model"
 )
@@ -94,6 +99,12 @@ type Event struct {
 	// Set by storage
 	ID        string
 	Timestamp time.Time
+	// Sequence is the position of the event in its session, assigned by
+	// the storage when the event is appended: 1 for the first event of the
+	// session, and one more for every event after it, even when the
+	// clocks of the authors tie or are skewed. It is zero for the events
+	// not stored yet, and with storages which don't assign sequences.
+	Sequence int64
 
 	// Set by agent.Context implementation.
 	InvocationID string
@@ -114,6 +125,9 @@ type Event struct {
 	// Agent client will know from this field about which function call is long running.
 	// Only valid for function call event.
 	LongRunningToolIDs []string
+	// Tags are optional custom labels attached to the event, e.g. "billing"
+	// or "handoff", that can be used to filter events.
+	Tags map[string]string
 }
 
 // IsFinalResponse returns whether the event is the final response of an agent.
@@ -170,6 +184,12 @@ const (
 	// They are tied to the user_id, shared across all sessions for that user
 	// (within the same app_name).
 	KeyPrefixUser string = "user:"
+	// KeyPrefixSystem is the prefix for system state keys, server-managed
+	// values like the tier of a tenant which agents and clients read but
+	// must not overwrite. The runner and the REST API can be configured to
+	// reject their writes, see [CheckSystemStateDelta]. Their scope is the
+	// session.
+	KeyPrefixSystem string = "sys:"
 )
 
 // ErrStateKeyNotExist is the error thrown when key does not exist.
@@ -207,3 +227,18 @@ func hasTrailingCodeExecutionResult(resp *model.LLMResponse) bool {
 	lastPart := resp.Content.Parts[len(resp.Content.Parts)-1]
 	return lastPart.CodeExecutionResult != nil
 }
+
+// eventContentHash returns a hash of the content and actions of the event.
+// Events with the same hash carry the same payload, regardless of their IDs
+// and timestamps.
+func eventContentHash(event *Event) (string, error) {
+	payload, err := json.Marshal(struct {
+		Content *genai.Content
+		Actions EventActions
+	}{event.Content, event.Actions})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTooManySessions is returned, wrapped, when a session is created for a
+// user or app which already holds the maximum number of sessions, and the
+// [SessionCountLimit] rejects new sessions.
+var ErrTooManySessions = errors.New("too many sessions")
+
+// SessionEviction selects what happens to a session created past a
+// [SessionCountLimit].
+type SessionEviction int
+
+const (
+	// SessionEvictionReject fails the creation with [ErrTooManySessions].
+	SessionEvictionReject SessionEviction = iota
+	// SessionEvictionOldestIdle deletes the least recently updated
+	// sessions of the user, or of the app for the per-app limit, to make
+	// room for the new one.
+	SessionEvictionOldestIdle
+)
+
+// SessionCountLimit bounds the number of sessions of an app, enforced when
+// sessions are created.
+type SessionCountLimit struct {
+	// MaxPerUser is the number of sessions of each user of the app.
+	// Optional: if zero, the sessions of a user are not limited.
+	MaxPerUser int
+	// MaxPerApp is the number of sessions of the app, across its users.
+	// Optional: if zero, the sessions of the app are not limited.
+	MaxPerApp int
+	// Eviction is what happens to a session created past a limit.
+	Eviction SessionEviction
+}
+
+// SessionCountLimits holds the session count limits of the apps of a
+// service.
+type SessionCountLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default SessionCountLimit
+	// Apps maps an app name to its session count limit.
+	Apps map[string]SessionCountLimit
+}
+
+// ForApp returns the session count limit of the app.
+func (l SessionCountLimits) ForApp(appName string) SessionCountLimit {
+	if limit, ok := l.Apps[appName]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Check returns an error wrapping [ErrTooManySessions] if a session can't
+// be created for a user holding userSessions sessions, in an app holding
+// appSessions. perUser reports whether the per-user limit is the one
+// reached, which is checked first.
+func (l SessionCountLimit) Check(appName, userID string, userSessions, appSessions int) (perUser bool, err error) {
+	if l.MaxPerUser > 0 && userSessions >= l.MaxPerUser {
+		return true, fmt.Errorf("%w: user %q of app %q holds %d sessions, the limit is %d", ErrTooManySessions, userID, appName, userSessions, l.MaxPerUser)
+	}
+	if l.MaxPerApp > 0 && appSessions >= l.MaxPerApp {
+		return false, fmt.Errorf("%w: app %q holds %d sessions, the limit is %d", ErrTooManySessions, appName, appSessions, l.MaxPerApp)
+	}
+	return false, nil
+}
+
+// admitSession makes room for a session of the user under the session
+// count limit of the app, evicting the oldest idle sessions if the limit
+// allows it. The caller must hold s.mu for writing.
+func (s *inMemoryService) admitSession(appName, userID string) error {
+	limit := s.cfg.MaxSessions.ForApp(appName)
+	if limit.MaxPerUser <= 0 && limit.MaxPerApp <= 0 {
+		return nil
+	}
+	swept := false
+	for {
+		perUser, err := limit.Check(appName, userID, s.userSessions[appName][userID], s.statsFor(appName).Sessions)
+		if err == nil {
+			return nil
+		}
+		if !swept && len(s.expiresAt) > 0 {
+			// Expired sessions don't count, they are only removed lazily.
+			s.sweepExpired()
+			swept = true
+			continue
+		}
+		if limit.Eviction != SessionEvictionOldestIdle {
+			return err
+		}
+		scope := id{appName: appName}
+		if perUser {
+			scope.userID = userID
+		}
+		key, oldest, ok := s.oldestIdle(scope)
+		if !ok {
+			return err
+		}
+		s.remove(key, oldest)
+	}
+}
+
+// oldestIdle returns the least recently updated session of the app, or of
+// the user if the scope has one. The caller must hold s.mu.
+func (s *inMemoryService) oldestIdle(scope id) (string, *session, bool) {
+	lo := id{appName: scope.appName, userID: scope.userID}.Encode()
+	hi := id{appName: scope.appName + "\x00"}.Encode()
+	if scope.userID != "" {
+		hi = id{appName: scope.appName, userID: scope.userID + "\x00"}.Encode()
+	}
+	var (
+		oldestKey string
+		oldest    *session
+		updatedAt time.Time
+	)
+	for key, storedSession := range s.sessions.Scan(lo, hi) {
+		if oldest == nil || storedSession.updatedAt.Before(updatedAt) {
+			oldestKey, oldest, updatedAt = key, storedSession, storedSession.updatedAt
+		}
+	}
+	return oldestKey, oldest, oldest != nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func listSessionIDs(t *testing.T, s Service, appName, userID string) []string {
+	t.Helper()
+	resp, err := s.List(t.Context(), &ListRequest{AppName: appName, UserID: userID})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var ids []string
+	for _, sess := range resp.Sessions {
+		ids = append(ids, sess.ID())
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func Test_inMemoryService_MaxSessionsReject(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		MaxSessions: SessionCountLimits{Apps: map[string]SessionCountLimit{"capped": {MaxPerUser: 2, MaxPerApp: 3}}},
+	})
+
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := s.Create(ctx, &CreateRequest{AppName: "capped", UserID: "u1", SessionID: id}); err != nil {
+			t.Fatalf("Create(%s) error = %v", id, err)
+		}
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "capped", UserID: "u1", SessionID: "s3"}); !errors.Is(err, ErrTooManySessions) {
+		t.Errorf("Create() past the per-user cap error = %v, want %v", err, ErrTooManySessions)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "capped", UserID: "u2", SessionID: "s1"}); err != nil {
+		t.Errorf("Create() for another user error = %v", err)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "capped", UserID: "u3", SessionID: "s1"}); !errors.Is(err, ErrTooManySessions) {
+		t.Errorf("Create() past the per-app cap error = %v, want %v", err, ErrTooManySessions)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "other", UserID: "u1", SessionID: "s3"}); err != nil {
+		t.Errorf("Create() in an uncapped app error = %v", err)
+	}
+
+	// Deleting a session frees its slot.
+	if err := s.Delete(ctx, &DeleteRequest{AppName: "capped", UserID: "u1", SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "capped", UserID: "u1", SessionID: "s3"}); err != nil {
+		t.Errorf("Create() after a deletion error = %v", err)
+	}
+	if got, want := listSessionIDs(t, s, "capped", "u1"), []string{"s2", "s3"}; !slices.Equal(got, want) {
+		t.Errorf("sessions of u1 = %v, want %v", got, want)
+	}
+}
+
+func Test_inMemoryService_MaxSessionsEvictOldestIdle(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		MaxSessions: SessionCountLimits{Default: SessionCountLimit{MaxPerUser: 2, MaxPerApp: 3, Eviction: SessionEvictionOldestIdle}},
+	})
+	created := map[string]Session{}
+	for _, id := range []string{"s1", "s2"} {
+		resp, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "u1", SessionID: id})
+		if err != nil {
+			t.Fatalf("Create(%s) error = %v", id, err)
+		}
+		created[id] = resp.Session
+	}
+	// s1 is used again, which leaves s2 the oldest idle session.
+	event := NewEvent("inv")
+	event.Timestamp = time.Now().Add(time.Second)
+	if err := s.AppendEvent(ctx, created["s1"], event); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "u1", SessionID: "s3"}); err != nil {
+		t.Fatalf("Create() past the per-user cap error = %v", err)
+	}
+	if got, want := listSessionIDs(t, s, "app", "u1"), []string{"s1", "s3"}; !slices.Equal(got, want) {
+		t.Errorf("sessions of u1 = %v, want %v", got, want)
+	}
+
+	// The app holds 3 sessions, the next one evicts the oldest idle of the
+	// app: s3 of u1, s1 being updated later.
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "u2", SessionID: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "u2", SessionID: "t2"}); err != nil {
+		t.Fatalf("Create() past the per-app cap error = %v", err)
+	}
+	if got, want := listSessionIDs(t, s, "app", ""), []string{"s1", "t1", "t2"}; !slices.Equal(got, want) {
+		t.Errorf("sessions of the app = %v, want %v", got, want)
+	}
+	stats, err := s.(StatsService).AppStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stats["app"]; got.Sessions != 3 || got.Events != 1 {
+		t.Errorf("AppStats() = %+v, want 3 sessions and 1 event", got)
+	}
+}
+
+func Test_inMemoryService_MaxSessionsIgnoresExpired(t *testing.T) {
+	ctx := t.Context()
+	now := time.Now()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{
+		MaxSessions: SessionCountLimits{Default: SessionCountLimit{MaxPerUser: 1}},
+		SessionTTL:  time.Minute,
+		Now:         func() time.Time { return now },
+	})
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "u1", SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "u1", SessionID: "s2"}); err != nil {
+		t.Errorf("Create() after the only session expired error = %v", err)
+	}
+}
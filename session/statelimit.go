@@ -0,0 +1,78 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrStateKeysExceeded is returned, wrapped, when an appended event would
+// grow the state of its session past the maximum number of keys of its app.
+// The session is left unchanged.
+var ErrStateKeysExceeded = errors.New("state key limit exceeded")
+
+// StateKeyLimits holds the maximum number of keys of a session state, its
+// app and user keys included, per app. A limit of zero or less means no
+// limit.
+type StateKeyLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default int
+	// Apps maps an app name to its limit.
+	Apps map[string]int
+}
+
+// ForApp returns the state key limit of the app.
+func (l StateKeyLimits) ForApp(appName string) int {
+	if limit, ok := l.Apps[appName]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Check returns an error wrapping [ErrStateKeysExceeded] if applying the
+// resolved delta to the state of a session of the app would grow its
+// number of keys past the limit. Deltas which don't grow the state are
+// accepted, even when it is already past the limit. Temp keys don't count.
+func (l StateKeyLimits) Check(appName, sessionID string, state, delta map[string]any) error {
+	limit := l.ForApp(appName)
+	if limit <= 0 || len(delta) == 0 {
+		return nil
+	}
+	before := 0
+	for key := range state {
+		if !strings.HasPrefix(key, KeyPrefixTemp) {
+			before++
+		}
+	}
+	after := before
+	for key, value := range delta {
+		if strings.HasPrefix(key, KeyPrefixTemp) {
+			continue
+		}
+		_, exists := state[key]
+		switch {
+		case value == nil && exists:
+			after--
+		case value != nil && !exists:
+			after++
+		}
+	}
+	if after <= limit || after <= before {
+		return nil
+	}
+	return fmt.Errorf("%w: the state of session %q would hold %d keys, the limit is %d", ErrStateKeysExceeded, sessionID, after, limit)
+}
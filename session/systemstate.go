@@ -0,0 +1,39 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ErrSystemStateWrite is returned, wrapped, by [CheckSystemStateDelta] for
+// the deltas writing system state keys.
+var ErrSystemStateWrite = errors.New("system state keys can only be written by the server")
+
+// CheckSystemStateDelta returns an error wrapping [ErrSystemStateWrite]
+// naming the first key of the delta with the [KeyPrefixSystem] prefix, for
+// the writers which must leave the system state to the server.
+func CheckSystemStateDelta(delta map[string]any) error {
+	for _, key := range slices.Sorted(maps.Keys(delta)) {
+		if strings.HasPrefix(key, KeyPrefixSystem) {
+			return fmt.Errorf("%w: %q", ErrSystemStateWrite, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// DecodeState decodes the state of the session into a value of type T,
+// usually a struct describing the state schema of an app.
+//
+// Struct fields are matched with state keys by their json tag, or by their
+// name when untagged, case-insensitively. Nested maps decode into nested
+// structs, RFC 3339 strings into [time.Time] fields and numbers into any
+// numeric field they fit exactly, so states decoded from JSON work as is.
+// Keys without a matching field are ignored. A value of the wrong type
+// fails with an error naming the offending key.
+func DecodeState[T any](s Session) (T, error) {
+	var result T
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName: "json",
+		Result:  &result,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+			exactNumberHook,
+		),
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to decode state into %T: %w", result, err)
+	}
+	if err := decoder.Decode(maps.Collect(s.State().All())); err != nil {
+		return result, fmt.Errorf("failed to decode state into %T: %w", result, err)
+	}
+	return result, nil
+}
+
+// exactNumberHook rejects floats with a fractional part, or out of range,
+// for integer fields instead of silently truncating them.
+func exactNumberHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.Float32 && from.Kind() != reflect.Float64 {
+		return data, nil
+	}
+	f := reflect.ValueOf(data).Float()
+	field := reflect.New(to).Elem()
+	switch to.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f != math.Trunc(f) {
+			return nil, fmt.Errorf("%v is not an integer", f)
+		}
+		if f < math.MinInt64 || f >= math.MaxInt64 || field.OverflowInt(int64(f)) {
+			return nil, fmt.Errorf("%v overflows %s", f, to)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f != math.Trunc(f) {
+			return nil, fmt.Errorf("%v is not an integer", f)
+		}
+		if f < 0 || f >= math.MaxUint64 || field.OverflowUint(uint64(f)) {
+			return nil, fmt.Errorf("%v overflows %s", f, to)
+		}
+	}
+	return data, nil
+}
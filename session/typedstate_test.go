@@ -0,0 +1,138 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testProfile struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age"`
+	Tags []string `json:"tags"`
+}
+
+type testAppState struct {
+	Progress float64      `json:"progress"`
+	Steps    int          `json:"steps"`
+	Profile  testProfile  `json:"profile"`
+	Previous *testProfile `json:"previous"`
+	Deadline time.Time    `json:"deadline"`
+	Theme    string       `json:"user:theme"`
+}
+
+func TestDecodeState(t *testing.T) {
+	deadline := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name            string
+		state           map[string]any
+		want            testAppState
+		wantErrContains string
+	}{
+		{
+			name: "nested fields",
+			state: map[string]any{
+				"progress":   42.5,
+				"steps":      float64(3),
+				"profile":    map[string]any{"name": "ada", "age": float64(36), "tags": []any{"admin", "beta"}},
+				"previous":   map[string]any{"name": "bob"},
+				"deadline":   deadline.Format(time.RFC3339),
+				"user:theme": "dark",
+				"unrelated":  true,
+			},
+			want: testAppState{
+				Progress: 42.5,
+				Steps:    3,
+				Profile:  testProfile{Name: "ada", Age: 36, Tags: []string{"admin", "beta"}},
+				Previous: &testProfile{Name: "bob"},
+				Deadline: deadline,
+				Theme:    "dark",
+			},
+		},
+		{
+			name:  "missing keys keep the zero value",
+			state: map[string]any{"steps": 1},
+			want:  testAppState{Steps: 1},
+		},
+		{
+			name:            "string for a number",
+			state:           map[string]any{"steps": "three"},
+			wantErrContains: "'steps' expected type 'int', got unconvertible type 'string'",
+		},
+		{
+			name:            "fractional number for an integer",
+			state:           map[string]any{"steps": 2.5},
+			wantErrContains: "2.5 is not an integer",
+		},
+		{
+			name:            "nested mismatch names the nested key",
+			state:           map[string]any{"profile": map[string]any{"age": "old"}},
+			wantErrContains: "'profile.age'",
+		},
+		{
+			name:            "scalar for a struct",
+			state:           map[string]any{"profile": "ada"},
+			wantErrContains: "'profile'",
+		},
+		{
+			name:            "invalid time",
+			state:           map[string]any{"deadline": "tomorrow"},
+			wantErrContains: "deadline",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := InMemoryService()
+			created, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", State: tt.state})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := DecodeState[testAppState](created.Session)
+
+			if tt.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Fatalf("DecodeState() error = %v, want it to contain %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeState() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("DecodeState() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeState_Map(t *testing.T) {
+	s := InMemoryService()
+	created, err := s.Create(t.Context(), &CreateRequest{AppName: "app", UserID: "user", State: map[string]any{"a": 1, "b": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeState[map[string]int](created.Session)
+	if err != nil {
+		t.Fatalf("DecodeState() error = %v", err)
+	}
+	if diff := cmp.Diff(map[string]int{"a": 1, "b": 2}, got); diff != "" {
+		t.Errorf("DecodeState() mismatch (-want +got):\n%s", diff)
+	}
+}
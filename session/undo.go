@@ -0,0 +1,128 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNothingToUndo is returned, wrapped, by [UndoService.Undo] when the
+// session has no recorded state change left to revert.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// ErrNothingToRedo is returned, wrapped, by [UndoService.Redo] when no
+// reverted state change is left to reapply, or when the session changed
+// since the last undo.
+var ErrNothingToRedo = errors.New("nothing to redo")
+
+// UndoService is implemented by a [Service] that records the state changes
+// of the sessions so they can be reverted and reapplied. Every stored event
+// with a state delta pushes its change on the undo stack of its session.
+// Undo appends an event reverting the most recent change and moves the
+// change to the redo stack; Redo appends an event reapplying it. Any other
+// change clears the redo stack.
+//
+// State keys with the app: and user: prefixes are shared by several
+// sessions: undoing a change restores their previous value even if other
+// sessions changed them since.
+type UndoService interface {
+	// Undo reverts the most recent state change of the session not
+	// reverted yet. It fails with [ErrNothingToUndo] if there is none.
+	Undo(context.Context, *UndoRequest) (*UndoResponse, error)
+	// Redo reapplies the most recently reverted state change. It fails
+	// with [ErrNothingToRedo] if there is none.
+	Redo(context.Context, *UndoRequest) (*UndoResponse, error)
+}
+
+// UndoRequest represents a request to undo or redo a state change.
+type UndoRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+
+	// Author is the author of the appended event. Optional: defaults to
+	// "user".
+	Author string
+}
+
+// UndoResponse represents a response from [UndoService.Undo] and
+// [UndoService.Redo].
+type UndoResponse struct {
+	Session Session
+	// Event is the appended event, whose state delta reverts or reapplies
+	// the change.
+	Event *Event
+	// UndoDepth and RedoDepth are the number of changes left on the
+	// stacks.
+	UndoDepth, RedoDepth int
+}
+
+// UndoHistoryLimits holds the number of state changes recorded for undo per
+// session, per app. A limit of zero or less disables undo for the app, so
+// that apps not using it don't pay for the storage of the history.
+type UndoHistoryLimits struct {
+	// Default applies to the apps without an entry in Apps.
+	Default int
+	// Apps maps an app name to its limit.
+	Apps map[string]int
+}
+
+// ForApp returns the undo history limit of the app.
+func (l UndoHistoryLimits) ForApp(appName string) int {
+	if limit, ok := l.Apps[appName]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// stateChange is a state delta along with its inverse, the delta restoring
+// the values the keys had before.
+type stateChange struct {
+	delta, inverse map[string]any
+}
+
+// undoHistory holds the undo and redo stacks of a session, most recent
+// change last.
+type undoHistory struct {
+	undo, redo []stateChange
+}
+
+// newStateChange returns the change of the resolved state delta applied to
+// the state, or false if the delta changes nothing worth undoing. temp:
+// keys are not recorded, they don't outlive the invocation. A deleted or
+// absent key is nil in the deltas, as in the deltas of events.
+func newStateChange(state, delta map[string]any) (stateChange, bool) {
+	change := stateChange{delta: map[string]any{}, inverse: map[string]any{}}
+	for key, value := range delta {
+		if strings.HasPrefix(key, KeyPrefixTemp) {
+			continue
+		}
+		change.delta[key] = value
+		change.inverse[key] = state[key]
+	}
+	return change, len(change.delta) > 0
+}
+
+// record pushes a new change, dropping the oldest ones past limit, and
+// clears the redo stack.
+func (h *undoHistory) record(change stateChange, limit int) {
+	h.undo = append(h.undo, change)
+	if excess := len(h.undo) - limit; excess > 0 {
+		h.undo = append([]stateChange(nil), h.undo[excess:]...)
+	}
+	h.redo = nil
+}
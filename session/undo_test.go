@@ -0,0 +1,149 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInMemoryService_UndoRedo(t *testing.T) {
+	ctx := t.Context()
+	service := InMemoryServiceWithConfig(InMemoryServiceConfig{UndoHistory: UndoHistoryLimits{Default: 10}}).(UndoService)
+	s := service.(Service)
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session", State: map[string]any{"color": "red"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &UndoRequest{AppName: "app", UserID: "user", SessionID: "session"}
+	appendDelta := func(delta map[string]any) {
+		t.Helper()
+		if err := s.AppendEvent(ctx, created.Session, stateEvent(delta)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := func() map[string]any {
+		t.Helper()
+		resp, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return maps.Collect(resp.Session.State().All())
+	}
+	check := func(step string, resp *UndoResponse, err error, want map[string]any, undoDepth, redoDepth int) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if diff := cmp.Diff(want, state()); diff != "" {
+			t.Errorf("%s: state mismatch (-want +got):\n%s", step, diff)
+		}
+		if diff := cmp.Diff(want, maps.Collect(resp.Session.State().All())); diff != "" {
+			t.Errorf("%s: returned state mismatch (-want +got):\n%s", step, diff)
+		}
+		if resp.UndoDepth != undoDepth || resp.RedoDepth != redoDepth {
+			t.Errorf("%s: depths = %d, %d, want %d, %d", step, resp.UndoDepth, resp.RedoDepth, undoDepth, redoDepth)
+		}
+	}
+
+	// Set a new key and change one, then delete one.
+	appendDelta(map[string]any{"color": "blue", "size": 3})
+	appendDelta(map[string]any{"color": nil})
+	if diff := cmp.Diff(map[string]any{"size": 3}, state()); diff != "" {
+		t.Fatalf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	resp, err := service.Undo(ctx, req)
+	check("undo delete", resp, err, map[string]any{"color": "blue", "size": 3}, 1, 1)
+	if resp.Event.Author != "user" || resp.Event.Actions.StateDelta["color"] != "blue" {
+		t.Errorf("undo event = %+v, want a user event restoring color", resp.Event)
+	}
+	resp, err = service.Undo(ctx, req)
+	check("undo set", resp, err, map[string]any{"color": "red"}, 0, 2)
+	if _, err := service.Undo(ctx, req); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() with an empty stack error = %v, want ErrNothingToUndo", err)
+	}
+
+	resp, err = service.Redo(ctx, req)
+	check("redo set", resp, err, map[string]any{"color": "blue", "size": 3}, 1, 1)
+	resp, err = service.Redo(ctx, req)
+	check("redo delete", resp, err, map[string]any{"size": 3}, 2, 0)
+	if _, err := service.Redo(ctx, req); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo() with an empty stack error = %v, want ErrNothingToRedo", err)
+	}
+
+	// A new change after an undo clears the redo stack.
+	resp, err = service.Undo(ctx, req)
+	check("undo again", resp, err, map[string]any{"color": "blue", "size": 3}, 1, 1)
+	appendDelta(map[string]any{"size": 4})
+	if _, err := service.Redo(ctx, req); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo() after a new change error = %v, want ErrNothingToRedo", err)
+	}
+	resp, err = service.Undo(ctx, req)
+	check("undo new change", resp, err, map[string]any{"color": "blue", "size": 3}, 1, 1)
+
+	// Undo and redo are recorded as events.
+	got, err := s.Get(ctx, &GetRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Session.Events().Len(); n != 9 {
+		t.Errorf("session has %d events, want 9", n)
+	}
+}
+
+func TestInMemoryService_UndoHistoryLimits(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryServiceWithConfig(InMemoryServiceConfig{UndoHistory: UndoHistoryLimits{Apps: map[string]int{"undoable": 2}}})
+	service := s.(UndoService)
+	for _, appName := range []string{"undoable", "other"} {
+		created, err := s.Create(ctx, &CreateRequest{AppName: appName, UserID: "user", SessionID: "session"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 3 {
+			if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"step": i, "temp:scratch": i})); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Undo is disabled for the apps without a limit.
+	if _, err := service.Undo(ctx, &UndoRequest{AppName: "other", UserID: "user", SessionID: "session"}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Undo() of an app without history error = %v, want ErrUnsupported", err)
+	}
+
+	// Only the two most recent changes are kept, without the temp: keys.
+	req := &UndoRequest{AppName: "undoable", UserID: "user", SessionID: "session"}
+	var resp *UndoResponse
+	for range 2 {
+		var err error
+		if resp, err = service.Undo(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := resp.Event.Actions.StateDelta["temp:scratch"]; ok {
+			t.Errorf("undo event delta = %v, want no temp: key", resp.Event.Actions.StateDelta)
+		}
+	}
+	if diff := cmp.Diff(map[string]any{"step": 0}, maps.Collect(resp.Session.State().All())); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := service.Undo(ctx, req); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() past the limit error = %v, want ErrNothingToUndo", err)
+	}
+}
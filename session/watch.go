@@ -0,0 +1,146 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultWatchBufferSize is the number of events buffered for a subscriber
+// when [WatchUserRequest.BufferSize] is not set.
+const defaultWatchBufferSize = 64
+
+// WatchService is implemented by a [Service] that can stream the events
+// appended to the sessions of a user.
+type WatchService interface {
+	// WatchUser subscribes to the events appended to any session of the
+	// user, including sessions created after the subscription starts.
+	// The subscription ends, and its channel is closed, when the context is
+	// done.
+	WatchUser(context.Context, *WatchUserRequest) (*Subscription, error)
+}
+
+// WatchUserRequest represents a request to subscribe to the events of all
+// sessions of a user.
+type WatchUserRequest struct {
+	AppName string
+	UserID  string
+
+	// BufferSize is the number of events buffered for a consumer that falls
+	// behind. Events published while the buffer is full are dropped rather
+	// than blocking the writer. Defaults to 64.
+	BufferSize int
+}
+
+// SessionEvent is an event delivered by a [Subscription], tagged with the
+// session it was appended to.
+type SessionEvent struct {
+	SessionID string
+	// Event is the stored event. It must not be modified.
+	Event *Event
+}
+
+// Subscription is a stream of the events appended to the sessions of a
+// user, see [WatchService].
+type Subscription struct {
+	events  chan SessionEvent
+	dropped atomic.Int64
+}
+
+// Events returns the channel the events are delivered on. It is closed when
+// the subscription ends.
+func (s *Subscription) Events() <-chan SessionEvent {
+	return s.events
+}
+
+// NewSubscription returns a subscription delivering the events sent on the
+// channel, for implementations of [WatchService] outside this package. The
+// implementation closes the channel when the subscription ends. The events
+// it drops are not counted by [Subscription.Dropped].
+func NewSubscription(events chan SessionEvent) *Subscription {
+	return &Subscription{events: events}
+}
+
+// Dropped returns the number of events dropped because the buffer of the
+// subscription was full.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+type watchKey struct {
+	appName string
+	userID  string
+}
+
+// watchHub fans out published events to the subscribers of a user.
+// The zero value is ready to use.
+type watchHub struct {
+	mu   sync.Mutex
+	subs map[watchKey]map[*Subscription]struct{}
+}
+
+func (h *watchHub) subscribe(ctx context.Context, req *WatchUserRequest) (*Subscription, error) {
+	if req == nil || req.AppName == "" || req.UserID == "" {
+		return nil, fmt.Errorf("app_name and user_id are required")
+	}
+	if req.BufferSize < 0 {
+		return nil, fmt.Errorf("buffer size must not be negative, got %d", req.BufferSize)
+	}
+	size := req.BufferSize
+	if size == 0 {
+		size = defaultWatchBufferSize
+	}
+	sub := &Subscription{events: make(chan SessionEvent, size)}
+	key := watchKey{appName: req.AppName, userID: req.UserID}
+
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[watchKey]map[*Subscription]struct{})
+	}
+	if h.subs[key] == nil {
+		h.subs[key] = make(map[*Subscription]struct{})
+	}
+	h.subs[key][sub] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[key], sub)
+		if len(h.subs[key]) == 0 {
+			delete(h.subs, key)
+		}
+		close(sub.events)
+	}()
+	return sub, nil
+}
+
+// publish delivers the event to the subscribers of the user without
+// blocking; subscribers with a full buffer miss the event.
+func (h *watchHub) publish(appName, userID, sessionID string, event *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[watchKey{appName: appName, userID: userID}] {
+		select {
+		case sub.events <- SessionEvent{SessionID: sessionID, Event: event}:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_inMemoryService_WatchUser(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryService()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sub, err := s.(WatchService).WatchUser(watchCtx, &WatchUserRequest{AppName: "app", UserID: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions created after subscribing are watched, sessions of other
+	// users and apps are not.
+	for _, req := range []*CreateRequest{
+		{AppName: "app", UserID: "user", SessionID: "s1"},
+		{AppName: "app", UserID: "user", SessionID: "s2"},
+		{AppName: "app", UserID: "other", SessionID: "s3"},
+		{AppName: "other", UserID: "user", SessionID: "s4"},
+	} {
+		created, err := s.Create(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"session": req.SessionID})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"s1", "s2"} {
+		select {
+		case got := <-sub.Events():
+			if got.SessionID != want {
+				t.Errorf("got event of session %q, want %q", got.SessionID, want)
+			}
+			if v := got.Event.Actions.StateDelta["session"]; v != want {
+				t.Errorf("got event with delta %v, want the event appended to %q", v, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event of session %q not delivered", want)
+		}
+	}
+
+	cancel()
+	for got := range sub.Events() {
+		t.Errorf("unexpected event of session %q", got.SessionID)
+	}
+}
+
+func Test_inMemoryService_WatchUser_SlowConsumer(t *testing.T) {
+	ctx := t.Context()
+	s := InMemoryService()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sub, err := s.(WatchService).WatchUser(watchCtx, &WatchUserRequest{AppName: "app", UserID: "user", BufferSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := s.Create(ctx, &CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Appending never blocks on a consumer that doesn't read.
+	for i := range 5 {
+		if err := s.AppendEvent(ctx, created.Session, stateEvent(map[string]any{"n": i})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := sub.Dropped(); got != 3 {
+		t.Errorf("Dropped() = %d, want 3", got)
+	}
+	for i := range 2 {
+		got := <-sub.Events()
+		if n := got.Event.Actions.StateDelta["n"]; n != i {
+			t.Errorf("event %d has n = %v, want the oldest events to be kept", i, n)
+		}
+	}
+}
+
+func TestWatchUser_InvalidRequest(t *testing.T) {
+	s := InMemoryService().(WatchService)
+	for _, req := range []*WatchUserRequest{
+		nil,
+		{UserID: "user"},
+		{AppName: "app"},
+		{AppName: "app", UserID: "user", BufferSize: -1},
+	} {
+		if _, err := s.WatchUser(t.Context(), req); err == nil {
+			t.Errorf("WatchUser(%+v) succeeded, want error", req)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"google.golang.org/adk/session"
+)
+
+// NotifyingService wraps the service so that the notifier is notified of
+// the sessions it creates and deletes, and of the events appended to them,
+// including by transactions. Notifications are stored after the change
+// succeeds; a change whose notification can't be stored is logged but not
+// failed, since it is already applied.
+//
+// The returned service implements the optional capabilities like
+// [session.TransactionService]; they fail with an error wrapping
+// [errors.ErrUnsupported] if the wrapped service lacks them.
+func NotifyingService(service session.Service, notifier *Notifier) session.Service {
+	return &notifyingService{service: service, notifier: notifier}
+}
+
+type notifyingService struct {
+	service  session.Service
+	notifier *Notifier
+}
+
+func (s *notifyingService) notify(ctx context.Context, notification Notification) {
+	if err := s.notifier.Notify(context.WithoutCancel(ctx), notification); err != nil {
+		log.Printf("%s notification of session %q lost: %v", notification.Type, notification.SessionID, err)
+	}
+}
+
+func (s *notifyingService) notifyEvent(ctx context.Context, appName, userID, sessionID string, event *session.Event) {
+	s.notify(ctx, Notification{
+		Type:       TypeEventAppended,
+		AppName:    appName,
+		UserID:     userID,
+		SessionID:  sessionID,
+		EventID:    event.ID,
+		Author:     event.Author,
+		StateDelta: event.Actions.StateDelta,
+	})
+}
+
+func (s *notifyingService) Create(ctx context.Context, req *session.CreateRequest) (*session.CreateResponse, error) {
+	resp, err := s.service.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	created := resp.Session
+	s.notify(ctx, Notification{Type: TypeSessionCreated, AppName: created.AppName(), UserID: created.UserID(), SessionID: created.ID()})
+	return resp, nil
+}
+
+func (s *notifyingService) Get(ctx context.Context, req *session.GetRequest) (*session.GetResponse, error) {
+	return s.service.Get(ctx, req)
+}
+
+func (s *notifyingService) List(ctx context.Context, req *session.ListRequest) (*session.ListResponse, error) {
+	return s.service.List(ctx, req)
+}
+
+func (s *notifyingService) Delete(ctx context.Context, req *session.DeleteRequest) error {
+	if err := s.service.Delete(ctx, req); err != nil {
+		return err
+	}
+	s.notify(ctx, Notification{Type: TypeSessionDeleted, AppName: req.AppName, UserID: req.UserID, SessionID: req.SessionID})
+	return nil
+}
+
+func (s *notifyingService) AppendEvent(ctx context.Context, curSession session.Session, event *session.Event) error {
+	if err := s.service.AppendEvent(ctx, curSession, event); err != nil {
+		return err
+	}
+	if event != nil && !event.Partial {
+		s.notifyEvent(ctx, curSession.AppName(), curSession.UserID(), curSession.ID(), event)
+	}
+	return nil
+}
+
+// Transact implements [session.TransactionService].
+func (s *notifyingService) Transact(ctx context.Context, req *session.TransactRequest) (*session.TransactResponse, error) {
+	txService, ok := s.service.(session.TransactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support transactions: %w", s.service, errors.ErrUnsupported)
+	}
+	resp, err := txService.Transact(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range req.Ops {
+		s.notifyEvent(ctx, op.AppName, op.UserID, op.SessionID, op.Event)
+	}
+	return resp, nil
+}
+
+// AppStats implements [session.StatsService].
+func (s *notifyingService) AppStats(ctx context.Context) (map[string]session.AppStats, error) {
+	statsService, ok := s.service.(session.StatsService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not provide statistics: %w", s.service, errors.ErrUnsupported)
+	}
+	return statsService.AppStats(ctx)
+}
+
+// Compact implements [session.CompactionService].
+func (s *notifyingService) Compact(ctx context.Context, req *session.CompactRequest) (*session.CompactResponse, error) {
+	compactionService, ok := s.service.(session.CompactionService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support compaction: %w", s.service, errors.ErrUnsupported)
+	}
+	return compactionService.Compact(ctx, req)
+}
+
+// WatchUser implements [session.WatchService].
+func (s *notifyingService) WatchUser(ctx context.Context, req *session.WatchUserRequest) (*session.Subscription, error) {
+	watchService, ok := s.service.(session.WatchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support watching: %w", s.service, errors.ErrUnsupported)
+	}
+	return watchService.WatchUser(ctx, req)
+}
+
+// AcquireLease implements [session.LeaseService].
+func (s *notifyingService) AcquireLease(ctx context.Context, req *session.AcquireLeaseRequest) (*session.Lease, error) {
+	leaseService, ok := s.service.(session.LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return leaseService.AcquireLease(ctx, req)
+}
+
+// RenewLease implements [session.LeaseService].
+func (s *notifyingService) RenewLease(ctx context.Context, req *session.RenewLeaseRequest) (*session.Lease, error) {
+	leaseService, ok := s.service.(session.LeaseService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return leaseService.RenewLease(ctx, req)
+}
+
+// ReleaseLease implements [session.LeaseService].
+func (s *notifyingService) ReleaseLease(ctx context.Context, req *session.ReleaseLeaseRequest) error {
+	leaseService, ok := s.service.(session.LeaseService)
+	if !ok {
+		return fmt.Errorf("%T does not support leases: %w", s.service, errors.ErrUnsupported)
+	}
+	return leaseService.ReleaseLease(ctx, req)
+}
+
+// Undo implements [session.UndoService].
+func (s *notifyingService) Undo(ctx context.Context, req *session.UndoRequest) (*session.UndoResponse, error) {
+	undoService, ok := s.service.(session.UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	resp, err := undoService.Undo(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	s.notifyEvent(ctx, req.AppName, req.UserID, req.SessionID, resp.Event)
+	return resp, nil
+}
+
+// Redo implements [session.UndoService].
+func (s *notifyingService) Redo(ctx context.Context, req *session.UndoRequest) (*session.UndoResponse, error) {
+	undoService, ok := s.service.(session.UndoService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support undo: %w", s.service, errors.ErrUnsupported)
+	}
+	resp, err := undoService.Redo(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	s.notifyEvent(ctx, req.AppName, req.UserID, req.SessionID, resp.Event)
+	return resp, nil
+}
+
+// Touch implements [session.TouchService]. Touching a session changes
+// nothing clients observe, it isn't notified.
+func (s *notifyingService) Touch(ctx context.Context, req *session.TouchRequest) (*session.TouchResponse, error) {
+	touchService, ok := s.service.(session.TouchService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support touching sessions: %w", s.service, errors.ErrUnsupported)
+	}
+	return touchService.Touch(ctx, req)
+}
+
+// SetLabels implements [session.LabelService]. Labels are operational
+// metadata rather than changes of the session, they aren't notified.
+func (s *notifyingService) SetLabels(ctx context.Context, req *session.SetLabelsRequest) (*session.SetLabelsResponse, error) {
+	labelService, ok := s.service.(session.LabelService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support labels: %w", s.service, errors.ErrUnsupported)
+	}
+	return labelService.SetLabels(ctx, req)
+}
+
+// PinEvent implements [session.PinService]. Pins only decide which events
+// the retention keeps, they aren't notified.
+func (s *notifyingService) PinEvent(ctx context.Context, req *session.PinEventRequest) (*session.PinEventResponse, error) {
+	pinService, ok := s.service.(session.PinService)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support pinning events: %w", s.service, errors.ErrUnsupported)
+	}
+	return pinService.PinEvent(ctx, req)
+}
+
+var (
+	_ session.Service            = (*notifyingService)(nil)
+	_ session.TransactionService = (*notifyingService)(nil)
+	_ session.StatsService       = (*notifyingService)(nil)
+	_ session.CompactionService  = (*notifyingService)(nil)
+	_ session.WatchService       = (*notifyingService)(nil)
+	_ session.LeaseService       = (*notifyingService)(nil)
+	_ session.UndoService        = (*notifyingService)(nil)
+	_ session.TouchService       = (*notifyingService)(nil)
+	_ session.LabelService       = (*notifyingService)(nil)
+	_ session.PinService         = (*notifyingService)(nil)
+)
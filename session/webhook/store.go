@@ -0,0 +1,242 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Store holds the deliveries of a [Notifier]: the pending ones, and the dead
+// letters which exhausted their attempts. A store is used by one notifier
+// at a time.
+type Store interface {
+	// Add stores a new pending delivery of the notification and returns
+	// it, with a sequence number higher than the ones of the deliveries
+	// added before.
+	Add(ctx context.Context, notification Notification) (Delivery, error)
+	// Update stores the attempts of a pending delivery.
+	Update(ctx context.Context, d Delivery) error
+	// Remove deletes a pending delivery once it is delivered.
+	Remove(ctx context.Context, seq uint64) error
+	// DeadLetter moves a pending delivery to the dead letters.
+	DeadLetter(ctx context.Context, d Delivery) error
+	// Pending returns the pending deliveries, by sequence number.
+	Pending(ctx context.Context) ([]Delivery, error)
+	// DeadLetters returns the dead letters, by sequence number.
+	DeadLetters(ctx context.Context) ([]Delivery, error)
+}
+
+// NewMemoryStore returns a [Store] keeping the deliveries in memory. Pending
+// deliveries are lost when the process exits.
+func NewMemoryStore() Store {
+	return &memoryStore{pending: make(map[uint64]Delivery)}
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]Delivery
+	dead    []Delivery
+}
+
+func (s *memoryStore) Add(ctx context.Context, notification Notification) (Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	d := Delivery{Seq: s.seq, Notification: notification}
+	s.pending[d.Seq] = d
+	return d, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, d Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[d.Seq]; !ok {
+		return fmt.Errorf("no pending delivery %d", d.Seq)
+	}
+	s.pending[d.Seq] = d
+	return nil
+}
+
+func (s *memoryStore) Remove(ctx context.Context, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, seq)
+	return nil
+}
+
+func (s *memoryStore) DeadLetter(ctx context.Context, d Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, d.Seq)
+	s.dead = append(s.dead, d)
+	return nil
+}
+
+func (s *memoryStore) Pending(ctx context.Context) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := make([]Delivery, 0, len(s.pending))
+	for _, d := range s.pending {
+		pending = append(pending, d)
+	}
+	slices.SortFunc(pending, func(a, b Delivery) int { return cmp.Compare(a.Seq, b.Seq) })
+	return pending, nil
+}
+
+func (s *memoryStore) DeadLetters(ctx context.Context) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dead := slices.Clone(s.dead)
+	slices.SortFunc(dead, func(a, b Delivery) int { return cmp.Compare(a.Seq, b.Seq) })
+	return dead, nil
+}
+
+// NewDirStore returns a durable [Store] keeping each delivery in a JSON file
+// of the directory, in its pending or dead subdirectory. Files are written
+// to a temporary file, synced and renamed, so a crash leaves either the old
+// or the new version of a delivery.
+func NewDirStore(dir string) (Store, error) {
+	s := &dirStore{dir: dir}
+	for _, sub := range []string{"pending", "dead"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create webhook store: %w", err)
+		}
+	}
+	// Resume the sequence after the deliveries already stored.
+	for _, sub := range []string{"pending", "dead"} {
+		deliveries, err := s.list(sub)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deliveries {
+			s.seq = max(s.seq, d.Seq)
+		}
+	}
+	return s, nil
+}
+
+type dirStore struct {
+	dir string
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+func (s *dirStore) path(sub string, seq uint64) string {
+	// Zero padding makes the file names sort by sequence number.
+	return filepath.Join(s.dir, sub, fmt.Sprintf("%020d.json", seq))
+}
+
+func (s *dirStore) write(sub string, d Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to encode delivery %d: %w", d.Seq, err)
+	}
+	f, err := os.CreateTemp(filepath.Join(s.dir, sub), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(sub, d.Seq))
+}
+
+func (s *dirStore) list(sub string) ([]Delivery, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, sub))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook store: %w", err)
+	}
+	var deliveries []Delivery
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, sub, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook delivery: %w", err)
+		}
+		var d Delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, fmt.Errorf("invalid webhook delivery %s: %w", name, err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	// ReadDir sorts by file name, hence by sequence number.
+	return deliveries, nil
+}
+
+func (s *dirStore) Add(ctx context.Context, notification Notification) (Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := Delivery{Seq: s.seq + 1, Notification: notification}
+	if err := s.write("pending", d); err != nil {
+		return Delivery{}, err
+	}
+	s.seq = d.Seq
+	return d, nil
+}
+
+func (s *dirStore) Update(ctx context.Context, d Delivery) error {
+	return s.write("pending", d)
+}
+
+func (s *dirStore) Remove(ctx context.Context, seq uint64) error {
+	err := os.Remove(s.path("pending", seq))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *dirStore) DeadLetter(ctx context.Context, d Delivery) error {
+	if err := s.write("dead", d); err != nil {
+		return err
+	}
+	return s.Remove(ctx, d.Seq)
+}
+
+func (s *dirStore) Pending(ctx context.Context) ([]Delivery, error) {
+	return s.list("pending")
+}
+
+func (s *dirStore) DeadLetters(ctx context.Context) ([]Delivery, error) {
+	return s.list("dead")
+}
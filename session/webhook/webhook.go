@@ -0,0 +1,333 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook delivers notifications of session lifecycle changes to an
+// HTTP endpoint.
+//
+// A [Notifier] POSTs every [Notification] as JSON to the configured URL.
+// Failed deliveries are retried with jittered exponential backoff;
+// deliveries which exhaust their attempts are moved to the dead letters of
+// the [Store] instead of being dropped. The notifications of a session are
+// delivered in order: a notification is only sent once the previous ones
+// of its session are delivered or dead-lettered. With a durable store, such
+// as the one of [NewDirStore], pending deliveries survive restarts and
+// resume when the next notifier is created.
+//
+// [NotifyingService] wraps a [session.Service] so that its changes are
+// notified.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"google.golang.org/adk/session"
+)
+
+// Notification types.
+const (
+	TypeSessionCreated = "session.created"
+	TypeSessionDeleted = "session.deleted"
+	TypeEventAppended  = "event.appended"
+)
+
+// Notification is the JSON body of a webhook delivery.
+type Notification struct {
+	// ID identifies the notification. It is the same for every attempt to
+	// deliver it, so receivers can discard duplicates.
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	AppName   string    `json:"appName"`
+	UserID    string    `json:"userId"`
+	SessionID string    `json:"sessionId"`
+	// EventID, Author and StateDelta describe the appended event of an
+	// event.appended notification.
+	EventID    string         `json:"eventId,omitempty"`
+	Author     string         `json:"author,omitempty"`
+	StateDelta map[string]any `json:"stateDelta,omitempty"`
+}
+
+// Delivery is a notification waiting to be delivered, or dead-lettered.
+type Delivery struct {
+	// Seq orders the deliveries in the order they were added to the store.
+	Seq          uint64       `json:"seq"`
+	Notification Notification `json:"notification"`
+	// Attempts is the number of failed attempts.
+	Attempts int `json:"attempts"`
+	// LastError is the error of the last failed attempt.
+	LastError string `json:"lastError,omitempty"`
+	// NextAttempt is the earliest time of the next attempt.
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// Config contains the settings of a [Notifier].
+type Config struct {
+	// URL is the endpoint the notifications are POSTed to.
+	URL string
+	// Client sends the notifications. Optional: defaults to a client with a
+	// 10s timeout.
+	Client *http.Client
+	// Store holds the pending deliveries and the dead letters.
+	// Optional: defaults to an in-memory store, lost on restart.
+	Store Store
+	// MaxAttempts is the number of attempts after which a delivery is
+	// dead-lettered. Optional: defaults to 8.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled after
+	// every further failure. Optional: defaults to 1s.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts. Optional: defaults
+	// to 5m.
+	MaxBackoff time.Duration
+	// Jitter randomizes the delay between two attempts within the backoff.
+	// Optional: defaults to [session.JitterFull].
+	Jitter session.Jitter
+	// Rand is the source of the jitter, for instance a seeded one in tests.
+	// Optional: defaults to the global source of math/rand/v2.
+	Rand *rand.Rand
+	// OnDeadLetter is called with every delivery dead-lettered, after it is
+	// moved to the dead letters of the store. Optional.
+	OnDeadLetter func(Delivery)
+}
+
+// Notifier delivers notifications to a webhook. It is safe for concurrent
+// use.
+type Notifier struct {
+	cfg Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// randMu guards cfg.Rand, which is not safe for concurrent use.
+	randMu sync.Mutex
+
+	mu sync.Mutex
+	// queues holds the pending deliveries of each session, in order. A
+	// session has a queue exactly when a worker delivers its notifications.
+	queues map[sessionKey][]Delivery
+}
+
+type sessionKey struct {
+	appName, userID, sessionID string
+}
+
+// NewNotifier returns a notifier delivering to cfg.URL, and resumes the
+// deliveries pending in the store.
+func NewNotifier(cfg Config) (*Notifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook URL is required")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	pending, err := cfg.Store.Pending(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pending webhook deliveries: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{cfg: cfg, ctx: ctx, cancel: cancel, queues: make(map[sessionKey][]Delivery)}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, d := range pending {
+		n.enqueue(d)
+	}
+	return n, nil
+}
+
+// Notify stores the notification and schedules its delivery. It returns
+// once the notification is stored, without waiting for the delivery. The ID
+// and Time of the notification are set if they are empty.
+func (n *Notifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.ID == "" {
+		notification.ID = uuid.NewString()
+	}
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return fmt.Errorf("webhook notifier is closed")
+	}
+	// The store is written under the lock, so the sequence numbers follow
+	// the order of the queues.
+	d, err := n.cfg.Store.Add(ctx, notification)
+	if err != nil {
+		return fmt.Errorf("failed to store webhook notification: %w", err)
+	}
+	n.enqueue(d)
+	return nil
+}
+
+// Close stops the deliveries and waits for the attempts in flight. The
+// deliveries not done yet stay in the store, and are resumed by the next
+// notifier using it.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	n.cancel()
+	n.mu.Unlock()
+	n.wg.Wait()
+	return nil
+}
+
+// enqueue adds the delivery to the queue of its session, starting a worker
+// for the session if it has none. The caller must hold n.mu.
+func (n *Notifier) enqueue(d Delivery) {
+	key := sessionKey{d.Notification.AppName, d.Notification.UserID, d.Notification.SessionID}
+	queue, running := n.queues[key]
+	n.queues[key] = append(queue, d)
+	if !running {
+		n.wg.Add(1)
+		go n.work(key)
+	}
+}
+
+// work delivers the queue of the session in order, until it is empty or
+// the notifier is closed.
+func (n *Notifier) work(key sessionKey) {
+	defer n.wg.Done()
+	for {
+		n.mu.Lock()
+		queue := n.queues[key]
+		if len(queue) == 0 {
+			delete(n.queues, key)
+			n.mu.Unlock()
+			return
+		}
+		d := queue[0]
+		n.mu.Unlock()
+
+		if !n.deliver(d) {
+			return
+		}
+		n.mu.Lock()
+		n.queues[key] = n.queues[key][1:]
+		n.mu.Unlock()
+	}
+}
+
+// deliver attempts the delivery until it succeeds or is dead-lettered,
+// which it reports with true, or until the notifier is closed.
+func (n *Notifier) deliver(d Delivery) bool {
+	for {
+		if wait := time.Until(d.NextAttempt); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-n.ctx.Done():
+				timer.Stop()
+				return false
+			}
+		}
+		err := n.post(d)
+		if err == nil {
+			if err := n.cfg.Store.Remove(n.ctx, d.Seq); err != nil {
+				// The receiver may get the notification again after a
+				// restart, which the notification ID lets it detect.
+				log.Printf("failed to remove delivered webhook notification %s: %v", d.Notification.ID, err)
+			}
+			return true
+		}
+		if n.ctx.Err() != nil {
+			// The attempt was interrupted by Close, it doesn't count.
+			return false
+		}
+
+		d.Attempts++
+		d.LastError = err.Error()
+		if d.Attempts >= n.cfg.MaxAttempts {
+			if err := n.cfg.Store.DeadLetter(n.ctx, d); err != nil {
+				log.Printf("failed to dead-letter webhook notification %s: %v", d.Notification.ID, err)
+			}
+			if n.cfg.OnDeadLetter != nil {
+				n.cfg.OnDeadLetter(d)
+			}
+			return true
+		}
+		d.NextAttempt = time.Now().Add(n.backoff(d.Attempts))
+		if err := n.cfg.Store.Update(n.ctx, d); err != nil {
+			log.Printf("failed to store the attempts of webhook notification %s: %v", d.Notification.ID, err)
+		}
+	}
+}
+
+// backoff returns the delay after the given number of failed attempts,
+// jittered.
+func (n *Notifier) backoff(attempts int) time.Duration {
+	delay := n.cfg.InitialBackoff
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= n.cfg.MaxBackoff {
+			break
+		}
+	}
+	delay = min(delay, n.cfg.MaxBackoff)
+	if n.cfg.Rand != nil {
+		n.randMu.Lock()
+		defer n.randMu.Unlock()
+	}
+	return n.cfg.Jitter.Apply(delay, n.cfg.Rand)
+}
+
+// post sends the notification once. Responses other than 2xx are failures.
+func (n *Notifier) post(d Delivery) error {
+	body, err := json.Marshal(d.Notification)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Delivery", d.Notification.ID)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(d.Attempts+1))
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
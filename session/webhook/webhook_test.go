@@ -0,0 +1,384 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/adk/session"
+)
+
+// receiver is a webhook endpoint failing the first attempts of some
+// notifications.
+type receiver struct {
+	mu sync.Mutex
+	// fail returns whether the attempt of the notification fails.
+	fail func(n Notification, attempt int) bool
+	// attempts counts the requests per notification ID.
+	attempts map[string]int
+	// delivered holds the notifications acknowledged, in order.
+	delivered []Notification
+	changed   chan struct{}
+}
+
+func newReceiver(t *testing.T, fail func(n Notification, attempt int) bool) (*receiver, string) {
+	t.Helper()
+	r := &receiver{fail: fail, attempts: make(map[string]int), changed: make(chan struct{}, 1)}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(req.Body).Decode(&n); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got := req.Header.Get("X-Webhook-Delivery"); got != n.ID {
+			http.Error(rw, "delivery header mismatch", http.StatusBadRequest)
+			return
+		}
+		r.mu.Lock()
+		r.attempts[n.ID]++
+		failed := r.fail != nil && r.fail(n, r.attempts[n.ID])
+		if !failed {
+			r.delivered = append(r.delivered, n)
+		}
+		r.mu.Unlock()
+		select {
+		case r.changed <- struct{}{}:
+		default:
+		}
+		if failed {
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return r, server.URL
+}
+
+// waitDelivered waits until count notifications are delivered and returns
+// them.
+func (r *receiver) waitDelivered(t *testing.T, count int) []Notification {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		r.mu.Lock()
+		delivered := append([]Notification(nil), r.delivered...)
+		r.mu.Unlock()
+		if len(delivered) >= count {
+			return delivered
+		}
+		select {
+		case <-r.changed:
+		case <-deadline:
+			t.Fatalf("%d notifications delivered, want %d", len(delivered), count)
+		}
+	}
+}
+
+func sessionIDs(notifications []Notification, sessionID string) []string {
+	var ids []string
+	for _, n := range notifications {
+		if n.SessionID == sessionID {
+			ids = append(ids, n.ID)
+		}
+	}
+	return ids
+}
+
+func TestNotifier_FlakyReceiver(t *testing.T) {
+	ctx := t.Context()
+	// Every notification fails twice before it is accepted.
+	r, url := newReceiver(t, func(n Notification, attempt int) bool { return attempt <= 2 })
+	store := NewMemoryStore()
+	notifier, err := NewNotifier(Config{URL: url, Store: store, MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+
+	want := map[string][]string{}
+	for i, sessionID := range []string{"s1", "s2", "s1", "s1", "s2"} {
+		n := Notification{ID: sessionID + "-" + string(rune('a'+i)), Type: TypeEventAppended, AppName: "app", UserID: "user", SessionID: sessionID}
+		want[sessionID] = append(want[sessionID], n.ID)
+		if err := notifier.Notify(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivered := r.waitDelivered(t, 5)
+	for sessionID, wantIDs := range want {
+		if diff := cmp.Diff(wantIDs, sessionIDs(delivered, sessionID)); diff != "" {
+			t.Errorf("delivery order of session %s mismatch (-want +got):\n%s", sessionID, diff)
+		}
+	}
+	r.mu.Lock()
+	for id, attempts := range r.attempts {
+		if attempts != 3 {
+			t.Errorf("notification %s was attempted %d times, want 3", id, attempts)
+		}
+	}
+	r.mu.Unlock()
+	// Delivered notifications are removed from the store once their
+	// response is received.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := store.Pending(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d deliveries still pending, want none", len(pending))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNotifier_DeadLetter(t *testing.T) {
+	ctx := t.Context()
+	// The receiver never accepts the poison notification.
+	r, url := newReceiver(t, func(n Notification, attempt int) bool { return n.ID == "poison" })
+	store := NewMemoryStore()
+	deadLetters := make(chan Delivery, 1)
+	notifier, err := NewNotifier(Config{
+		URL:            url,
+		Store:          store,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		OnDeadLetter:   func(d Delivery) { deadLetters <- d },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+
+	for _, id := range []string{"poison", "next"} {
+		if err := notifier.Notify(ctx, Notification{ID: id, Type: TypeEventAppended, AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case d := <-deadLetters:
+		if d.Notification.ID != "poison" || d.Attempts != 3 || d.LastError == "" {
+			t.Errorf("dead-lettered delivery = %+v, want poison after 3 attempts with its error", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("poison notification was not dead-lettered")
+	}
+	// The notifications after the dead letter are still delivered.
+	if delivered := r.waitDelivered(t, 1); delivered[0].ID != "next" {
+		t.Errorf("delivered %q, want the notification after the dead letter", delivered[0].ID)
+	}
+	r.mu.Lock()
+	if attempts := r.attempts["poison"]; attempts != 3 {
+		t.Errorf("poison notification was attempted %d times, want 3", attempts)
+	}
+	r.mu.Unlock()
+
+	dead, err := store.DeadLetters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Notification.ID != "poison" {
+		t.Errorf("dead letters = %+v, want the poison notification", dead)
+	}
+}
+
+func TestNotifier_DurableStoreSurvivesRestart(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	down := true
+	var mu sync.Mutex
+	r, url := newReceiver(t, func(Notification, int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return down
+	})
+
+	store, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier, err := NewNotifier(Config{URL: url, Store: store, InitialBackoff: time.Hour, Jitter: session.JitterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"first", "second"} {
+		if err := notifier.Notify(ctx, Notification{ID: id, Type: TypeEventAppended, AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Wait for the failed first attempt, then stop the process.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := store.Pending(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) == 2 && pending[0].Attempts == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending deliveries = %+v, want a failed attempt", pending)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := notifier.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The receiver comes back, and a new process resumes the deliveries
+	// from the store, in order.
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	store, err = NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := store.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range pending {
+		// Don't wait for the hour of backoff recorded before the restart.
+		pending[i].NextAttempt = time.Time{}
+		if err := store.Update(ctx, pending[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notifier, err = NewNotifier(Config{URL: url, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+	if err := notifier.Notify(ctx, Notification{ID: "third", Type: TypeEventAppended, AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+	delivered := r.waitDelivered(t, 3)
+	if diff := cmp.Diff([]string{"first", "second", "third"}, sessionIDs(delivered, "session")); diff != "" {
+		t.Errorf("delivery order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifyingService(t *testing.T) {
+	ctx := t.Context()
+	r, url := newReceiver(t, nil)
+	notifier, err := NewNotifier(Config{URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+	s := NotifyingService(session.InMemoryService(), notifier)
+
+	created, err := s.Create(ctx, &session.CreateRequest{AppName: "app", UserID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := session.NewEvent("invocation")
+	event.Author = "agent"
+	event.Actions.StateDelta = map[string]any{"step": "done"}
+	if err := s.AppendEvent(ctx, created.Session, event); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.(session.TransactionService).Transact(ctx, &session.TransactRequest{Ops: []session.TransactOp{
+		{AppName: "app", UserID: "user", SessionID: "session", Event: session.NewEvent("transaction")},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, &session.DeleteRequest{AppName: "app", UserID: "user", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered := r.waitDelivered(t, 4)
+	var gotTypes []string
+	for _, n := range delivered {
+		gotTypes = append(gotTypes, n.Type)
+	}
+	if diff := cmp.Diff([]string{TypeSessionCreated, TypeEventAppended, TypeEventAppended, TypeSessionDeleted}, gotTypes); diff != "" {
+		t.Errorf("notification types mismatch (-want +got):\n%s", diff)
+	}
+	if got := delivered[1]; got.EventID != event.ID || got.Author != "agent" || got.StateDelta["step"] != "done" {
+		t.Errorf("event notification = %+v, want the appended event", got)
+	}
+}
+
+func TestNotifier_BackoffJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter session.Jitter
+		// min and max are the bounds of the delay after 1 to 5 failed
+		// attempts, with a backoff doubling from 1s up to 10s.
+		min, max []time.Duration
+	}{
+		{
+			name:   "none",
+			jitter: session.JitterNone,
+			min:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second},
+			max:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second},
+		},
+		{
+			name:   "equal",
+			jitter: session.JitterEqual,
+			min:    []time.Duration{time.Second / 2, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+			max:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second},
+		},
+		{
+			name:   "full",
+			jitter: session.JitterFull,
+			min:    []time.Duration{0, 0, 0, 0, 0},
+			max:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier, err := NewNotifier(Config{
+				URL:            "http://localhost",
+				InitialBackoff: time.Second,
+				MaxBackoff:     10 * time.Second,
+				Jitter:         tt.jitter,
+				Rand:           rand.New(rand.NewPCG(1, 2)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer notifier.Close()
+			for attempts := 1; attempts <= 5; attempts++ {
+				lo, hi := tt.min[attempts-1], tt.max[attempts-1]
+				distinct := map[time.Duration]bool{}
+				for range 100 {
+					d := notifier.backoff(attempts)
+					if d < lo || d > hi {
+						t.Fatalf("backoff after %d attempts = %v, want within [%v, %v]", attempts, d, lo, hi)
+					}
+					distinct[d] = true
+				}
+				// Jittered delays spread over their window.
+				if lo != hi && len(distinct) < 90 {
+					t.Errorf("backoff after %d attempts took %d distinct values out of 100, want them spread", attempts, len(distinct))
+				}
+			}
+		})
+	}
+}